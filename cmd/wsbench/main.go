@@ -0,0 +1,311 @@
+// Command wsbench load tests a session manager. It connects sessions x
+// clients websocket connections, reports the connect rate and the heap
+// each connection costs, then has one client per session send messages
+// and reports the fan-out latency percentiles seen by the others.
+//
+// Without -url it runs against a manager in the same process:
+//
+//	go run ./cmd/wsbench -sessions 100 -clients 50 -messages 20
+//
+// With -url it dials a running server, e.g. the one started by make start,
+// at url/<session key>; the sessions must exist or be auto-registered:
+//
+//	go run ./cmd/wsbench -url ws://localhost:5000/ws -sessions 10 -clients 100
+//
+// The heap figure covers everything in the process, so in-process runs
+// include both ends of every connection.
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chau-t-tran/ws-to-me/ws_manager"
+	"github.com/gorilla/websocket"
+)
+
+type config struct {
+	url         string
+	sessions    int
+	clients     int
+	messages    int
+	size        int
+	concurrency int
+	interval    time.Duration
+	settle      time.Duration
+	timeout     time.Duration
+}
+
+type result struct {
+	connections   int
+	connectTime   time.Duration
+	heapPerConn   float64
+	sent          int
+	expected      int
+	received      int
+	latencies     []time.Duration
+	broadcastTime time.Duration
+}
+
+func main() {
+	cfg := config{}
+	flag.StringVar(&cfg.url, "url", "", "websocket base URL of a running server; empty runs a manager in process")
+	flag.IntVar(&cfg.sessions, "sessions", 10, "number of sessions")
+	flag.IntVar(&cfg.clients, "clients", 10, "clients per session")
+	flag.IntVar(&cfg.messages, "messages", 100, "messages sent per session")
+	flag.IntVar(&cfg.size, "size", 256, "message size in bytes, at least 8")
+	flag.IntVar(&cfg.concurrency, "concurrency", 64, "concurrent dials")
+	flag.DurationVar(&cfg.interval, "interval", 10*time.Millisecond, "pause between messages sent to a session")
+	flag.DurationVar(&cfg.settle, "settle", 200*time.Millisecond, "pause after connecting, so the server has joined every connection to its session")
+	flag.DurationVar(&cfg.timeout, "timeout", 10*time.Second, "how long to wait for messages after the last is sent")
+	flag.Parse()
+
+	res, err := run(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	report(res)
+}
+
+// run connects the clients and sends the messages described by cfg.
+func run(cfg config) (*result, error) {
+	if cfg.sessions < 1 || cfg.clients < 2 {
+		return nil, errors.New("Need at least 1 session and 2 clients per session")
+	}
+	if cfg.size < 8 {
+		cfg.size = 8
+	}
+	if cfg.concurrency < 1 {
+		cfg.concurrency = 1
+	}
+	keys := make([]string, cfg.sessions)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("bench%04d", i)
+	}
+
+	base := cfg.url
+	if base == "" {
+		stop, url, err := startManager(keys)
+		if err != nil {
+			return nil, err
+		}
+		defer stop()
+		base = url
+	}
+	base = strings.TrimSuffix(base, "/")
+
+	res := &result{}
+	before := heapInUse()
+	conns, elapsed, err := connect(base, keys, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, sessionConns := range conns {
+			for _, conn := range sessionConns {
+				conn.Close()
+			}
+		}
+	}()
+	res.connections = cfg.sessions * cfg.clients
+	res.connectTime = elapsed
+	res.heapPerConn = float64(int64(heapInUse())-int64(before)) / float64(res.connections)
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		done = make(chan struct{})
+	)
+	res.expected = cfg.sessions * (cfg.clients - 1) * cfg.messages
+	for _, sessionConns := range conns {
+		// the sender reads too, so echoes to it cannot back up the server
+		go func(conn *websocket.Conn) {
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}(sessionConns[0])
+		for _, conn := range sessionConns[1:] {
+			wg.Add(1)
+			go func(conn *websocket.Conn) {
+				defer wg.Done()
+				latencies := make([]time.Duration, 0, cfg.messages)
+				for len(latencies) < cfg.messages {
+					messageType, data, err := conn.ReadMessage()
+					if err != nil {
+						break
+					}
+					if messageType != websocket.BinaryMessage || len(data) < 8 {
+						continue
+					}
+					sent := int64(binary.BigEndian.Uint64(data))
+					latencies = append(latencies, time.Duration(time.Now().UnixNano()-sent))
+				}
+				mu.Lock()
+				res.latencies = append(res.latencies, latencies...)
+				mu.Unlock()
+			}(conn)
+		}
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	time.Sleep(cfg.settle)
+	start := time.Now()
+	var senders sync.WaitGroup
+	var sendErr error
+	for _, sessionConns := range conns {
+		senders.Add(1)
+		go func(conn *websocket.Conn) {
+			defer senders.Done()
+			payload := make([]byte, cfg.size)
+			for i := 0; i < cfg.messages; i++ {
+				binary.BigEndian.PutUint64(payload, uint64(time.Now().UnixNano()))
+				if err := conn.WriteMessage(websocket.BinaryMessage, payload); err != nil {
+					mu.Lock()
+					sendErr = err
+					mu.Unlock()
+					return
+				}
+				mu.Lock()
+				res.sent++
+				mu.Unlock()
+				time.Sleep(cfg.interval)
+			}
+		}(sessionConns[0])
+	}
+	senders.Wait()
+	if sendErr != nil {
+		return nil, errors.New(
+			fmt.Sprintf("Send failed: %s", sendErr),
+		)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(cfg.timeout):
+		// unblock the readers still waiting for messages that were lost
+		for _, sessionConns := range conns {
+			for _, conn := range sessionConns[1:] {
+				conn.SetReadDeadline(time.Now())
+			}
+		}
+		<-done
+	}
+	res.broadcastTime = time.Since(start)
+	res.received = len(res.latencies)
+	return res, nil
+}
+
+// startManager serves a manager for keys on a local port and returns its
+// websocket base URL.
+func startManager(keys []string) (func(), string, error) {
+	sm := ws_manager.CreateSessionManager(keys, ws_manager.WithLogger(ws_manager.NopLogger()))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", err
+	}
+	server := &http.Server{Handler: sm.Handler()}
+	go server.Serve(listener)
+	stop := func() {
+		server.Close()
+	}
+	return stop, "ws://" + listener.Addr().String(), nil
+}
+
+// connect dials cfg.clients connections to each of keys, at most
+// cfg.concurrency at a time, and returns them by session.
+func connect(base string, keys []string, cfg config) ([][]*websocket.Conn, time.Duration, error) {
+	conns := make([][]*websocket.Conn, len(keys))
+	for i := range conns {
+		conns[i] = make([]*websocket.Conn, cfg.clients)
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		dialErr error
+		slots   = make(chan struct{}, cfg.concurrency)
+	)
+	start := time.Now()
+	for i, key := range keys {
+		for j := 0; j < cfg.clients; j++ {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(i, j int, key string) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				conn, _, err := websocket.DefaultDialer.Dial(base+"/"+key, nil)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					dialErr = err
+					return
+				}
+				conns[i][j] = conn
+			}(i, j, key)
+		}
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	if dialErr != nil {
+		for _, sessionConns := range conns {
+			for _, conn := range sessionConns {
+				if conn != nil {
+					conn.Close()
+				}
+			}
+		}
+		return nil, 0, errors.New(
+			fmt.Sprintf("Dial failed: %s", dialErr),
+		)
+	}
+	return conns, elapsed, nil
+}
+
+func heapInUse() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapInuse
+}
+
+// percentile returns the p-th percentile of sorted.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func report(res *result) {
+	fmt.Printf("connections   %d in %s (%.0f/s)\n",
+		res.connections, res.connectTime.Round(time.Millisecond), float64(res.connections)/res.connectTime.Seconds())
+	fmt.Printf("heap/conn     %.1f KiB\n", res.heapPerConn/1024)
+	fmt.Printf("messages      %d sent, %d of %d deliveries received in %s\n",
+		res.sent, res.received, res.expected, res.broadcastTime.Round(time.Millisecond))
+	sorted := append([]time.Duration(nil), res.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	fmt.Printf("latency       p50 %s  p90 %s  p99 %s  max %s\n",
+		percentile(sorted, 50), percentile(sorted, 90), percentile(sorted, 99), percentile(sorted, 100))
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunInProcess(t *testing.T) {
+	res, err := run(config{sessions: 2, clients: 3, messages: 5, size: 64, concurrency: 4, settle: 100 * time.Millisecond, timeout: 5 * time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, res.connections)
+	assert.Equal(t, 10, res.sent)
+	assert.Equal(t, 20, res.expected)
+	assert.Equal(t, 20, res.received)
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	assert.Equal(t, time.Duration(5), percentile(sorted, 50))
+	assert.Equal(t, time.Duration(9), percentile(sorted, 90))
+	assert.Equal(t, time.Duration(10), percentile(sorted, 100))
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+}
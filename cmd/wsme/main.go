@@ -0,0 +1,315 @@
+// Command wsme talks to a running session manager, for debugging and
+// demos. Sessions are created, tailed and published to over the server's
+// own routes, as set up by server.SetupWSRoutes, and listed and kicked over
+// the admin API of ws_manager.AdminHandler:
+//
+//	wsme create                        register a session and print its key
+//	wsme list                          list the active sessions
+//	wsme tail KEY                      print the messages of a session
+//	wsme publish KEY [FILE]            send each line of FILE, or stdin
+//	wsme kick KEY CLIENT               disconnect a client
+//
+// Every command takes -server, the server's base URL, and list and kick
+// -admin, where the admin API is mounted:
+//
+//	wsme publish -server http://localhost:5000 abcdefgh < notes.txt
+//	wsme list -admin http://localhost:5000/admin
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chau-t-tran/ws-to-me/ws_manager"
+	"github.com/chau-t-tran/ws-to-me/wsclient"
+	"github.com/gorilla/websocket"
+)
+
+const usage = `usage: wsme <command> [flags] [args]
+
+commands:
+  create                   register a session and print its key
+  list                     list the active sessions
+  tail KEY                 print the messages of a session
+  publish KEY [FILE]       send each line of FILE, or stdin, to a session
+  kick KEY CLIENT          disconnect a client
+
+Run wsme <command> -h for the flags of a command.
+`
+
+// headers collects repeated -header flags.
+type headers http.Header
+
+func (h headers) String() string {
+	return ""
+}
+
+func (h headers) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	if !ok {
+		return errors.New(fmt.Sprintf("Header %q is not Name: value", value))
+	}
+	http.Header(h).Add(strings.TrimSpace(name), strings.TrimSpace(val))
+	return nil
+}
+
+// command holds the flags shared by every command.
+type command struct {
+	flags  *flag.FlagSet
+	server string
+	admin  string
+	header headers
+	stdin  io.Reader
+	stdout io.Writer
+	// interrupt stops tail, os.Interrupt unless a test sets it
+	interrupt <-chan struct{}
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr, nil); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run runs the command in args. interrupt stops tail; nil stops it on
+// os.Interrupt.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer, interrupt <-chan struct{}) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return flag.ErrHelp
+	}
+	name, args := args[0], args[1:]
+	cmd := &command{
+		flags:     flag.NewFlagSet("wsme "+name, flag.ContinueOnError),
+		header:    headers{},
+		stdin:     stdin,
+		stdout:    stdout,
+		interrupt: interrupt,
+	}
+	cmd.flags.SetOutput(stderr)
+	cmd.flags.StringVar(&cmd.server, "server", "http://localhost:5000", "base URL of the server")
+	cmd.flags.StringVar(&cmd.admin, "admin", "", "base URL of the admin API, server/admin if empty")
+	cmd.flags.Var(cmd.header, "header", "header sent with every request, as Name: value; repeatable")
+	switch name {
+	case "create":
+		return cmd.create(args)
+	case "list":
+		return cmd.list(args)
+	case "tail":
+		return cmd.tail(args)
+	case "publish":
+		return cmd.publish(args)
+	case "kick":
+		return cmd.kick(args)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stderr, usage)
+		return flag.ErrHelp
+	}
+	fmt.Fprint(stderr, usage)
+	return errors.New(fmt.Sprintf("Unknown command %q", name))
+}
+
+// parse parses the flags of the command and checks it got n arguments, or
+// between n and max.
+func (cmd *command) parse(args []string, n, max int) ([]string, error) {
+	if err := cmd.flags.Parse(args); err != nil {
+		return nil, err
+	}
+	rest := cmd.flags.Args()
+	if len(rest) < n || len(rest) > max {
+		cmd.flags.Usage()
+		return nil, errors.New(fmt.Sprintf("%s takes %d to %d arguments, got %d", cmd.flags.Name(), n, max, len(rest)))
+	}
+	return rest, nil
+}
+
+func (cmd *command) create(args []string) error {
+	if _, err := cmd.parse(args, 0, 0); err != nil {
+		return err
+	}
+	var created ws_manager.SessionRegResponse
+	if err := cmd.request(http.MethodPost, strings.TrimSuffix(cmd.server, "/")+"/register", http.StatusCreated, &created); err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.stdout, created.SessionKey)
+	return nil
+}
+
+func (cmd *command) list(args []string) error {
+	if _, err := cmd.parse(args, 0, 0); err != nil {
+		return err
+	}
+	var sessions []ws_manager.AdminSession
+	if err := cmd.request(http.MethodGet, cmd.adminURL("sessions"), http.StatusOK, &sessions); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(cmd.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SESSION\tCONNECTIONS\tBROADCASTS\tLAST USED")
+	for _, s := range sessions {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", s.SessionKey, s.Connections, s.Broadcasts, s.LastUsed.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func (cmd *command) kick(args []string) error {
+	rest, err := cmd.parse(args, 2, 2)
+	if err != nil {
+		return err
+	}
+	return cmd.request(http.MethodDelete, cmd.adminURL("sessions", rest[0], "clients", rest[1]), http.StatusNoContent, nil)
+}
+
+func (cmd *command) tail(args []string) error {
+	count := cmd.flags.Int("n", 0, "exit after this many messages; zero tails until interrupted")
+	rest, err := cmd.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	client, err := cmd.connect(rest[0])
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	interrupt := cmd.interrupt
+	if interrupt == nil {
+		interrupt = notifyInterrupt()
+	}
+	for seen := 0; *count <= 0 || seen < *count; seen++ {
+		select {
+		case msg, ok := <-client.Messages():
+			if !ok {
+				return errors.New("Connection closed")
+			}
+			if msg.Type == websocket.BinaryMessage {
+				fmt.Fprintln(cmd.stdout, base64.StdEncoding.EncodeToString(msg.Data))
+			} else {
+				fmt.Fprintln(cmd.stdout, string(msg.Data))
+			}
+		case <-interrupt:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (cmd *command) publish(args []string) error {
+	whole := cmd.flags.Bool("whole", false, "send the whole input as one message instead of one per line")
+	binary := cmd.flags.Bool("binary", false, "send binary frames instead of text")
+	rest, err := cmd.parse(args, 1, 2)
+	if err != nil {
+		return err
+	}
+	input := cmd.stdin
+	if len(rest) == 2 {
+		f, err := os.Open(rest[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		input = f
+	}
+	client, err := cmd.connect(rest[0])
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	send := client.Send
+	if *binary {
+		send = client.SendBinary
+	}
+	if *whole {
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return err
+		}
+		return send(data)
+	}
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		if err := send(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// connect dials sessionKey on the server, without reconnecting.
+func (cmd *command) connect(sessionKey string) (*wsclient.Client, error) {
+	base := strings.TrimSuffix(cmd.server, "/")
+	switch {
+	case strings.HasPrefix(base, "https://"):
+		base = "wss://" + strings.TrimPrefix(base, "https://")
+	case strings.HasPrefix(base, "http://"):
+		base = "ws://" + strings.TrimPrefix(base, "http://")
+	}
+	return wsclient.Connect(base, sessionKey,
+		wsclient.WithHeader(http.Header(cmd.header)),
+		wsclient.WithReconnect(0, 0),
+	)
+}
+
+// adminURL returns the admin API URL of the path segments.
+func (cmd *command) adminURL(segments ...string) string {
+	base := cmd.admin
+	if base == "" {
+		base = strings.TrimSuffix(cmd.server, "/") + "/admin"
+	}
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.Join(segments, "/")
+}
+
+// request makes an HTTP request expecting status and decodes the JSON
+// response into v unless it is nil.
+func (cmd *command) request(method, target string, status int, v interface{}) error {
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return err
+	}
+	for name, values := range cmd.header {
+		req.Header[name] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return errors.New(fmt.Sprintf("%s %s: %s: %s", method, target, resp.Status, strings.TrimSpace(string(body))))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// notifyInterrupt returns a channel closed on the first os.Interrupt.
+func notifyInterrupt() <-chan struct{} {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	stop := make(chan struct{})
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		close(stop)
+	}()
+	return stop
+}
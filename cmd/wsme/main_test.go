@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chau-t-tran/ws-to-me/ws_manager"
+	"github.com/chau-t-tran/ws-to-me/wsclient"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// startServer serves sm the way server.SetupWSRoutes does, with the admin
+// API mounted at /admin.
+func startServer(t *testing.T, sessionKeys ...string) (*ws_manager.SessionManager, *httptest.Server) {
+	sm := ws_manager.CreateSessionManager(sessionKeys, ws_manager.WithLogger(ws_manager.NopLogger()))
+	e := echo.New()
+	e.POST("/register", sm.RegisterHandler)
+	e.GET("/:sessionKey", sm.EchoHandler)
+	e.Any("/admin/*", echo.WrapHandler(http.StripPrefix("/admin", sm.AdminHandler())))
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	return sm, server
+}
+
+func waitForConnections(sm *ws_manager.SessionManager, sessionKey string, n int) bool {
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		conns, err := sm.GetSession(sessionKey)
+		if err == nil && len(conns) == n {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCreateAndList(t *testing.T) {
+	sm, server := startServer(t)
+	var stdout bytes.Buffer
+	assert.NoError(t, run([]string{"create", "-server", server.URL}, nil, &stdout, &bytes.Buffer{}, nil))
+	sessionKey := strings.TrimSpace(stdout.String())
+	assert.Equal(t, []string{sessionKey}, sm.ListSessions())
+
+	stdout.Reset()
+	assert.NoError(t, run([]string{"list", "-server", server.URL}, nil, &stdout, &bytes.Buffer{}, nil))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "SESSION"))
+	assert.Equal(t, sessionKey, strings.Fields(lines[1])[0])
+	assert.Equal(t, "0", strings.Fields(lines[1])[1])
+}
+
+func TestTailAndPublish(t *testing.T) {
+	sm, server := startServer(t, "abcdefgh")
+	var tailed bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- run([]string{"tail", "-server", server.URL, "-n", "3", "abcdefgh"}, nil, &tailed, &bytes.Buffer{}, make(chan struct{}))
+	}()
+	assert.True(t, waitForConnections(sm, "abcdefgh", 1))
+
+	stdin := strings.NewReader("hello\nworld\n")
+	assert.NoError(t, run([]string{"publish", "-server", server.URL, "abcdefgh"}, stdin, &bytes.Buffer{}, &bytes.Buffer{}, nil))
+	path := filepath.Join(t.TempDir(), "notes")
+	assert.NoError(t, os.WriteFile(path, []byte{0xff, 0x00}, 0o600))
+	assert.NoError(t, run([]string{"publish", "-server", server.URL, "-whole", "-binary", "abcdefgh", path}, nil, &bytes.Buffer{}, &bytes.Buffer{}, nil))
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("tail did not exit")
+	}
+	assert.Equal(t, "hello\nworld\n/wA=\n", tailed.String())
+}
+
+func TestTailInterrupt(t *testing.T) {
+	_, server := startServer(t, "abcdefgh")
+	interrupt := make(chan struct{})
+	close(interrupt)
+	assert.NoError(t, run([]string{"tail", "-server", server.URL, "abcdefgh"}, nil, &bytes.Buffer{}, &bytes.Buffer{}, interrupt))
+}
+
+func TestKick(t *testing.T) {
+	sm, server := startServer(t, "abcdefgh")
+	client, err := wsclient.Connect(strings.Replace(server.URL, "http", "ws", 1), "abcdefgh", wsclient.WithReconnect(0, 0))
+	assert.NoError(t, err)
+	defer client.Close()
+	assert.True(t, waitForConnections(sm, "abcdefgh", 1))
+
+	assert.NoError(t, run([]string{"kick", "-server", server.URL, "abcdefgh", client.ID()}, nil, &bytes.Buffer{}, &bytes.Buffer{}, nil))
+	assert.True(t, waitForConnections(sm, "abcdefgh", 0))
+
+	err = run([]string{"kick", "-server", server.URL, "abcdefgh", client.ID()}, nil, &bytes.Buffer{}, &bytes.Buffer{}, nil)
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestUsage(t *testing.T) {
+	var stderr bytes.Buffer
+	assert.Error(t, run([]string{"frobnicate"}, nil, &bytes.Buffer{}, &stderr, nil))
+	assert.Contains(t, stderr.String(), "usage: wsme")
+	assert.Error(t, run([]string{"kick", "abcdefgh"}, nil, &bytes.Buffer{}, &bytes.Buffer{}, nil))
+	assert.Error(t, run([]string{"publish", "-header", "nocolon", "abcdefgh"}, nil, &bytes.Buffer{}, &bytes.Buffer{}, nil))
+}
@@ -4,5 +4,5 @@ import "github.com/chau-t-tran/ws-to-me/server"
 
 func main() {
 	e := server.GetServer()
-	e.Logger.Fatal(e.Start(":5000"))
+	e.Logger.Fatal(server.StartServer(e, ":5000"))
 }
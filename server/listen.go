@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ServerOption configures StartServer.
+type ServerOption func(*serverConfig)
+
+type serverConfig struct {
+	listenConfig net.ListenConfig
+	// certFile and keyFile are the PEM files of WithTLS
+	certFile string
+	keyFile  string
+	// autoTLS obtains certificates for WithAutoTLS
+	autoTLS *autocert.Manager
+	// onListen is told the bound address by WithOnListen
+	onListen func(net.Addr)
+}
+
+// WithListenConfig sets the net.ListenConfig used to bind the accept socket,
+// e.g. to enable SO_REUSEPORT through its Control hook so a new process can
+// bind the port before the old one exits, or to tune TCP keepalive.
+func WithListenConfig(lc net.ListenConfig) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.listenConfig = lc
+	}
+}
+
+// WithTLS serves HTTPS, and so wss, with the PEM-encoded certificate and
+// key in certFile and keyFile, for deployments that terminate TLS in the
+// process rather than behind a proxy.
+func WithTLS(certFile, keyFile string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.certFile = certFile
+		cfg.keyFile = keyFile
+	}
+}
+
+// WithAutoTLS serves HTTPS, and so wss, with certificates for hosts issued
+// by Let's Encrypt and cached in cacheDir across restarts. The challenge is
+// answered over TLS on the listener itself, so it has to be reachable on
+// port 443 under every host.
+func WithAutoTLS(cacheDir string, hosts ...string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.autoTLS = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(cacheDir),
+			HostPolicy: autocert.HostWhitelist(hosts...),
+		}
+	}
+}
+
+// WithOnListen calls fn with the address StartServer bound, before it
+// starts accepting, e.g. to learn the port when addr asks for any.
+func WithOnListen(fn func(net.Addr)) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.onListen = fn
+	}
+}
+
+// StartServer binds addr and serves e until the server is shut down.
+func StartServer(e *echo.Echo, addr string, opts ...ServerOption) error {
+	cfg := serverConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return err
+	}
+	ln, err := cfg.listenConfig.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if cfg.onListen != nil {
+		cfg.onListen(ln.Addr())
+	}
+	// The listener is served here rather than handed to echo, whose
+	// Listener fields are only safe to set before e is shared. Serving
+	// e.Server and e.TLSServer keeps e.Shutdown and e.Close working.
+	if tlsConfig == nil {
+		s := e.Server
+		s.Addr = addr
+		s.Handler = e
+		s.ErrorLog = e.StdLogger
+		return s.Serve(ln)
+	}
+	s := e.TLSServer
+	s.Addr = addr
+	s.Handler = e
+	s.ErrorLog = e.StdLogger
+	s.TLSConfig = tlsConfig
+	// WebSocket upgrades need HTTP/1.1, so HTTP/2 is not offered.
+	s.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	return s.Serve(tls.NewListener(ln, tlsConfig))
+}
+
+// tlsConfig returns the TLS configuration of the options, or nil to serve
+// plain HTTP.
+func (cfg *serverConfig) tlsConfig() (*tls.Config, error) {
+	switch {
+	case cfg.autoTLS != nil:
+		tlsConfig := cfg.autoTLS.TLSConfig()
+		protos := []string{}
+		for _, proto := range tlsConfig.NextProtos {
+			if proto != "h2" {
+				protos = append(protos, proto)
+			}
+		}
+		tlsConfig.NextProtos = protos
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return tlsConfig, nil
+	case cfg.certFile != "":
+		cert, err := tls.LoadX509KeyPair(cfg.certFile, cfg.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"http/1.1"},
+			MinVersion:   tls.VersionTLS12,
+		}, nil
+	}
+	return nil, nil
+}
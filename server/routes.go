@@ -12,5 +12,8 @@ func SetupWSRoutes(e *echo.Echo) {
 	e.GET("/", sm.RootHandler)
 	e.GET("/:sessionKey", sm.EchoHandler)
 	e.POST("/register", sm.RegisterHandler)
+	e.GET("/metrics", echo.WrapHandler(sm.PrometheusHandler()))
+	e.GET("/healthz", echo.WrapHandler(sm.HealthHandler()))
+	e.GET("/readyz", echo.WrapHandler(sm.HealthHandler()))
 	fmt.Println("WS routes setup!")
 }
@@ -2,16 +2,26 @@ package server
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
-	"math/rand"
+	"math/big"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/chau-t-tran/ws-to-me/constants"
-	"github.com/chau-t-tran/ws-to-me/utils"
 	"github.com/chau-t-tran/ws-to-me/ws_manager"
+	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -69,10 +79,6 @@ func (suite *RootTestSuite) TestLandingPage() {
 }
 
 func (suite *RootTestSuite) TestRegistrationCall() {
-	rand.Seed(int64(suite.seed))
-	sessionKey := utils.RandomKey()
-	rand.Seed(int64(suite.seed))
-
 	respTarget := ws_manager.SessionRegResponse{}
 	url := fmt.Sprintf("http://localhost:%d/register", suite.PORT)
 	contentType := "application/json"
@@ -85,7 +91,141 @@ func (suite *RootTestSuite) TestRegistrationCall() {
 
 	err = json.NewDecoder(resp.Body).Decode(&respTarget)
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), respTarget.SessionKey, sessionKey)
+	assert.Len(suite.T(), respTarget.SessionKey, ws_manager.DefaultKeyLength)
+
+	wsURL := fmt.Sprintf("ws://localhost:%d/%s", suite.PORT, respTarget.SessionKey)
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if assert.NoError(suite.T(), err) {
+		conn.Close()
+	}
+}
+
+func (suite *RootTestSuite) TestStartServerUsesListenConfig() {
+	controlled := make(chan struct{}, 1)
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			controlled <- struct{}{}
+			return nil
+		},
+	}
+	e := echo.New()
+	e.HideBanner = true
+	e.GET("/health", func(c echo.Context) error {
+		return c.String(http.StatusOK, "Ok")
+	})
+	listening := make(chan net.Addr, 1)
+	go StartServer(e, "127.0.0.1:0", WithListenConfig(lc), WithOnListen(func(addr net.Addr) {
+		listening <- addr
+	}))
+	defer e.Close()
+
+	select {
+	case <-controlled:
+	case <-time.After(5 * time.Second):
+		suite.T().Fatal("listen config was not used")
+	}
+	addr := <-listening
+	resp, err := suite.httpClient.Get(fmt.Sprintf("http://%s/health", addr))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+}
+
+func (suite *RootTestSuite) TestStartServerWithTLS() {
+	certFile, keyFile, pool := writeTestCert(suite.T())
+	e := echo.New()
+	e.HideBanner = true
+	e.GET("/health", func(c echo.Context) error {
+		return c.String(http.StatusOK, "Ok")
+	})
+	listening := make(chan net.Addr, 1)
+	go StartServer(e, "127.0.0.1:0", WithTLS(certFile, keyFile), WithOnListen(func(addr net.Addr) {
+		listening <- addr
+	}))
+	defer e.Close()
+
+	var addr net.Addr
+	select {
+	case addr = <-listening:
+	case <-time.After(5 * time.Second):
+		suite.T().Fatal("server did not listen")
+	}
+	client := http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: pool},
+			ForceAttemptHTTP2: true,
+		},
+	}
+	resp, err := client.Get(fmt.Sprintf("https://%s/health", addr))
+	if assert.NoError(suite.T(), err) {
+		defer resp.Body.Close()
+		assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+		// websocket upgrades need HTTP/1.1
+		assert.Equal(suite.T(), 1, resp.ProtoMajor)
+	}
+}
+
+func (suite *RootTestSuite) TestStartServerStopsOnClose() {
+	e := echo.New()
+	listening := make(chan net.Addr, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- StartServer(e, "127.0.0.1:0", WithOnListen(func(addr net.Addr) {
+			listening <- addr
+		}))
+	}()
+	<-listening
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(suite.T(), e.Close())
+	select {
+	case err := <-done:
+		assert.ErrorIs(suite.T(), err, http.ErrServerClosed)
+	case <-time.After(5 * time.Second):
+		suite.T().Fatal("server did not stop")
+	}
+}
+
+func (suite *RootTestSuite) TestStartServerWithBadCert() {
+	e := echo.New()
+	err := StartServer(e, "127.0.0.1:0", WithTLS("missing.pem", "missing-key.pem"))
+	assert.Error(suite.T(), err)
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and returns
+// its files and a pool trusting it.
+func writeTestCert(t *testing.T) (certFile, keyFile string, pool *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(cryptorand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
 }
 
 /*-------------------Runner-----------------------------*/
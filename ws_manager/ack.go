@@ -0,0 +1,124 @@
+package ws_manager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CloseAckTimeout is the close code sent to a connection that missed too
+// many consecutive acknowledgements.
+const CloseAckTimeout = 4007
+
+// WithAckPolicy requires clients to acknowledge delivered messages. Every
+// message written to a connection is numbered from 1, and the client
+// confirms receipt of everything up to n with a control frame:
+//
+//	{"control":"ack","seq":n}
+//
+// A message not acknowledged within timeout counts as a missed ack, and a
+// connection that misses maxMissed acks in a row is closed with
+// CloseAckTimeout. Any acknowledgement resets the count.
+func WithAckPolicy(timeout time.Duration, maxMissed int) Option {
+	return func(sm *SessionManager) {
+		sm.ackTimeout = timeout
+		sm.ackMaxMissed = maxMissed
+	}
+}
+
+// ackDeadline is when the message numbered seq must have been acknowledged.
+type ackDeadline struct {
+	seq uint64
+	at  time.Time
+}
+
+// trackAckLocked queues the ack deadline of the message just delivered to
+// cl. Each connection has one timer, armed for its oldest deadline. The
+// caller must hold sessionManagerMu.
+func (sm *SessionManager) trackAckLocked(s *session, cl *client) {
+	if sm.ackTimeout <= 0 {
+		return
+	}
+	cl.ackDeadlines = append(cl.ackDeadlines, ackDeadline{seq: cl.delivered, at: time.Now().Add(sm.ackTimeout)})
+	if cl.ackTimer == nil {
+		sessionKey := s.key
+		cl.ackTimer = time.AfterFunc(sm.ackTimeout, func() {
+			sm.expireAcks(sessionKey, cl)
+		})
+	}
+}
+
+// expireAcks counts the passed deadlines of cl that were not acknowledged
+// in time, closing cl after too many, and rearms its timer for the next.
+func (sm *SessionManager) expireAcks(sessionKey string, cl *client) {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok || !s.hasClient(cl) {
+		cl.ackDeadlines, cl.ackTimer = nil, nil
+		return
+	}
+	now := time.Now()
+	for len(cl.ackDeadlines) > 0 && !cl.ackDeadlines[0].at.After(now) {
+		if cl.acked < cl.ackDeadlines[0].seq {
+			cl.missedAcks++
+		}
+		cl.ackDeadlines = cl.ackDeadlines[1:]
+	}
+	if sm.ackMaxMissed > 0 && cl.missedAcks >= sm.ackMaxMissed {
+		cl.ackDeadlines, cl.ackTimer = nil, nil
+		sm.disconnectClientLocked(s, cl, CloseAckTimeout, "too many missed acks")
+		return
+	}
+	if len(cl.ackDeadlines) == 0 {
+		cl.ackTimer = nil
+		return
+	}
+	cl.ackTimer.Reset(cl.ackDeadlines[0].at.Sub(now))
+}
+
+// BroadcastWithAck is BroadcastMessage for messages that must not be lost
+// silently. Delivery continues past failed writes, and delivered counts the
+// recipients the frame was actually written to. Failed writes are returned
+// together as a *BroadcastError. For confirmation from the clients
+// themselves, combine it with WithAckPolicy.
+func (sm *SessionManager) BroadcastWithAck(sessionKey string, senderID string, messageType int, message []byte) (delivered int, err error) {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return 0, sessionNotFound(sessionKey)
+	}
+	messageType, message, allow := sm.prepareBroadcastLocked(s, senderID, messageType, message, nil)
+	if !allow {
+		return 0, nil
+	}
+	delivered, failed, errs := sm.deliverLocked(s, senderID, messageType, message, nil)
+	return delivered, newBroadcastError(failed, errs)
+}
+
+func (sm *SessionManager) ackLocked(cl *client, seq uint64) error {
+	if seq > cl.delivered {
+		return errors.New(
+			fmt.Sprintf("Ack %d from %s is ahead of %d delivered", seq, cl.id, cl.delivered),
+		)
+	}
+	if seq > cl.acked {
+		cl.acked = seq
+	}
+	// acknowledged deadlines can no longer be missed
+	for len(cl.ackDeadlines) > 0 && cl.ackDeadlines[0].seq <= cl.acked {
+		cl.ackDeadlines = cl.ackDeadlines[1:]
+	}
+	cl.missedAcks = 0
+	return nil
+}
+
+func (s *session) hasClient(cl *client) bool {
+	for _, member := range s.clients {
+		if member == cl {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package ws_manager
+
+import (
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type AckTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *AckTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithAckPolicy(100*time.Millisecond, 2),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *AckTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *AckTestSuite) TestAckingConnectionSurvives() {
+	conn, connID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	for i := 1; i <= 3; i++ {
+		assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("update")))
+		_, err := readWithTimeout(conn, time.Second)
+		assert.NoError(suite.T(), err)
+		conn.WriteMessage(1, []byte(fmt.Sprintf(`{"control":"ack","seq":%d}`, i)))
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	stats, err := suite.manager.GetConnectionStats(suite.sessionKey, connID)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), uint64(3), stats.Delivered)
+	assert.Equal(suite.T(), uint64(3), stats.Acked)
+	assert.Equal(suite.T(), 0, stats.MissedAcks)
+}
+
+func (suite *AckTestSuite) TestMissedAcksDisconnect() {
+	conn, connID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("one")))
+	time.Sleep(200 * time.Millisecond)
+	stats, err := suite.manager.GetConnectionStats(suite.sessionKey, connID)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, stats.MissedAcks)
+
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("two")))
+	for {
+		_, _, err = conn.ReadMessage()
+		if err != nil {
+			break
+		}
+	}
+	assert.True(suite.T(), websocket.IsCloseError(err, CloseAckTimeout))
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+}
+
+func (suite *AckTestSuite) TestAckResetsMissedCount() {
+	conn, connID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("one")))
+	time.Sleep(200 * time.Millisecond)
+	conn.WriteMessage(1, []byte(`{"control":"ack","seq":1}`))
+	time.Sleep(50 * time.Millisecond)
+
+	stats, err := suite.manager.GetConnectionStats(suite.sessionKey, connID)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, stats.MissedAcks)
+}
+
+func (suite *AckTestSuite) TestBroadcastWithAckCountsSuccessfulWrites() {
+	healthy, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	_, brokenID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	// force-close writes on the server side of the second connection
+	suite.manager.sessionManagerMu.Lock()
+	tcp := suite.manager.sessions[suite.sessionKey].clients[1].conn.UnderlyingConn().(*net.TCPConn)
+	suite.manager.sessionManagerMu.Unlock()
+	assert.NoError(suite.T(), tcp.CloseWrite())
+
+	delivered, err := suite.manager.BroadcastWithAck(suite.sessionKey, "", websocket.TextMessage, []byte("launch"))
+	assert.Equal(suite.T(), 1, delivered)
+	if assert.IsType(suite.T(), &BroadcastError{}, err) {
+		assert.Contains(suite.T(), err.(*BroadcastError).Failures, brokenID)
+	}
+	message, err := readWithTimeout(healthy, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "launch", message)
+}
+
+func (suite *AckTestSuite) TestOneTimerPerConnection() {
+	manager := CreateSessionManager([]string{suite.sessionKey}, WithAckPolicy(time.Minute, 2))
+	defer manager.cronScheduler.Stop()
+	e := echo.New()
+	e.GET("/:sessionKey", manager.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+	conn, err := dialSession(server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(manager, suite.sessionKey, 1))
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(suite.T(), manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("update")))
+		_, err := readWithTimeout(conn, time.Second)
+		assert.NoError(suite.T(), err)
+	}
+	manager.rlockSession(suite.sessionKey)
+	cl := manager.sessions[suite.sessionKey].clients[0]
+	timer := cl.ackTimer
+	assert.NotNil(suite.T(), timer)
+	assert.Len(suite.T(), cl.ackDeadlines, 3)
+	manager.runlockSession(suite.sessionKey)
+
+	conn.WriteMessage(1, []byte(`{"control":"ack","seq":2}`))
+	assert.Eventually(suite.T(), func() bool {
+		manager.rlockSession(suite.sessionKey)
+		defer manager.runlockSession(suite.sessionKey)
+		return len(cl.ackDeadlines) == 1 && cl.ackTimer == timer
+	}, time.Second, 5*time.Millisecond)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestAckTestSuite(t *testing.T) {
+	suite.Run(t, new(AckTestSuite))
+}
@@ -0,0 +1,151 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type (
+	AdminSession struct {
+		SessionKey  string    `json:"sessionKey"`
+		Connections int       `json:"connections"`
+		Broadcasts  uint64    `json:"broadcasts"`
+		CreatedAt   time.Time `json:"createdAt"`
+		LastUsed    time.Time `json:"lastUsed"`
+	}
+
+	AdminClient struct {
+		ID         string    `json:"id"`
+		RemoteAddr string    `json:"remoteAddr"`
+		JoinedAt   time.Time `json:"joinedAt"`
+		Identity   string    `json:"identity,omitempty"`
+		Name       string    `json:"name,omitempty"`
+		Role       string    `json:"role"`
+	}
+
+	AdminSessionDetail struct {
+		AdminSession
+		Clients []AdminClient `json:"clients"`
+	}
+
+	AdminGCResponse struct {
+		Evicted int `json:"evicted"`
+	}
+)
+
+// AdminHandler serves ops endpoints for the manager, relative to wherever
+// it is mounted, e.g. with http.StripPrefix("/admin", sm.AdminHandler()):
+//
+//	GET    /sessions                     list sessions
+//	GET    /sessions/{key}               one session and its clients
+//	DELETE /sessions/{key}               close a session
+//	DELETE /sessions/{key}/clients/{id}  kick a client
+//	POST   /gc?ttl=1h                    collect sessions idle for longer than ttl
+//
+// The ttl defaults to the WithGC ttl, or a day. The endpoints do no
+// authentication of their own; guard them with the router's middleware.
+func (sm *SessionManager) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch {
+		case len(parts) == 1 && parts[0] == "sessions" && r.Method == http.MethodGet:
+			sm.adminListSessions(w)
+		case len(parts) == 2 && parts[0] == "sessions" && r.Method == http.MethodGet:
+			sm.adminGetSession(w, parts[1])
+		case len(parts) == 2 && parts[0] == "sessions" && r.Method == http.MethodDelete:
+			sm.adminCloseSession(w, parts[1])
+		case len(parts) == 4 && parts[0] == "sessions" && parts[2] == "clients" && r.Method == http.MethodDelete:
+			if err := sm.KickClient(parts[1], parts[3], "kicked"); err != nil {
+				plainText(w, http.StatusNotFound, err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case len(parts) == 1 && parts[0] == "gc" && r.Method == http.MethodPost:
+			sm.adminCollectGarbage(w, r)
+		default:
+			plainText(w, http.StatusNotFound, "Not found")
+		}
+	})
+}
+
+func (sm *SessionManager) adminListSessions(w http.ResponseWriter) {
+	stats := sm.ListSessionsDetailed()
+	sessions := make([]AdminSession, len(stats))
+	for i, st := range stats {
+		sessions[i] = adminSession(st)
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+func (sm *SessionManager) adminGetSession(w http.ResponseWriter, sessionKey string) {
+	stats, err := sm.GetSessionStats(sessionKey)
+	if err != nil {
+		plainText(w, http.StatusNotFound, err.Error())
+		return
+	}
+	clients, err := sm.GetClients(sessionKey)
+	if err != nil {
+		plainText(w, http.StatusNotFound, err.Error())
+		return
+	}
+	detail := AdminSessionDetail{AdminSession: adminSession(stats), Clients: make([]AdminClient, len(clients))}
+	for i, cl := range clients {
+		detail.Clients[i] = AdminClient{
+			ID:         cl.ID,
+			RemoteAddr: cl.RemoteAddr,
+			JoinedAt:   cl.JoinedAt,
+			Identity:   cl.Identity,
+			Name:       cl.Name,
+			Role:       cl.Role,
+		}
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+func (sm *SessionManager) adminCloseSession(w http.ResponseWriter, sessionKey string) {
+	if _, err := sm.GetSessionStats(sessionKey); err != nil {
+		plainText(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err := sm.CloseSession(sessionKey, websocket.CloseNormalClosure, "session closed"); err != nil {
+		sm.logger.Warn("Admin close incomplete", "session", sessionKey, "err", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (sm *SessionManager) adminCollectGarbage(w http.ResponseWriter, r *http.Request) {
+	ttl := sm.gcTTL
+	if ttl <= 0 {
+		ttl = sm.maxAliveTime
+	}
+	if raw := r.URL.Query().Get("ttl"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			plainText(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		ttl = parsed
+	}
+	writeJSON(w, http.StatusOK, AdminGCResponse{Evicted: sm.CollectGarbage(ttl)})
+}
+
+func adminSession(st SessionStats) AdminSession {
+	return AdminSession{
+		SessionKey:  st.SessionKey,
+		Connections: st.Connections,
+		Broadcasts:  st.Broadcasts,
+		CreatedAt:   st.CreatedAt,
+		LastUsed:    st.LastUsed,
+	}
+}
+
+// writeJSON writes v as a JSON response the way echo's Context.JSON does.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+	return json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,123 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type AdminTestSuite struct {
+	suite.Suite
+	manager *SessionManager
+	server  *httptest.Server
+	admin   *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *AdminTestSuite) SetupTest() {
+	suite.manager = CreateSessionManager([]string{"roomone", "roomtwo"}, WithLogger(NopLogger()))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+	mux := http.NewServeMux()
+	mux.Handle("/admin/", http.StripPrefix("/admin", suite.manager.AdminHandler()))
+	suite.admin = httptest.NewServer(mux)
+}
+
+func (suite *AdminTestSuite) TearDownTest() {
+	suite.admin.Close()
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+func (suite *AdminTestSuite) do(method, path string) *http.Response {
+	req, err := http.NewRequest(method, suite.admin.URL+"/admin"+path, nil)
+	assert.NoError(suite.T(), err)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(suite.T(), err)
+	return resp
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *AdminTestSuite) TestInspectSessions() {
+	conn, clientID, err := dialSessionWithID(suite.server, "roomone", "name=alice")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 1))
+
+	resp := suite.do(http.MethodGet, "/sessions")
+	defer resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+	var sessions []AdminSession
+	assert.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&sessions))
+	if assert.Len(suite.T(), sessions, 2) {
+		assert.Equal(suite.T(), "roomone", sessions[0].SessionKey)
+		assert.Equal(suite.T(), 1, sessions[0].Connections)
+		assert.False(suite.T(), sessions[0].LastUsed.IsZero())
+	}
+
+	resp = suite.do(http.MethodGet, "/sessions/roomone")
+	defer resp.Body.Close()
+	var detail AdminSessionDetail
+	assert.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&detail))
+	if assert.Len(suite.T(), detail.Clients, 1) {
+		assert.Equal(suite.T(), clientID, detail.Clients[0].ID)
+		assert.Equal(suite.T(), "alice", detail.Clients[0].Name)
+	}
+
+	assert.Equal(suite.T(), http.StatusNotFound, suite.do(http.MethodGet, "/sessions/missing").StatusCode)
+	assert.Equal(suite.T(), http.StatusNotFound, suite.do(http.MethodPut, "/sessions").StatusCode)
+}
+
+func (suite *AdminTestSuite) TestKickAndClose() {
+	kicked, kickedID, err := dialSessionWithID(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	member, err := dialSession(suite.server, "roomtwo", "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 1))
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomtwo", 1))
+
+	assert.Equal(suite.T(), http.StatusNoContent, suite.do(http.MethodDelete, "/sessions/roomone/clients/"+kickedID).StatusCode)
+	_, err = readWithTimeout(kicked, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.ClosePolicyViolation))
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 0))
+	assert.Equal(suite.T(), http.StatusNotFound, suite.do(http.MethodDelete, "/sessions/roomone/clients/"+kickedID).StatusCode)
+
+	assert.Equal(suite.T(), http.StatusNoContent, suite.do(http.MethodDelete, "/sessions/roomtwo").StatusCode)
+	_, err = readWithTimeout(member, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.CloseNormalClosure))
+	assert.Equal(suite.T(), []string{"roomone"}, suite.manager.ListSessions())
+	assert.Equal(suite.T(), http.StatusNotFound, suite.do(http.MethodDelete, "/sessions/roomtwo").StatusCode)
+}
+
+func (suite *AdminTestSuite) TestTriggerGC() {
+	time.Sleep(50 * time.Millisecond)
+	resp := suite.do(http.MethodPost, "/gc?ttl=1h")
+	defer resp.Body.Close()
+	var gc AdminGCResponse
+	assert.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&gc))
+	assert.Equal(suite.T(), 0, gc.Evicted)
+
+	resp = suite.do(http.MethodPost, "/gc?ttl=10ms")
+	defer resp.Body.Close()
+	assert.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&gc))
+	assert.Equal(suite.T(), 2, gc.Evicted)
+	assert.Empty(suite.T(), suite.manager.ListSessions())
+
+	assert.Equal(suite.T(), http.StatusBadRequest, suite.do(http.MethodPost, "/gc?ttl=soon").StatusCode)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestAdminTestSuite(t *testing.T) {
+	suite.Run(t, new(AdminTestSuite))
+}
@@ -0,0 +1,71 @@
+package ws_manager
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// WithAffinityCookie also hands out the resume token of WithResume in a
+// cookie named name, signed with secret, so a browser reconnecting to the
+// same session URL reclaims its client without the page keeping the token.
+// The cookie is Secure, HttpOnly and SameSite=Strict, and scoped to the
+// session's path. A "resume" query parameter takes precedence over it, and
+// a cookie that fails verification is ignored. Without WithResume it has no
+// effect.
+func WithAffinityCookie(name string, secret []byte) Option {
+	return func(sm *SessionManager) {
+		sm.affinityCookie = name
+		sm.affinitySecret = secret
+	}
+}
+
+// affinityToken returns the resume token held by the affinity cookie of r,
+// or "" if there is no valid one.
+func (sm *SessionManager) affinityToken(sessionKey string, r *http.Request) string {
+	if sm.affinityCookie == "" {
+		return ""
+	}
+	cookie, err := r.Cookie(sm.affinityCookie)
+	if err != nil {
+		return ""
+	}
+	i := strings.LastIndexByte(cookie.Value, '.')
+	if i < 0 {
+		return ""
+	}
+	token := cookie.Value[:i]
+	if !hmac.Equal([]byte(cookie.Value[i+1:]), []byte(sm.signAffinity(sessionKey, token))) {
+		return ""
+	}
+	return token
+}
+
+// setAffinityCookie adds the cookie carrying token to the upgrade response
+// header.
+func (sm *SessionManager) setAffinityCookie(header http.Header, sessionKey string, r *http.Request, token string) {
+	if sm.affinityCookie == "" {
+		return
+	}
+	cookie := &http.Cookie{
+		Name:     sm.affinityCookie,
+		Value:    token + "." + sm.signAffinity(sessionKey, token),
+		Path:     r.URL.Path,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	}
+	header.Add("Set-Cookie", cookie.String())
+}
+
+// signAffinity binds token to sessionKey, so a cookie cannot be replayed
+// against another session.
+func (sm *SessionManager) signAffinity(sessionKey, token string) string {
+	mac := hmac.New(sha256.New, sm.affinitySecret)
+	mac.Write([]byte(sessionKey))
+	mac.Write([]byte{0})
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,71 @@
+package ws_manager
+
+import (
+	"time"
+)
+
+// AuditEntry records a single broadcast for moderation review.
+type AuditEntry struct {
+	SenderIdentity string
+	SenderID       string
+	Time           time.Time
+	Message        string
+}
+
+// WithAuditRetention keeps an audit log of every broadcast in each session,
+// holding at most maxEntries entries no older than maxAge. A zero for either
+// bound leaves it unlimited; auditing is off unless this option is given.
+func WithAuditRetention(maxEntries int, maxAge time.Duration) Option {
+	return func(sm *SessionManager) {
+		sm.auditEnabled = true
+		sm.auditMaxEntries = maxEntries
+		sm.auditMaxAge = maxAge
+	}
+}
+
+// GetAuditLog returns the session's audit entries recorded at or after
+// since, oldest first.
+func (sm *SessionManager) GetAuditLog(sessionKey string, since time.Time) ([]AuditEntry, error) {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return nil, sessionNotFound(sessionKey)
+	}
+	sm.pruneAuditLocked(s, time.Now())
+	entries := []AuditEntry{}
+	for _, entry := range s.audit {
+		if !entry.Time.Before(since) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (sm *SessionManager) auditLocked(s *session, senderID, senderIdentity string, message []byte, now time.Time) {
+	if !sm.auditEnabled {
+		return
+	}
+	s.audit = append(s.audit, AuditEntry{
+		SenderIdentity: senderIdentity,
+		SenderID:       senderID,
+		Time:           now,
+		Message:        string(message),
+	})
+	sm.pruneAuditLocked(s, now)
+}
+
+func (sm *SessionManager) pruneAuditLocked(s *session, now time.Time) {
+	drop := 0
+	if sm.auditMaxEntries > 0 && len(s.audit) > sm.auditMaxEntries {
+		drop = len(s.audit) - sm.auditMaxEntries
+	}
+	if sm.auditMaxAge > 0 {
+		for drop < len(s.audit) && now.Sub(s.audit[drop].Time) > sm.auditMaxAge {
+			drop++
+		}
+	}
+	if drop > 0 {
+		s.audit = append([]AuditEntry{}, s.audit[drop:]...)
+	}
+}
@@ -0,0 +1,192 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Audit events recorded by WithAuditSink, besides the session lifecycle
+// events of WithWebhooks, such as WebhookSessionCreated.
+const (
+	// AuditJoin is recorded when a connection joins a session.
+	AuditJoin = "join"
+	// AuditLeave is recorded when a connection has left its session, with
+	// how it was closed.
+	AuditLeave = "leave"
+	// AuditKick is recorded when a connection is kicked, ahead of its
+	// leave event.
+	AuditKick = "kick"
+	// AuditBroadcast is recorded for every broadcast.
+	AuditBroadcast = "broadcast"
+)
+
+const auditQueueSize = 1024
+
+// AuditEvent is a structured record of session activity, written by
+// JSONAuditSink as one line:
+//
+//	{"time":"2023-11-14T22:13:20.123Z","event":"join","sessionKey":"abcdefgh","clientID":"7","identity":"alice","remoteAddr":"10.0.0.7:52114","role":"participant"}
+type AuditEvent struct {
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"`
+	SessionKey string    `json:"sessionKey"`
+	// ClientID and Identity are the connection the event is about, or
+	// the sender of a broadcast
+	ClientID   string `json:"clientID,omitempty"`
+	Identity   string `json:"identity,omitempty"`
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	Role       string `json:"role,omitempty"`
+	// Code, Reason and ByServer tell how a connection left, see
+	// CloseInfo; Reason is also the reason of a kick
+	Code     int    `json:"code,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	ByServer bool   `json:"byServer,omitempty"`
+	// MessageType, Bytes and Seq describe a broadcast, and Payload holds
+	// it if WithAuditSink was asked to record payloads
+	MessageType int    `json:"messageType,omitempty"`
+	Bytes       int    `json:"bytes,omitempty"`
+	Seq         uint64 `json:"seq,omitempty"`
+	Payload     []byte `json:"payload,omitempty"`
+}
+
+// AuditSink stores audit events, e.g. in a file, a log pipeline or a
+// database. WriteAuditEvent is called from a single goroutine, in the order
+// the events happened.
+type AuditSink interface {
+	WriteAuditEvent(event AuditEvent) error
+}
+
+// WithAuditSink records who was in which session when: joins, leaves,
+// kicks, session lifecycle events and the metadata of every broadcast are
+// written to sink as AuditEvents. Payloads are recorded only if payloads is
+// set. Events are queued and written from a single goroutine, so a slow
+// sink never holds up sessions; should the queue overflow, events are
+// dropped with a log line. Shutdown writes the queued events once the
+// connections are closed. The manager never closes sink.
+//
+// This is separate from WithAuditRetention, which keeps the broadcasts of
+// each session in memory for moderation review.
+func WithAuditSink(sink AuditSink, payloads bool) Option {
+	return func(sm *SessionManager) {
+		sm.auditSink = sink
+		sm.auditPayloads = payloads
+	}
+}
+
+// JSONAuditSink returns a sink writing each event to w as a line of JSON,
+// e.g. to os.Stdout for a log collector. See NewFileAuditSink for a file
+// that rotates.
+func JSONAuditSink(w io.Writer) AuditSink {
+	return &jsonAuditSink{enc: json.NewEncoder(w)}
+}
+
+type jsonAuditSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (s *jsonAuditSink) WriteAuditEvent(event AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(event)
+}
+
+// recordAudit queues event for the audit sink.
+func (sm *SessionManager) recordAudit(event AuditEvent) {
+	if sm.auditSink == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	select {
+	case sm.auditQueue <- event:
+	default:
+		sm.logger.Warn("Audit queue full, event dropped", "event", event.Event, "session", event.SessionKey)
+	}
+}
+
+// auditEventOf returns event about cl in sessionKey.
+func auditEventOf(event string, sessionKey string, cl *client) AuditEvent {
+	return AuditEvent{
+		Event:      event,
+		SessionKey: sessionKey,
+		ClientID:   cl.id,
+		Identity:   cl.identity,
+		RemoteAddr: cl.addr,
+		Role:       cl.role,
+	}
+}
+
+// auditLeave queues the leave event of cl, with how it was closed.
+func (sm *SessionManager) auditLeave(sessionKey string, cl *client) {
+	if sm.auditSink == nil {
+		return
+	}
+	info := cl.closeInfo()
+	event := auditEventOf(AuditLeave, sessionKey, cl)
+	event.Code, event.Reason, event.ByServer = info.Code, info.Reason, info.ByServer
+	sm.recordAudit(event)
+}
+
+// auditBroadcast queues the metadata of a broadcast of message from
+// senderID.
+func (sm *SessionManager) auditBroadcast(s *session, senderID, senderIdentity string, messageType int, message []byte, now time.Time, seq uint64) {
+	if sm.auditSink == nil {
+		return
+	}
+	event := AuditEvent{
+		Time:        now,
+		Event:       AuditBroadcast,
+		SessionKey:  s.key,
+		ClientID:    senderID,
+		Identity:    senderIdentity,
+		MessageType: messageType,
+		Bytes:       len(message),
+		Seq:         seq,
+	}
+	if sm.auditPayloads {
+		event.Payload = append([]byte{}, message...)
+	}
+	sm.recordAudit(event)
+}
+
+// writeAudit hands queued events to the audit sink until stopAudit is
+// called, then writes what is left.
+func (sm *SessionManager) writeAudit() {
+	defer close(sm.auditDone)
+	for {
+		select {
+		case event := <-sm.auditQueue:
+			sm.writeAuditEvent(event)
+		case <-sm.auditStop:
+			for {
+				select {
+				case event := <-sm.auditQueue:
+					sm.writeAuditEvent(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (sm *SessionManager) writeAuditEvent(event AuditEvent) {
+	if err := sm.auditSink.WriteAuditEvent(event); err != nil {
+		sm.logger.Warn("Audit sink failed", "event", event.Event, "session", event.SessionKey, "err", err)
+	}
+}
+
+// stopAudit writes the queued events and stops the audit writer.
+func (sm *SessionManager) stopAudit() {
+	if sm.auditSink == nil {
+		return
+	}
+	sm.auditStopOnce.Do(func() {
+		close(sm.auditStop)
+	})
+	<-sm.auditDone
+}
@@ -0,0 +1,153 @@
+package ws_manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// chanAuditSink hands the events written to it to a channel.
+type chanAuditSink chan AuditEvent
+
+func (c chanAuditSink) WriteAuditEvent(event AuditEvent) error {
+	c <- event
+	return nil
+}
+
+type AuditSinkTestSuite struct {
+	suite.Suite
+	sessionKey string
+	events     chanAuditSink
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *AuditSinkTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.events = make(chanAuditSink, 64)
+	suite.manager = CreateSessionManager([]string{suite.sessionKey},
+		WithAuditSink(suite.events, false),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *AuditSinkTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+// nextEvent returns the next audit event other than a session lifecycle
+// one.
+func (suite *AuditSinkTestSuite) nextEvent() AuditEvent {
+	for {
+		select {
+		case event := <-suite.events:
+			if strings.HasPrefix(event.Event, "session.") {
+				continue
+			}
+			return event
+		case <-time.After(time.Second):
+			suite.T().Fatal("no audit event")
+			return AuditEvent{}
+		}
+	}
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *AuditSinkTestSuite) TestConnectionActivity() {
+	conn, id, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	event := suite.nextEvent()
+	assert.Equal(suite.T(), AuditJoin, event.Event)
+	assert.Equal(suite.T(), suite.sessionKey, event.SessionKey)
+	assert.Equal(suite.T(), id, event.ClientID)
+	assert.NotEmpty(suite.T(), event.RemoteAddr)
+	assert.False(suite.T(), event.Time.IsZero())
+
+	suite.manager.Broadcast(suite.sessionKey, "", websocket.TextMessage, []byte("secret"))
+	event = suite.nextEvent()
+	assert.Equal(suite.T(), AuditBroadcast, event.Event)
+	assert.Equal(suite.T(), websocket.TextMessage, event.MessageType)
+	assert.Equal(suite.T(), 6, event.Bytes)
+	assert.Nil(suite.T(), event.Payload)
+
+	assert.NoError(suite.T(), suite.manager.KickClient(suite.sessionKey, id, "spam"))
+	event = suite.nextEvent()
+	assert.Equal(suite.T(), AuditKick, event.Event)
+	assert.Equal(suite.T(), id, event.ClientID)
+	assert.Equal(suite.T(), "spam", event.Reason)
+	event = suite.nextEvent()
+	assert.Equal(suite.T(), AuditLeave, event.Event)
+	assert.Equal(suite.T(), websocket.ClosePolicyViolation, event.Code)
+	assert.True(suite.T(), event.ByServer)
+}
+
+func (suite *AuditSinkTestSuite) TestPayloads() {
+	sm := CreateSessionManager([]string{suite.sessionKey},
+		WithAuditSink(suite.events, true),
+	)
+	defer sm.cronScheduler.Stop()
+	sm.Broadcast(suite.sessionKey, "", websocket.TextMessage, []byte("hello"))
+	event := suite.nextEvent()
+	assert.Equal(suite.T(), AuditBroadcast, event.Event)
+	assert.Equal(suite.T(), []byte("hello"), event.Payload)
+}
+
+func (suite *AuditSinkTestSuite) TestShutdownFlushes() {
+	var buf bytes.Buffer
+	sm := CreateSessionManager([]string{suite.sessionKey},
+		WithAuditSink(JSONAuditSink(&buf), false),
+	)
+	sm.Broadcast(suite.sessionKey, "", websocket.TextMessage, []byte("hello"))
+	assert.NoError(suite.T(), sm.Shutdown(context.Background()))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var event AuditEvent
+	assert.NoError(suite.T(), json.Unmarshal([]byte(lines[0]), &event))
+	assert.Equal(suite.T(), AuditBroadcast, event.Event)
+	assert.Equal(suite.T(), 5, event.Bytes)
+}
+
+func (suite *AuditSinkTestSuite) TestFileRotation() {
+	path := filepath.Join(suite.T().TempDir(), "audit.log")
+	sink, err := NewFileAuditSink(path, 200, 2)
+	assert.NoError(suite.T(), err)
+	defer sink.Close()
+	for i := 0; i < 10; i++ {
+		assert.NoError(suite.T(), sink.WriteAuditEvent(AuditEvent{Time: time.Now(), Event: AuditJoin, SessionKey: suite.sessionKey}))
+	}
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		assert.NoError(suite.T(), err)
+		assert.LessOrEqual(suite.T(), info.Size(), int64(200))
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(suite.T(), os.IsNotExist(err))
+
+	assert.NoError(suite.T(), sink.Rotate())
+	info, err := os.Stat(path)
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), info.Size())
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestAuditSinkTestSuite(t *testing.T) {
+	suite.Run(t, new(AuditSinkTestSuite))
+}
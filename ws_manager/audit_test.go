@@ -0,0 +1,112 @@
+package ws_manager
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type AuditTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *AuditTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+}
+
+func (suite *AuditTestSuite) TearDownTest() {
+	if suite.server != nil {
+		suite.server.Close()
+		suite.server = nil
+	}
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *AuditTestSuite) TestRecordsSenderAttribution() {
+	suite.manager = CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithAuth(headerAuth),
+		WithAuditRetention(100, time.Hour),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+
+	bob, _, err := dialSessionAs(suite.server, suite.sessionKey, "bob")
+	assert.NoError(suite.T(), err)
+	alice, resp, err := dialSessionAs(suite.server, suite.sessionKey, "alice")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	start := time.Now()
+	alice.WriteMessage(1, []byte("hello bob"))
+	_, err = readWithTimeout(bob, time.Second)
+	assert.NoError(suite.T(), err)
+
+	entries, err := suite.manager.GetAuditLog(suite.sessionKey, start)
+	assert.NoError(suite.T(), err)
+	if assert.Len(suite.T(), entries, 1) {
+		assert.Equal(suite.T(), "alice", entries[0].SenderIdentity)
+		assert.Equal(suite.T(), resp.Header.Get(ClientIDHeader), entries[0].SenderID)
+		assert.Equal(suite.T(), "hello bob", entries[0].Message)
+	}
+
+	entries, err = suite.manager.GetAuditLog(suite.sessionKey, time.Now())
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), entries, 0)
+}
+
+func (suite *AuditTestSuite) TestRetentionByCount() {
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithAuditRetention(2, 0))
+	for _, message := range []string{"one", "two", "three"} {
+		assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte(message)))
+	}
+	entries, err := suite.manager.GetAuditLog(suite.sessionKey, time.Time{})
+	assert.NoError(suite.T(), err)
+	if assert.Len(suite.T(), entries, 2) {
+		assert.Equal(suite.T(), "two", entries[0].Message)
+		assert.Equal(suite.T(), "three", entries[1].Message)
+	}
+}
+
+func (suite *AuditTestSuite) TestRetentionByAge() {
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithAuditRetention(0, 100*time.Millisecond))
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("old")))
+	time.Sleep(150 * time.Millisecond)
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("new")))
+
+	entries, err := suite.manager.GetAuditLog(suite.sessionKey, time.Time{})
+	assert.NoError(suite.T(), err)
+	if assert.Len(suite.T(), entries, 1) {
+		assert.Equal(suite.T(), "new", entries[0].Message)
+	}
+}
+
+func (suite *AuditTestSuite) TestAuditOffByDefault() {
+	suite.manager = CreateSessionManager([]string{suite.sessionKey})
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("hi")))
+	entries, err := suite.manager.GetAuditLog(suite.sessionKey, time.Time{})
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), entries, 0)
+
+	_, err = suite.manager.GetAuditLog("missing", time.Time{})
+	assert.EqualError(suite.T(), err, "Session missing not found")
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestAuditTestSuite(t *testing.T) {
+	suite.Run(t, new(AuditTestSuite))
+}
@@ -0,0 +1,104 @@
+package ws_manager
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"github.com/gorilla/websocket"
+)
+
+var errSubscriptionLost = errors.New("Subscription lost")
+
+// BackendMessage is a broadcast as it travels between manager instances.
+type BackendMessage struct {
+	// Origin identifies the instance that published the broadcast, so it
+	// does not deliver it twice.
+	Origin      string `json:"origin"`
+	SenderID    string `json:"sender"`
+	MessageType int    `json:"type"`
+	Data        []byte `json:"data"`
+}
+
+// Backend relays broadcasts between manager instances that serve the same
+// sessions, e.g. behind a load balancer.
+type Backend interface {
+	// Publish sends msg to every instance subscribed to the session.
+	Publish(sessionKey string, msg BackendMessage) error
+	// Subscribe calls handler for every message published by any instance,
+	// including this one, until unsubscribe is called.
+	Subscribe(handler func(sessionKey string, msg BackendMessage)) (unsubscribe func(), err error)
+}
+
+// WithBackend publishes every Broadcast and BroadcastMessage to backend and
+// delivers the broadcasts published by other instances to the local
+// connections of their session. Topic and filtered broadcasts stay local.
+// The pre-broadcast hooks run on the publishing instance only: a vetoed
+// broadcast is not published, and the others deliver it as rewritten.
+// Client IDs are prefixed with a random instance ID so that they are unique
+// across instances.
+func WithBackend(backend Backend) Option {
+	return func(sm *SessionManager) {
+		sm.backend = backend
+		sm.instanceID = newInstanceID()
+	}
+}
+
+func newInstanceID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// subscribeBackend starts relaying the broadcasts of other instances.
+func (sm *SessionManager) subscribeBackend() {
+	if sm.backend == nil {
+		return
+	}
+	unsubscribe, err := sm.backend.Subscribe(sm.relay)
+	if err != nil {
+		sm.logger.Error("Backend subscribe failed", "err", err)
+		sm.backendErr = err
+		return
+	}
+	sm.unsubscribeBackend = unsubscribe
+}
+
+// publish hands a local broadcast to the other instances.
+func (sm *SessionManager) publish(sessionKey, senderID string, messageType int, data []byte) error {
+	if sm.backend == nil {
+		return nil
+	}
+	err := sm.backend.Publish(sessionKey, BackendMessage{
+		Origin:      sm.instanceID,
+		SenderID:    senderID,
+		MessageType: messageType,
+		Data:        data,
+	})
+	if err != nil {
+		sm.logger.Warn("Backend publish failed", "session", sessionKey, "err", err)
+	}
+	return err
+}
+
+// relay delivers a broadcast published by another instance to the local
+// connections of its session.
+func (sm *SessionManager) relay(sessionKey string, msg BackendMessage) {
+	if msg.Origin == sm.instanceID {
+		return
+	}
+	if msg.MessageType != websocket.BinaryMessage {
+		msg.MessageType = websocket.TextMessage
+	}
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return
+	}
+	if err := sm.sendLocked(s, msg.SenderID, msg.MessageType, msg.Data, nil); err != nil {
+		sm.logger.Warn("Relay failed", "session", sessionKey, "err", err)
+	}
+}
@@ -0,0 +1,394 @@
+package ws_manager
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// fakeRedis speaks just enough of the Redis protocol for PUBLISH and
+// PSUBSCRIBE with trailing-* patterns, HSET, HDEL and HGETALL, and AUTH.
+type fakeRedis struct {
+	listener net.Listener
+	username string
+	password string
+
+	mu          sync.Mutex
+	subscribers map[net.Conn]string
+	hashes      map[string]map[string]string
+}
+
+func startFakeRedis() (*fakeRedis, error) {
+	return startFakeRedisWith("", "", nil)
+}
+
+// startFakeRedisWith starts a fakeRedis that requires AUTH when password is
+// not empty, as username when that is not empty, and TLS when config is not
+// nil.
+func startFakeRedisWith(username, password string, config *tls.Config) (*fakeRedis, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		listener = tls.NewListener(listener, config)
+	}
+	f := &fakeRedis{
+		listener:    listener,
+		username:    username,
+		password:    password,
+		subscribers: map[net.Conn]string{},
+		hashes:      map[string]map[string]string{},
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f, nil
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer func() {
+		f.mu.Lock()
+		delete(f.subscribers, conn)
+		f.mu.Unlock()
+		conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	authenticated := f.password == ""
+	for {
+		reply, err := readRedisReply(r)
+		if err != nil {
+			return
+		}
+		args := []string{}
+		for _, arg := range reply.([]interface{}) {
+			args = append(args, redisString(arg))
+		}
+		command := strings.ToUpper(args[0])
+		if command == "AUTH" {
+			username := ""
+			if len(args) == 3 {
+				username = args[1]
+			}
+			if username != f.username || args[len(args)-1] != f.password {
+				conn.Write([]byte("-WRONGPASS invalid username-password pair\r\n"))
+				continue
+			}
+			authenticated = true
+			conn.Write([]byte("+OK\r\n"))
+			continue
+		}
+		if !authenticated {
+			conn.Write([]byte("-NOAUTH Authentication required.\r\n"))
+			continue
+		}
+		f.mu.Lock()
+		switch command {
+		case "PSUBSCRIBE":
+			f.subscribers[conn] = args[1]
+			conn.Write(redisCommand("psubscribe", args[1]))
+		case "PUBLISH":
+			n := 0
+			for sub, pattern := range f.subscribers {
+				if strings.HasPrefix(args[1], strings.TrimSuffix(pattern, "*")) {
+					sub.Write(redisCommand("pmessage", pattern, args[1], args[2]))
+					n++
+				}
+			}
+			fmt.Fprintf(conn, ":%d\r\n", n)
+		case "HSET":
+			if f.hashes[args[1]] == nil {
+				f.hashes[args[1]] = map[string]string{}
+			}
+			f.hashes[args[1]][args[2]] = args[3]
+			conn.Write([]byte(":1\r\n"))
+		case "HDEL":
+			delete(f.hashes[args[1]], args[2])
+			conn.Write([]byte(":1\r\n"))
+		case "HGETALL":
+			fields := []string{}
+			for field, value := range f.hashes[args[1]] {
+				fields = append(fields, field, value)
+			}
+			conn.Write(redisCommand(fields...))
+		}
+		f.mu.Unlock()
+	}
+}
+
+// testTLSConfigs returns a server config with a self-signed certificate for
+// 127.0.0.1 and a client config trusting it.
+func testTLSConfigs() (*tls.Config, *tls.Config, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return server, &tls.Config{RootCAs: pool}, nil
+}
+
+// recordingBackend keeps what is published to it and delivers nothing.
+type recordingBackend struct {
+	mu        sync.Mutex
+	published []string
+}
+
+func (b *recordingBackend) Publish(sessionKey string, msg BackendMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.published = append(b.published, string(msg.Data))
+	return nil
+}
+
+func (b *recordingBackend) Subscribe(handler func(sessionKey string, msg BackendMessage)) (func(), error) {
+	return func() {}, nil
+}
+
+type BackendTestSuite struct {
+	suite.Suite
+	sessionKey string
+	redis      *fakeRedis
+	managers   []*SessionManager
+	servers    []*httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *BackendTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	redis, err := startFakeRedis()
+	assert.NoError(suite.T(), err)
+	suite.redis = redis
+	suite.managers = nil
+	suite.servers = nil
+	for i := 0; i < 2; i++ {
+		manager := CreateSessionManager(
+			[]string{suite.sessionKey},
+			WithBackend(NewRedisBackend(redis.listener.Addr().String(), "ws:")),
+		)
+		e := echo.New()
+		e.GET("/:sessionKey", manager.EchoHandler)
+		suite.managers = append(suite.managers, manager)
+		suite.servers = append(suite.servers, httptest.NewServer(e))
+	}
+}
+
+func (suite *BackendTestSuite) TearDownTest() {
+	for i, server := range suite.servers {
+		server.Close()
+		suite.managers[i].cronScheduler.Stop()
+		suite.managers[i].unsubscribeBackend()
+	}
+	suite.redis.listener.Close()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *BackendTestSuite) TestBroadcastReachesOtherInstances() {
+	sender, senderID, err := dialSessionWithID(suite.servers[0], suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	local, err := dialSession(suite.servers[0], suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	remote, remoteID, err := dialSessionWithID(suite.servers[1], suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.managers[0], suite.sessionKey, 2))
+	assert.True(suite.T(), waitForConnections(suite.managers[1], suite.sessionKey, 1))
+	assert.NotEqual(suite.T(), senderID, remoteID)
+
+	recipients, errs := suite.managers[1].Broadcast(suite.sessionKey, "", websocket.BinaryMessage, []byte{1, 2})
+	assert.Empty(suite.T(), errs)
+	assert.Equal(suite.T(), 1, recipients)
+	for _, conn := range []*websocket.Conn{sender, local, remote} {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		messageType, message, err := conn.ReadMessage()
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), websocket.BinaryMessage, messageType)
+		assert.Equal(suite.T(), []byte{1, 2}, message)
+	}
+
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte("hello")))
+	for _, conn := range []*websocket.Conn{local, remote} {
+		message, err := readWithTimeout(conn, time.Second)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "hello", message)
+	}
+
+	// the publishing instance does not deliver its own broadcast twice
+	_, err = readWithTimeout(local, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+	_, err = readWithTimeout(sender, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *BackendTestSuite) TestPublishErrorIsReported() {
+	suite.redis.listener.Close()
+	manager := CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithLogger(NopLogger()),
+		WithBackend(NewRedisBackend(suite.redis.listener.Addr().String(), "ws:")),
+	)
+	defer manager.cronScheduler.Stop()
+	assert.Error(suite.T(), manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("x")))
+}
+
+func (suite *BackendTestSuite) TestAuthAndTLS() {
+	serverTLS, clientTLS, err := testTLSConfigs()
+	assert.NoError(suite.T(), err)
+	redis, err := startFakeRedisWith("relay", "secret", serverTLS)
+	assert.NoError(suite.T(), err)
+	defer redis.listener.Close()
+	addr := redis.listener.Addr().String()
+
+	received := make(chan string, 1)
+	subscriber := NewRedisBackend(addr, "ws:", WithRedisAuth("relay", "secret"), WithRedisTLS(clientTLS))
+	unsubscribe, err := subscriber.Subscribe(func(sessionKey string, msg BackendMessage) {
+		received <- string(msg.Data)
+	})
+	assert.NoError(suite.T(), err)
+	defer unsubscribe()
+
+	assert.Eventually(suite.T(), func() bool {
+		redis.mu.Lock()
+		defer redis.mu.Unlock()
+		return len(redis.subscribers) == 1
+	}, time.Second, 10*time.Millisecond)
+	publisher := NewRedisBackend(addr, "ws:", WithRedisAuth("relay", "secret"), WithRedisTLS(clientTLS))
+	assert.NoError(suite.T(), publisher.Publish(suite.sessionKey, BackendMessage{Data: []byte("hello")}))
+	select {
+	case message := <-received:
+		assert.Equal(suite.T(), "hello", message)
+	case <-time.After(time.Second):
+		suite.T().Fatal("message not received over TLS")
+	}
+
+	wrongPassword := NewRedisBackend(addr, "ws:", WithRedisAuth("relay", "guess"), WithRedisTLS(clientTLS))
+	assert.ErrorContains(suite.T(), wrongPassword.Publish(suite.sessionKey, BackendMessage{}), "WRONGPASS")
+	noAuth := NewRedisBackend(addr, "ws:", WithRedisTLS(clientTLS))
+	assert.ErrorContains(suite.T(), noAuth.Publish(suite.sessionKey, BackendMessage{}), "NOAUTH")
+	noTLS := NewRedisBackend(addr, "ws:", WithRedisAuth("relay", "secret"))
+	assert.Error(suite.T(), noTLS.Publish(suite.sessionKey, BackendMessage{}))
+}
+
+func (suite *BackendTestSuite) TestUnresponsiveRedisTimesOut() {
+	// a server that accepts connections and never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(suite.T(), err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	addr := listener.Addr().String()
+
+	for name, call := range map[string]func() error{
+		"publish": func() error {
+			return NewRedisBackend(addr, "ws:", WithRedisTimeout(100*time.Millisecond)).Publish(suite.sessionKey, BackendMessage{})
+		},
+		"auth": func() error {
+			return NewRedisBackend(addr, "ws:", WithRedisAuth("", "secret"), WithRedisTimeout(100*time.Millisecond)).Publish(suite.sessionKey, BackendMessage{})
+		},
+		"store": func() error {
+			_, err := NewRedisSessionStore(addr, "ws:sessions", WithRedisTimeout(100*time.Millisecond)).LoadSessions()
+			return err
+		},
+	} {
+		start := time.Now()
+		err := call()
+		var netErr net.Error
+		if assert.ErrorAs(suite.T(), err, &netErr, name) {
+			assert.True(suite.T(), netErr.Timeout(), name)
+		}
+		assert.Less(suite.T(), time.Since(start), time.Second, name)
+	}
+}
+
+func (suite *BackendTestSuite) TestOnlyHookedBroadcastsArePublished() {
+	backend := &recordingBackend{}
+	manager := CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithBackend(backend),
+		WithPreBroadcast(func(sessionKey, senderID, message string) (string, bool) {
+			return strings.ToUpper(message), message != "veto"
+		}),
+	)
+	defer manager.cronScheduler.Stop()
+	e := echo.New()
+	e.GET("/:sessionKey", manager.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+	conn, err := dialSession(server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	assert.True(suite.T(), waitForConnections(manager, suite.sessionKey, 1))
+
+	for _, message := range []string{"veto", "hello"} {
+		assert.NoError(suite.T(), manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte(message)))
+		_, errs := manager.Broadcast(suite.sessionKey, "", websocket.TextMessage, []byte(message))
+		assert.Empty(suite.T(), errs)
+		_, err := manager.BroadcastContext(context.Background(), suite.sessionKey, "", websocket.TextMessage, []byte(message))
+		assert.NoError(suite.T(), err)
+	}
+	assert.Equal(suite.T(), []string{"HELLO", "HELLO", "HELLO"}, backend.published)
+
+	// relayed broadcasts were hooked by the instance that published them
+	manager.relay(suite.sessionKey, BackendMessage{Origin: "elsewhere", MessageType: websocket.TextMessage, Data: []byte("veto")})
+	for _, want := range []string{"HELLO", "HELLO", "HELLO", "veto"} {
+		message, err := readWithTimeout(conn, time.Second)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), want, message)
+	}
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestBackendTestSuite(t *testing.T) {
+	suite.Run(t, new(BackendTestSuite))
+}
@@ -0,0 +1,164 @@
+package ws_manager
+
+import (
+	"net"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func (s *session) isBanned(identity string) bool {
+	if identity == "" {
+		return false
+	}
+	_, ok := s.banned[identity]
+	return ok
+}
+
+// BanIdentity bans identity from the session. Connections with that identity
+// are closed immediately and future upgrades are rejected with HTTP 403.
+// Anonymous connections cannot be banned by identity.
+func (sm *SessionManager) BanIdentity(sessionKey, identity string) {
+	if identity == "" {
+		return
+	}
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return
+	}
+	s.banned[identity] = struct{}{}
+
+	for _, cl := range append([]*client{}, s.clients...) {
+		if cl.identity != identity {
+			continue
+		}
+		sm.disconnectClientLocked(s, cl, websocket.ClosePolicyViolation, "banned")
+	}
+}
+
+// UnbanIdentity lifts a ban placed by BanIdentity.
+func (sm *SessionManager) UnbanIdentity(sessionKey, identity string) {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	if s, ok := sm.sessions[sessionKey]; ok {
+		delete(s.banned, identity)
+	}
+}
+
+// ListBanned returns the banned identities of the session in sorted order.
+func (sm *SessionManager) ListBanned(sessionKey string) []string {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return []string{}
+	}
+	banned := make([]string, 0, len(s.banned))
+	for identity := range s.banned {
+		banned = append(banned, identity)
+	}
+	sort.Strings(banned)
+	return banned
+}
+
+func (sm *SessionManager) isBanned(sessionKey, identity string) bool {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	return ok && s.isBanned(identity)
+}
+
+// WithKickBan makes KickClient also ban the kicked connection's client ID
+// and remote IP from the session for d, so the peer cannot rejoin right
+// away. A zero d bans until UnbanAddress or the session goes away.
+func WithKickBan(d time.Duration) Option {
+	return func(sm *SessionManager) {
+		sm.kickBan = true
+		sm.kickBanDuration = d
+	}
+}
+
+// BanAddress rejects upgrades into the session from the remote IP ip with
+// HTTP 403 for d, or until UnbanAddress if d is zero. Connections already
+// open are not affected.
+func (sm *SessionManager) BanAddress(sessionKey, ip string, d time.Duration) {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	if s, ok := sm.sessions[sessionKey]; ok {
+		s.bannedAddrs[ip] = banExpiry(d)
+	}
+}
+
+// UnbanAddress lifts a ban placed by BanAddress or a kick.
+func (sm *SessionManager) UnbanAddress(sessionKey, ip string) {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	if s, ok := sm.sessions[sessionKey]; ok {
+		delete(s.bannedAddrs, ip)
+	}
+}
+
+// banKickedLocked bans cl from s as WithKickBan asks. The caller must hold
+// sessionManagerMu.
+func (sm *SessionManager) banKickedLocked(s *session, cl *client) {
+	if !sm.kickBan {
+		return
+	}
+	until := banExpiry(sm.kickBanDuration)
+	s.bannedIDs[cl.id] = until
+	if ip := hostOf(cl.addr); ip != "" {
+		s.bannedAddrs[ip] = until
+	}
+}
+
+// isKickBanned reports whether an upgrade from remoteAddr, resuming
+// clientID if not empty, is banned from the session.
+func (sm *SessionManager) isKickBanned(sessionKey, remoteAddr, clientID string) bool {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	return banActive(s.bannedAddrs, hostOf(remoteAddr), now) || banActive(s.bannedIDs, clientID, now)
+}
+
+func banActive(bans map[string]time.Time, key string, now time.Time) bool {
+	if key == "" {
+		return false
+	}
+	until, ok := bans[key]
+	return ok && (until.IsZero() || now.Before(until))
+}
+
+// banExpiry is when a ban of d placed now ends; the zero time never ends.
+func banExpiry(d time.Duration) time.Time {
+	if d <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
+
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// closeClient sends a close frame with code and reason, then closes the
+// underlying connection. The client's read loop exits on its next read.
+func (sm *SessionManager) closeClient(cl *client, code int, reason string) {
+	deadline := time.Now().Add(time.Second)
+	cl.recordClose(CloseInfo{Code: code, Reason: reason, ByServer: true})
+	message := websocket.FormatCloseMessage(code, reason)
+	if err := cl.conn.WriteControl(websocket.CloseMessage, message, deadline); err != nil {
+		sm.logger.Debug("Close frame failed", "client", cl.id, "err", err)
+	}
+	cl.conn.Close()
+}
@@ -0,0 +1,125 @@
+package ws_manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type BansTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+func (suite *BansTestSuite) dialAs(identity string) (*websocket.Conn, *http.Response, error) {
+	return dialSessionAs(suite.server, suite.sessionKey, identity)
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *BansTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithAuth(headerAuth))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *BansTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *BansTestSuite) TestUnauthenticatedIsRejected() {
+	_, resp, err := suite.dialAs("")
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusUnauthorized, resp.StatusCode)
+}
+
+func (suite *BansTestSuite) TestBannedIdentityIsRejected() {
+	suite.manager.BanIdentity(suite.sessionKey, "mallory")
+
+	_, resp, err := suite.dialAs("mallory")
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+
+	suite.manager.UnbanIdentity(suite.sessionKey, "mallory")
+	conn, _, err := suite.dialAs("mallory")
+	assert.NoError(suite.T(), err)
+	conn.Close()
+}
+
+func (suite *BansTestSuite) TestConnectedIdentityIsKicked() {
+	mallory, _, err := suite.dialAs("mallory")
+	assert.NoError(suite.T(), err)
+	_, _, err = suite.dialAs("alice")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	suite.manager.BanIdentity(suite.sessionKey, "mallory")
+
+	_, err = readWithTimeout(mallory, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.ClosePolicyViolation))
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+}
+
+func (suite *BansTestSuite) TestListBanned() {
+	suite.manager.BanIdentity(suite.sessionKey, "mallory")
+	suite.manager.BanIdentity(suite.sessionKey, "eve")
+	assert.Equal(suite.T(), []string{"eve", "mallory"}, suite.manager.ListBanned(suite.sessionKey))
+	assert.Equal(suite.T(), []string{}, suite.manager.ListBanned("missing"))
+}
+
+func (suite *BansTestSuite) TestKickBanKeepsPeerOut() {
+	manager := CreateSessionManager([]string{suite.sessionKey}, WithKickBan(300*time.Millisecond))
+	defer manager.cronScheduler.Stop()
+	e := echo.New()
+	e.GET("/:sessionKey", manager.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	conn, clientID, err := dialSessionWithID(server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(manager, suite.sessionKey, 1))
+	assert.NoError(suite.T(), manager.KickClient(suite.sessionKey, clientID, "go away"))
+	_, err = readWithTimeout(conn, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.ClosePolicyViolation))
+	assert.Error(suite.T(), manager.KickClient(suite.sessionKey, clientID, "again"))
+
+	_, resp, err := dialSessionWithHeader(server, suite.sessionKey, "", nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+
+	time.Sleep(400 * time.Millisecond)
+	rejoined, _, err := dialSessionWithHeader(server, suite.sessionKey, "", nil)
+	assert.NoError(suite.T(), err)
+	rejoined.Close()
+}
+
+func (suite *BansTestSuite) TestBanAddress() {
+	suite.manager.BanAddress(suite.sessionKey, "127.0.0.1", 0)
+	_, resp, err := suite.dialAs("alice")
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+
+	suite.manager.UnbanAddress(suite.sessionKey, "127.0.0.1")
+	conn, _, err := suite.dialAs("alice")
+	assert.NoError(suite.T(), err)
+	conn.Close()
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestBansTestSuite(t *testing.T) {
+	suite.Run(t, new(BansTestSuite))
+}
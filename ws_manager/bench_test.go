@@ -0,0 +1,137 @@
+package ws_manager
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// The Parallel benchmarks measure how operations on unrelated sessions
+// contend for the manager lock; run them with -cpu 1,4,8 to see the
+// contention. Broadcasts and lookups only lock the shard of their session,
+// while registering and removing sessions still takes the lock exclusively.
+// The FanOut benchmarks compare serial and parallel broadcasts to a large
+// session.
+
+func benchmarkManager(b *testing.B, sessions int) (*SessionManager, []string) {
+	sm := CreateSessionManager([]string{}, WithLogger(NopLogger()))
+	b.Cleanup(sm.cronScheduler.Stop)
+	keys := make([]string, sessions)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("session%d", i)
+		if err := sm.RegisterSession(keys[i]); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return sm, keys
+}
+
+func BenchmarkParallelBroadcastAcrossSessions(b *testing.B) {
+	sm, keys := benchmarkManager(b, 1000)
+	payload := []byte("hello")
+	var next uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			key := keys[atomic.AddUint64(&next, 1)%uint64(len(keys))]
+			sm.Broadcast(key, "", websocket.TextMessage, payload)
+		}
+	})
+}
+
+func BenchmarkParallelSessionLookups(b *testing.B) {
+	sm, keys := benchmarkManager(b, 1000)
+	var next uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			key := keys[atomic.AddUint64(&next, 1)%uint64(len(keys))]
+			if _, err := sm.GetSessionStats(key); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkParallelRegisterAndRemove(b *testing.B) {
+	sm, _ := benchmarkManager(b, 0)
+	var next uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			key := fmt.Sprintf("churn%d", atomic.AddUint64(&next, 1))
+			sm.RegisterSession(key)
+			sm.RemoveSession(key)
+		}
+	})
+}
+
+// benchmarkFanOut broadcasts to a session of clients connections that
+// discard everything they read.
+func benchmarkFanOut(b *testing.B, clients int, opts ...Option) {
+	sm := CreateSessionManager([]string{"fanout"}, append(opts, WithLogger(NopLogger()))...)
+	defer sm.cronScheduler.Stop()
+	e := echo.New()
+	e.GET("/:sessionKey", sm.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+	for i := 0; i < clients; i++ {
+		conn, err := dialSession(server, "fanout", "")
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer conn.Close()
+		go func() {
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	if !waitForConnections(sm, "fanout", clients) {
+		b.Fatal("clients did not connect")
+	}
+	payload := make([]byte, 1024)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := sm.BroadcastMessage("fanout", "", websocket.BinaryMessage, payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFanOutSerial(b *testing.B) {
+	benchmarkFanOut(b, 200)
+}
+
+func BenchmarkFanOutParallel(b *testing.B) {
+	benchmarkFanOut(b, 200, WithParallelBroadcast(8))
+}
+
+func BenchmarkSessionLookup(b *testing.B) {
+	sm, keys := benchmarkManager(b, 100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sm.GetSessionStats(keys[i%len(keys)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBroadcastEmptySession(b *testing.B) {
+	sm, keys := benchmarkManager(b, 1)
+	payload := []byte("hello")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sm.Broadcast(keys[0], "", websocket.TextMessage, payload)
+	}
+}
+
+func BenchmarkFanOutWithHistory(b *testing.B) {
+	benchmarkFanOut(b, 200, WithHistorySize(100))
+}
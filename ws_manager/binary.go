@@ -0,0 +1,24 @@
+package ws_manager
+
+import "github.com/gorilla/websocket"
+
+// PreBroadcastMessageFunc is PreBroadcastFunc with the frame type, so hooks
+// can tell text from binary payloads, e.g. to pass audio chunks through
+// untouched while filtering chat. It returns the payload to deliver, which
+// keeps the original frame type, or allow=false to deliver it to nobody.
+type PreBroadcastMessageFunc func(sessionKey, senderID string, messageType int, message []byte) (newMsg []byte, allow bool)
+
+// WithPreBroadcastMessage installs a typed pre-broadcast hook. It runs
+// before the WithPreBroadcast hook, if both are set, under the same rules.
+func WithPreBroadcastMessage(hook PreBroadcastMessageFunc) Option {
+	return func(sm *SessionManager) {
+		sm.preBroadcastMessage = hook
+	}
+}
+
+// BroadcastBinary sends data as a binary frame to every connection in the
+// session except the sender. Inbound binary frames are relayed as binary
+// frames too.
+func (sm *SessionManager) BroadcastBinary(sessionKey, senderID string, data []byte) error {
+	return sm.BroadcastMessage(sessionKey, senderID, websocket.BinaryMessage, data)
+}
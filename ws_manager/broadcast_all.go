@@ -0,0 +1,90 @@
+package ws_manager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BroadcastError reports the connections a broadcast could not be written
+// to, keyed by client ID.
+type BroadcastError struct {
+	Failures map[string]error
+	// TimedOut lists the failed connections whose write hit its deadline.
+	TimedOut []string
+	// Skipped lists the connections a BroadcastContext did not write to
+	// because its context ended first.
+	Skipped []string
+	// Err is the context's error if a BroadcastContext was cut short.
+	Err error
+}
+
+func (e *BroadcastError) Error() string {
+	ids := make([]string, 0, len(e.Failures))
+	for id := range e.Failures {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprintf("%s: %s", id, e.Failures[id])
+	}
+	msg := fmt.Sprintf("Broadcast failed for %d connections: %s", len(ids), strings.Join(parts, "; "))
+	if len(e.Skipped) > 0 {
+		msg += fmt.Sprintf(", skipped %s", strings.Join(e.Skipped, ", "))
+	}
+	if e.Err != nil {
+		msg += fmt.Sprintf(" (%s)", e.Err)
+	}
+	return msg
+}
+
+// Unwrap returns the context's error, so errors.Is(err, context.Canceled)
+// holds for a cancelled BroadcastContext.
+func (e *BroadcastError) Unwrap() error {
+	return e.Err
+}
+
+// newBroadcastError pairs failed connections with their write errors, or
+// returns nil if there are none.
+func newBroadcastError(failed []*client, errs []error) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	failures := map[string]error{}
+	for i, cl := range failed {
+		failures[cl.id] = errs[i]
+	}
+	return &BroadcastError{Failures: failures}
+}
+
+// BroadcastAll sends data to every connection of every session, e.g. for
+// maintenance notices. Each session's copy goes through the pre-broadcast
+// hooks like any other broadcast, so a veto or rewrite applies per session
+// and the copy is recorded in that session's history and audit log.
+// Delivery continues past failed writes, which are returned together as a
+// *BroadcastError; the connections that failed are dropped. The manager
+// lock is held for the whole broadcast, so it is never interleaved with a
+// per-session broadcast.
+func (sm *SessionManager) BroadcastAll(messageType int, data []byte) error {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	failures := map[string]error{}
+	for _, s := range sm.sessions {
+		message, allow := sm.hookBroadcastLocked(s, "", messageType, data)
+		if !allow {
+			continue
+		}
+		var broadcastErr *BroadcastError
+		if errors.As(sm.sendLocked(s, "", messageType, message, nil), &broadcastErr) {
+			for id, err := range broadcastErr.Failures {
+				failures[id] = err
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return &BroadcastError{Failures: failures}
+	}
+	return nil
+}
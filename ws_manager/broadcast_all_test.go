@@ -0,0 +1,161 @@
+package ws_manager
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type BroadcastAllTestSuite struct {
+	suite.Suite
+	manager *SessionManager
+	server  *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *BroadcastAllTestSuite) SetupTest() {
+	suite.manager = CreateSessionManager([]string{"roomone", "roomtwo"})
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *BroadcastAllTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *BroadcastAllTestSuite) TestEveryConnectionReceivesAnnouncement() {
+	conns := []*websocket.Conn{}
+	for _, key := range []string{"roomone", "roomone", "roomtwo", "roomtwo"} {
+		conn, err := dialSession(suite.server, key, "")
+		assert.NoError(suite.T(), err)
+		conns = append(conns, conn)
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 2))
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomtwo", 2))
+
+	assert.NoError(suite.T(), suite.manager.BroadcastAll(websocket.TextMessage, []byte("maintenance at noon")))
+	for _, conn := range conns {
+		message, err := readWithTimeout(conn, time.Second)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "maintenance at noon", message)
+	}
+}
+
+func (suite *BroadcastAllTestSuite) TestWriteErrorsAreAggregated() {
+	healthy, err := dialSession(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	_, brokenID, err := dialSessionWithID(suite.server, "roomtwo", "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 1))
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomtwo", 1))
+
+	// shut down writes on the server side of one connection; its reads keep
+	// working, so only the failed broadcast removes it
+	suite.manager.sessionManagerMu.Lock()
+	tcp := suite.manager.sessions["roomtwo"].clients[0].conn.UnderlyingConn().(*net.TCPConn)
+	suite.manager.sessionManagerMu.Unlock()
+	assert.NoError(suite.T(), tcp.CloseWrite())
+
+	err = suite.manager.BroadcastAll(websocket.TextMessage, []byte("hello"))
+	if assert.IsType(suite.T(), &BroadcastError{}, err) {
+		failures := err.(*BroadcastError).Failures
+		assert.Len(suite.T(), failures, 1)
+		assert.Contains(suite.T(), failures, brokenID)
+	}
+	message, err := readWithTimeout(healthy, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "hello", message)
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomtwo", 0))
+}
+
+func (suite *BroadcastAllTestSuite) TestFailedRecipientsAreDropped() {
+	disconnected := make(chan error, 1)
+	suite.manager.OnDisconnect(func(sessionKey, clientID string, err error) {
+		disconnected <- err
+	})
+	sender, err := dialSession(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	broken, err := dialSession(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	defer broken.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 3))
+
+	suite.manager.sessionManagerMu.Lock()
+	tcp := suite.manager.sessions["roomone"].clients[2].conn.UnderlyingConn().(*net.TCPConn)
+	suite.manager.sessionManagerMu.Unlock()
+	assert.NoError(suite.T(), tcp.CloseWrite())
+
+	// the sender outlives the failed write and keeps broadcasting
+	for _, text := range []string{"first", "second"} {
+		assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte(text)))
+		message, err := readWithTimeout(receiver, time.Second)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), text, message)
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 2))
+	select {
+	case err := <-disconnected:
+		assert.Error(suite.T(), err)
+	case <-time.After(time.Second):
+		suite.T().Error("disconnect hook did not run")
+	}
+	assert.Equal(suite.T(), uint64(1), suite.manager.Metrics().WriteFailures)
+	assert.Equal(suite.T(), uint64(1), suite.manager.Metrics().Disconnects)
+}
+
+func (suite *BroadcastAllTestSuite) TestPreBroadcastHookApplies() {
+	manager := CreateSessionManager(
+		[]string{"roomone", "roomtwo"},
+		WithHistorySize(5),
+		WithPreBroadcast(func(sessionKey, senderID, message string) (string, bool) {
+			return strings.ReplaceAll(message, "secret", "[redacted]"), sessionKey != "roomtwo"
+		}),
+	)
+	defer manager.cronScheduler.Stop()
+	e := echo.New()
+	e.GET("/:sessionKey", manager.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+	one, err := dialSession(server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	two, err := dialSession(server, "roomtwo", "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(manager, "roomone", 1))
+	assert.True(suite.T(), waitForConnections(manager, "roomtwo", 1))
+
+	assert.NoError(suite.T(), manager.BroadcastAll(websocket.TextMessage, []byte("the secret is out")))
+	message, err := readWithTimeout(one, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "the [redacted] is out", message)
+	_, err = readWithTimeout(two, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+
+	assert.Equal(suite.T(), uint64(1), manager.Metrics().VetoedBroadcasts)
+
+	// the rewritten copy was kept in the history and is replayed
+	late, err := dialSession(server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	message, err = readWithTimeout(late, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "the [redacted] is out", message)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestBroadcastAllTestSuite(t *testing.T) {
+	suite.Run(t, new(BroadcastAllTestSuite))
+}
@@ -0,0 +1,194 @@
+package ws_manager
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// PerWriteTimeout bounds each connection's write in a BroadcastContext to
+// timeout instead of the manager's write timeout.
+func PerWriteTimeout(timeout time.Duration) BroadcastOption {
+	return func(o *broadcastOptions) {
+		o.writeTimeout = timeout
+	}
+}
+
+// BroadcastContext is Broadcast bounded by ctx. Connections are written to
+// one at a time, each within its own deadline: the earlier of the context's
+// deadline and the write timeout (PerWriteTimeout, else WithWriteTimeout),
+// so a stuck connection costs at most one timeout. Once ctx ends the write
+// in progress is interrupted and the remaining connections are skipped.
+// It returns how many connections the frame was written to; failed writes,
+// with the timed out and skipped connections, are returned together as a
+// *BroadcastError. The broadcast is published to the backend only if ctx
+// was still live at the end.
+func (sm *SessionManager) BroadcastContext(ctx context.Context, sessionKey string, senderID string, messageType int, data []byte, opts ...BroadcastOption) (delivered int, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	options := broadcastOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	delivered, published, publish, err := sm.broadcastContext(ctx, sessionKey, senderID, messageType, data, options)
+	if publish && contextErr(ctx) == nil {
+		if publishErr := sm.publish(sessionKey, senderID, messageType, published); err == nil {
+			err = publishErr
+		}
+	}
+	return delivered, err
+}
+
+// broadcastContext is the local part of BroadcastContext. publish reports
+// whether the broadcast went out and published should be handed to the
+// backend.
+func (sm *SessionManager) broadcastContext(ctx context.Context, sessionKey string, senderID string, messageType int, data []byte, options broadcastOptions) (delivered int, published []byte, publish bool, err error) {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return 0, nil, false, sessionNotFound(sessionKey)
+	}
+	match := options.match()
+	published, allow := sm.hookBroadcastLocked(s, senderID, messageType, data)
+	if !allow {
+		return 0, nil, false, nil
+	}
+	messageType, data = sm.acceptBroadcastLocked(s, nil, "", senderID, messageType, published, match)
+	defer sm.observeBroadcastLocked(time.Now())
+	recipients := s.recipients(senderID, match)
+	if sender := s.client(senderID); sender != nil && options.includeSender && !s.includeSender && !options.exclude[senderID] {
+		recipients = append(recipients, sender)
+	}
+	span := sm.startBroadcastSpanLocked(s, senderID, len(recipients))
+
+	watch := newWriteWatch(ctx)
+	defer watch.stop()
+	result := &BroadcastError{Failures: map[string]error{}}
+	failed := []*client{}
+	errs := []error{}
+	for i, cl := range recipients {
+		if contextErr(ctx) != nil {
+			for _, rest := range recipients[i:] {
+				result.Skipped = append(result.Skipped, rest.id)
+			}
+			break
+		}
+		if sm.oversizedLocked(s, cl, data) {
+			continue
+		}
+		timeout := options.writeTimeout
+		if timeout <= 0 {
+			timeout = cl.writeTimeout
+		}
+		watch.begin(cl)
+		err := cl.writeBefore(messageType, data, writeDeadline(ctx, timeout))
+		watch.end()
+		if _, err := sm.wroteLocked(s, cl, data, err); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				result.TimedOut = append(result.TimedOut, cl.id)
+			}
+			result.Failures[cl.id] = err
+			failed = append(failed, cl)
+			errs = append(errs, err)
+			continue
+		}
+		delivered++
+	}
+	for i, cl := range failed {
+		sm.dropClientLocked(s, cl, errs[i])
+	}
+	endBroadcastSpan(span, delivered, errs)
+	result.Err = contextErr(ctx)
+	if result.Err == nil && len(result.Skipped) == 0 && len(result.Failures) == 0 {
+		return delivered, published, true, nil
+	}
+	return delivered, published, true, result
+}
+
+// contextErr is ctx.Err(), reporting a passed deadline even before the
+// context's own timer fires, so a write that timed out at the deadline
+// ends the broadcast.
+func contextErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// writeDeadline is the earlier of ctx's deadline and timeout from now. The
+// zero time means no deadline.
+func writeDeadline(ctx context.Context, timeout time.Duration) time.Time {
+	deadline, ok := ctx.Deadline()
+	if timeout > 0 {
+		if byTimeout := time.Now().Add(timeout); !ok || byTimeout.Before(deadline) {
+			return byTimeout
+		}
+	}
+	if !ok {
+		return time.Time{}
+	}
+	return deadline
+}
+
+// writeBefore is write with an explicit deadline for this frame. Queued and
+// coalescing connections only hold it, so the deadline does not apply.
+func (cl *client) writeBefore(messageType int, data []byte, deadline time.Time) error {
+	if cl.queue != nil || cl.coalesce != nil {
+		return cl.write(messageType, data)
+	}
+	messageType, data = cl.encodeFrame(messageType, data)
+	cl.writeMu.Lock()
+	defer cl.writeMu.Unlock()
+	// Later writes set their own deadline only with a write timeout.
+	defer cl.conn.SetWriteDeadline(time.Time{})
+	cl.conn.SetWriteDeadline(deadline)
+	cl.setWriteCompression(len(data))
+	return cl.conn.WriteMessage(messageType, data)
+}
+
+// writeWatch interrupts the write in progress when its context ends.
+type writeWatch struct {
+	mu      sync.Mutex
+	writing *client
+	done    chan struct{}
+}
+
+func newWriteWatch(ctx context.Context) *writeWatch {
+	w := &writeWatch{done: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.mu.Lock()
+			if w.writing != nil {
+				w.writing.conn.UnderlyingConn().SetWriteDeadline(time.Now())
+			}
+			w.mu.Unlock()
+		case <-w.done:
+		}
+	}()
+	return w
+}
+
+func (w *writeWatch) begin(cl *client) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writing = cl
+}
+
+func (w *writeWatch) end() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writing = nil
+}
+
+func (w *writeWatch) stop() {
+	close(w.done)
+}
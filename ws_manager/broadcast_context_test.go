@@ -0,0 +1,150 @@
+package ws_manager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type BroadcastContextTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+// large is big enough to fill the shrunken socket buffers of a peer that
+// never reads.
+var large = bytes.Repeat([]byte("x"), 4<<20)
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *BroadcastContextTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithLogger(NopLogger()))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *BroadcastContextTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+// dialStuckThenHealthy joins a connection that never reads, then one that
+// does, in that order. Both stay open until the test ends.
+func (suite *BroadcastContextTestSuite) dialStuckThenHealthy() (stuckID string, healthy *websocket.Conn, healthyID string) {
+	stuck, stuckID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	suite.T().Cleanup(func() { stuck.Close() })
+	stuck.UnderlyingConn().(*net.TCPConn).SetReadBuffer(4096)
+	suite.manager.sessionManagerMu.Lock()
+	suite.manager.sessions[suite.sessionKey].clients[0].conn.UnderlyingConn().(*net.TCPConn).SetWriteBuffer(4096)
+	suite.manager.sessionManagerMu.Unlock()
+	healthy, healthyID, err = dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	suite.T().Cleanup(func() { healthy.Close() })
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+	return stuckID, healthy, healthyID
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *BroadcastContextTestSuite) TestDeliversToEveryone() {
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	delivered, err := suite.manager.BroadcastContext(context.Background(), suite.sessionKey, "", websocket.TextMessage, []byte("hello"))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, delivered)
+	message, err := readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "hello", message)
+}
+
+func (suite *BroadcastContextTestSuite) TestStuckClientTimesOut() {
+	stuckID, healthy, _ := suite.dialStuckThenHealthy()
+	received := make(chan int, 1)
+	go func() {
+		healthy.SetReadDeadline(time.Now().Add(10 * time.Second))
+		_, message, _ := healthy.ReadMessage()
+		received <- len(message)
+	}()
+
+	start := time.Now()
+	delivered, err := suite.manager.BroadcastContext(context.Background(), suite.sessionKey, "", websocket.TextMessage, large, PerWriteTimeout(time.Second))
+	assert.Less(suite.T(), time.Since(start), 5*time.Second)
+	assert.Equal(suite.T(), 1, delivered)
+	if assert.IsType(suite.T(), &BroadcastError{}, err) {
+		broadcastErr := err.(*BroadcastError)
+		assert.Equal(suite.T(), []string{stuckID}, broadcastErr.TimedOut)
+		assert.Contains(suite.T(), broadcastErr.Failures, stuckID)
+		assert.Empty(suite.T(), broadcastErr.Skipped)
+		assert.NoError(suite.T(), broadcastErr.Err)
+	}
+	assert.Equal(suite.T(), len(large), <-received)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+}
+
+func (suite *BroadcastContextTestSuite) TestCancelSkipsRemainingClients() {
+	stuckID, _, healthyID := suite.dialStuckThenHealthy()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	delivered, err := suite.manager.BroadcastContext(ctx, suite.sessionKey, "", websocket.TextMessage, large)
+	assert.Less(suite.T(), time.Since(start), 5*time.Second)
+	assert.Equal(suite.T(), 0, delivered)
+	assert.True(suite.T(), errors.Is(err, context.Canceled))
+	if assert.IsType(suite.T(), &BroadcastError{}, err) {
+		broadcastErr := err.(*BroadcastError)
+		assert.Contains(suite.T(), broadcastErr.Failures, stuckID)
+		assert.Equal(suite.T(), []string{healthyID}, broadcastErr.Skipped)
+	}
+}
+
+func (suite *BroadcastContextTestSuite) TestContextDeadlineBoundsWrites() {
+	stuckID, _, healthyID := suite.dialStuckThenHealthy()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := suite.manager.BroadcastContext(ctx, suite.sessionKey, "", websocket.TextMessage, large)
+	assert.True(suite.T(), errors.Is(err, context.DeadlineExceeded))
+	if assert.IsType(suite.T(), &BroadcastError{}, err) {
+		broadcastErr := err.(*BroadcastError)
+		assert.Equal(suite.T(), []string{stuckID}, broadcastErr.TimedOut)
+		assert.Equal(suite.T(), []string{healthyID}, broadcastErr.Skipped)
+	}
+}
+
+func (suite *BroadcastContextTestSuite) TestEndedContextWritesNothing() {
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	delivered, err := suite.manager.BroadcastContext(ctx, suite.sessionKey, "", websocket.TextMessage, []byte("never"))
+	assert.Equal(suite.T(), context.Canceled, err)
+	assert.Equal(suite.T(), 0, delivered)
+	_, err = readWithTimeout(conn, 100*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestBroadcastContextTestSuite(t *testing.T) {
+	suite.Run(t, new(BroadcastContextTestSuite))
+}
@@ -0,0 +1,24 @@
+package ws_manager
+
+// BroadcastFunc sends data to the connections of the session, other than
+// the sender, for which filter returns true. filter runs under the manager
+// lock and must not call back into the manager. Delivery continues past
+// failed writes, and recipients counts the frames actually written; failed
+// writes are returned together as a *BroadcastError.
+func (sm *SessionManager) BroadcastFunc(sessionKey, senderID string, messageType int, data []byte, filter func(ClientInfo) bool) (recipients int, err error) {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return 0, sessionNotFound(sessionKey)
+	}
+	match := func(cl *client) bool {
+		return filter(cl.info())
+	}
+	messageType, data, allow := sm.prepareBroadcastLocked(s, senderID, messageType, data, match)
+	if !allow {
+		return 0, nil
+	}
+	recipients, failed, errs := sm.deliverLocked(s, senderID, messageType, data, match)
+	return recipients, newBroadcastError(failed, errs)
+}
@@ -0,0 +1,78 @@
+package ws_manager
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type BroadcastFuncTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *BroadcastFuncTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey})
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *BroadcastFuncTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+func isAdmin(info ClientInfo) bool {
+	for _, tag := range info.Tags {
+		if tag == "role=admin" {
+			return true
+		}
+	}
+	return false
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *BroadcastFuncTestSuite) TestOnlyMatchingClientsReceive() {
+	sender, senderID, err := dialSessionWithID(suite.server, suite.sessionKey, "tag=role=admin")
+	assert.NoError(suite.T(), err)
+	admin, err := dialSession(suite.server, suite.sessionKey, "tag=role=admin&tag=team=red")
+	assert.NoError(suite.T(), err)
+	member, err := dialSession(suite.server, suite.sessionKey, "tag=team=red")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 3))
+
+	recipients, err := suite.manager.BroadcastFunc(suite.sessionKey, senderID, websocket.TextMessage, []byte("admins only"), isAdmin)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, recipients)
+
+	message, err := readWithTimeout(admin, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "admins only", message)
+	_, err = readWithTimeout(member, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+	_, err = readWithTimeout(sender, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *BroadcastFuncTestSuite) TestUnknownSession() {
+	_, err := suite.manager.BroadcastFunc("missing", "", websocket.TextMessage, []byte("hi"), isAdmin)
+	assert.EqualError(suite.T(), err, "Session missing not found")
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestBroadcastFuncTestSuite(t *testing.T) {
+	suite.Run(t, new(BroadcastFuncTestSuite))
+}
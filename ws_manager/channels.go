@@ -0,0 +1,96 @@
+package ws_manager
+
+import (
+	"errors"
+	"sort"
+)
+
+// Subscribe adds the connection with clientID to the named channel of its
+// session. Channels are sub-groups of a session, e.g. breakout rooms; a
+// connection may be in any number of them and leaves them all when it
+// leaves the session. With WithControlMessages, connections can also
+// subscribe themselves with the control messages
+//
+//	{"control":"subscribe","channels":["room-1"]}
+//	{"control":"unsubscribe","channels":["room-1"]}
+func (sm *SessionManager) Subscribe(sessionKey, clientID, channel string) error {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	cl, err := sm.findClient(sessionKey, clientID)
+	if err != nil {
+		return err
+	}
+	return cl.subscribe(channel)
+}
+
+// Unsubscribe removes the connection with clientID from the named channel.
+// Leaving a channel the connection is not in is not an error.
+func (sm *SessionManager) Unsubscribe(sessionKey, clientID, channel string) error {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	cl, err := sm.findClient(sessionKey, clientID)
+	if err != nil {
+		return err
+	}
+	delete(cl.channels, channel)
+	return nil
+}
+
+// ChannelMembers returns the IDs of the connections subscribed to the named
+// channel of the session, in the order they joined the session.
+func (sm *SessionManager) ChannelMembers(sessionKey, channel string) ([]string, error) {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return nil, sessionNotFound(sessionKey)
+	}
+	members := []string{}
+	for _, cl := range s.clients {
+		if cl.inChannel(channel) {
+			members = append(members, cl.id)
+		}
+	}
+	return members, nil
+}
+
+// Channels returns the names of the channels the connection with clientID
+// is subscribed to, sorted.
+func (sm *SessionManager) Channels(sessionKey, clientID string) ([]string, error) {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	cl, err := sm.findClient(sessionKey, clientID)
+	if err != nil {
+		return nil, err
+	}
+	channels := make([]string, 0, len(cl.channels))
+	for channel := range cl.channels {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels, nil
+}
+
+// BroadcastToChannel sends data to the connections of the session
+// subscribed to channel, except the sender.
+func (sm *SessionManager) BroadcastToChannel(sessionKey, channel string, senderID string, messageType int, data []byte) error {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	return sm.broadcastLocked(sessionKey, senderID, messageType, data, func(cl *client) bool {
+		return cl.inChannel(channel)
+	})
+}
+
+// subscribe adds cl to channel. The caller must hold sessionManagerMu.
+func (cl *client) subscribe(channel string) error {
+	if channel == "" {
+		return errors.New("Channel name is empty")
+	}
+	cl.channels[channel] = struct{}{}
+	return nil
+}
+
+func (cl *client) inChannel(channel string) bool {
+	_, ok := cl.channels[channel]
+	return ok
+}
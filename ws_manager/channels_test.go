@@ -0,0 +1,101 @@
+package ws_manager
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ChannelsTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *ChannelsTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithControlMessages(true))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *ChannelsTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *ChannelsTestSuite) TestSubscribeWithControlMessages() {
+	member, memberID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	outsider, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	member.WriteMessage(websocket.TextMessage, []byte(`{"control":"subscribe","channels":["room-1","room-2"]}`))
+	time.Sleep(100 * time.Millisecond)
+	members, err := suite.manager.ChannelMembers(suite.sessionKey, "room-1")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{memberID}, members)
+
+	assert.NoError(suite.T(), suite.manager.BroadcastToChannel(suite.sessionKey, "room-1", "", websocket.TextMessage, []byte("breakout")))
+	message, err := readWithTimeout(member, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "breakout", message)
+
+	member.WriteMessage(websocket.TextMessage, []byte(`{"control":"unsubscribe","channels":["room-1"]}`))
+	time.Sleep(100 * time.Millisecond)
+	channels, err := suite.manager.Channels(suite.sessionKey, memberID)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"room-2"}, channels)
+
+	assert.NoError(suite.T(), suite.manager.BroadcastToChannel(suite.sessionKey, "room-1", "", websocket.TextMessage, []byte("nobody")))
+	_, err = readWithTimeout(outsider, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+	_, err = readWithTimeout(member, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *ChannelsTestSuite) TestServerSideSubscriptions() {
+	sender, senderID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	receiver, receiverID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	assert.NoError(suite.T(), suite.manager.Subscribe(suite.sessionKey, senderID, "room-1"))
+	assert.NoError(suite.T(), suite.manager.Subscribe(suite.sessionKey, receiverID, "room-1"))
+	assert.Error(suite.T(), suite.manager.Subscribe(suite.sessionKey, receiverID, ""))
+	assert.Error(suite.T(), suite.manager.Subscribe(suite.sessionKey, "missing", "room-1"))
+
+	assert.NoError(suite.T(), suite.manager.BroadcastToChannel(suite.sessionKey, "room-1", senderID, websocket.TextMessage, []byte("hi room")))
+	message, err := readWithTimeout(receiver, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "hi room", message)
+
+	assert.NoError(suite.T(), suite.manager.Unsubscribe(suite.sessionKey, receiverID, "room-1"))
+	receiver.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	members, err := suite.manager.ChannelMembers(suite.sessionKey, "room-1")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{senderID}, members)
+	_, err = suite.manager.ChannelMembers("missing", "room-1")
+	assert.Error(suite.T(), err)
+	sender.Close()
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestChannelsTestSuite(t *testing.T) {
+	suite.Run(t, new(ChannelsTestSuite))
+}
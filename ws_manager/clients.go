@@ -0,0 +1,132 @@
+package ws_manager
+
+import (
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ClientIDHeader is the upgrade response header carrying the ID the manager
+// assigned to the new connection.
+const ClientIDHeader = "X-Client-Id"
+
+// ClientInfo describes a connection in a session. ID is what Broadcast,
+// SendToClient and the other per-connection methods take.
+type ClientInfo struct {
+	ID         string
+	RemoteAddr string
+	JoinedAt   time.Time
+	Conn       *websocket.Conn
+	Identity   string
+	Name       string
+	Role       string
+	Topic      string
+	// Stream is the stream the connection joined, see WithStream.
+	Stream string
+	Tags   []string
+	// Metadata is a copy of the connection's application metadata.
+	Metadata map[string]interface{}
+	// Compressed is set when the connection negotiated permessage-deflate.
+	Compressed bool
+	// SlowConsumer is set while the connection's send queue has been full
+	// past the WithSlowConsumer threshold.
+	SlowConsumer bool
+	// Muted is set by MuteClient.
+	Muted bool
+}
+
+// GetClients returns the connections of the session in the order they joined.
+func (sm *SessionManager) GetClients(sessionKey string) ([]ClientInfo, error) {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return nil, sessionNotFound(sessionKey)
+	}
+	clients := make([]ClientInfo, len(s.clients))
+	for i, cl := range s.clients {
+		clients[i] = cl.info()
+	}
+	return clients, nil
+}
+
+// KickClient removes the connection with clientID from the session and
+// closes it with a policy violation and reason, or the code set with
+// WithCloseCode(CloseKick, ...). See WithKickBan to keep the peer from
+// rejoining.
+func (sm *SessionManager) KickClient(sessionKey, clientID, reason string) error {
+	sm.sessionManagerMu.Lock()
+	cl, err := sm.findClient(sessionKey, clientID)
+	code := 0
+	if err == nil {
+		code, reason = sm.kickLocked(sm.sessions[sessionKey], cl, reason)
+	}
+	sm.sessionManagerMu.Unlock()
+	if err != nil {
+		return err
+	}
+	sm.closeClient(cl, code, reason)
+	return nil
+}
+
+// kickLocked removes cl from s as KickClient does and returns the code and
+// reason to close it with. The caller must hold sessionManagerMu and close
+// cl.
+func (sm *SessionManager) kickLocked(s *session, cl *client, reason string) (int, string) {
+	code, reason := sm.closeFrame(CloseKick, websocket.ClosePolicyViolation, reason)
+	cl.recordClose(CloseInfo{Code: code, Reason: reason, ByServer: true})
+	event := auditEventOf(AuditKick, s.key, cl)
+	event.Code, event.Reason = code, reason
+	sm.recordAudit(event)
+	sm.removeClientLocked(s, cl)
+	sm.banKickedLocked(s, cl)
+	return code, reason
+}
+
+// ListClients is GetClients, for "who's online" views: each entry carries
+// the connection's ID, name, role, metadata, join time and remote address.
+func (sm *SessionManager) ListClients(sessionKey string) ([]ClientInfo, error) {
+	return sm.GetClients(sessionKey)
+}
+
+// info describes cl. The caller must hold sessionManagerMu.
+func (cl *client) info() ClientInfo {
+	tags := make([]string, 0, len(cl.tags))
+	for tag := range cl.tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return ClientInfo{
+		ID:           cl.id,
+		RemoteAddr:   cl.addr,
+		JoinedAt:     cl.joinedAt,
+		Conn:         cl.conn,
+		Identity:     cl.identity,
+		Name:         cl.name,
+		Role:         cl.role,
+		Topic:        cl.topic,
+		Stream:       cl.stream,
+		Tags:         tags,
+		Metadata:     copyMetadata(cl.metadata),
+		Compressed:   cl.compressed,
+		SlowConsumer: cl.queue != nil && cl.queue.isLagging(),
+		Muted:        cl.isMuted(),
+	}
+}
+
+// newClientID returns the next connection ID of the manager. IDs are unique
+// for the lifetime of the manager and never reused. With a backend they are
+// prefixed with the instance ID. WithIDGenerator replaces the counter.
+func (sm *SessionManager) newClientID() string {
+	if sm.idGenerator != nil {
+		return sm.idGenerator.NewID()
+	}
+	id := strconv.FormatUint(atomic.AddUint64(&sm.nextClientID, 1), 10)
+	if sm.instanceID != "" {
+		return sm.instanceID + "-" + id
+	}
+	return id
+}
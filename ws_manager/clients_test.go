@@ -0,0 +1,125 @@
+package ws_manager
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ClientsTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *ClientsTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey})
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *ClientsTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *ClientsTestSuite) TestUpgradeReturnsDistinctClientIDs() {
+	_, first, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	_, second, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.NotEmpty(suite.T(), first)
+	assert.NotEqual(suite.T(), first, second)
+}
+
+func (suite *ClientsTestSuite) TestGetClientsListsConnectionsInJoinOrder() {
+	before := time.Now()
+	first, firstID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	_, secondID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	clients, err := suite.manager.GetClients(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	if assert.Len(suite.T(), clients, 2) {
+		assert.Equal(suite.T(), firstID, clients[0].ID)
+		assert.Equal(suite.T(), secondID, clients[1].ID)
+		assert.Equal(suite.T(), first.LocalAddr().String(), clients[0].RemoteAddr)
+		assert.False(suite.T(), clients[0].JoinedAt.Before(before))
+		assert.NotNil(suite.T(), clients[0].Conn)
+	}
+}
+
+func (suite *ClientsTestSuite) TestConcurrentDialsAndReads() {
+	const dials = 20
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				snapshot, err := suite.manager.GetSession(suite.sessionKey)
+				assert.NoError(suite.T(), err)
+				// the slice is a copy, so writing to it does not race
+				// with the manager
+				if len(snapshot) > 0 {
+					snapshot[0] = nil
+				}
+				_, err = suite.manager.GetClients(suite.sessionKey)
+				assert.NoError(suite.T(), err)
+				suite.manager.ListSessionsDetailed()
+			}
+		}()
+	}
+	var dialers sync.WaitGroup
+	conns := make([]*websocket.Conn, dials)
+	for i := 0; i < dials; i++ {
+		dialers.Add(1)
+		go func(i int) {
+			defer dialers.Done()
+			var err error
+			conns[i], err = dialSession(suite.server, suite.sessionKey, "")
+			assert.NoError(suite.T(), err)
+		}(i)
+	}
+	dialers.Wait()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, dials))
+	close(done)
+	wg.Wait()
+	// closing the connections here also keeps them reachable until now
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+func (suite *ClientsTestSuite) TestGetClientsNotFound() {
+	_, err := suite.manager.GetClients("missing")
+	assert.EqualError(suite.T(), err, "Session missing not found")
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestClientsTestSuite(t *testing.T) {
+	suite.Run(t, new(ClientsTestSuite))
+}
@@ -0,0 +1,159 @@
+package ws_manager
+
+import (
+	"errors"
+
+	"github.com/gorilla/websocket"
+)
+
+// CloseInfo tells how a connection ended. Code and Reason come from the
+// close frame the client sent or, if ByServer is set, the one the server
+// closed the connection with. A connection that dropped without a close
+// frame, e.g. on a network error or a failed write, has the code
+// websocket.CloseAbnormalClosure (1006) and no reason.
+type CloseInfo struct {
+	Code     int
+	Reason   string
+	ByServer bool
+}
+
+// CloseFunc is called after a connection has left its session, with how it
+// ended.
+type CloseFunc func(sessionKey, clientID string, info CloseInfo)
+
+// WithOnClose calls onClose for every connection EchoHandler removes, after
+// the disconnect hooks. It runs outside the manager lock and may call back
+// into the manager.
+func WithOnClose(onClose CloseFunc) Option {
+	return func(sm *SessionManager) {
+		sm.closeHooks = append(sm.closeHooks, onClose)
+	}
+}
+
+// OnClose registers fn as WithOnClose does, on a running manager.
+func (sm *SessionManager) OnClose(fn CloseFunc) {
+	sm.policyMu.Lock()
+	defer sm.policyMu.Unlock()
+	sm.closeHooks = append(sm.closeHooks, fn)
+}
+
+// CloseScenario names a reason the server closes connections for, see
+// WithCloseCode.
+type CloseScenario int
+
+const (
+	// CloseKick is KickClient, by default a policy violation with the
+	// reason passed to it.
+	CloseKick CloseScenario = iota
+	// CloseExpire is a collector removing an idle session, by default a
+	// normal closure with the reason "session expired".
+	CloseExpire
+	// CloseShutdown is Shutdown, by default going away with the reason
+	// "server shutting down".
+	CloseShutdown
+	// CloseRateLimit is WithRateLimitAction(RateLimitDisconnect), by
+	// default CloseRateLimited, and the maxDropped of WithRateLimit, by
+	// default a policy violation, both with the reason "rate limit exceeded".
+	CloseRateLimit
+	// CloseIdle is WithIdleConnTimeout and WithIdleEviction, by default
+	// CloseNoActivity with the reason "idle timeout".
+	CloseIdle
+	// CloseDrain is the timeout of StartDraining, by default going away
+	// with the reason "server draining".
+	CloseDrain
+	// CloseDuplicate is DuplicateCloseOlder, by default a policy violation
+	// with the reason "replaced by a new connection".
+	CloseDuplicate
+)
+
+type closeCode struct {
+	code   int
+	reason string
+}
+
+// WithCloseCode makes the server close connections with code and reason in
+// scenario instead of the defaults, e.g. so clients can tell a kick from a
+// shutdown. An empty reason keeps the default one; for CloseKick, a reason
+// passed to KickClient takes precedence.
+func WithCloseCode(scenario CloseScenario, code int, reason string) Option {
+	return func(sm *SessionManager) {
+		if sm.closeCodes == nil {
+			sm.closeCodes = map[CloseScenario]closeCode{}
+		}
+		sm.closeCodes[scenario] = closeCode{code: code, reason: reason}
+	}
+}
+
+// closeFrame returns the code and reason to close connections with in
+// scenario, where code and reason are the defaults.
+func (sm *SessionManager) closeFrame(scenario CloseScenario, code int, reason string) (int, string) {
+	custom, ok := sm.closeCodes[scenario]
+	if !ok {
+		return code, reason
+	}
+	if custom.reason != "" && (scenario != CloseKick || reason == "") {
+		reason = custom.reason
+	}
+	return custom.code, reason
+}
+
+// recordClose notes info as how cl ended, unless it was already noted, so
+// the server's close frame wins over the error its read loop then gets.
+func (cl *client) recordClose(info CloseInfo) {
+	cl.closeMu.Lock()
+	defer cl.closeMu.Unlock()
+	if cl.closed == nil {
+		cl.closed = &info
+	}
+}
+
+// closeInfo returns how cl ended, an abnormal closure if nothing was noted.
+func (cl *client) closeInfo() CloseInfo {
+	cl.closeMu.Lock()
+	defer cl.closeMu.Unlock()
+	if cl.closed == nil {
+		return CloseInfo{Code: websocket.CloseAbnormalClosure}
+	}
+	return *cl.closed
+}
+
+// closeInfoOf returns how a connection whose read loop ended with err was
+// closed by its client.
+func closeInfoOf(err error) CloseInfo {
+	var closeErr *websocket.CloseError
+	// gorilla/websocket reports a dropped connection as an abnormal closure
+	// with the read error as its text, which the client never sent
+	if errors.As(err, &closeErr) && closeErr.Code != websocket.CloseAbnormalClosure {
+		return CloseInfo{Code: closeErr.Code, Reason: closeErr.Text}
+	}
+	return CloseInfo{Code: websocket.CloseAbnormalClosure}
+}
+
+// disconnectClient removes cl from its session and closes it with code and
+// reason, which the leave presence event carries.
+func (sm *SessionManager) disconnectClient(sessionKey string, cl *client, code int, reason string) {
+	cl.recordClose(CloseInfo{Code: code, Reason: reason, ByServer: true})
+	sm.removeClient(sessionKey, cl)
+	sm.closeClient(cl, code, reason)
+}
+
+// disconnectClientLocked is disconnectClient for a caller holding
+// sessionManagerMu.
+func (sm *SessionManager) disconnectClientLocked(s *session, cl *client, code int, reason string) {
+	cl.recordClose(CloseInfo{Code: code, Reason: reason, ByServer: true})
+	sm.removeClientLocked(s, cl)
+	sm.closeClient(cl, code, reason)
+}
+
+// runCloseHooks calls the close hooks for cl.
+func (sm *SessionManager) runCloseHooks(sessionKey string, cl *client) {
+	sm.policyMu.RLock()
+	hooks := sm.closeHooks
+	sm.policyMu.RUnlock()
+	info := cl.closeInfo()
+	for _, hook := range hooks {
+		sm.runHook("close", sessionKey, cl, func() {
+			hook(sessionKey, cl.id, info)
+		})
+	}
+}
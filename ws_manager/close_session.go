@@ -0,0 +1,101 @@
+package ws_manager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// closeAckTimeout bounds how long CloseSession waits for peers to answer
+// its close frame.
+const closeAckTimeout = 2 * time.Second
+
+// CloseError reports the connections of a session that could not be closed
+// cleanly, keyed by client ID.
+type CloseError struct {
+	Failures map[string]error
+}
+
+func (e *CloseError) Error() string {
+	ids := make([]string, 0, len(e.Failures))
+	for id := range e.Failures {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprintf("%s: %s", id, e.Failures[id])
+	}
+	return fmt.Sprintf("Close failed for %d connections: %s", len(ids), strings.Join(parts, "; "))
+}
+
+// CloseSession removes the session and performs the closing handshake with
+// each of its connections: a close frame with code and reason is sent, and
+// CloseSession waits for the peer's close frame until closeAckTimeout has
+// passed. Connections that could not be sent the frame, or did not answer
+// in time, are closed anyway and reported in a *CloseError.
+func (sm *SessionManager) CloseSession(sessionKey string, code int, reason string) error {
+	sm.sessionManagerMu.Lock()
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		sm.sessionManagerMu.Unlock()
+		return sessionNotFound(sessionKey)
+	}
+	delete(sm.sessions, s.key)
+	sm.endSubscriptions(s.key)
+	sm.cancelScheduledLocked(s)
+	sm.markStoredLocked(s.key, true)
+	clients := s.clients
+	s.clients = []*client{}
+	for _, cl := range clients {
+		cl.recordClose(CloseInfo{Code: code, Reason: reason, ByServer: true})
+		sm.leaveGroupsLocked(cl)
+		sm.statsMu.Lock()
+		sm.metrics.Disconnects++
+		sm.statsMu.Unlock()
+	}
+	sm.drainCheckLocked()
+	sm.sessionManagerMu.Unlock()
+
+	failures := map[string]error{}
+	deadline := time.Now().Add(closeAckTimeout)
+	message := websocket.FormatCloseMessage(code, reason)
+	for _, cl := range clients {
+		if err := cl.conn.WriteControl(websocket.CloseMessage, message, deadline); err != nil {
+			failures[cl.id] = err
+			cl.conn.Close()
+		}
+	}
+	timeout := time.NewTimer(time.Until(deadline))
+	defer timeout.Stop()
+	expired := false
+	for _, cl := range clients {
+		if _, failed := failures[cl.id]; failed {
+			continue
+		}
+		if !expired {
+			select {
+			case <-cl.left:
+				continue
+			case <-timeout.C:
+				expired = true
+			}
+		} else {
+			select {
+			case <-cl.left:
+				continue
+			default:
+			}
+		}
+		cl.conn.Close()
+		failures[cl.id] = errors.New("close not acknowledged")
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return &CloseError{Failures: failures}
+}
@@ -0,0 +1,123 @@
+package ws_manager
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type CloseTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+	closes     chan CloseInfo
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *CloseTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.closes = make(chan CloseInfo, 4)
+}
+
+func (suite *CloseTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+func (suite *CloseTestSuite) start(opts ...Option) {
+	// connections of the previous test may still be reporting
+	closes := suite.closes
+	opts = append(opts, WithOnClose(func(sessionKey, clientID string, info CloseInfo) {
+		closes <- info
+	}))
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, opts...)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *CloseTestSuite) nextClose() CloseInfo {
+	select {
+	case info := <-suite.closes:
+		return info
+	case <-time.After(time.Second):
+		suite.T().Fatal("no close reported")
+		return CloseInfo{}
+	}
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *CloseTestSuite) TestClientCloseFrameIsReported() {
+	suite.start(WithPresenceEvents(true))
+	watcher, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer watcher.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	peer, peerID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	_, err = readWithTimeout(watcher, time.Second)
+	assert.NoError(suite.T(), err)
+
+	peer.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(4001, "bye"))
+	message, err := readWithTimeout(watcher, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.JSONEq(suite.T(), `{"type":"leave","clientID":"`+peerID+`","code":4001,"reason":"bye"}`, message)
+	assert.Equal(suite.T(), CloseInfo{Code: 4001, Reason: "bye"}, suite.nextClose())
+
+	peer.Close()
+	watcher.Close()
+	assert.Equal(suite.T(), CloseInfo{Code: websocket.CloseAbnormalClosure}, suite.nextClose())
+}
+
+func (suite *CloseTestSuite) TestKickUsesCustomCloseCode() {
+	suite.start(WithPresenceEvents(true), WithCloseCode(CloseKick, 4100, "kicked"))
+	watcher, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer watcher.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	peer, peerID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer peer.Close()
+	_, err = readWithTimeout(watcher, time.Second)
+	assert.NoError(suite.T(), err)
+
+	assert.NoError(suite.T(), suite.manager.KickClient(suite.sessionKey, peerID, ""))
+	_, err = readWithTimeout(peer, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, 4100))
+	assert.Equal(suite.T(), "kicked", err.(*websocket.CloseError).Text)
+	message, err := readWithTimeout(watcher, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.JSONEq(suite.T(), `{"type":"leave","clientID":"`+peerID+`","code":4100,"reason":"kicked"}`, message)
+	assert.Equal(suite.T(), CloseInfo{Code: 4100, Reason: "kicked", ByServer: true}, suite.nextClose())
+}
+
+func (suite *CloseTestSuite) TestShutdownUsesCustomCloseCode() {
+	suite.start(WithCloseCode(CloseShutdown, 4200, ""))
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(suite.T(), suite.manager.Shutdown(ctx))
+	_, err = readWithTimeout(conn, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, 4200))
+	assert.Equal(suite.T(), "server shutting down", err.(*websocket.CloseError).Text)
+	assert.Equal(suite.T(), CloseInfo{Code: 4200, Reason: "server shutting down", ByServer: true}, suite.nextClose())
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestCloseTestSuite(t *testing.T) {
+	suite.Run(t, new(CloseTestSuite))
+}
@@ -0,0 +1,155 @@
+package ws_manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WithCoalescing holds the text frames written to each connection for up to
+// window and sends them as one text frame holding a JSON array, for chatty
+// traffic such as cursor positions. The window opens with the first frame
+// held and the batch is sent when it ends, so no frame waits longer than
+// window. In envelope and protocol mode the array holds the frames as they
+// are:
+//
+//	[{"type":"message","sender":"3",...},{"type":"message","sender":"4",...}]
+//
+// Otherwise every frame becomes a JSON string of the array:
+//
+//	["x=10","x=12"]
+//
+// A batch is sent as an array even when it holds a single frame. Binary
+// frames, including those of a binary codec, are not held: the batch
+// pending is sent first, then the binary frame, so order is kept. With
+// WithSendQueue the batch is queued as one frame. A window of zero or less
+// disables it.
+func WithCoalescing(window time.Duration) Option {
+	return func(sm *SessionManager) {
+		sm.coalesceWindow = window
+	}
+}
+
+// coalescer holds the text frames of a connection until its window ends.
+type coalescer struct {
+	window time.Duration
+	// raw wraps every frame as a JSON string
+	raw bool
+	// send writes a batch, or the frame that ends one
+	send func(messageType int, data []byte) error
+	// fail closes the connection after a batch failed to send from the
+	// timer, where no caller hears of the error
+	fail func(err error)
+
+	mu      sync.Mutex
+	pending [][]byte
+	timer   *time.Timer
+	stopped bool
+
+	// flushMu keeps batches in the order their frames were held
+	flushMu sync.Mutex
+}
+
+// startCoalescing installs the coalescer of cl, and returns the function
+// that stops it once the connection ends.
+func (sm *SessionManager) startCoalescing(sessionKey string, cl *client) (stop func()) {
+	window := sm.streamCoalesceWindow(cl.stream)
+	if window <= 0 {
+		return func() {}
+	}
+	c := &coalescer{
+		window: window,
+		raw:    !sm.envelopeMode && !sm.protocolMode,
+		send:   cl.send,
+		fail: func(err error) {
+			sm.logger.Warn("Write failed", "session", sessionKey, "client", cl.id, "err", err)
+			cl.conn.Close()
+		},
+	}
+	cl.coalesce = c
+	return c.stop
+}
+
+// hold adds a text frame to the batch, opening the window if it is the
+// first.
+func (c *coalescer) hold(data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return
+	}
+	c.pending = append(c.pending, append([]byte{}, data...))
+	if c.timer == nil {
+		c.timer = time.AfterFunc(c.window, func() {
+			if err := c.flush(); err != nil {
+				c.fail(err)
+			}
+		})
+	}
+}
+
+// writeThrough sends the pending batch, then the frame that is not held.
+func (c *coalescer) writeThrough(messageType int, data []byte) error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+	if err := c.flushLocked(); err != nil {
+		return err
+	}
+	return c.send(messageType, data)
+}
+
+func (c *coalescer) flush() error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+	return c.flushLocked()
+}
+
+// flushLocked sends the pending batch, if any. The caller must hold
+// flushMu.
+func (c *coalescer) flushLocked() error {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = nil
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	return c.send(websocket.TextMessage, c.batch(pending))
+}
+
+// batch joins frames into a JSON array.
+func (c *coalescer) batch(frames [][]byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte('[')
+	for i, frame := range frames {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if c.raw || !json.Valid(frame) {
+			quoted, _ := json.Marshal(string(frame))
+			frame = quoted
+		}
+		b.Write(frame)
+	}
+	b.WriteByte(']')
+	return b.Bytes()
+}
+
+// stop drops the pending batch and holds no more frames.
+func (c *coalescer) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = true
+	c.pending = nil
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+}
@@ -0,0 +1,108 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type CoalesceTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *CoalesceTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.start()
+}
+
+func (suite *CoalesceTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+func (suite *CoalesceTestSuite) start(opts ...Option) {
+	opts = append([]Option{WithCoalescing(50 * time.Millisecond)}, opts...)
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, opts...)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *CoalesceTestSuite) TestFramesWithinWindowAreBatched() {
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	for _, message := range []string{"x=10", "x=11", "x=12"} {
+		suite.manager.Broadcast(suite.sessionKey, SystemSender, websocket.TextMessage, []byte(message))
+	}
+	message, err := readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	var batch []string
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &batch))
+	assert.Equal(suite.T(), []string{"x=10", "x=11", "x=12"}, batch)
+
+	suite.manager.Broadcast(suite.sessionKey, SystemSender, websocket.TextMessage, []byte("x=13"))
+	message, err = readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), `["x=13"]`, message)
+}
+
+func (suite *CoalesceTestSuite) TestBinaryFrameSendsPendingBatchFirst() {
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	suite.manager.Broadcast(suite.sessionKey, SystemSender, websocket.TextMessage, []byte("before"))
+	suite.manager.Broadcast(suite.sessionKey, SystemSender, websocket.BinaryMessage, []byte{1, 2, 3})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	messageType, message, err := conn.ReadMessage()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), websocket.TextMessage, messageType)
+	assert.Equal(suite.T(), `["before"]`, string(message))
+	messageType, message, err = conn.ReadMessage()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), websocket.BinaryMessage, messageType)
+	assert.Equal(suite.T(), []byte{1, 2, 3}, message)
+}
+
+func (suite *CoalesceTestSuite) TestEnvelopesAreBatchedAsObjects() {
+	suite.TearDownTest()
+	suite.start(WithEnvelopeMode(true))
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	suite.manager.Broadcast(suite.sessionKey, SystemSender, websocket.TextMessage, []byte("one"))
+	suite.manager.Broadcast(suite.sessionKey, SystemSender, websocket.TextMessage, []byte("two"))
+	message, err := readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	var batch []envelope
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &batch))
+	if assert.Len(suite.T(), batch, 2) {
+		assert.Equal(suite.T(), "one", batch[0].Data)
+		assert.Equal(suite.T(), "two", batch[1].Data)
+	}
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestCoalesceTestSuite(t *testing.T) {
+	suite.Run(t, new(CoalesceTestSuite))
+}
@@ -0,0 +1,105 @@
+package ws_manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// Codec encodes the envelopes of protocol mode on the wire. Each codec is
+// offered as a WebSocket subprotocol named by Name, so every connection
+// picks its own encoding and a session can mix them: the manager decodes
+// inbound frames with the sender's codec and encodes outbound envelopes
+// with each recipient's.
+type Codec interface {
+	// Name is the subprotocol clients request the codec with.
+	Name() string
+	// MessageType is the frame type encoded envelopes are sent in.
+	MessageType() int
+	Encode(env Envelope) ([]byte, error)
+	Decode(data []byte) (Envelope, error)
+}
+
+// WithCodecs offers codecs to protocol mode connections, in order of
+// preference. Clients choose one through the Sec-WebSocket-Protocol
+// header; those that request none of them, or no subprotocol at all, speak
+// JSON. Negotiation is skipped when the upgrader lists its own
+// Subprotocols.
+func WithCodecs(codecs ...Codec) Option {
+	return func(sm *SessionManager) {
+		sm.codecs = codecs
+	}
+}
+
+// JSONCodec returns the default codec, offered as "json", which sends
+// envelopes as JSON text frames.
+func JSONCodec() Codec {
+	return jsonCodec{}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string     { return "json" }
+func (jsonCodec) MessageType() int { return websocket.TextMessage }
+
+func (jsonCodec) Encode(env Envelope) ([]byte, error) {
+	return json.Marshal(env)
+}
+
+func (jsonCodec) Decode(data []byte) (Envelope, error) {
+	var env Envelope
+	err := json.Unmarshal(data, &env)
+	return env, err
+}
+
+// negotiateCodec returns the first codec requested by r, or nil for JSON.
+func (sm *SessionManager) negotiateCodec(r *http.Request) Codec {
+	if !sm.protocolMode || len(sm.codecs) == 0 || sm.upgrader.Subprotocols != nil {
+		return nil
+	}
+	for _, requested := range websocket.Subprotocols(r) {
+		for _, codec := range sm.codecs {
+			if codec.Name() == requested {
+				return codec
+			}
+		}
+	}
+	return nil
+}
+
+// decodeEnvelope decodes an inbound protocol mode frame from cl.
+func (cl *client) decodeEnvelope(messageType int, message []byte) (Envelope, error) {
+	if cl.codec == nil {
+		if messageType != websocket.TextMessage {
+			return Envelope{}, errors.New("Envelope is not a text frame")
+		}
+		return jsonCodec{}.Decode(message)
+	}
+	if messageType != cl.codec.MessageType() {
+		return Envelope{}, errors.New("Envelope frame type does not match the codec")
+	}
+	return cl.codec.Decode(message)
+}
+
+// encodeFrame re-encodes an outbound JSON envelope with the codec of cl.
+// Frames that are not envelopes, e.g. presence events, are sent as they
+// are.
+func (cl *client) encodeFrame(messageType int, data []byte) (int, []byte) {
+	if cl.codec == nil || messageType != websocket.TextMessage {
+		return messageType, data
+	}
+	var env Envelope
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&env); err != nil || env.Type == "" {
+		return messageType, data
+	}
+	encoded, err := cl.codec.Encode(env)
+	if err != nil {
+		return messageType, data
+	}
+	return cl.codec.MessageType(), encoded
+}
@@ -0,0 +1,139 @@
+package ws_manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type CodecTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *CodecTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithProtocolMode(true),
+		WithCodecs(MsgpackCodec(), ProtobufCodec(), JSONCodec()),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *CodecTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+func (suite *CodecTestSuite) dial(subprotocol string) *websocket.Conn {
+	header := http.Header{}
+	if subprotocol != "" {
+		header.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+	conn, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", header)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), subprotocol, resp.Header.Get("Sec-WebSocket-Protocol"))
+	return conn
+}
+
+func (suite *CodecTestSuite) readEnvelope(conn *websocket.Conn, codec Codec) Envelope {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	messageType, message, err := conn.ReadMessage()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), codec.MessageType(), messageType)
+	env, err := codec.Decode(message)
+	assert.NoError(suite.T(), err)
+	return env
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *CodecTestSuite) TestCodecsRoundTrip() {
+	env := Envelope{
+		Type:       "edit",
+		Sender:     "7",
+		SessionKey: suite.sessionKey,
+		Timestamp:  1700000000000,
+		Payload:    []byte(`{"ops":[{"insert":"hi","at":-3}],"ratio":0.5,"done":false,"note":null}`),
+		Replayed:   true,
+	}
+	for _, codec := range []Codec{JSONCodec(), MsgpackCodec(), ProtobufCodec()} {
+		data, err := codec.Encode(env)
+		assert.NoError(suite.T(), err, codec.Name())
+		decoded, err := codec.Decode(data)
+		assert.NoError(suite.T(), err, codec.Name())
+		assert.Equal(suite.T(), env.Type, decoded.Type, codec.Name())
+		assert.Equal(suite.T(), env.Sender, decoded.Sender, codec.Name())
+		assert.Equal(suite.T(), env.SessionKey, decoded.SessionKey, codec.Name())
+		assert.Equal(suite.T(), env.Timestamp, decoded.Timestamp, codec.Name())
+		assert.Equal(suite.T(), env.Replayed, decoded.Replayed, codec.Name())
+		assert.JSONEq(suite.T(), string(env.Payload), string(decoded.Payload), codec.Name())
+	}
+
+	_, err := MsgpackCodec().Decode([]byte{0xdb, 0xff, 0xff, 0xff, 0xff})
+	assert.Error(suite.T(), err)
+	_, err = ProtobufCodec().Decode([]byte{0x0a, 0x10, 'x'})
+	assert.Error(suite.T(), err)
+}
+
+func (suite *CodecTestSuite) TestClientsMixEncodings() {
+	jsonConn := suite.dial("")
+	msgpackConn := suite.dial("msgpack")
+	protobufConn := suite.dial("protobuf")
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 3))
+
+	assert.NoError(suite.T(), jsonConn.WriteMessage(websocket.TextMessage, []byte(`{"type":"chat","payload":{"text":"hi"}}`)))
+	for conn, codec := range map[*websocket.Conn]Codec{msgpackConn: MsgpackCodec(), protobufConn: ProtobufCodec()} {
+		env := suite.readEnvelope(conn, codec)
+		assert.Equal(suite.T(), "chat", env.Type)
+		assert.Equal(suite.T(), suite.sessionKey, env.SessionKey)
+		assert.JSONEq(suite.T(), `{"text":"hi"}`, string(env.Payload))
+	}
+
+	frame, err := MsgpackCodec().Encode(Envelope{Type: "cursor", Payload: []byte(`{"line":4}`)})
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), msgpackConn.WriteMessage(websocket.BinaryMessage, frame))
+	env := suite.readEnvelope(jsonConn, JSONCodec())
+	assert.Equal(suite.T(), "cursor", env.Type)
+	assert.JSONEq(suite.T(), `{"line":4}`, string(env.Payload))
+	env = suite.readEnvelope(protobufConn, ProtobufCodec())
+	assert.Equal(suite.T(), "cursor", env.Type)
+	assert.JSONEq(suite.T(), `{"line":4}`, string(env.Payload))
+
+	// a JSON text frame does not match the msgpack connection's codec
+	assert.NoError(suite.T(), msgpackConn.WriteMessage(websocket.TextMessage, []byte(`{"type":"chat"}`)))
+	_, err = readWithTimeout(jsonConn, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *CodecTestSuite) TestUnknownSubprotocolFallsBackToJSON() {
+	header := http.Header{}
+	header.Set("Sec-WebSocket-Protocol", "cbor")
+	conn, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", header)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), resp.Header.Get("Sec-WebSocket-Protocol"))
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	assert.NoError(suite.T(), suite.manager.BroadcastEnvelope(suite.sessionKey, "notice", map[string]string{"text": "hello"}))
+	env := suite.readEnvelope(conn, JSONCodec())
+	assert.Equal(suite.T(), "notice", env.Type)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestCodecTestSuite(t *testing.T) {
+	suite.Run(t, new(CodecTestSuite))
+}
@@ -0,0 +1,64 @@
+package ws_manager
+
+import (
+	"compress/flate"
+	"net/http"
+	"strings"
+)
+
+const defaultCompressionLevel = flate.BestSpeed
+
+// WithCompression negotiates permessage-deflate with clients that offer it;
+// the others connect uncompressed as before. Frames are compressed one
+// write at a time under the per-connection write lock, so compression is
+// safe with concurrent broadcasts. A WithParallelBroadcast broadcast is
+// prepared once per encoding, so compressed and uncompressed connections
+// of one session each get a frame they can read. ClientInfo.Compressed
+// tells which connections negotiated it.
+func WithCompression(enabled bool) Option {
+	return func(sm *SessionManager) {
+		sm.compression = enabled
+	}
+}
+
+// WithCompressionLevel sets the flate level, from flate.HuffmanOnly to
+// flate.BestCompression, used on compressed connections. The default is
+// flate.BestSpeed.
+func WithCompressionLevel(level int) Option {
+	return func(sm *SessionManager) {
+		sm.compressionLevel = level
+	}
+}
+
+// WithCompressionThreshold sends frames shorter than size bytes
+// uncompressed even on compressed connections, where deflating them costs
+// more than it saves. Zero, the default, compresses every frame.
+func WithCompressionThreshold(size int) Option {
+	return func(sm *SessionManager) {
+		sm.compressionThreshold = size
+	}
+}
+
+// offersDeflate reports whether the upgrade request r offers
+// permessage-deflate, which the upgrader then accepts when compression is
+// enabled.
+func offersDeflate(r *http.Request) bool {
+	for _, value := range r.Header.Values("Sec-Websocket-Extensions") {
+		for _, ext := range strings.Split(value, ",") {
+			name := strings.TrimSpace(strings.SplitN(ext, ";", 2)[0])
+			if strings.EqualFold(name, "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setWriteCompression turns compression of the next frame of cl, of size
+// bytes, on or off by the compression threshold. The caller must hold
+// writeMu.
+func (cl *client) setWriteCompression(size int) {
+	if cl.compressed && cl.compressThreshold > 0 {
+		cl.conn.EnableWriteCompression(size >= cl.compressThreshold)
+	}
+}
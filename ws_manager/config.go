@@ -0,0 +1,148 @@
+package ws_manager
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Config gathers the transport settings of a SessionManager in one place.
+// Zero fields keep the defaults, so a Config only needs the settings it
+// changes:
+//
+//	sm := CreateSessionManager(keys, WithConfig(Config{
+//		AllowedOrigins: []string{"https://example.com", "https://*.example.com"},
+//		WriteTimeout:   5 * time.Second,
+//		MaxMessageSize: 64 << 10,
+//		Compression:    true,
+//	}))
+//
+// Options after WithConfig override it.
+type Config struct {
+	// AllowedOrigins lists the origins accepted on upgrade, with wildcards,
+	// as WithAllowedOrigins.
+	AllowedOrigins []string
+	// CheckOrigin accepts or rejects the Origin of upgrade requests, as
+	// WithCheckOrigin. Together with AllowedOrigins it is consulted for the
+	// origins not on the list.
+	CheckOrigin func(*http.Request) bool
+	// ReadBufferSize and WriteBufferSize size the upgrader's I/O buffers,
+	// as WithBufferSizes.
+	ReadBufferSize  int
+	WriteBufferSize int
+	// HandshakeTimeout bounds upgrades, as WithHandshakeTimeout.
+	HandshakeTimeout time.Duration
+	// WriteBufferPool lends connections their write buffers, as
+	// WithWriteBufferPool.
+	WriteBufferPool websocket.BufferPool
+	// ReadTimeout closes connections that send no message for this long,
+	// as WithIdleConnTimeout.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds every data frame write, as WithWriteTimeout.
+	WriteTimeout time.Duration
+	// PingInterval and PongTimeout configure keepalive, as WithKeepalive.
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+	// MaxMessageSize limits inbound messages, as WithMaxMessageSize.
+	MaxMessageSize int64
+	// Compression and CompressionLevel configure permessage-deflate, as
+	// WithCompression and WithCompressionLevel. Since zero means unset,
+	// flate.NoCompression cannot be selected here.
+	Compression      bool
+	CompressionLevel int
+	// CompressionThreshold is the smallest frame compressed, as
+	// WithCompressionThreshold.
+	CompressionThreshold int
+	// AutoRegister creates sessions on demand, as WithAutoRegister, up to
+	// MaxSessions, as WithMaxSessions.
+	AutoRegister bool
+	MaxSessions  int
+	// MaxTotalConnections caps the connections across all sessions, as
+	// WithMaxTotalConnections, and LimitPolicy enforces both caps, as
+	// WithLimitPolicy.
+	MaxTotalConnections int
+	LimitPolicy         LimitPolicy
+	// LogLevel is the least severe level logged, as WithLogLevel.
+	LogLevel LogLevel
+	// UnknownSession sets how dials to unregistered sessions are refused,
+	// as WithUnknownSessionPolicy.
+	UnknownSession UnknownSessionPolicy
+}
+
+// WithConfig applies the non-zero fields of cfg.
+func WithConfig(cfg Config) Option {
+	return func(sm *SessionManager) {
+		switch {
+		case len(cfg.AllowedOrigins) > 0 && cfg.CheckOrigin != nil:
+			allowed := AllowOrigins(cfg.AllowedOrigins...)
+			sm.originChecker = func(r *http.Request) bool {
+				return allowed(r) || cfg.CheckOrigin(r)
+			}
+		case len(cfg.AllowedOrigins) > 0:
+			sm.originChecker = AllowOrigins(cfg.AllowedOrigins...)
+		case cfg.CheckOrigin != nil:
+			sm.originChecker = cfg.CheckOrigin
+		}
+		if cfg.ReadBufferSize > 0 {
+			sm.upgrader.ReadBufferSize = cfg.ReadBufferSize
+		}
+		if cfg.WriteBufferSize > 0 {
+			sm.upgrader.WriteBufferSize = cfg.WriteBufferSize
+		}
+		if cfg.HandshakeTimeout > 0 {
+			sm.upgrader.HandshakeTimeout = cfg.HandshakeTimeout
+		}
+		if cfg.WriteBufferPool != nil {
+			sm.upgrader.WriteBufferPool = cfg.WriteBufferPool
+		}
+		if cfg.ReadTimeout > 0 {
+			sm.idleConnTimeout = cfg.ReadTimeout
+		}
+		if cfg.WriteTimeout > 0 {
+			sm.writeTimeout = cfg.WriteTimeout
+		}
+		if cfg.PingInterval > 0 {
+			WithKeepalive(cfg.PingInterval, cfg.PongTimeout)(sm)
+		}
+		if cfg.MaxMessageSize > 0 {
+			sm.maxMessageSize = cfg.MaxMessageSize
+		}
+		if cfg.Compression {
+			sm.compression = true
+		}
+		if cfg.CompressionLevel != 0 {
+			sm.compressionLevel = cfg.CompressionLevel
+		}
+		if cfg.UnknownSession != UnknownSessionReject {
+			sm.unknownSessionPolicy = cfg.UnknownSession
+		}
+		if cfg.AutoRegister {
+			sm.autoRegister = true
+		}
+		if cfg.MaxSessions > 0 {
+			sm.maxSessions = cfg.MaxSessions
+		}
+		if cfg.MaxTotalConnections > 0 {
+			sm.maxTotalConnections = cfg.MaxTotalConnections
+		}
+		if cfg.LimitPolicy != LimitReject {
+			sm.limitPolicy = cfg.LimitPolicy
+		}
+		if cfg.CompressionThreshold > 0 {
+			sm.compressionThreshold = cfg.CompressionThreshold
+		}
+		if cfg.LogLevel != LogInfo {
+			sm.logLevel = cfg.LogLevel
+		}
+	}
+}
+
+// WithWriteTimeout fails a data frame write to a connection that has not
+// completed within timeout, which then drops the connection like any other
+// failed write. Zero, the default, waits indefinitely.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(sm *SessionManager) {
+		sm.writeTimeout = timeout
+	}
+}
@@ -0,0 +1,44 @@
+package ws_manager
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// CloseNoActivity is the close code sent to a connection that did nothing
+// within the connect grace timeout.
+const CloseNoActivity = 4006
+
+// WithConnectGraceTimeout closes connections that neither send nor receive a
+// message within d of connecting. Zero disables the check.
+func WithConnectGraceTimeout(d time.Duration) Option {
+	return func(sm *SessionManager) {
+		sm.connectGraceTimeout = d
+	}
+}
+
+func (cl *client) markActive() {
+	atomic.StoreInt32(&cl.active, 1)
+	atomic.StoreInt64(&cl.lastActive, time.Now().UnixNano())
+}
+
+func (cl *client) isActive() bool {
+	return atomic.LoadInt32(&cl.active) == 1
+}
+
+// watchConnectGrace arms the connect grace timer for cl. The returned
+// function disarms it and must be called when the connection ends.
+func (sm *SessionManager) watchConnectGrace(sessionKey string, cl *client) (stop func()) {
+	if sm.connectGraceTimeout <= 0 {
+		return func() {}
+	}
+	timer := time.AfterFunc(sm.connectGraceTimeout, func() {
+		if cl.isActive() {
+			return
+		}
+		sm.disconnectClient(sessionKey, cl, CloseNoActivity, "no activity after connect")
+	})
+	return func() {
+		timer.Stop()
+	}
+}
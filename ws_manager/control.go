@@ -0,0 +1,128 @@
+package ws_manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// controlMessage is an inbound frame addressed to the manager instead of the
+// session. With WithControlMessages, control frames are text frames holding
+// a JSON object with a "control" field and are never broadcast, e.g.
+//
+//	{"control":"block","identities":["bob"]}
+//	{"control":"unblock","identities":["bob"]}
+//	{"control":"ack","seq":12}
+//	{"control":"qos-ack","seq":7}
+//	{"control":"subscribe","channels":["room-1"]}
+//	{"control":"since","seq":41}
+//
+// See WithSessionOwners for the moderation controls.
+type controlMessage struct {
+	Control    string   `json:"control"`
+	Identities []string `json:"identities,omitempty"`
+	Seq        uint64   `json:"seq,omitempty"`
+	Channels   []string `json:"channels,omitempty"`
+	ClientID   string   `json:"clientID,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+	Key        string   `json:"key,omitempty"`
+}
+
+// WithControlMessages has the manager take text frames holding a JSON object
+// with a "control" field as control frames, see controlMessage. It is off by
+// default, so application JSON with a "control" key is relayed as any other
+// message. WithAckPolicy, WithQoS, WithSessionOwners, WithSequenceNumbers and
+// WithEndToEndEncryption turn it on, as their clients answer with control
+// frames.
+func WithControlMessages(enabled bool) Option {
+	return func(sm *SessionManager) {
+		sm.controlMessages = enabled
+	}
+}
+
+// controlEnabled reports whether inbound frames are checked for controls.
+func (sm *SessionManager) controlEnabled() bool {
+	return sm.controlMessages || sm.ackTimeout > 0 || sm.qosRetryInterval > 0 ||
+		sm.sessionOwners || sm.sequenceNumbers || sm.endToEnd
+}
+
+func parseControlMessage(message []byte) (controlMessage, bool) {
+	var msg controlMessage
+	trimmed := bytes.TrimSpace(message)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return msg, false
+	}
+	if err := json.Unmarshal(trimmed, &msg); err != nil || msg.Control == "" {
+		return msg, false
+	}
+	return msg, true
+}
+
+// receiveControl runs the control frame msg, size bytes, from cl past the
+// rate limits and handles it. Muted connections may only acknowledge
+// deliveries, so that QoS and the ack policy keep working for them.
+func (sm *SessionManager) receiveControl(sessionKey string, cl *client, msg controlMessage, size int) {
+	sm.countInbound(sessionKey, size)
+	if cl.isMuted() && msg.Control != "ack" && msg.Control != "qos-ack" {
+		sm.rejectMuted(sessionKey, cl)
+		return
+	}
+	if sm.rateLimited(sessionKey, cl, size) {
+		return
+	}
+	sm.handleControl(sessionKey, cl, msg)
+}
+
+func (sm *SessionManager) handleControl(sessionKey string, cl *client, msg controlMessage) {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	if sm.moderateLocked(sessionKey, cl, msg) || sm.publishKeyLocked(sessionKey, cl, msg) {
+		return
+	}
+	switch msg.Control {
+	case "block":
+		for _, identity := range msg.Identities {
+			if identity != "" {
+				cl.blocked[identity] = struct{}{}
+			}
+		}
+	case "unblock":
+		for _, identity := range msg.Identities {
+			delete(cl.blocked, identity)
+		}
+	case "ack":
+		if err := sm.ackLocked(cl, msg.Seq); err != nil {
+			sm.logger.Warn("Invalid ack", "session", sessionKey, "client", cl.id, "err", err)
+		}
+	case "qos-ack":
+		if !sm.settleDeliveryLocked(sessionKey, cl, msg.Seq, nil) {
+			sm.logger.Debug("Ack for no pending message", "session", sessionKey, "client", cl.id, "seq", msg.Seq)
+		}
+	case "since":
+		if s, ok := sm.sessions[sessionKey]; ok {
+			if _, err := sm.replaySinceLocked(s, cl, msg.Seq); err != nil && !errors.Is(err, ErrSequenceGap) {
+				sm.logger.Warn("Replay failed", "session", sessionKey, "client", cl.id, "err", err)
+			}
+		}
+	case "subscribe":
+		for _, channel := range msg.Channels {
+			if err := cl.subscribe(channel); err != nil {
+				sm.logger.Warn("Invalid subscribe", "session", sessionKey, "client", cl.id, "err", err)
+			}
+		}
+	case "unsubscribe":
+		for _, channel := range msg.Channels {
+			delete(cl.channels, channel)
+		}
+	default:
+		sm.logger.Warn("Unknown control message", "session", sessionKey, "client", cl.id, "control", msg.Control)
+	}
+}
+
+func (cl *client) hasBlocked(identity string) bool {
+	if identity == "" {
+		return false
+	}
+	_, ok := cl.blocked[identity]
+	return ok
+}
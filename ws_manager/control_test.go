@@ -0,0 +1,168 @@
+package ws_manager
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ControlTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *ControlTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithAuth(headerAuth), WithControlMessages(true))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *ControlTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *ControlTestSuite) TestParseControlMessage() {
+	msg, ok := parseControlMessage([]byte(` {"control":"block","identities":["bob"]}`))
+	assert.True(suite.T(), ok)
+	assert.Equal(suite.T(), "block", msg.Control)
+	assert.Equal(suite.T(), []string{"bob"}, msg.Identities)
+
+	for _, raw := range []string{"hello", `{"text":"hi"}`, `{"control":`, `["control"]`} {
+		_, ok := parseControlMessage([]byte(raw))
+		assert.False(suite.T(), ok, raw)
+	}
+}
+
+func (suite *ControlTestSuite) TestBlockedSenderIsNotDelivered() {
+	alice, _, err := dialSessionAs(suite.server, suite.sessionKey, "alice")
+	assert.NoError(suite.T(), err)
+	bob, _, err := dialSessionAs(suite.server, suite.sessionKey, "bob")
+	assert.NoError(suite.T(), err)
+	carol, _, err := dialSessionAs(suite.server, suite.sessionKey, "carol")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 3))
+
+	alice.WriteMessage(1, []byte(`{"control":"block","identities":["bob"]}`))
+	time.Sleep(100 * time.Millisecond)
+	bob.WriteMessage(1, []byte("hi all"))
+
+	message, err := readWithTimeout(carol, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "hi all", message)
+
+	_, err = readWithTimeout(alice, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *ControlTestSuite) TestUnblockRestoresDelivery() {
+	alice, _, err := dialSessionAs(suite.server, suite.sessionKey, "alice")
+	assert.NoError(suite.T(), err)
+	bob, _, err := dialSessionAs(suite.server, suite.sessionKey, "bob")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	alice.WriteMessage(1, []byte(`{"control":"block","identities":["bob"]}`))
+	alice.WriteMessage(1, []byte(`{"control":"unblock","identities":["bob"]}`))
+	time.Sleep(100 * time.Millisecond)
+	bob.WriteMessage(1, []byte("hi alice"))
+
+	message, err := readWithTimeout(alice, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "hi alice", message)
+}
+
+func (suite *ControlTestSuite) TestControlMessagesAreOptIn() {
+	manager := CreateSessionManager([]string{suite.sessionKey})
+	defer manager.cronScheduler.Stop()
+	e := echo.New()
+	e.GET("/:sessionKey", manager.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+	sender, err := dialSession(server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(manager, suite.sessionKey, 2))
+
+	frame := `{"control":"block","identities":["bob"]}`
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte(frame)))
+	message, err := readWithTimeout(receiver, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), frame, message)
+}
+
+func (suite *ControlTestSuite) TestControlFramesAreRateLimited() {
+	manager := CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithLogger(NopLogger()),
+		WithControlMessages(true),
+		WithRateLimit(0.1, 2, 0),
+	)
+	defer manager.cronScheduler.Stop()
+	e := echo.New()
+	e.GET("/:sessionKey", manager.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+	conn, err := dialSession(server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(manager, suite.sessionKey, 1))
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(suite.T(), conn.WriteMessage(websocket.TextMessage, []byte(`{"control":"subscribe","channels":["room-1"]}`)))
+	}
+	assert.Eventually(suite.T(), func() bool {
+		return manager.Metrics().RateLimitedMessages == 3
+	}, time.Second, 10*time.Millisecond)
+}
+
+func (suite *ControlTestSuite) TestControlLocksOnlyItsShard() {
+	keys := []string{}
+	for i := 0; i < 8; i++ {
+		keys = append(keys, string(rune('a'+i))+"session")
+	}
+	manager := CreateSessionManager(keys, WithControlMessages(true))
+	defer manager.cronScheduler.Stop()
+	busy, other := keys[0], ""
+	for _, key := range keys[1:] {
+		if manager.shardOf(key) != manager.shardOf(busy) {
+			other = key
+			break
+		}
+	}
+	if other == "" {
+		suite.T().Fatal("all keys on one shard")
+	}
+
+	manager.lockSession(busy)
+	defer manager.unlockSession(busy)
+	done := make(chan struct{})
+	go func() {
+		manager.handleControl(other, &client{blocked: map[string]struct{}{}}, controlMessage{Control: "block", Identities: []string{"bob"}})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		suite.T().Fatal("control frame blocked by another shard")
+	}
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestControlTestSuite(t *testing.T) {
+	suite.Run(t, new(ControlTestSuite))
+}
@@ -0,0 +1,50 @@
+package ws_manager
+
+// Reasons reported in DeadLetter.Reason.
+const (
+	DeadLetterSizeExceeded = "size exceeded"
+	DeadLetterWriteFailed  = "write failed"
+)
+
+// DeadLetter describes a message that could not be delivered to one
+// recipient.
+type DeadLetter struct {
+	SessionKey string
+	ClientID   string
+	Message    []byte
+	Reason     string
+}
+
+// WithDeadLetterHandler receives every message dropped for a recipient. The
+// handler runs under the manager lock and must not call back into the
+// manager. It may run concurrently for different sessions.
+func WithDeadLetterHandler(handler func(DeadLetter)) Option {
+	return func(sm *SessionManager) {
+		sm.deadLetter = handler
+	}
+}
+
+// WithMaxOutboundMessageSize drops messages larger than limit bytes for the
+// recipient they are about to be written to, after every rewrite has been
+// applied. Dropped messages go to the dead-letter handler. Zero means no
+// limit.
+func WithMaxOutboundMessageSize(limit int) Option {
+	return func(sm *SessionManager) {
+		sm.maxOutboundMessageSize = limit
+	}
+}
+
+func (sm *SessionManager) deadLetterLocked(s *session, cl *client, message []byte, reason string) {
+	sm.statsMu.Lock()
+	sm.metrics.DroppedMessages++
+	sm.statsMu.Unlock()
+	if sm.deadLetter == nil {
+		return
+	}
+	sm.deadLetter(DeadLetter{
+		SessionKey: s.key,
+		ClientID:   cl.id,
+		Message:    message,
+		Reason:     reason,
+	})
+}
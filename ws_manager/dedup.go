@@ -0,0 +1,123 @@
+package ws_manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// MessageIDFunc extracts the client-assigned ID of an inbound message. An
+// empty ID opts the message out of deduplication.
+type MessageIDFunc func(message []byte) string
+
+// WithInboundDedup drops inbound messages whose ID the same sender already
+// used within window. Senders are keyed by identity, falling back to the
+// client ID for anonymous clients, and the seen-set lives on the
+// session, so a message retried on a new socket after a reconnect is still
+// recognized. IDs are forgotten once the window has passed, and those of an
+// anonymous client once it has left and can no longer resume. A nil idOf
+// reads the "id" field of JSON object messages.
+func WithInboundDedup(window time.Duration, idOf MessageIDFunc) Option {
+	return func(sm *SessionManager) {
+		if idOf == nil {
+			idOf = jsonMessageID
+		}
+		sm.dedupWindow = window
+		sm.dedupID = idOf
+	}
+}
+
+func jsonMessageID(message []byte) string {
+	trimmed := bytes.TrimSpace(message)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return ""
+	}
+	var msg struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(trimmed, &msg); err != nil {
+		return ""
+	}
+	return msg.ID
+}
+
+func (cl *client) dedupKey() string {
+	if cl.identity != "" {
+		return "id:" + cl.identity
+	}
+	return "id:" + cl.id
+}
+
+// isDuplicate records message as seen from cl and reports whether it had
+// already been seen within the dedup window.
+func (sm *SessionManager) isDuplicate(sessionKey string, cl *client, message []byte) bool {
+	if sm.dedupID == nil {
+		return false
+	}
+	id := sm.dedupID(message)
+	if id == "" {
+		return false
+	}
+
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	if now.Sub(s.seenSwept) > sm.dedupWindow {
+		sm.sweepSeenLocked(s, now)
+	}
+	key := cl.dedupKey()
+	seen, ok := s.seen[key]
+	if !ok {
+		seen = map[string]time.Time{}
+		s.seen[key] = seen
+	}
+	sm.expireSeen(seen, now)
+	if _, dup := seen[id]; dup {
+		sm.statsMu.Lock()
+		sm.metrics.DuplicateMessages++
+		sm.statsMu.Unlock()
+		return true
+	}
+	seen[id] = now
+	return false
+}
+
+// expireSeen removes the IDs seen longer than the dedup window ago.
+func (sm *SessionManager) expireSeen(seen map[string]time.Time, now time.Time) {
+	for seenID, at := range seen {
+		if now.Sub(at) > sm.dedupWindow {
+			delete(seen, seenID)
+		}
+	}
+}
+
+// sweepSeenLocked expires the IDs of every sender of s and removes the
+// senders left with none, such as identities that have not come back. The
+// caller must hold sessionManagerMu.
+func (sm *SessionManager) sweepSeenLocked(s *session, now time.Time) {
+	for key, seen := range s.seen {
+		sm.expireSeen(seen, now)
+		if len(seen) == 0 {
+			delete(s.seen, key)
+		}
+	}
+	s.seenSwept = now
+}
+
+// forgetSeenLocked removes the seen-set of cl, which left s, unless cl can
+// still come back as the same sender: while it is parked for resuming, or
+// for the rest of the window when it is keyed by identity. The caller must
+// hold sessionManagerMu.
+func (sm *SessionManager) forgetSeenLocked(s *session, cl *client) {
+	if cl.identity != "" {
+		return
+	}
+	if slot, ok := s.parked[cl.resumeToken]; ok && slot.client == cl {
+		return
+	}
+	delete(s.seen, cl.dedupKey())
+}
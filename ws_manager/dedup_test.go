@@ -0,0 +1,168 @@
+package ws_manager
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type DedupTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *DedupTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithAuth(headerAuth),
+		WithInboundDedup(time.Minute, nil),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *DedupTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *DedupTestSuite) TestRetryAfterReconnectIsDropped() {
+	bob, _, err := dialSessionAs(suite.server, suite.sessionKey, "bob")
+	assert.NoError(suite.T(), err)
+	alice, _, err := dialSessionAs(suite.server, suite.sessionKey, "alice")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	alice.WriteMessage(1, []byte(`{"id":"m1","text":"hello"}`))
+	message, err := readWithTimeout(bob, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), `{"id":"m1","text":"hello"}`, message)
+
+	// alice drops and retries m1 on a fresh socket
+	alice.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	alice, _, err = dialSessionAs(suite.server, suite.sessionKey, "alice")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+	alice.WriteMessage(1, []byte(`{"id":"m1","text":"hello"}`))
+	alice.WriteMessage(1, []byte(`{"id":"m2","text":"again"}`))
+
+	message, err = readWithTimeout(bob, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), `{"id":"m2","text":"again"}`, message)
+	assert.Equal(suite.T(), uint64(1), suite.manager.Metrics().DuplicateMessages)
+}
+
+func (suite *DedupTestSuite) TestSameIDFromDifferentSenders() {
+	bob, _, err := dialSessionAs(suite.server, suite.sessionKey, "bob")
+	assert.NoError(suite.T(), err)
+	alice, _, err := dialSessionAs(suite.server, suite.sessionKey, "alice")
+	assert.NoError(suite.T(), err)
+	carol, _, err := dialSessionAs(suite.server, suite.sessionKey, "carol")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 3))
+
+	alice.WriteMessage(1, []byte(`{"id":"m1"}`))
+	_, err = readWithTimeout(bob, time.Second)
+	assert.NoError(suite.T(), err)
+	carol.WriteMessage(1, []byte(`{"id":"m1"}`))
+	_, err = readWithTimeout(bob, time.Second)
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *DedupTestSuite) TestMessagesWithoutIDAreNotDeduplicated() {
+	assert.Equal(suite.T(), "", jsonMessageID([]byte("plain text")))
+	assert.Equal(suite.T(), "", jsonMessageID([]byte(`{"text":"no id"}`)))
+	assert.Equal(suite.T(), "abc", jsonMessageID([]byte(`{"id":"abc"}`)))
+}
+
+// seenKeys returns the dedup keys the session of manager holds.
+func (suite *DedupTestSuite) seenKeys(manager *SessionManager) []string {
+	manager.rlockSession(suite.sessionKey)
+	defer manager.runlockSession(suite.sessionKey)
+	keys := []string{}
+	for key := range manager.sessions[suite.sessionKey].seen {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (suite *DedupTestSuite) startManager(opts ...Option) (*SessionManager, *httptest.Server) {
+	manager := CreateSessionManager([]string{suite.sessionKey}, opts...)
+	e := echo.New()
+	e.GET("/:sessionKey", manager.EchoHandler)
+	return manager, httptest.NewServer(e)
+}
+
+func (suite *DedupTestSuite) TestAnonymousSendersAreForgotten() {
+	manager, server := suite.startManager(WithInboundDedup(time.Minute, nil))
+	defer manager.cronScheduler.Stop()
+	defer server.Close()
+	for i := 0; i < 3; i++ {
+		conn, err := dialSession(server, suite.sessionKey, "")
+		assert.NoError(suite.T(), err)
+		assert.NoError(suite.T(), conn.WriteMessage(1, []byte(`{"id":"m1"}`)))
+		assert.Eventually(suite.T(), func() bool { return len(suite.seenKeys(manager)) == 1 }, time.Second, 10*time.Millisecond)
+		conn.Close()
+		assert.True(suite.T(), waitForConnections(manager, suite.sessionKey, 0))
+		assert.Empty(suite.T(), suite.seenKeys(manager))
+	}
+}
+
+func (suite *DedupTestSuite) TestParkedSendersAreForgottenOnExpiry() {
+	manager, server := suite.startManager(WithInboundDedup(time.Minute, nil), WithResume(100*time.Millisecond, 0))
+	defer manager.cronScheduler.Stop()
+	defer server.Close()
+	conn, err := dialSession(server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), conn.WriteMessage(1, []byte(`{"id":"m1"}`)))
+	assert.Eventually(suite.T(), func() bool { return len(suite.seenKeys(manager)) == 1 }, time.Second, 10*time.Millisecond)
+	conn.Close()
+	assert.True(suite.T(), waitForConnections(manager, suite.sessionKey, 0))
+
+	// kept while the connection can resume, then dropped
+	assert.Len(suite.T(), suite.seenKeys(manager), 1)
+	assert.Eventually(suite.T(), func() bool { return len(suite.seenKeys(manager)) == 0 }, 2*time.Second, 10*time.Millisecond)
+}
+
+func (suite *DedupTestSuite) TestExpiredSendersAreSwept() {
+	manager, server := suite.startManager(WithAuth(headerAuth), WithInboundDedup(50*time.Millisecond, nil))
+	defer manager.cronScheduler.Stop()
+	defer server.Close()
+	alice, _, err := dialSessionAs(server, suite.sessionKey, "alice")
+	assert.NoError(suite.T(), err)
+	bob, _, err := dialSessionAs(server, suite.sessionKey, "bob")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(manager, suite.sessionKey, 2))
+	assert.NoError(suite.T(), alice.WriteMessage(1, []byte(`{"id":"m1"}`)))
+	_, err = readWithTimeout(bob, time.Second)
+	assert.NoError(suite.T(), err)
+	alice.Close()
+	assert.True(suite.T(), waitForConnections(manager, suite.sessionKey, 1))
+	assert.Equal(suite.T(), []string{"id:alice"}, suite.seenKeys(manager))
+
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(suite.T(), bob.WriteMessage(1, []byte(`{"id":"m2"}`)))
+	assert.Eventually(suite.T(), func() bool {
+		keys := suite.seenKeys(manager)
+		return len(keys) == 1 && keys[0] == "id:bob"
+	}, time.Second, 10*time.Millisecond)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestDedupTestSuite(t *testing.T) {
+	suite.Run(t, new(DedupTestSuite))
+}
@@ -0,0 +1,128 @@
+package ws_manager
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// AlternateHostHeader carries the host to reconnect to in the responses
+// refusing dials while the manager drains, see WithDrainResponse.
+const AlternateHostHeader = "X-Alternate-Host"
+
+// ErrDraining refuses connections once StartDraining is called.
+var ErrDraining = errors.New("Server is draining")
+
+// WithDrainResponse answers dials refused while the manager drains with
+// status instead of 503 Service Unavailable, and, if alternateHost is not
+// empty, tells the client where to reconnect in the AlternateHostHeader,
+// e.g. the instance replacing this one in a deploy.
+func WithDrainResponse(status int, alternateHost string) Option {
+	return func(sm *SessionManager) {
+		sm.drainStatus = status
+		sm.drainHost = alternateHost
+	}
+}
+
+// StartDraining puts the manager in drain mode for a zero-downtime deploy:
+// new connections are refused, see WithDrainResponse, while the existing
+// ones carry on until they close. Once timeout has passed, unless it is
+// zero, the remaining connections are closed going away with the reason
+// "server draining", or as set with WithCloseCode(CloseDrain, ...). The
+// returned channel is closed once no connections are left, as is the one
+// Drained returns. Calling StartDraining again returns the same channel and
+// arms a further timeout.
+func (sm *SessionManager) StartDraining(timeout time.Duration) <-chan struct{} {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	if !sm.draining {
+		sm.draining = true
+		sm.logger.Info("Draining connections", "connections", sm.connectionCountLocked())
+	}
+	if sm.drained == nil {
+		sm.drained = make(chan struct{})
+	}
+	sm.drainCheckLocked()
+	if timeout > 0 {
+		time.AfterFunc(timeout, sm.closeDraining)
+	}
+	return sm.drained
+}
+
+// Draining reports whether StartDraining has been called.
+func (sm *SessionManager) Draining() bool {
+	sm.sessionManagerMu.RLock()
+	defer sm.sessionManagerMu.RUnlock()
+	return sm.draining
+}
+
+// Drained returns the channel StartDraining closes once no connections are
+// left, nil if the manager is not draining.
+func (sm *SessionManager) Drained() <-chan struct{} {
+	sm.sessionManagerMu.RLock()
+	defer sm.sessionManagerMu.RUnlock()
+	return sm.drained
+}
+
+// refuseDraining answers a dial while the manager drains. It reports
+// whether the dial was refused.
+func (sm *SessionManager) refuseDraining(w http.ResponseWriter) bool {
+	if !sm.Draining() {
+		return false
+	}
+	status := sm.drainStatus
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	if sm.drainHost != "" {
+		w.Header().Set(AlternateHostHeader, sm.drainHost)
+	}
+	plainText(w, status, ErrDraining.Error())
+	return true
+}
+
+// closeDraining closes the connections left once the drain timeout has
+// passed.
+func (sm *SessionManager) closeDraining() {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	code, reason := sm.closeFrame(CloseDrain, websocket.CloseGoingAway, "server draining")
+	for _, s := range sm.sessions {
+		for _, cl := range append([]*client(nil), s.clients...) {
+			sm.disconnectClientLocked(s, cl, code, reason)
+		}
+	}
+}
+
+// drainCheckLocked closes the drained channel once the last connection of
+// a draining manager has left. The caller must hold sessionManagerMu;
+// connections of different shards leave at once, so it counts them under
+// statsMu rather than across the sessions.
+func (sm *SessionManager) drainCheckLocked() {
+	if !sm.draining {
+		return
+	}
+	sm.statsMu.Lock()
+	defer sm.statsMu.Unlock()
+	if sm.openConnectionsLocked() > 0 {
+		return
+	}
+	select {
+	case <-sm.drained:
+	default:
+		sm.logger.Info("Drained all connections")
+		close(sm.drained)
+	}
+}
+
+// connectionCountLocked returns the number of connections in all
+// sessions. The caller must hold sessionManagerMu.
+func (sm *SessionManager) connectionCountLocked() int {
+	count := 0
+	for _, s := range sm.sessions {
+		count += len(s.clients)
+	}
+	return count
+}
@@ -0,0 +1,96 @@
+package ws_manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type DrainTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *DrainTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey},
+		WithDrainResponse(http.StatusGone, "ws2.example.com"),
+		WithCloseCode(CloseDrain, websocket.CloseServiceRestart, ""),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *DrainTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *DrainTestSuite) TestDrainRefusesDialsAndWaitsForConnections() {
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	assert.Nil(suite.T(), suite.manager.Drained())
+
+	drained := suite.manager.StartDraining(0)
+	assert.True(suite.T(), suite.manager.Draining())
+	_, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", nil)
+	assert.Error(suite.T(), err)
+	if assert.NotNil(suite.T(), resp) {
+		assert.Equal(suite.T(), http.StatusGone, resp.StatusCode)
+		assert.Equal(suite.T(), "ws2.example.com", resp.Header.Get(AlternateHostHeader))
+	}
+
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, SystemSender, websocket.TextMessage, []byte("still here")))
+	message, err := readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "still here", message)
+	select {
+	case <-drained:
+		suite.T().Fatal("drained with a connection left")
+	default:
+	}
+
+	conn.Close()
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		suite.T().Fatal("not drained")
+	}
+	assert.Equal(suite.T(), drained, suite.manager.Drained())
+}
+
+func (suite *DrainTestSuite) TestDrainTimeoutClosesConnections() {
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	drained := suite.manager.StartDraining(100 * time.Millisecond)
+	_, err = readWithTimeout(conn, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.CloseServiceRestart))
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		suite.T().Fatal("not drained")
+	}
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestDrainTestSuite(t *testing.T) {
+	suite.Run(t, new(DrainTestSuite))
+}
@@ -0,0 +1,144 @@
+package ws_manager
+
+import (
+	"errors"
+
+	"github.com/gorilla/websocket"
+)
+
+// DuplicatePolicy decides what happens when a connection joins a session
+// that already holds a connection of the same identity, e.g. a second tab
+// or a reconnect racing the old connection's close.
+type DuplicatePolicy int
+
+const (
+	// DuplicateAllow lets both connections stay.
+	DuplicateAllow DuplicatePolicy = iota
+	// DuplicateCloseOlder closes the connection already in the session
+	// with a policy violation and the reason "replaced by a new
+	// connection", or as set with WithCloseCode(CloseDuplicate, ...).
+	DuplicateCloseOlder
+	// DuplicateRejectNew refuses the new connection with HTTP 409, or
+	// closes it with a policy violation and the reason "already connected"
+	// if the other connection joined during the handshake.
+	DuplicateRejectNew
+)
+
+// ErrAlreadyConnected refuses a connection under DuplicateRejectNew.
+var ErrAlreadyConnected = errors.New("Already connected")
+
+// DuplicateEvent reports that a connection joined a session its identity
+// was already connected to.
+type DuplicateEvent struct {
+	SessionKey string
+	Identity   string
+	// ExistingID is the client ID of the connection already in the
+	// session, NewID that of the one joining
+	ExistingID string
+	NewID      string
+	// Policy is what was done about it
+	Policy DuplicatePolicy
+}
+
+// DuplicateFunc is called whenever WithDuplicatePolicy closes or refuses a
+// connection.
+type DuplicateFunc func(event DuplicateEvent)
+
+// WithDuplicatePolicy sets what happens when an identity connects to a
+// session twice. Identities come from WithAuth; connections without one
+// are never duplicates. The policy is enforced under the manager lock as
+// the connection joins, so two racing dials cannot both get in. With
+// WithClientIDs, a connection whose ID is held by another is a duplicate
+// too: DuplicateCloseOlder replaces the older one, and under the other
+// policies the dial is refused as WithClientIDs describes.
+func WithDuplicatePolicy(policy DuplicatePolicy) Option {
+	return func(sm *SessionManager) {
+		sm.duplicatePolicy = policy
+	}
+}
+
+// WithOnDuplicate calls onDuplicate whenever WithDuplicatePolicy closes or
+// refuses a connection. It runs under the manager lock and must not call
+// back into the manager. It may run concurrently for different sessions.
+func WithOnDuplicate(onDuplicate DuplicateFunc) Option {
+	return func(sm *SessionManager) {
+		sm.onDuplicate = onDuplicate
+	}
+}
+
+// duplicateOf returns the connection of s that a connection with clientID
+// and identity duplicates, or nil.
+func (sm *SessionManager) duplicateOf(s *session, clientID, identity string) *client {
+	if existing := s.client(clientID); existing != nil {
+		return existing
+	}
+	if identity == "" || sm.duplicatePolicy == DuplicateAllow {
+		return nil
+	}
+	for _, cl := range s.clients {
+		if cl.identity == identity {
+			return cl
+		}
+	}
+	return nil
+}
+
+// refuseDuplicate reports whether a dial into sessionKey as identity with
+// clientID is refused under DuplicateRejectNew, ahead of the upgrade.
+func (sm *SessionManager) refuseDuplicate(sessionKey, identity, clientID string) bool {
+	if sm.duplicatePolicy != DuplicateRejectNew || identity == "" {
+		return false
+	}
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return false
+	}
+	existing := sm.duplicateOf(s, clientID, identity)
+	if existing == nil {
+		return false
+	}
+	sm.reportDuplicateLocked(s, existing, clientID, identity)
+	return true
+}
+
+// resolveDuplicateLocked applies the duplicate policy to cl, which is
+// joining s: it closes the connection cl duplicates under
+// DuplicateCloseOlder, and otherwise returns ErrClientIDTaken or
+// ErrAlreadyConnected to refuse cl. The caller must hold sessionManagerMu.
+func (sm *SessionManager) resolveDuplicateLocked(s *session, cl *client) error {
+	existing := sm.duplicateOf(s, cl.id, cl.identity)
+	if existing == nil {
+		return nil
+	}
+	switch {
+	case sm.duplicatePolicy == DuplicateCloseOlder:
+		sm.reportDuplicateLocked(s, existing, cl.id, cl.identity)
+		sm.logger.Info("Replacing duplicate connection", "session", s.key, "client", existing.id, "identity", cl.identity)
+		code, reason := sm.closeFrame(CloseDuplicate, websocket.ClosePolicyViolation, "replaced by a new connection")
+		sm.disconnectClientLocked(s, existing, code, reason)
+		return nil
+	case sm.duplicatePolicy == DuplicateRejectNew:
+		sm.reportDuplicateLocked(s, existing, cl.id, cl.identity)
+	}
+	if existing.id == cl.id {
+		return ErrClientIDTaken
+	}
+	return ErrAlreadyConnected
+}
+
+// reportDuplicateLocked passes the duplicate to the WithOnDuplicate hook.
+// The caller must hold sessionManagerMu.
+func (sm *SessionManager) reportDuplicateLocked(s *session, existing *client, clientID, identity string) {
+	if sm.onDuplicate == nil {
+		return
+	}
+	sm.onDuplicate(DuplicateEvent{
+		SessionKey: s.key,
+		Identity:   identity,
+		ExistingID: existing.id,
+		NewID:      clientID,
+		Policy:     sm.duplicatePolicy,
+	})
+}
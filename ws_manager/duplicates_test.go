@@ -0,0 +1,105 @@
+package ws_manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type DuplicatesTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+	events     chan DuplicateEvent
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *DuplicatesTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+}
+
+func (suite *DuplicatesTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+func (suite *DuplicatesTestSuite) start(policy DuplicatePolicy) {
+	events := make(chan DuplicateEvent, 4)
+	suite.events = events
+	suite.manager = CreateSessionManager([]string{suite.sessionKey},
+		WithAuth(headerAuth),
+		WithDuplicatePolicy(policy),
+		WithOnDuplicate(func(event DuplicateEvent) {
+			events <- event
+		}),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *DuplicatesTestSuite) TestCloseOlder() {
+	suite.start(DuplicateCloseOlder)
+	older, resp, err := dialSessionAs(suite.server, suite.sessionKey, "alice")
+	assert.NoError(suite.T(), err)
+	defer older.Close()
+	olderID := resp.Header.Get(ClientIDHeader)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	newer, resp, err := dialSessionAs(suite.server, suite.sessionKey, "alice")
+	assert.NoError(suite.T(), err)
+	defer newer.Close()
+	newerID := resp.Header.Get(ClientIDHeader)
+
+	_, err = readWithTimeout(older, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.ClosePolicyViolation))
+	assert.Equal(suite.T(), DuplicateEvent{
+		SessionKey: suite.sessionKey,
+		Identity:   "alice",
+		ExistingID: olderID,
+		NewID:      newerID,
+		Policy:     DuplicateCloseOlder,
+	}, <-suite.events)
+	clients, err := suite.manager.GetClients(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	if assert.Len(suite.T(), clients, 1) {
+		assert.Equal(suite.T(), newerID, clients[0].ID)
+	}
+}
+
+func (suite *DuplicatesTestSuite) TestRejectNew() {
+	suite.start(DuplicateRejectNew)
+	alice, _, err := dialSessionAs(suite.server, suite.sessionKey, "alice")
+	assert.NoError(suite.T(), err)
+	defer alice.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	_, resp, err := dialSessionAs(suite.server, suite.sessionKey, "alice")
+	assert.Error(suite.T(), err)
+	if assert.NotNil(suite.T(), resp) {
+		assert.Equal(suite.T(), http.StatusConflict, resp.StatusCode)
+	}
+	event := <-suite.events
+	assert.Equal(suite.T(), "alice", event.Identity)
+	assert.Equal(suite.T(), DuplicateRejectNew, event.Policy)
+
+	bob, _, err := dialSessionAs(suite.server, suite.sessionKey, "bob")
+	assert.NoError(suite.T(), err)
+	defer bob.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestDuplicatesTestSuite(t *testing.T) {
+	suite.Run(t, new(DuplicatesTestSuite))
+}
@@ -0,0 +1,138 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WithEndToEndEncryption relays payloads as opaque ciphertext for
+// applications that encrypt end to end, and runs a key exchange so the
+// clients can find each other's public keys. A connection publishes its
+// key with the "publicKey" query parameter when it dials, or later with
+// the control message
+//
+//	{"control":"publicKey","key":"MCowBQYDK2VuAyEA..."}
+//
+// The manager never interprets keys. The other connections of the session
+// are told of each key that is published:
+//
+//	{"type":"system.publicKey","sender":"","sessionKey":"abcdefgh","timestamp":1700000000000,"payload":{"clientID":"7","key":"MCowBQYDK2VuAyEA..."}}
+//
+// and a connection joining is sent the keys of those already there:
+//
+//	{"type":"system.publicKeys","sender":"","sessionKey":"abcdefgh","timestamp":1700000000000,"payload":{"keys":{"3":"MCowBQYDK2VuAyEA...","4":"MCowBQYDK2VuAyEA..."}}}
+//
+// Features that read payloads are turned off: envelope validators,
+// including JSONSchema ones, are skipped. In protocol mode the envelope
+// fields around the payload, such as its type and TTL, are still read, so
+// handlers, history and per-type TTLs work as before; history replays the
+// ciphertext as it was relayed.
+func WithEndToEndEncryption() Option {
+	return func(sm *SessionManager) {
+		sm.endToEnd = true
+	}
+}
+
+// PublicKeys returns the public keys published in the session by
+// WithEndToEndEncryption, by client ID.
+func (sm *SessionManager) PublicKeys(sessionKey string) (map[string]string, error) {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return nil, sessionNotFound(sessionKey)
+	}
+	return s.publicKeys(nil), nil
+}
+
+type publicKeyNotice struct {
+	ClientID string `json:"clientID"`
+	Key      string `json:"key"`
+}
+
+type publicKeysNotice struct {
+	Keys map[string]string `json:"keys"`
+}
+
+// publicKeys returns the keys of the connections of s other than except.
+func (s *session) publicKeys(except *client) map[string]string {
+	keys := map[string]string{}
+	for _, cl := range s.clients {
+		if cl != except && cl.publicKey != "" {
+			keys[cl.id] = cl.publicKey
+		}
+	}
+	return keys
+}
+
+// exchangeKeysLocked runs the key exchange for cl, which just joined s: it
+// is sent the keys of the others, and its own key, if it dialed with one,
+// is announced to them. The caller must hold sessionManagerMu.
+func (sm *SessionManager) exchangeKeysLocked(s *session, cl *client) {
+	if !sm.endToEnd {
+		return
+	}
+	if keys := s.publicKeys(cl); len(keys) > 0 {
+		if frame := systemFrame(s.key, "system.publicKeys", publicKeysNotice{Keys: keys}); frame != nil {
+			if err := cl.write(websocket.TextMessage, frame); err != nil {
+				sm.logger.Warn("Public keys notice failed", "session", s.key, "client", cl.id, "err", err)
+			}
+		}
+	}
+	if cl.publicKey != "" {
+		sm.announceKeyLocked(s, cl)
+	}
+}
+
+// publishKeyLocked handles the publicKey control message from cl. It
+// reports whether msg was one. The caller must hold sessionManagerMu.
+func (sm *SessionManager) publishKeyLocked(sessionKey string, cl *client, msg controlMessage) bool {
+	if msg.Control != "publicKey" || !sm.endToEnd {
+		return false
+	}
+	s, ok := sm.sessions[sessionKey]
+	if !ok || msg.Key == "" {
+		return true
+	}
+	cl.publicKey = msg.Key
+	sm.announceKeyLocked(s, cl)
+	return true
+}
+
+// announceKeyLocked tells the other connections of s the key of cl. The
+// caller must hold sessionManagerMu.
+func (sm *SessionManager) announceKeyLocked(s *session, cl *client) {
+	frame := systemFrame(s.key, "system.publicKey", publicKeyNotice{ClientID: cl.id, Key: cl.publicKey})
+	if frame == nil {
+		return
+	}
+	for _, peer := range s.clients {
+		if peer == cl {
+			continue
+		}
+		if err := peer.write(websocket.TextMessage, frame); err != nil {
+			sm.logger.Warn("Public key notice failed", "session", s.key, "client", peer.id, "err", err)
+		}
+	}
+}
+
+// systemFrame returns a server-originated envelope of envelopeType with
+// payload, nil if it cannot be encoded.
+func systemFrame(sessionKey, envelopeType string, payload interface{}) []byte {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil
+	}
+	frame, err := json.Marshal(Envelope{
+		Type:       envelopeType,
+		SessionKey: sessionKey,
+		Timestamp:  time.Now().UnixNano() / int64(time.Millisecond),
+		Payload:    data,
+	})
+	if err != nil {
+		return nil
+	}
+	return frame
+}
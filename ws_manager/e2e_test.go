@@ -0,0 +1,95 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EndToEndTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *EndToEndTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey},
+		WithProtocolMode(true),
+		WithEndToEndEncryption(),
+		WithEnvelopeValidator("chat", func(env Envelope) error {
+			return errors.New("payload is unreadable")
+		}),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *EndToEndTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+// readEnvelope reads the next envelope from conn.
+func (suite *EndToEndTestSuite) readEnvelope(conn *websocket.Conn) Envelope {
+	message, err := readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	var env Envelope
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &env))
+	return env
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *EndToEndTestSuite) TestKeyExchange() {
+	alice, aliceID, err := dialSessionWithID(suite.server, suite.sessionKey, "publicKey=alicekey")
+	assert.NoError(suite.T(), err)
+	defer alice.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	bob, bobID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer bob.Close()
+	env := suite.readEnvelope(bob)
+	assert.Equal(suite.T(), "system.publicKeys", env.Type)
+	assert.JSONEq(suite.T(), `{"keys":{"`+aliceID+`":"alicekey"}}`, string(env.Payload))
+
+	bob.WriteJSON(controlMessage{Control: "publicKey", Key: "bobkey"})
+	env = suite.readEnvelope(alice)
+	assert.Equal(suite.T(), "system.publicKey", env.Type)
+	assert.JSONEq(suite.T(), `{"clientID":"`+bobID+`","key":"bobkey"}`, string(env.Payload))
+	keys, err := suite.manager.PublicKeys(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), map[string]string{aliceID: "alicekey", bobID: "bobkey"}, keys)
+}
+
+func (suite *EndToEndTestSuite) TestValidatorsAreSkipped() {
+	alice, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer alice.Close()
+	bob, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer bob.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	alice.WriteJSON(Envelope{Type: "chat", Payload: json.RawMessage(`"bm9uY2UuY2lwaGVydGV4dA=="`)})
+	env := suite.readEnvelope(bob)
+	assert.Equal(suite.T(), "chat", env.Type)
+	assert.Equal(suite.T(), `"bm9uY2UuY2lwaGVydGV4dA=="`, string(env.Payload))
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestEndToEndTestSuite(t *testing.T) {
+	suite.Run(t, new(EndToEndTestSuite))
+}
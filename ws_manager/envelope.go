@@ -0,0 +1,69 @@
+package ws_manager
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WithEnvelopeMode wraps every broadcast in a JSON text frame naming the
+// sender's client ID and the time it was relayed in Unix milliseconds:
+//
+//	{"from":"3","ts":1700000000000,"data":"hello"}
+//
+// Binary payloads are base64-encoded and flagged:
+//
+//	{"from":"3","ts":1700000000000,"data":"AAEC","binary":true}
+//
+// Server-originated broadcasts have an empty sender, or "system" when sent
+// as SystemSender, and broadcasts replayed from history are flagged with
+// "replayed":true.
+func WithEnvelopeMode(enabled bool) Option {
+	return func(sm *SessionManager) {
+		sm.envelopeMode = enabled
+	}
+}
+
+type envelope struct {
+	From     string `json:"from"`
+	TS       int64  `json:"ts"`
+	Data     string `json:"data"`
+	Binary   bool   `json:"binary,omitempty"`
+	Replayed bool   `json:"replayed,omitempty"`
+	Seq      uint64 `json:"seq,omitempty"`
+}
+
+// wrapEnvelope returns the frame type and payload to deliver for a broadcast
+// of message from senderID, wrapping it if envelope mode is on and stamping
+// it with seq if that is not zero.
+func (sm *SessionManager) wrapEnvelope(senderID string, messageType int, message []byte, now time.Time, seq uint64) (int, []byte) {
+	if sm.protocolMode && seq > 0 {
+		return messageType, setEnvelopeFields(messageType, message, map[string]interface{}{"seq": seq})
+	}
+	return sm.envelopeFrame(senderID, messageType, message, now, false, seq)
+}
+
+// envelopeFrame is wrapEnvelope with the replayed flag set as given.
+func (sm *SessionManager) envelopeFrame(senderID string, messageType int, message []byte, now time.Time, replayed bool, seq uint64) (int, []byte) {
+	if !sm.envelopeMode || sm.protocolMode {
+		return messageType, message
+	}
+	env := envelope{
+		From:     senderID,
+		TS:       now.UnixNano() / int64(time.Millisecond),
+		Data:     string(message),
+		Replayed: replayed,
+		Seq:      seq,
+	}
+	if messageType == websocket.BinaryMessage {
+		env.Data = base64.StdEncoding.EncodeToString(message)
+		env.Binary = true
+	}
+	wrapped, err := json.Marshal(env)
+	if err != nil {
+		return messageType, message
+	}
+	return websocket.TextMessage, wrapped
+}
@@ -0,0 +1,91 @@
+package ws_manager
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors of the manager's methods. Most come wrapped in a *SessionError or
+// *ClientError naming the session and connection involved, so callers
+// branch with errors.Is and read the context with errors.As:
+//
+//	var ce *ws_manager.ClientError
+//	if errors.Is(err, ws_manager.ErrClientNotFound) && errors.As(err, &ce) {
+//		log.Printf("%s left %s", ce.ClientID, ce.SessionKey)
+//	}
+//
+// The errors refusing a connection, such as ErrClientLimitReached and
+// ErrSessionLocked, are declared next to the options that cause them.
+var (
+	// ErrSessionNotFound reports a session key the manager does not hold.
+	ErrSessionNotFound = errors.New("Session not found")
+	// ErrSessionExists reports a session key that is already registered.
+	ErrSessionExists = errors.New("Session already exists")
+	// ErrClientNotFound reports a client ID that is not connected to the
+	// session.
+	ErrClientNotFound = errors.New("Client not found")
+	// ErrBanned reports an identity banned from the session, see BanIdentity.
+	ErrBanned = errors.New("Banned")
+)
+
+// SessionError is an error about the session SessionKey.
+type SessionError struct {
+	SessionKey string
+	Err        error
+}
+
+func (e *SessionError) Error() string {
+	switch e.Err {
+	case ErrSessionNotFound:
+		return fmt.Sprintf("Session %s not found", e.SessionKey)
+	case ErrSessionExists:
+		return fmt.Sprintf("Session %s already exists", e.SessionKey)
+	}
+	return fmt.Sprintf("Session %s: %s", e.SessionKey, e.Err)
+}
+
+// Unwrap returns Err, so errors.Is(err, ErrSessionNotFound) holds.
+func (e *SessionError) Unwrap() error {
+	return e.Err
+}
+
+// ClientError is an error about the connection ClientID of the session
+// SessionKey.
+type ClientError struct {
+	SessionKey string
+	ClientID   string
+	// Identity is set when the error is about the identity of the
+	// connection, as for ErrBanned
+	Identity string
+	// Op is what failed, "write" for a broadcast that could not be written
+	// to the connection, empty if Err says it all
+	Op  string
+	Err error
+}
+
+func (e *ClientError) Error() string {
+	switch {
+	case e.Op == "write":
+		return fmt.Sprintf("Write to %s failed: %s", e.ClientID, e.Err)
+	case e.Err == ErrClientNotFound:
+		return fmt.Sprintf("Client %s not found in session %s", e.ClientID, e.SessionKey)
+	case e.Err == ErrBanned:
+		return fmt.Sprintf("Identity %s is banned from session %s", e.Identity, e.SessionKey)
+	}
+	return fmt.Sprintf("Client %s in session %s: %s", e.ClientID, e.SessionKey, e.Err)
+}
+
+// Unwrap returns Err, so errors.Is(err, ErrClientNotFound) holds.
+func (e *ClientError) Unwrap() error {
+	return e.Err
+}
+
+// sessionNotFound returns the error for the unknown session sessionKey.
+func sessionNotFound(sessionKey string) error {
+	return &SessionError{SessionKey: sessionKey, Err: ErrSessionNotFound}
+}
+
+// clientNotFound returns the error for clientID missing from sessionKey.
+func clientNotFound(sessionKey, clientID string) error {
+	return &ClientError{SessionKey: sessionKey, ClientID: clientID, Err: ErrClientNotFound}
+}
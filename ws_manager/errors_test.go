@@ -0,0 +1,76 @@
+package ws_manager
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ErrorsTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *ErrorsTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithLogger(NopLogger()))
+}
+
+func (suite *ErrorsTestSuite) TearDownTest() {
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *ErrorsTestSuite) TestSessionNotFound() {
+	_, err := suite.manager.GetSession("missing")
+	assert.True(suite.T(), errors.Is(err, ErrSessionNotFound))
+	var se *SessionError
+	assert.True(suite.T(), errors.As(err, &se))
+	assert.Equal(suite.T(), "missing", se.SessionKey)
+	assert.EqualError(suite.T(), err, "Session missing not found")
+}
+
+func (suite *ErrorsTestSuite) TestSessionExists() {
+	err := suite.manager.RegisterSession(suite.sessionKey)
+	assert.True(suite.T(), errors.Is(err, ErrSessionExists))
+	assert.EqualError(suite.T(), err, "Session abcdefgh already exists")
+}
+
+func (suite *ErrorsTestSuite) TestClientNotFound() {
+	err := suite.manager.SendTo(suite.sessionKey, "404", []byte("hello"))
+	assert.True(suite.T(), errors.Is(err, ErrClientNotFound))
+	var ce *ClientError
+	assert.True(suite.T(), errors.As(err, &ce))
+	assert.Equal(suite.T(), suite.sessionKey, ce.SessionKey)
+	assert.Equal(suite.T(), "404", ce.ClientID)
+}
+
+func (suite *ErrorsTestSuite) TestRefusalCarriesContext() {
+	suite.manager.sessionManagerMu.Lock()
+	suite.manager.sessions[suite.sessionKey].locked = true
+	suite.manager.sessionManagerMu.Unlock()
+	err := suite.manager.addClient(suite.sessionKey, &client{id: "7"})
+	assert.True(suite.T(), errors.Is(err, ErrSessionLocked))
+	var ce *ClientError
+	assert.True(suite.T(), errors.As(err, &ce))
+	assert.Equal(suite.T(), "7", ce.ClientID)
+	assert.EqualError(suite.T(), err, "Client 7 in session abcdefgh: Session is locked")
+}
+
+func (suite *ErrorsTestSuite) TestWriteFailure() {
+	err := &ClientError{SessionKey: suite.sessionKey, ClientID: "7", Op: "write", Err: ErrCloseConnection}
+	assert.EqualError(suite.T(), err, "Write to 7 failed: Close connection")
+	assert.True(suite.T(), errors.Is(err, ErrCloseConnection))
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestErrorsTestSuite(t *testing.T) {
+	suite.Run(t, new(ErrorsTestSuite))
+}
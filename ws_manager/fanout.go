@@ -0,0 +1,96 @@
+package ws_manager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WithParallelBroadcast encodes each broadcast once as a prepared message
+// and writes it to the recipients from up to workers goroutines, so one
+// slow connection no longer holds up the rest of a large session. The
+// broadcast still returns only once every write has finished. A value
+// below 2 writes serially, which is the default.
+func WithParallelBroadcast(workers int) Option {
+	return func(sm *SessionManager) {
+		sm.broadcastWorkers = workers
+	}
+}
+
+// fanOutLocked is deliverLocked for WithParallelBroadcast. Workers only
+// write; the bookkeeping happens here once they are done. The caller must
+// hold sessionManagerMu.
+func (sm *SessionManager) fanOutLocked(s *session, recipients []*client, messageType int, message []byte) (int, []*client, []error) {
+	prepared, err := websocket.NewPreparedMessage(messageType, message)
+	if err != nil {
+		sm.logger.Warn("Preparing broadcast failed", "session", s.key, "err", err)
+		return 0, recipients, repeatError(err, len(recipients))
+	}
+	workers := sm.broadcastWorkers
+	if workers > len(recipients) {
+		workers = len(recipients)
+	}
+	writeErrs := make([]error, len(recipients))
+	skipped := make([]bool, len(recipients))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				writeErrs[i] = recipients[i].writePrepared(messageType, message, prepared)
+			}
+		}()
+	}
+	for i, cl := range recipients {
+		if sm.oversizedLocked(s, cl, message) {
+			skipped[i] = true
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	delivered := 0
+	failed := []*client{}
+	errs := []error{}
+	for i, cl := range recipients {
+		if skipped[i] {
+			continue
+		}
+		if _, err := sm.wroteLocked(s, cl, message, writeErrs[i]); err != nil {
+			failed = append(failed, cl)
+			errs = append(errs, err)
+			continue
+		}
+		delivered++
+	}
+	return delivered, failed, errs
+}
+
+// writePrepared is write for a frame already encoded as prepared. Queued
+// and coalescing connections still take the raw payload, and connections
+// with a codec encode their own frame.
+func (cl *client) writePrepared(messageType int, data []byte, prepared *websocket.PreparedMessage) error {
+	if cl.queue != nil || cl.codec != nil || cl.coalesce != nil {
+		return cl.write(messageType, data)
+	}
+	cl.writeMu.Lock()
+	defer cl.writeMu.Unlock()
+	if cl.writeTimeout > 0 {
+		cl.conn.SetWriteDeadline(time.Now().Add(cl.writeTimeout))
+	}
+	cl.setWriteCompression(len(data))
+	return cl.conn.WritePreparedMessage(prepared)
+}
+
+func repeatError(err error, n int) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,89 @@
+package ws_manager
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type FanOutTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *FanOutTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithParallelBroadcast(4), WithLogger(NopLogger()))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *FanOutTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *FanOutTestSuite) TestEveryRecipientGetsTheFrame() {
+	conns := []*websocket.Conn{}
+	for i := 0; i < 20; i++ {
+		conn, err := dialSession(suite.server, suite.sessionKey, "")
+		assert.NoError(suite.T(), err)
+		conns = append(conns, conn)
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 20))
+
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("to all")))
+	for _, conn := range conns {
+		message, err := readWithTimeout(conn, time.Second)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "to all", message)
+	}
+	assert.Equal(suite.T(), uint64(20*len("to all")), suite.manager.Metrics().BytesRelayed)
+}
+
+func (suite *FanOutTestSuite) TestFailedWritesAreAggregated() {
+	healthy, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	_, brokenID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	other, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 3))
+
+	suite.manager.sessionManagerMu.Lock()
+	tcp := suite.manager.sessions[suite.sessionKey].clients[1].conn.UnderlyingConn().(*net.TCPConn)
+	suite.manager.sessionManagerMu.Unlock()
+	assert.NoError(suite.T(), tcp.CloseWrite())
+
+	err = suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("hello"))
+	if assert.IsType(suite.T(), &BroadcastError{}, err) {
+		failures := err.(*BroadcastError).Failures
+		assert.Len(suite.T(), failures, 1)
+		assert.Contains(suite.T(), failures, brokenID)
+	}
+	for _, conn := range []*websocket.Conn{healthy, other} {
+		message, err := readWithTimeout(conn, time.Second)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "hello", message)
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestFanOutTestSuite(t *testing.T) {
+	suite.Run(t, new(FanOutTestSuite))
+}
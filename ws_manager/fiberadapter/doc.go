@@ -0,0 +1,6 @@
+// Package fiberadapter serves ws_manager sessions from fiber routes. It is
+// a module of its own, so the ws_manager module does not require fiber of
+// applications that do not use it:
+//
+//	go get github.com/chau-t-tran/ws-to-me/ws_manager/fiberadapter
+package fiberadapter
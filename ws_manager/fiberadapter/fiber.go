@@ -0,0 +1,107 @@
+package fiberadapter
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/chau-t-tran/ws-to-me/ws_manager"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// FiberHandler is ws_manager's EchoHandler for fiber. The session key is
+// the "sessionKey" route parameter:
+//
+//	app.Get("/:sessionKey", fiberadapter.FiberHandler(sm))
+//
+// fasthttp has no net/http request to upgrade, so the handler hijacks the
+// connection and serves it as one; refused handshakes are answered on the
+// raw connection and close it.
+func FiberHandler(sm *ws_manager.SessionManager) fiber.Handler {
+	return FiberHandlerForParam(sm, "sessionKey")
+}
+
+// FiberHandlerForParam is FiberHandler with the session key taken from the
+// route parameter named param.
+func FiberHandlerForParam(sm *ws_manager.SessionManager, param string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// fasthttp reuses the context once the handler returns, so
+		// everything the connection needs is copied out first.
+		sessionKey := c.Params(param)
+		r, err := newRequest(c.Context())
+		if err != nil {
+			return err
+		}
+		c.Context().HijackSetNoResponse(true)
+		c.Context().Hijack(func(conn net.Conn) {
+			sm.ServeWS(newHijackWriter(conn), r, sessionKey)
+		})
+		return nil
+	}
+}
+
+// newRequest copies the fasthttp request into a net/http one.
+func newRequest(ctx *fasthttp.RequestCtx) (*http.Request, error) {
+	uri := string(ctx.RequestURI())
+	r, err := http.NewRequest(string(ctx.Method()), uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.RequestURI = uri
+	r.Host = string(ctx.Host())
+	r.RemoteAddr = ctx.RemoteAddr().String()
+	ctx.Request.Header.VisitAll(func(key, value []byte) {
+		r.Header.Add(string(key), string(value))
+	})
+	return r, nil
+}
+
+// hijackWriter is the http.ResponseWriter of a hijacked fasthttp
+// connection. The websocket upgrade takes the connection over with Hijack;
+// anything else is written out as a plain HTTP/1.1 response that ends with
+// the connection.
+type hijackWriter struct {
+	conn        net.Conn
+	rw          *bufio.ReadWriter
+	header      http.Header
+	wroteHeader bool
+}
+
+func newHijackWriter(conn net.Conn) *hijackWriter {
+	return &hijackWriter{
+		conn:   conn,
+		rw:     bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
+		header: http.Header{},
+	}
+}
+
+func (w *hijackWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *hijackWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.header.Set("Connection", "close")
+	fmt.Fprintf(w.rw, "HTTP/1.1 %d %s\r\n", code, http.StatusText(code))
+	w.header.Write(w.rw)
+	w.rw.WriteString("\r\n")
+	w.rw.Flush()
+}
+
+func (w *hijackWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	n, err := w.rw.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, w.rw.Flush()
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, w.rw, nil
+}
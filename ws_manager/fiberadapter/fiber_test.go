@@ -0,0 +1,75 @@
+package fiberadapter
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/chau-t-tran/ws-to-me/ws_manager"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type FiberTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *ws_manager.SessionManager
+	app        *fiber.App
+	url        string
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *FiberTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = ws_manager.CreateSessionManager([]string{suite.sessionKey})
+	suite.app = fiber.New(fiber.Config{DisableStartupMessage: true})
+	suite.app.Get("/:sessionKey", FiberHandler(suite.manager))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	go suite.app.Listener(ln)
+	suite.url = "ws://" + ln.Addr().String()
+}
+
+func (suite *FiberTestSuite) TearDownTest() {
+	suite.app.Shutdown()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *FiberTestSuite) TestRelaysBetweenConnections() {
+	sender, _, err := websocket.DefaultDialer.Dial(suite.url+"/"+suite.sessionKey, nil)
+	assert.NoError(suite.T(), err)
+	defer sender.Close()
+	receiver, _, err := websocket.DefaultDialer.Dial(suite.url+"/"+suite.sessionKey, nil)
+	assert.NoError(suite.T(), err)
+	defer receiver.Close()
+	assert.Eventually(suite.T(), func() bool {
+		n, _ := suite.manager.ActiveConnections(suite.sessionKey)
+		return n == 2
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte("hello")))
+	receiver.SetReadDeadline(time.Now().Add(time.Second))
+	_, message, err := receiver.ReadMessage()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "hello", string(message))
+}
+
+func (suite *FiberTestSuite) TestUnknownSessionIsRefused() {
+	_, resp, err := websocket.DefaultDialer.Dial(suite.url+"/missing", nil)
+	assert.Error(suite.T(), err)
+	if assert.NotNil(suite.T(), resp) {
+		assert.Equal(suite.T(), 404, resp.StatusCode)
+	}
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestFiberTestSuite(t *testing.T) {
+	suite.Run(t, new(FiberTestSuite))
+}
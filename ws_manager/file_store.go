@@ -0,0 +1,86 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileSessionStore is a SessionStore keeping one JSON file per session in
+// a directory. Files are replaced atomically, so a crash mid-save leaves
+// the previous version.
+type FileSessionStore struct {
+	dir string
+}
+
+// NewFileSessionStore returns a store in dir, which is created if needed.
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{dir: dir}, nil
+}
+
+// SaveSession implements SessionStore.
+func (f *FileSessionStore) SaveSession(session StoredSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(f.dir, ".session-*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(session.Key))
+}
+
+// DeleteSession implements SessionStore. Deleting a session that is not
+// stored is not an error.
+func (f *FileSessionStore) DeleteSession(sessionKey string) error {
+	err := os.Remove(f.path(sessionKey))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// LoadSessions implements SessionStore.
+func (f *FileSessionStore) LoadSessions() ([]StoredSession, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+	sessions := []StoredSession{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(f.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var session StoredSession
+		if err := json.Unmarshal(data, &session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// path escapes sessionKey so any key maps to a single file name.
+func (f *FileSessionStore) path(sessionKey string) string {
+	return filepath.Join(f.dir, url.PathEscape(sessionKey)+".json")
+}
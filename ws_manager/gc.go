@@ -0,0 +1,205 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// EvictFunc is called when a session is reaped for being idle, with the IDs
+// of the connections it still had.
+type EvictFunc func(sessionKey string, clientIDs []string)
+
+// WithGC starts a collector, as StartGC does, when the manager is created.
+// It is stopped by StopGC or Shutdown.
+func WithGC(interval time.Duration, ttl time.Duration) Option {
+	return func(sm *SessionManager) {
+		sm.gcInterval = interval
+		sm.gcTTL = ttl
+	}
+}
+
+// WithOnEvict calls onEvict for every session removed by a collector. It
+// runs under the manager lock and must not call back into the manager.
+func WithOnEvict(onEvict EvictFunc) Option {
+	return func(sm *SessionManager) {
+		sm.onEvict = onEvict
+	}
+}
+
+// WithExpiryWarning has collectors warn the connections of an idle session
+// once it is within warning of its ttl, with an envelope saying when it
+// will be removed:
+//
+//	{"type":"system.expiring","sender":"","sessionKey":"abcdefgh","timestamp":1700000000000,"payload":{"expiresInMs":30000}}
+//
+// The warning is sent by the first collection that finds the session that
+// close to expiry, so it comes at most one collector interval late. With
+// extendOnReply, a message from any connection after the warning uses the
+// session and restarts its ttl, as it does before; without it the warning is
+// final and the session is removed when it said, whatever its traffic. A
+// warning of zero or less disables it.
+func WithExpiryWarning(warning time.Duration, extendOnReply bool) Option {
+	return func(sm *SessionManager) {
+		sm.expiryWarning = warning
+		sm.expiryExtend = extendOnReply
+	}
+}
+
+type expiryWarning struct {
+	ExpiresInMs int64 `json:"expiresInMs"`
+}
+
+// StopGC stops the collector started by WithGC. It is a no-op without one
+// and may be called repeatedly.
+func (sm *SessionManager) StopGC() {
+	if sm.stopGC != nil {
+		sm.stopGC()
+		sm.sessionManagerMu.Lock()
+		sm.gcStopped = true
+		sm.sessionManagerMu.Unlock()
+	}
+}
+
+// StartGC runs a collector that, every interval, removes the sessions that
+// have not been used for longer than ttl and closes their connections. A
+// session is used whenever a connection joins it or sends a message, so an
+// empty session survives until ttl has passed since its last use. The
+// returned stop function halts the collector and may be called repeatedly;
+// Shutdown halts it too.
+func (sm *SessionManager) StartGC(interval time.Duration, ttl time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				sm.collectStale(ttl)
+			case <-done:
+				return
+			case <-sm.done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
+
+// CollectGarbage runs one collection now, removing the sessions that have
+// not been used for longer than ttl, and returns how many it removed.
+func (sm *SessionManager) CollectGarbage(ttl time.Duration) int {
+	return sm.collectStale(ttl)
+}
+
+func (sm *SessionManager) collectStale(ttl time.Duration) int {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	now := time.Now()
+	sm.gcLastRun = now
+	evicted := 0
+	for _, s := range sm.sessions {
+		if sm.dueLocked(s, ttl, now) {
+			sm.expireLocked(s)
+			evicted++
+		}
+	}
+	sm.logger.Debug("Collected idle sessions", "evicted", evicted, "sessions", len(sm.sessions))
+	return evicted
+}
+
+// dueLocked reports whether s has outlived ttl, or its SessionConfig
+// IdleTTL, warning its connections first under WithExpiryWarning. The caller must hold sessionManagerMu.
+func (sm *SessionManager) dueLocked(s *session, ttl time.Duration, now time.Time) bool {
+	ttl = idleTTLLocked(s, ttl)
+	if ttl < 0 {
+		return false
+	}
+	if !s.expiresAt.IsZero() {
+		if !sm.expiryExtend || s.lastUsed.Equal(s.warnedFor) {
+			return !now.Before(s.expiresAt)
+		}
+		// used since the warning
+		s.expiresAt = time.Time{}
+	}
+	idle := now.Sub(s.lastUsed)
+	if idle > ttl {
+		return true
+	}
+	if sm.expiryWarning > 0 && idle > ttl-sm.expiryWarning {
+		s.expiresAt = s.lastUsed.Add(ttl)
+		s.warnedFor = s.lastUsed
+		sm.warnExpiryLocked(s, s.expiresAt.Sub(now))
+	}
+	return false
+}
+
+// warnExpiryLocked tells the connections of s it is removed in expiresIn.
+// The warning does not use the session. The caller must hold
+// sessionManagerMu.
+func (sm *SessionManager) warnExpiryLocked(s *session, expiresIn time.Duration) {
+	sm.logger.Info("Warning idle session", "session", s.key, "connections", len(s.clients), "expiresIn", expiresIn)
+	payload, err := json.Marshal(expiryWarning{ExpiresInMs: expiresIn.Milliseconds()})
+	if err != nil {
+		return
+	}
+	frame, err := json.Marshal(Envelope{
+		Type:       "system.expiring",
+		SessionKey: s.key,
+		Timestamp:  time.Now().UnixNano() / int64(time.Millisecond),
+		Payload:    payload,
+	})
+	if err != nil {
+		return
+	}
+	for _, cl := range s.clients {
+		if err := cl.write(websocket.TextMessage, frame); err != nil {
+			sm.logger.Warn("Expiry warning failed", "session", s.key, "client", cl.id, "err", err)
+		}
+	}
+}
+
+// expireLocked evicts an idle session. The caller must hold
+// sessionManagerMu.
+func (sm *SessionManager) expireLocked(s *session) {
+	sm.logger.Info("Evicting idle session", "session", s.key, "connections", len(s.clients))
+	code, reason := sm.closeFrame(CloseExpire, websocket.CloseNormalClosure, "session expired")
+	sm.evictLocked(s, code, reason)
+}
+
+// evictLocked removes a session that expired or, with LimitEvictLRU, had to
+// make room, closing its connections with code and reason. The caller must
+// hold sessionManagerMu.
+func (sm *SessionManager) evictLocked(s *session, code int, reason string) {
+	clientIDs := make([]string, len(s.clients))
+	for i, cl := range s.clients {
+		clientIDs[i] = cl.id
+	}
+	sm.removeSessionLocked(s, code, reason)
+	sm.markStoredLocked(s.key, true)
+	sm.statsMu.Lock()
+	sm.metrics.Evictions++
+	sm.evictionRate.observe(time.Now(), sm.rateWindow)
+	sm.statsMu.Unlock()
+	sm.webhookLocked(WebhookSessionEvicted, s)
+	if sm.onEvict != nil {
+		sm.onEvict(s.key, clientIDs)
+	}
+}
+
+// touch marks the session as used now.
+func (sm *SessionManager) touch(sessionKey string) {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	if s, ok := sm.sessions[sessionKey]; ok {
+		s.lastUsed = time.Now()
+	}
+}
@@ -2,11 +2,13 @@ package ws_manager
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"testing"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -14,7 +16,7 @@ import (
 
 type GCTestSuite struct {
 	suite.Suite
-	manager    SessionManager
+	manager    *SessionManager
 	sessionKey string
 	timeFormat string
 
@@ -29,10 +31,12 @@ func (suite *GCTestSuite) SetupSuite() {
 	suite.timeFormat = "02 Jan 06 15:04:05 MST"
 	suite.sessionKey = "abcdefgh"
 
-	suite.wsUrl = fmt.Sprintf("ws://localhost:%d/%s", suite.port, suite.sessionKey)
 	suite.port = 4000
+	suite.wsUrl = fmt.Sprintf("ws://localhost:%d/%s", suite.port, suite.sessionKey)
 	suite.e = echo.New()
-	suite.e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.e.GET("/:sessionKey", func(c echo.Context) error {
+		return suite.manager.EchoHandler(c)
+	})
 	go func() {
 		suite.e.Start(fmt.Sprintf(":%d", suite.port))
 	}()
@@ -79,7 +83,7 @@ func (suite *GCTestSuite) TestLastUsedUpdatesOnBroadcast() {
 
 	time.Sleep(3 * time.Second)
 
-	suite.manager.Broadcast(suite.sessionKey, "", []byte{})
+	suite.manager.Broadcast(suite.sessionKey, "", websocket.TextMessage, []byte{})
 	currentTimeString := time.Now().Format(suite.timeFormat)
 
 	lastUsedTime, err := suite.manager.GetLastUsedTime(suite.sessionKey)
@@ -116,13 +120,149 @@ func (suite *GCTestSuite) TestSessionGetsDeletedAfterOneDay() {
 	assert.Error(suite.T(), err, expectedSessionErrorMessage)
 
 	_, err = suite.manager.GetLastUsedTime(suite.sessionKey)
-	expectedTimeErrorMessage := fmt.Sprintf("Session %s last used time not found", suite.sessionKey)
+	expectedTimeErrorMessage := fmt.Sprintf("Session %s not found", suite.sessionKey)
 	assert.Error(suite.T(), err, expectedTimeErrorMessage)
 
 	// clean-up
 	// suite.manager.cronScheduler.Stop()
 }
 
+func (suite *GCTestSuite) TestStartGCRemovesStaleSessions() {
+	suite.manager.RegisterSession(suite.sessionKey)
+	conn, _, err := websocket.DefaultDialer.Dial(suite.wsUrl, nil)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	stop := suite.manager.StartGC(50*time.Millisecond, 300*time.Millisecond)
+	defer stop()
+
+	_, err = readWithTimeout(conn, 2*time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.CloseNormalClosure))
+	_, err = suite.manager.GetSession(suite.sessionKey)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), uint64(1), suite.manager.Metrics().Evictions)
+}
+
+func (suite *GCTestSuite) TestStartGCKeepsActiveSessions() {
+	suite.manager.RegisterSession(suite.sessionKey)
+	conn, _, err := websocket.DefaultDialer.Dial(suite.wsUrl, nil)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	stop := suite.manager.StartGC(50*time.Millisecond, 300*time.Millisecond)
+	defer stop()
+
+	// inbound messages keep the session alive past the ttl
+	for i := 0; i < 10; i++ {
+		assert.NoError(suite.T(), conn.WriteMessage(websocket.TextMessage, []byte("ping")))
+		time.Sleep(100 * time.Millisecond)
+	}
+	_, err = suite.manager.GetSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *GCTestSuite) TestStartGCKeepsRecentlyUsedEmptySessions() {
+	stop := suite.manager.StartGC(50*time.Millisecond, time.Second)
+	suite.manager.RegisterSession(suite.sessionKey)
+
+	time.Sleep(300 * time.Millisecond)
+	_, err := suite.manager.GetSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+
+	time.Sleep(time.Second)
+	_, err = suite.manager.GetSession(suite.sessionKey)
+	assert.Error(suite.T(), err)
+
+	stop()
+	stop()
+}
+
+func (suite *GCTestSuite) TestWithGCReportsEvictions() {
+	suite.manager.cronScheduler.Stop()
+	evicted := make(chan []string, 1)
+	suite.manager = CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithGC(50*time.Millisecond, 300*time.Millisecond),
+		WithOnEvict(func(sessionKey string, clientIDs []string) {
+			assert.Equal(suite.T(), suite.sessionKey, sessionKey)
+			evicted <- clientIDs
+		}),
+	)
+	defer suite.manager.StopGC()
+	conn, resp, err := websocket.DefaultDialer.Dial(suite.wsUrl, nil)
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+
+	select {
+	case clientIDs := <-evicted:
+		assert.Equal(suite.T(), []string{resp.Header.Get(ClientIDHeader)}, clientIDs)
+	case <-time.After(2 * time.Second):
+		suite.T().Fatal("session was not evicted")
+	}
+	_, err = suite.manager.GetSession(suite.sessionKey)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *GCTestSuite) TestStopGC() {
+	suite.manager.StopGC()
+	suite.manager.cronScheduler.Stop()
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithGC(50*time.Millisecond, 100*time.Millisecond))
+	suite.manager.StopGC()
+	suite.manager.StopGC()
+
+	time.Sleep(300 * time.Millisecond)
+	_, err := suite.manager.GetSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *GCTestSuite) TestExpiryWarningReplyKeepsSession() {
+	suite.manager.cronScheduler.Stop()
+	suite.manager = CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithGC(50*time.Millisecond, 400*time.Millisecond),
+		WithExpiryWarning(300*time.Millisecond, true),
+	)
+	defer suite.manager.StopGC()
+	conn, _, err := websocket.DefaultDialer.Dial(suite.wsUrl, nil)
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+
+	message, err := readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	var env Envelope
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &env))
+	assert.Equal(suite.T(), "system.expiring", env.Type)
+	var warning expiryWarning
+	assert.NoError(suite.T(), json.Unmarshal(env.Payload, &warning))
+	assert.True(suite.T(), warning.ExpiresInMs > 0 && warning.ExpiresInMs <= 300)
+
+	assert.NoError(suite.T(), conn.WriteMessage(websocket.TextMessage, []byte("still here")))
+	time.Sleep(350 * time.Millisecond)
+	_, err = suite.manager.GetSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *GCTestSuite) TestFinalExpiryWarning() {
+	suite.manager.cronScheduler.Stop()
+	suite.manager = CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithGC(50*time.Millisecond, 400*time.Millisecond),
+		WithExpiryWarning(300*time.Millisecond, false),
+	)
+	defer suite.manager.StopGC()
+	conn, _, err := websocket.DefaultDialer.Dial(suite.wsUrl, nil)
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+
+	_, err = readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), conn.WriteMessage(websocket.TextMessage, []byte("still here")))
+	_, err = readWithTimeout(conn, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.CloseNormalClosure))
+	_, err = suite.manager.GetSession(suite.sessionKey)
+	assert.Error(suite.T(), err)
+}
+
 /*-------------------Test Runner------------------------*/
 
 func TestGCTestSuite(t *testing.T) {
@@ -0,0 +1,6 @@
+// Package ginadapter serves ws_manager sessions from gin routes. It is a
+// module of its own, so the ws_manager module does not require gin of
+// applications that do not use it:
+//
+//	go get github.com/chau-t-tran/ws-to-me/ws_manager/ginadapter
+package ginadapter
@@ -0,0 +1,24 @@
+package ginadapter
+
+import (
+	"github.com/chau-t-tran/ws-to-me/ws_manager"
+	"github.com/gin-gonic/gin"
+)
+
+// GinHandler is ws_manager's EchoHandler for gin. The session key is the
+// "sessionKey" route parameter:
+//
+//	r.GET("/:sessionKey", ginadapter.GinHandler(sm))
+func GinHandler(sm *ws_manager.SessionManager) gin.HandlerFunc {
+	return GinHandlerForParam(sm, "sessionKey")
+}
+
+// GinHandlerForParam is GinHandler with the session key taken from the
+// route parameter named param.
+func GinHandlerForParam(sm *ws_manager.SessionManager, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := sm.ServeWS(c.Writer, c.Request, c.Param(param)); err != nil {
+			c.Error(err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package ginadapter
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chau-t-tran/ws-to-me/ws_manager"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type GinTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *ws_manager.SessionManager
+	server     *httptest.Server
+	url        string
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *GinTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = ws_manager.CreateSessionManager([]string{suite.sessionKey})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/:sessionKey", GinHandler(suite.manager))
+	suite.server = httptest.NewServer(r)
+	suite.url = "ws" + strings.TrimPrefix(suite.server.URL, "http")
+}
+
+func (suite *GinTestSuite) TearDownTest() {
+	suite.server.Close()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *GinTestSuite) TestRelaysBetweenConnections() {
+	sender, _, err := websocket.DefaultDialer.Dial(suite.url+"/"+suite.sessionKey, nil)
+	assert.NoError(suite.T(), err)
+	defer sender.Close()
+	receiver, _, err := websocket.DefaultDialer.Dial(suite.url+"/"+suite.sessionKey, nil)
+	assert.NoError(suite.T(), err)
+	defer receiver.Close()
+	assert.Eventually(suite.T(), func() bool {
+		n, _ := suite.manager.ActiveConnections(suite.sessionKey)
+		return n == 2
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte("hello")))
+	receiver.SetReadDeadline(time.Now().Add(time.Second))
+	_, message, err := receiver.ReadMessage()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "hello", string(message))
+}
+
+func (suite *GinTestSuite) TestUnknownSessionIsRefused() {
+	_, resp, err := websocket.DefaultDialer.Dial(suite.url+"/missing", nil)
+	assert.Error(suite.T(), err)
+	if assert.NotNil(suite.T(), resp) {
+		assert.Equal(suite.T(), 404, resp.StatusCode)
+	}
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestGinTestSuite(t *testing.T) {
+	suite.Run(t, new(GinTestSuite))
+}
@@ -0,0 +1,126 @@
+package ws_manager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// AddToGroup adds the connection with clientID in the given session to a named
+// group. Groups span sessions, and connections leave every group when they
+// disconnect.
+func (sm *SessionManager) AddToGroup(groupName string, sessionKey, clientID string) error {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	cl, err := sm.findClient(sessionKey, clientID)
+	if err != nil {
+		return err
+	}
+	members, ok := sm.groups[groupName]
+	if !ok {
+		members = map[*client]string{}
+		sm.groups[groupName] = members
+	}
+	members[cl] = sessionKey
+	return nil
+}
+
+// RemoveFromGroup removes the connection with clientID in the given session from
+// a named group.
+func (sm *SessionManager) RemoveFromGroup(groupName string, sessionKey, clientID string) error {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	cl, err := sm.findClient(sessionKey, clientID)
+	if err != nil {
+		return err
+	}
+	sm.leaveGroupLocked(groupName, cl)
+	return nil
+}
+
+// BroadcastToGroup sends message to every member of the group, whichever
+// session it belongs to, and returns the number of connections it reached.
+// Delivery continues past failed writes; the first write error is returned.
+func (sm *SessionManager) BroadcastToGroup(groupName, message string) (int, error) {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	members, ok := sm.groups[groupName]
+	if !ok {
+		return 0, errors.New(
+			fmt.Sprintf("Group %s not found", groupName),
+		)
+	}
+
+	// the pre-broadcast hook is consulted once per session
+	rewritten := map[string][]byte{}
+	delivered := 0
+	var firstErr error
+	for cl, sessionKey := range members {
+		s, ok := sm.sessions[sessionKey]
+		if !ok {
+			continue
+		}
+		payload, seen := rewritten[sessionKey]
+		if !seen {
+			payload = []byte(message)
+			if sm.preBroadcastMessage != nil {
+				newMsg, allow := sm.preBroadcastMessage(sessionKey, "", websocket.TextMessage, payload)
+				if allow {
+					payload = newMsg
+				} else {
+					payload = nil
+					sm.countVeto()
+				}
+			}
+			if payload != nil && sm.preBroadcast != nil {
+				newMsg, allow := sm.preBroadcast(sessionKey, "", string(payload))
+				if allow {
+					payload = []byte(newMsg)
+				} else {
+					payload = nil
+					sm.countVeto()
+				}
+			}
+			if payload != nil {
+				now := time.Now()
+				sm.auditLocked(s, "", "", payload, now)
+				sm.auditBroadcast(s, "", "", websocket.TextMessage, payload, now, 0)
+			}
+			rewritten[sessionKey] = payload
+		}
+		if payload == nil {
+			continue
+		}
+		written, err := sm.writeLocked(s, cl, payload)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if written {
+			delivered++
+		}
+	}
+	return delivered, firstErr
+}
+
+func (sm *SessionManager) leaveGroupLocked(groupName string, cl *client) {
+	members, ok := sm.groups[groupName]
+	if !ok {
+		return
+	}
+	delete(members, cl)
+	if len(members) == 0 {
+		delete(sm.groups, groupName)
+	}
+}
+
+// leaveGroupsLocked removes cl from every group. The caller must hold
+// sessionManagerMu.
+func (sm *SessionManager) leaveGroupsLocked(cl *client) {
+	sm.groupsMu.Lock()
+	defer sm.groupsMu.Unlock()
+	for groupName := range sm.groups {
+		sm.leaveGroupLocked(groupName, cl)
+	}
+}
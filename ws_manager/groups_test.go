@@ -0,0 +1,85 @@
+package ws_manager
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type GroupsTestSuite struct {
+	suite.Suite
+	manager *SessionManager
+	server  *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *GroupsTestSuite) SetupTest() {
+	suite.manager = CreateSessionManager([]string{"roomone", "roomtwo"})
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *GroupsTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *GroupsTestSuite) TestBroadcastSpansSessions() {
+	premium1, premium1ID, err := dialSessionWithID(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	free, err := dialSession(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	premium2, premium2ID, err := dialSessionWithID(suite.server, "roomtwo", "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 2))
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomtwo", 1))
+
+	assert.NoError(suite.T(), suite.manager.AddToGroup("premium", "roomone", premium1ID))
+	assert.NoError(suite.T(), suite.manager.AddToGroup("premium", "roomtwo", premium2ID))
+
+	delivered, err := suite.manager.BroadcastToGroup("premium", "new feature")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 2, delivered)
+
+	message, err := readWithTimeout(premium1, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "new feature", message)
+	message, err = readWithTimeout(premium2, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "new feature", message)
+
+	_, err = readWithTimeout(free, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *GroupsTestSuite) TestDisconnectLeavesGroup() {
+	member, memberID, err := dialSessionWithID(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 1))
+	assert.NoError(suite.T(), suite.manager.AddToGroup("premium", "roomone", memberID))
+
+	member.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 0))
+
+	_, err = suite.manager.BroadcastToGroup("premium", "anyone there?")
+	assert.EqualError(suite.T(), err, "Group premium not found")
+}
+
+func (suite *GroupsTestSuite) TestAddUnknownConnection() {
+	err := suite.manager.AddToGroup("premium", "roomone", "404")
+	assert.EqualError(suite.T(), err, "Client 404 not found in session roomone")
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestGroupsTestSuite(t *testing.T) {
+	suite.Run(t, new(GroupsTestSuite))
+}
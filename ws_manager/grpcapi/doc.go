@@ -0,0 +1,18 @@
+// Package grpcapi serves the SessionControl gRPC service of control.proto,
+// so backend services that do not speak HTTP can register and close
+// sessions, broadcast, query presence and stats, and watch lifecycle
+// events. It is a module of its own, so the ws_manager module does not
+// require gRPC of applications that do not use it. The controlpb package is
+// generated from control.proto, and regenerated after changing it with
+// protoc, protoc-gen-go and protoc-gen-go-grpc installed:
+//
+//	go generate .
+//
+// The service is served next to the WebSocket endpoint:
+//
+//	gs := grpc.NewServer()
+//	grpcapi.Register(gs, sm)
+//	gs.Serve(lis)
+package grpcapi
+
+//go:generate protoc --go_out=. --go_opt=module=github.com/chau-t-tran/ws-to-me/ws_manager/grpcapi --go-grpc_out=. --go-grpc_opt=module=github.com/chau-t-tran/ws-to-me/ws_manager/grpcapi control.proto
@@ -0,0 +1,262 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chau-t-tran/ws-to-me/ws_manager"
+	"github.com/chau-t-tran/ws-to-me/ws_manager/grpcapi/controlpb"
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Client lifecycle events streamed by WatchEvents, besides the session
+// events of ws_manager.
+const (
+	EventClientJoined = "client.joined"
+	EventClientLeft   = "client.left"
+)
+
+// watchBuffer is how many events a WatchEvents stream may fall behind
+// before it is ended with ResourceExhausted.
+const watchBuffer = 256
+
+// Server implements controlpb.SessionControlServer on a SessionManager.
+type Server struct {
+	controlpb.UnimplementedSessionControlServer
+	sm *ws_manager.SessionManager
+
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+type watcher struct {
+	sessionKey string
+	events     chan *controlpb.Event
+	lost       chan struct{}
+	lostOnce   sync.Once
+}
+
+// NewServer returns the service for sm. It hooks into sm's lifecycle
+// events once, so create a single Server per manager.
+func NewServer(sm *ws_manager.SessionManager) *Server {
+	srv := &Server{sm: sm, watchers: map[*watcher]struct{}{}}
+	sm.OnSessionEvent(func(event ws_manager.WebhookEvent) {
+		srv.publish(&controlpb.Event{
+			Event:      event.Event,
+			SessionKey: event.SessionKey,
+			Timestamp:  event.Timestamp,
+			Clients:    int32(event.Clients),
+		})
+	})
+	sm.OnConnect(func(sessionKey, clientID string) {
+		srv.publish(&controlpb.Event{
+			Event:      EventClientJoined,
+			SessionKey: sessionKey,
+			Timestamp:  unixMillis(time.Now()),
+			ClientId:   clientID,
+		})
+	})
+	sm.OnClose(func(sessionKey, clientID string, info ws_manager.CloseInfo) {
+		srv.publish(&controlpb.Event{
+			Event:       EventClientLeft,
+			SessionKey:  sessionKey,
+			Timestamp:   unixMillis(time.Now()),
+			ClientId:    clientID,
+			CloseCode:   int32(info.Code),
+			CloseReason: info.Reason,
+		})
+	})
+	return srv
+}
+
+// Register registers the service for sm on gs and returns it.
+func Register(gs *grpc.Server, sm *ws_manager.SessionManager) *Server {
+	srv := NewServer(sm)
+	controlpb.RegisterSessionControlServer(gs, srv)
+	return srv
+}
+
+func (srv *Server) RegisterSession(ctx context.Context, req *controlpb.RegisterSessionRequest) (*controlpb.RegisterSessionResponse, error) {
+	if req.SessionKey == "" {
+		key, err := srv.sm.CreateSession()
+		if err != nil {
+			return nil, statusOf(err)
+		}
+		return &controlpb.RegisterSessionResponse{SessionKey: key}, nil
+	}
+	if err := srv.sm.RegisterSession(req.SessionKey); err != nil {
+		return nil, statusOf(err)
+	}
+	return &controlpb.RegisterSessionResponse{SessionKey: req.SessionKey}, nil
+}
+
+func (srv *Server) CloseSession(ctx context.Context, req *controlpb.CloseSessionRequest) (*controlpb.CloseSessionResponse, error) {
+	code := int(req.Code)
+	if code == 0 {
+		code = websocket.CloseNormalClosure
+	}
+	err := srv.sm.CloseSession(req.SessionKey, code, req.Reason)
+	var closeErr *ws_manager.CloseError
+	switch {
+	case err == nil:
+		return &controlpb.CloseSessionResponse{}, nil
+	case errors.As(err, &closeErr):
+		resp := &controlpb.CloseSessionResponse{}
+		for id := range closeErr.Failures {
+			resp.FailedClientIds = append(resp.FailedClientIds, id)
+		}
+		sort.Strings(resp.FailedClientIds)
+		return resp, nil
+	default:
+		return nil, statusOf(err)
+	}
+}
+
+func (srv *Server) Broadcast(ctx context.Context, req *controlpb.BroadcastRequest) (*controlpb.BroadcastResponse, error) {
+	if _, err := srv.sm.GetSessionStats(req.SessionKey); err != nil {
+		return nil, statusOf(err)
+	}
+	messageType := websocket.TextMessage
+	if req.Binary {
+		messageType = websocket.BinaryMessage
+	}
+	recipients, errs := srv.sm.Broadcast(req.SessionKey, ws_manager.SystemSender, messageType, req.Message)
+	return &controlpb.BroadcastResponse{
+		Recipients: int32(recipients),
+		Failed:     int32(len(errs)),
+	}, nil
+}
+
+func (srv *Server) ListClients(ctx context.Context, req *controlpb.ListClientsRequest) (*controlpb.ListClientsResponse, error) {
+	clients, err := srv.sm.ListClients(req.SessionKey)
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	resp := &controlpb.ListClientsResponse{}
+	for _, info := range clients {
+		resp.Clients = append(resp.Clients, &controlpb.Client{
+			Id:         info.ID,
+			RemoteAddr: info.RemoteAddr,
+			JoinedAt:   unixMillis(info.JoinedAt),
+			Identity:   info.Identity,
+			Name:       info.Name,
+			Role:       info.Role,
+			Tags:       info.Tags,
+		})
+	}
+	return resp, nil
+}
+
+func (srv *Server) GetSessionStats(ctx context.Context, req *controlpb.GetSessionStatsRequest) (*controlpb.SessionStats, error) {
+	stats, err := srv.sm.GetSessionStats(req.SessionKey)
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return &controlpb.SessionStats{
+		SessionKey:          stats.SessionKey,
+		Connections:         int32(stats.Connections),
+		Broadcasts:          stats.Broadcasts,
+		BytesRelayed:        stats.BytesRelayed,
+		MessagesPerSecond:   stats.MessagesPerSecond,
+		CreatedAt:           unixMillis(stats.CreatedAt),
+		LastUsed:            unixMillis(stats.LastUsed),
+		RejectedConnections: stats.RejectedConnections,
+		PeakConnections:     int32(stats.PeakConnections),
+		MessagesReceived:    stats.MessagesReceived,
+		BytesReceived:       stats.BytesReceived,
+		Tags:                stats.Tags,
+	}, nil
+}
+
+func (srv *Server) GetStats(ctx context.Context, req *controlpb.GetStatsRequest) (*controlpb.ManagerStats, error) {
+	stats := srv.sm.Stats()
+	return &controlpb.ManagerStats{
+		Sessions:         int32(stats.Sessions),
+		Connections:      int32(stats.Connections),
+		PeakConnections:  int32(stats.PeakConnections),
+		Broadcasts:       stats.Broadcasts,
+		MessagesReceived: stats.MessagesReceived,
+		BytesRelayed:     stats.BytesRelayed,
+		BytesReceived:    stats.BytesReceived,
+		StartedAt:        unixMillis(stats.StartedAt),
+		LastActivity:     unixMillis(stats.LastActivity),
+	}, nil
+}
+
+// WatchEvents streams lifecycle events until the call is cancelled. A
+// stream that falls more than watchBuffer events behind is ended with
+// ResourceExhausted rather than holding up the manager, so the caller
+// knows to resync, e.g. with ListClients.
+func (srv *Server) WatchEvents(req *controlpb.WatchEventsRequest, stream controlpb.SessionControl_WatchEventsServer) error {
+	w := &watcher{
+		sessionKey: req.SessionKey,
+		events:     make(chan *controlpb.Event, watchBuffer),
+		lost:       make(chan struct{}),
+	}
+	srv.mu.Lock()
+	srv.watchers[w] = struct{}{}
+	srv.mu.Unlock()
+	defer func() {
+		srv.mu.Lock()
+		delete(srv.watchers, w)
+		srv.mu.Unlock()
+	}()
+	for {
+		select {
+		case event := <-w.events:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-w.lost:
+			return status.Error(codes.ResourceExhausted, "Event stream fell behind")
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// publish hands event to the watchers without blocking, as session events
+// arrive under the manager lock.
+func (srv *Server) publish(event *controlpb.Event) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for w := range srv.watchers {
+		if w.sessionKey != "" && w.sessionKey != event.SessionKey {
+			continue
+		}
+		select {
+		case w.events <- event:
+		default:
+			w.lostOnce.Do(func() {
+				close(w.lost)
+			})
+		}
+	}
+}
+
+// statusOf maps an error of the manager to its gRPC status.
+func statusOf(err error) error {
+	switch {
+	case errors.Is(err, ws_manager.ErrSessionNotFound), errors.Is(err, ws_manager.ErrClientNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ws_manager.ErrSessionExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ws_manager.ErrSessionLimitReached):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return status.Error(codes.FailedPrecondition, err.Error())
+}
+
+// unixMillis returns t in Unix milliseconds, zero for the zero time.
+func unixMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,139 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/chau-t-tran/ws-to-me/ws_manager"
+	"github.com/chau-t-tran/ws-to-me/ws_manager/grpcapi/controlpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type ServerTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *ws_manager.SessionManager
+	server     *Server
+}
+
+// eventStream collects the events WatchEvents sends.
+type eventStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	events chan *controlpb.Event
+}
+
+func (s *eventStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *eventStream) Send(event *controlpb.Event) error {
+	s.events <- event
+	return nil
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *ServerTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = ws_manager.CreateSessionManager([]string{suite.sessionKey})
+	suite.server = NewServer(suite.manager)
+}
+
+func (suite *ServerTestSuite) TearDownTest() {
+	suite.manager.Shutdown(context.Background())
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *ServerTestSuite) TestRegisterAndQuerySessions() {
+	ctx := context.Background()
+	resp, err := suite.server.RegisterSession(ctx, &controlpb.RegisterSessionRequest{})
+	assert.NoError(suite.T(), err)
+	assert.NotEmpty(suite.T(), resp.SessionKey)
+
+	_, err = suite.server.RegisterSession(ctx, &controlpb.RegisterSessionRequest{SessionKey: suite.sessionKey})
+	assert.Equal(suite.T(), codes.AlreadyExists, status.Code(err))
+	_, err = suite.server.ListClients(ctx, &controlpb.ListClientsRequest{SessionKey: "missing"})
+	assert.Equal(suite.T(), codes.NotFound, status.Code(err))
+
+	stats, err := suite.server.GetStats(ctx, &controlpb.GetStatsRequest{})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int32(2), stats.Sessions)
+	broadcast, err := suite.server.Broadcast(ctx, &controlpb.BroadcastRequest{SessionKey: suite.sessionKey, Message: []byte("hi")})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int32(0), broadcast.Recipients)
+}
+
+func (suite *ServerTestSuite) TestWatchEventsFiltersBySession() {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &eventStream{ctx: ctx, events: make(chan *controlpb.Event, 4)}
+	done := make(chan error, 1)
+	go func() {
+		done <- suite.server.WatchEvents(&controlpb.WatchEventsRequest{SessionKey: "roomone"}, stream)
+	}()
+	assert.Eventually(suite.T(), func() bool {
+		suite.server.mu.Lock()
+		defer suite.server.mu.Unlock()
+		return len(suite.server.watchers) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(suite.T(), suite.manager.RegisterSession("roomtwo"))
+	assert.NoError(suite.T(), suite.manager.RegisterSession("roomone"))
+	select {
+	case event := <-stream.events:
+		assert.Equal(suite.T(), ws_manager.WebhookSessionCreated, event.Event)
+		assert.Equal(suite.T(), "roomone", event.SessionKey)
+	case <-time.After(time.Second):
+		suite.T().Fatal("no event streamed")
+	}
+	cancel()
+	assert.ErrorIs(suite.T(), <-done, context.Canceled)
+}
+
+func (suite *ServerTestSuite) TestServesOverGRPC() {
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	Register(gs, suite.manager)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if !assert.NoError(suite.T(), err) {
+		return
+	}
+	defer conn.Close()
+	client := controlpb.NewSessionControlClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := client.RegisterSession(ctx, &controlpb.RegisterSessionRequest{SessionKey: "roomone"})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "roomone", resp.SessionKey)
+	_, err = client.GetSessionStats(ctx, &controlpb.GetSessionStatsRequest{SessionKey: "missing"})
+	assert.Equal(suite.T(), codes.NotFound, status.Code(err))
+
+	stats, err := client.GetSessionStats(ctx, &controlpb.GetSessionStatsRequest{SessionKey: "roomone"})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "roomone", stats.SessionKey)
+	assert.Equal(suite.T(), int32(0), stats.Connections)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestServerTestSuite(t *testing.T) {
+	suite.Run(t, new(ServerTestSuite))
+}
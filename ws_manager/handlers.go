@@ -1,10 +1,11 @@
 package ws_manager
 
 import (
-	"log"
+	"errors"
 	"net/http"
+	"path"
 
-	"github.com/chau-t-tran/ws-to-me/utils"
+	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 )
 
@@ -16,45 +17,417 @@ type (
 
 // two different ways to register a session: via landing page or via API
 
+// RegisterHandler registers a session under a key from CreateSession and
+// answers 201 with the key. It answers 503 while the manager cannot take
+// more sessions and 409 if no unused key was found.
 func (sm *SessionManager) RegisterHandler(c echo.Context) error {
-	sessionKey := utils.RandomKey()
-	sm.RegisterSession(sessionKey)
+	sessionKey, err := sm.CreateSession()
+	if err != nil {
+		return c.String(createSessionStatus(err), err.Error())
+	}
 	response := SessionRegResponse{
 		SessionKey: sessionKey,
 	}
 	return c.JSON(http.StatusCreated, response)
 }
 
+// RootHandler is RegisterHandler for the landing page, which it renders
+// with the new key.
 func (sm *SessionManager) RootHandler(c echo.Context) error {
-	sessionKey := utils.RandomKey()
-	sm.RegisterSession(sessionKey)
-	log.Println("Registered", sessionKey)
+	sessionKey, err := sm.CreateSession()
+	if err != nil {
+		return c.String(createSessionStatus(err), err.Error())
+	}
+	sm.logger.Info("Registered session", "session", sessionKey)
 	return c.Render(http.StatusOK, "index.html", map[string]interface{}{
 		"sessionKey": sessionKey,
 		"host":       c.Request().Host,
 	})
 }
 
+// createSessionStatus is the status answering a CreateSession error.
+func createSessionStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrShutDown), errors.Is(err, ErrSessionLimitReached):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrNoFreeSessionKey):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
 // main websocket handler
 
+// EchoHandler upgrades the request and serves the connection in the session
+// named by the "sessionKey" path parameter, and in the stream named by the
+// "stream" one if the route has it, see WithStream.
 func (sm *SessionManager) EchoHandler(c echo.Context) error {
-	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
-	sessionKey := c.Param("sessionKey")
+	return sm.serveStream(c.Response(), c.Request(), c.Param("sessionKey"), c.Param("stream"))
+}
+
+// ServeWS upgrades r and serves the connection in sessionKey until it
+// ends, for routers that extract the session key themselves, e.g. chi's
+// URLParam or gin's Param. Refused handshakes are answered on w.
+func (sm *SessionManager) ServeWS(w http.ResponseWriter, r *http.Request, sessionKey string) error {
+	return sm.serve(w, r, sessionKey)
+}
+
+// Handler is EchoHandler for net/http routers. The session key is the last
+// segment of the request path, or the "sessionKey" query parameter when the
+// path has none. A last segment naming a stream registered with WithStream
+// is the stream, and the segment before it the session key.
+func (sm *SessionManager) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionKey, stream := sm.sessionAndStream(r)
+		sm.serveStream(w, r, sessionKey, stream)
+	}
+}
+
+// HandlerForKey is Handler with the session key taken from the request by
+// keyFromRequest, e.g. a router's path parameter lookup.
+func (sm *SessionManager) HandlerForKey(keyFromRequest func(*http.Request) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sm.ServeWS(w, r, keyFromRequest(r))
+	}
+}
+
+func sessionKeyFromRequest(r *http.Request) string {
+	if key := path.Base(r.URL.Path); key != "/" && key != "." {
+		return key
+	}
+	return r.URL.Query().Get("sessionKey")
+}
+
+// plainText writes a plain text response the way echo's Context.String
+// does.
+func plainText(w http.ResponseWriter, code int, text string) error {
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.WriteHeader(code)
+	_, err := w.Write([]byte(text))
+	return err
+}
+
+// serve upgrades r and runs the connection in sessionKey until it ends.
+func (sm *SessionManager) serve(w http.ResponseWriter, r *http.Request, sessionKey string) error {
+	return sm.serveStream(w, r, sessionKey, "")
+}
+
+// serveStream is serve for a connection of stream.
+func (sm *SessionManager) serveStream(w http.ResponseWriter, r *http.Request, sessionKey, stream string) error {
+	forwarded := false
+	if addr := sm.clientAddr(r); addr != r.RemoteAddr {
+		r = r.WithContext(r.Context())
+		r.RemoteAddr = addr
+		forwarded = true
+	}
+	query := r.URL.Query()
+	if err := sm.trackHandler(); err != nil {
+		return plainText(w, http.StatusServiceUnavailable, err.Error())
+	}
+	defer sm.handlers.Done()
+	if sm.refuseDraining(w) {
+		return nil
+	}
+	if err := sm.validateKey(sessionKey); err != nil {
+		return plainText(w, http.StatusBadRequest, err.Error())
+	}
+	if !sm.streamKnown(stream) {
+		return plainText(w, http.StatusNotFound, "Stream not found")
+	}
+	if err := sm.refuseAtLimit(sessionKey); err != nil {
+		return plainText(w, http.StatusServiceUnavailable, err.Error())
+	}
+	if sm.unknownSessionPolicy == UnknownSessionReject && !sm.sessionAvailable(sessionKey) {
+		sm.unknownSession(sessionKey, r)
+		return plainText(w, http.StatusNotFound, "Session not found")
+	}
+	identity := ""
+	role := RoleParticipant
+	if sm.auth != nil {
+		id, err := sm.auth(sessionKey, r)
+		switch {
+		case err == nil:
+			identity = id
+		case errors.Is(err, ErrForbidden):
+			sm.logger.Warn("Authentication failed", "session", sessionKey, "err", err)
+			return plainText(w, http.StatusForbidden, "Forbidden")
+		case sm.anonymousObserve:
+			role = RoleObserver
+		default:
+			sm.logger.Warn("Authentication failed", "session", sessionKey, "err", err)
+			return plainText(w, http.StatusUnauthorized, "Unauthorized")
+		}
+	}
+	if sm.isBanned(sessionKey, identity) {
+		return plainText(w, http.StatusForbidden, "Forbidden")
+	}
+	if role == RoleParticipant {
+		assigned, err := sm.assignRole(sessionKey, identity, r)
+		if err != nil {
+			sm.logger.Warn("Role refused", "session", sessionKey, "identity", identity, "err", err)
+			return plainText(w, http.StatusForbidden, "Forbidden")
+		}
+		role = assigned
+	}
+	if !sm.closeWhenFull && !sm.admit(sessionKey) {
+		return plainText(w, http.StatusServiceUnavailable, "Session is full")
+	}
+	name := query.Get("name")
+	if !sm.nameAvailable(sessionKey, name) {
+		return plainText(w, http.StatusConflict, "Name already taken")
+	}
+
+	var resumed *resumeSlot
+	token := query.Get("resume")
+	if token == "" {
+		token = sm.affinityToken(sessionKey, r)
+	}
+	owner := sm.designatedOwner(sessionKey, identity)
+	if token == "" && !owner && sm.sessionLocked(sessionKey) {
+		return plainText(w, http.StatusLocked, "Session is locked")
+	}
+	if token != "" && sm.resumeTTL > 0 {
+		resumed = sm.claimResume(sessionKey, token, identity)
+	}
+	clientID := ""
+	if resumed != nil {
+		clientID = resumed.client.id
+	} else if sm.clientIDs != nil {
+		id, err := sm.clientIDs(sessionKey, identity, r)
+		if err != nil {
+			sm.logger.Warn("Client ID refused", "session", sessionKey, "identity", identity, "err", err)
+			return plainText(w, http.StatusForbidden, "Forbidden")
+		}
+		if id != "" && sm.duplicatePolicy != DuplicateCloseOlder && !sm.clientIDAvailable(sessionKey, id) {
+			return plainText(w, http.StatusConflict, "Client ID in use")
+		}
+		clientID = id
+	}
+	if sm.isKickBanned(sessionKey, r.RemoteAddr, clientID) {
+		return plainText(w, http.StatusForbidden, "Forbidden")
+	}
+	if clientID == "" {
+		clientID = sm.newClientID()
+	}
+	if sm.refuseDuplicate(sessionKey, identity, clientID) {
+		return plainText(w, http.StatusConflict, ErrAlreadyConnected.Error())
+	}
+	header := http.Header{}
+	header.Set(ClientIDHeader, clientID)
+	codec := sm.negotiateCodec(r)
+	if codec != nil {
+		header.Set("Sec-Websocket-Protocol", codec.Name())
+	}
+	resumeToken := ""
+	if sm.resumeTTL > 0 {
+		resumeToken = newResumeToken()
+		header.Set(ResumeTokenHeader, resumeToken)
+		sm.setAffinityCookie(header, sessionKey, r, resumeToken)
+	}
+	conn, err := sm.upgrader.Upgrade(w, r, header)
 	if err != nil {
-		log.Println("upgrade error:", err)
+		sm.logger.Error("Upgrade failed", "session", sessionKey, "err", err)
 		return err
 	}
 	defer conn.Close()
-	sm.AddConnection(sessionKey, conn)
+	if sm.compression {
+		if err := conn.SetCompressionLevel(sm.compressionLevel); err != nil {
+			sm.logger.Error("Setting compression level failed", "session", sessionKey, "err", err)
+		}
+	}
+	var readErr error
+	connCtx, connSpan := sm.tracer.Start(r.Context(), "ws.connection", "session", sessionKey, "client", clientID, "resumed", resumed != nil)
+	defer func() {
+		endConnectionSpan(connSpan, readErr)
+	}()
+	cl := newClient(conn, identity, query["tag"])
+	cl.id = clientID
+	if forwarded {
+		cl.addr = r.RemoteAddr
+	}
+	cl.addrLimiter = sm.claimAddrLimiter(cl)
+	defer sm.releaseAddrLimiter(cl)
+	if codec != nil && codec.Name() != JSONCodec().Name() {
+		cl.codec = codec
+	}
+	cl.setContext(connCtx)
+	cl.writeTimeout = sm.writeTimeout
+	cl.compressed = sm.upgrader.EnableCompression && offersDeflate(r)
+	cl.compressThreshold = sm.compressionThreshold
+	cl.resumeToken = resumeToken
+	cl.resumed = resumed
+	cl.ownerCandidate = owner
+	cl.limiter = newRateLimiter(sm.streamRateLimit(sessionKey, stream))
+	cl.role = role
+	cl.name = name
+	cl.topic = query.Get("topic")
+	cl.stream = stream
+	if sm.endToEnd {
+		cl.publicKey = query.Get("publicKey")
+	}
+	if sm.clientMetadata != nil {
+		cl.metadata = copyMetadata(sm.clientMetadata(r, sessionKey))
+	}
+	if resumed != nil {
+		resumed.restore(cl)
+	}
+	stopWriter := sm.startWriter(sessionKey, cl)
+	defer stopWriter()
+	stopCoalescing := sm.startCoalescing(sessionKey, cl)
+	defer stopCoalescing()
+	if err := sm.addClient(sessionKey, cl); err != nil {
+		sm.logger.Info("Connection refused", "session", sessionKey, "client", clientID, "err", err)
+		if errors.Is(err, ErrNameTaken) {
+			sm.closeClient(cl, websocket.ClosePolicyViolation, "name already taken")
+			return nil
+		}
+		if errors.Is(err, ErrClientIDTaken) {
+			sm.closeClient(cl, websocket.ClosePolicyViolation, "client ID in use")
+			return nil
+		}
+		if errors.Is(err, ErrAlreadyConnected) {
+			sm.closeClient(cl, websocket.ClosePolicyViolation, "already connected")
+			return nil
+		}
+		if errors.Is(err, ErrDraining) {
+			code, reason := sm.closeFrame(CloseDrain, websocket.CloseGoingAway, "server draining")
+			sm.closeClient(cl, code, reason)
+			return nil
+		}
+		if errors.Is(err, ErrSessionLocked) {
+			sm.closeClient(cl, websocket.ClosePolicyViolation, "session is locked")
+			return nil
+		}
+		if errors.Is(err, ErrSessionLimitReached) {
+			sm.closeClient(cl, websocket.CloseTryAgainLater, "too many sessions")
+			return nil
+		}
+		if errors.Is(err, ErrConnectionLimitReached) {
+			sm.closeClient(cl, websocket.CloseTryAgainLater, "too many connections")
+			return nil
+		}
+		if errors.Is(err, ErrClientLimitReached) {
+			code := websocket.ClosePolicyViolation
+			if sm.closeWhenFull {
+				code = CloseSessionFull
+			}
+			sm.closeClient(cl, code, "session is full")
+			return nil
+		}
+		if sm.isBanned(sessionKey, identity) {
+			sm.closeClient(cl, websocket.ClosePolicyViolation, "banned")
+			return nil
+		}
+		if !sm.sessionAvailable(sessionKey) {
+			sm.unknownSession(sessionKey, r)
+			sm.closeClient(cl, CloseUnknownSession, "unknown_session")
+			return nil
+		}
+		// a failed welcome or replay leaves the client in the session
+		sm.removeClient(sessionKey, cl)
+		sm.closeClient(cl, websocket.CloseNormalClosure, "session not found")
+		return nil
+	}
+	sm.connected(sessionKey, cl)
+	defer func() {
+		sm.disconnected(sessionKey, cl, readErr)
+	}()
+	stopGrace := sm.watchConnectGrace(sessionKey, cl)
+	defer stopGrace()
+	stopEviction := sm.watchIdleEviction(sessionKey, cl)
+	defer stopEviction()
+	sm.resetIdle(cl)
+	stopKeepalive := sm.startKeepalive(sessionKey, cl)
+	defer stopKeepalive()
 	for {
-		_, message, err := conn.ReadMessage()
+		messageType, message, err := sm.readMessage(cl)
 		if err != nil {
+			readErr = err
+			if err == websocket.ErrReadLimit {
+				sm.rejectOversized(sessionKey, cl)
+			} else if sm.idleExpired(cl) {
+				code, reason := sm.closeFrame(CloseIdle, CloseNoActivity, "idle timeout")
+				cl.recordClose(CloseInfo{Code: code, Reason: reason, ByServer: true})
+				sm.closeClient(cl, code, reason)
+			}
 			break
 		}
-		err = sm.Broadcast(sessionKey, conn.RemoteAddr().String(), message)
+		cl.markActive()
+		sm.touch(sessionKey)
+		sm.resetIdle(cl)
+		if messageType == websocket.TextMessage && sm.controlEnabled() {
+			if control, ok := parseControlMessage(message); ok {
+				sm.receiveControl(sessionKey, cl, control, len(message))
+				continue
+			}
+		}
+		msgCtx, msgSpan := sm.tracer.Start(connCtx, "ws.message", "session", sessionKey, "client", cl.id, "bytes", len(message))
+		cl.setContext(msgCtx)
+		err = sm.relayMessage(sessionKey, cl, messageType, message)
 		if err != nil {
+			msgSpan.RecordError(err)
+		}
+		msgSpan.End()
+		cl.setContext(connCtx)
+		if err != nil {
+			readErr = err
 			return err
 		}
 	}
 	return nil
 }
+
+// relayMessage passes a data message from cl through the read-side policies and
+// broadcasts it. Only errors that should end the sender's connection are
+// returned.
+func (sm *SessionManager) relayMessage(sessionKey string, cl *client, messageType int, message []byte) error {
+	sm.countInbound(sessionKey, len(message))
+	if cl.role == RoleObserver {
+		sm.rejectReadOnly(sessionKey, cl)
+		return nil
+	}
+	if cl.isMuted() {
+		sm.rejectMuted(sessionKey, cl)
+		return nil
+	}
+	if sm.rateLimited(sessionKey, cl, len(message)) {
+		return nil
+	}
+	if sm.isDuplicate(sessionKey, cl, message) {
+		return nil
+	}
+	messageType, message, recipients, err := sm.runMiddlewares(sessionKey, cl, messageType, message)
+	if err != nil {
+		sm.logger.Debug("Message dropped by middleware", "session", sessionKey, "client", cl.id, "err", err)
+		if errors.Is(err, ErrCloseConnection) {
+			sm.closeClient(cl, websocket.ClosePolicyViolation, "message rejected")
+		}
+		return nil
+	}
+	sm.received(sessionKey, cl, messageType, message)
+	if sm.protocolMode {
+		var forward bool
+		message, forward = sm.dispatchEnvelope(sessionKey, cl, messageType, message)
+		if !forward {
+			return nil
+		}
+		messageType = websocket.TextMessage
+	}
+	if recipients != nil {
+		err = sm.redirect(sessionKey, cl, messageType, message, recipients)
+	} else if len(sm.streams) > 0 {
+		err = sm.relayToStream(sessionKey, cl, messageType, message)
+	} else if cl.topic != "" {
+		err = sm.BroadcastToTopic(sessionKey, cl.topic, cl.id, messageType, message)
+	} else {
+		err = sm.BroadcastMessage(sessionKey, cl.id, messageType, message)
+	}
+	var broadcastErr *BroadcastError
+	if errors.As(err, &broadcastErr) {
+		// the recipients that failed have been dropped; the sender
+		// stays connected
+		sm.logger.Debug("Broadcast dropped connections", "session", sessionKey, "client", cl.id, "err", err)
+		return nil
+	}
+	return err
+}
@@ -1,15 +1,19 @@
 package ws_manager
 
 import (
-	"fmt"
+	"context"
+	"encoding/json"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/chau-t-tran/ws-to-me/constants"
 	"github.com/chau-t-tran/ws-to-me/templates"
 	"github.com/chau-t-tran/ws-to-me/utils"
+	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 
 	"github.com/stretchr/testify/assert"
@@ -18,21 +22,15 @@ import (
 
 type HandlersTestSuite struct {
 	suite.Suite
-	seed           int
-	sessionKeyJSON string
-	manager        SessionManager
-	e              *echo.Echo
+	seed    int
+	manager *SessionManager
+	e       *echo.Echo
 }
 
 /*-------------------Setups/Teardowns-------------------*/
 
 func (suite *HandlersTestSuite) SetupTest() {
 	suite.seed = constants.KEY_TEST_SEED
-	rand.Seed(int64(suite.seed))
-	key := utils.RandomKey()
-	rand.Seed(int64(suite.seed))
-	suite.sessionKeyJSON = fmt.Sprintf(`{"sessionKey":"%s"}`, key)
-
 	suite.manager = CreateSessionManager([]string{})
 
 	suite.e = echo.New()
@@ -50,6 +48,8 @@ func (suite *HandlersTestSuite) TestRootHandler() {
 	c := suite.e.NewContext(req, rec)
 
 	assert.NoError(suite.T(), suite.manager.RootHandler(c))
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Len(suite.T(), suite.manager.ListSessions(), 1)
 }
 
 func (suite *HandlersTestSuite) TestRegisterHandler() {
@@ -58,8 +58,83 @@ func (suite *HandlersTestSuite) TestRegisterHandler() {
 	c := suite.e.NewContext(req, rec)
 
 	if assert.NoError(suite.T(), suite.manager.RegisterHandler(c)) {
-		assert.Equal(suite.T(), suite.sessionKeyJSON+"\n", rec.Body.String())
+		assert.Equal(suite.T(), http.StatusCreated, rec.Code)
+		var response SessionRegResponse
+		assert.NoError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Len(suite.T(), response.SessionKey, DefaultKeyLength)
+		assert.Equal(suite.T(), []string{response.SessionKey}, suite.manager.ListSessions())
+	}
+}
+
+func (suite *HandlersTestSuite) TestRegisterHandlerRefusals() {
+	register := func(sm *SessionManager) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c := suite.e.NewContext(httptest.NewRequest(http.MethodPost, "/register", nil), rec)
+		assert.NoError(suite.T(), sm.RegisterHandler(c))
+		return rec
+	}
+
+	full := CreateSessionManager([]string{"roomone"}, WithMaxSessions(1))
+	defer full.cronScheduler.Stop()
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, register(full).Code)
+
+	crowded := CreateSessionManager([]string{"a", "b"}, WithKeyFormat(1, "ab"))
+	defer crowded.cronScheduler.Stop()
+	assert.Equal(suite.T(), http.StatusConflict, register(crowded).Code)
+
+	assert.NoError(suite.T(), suite.manager.Shutdown(context.Background()))
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, register(suite.manager).Code)
+	assert.Empty(suite.T(), suite.manager.ListSessions())
+}
+
+func (suite *HandlersTestSuite) TestNetHTTPHandlers() {
+	assert.NoError(suite.T(), suite.manager.RegisterSession("roomone"))
+	mux := http.NewServeMux()
+	mux.Handle("/ws/", suite.manager.Handler())
+	mux.Handle("/custom", suite.manager.HandlerForKey(func(r *http.Request) string {
+		return r.Header.Get("X-Session")
+	}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	byPath, _, err := websocket.DefaultDialer.Dial(wsURL+"/ws/roomone", nil)
+	assert.NoError(suite.T(), err)
+	header := http.Header{}
+	header.Set("X-Session", "roomone")
+	byHeader, _, err := websocket.DefaultDialer.Dial(wsURL+"/custom", header)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 2))
+
+	byPath.WriteMessage(websocket.TextMessage, []byte("over net/http"))
+	message, err := readWithTimeout(byHeader, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "over net/http", message)
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL+"/ws/missing", nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+func (suite *HandlersTestSuite) TestServeWS() {
+	assert.NoError(suite.T(), suite.manager.RegisterSession("roomtwo"))
+	served := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served <- suite.manager.ServeWS(w, r, strings.TrimPrefix(r.URL.Path, "/rooms/"))
+	}))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"/rooms/roomtwo", nil)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomtwo", 1))
+	conn.Close()
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		suite.T().Error("ServeWS did not return after the connection closed")
 	}
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomtwo", 0))
 }
 
 /*-------------------Test Runner------------------------*/
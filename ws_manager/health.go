@@ -0,0 +1,136 @@
+package ws_manager
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HealthChecker is implemented by backends that can tell whether their
+// connection is up, such as RedisBackend and NATSBackend. Health reports a
+// backend without it as healthy once its subscription is made.
+type HealthChecker interface {
+	Healthy() error
+}
+
+// Health is the state of the manager reported by HealthHandler.
+type Health struct {
+	// Live is false if the manager looks stuck: its WithGC collector has
+	// missed its runs
+	Live bool `json:"live"`
+	// Ready is whether the manager should be sent new connections: it is
+	// live, accepting connections, its backend is healthy and it is below
+	// its caps
+	Ready bool `json:"ready"`
+	// Accepting is false once StartDraining or Shutdown is called
+	Accepting bool `json:"accepting"`
+	Draining  bool `json:"draining,omitempty"`
+	ShutDown  bool `json:"shutDown,omitempty"`
+	// GC is "ok", "overdue", or "off" without a WithGC collector
+	GC string `json:"gc"`
+	// Backend is "ok", "off" without WithBackend, or the backend's error
+	Backend string `json:"backend"`
+	// Sessions and Connections are the current load, MaxSessions and
+	// MaxConnections those of WithMaxSessions and WithMaxTotalConnections
+	Sessions       int `json:"sessions"`
+	MaxSessions    int `json:"maxSessions,omitempty"`
+	Connections    int `json:"connections"`
+	MaxConnections int `json:"maxConnections,omitempty"`
+	// Problems says why the manager is not live or not ready
+	Problems []string `json:"problems,omitempty"`
+}
+
+// gcGrace is how many runs the WithGC collector may miss before Health
+// reports it overdue.
+const gcGrace = 3
+
+// Health reports the state of the manager.
+func (sm *SessionManager) Health() Health {
+	sm.rlockSessions()
+	defer sm.runlockSessions()
+	h := Health{
+		Live:           true,
+		Accepting:      !sm.shutDown && !sm.draining,
+		Draining:       sm.draining,
+		ShutDown:       sm.shutDown,
+		GC:             "off",
+		Backend:        "off",
+		Sessions:       len(sm.sessions),
+		MaxSessions:    sm.maxSessions,
+		Connections:    sm.connectionCountLocked(),
+		MaxConnections: sm.maxTotalConnections,
+	}
+	if sm.gcInterval > 0 && !sm.gcStopped && !sm.shutDown {
+		h.GC = "ok"
+		last := sm.gcLastRun
+		if last.IsZero() {
+			last = sm.startedAt
+		}
+		if time.Since(last) > gcGrace*sm.gcInterval {
+			h.GC = "overdue"
+			h.Live = false
+			h.Problems = append(h.Problems, fmt.Sprintf("GC has not run since %s", last.Format(time.RFC3339)))
+		}
+	}
+	if sm.backend != nil {
+		h.Backend = "ok"
+		err := sm.backendErr
+		if checker, ok := sm.backend.(HealthChecker); ok && err == nil {
+			err = checker.Healthy()
+		}
+		if err != nil {
+			h.Backend = err.Error()
+			h.Problems = append(h.Problems, "Backend unhealthy: "+err.Error())
+		}
+	}
+	if !h.Accepting {
+		h.Problems = append(h.Problems, "Not accepting connections")
+	}
+	if sm.limitPolicy == LimitReject {
+		if sm.maxSessions > 0 && h.Sessions >= sm.maxSessions {
+			h.Problems = append(h.Problems, fmt.Sprintf("At %d sessions of %d", h.Sessions, sm.maxSessions))
+		}
+		if sm.maxTotalConnections > 0 && h.Connections >= sm.maxTotalConnections {
+			h.Problems = append(h.Problems, fmt.Sprintf("At %d connections of %d", h.Connections, sm.maxTotalConnections))
+		}
+	}
+	h.Ready = len(h.Problems) == 0
+	return h
+}
+
+// HealthHandler serves probe endpoints for the manager, relative to
+// wherever it is mounted, by the last segment of the path, e.g. with
+// e.GET("/healthz", echo.WrapHandler(sm.HealthHandler())):
+//
+//	GET /healthz  liveness: 200 unless the manager looks stuck
+//	GET /readyz   readiness: 200 while new connections should be routed here
+//
+// Both answer 503 Service Unavailable otherwise, with the Health as JSON,
+// so a draining, overloaded or disconnected instance is taken out of
+// rotation without being restarted.
+func (sm *SessionManager) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			plainText(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		h := sm.Health()
+		ok := false
+		path := strings.Trim(r.URL.Path, "/")
+		switch path[strings.LastIndex(path, "/")+1:] {
+		case "healthz":
+			ok = h.Live
+		case "readyz":
+			ok = h.Ready
+		default:
+			plainText(w, http.StatusNotFound, "Not found")
+			return
+		}
+		code := http.StatusOK
+		if !ok {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, h)
+	})
+}
@@ -0,0 +1,152 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// downBackend is a Backend that cannot subscribe.
+type downBackend struct{}
+
+func (downBackend) Publish(sessionKey string, msg BackendMessage) error {
+	return errors.New("connection refused")
+}
+
+func (downBackend) Subscribe(handler func(sessionKey string, msg BackendMessage)) (func(), error) {
+	return nil, errors.New("connection refused")
+}
+
+type HealthTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+	probes     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *HealthTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = nil
+	suite.start(WithMaxTotalConnections(1))
+}
+
+func (suite *HealthTestSuite) TearDownTest() {
+	suite.stop()
+}
+
+// start replaces the manager with one made with opts.
+func (suite *HealthTestSuite) start(opts ...Option) {
+	if suite.manager != nil {
+		suite.stop()
+	}
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, append([]Option{WithLogger(NopLogger())}, opts...)...)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+	mux := http.NewServeMux()
+	mux.Handle("/probes/", suite.manager.HealthHandler())
+	suite.probes = httptest.NewServer(mux)
+}
+
+func (suite *HealthTestSuite) stop() {
+	suite.probes.Close()
+	suite.server.Close()
+	suite.manager.StopGC()
+	suite.manager.cronScheduler.Stop()
+}
+
+// probe returns the status and report of the probe endpoint.
+func (suite *HealthTestSuite) probe(endpoint string) (int, Health) {
+	resp, err := http.Get(suite.probes.URL + "/probes/" + endpoint)
+	assert.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	var h Health
+	assert.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&h))
+	return resp.StatusCode, h
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *HealthTestSuite) TestReadyByDefault() {
+	code, h := suite.probe("readyz")
+	assert.Equal(suite.T(), http.StatusOK, code)
+	assert.True(suite.T(), h.Ready)
+	assert.True(suite.T(), h.Accepting)
+	assert.Equal(suite.T(), "off", h.GC)
+	assert.Equal(suite.T(), "off", h.Backend)
+	assert.Equal(suite.T(), 1, h.Sessions)
+	assert.Equal(suite.T(), 1, h.MaxConnections)
+	code, _ = suite.probe("healthz")
+	assert.Equal(suite.T(), http.StatusOK, code)
+}
+
+func (suite *HealthTestSuite) TestNotReadyAtCap() {
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	code, h := suite.probe("readyz")
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, code)
+	assert.Equal(suite.T(), 1, h.Connections)
+	assert.Equal(suite.T(), []string{"At 1 connections of 1"}, h.Problems)
+	code, _ = suite.probe("healthz")
+	assert.Equal(suite.T(), http.StatusOK, code)
+}
+
+func (suite *HealthTestSuite) TestNotReadyWhileDraining() {
+	suite.manager.StartDraining(0)
+	code, h := suite.probe("readyz")
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, code)
+	assert.True(suite.T(), h.Draining)
+	assert.False(suite.T(), h.Accepting)
+	code, _ = suite.probe("healthz")
+	assert.Equal(suite.T(), http.StatusOK, code)
+}
+
+func (suite *HealthTestSuite) TestBackendDown() {
+	suite.start(WithBackend(downBackend{}))
+	code, h := suite.probe("readyz")
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, code)
+	assert.Equal(suite.T(), "connection refused", h.Backend)
+}
+
+func (suite *HealthTestSuite) TestGCOverdue() {
+	suite.start(WithGC(time.Hour, time.Hour))
+	_, h := suite.probe("healthz")
+	assert.Equal(suite.T(), "ok", h.GC)
+
+	suite.manager.sessionManagerMu.Lock()
+	suite.manager.startedAt = time.Now().Add(-4 * time.Hour)
+	suite.manager.sessionManagerMu.Unlock()
+	code, h := suite.probe("healthz")
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, code)
+	assert.False(suite.T(), h.Live)
+	assert.Equal(suite.T(), "overdue", h.GC)
+
+	suite.manager.CollectGarbage(time.Hour)
+	code, _ = suite.probe("healthz")
+	assert.Equal(suite.T(), http.StatusOK, code)
+}
+
+func (suite *HealthTestSuite) TestUnknownProbe() {
+	resp, err := http.Get(suite.probes.URL + "/probes/other")
+	assert.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestHealthTestSuite(t *testing.T) {
+	suite.Run(t, new(HealthTestSuite))
+}
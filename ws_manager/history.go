@@ -0,0 +1,174 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WithHistorySize keeps the last size broadcasts of each session and replays
+// them, oldest first, to every connection as soon as it joins. Replayed
+// messages go only to the new connection, and only if the original broadcast
+// would have reached it. In envelope and protocol mode they carry
+// "replayed":true. Presence, welcome and control frames are not kept.
+// Zero disables history.
+func WithHistorySize(size int) Option {
+	return func(sm *SessionManager) {
+		sm.historySize = size
+	}
+}
+
+// WithHistoryMaxAge stops replaying broadcasts older than maxAge. Zero keeps
+// them until they are pushed out by WithHistorySize.
+func WithHistoryMaxAge(maxAge time.Duration) Option {
+	return func(sm *SessionManager) {
+		sm.historyMaxAge = maxAge
+	}
+}
+
+// WithHistoryTTL stops replaying protocol mode envelopes of type
+// envelopeType once they are older than ttl, e.g. so typing indicators are
+// not replayed to late joiners. An envelope can set its own TTL, which takes
+// precedence. Either way the history max age still applies. Expired entries
+// are dropped from the history when it is next written to or replayed.
+func WithHistoryTTL(envelopeType string, ttl time.Duration) Option {
+	return func(sm *SessionManager) {
+		if sm.historyTTLs == nil {
+			sm.historyTTLs = map[string]time.Duration{}
+		}
+		sm.historyTTLs[envelopeType] = ttl
+	}
+}
+
+type historyEntry struct {
+	messageType int
+	message     []byte
+	match       func(*client) bool
+	at          time.Time
+	// seq is the broadcast's sequence number, zero without
+	// WithSequenceNumbers
+	seq uint64
+	// ttl is how long after at the entry is replayed, zero for as long as
+	// the history max age allows
+	ttl time.Duration
+}
+
+// expired reports whether the entry is no longer replayed at now.
+func (entry historyEntry) expired(now time.Time, maxAge time.Duration) bool {
+	age := now.Sub(entry.at)
+	return (maxAge > 0 && age > maxAge) || (entry.ttl > 0 && age >= entry.ttl)
+}
+
+// historyTTL returns the TTL of a broadcast of message: that of the
+// envelope, else that of its type, zero outside protocol mode.
+func (sm *SessionManager) historyTTL(messageType int, message []byte) time.Duration {
+	if !sm.protocolMode || messageType != websocket.TextMessage {
+		return 0
+	}
+	var env struct {
+		Type string `json:"type"`
+		TTL  int64  `json:"ttl"`
+	}
+	if json.Unmarshal(message, &env) != nil {
+		return 0
+	}
+	if env.TTL > 0 {
+		return time.Duration(env.TTL) * time.Millisecond
+	}
+	return sm.historyTTLs[env.Type]
+}
+
+// recordHistoryLocked appends a broadcast of message from senderID to the
+// history of s, dropping the oldest entry once the history is full or
+// expired. The caller must hold sessionManagerMu.
+func (sm *SessionManager) recordHistoryLocked(s *session, senderID string, messageType int, message []byte, match func(*client) bool, now time.Time, seq uint64) {
+	size := sm.historySizeLocked(s)
+	if size <= 0 {
+		return
+	}
+	ttl := sm.historyTTL(messageType, message)
+	messageType, message = sm.replayFrame(senderID, messageType, message, now, seq)
+	s.history = append(s.history, historyEntry{
+		messageType: messageType,
+		message:     append([]byte{}, message...),
+		match:       match,
+		at:          now,
+		seq:         seq,
+		ttl:         ttl,
+	})
+	if len(s.history) > size {
+		s.history = append([]historyEntry{}, s.history[len(s.history)-size:]...)
+	}
+	sm.expireHistoryLocked(s, now)
+	if sm.storeHistory {
+		sm.markStoredLocked(s.key, false)
+	}
+}
+
+// expireHistoryLocked drops the entries of s older than the history max age
+// or their TTL. The caller must hold sessionManagerMu.
+func (sm *SessionManager) expireHistoryLocked(s *session, now time.Time) {
+	kept := []historyEntry{}
+	for _, entry := range s.history {
+		if !entry.expired(now, sm.historyMaxAge) {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) < len(s.history) {
+		s.history = kept
+	}
+}
+
+// replayFrame returns the frame replaying a broadcast of message, flagged
+// as replayed in envelope and protocol mode.
+func (sm *SessionManager) replayFrame(senderID string, messageType int, message []byte, now time.Time, seq uint64) (int, []byte) {
+	if sm.protocolMode {
+		fields := map[string]interface{}{"replayed": true}
+		if seq > 0 {
+			fields["seq"] = seq
+		}
+		return messageType, setEnvelopeFields(messageType, message, fields)
+	}
+	return sm.envelopeFrame(senderID, messageType, message, now, true, seq)
+}
+
+// setEnvelopeFields returns the protocol mode envelope message with fields
+// set, or message as it is if it is not a JSON object.
+func setEnvelopeFields(messageType int, message []byte, fields map[string]interface{}) []byte {
+	var env map[string]json.RawMessage
+	if messageType != websocket.TextMessage || json.Unmarshal(message, &env) != nil || env == nil {
+		return message
+	}
+	for name, value := range fields {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return message
+		}
+		env[name] = raw
+	}
+	flagged, err := json.Marshal(env)
+	if err != nil {
+		return message
+	}
+	return flagged
+}
+
+// replayHistoryLocked writes the history of s to cl. Holding
+// sessionManagerMu for the whole replay keeps live broadcasts from
+// interleaving with it.
+func (sm *SessionManager) replayHistoryLocked(s *session, cl *client) error {
+	sm.expireHistoryLocked(s, time.Now())
+	for _, entry := range s.history {
+		if entry.match != nil && !entry.match(cl) {
+			continue
+		}
+		if _, err := sm.writeFrameLocked(s, cl, entry.messageType, entry.message); err != nil {
+			return err
+		}
+	}
+	if cl.stream != "" {
+		return sm.replayStreamHistoryLocked(s, cl)
+	}
+	return nil
+}
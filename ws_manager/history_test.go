@@ -0,0 +1,188 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chau-t-tran/ws-to-me/ws_manager/testutil"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type HistoryTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *HistoryTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithHistorySize(3))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *HistoryTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *HistoryTestSuite) TestNewConnectionReceivesRecentHistory() {
+	existing, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	for i := 1; i <= 4; i++ {
+		assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte(fmt.Sprint(i))))
+	}
+	for i := 1; i <= 4; i++ {
+		_, err := readWithTimeout(existing, time.Second)
+		assert.NoError(suite.T(), err)
+	}
+
+	newcomer, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	for _, expected := range []string{"2", "3", "4"} {
+		message, err := readWithTimeout(newcomer, time.Second)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), expected, message)
+	}
+
+	// the replay is not sent to anyone else
+	_, err = readWithTimeout(existing, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *HistoryTestSuite) TestReplayDoesNotInterleaveWithLiveTraffic() {
+	total := 200
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= total; i++ {
+			suite.manager.Broadcast(suite.sessionKey, "", websocket.TextMessage, []byte(fmt.Sprintf(`{"seq":%d}`, i)))
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	newcomer, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	checker := testutil.NewOrderingChecker(testutil.JSONSeq("seq"))
+	go checker.Listen(newcomer)
+	<-done
+
+	assert.Eventually(suite.T(), func() bool {
+		seqs := checker.Sequences()
+		return len(seqs) > 0 && seqs[len(seqs)-1] == uint64(total)
+	}, 2*time.Second, 10*time.Millisecond)
+	checker.AssertMonotonic(suite.T())
+	checker.AssertNoGaps(suite.T())
+}
+
+func (suite *HistoryTestSuite) TestReplayedEnvelopesAreFlagged() {
+	sm := CreateSessionManager([]string{suite.sessionKey}, WithHistorySize(3), WithEnvelopeMode(true))
+	defer sm.cronScheduler.Stop()
+	e := echo.New()
+	e.GET("/:sessionKey", sm.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	existing, err := dialSession(server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(sm, suite.sessionKey, 1))
+	assert.NoError(suite.T(), sm.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("hello")))
+	live, err := readWithTimeout(existing, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.NotContains(suite.T(), live, "replayed")
+
+	newcomer, err := dialSession(server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	replayed, err := readWithTimeout(newcomer, time.Second)
+	assert.NoError(suite.T(), err)
+	var env envelope
+	assert.NoError(suite.T(), json.Unmarshal([]byte(replayed), &env))
+	assert.True(suite.T(), env.Replayed)
+	assert.Equal(suite.T(), "hello", env.Data)
+}
+
+func (suite *HistoryTestSuite) TestExpiredHistoryIsNotReplayed() {
+	sm := CreateSessionManager([]string{suite.sessionKey}, WithHistorySize(3), WithHistoryMaxAge(100*time.Millisecond))
+	defer sm.cronScheduler.Stop()
+	e := echo.New()
+	e.GET("/:sessionKey", sm.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	assert.NoError(suite.T(), sm.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("stale")))
+	time.Sleep(200 * time.Millisecond)
+	assert.NoError(suite.T(), sm.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("fresh")))
+
+	newcomer, err := dialSession(server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	message, err := readWithTimeout(newcomer, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "fresh", message)
+	_, err = readWithTimeout(newcomer, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *HistoryTestSuite) TestHistoryTTLPerTypeAndEnvelope() {
+	sm := CreateSessionManager([]string{suite.sessionKey},
+		WithHistorySize(5),
+		WithProtocolMode(true),
+		WithHistoryTTL("typing", 100*time.Millisecond),
+	)
+	defer sm.cronScheduler.Stop()
+	e := echo.New()
+	e.GET("/:sessionKey", sm.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	for _, frame := range []string{
+		`{"type":"typing","payload":"alice"}`,
+		`{"type":"chat","payload":"gone","ttl":100}`,
+		`{"type":"chat","payload":"kept"}`,
+	} {
+		assert.NoError(suite.T(), sm.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte(frame)))
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	newcomer, err := dialSession(server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer newcomer.Close()
+	message, err := readWithTimeout(newcomer, time.Second)
+	assert.NoError(suite.T(), err)
+	var env Envelope
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &env))
+	assert.Equal(suite.T(), "chat", env.Type)
+	assert.JSONEq(suite.T(), `"kept"`, string(env.Payload))
+	_, err = readWithTimeout(newcomer, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+
+	sm.sessionManagerMu.RLock()
+	defer sm.sessionManagerMu.RUnlock()
+	assert.Len(suite.T(), sm.sessions[suite.sessionKey].history, 1)
+}
+
+func (suite *HistoryTestSuite) TestHistoryDisabledByDefault() {
+	sm := CreateSessionManager([]string{suite.sessionKey})
+	defer sm.cronScheduler.Stop()
+	assert.NoError(suite.T(), sm.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("hello")))
+	assert.Empty(suite.T(), sm.sessions[suite.sessionKey].history)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestHistoryTestSuite(t *testing.T) {
+	suite.Run(t, new(HistoryTestSuite))
+}
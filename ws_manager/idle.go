@@ -0,0 +1,145 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WithIdleConnTimeout closes connections that send no message for timeout.
+// Unlike keepalive, pongs do not count, so a connection that answers pings
+// but never speaks is dropped too. The connection gets a CloseNoActivity
+// close frame and its disconnect is reported with the read timeout error.
+// Zero disables the timeout.
+func WithIdleConnTimeout(timeout time.Duration) Option {
+	return func(sm *SessionManager) {
+		sm.idleConnTimeout = timeout
+	}
+}
+
+// armReadDeadline sets the read deadline of cl to at, or to its idle
+// deadline if that comes first. A zero at means no keepalive deadline.
+// Like every read-side setting it must be called from the read loop.
+func (sm *SessionManager) armReadDeadline(cl *client, at time.Time) error {
+	if sm.idleConnTimeout > 0 && (at.IsZero() || cl.idleDeadline.Before(at)) {
+		at = cl.idleDeadline
+	}
+	return cl.conn.SetReadDeadline(at)
+}
+
+// resetIdle restarts the idle timeout of cl after an inbound message.
+func (sm *SessionManager) resetIdle(cl *client) {
+	if sm.idleConnTimeout <= 0 {
+		return
+	}
+	cl.idleDeadline = time.Now().Add(sm.idleConnTimeout)
+	sm.armReadDeadline(cl, cl.keepaliveDeadline)
+}
+
+// idleExpired reports whether cl was dropped for idling.
+func (sm *SessionManager) idleExpired(cl *client) bool {
+	return sm.idleConnTimeout > 0 && !time.Now().Before(cl.idleDeadline)
+}
+
+// WithIdleEviction closes connections with no traffic in either direction
+// for timeout: neither a message from the client nor one delivered to it.
+// Unlike WithIdleConnTimeout, a connection that only listens stays open as
+// long as its session is busy. warning before the deadline, if positive and
+// shorter than timeout, the connection is sent an envelope saying when it
+// will be closed,
+//
+//	{"type":"system.idle","sender":"","sessionKey":"abcdefgh","timestamp":1700000000000,"payload":{"closesInMs":30000}}
+//
+// and any traffic restarts the timeout. Evicted connections get a
+// CloseNoActivity close frame. Zero disables eviction.
+func WithIdleEviction(timeout time.Duration, warning time.Duration) Option {
+	return func(sm *SessionManager) {
+		sm.idleEvictTimeout = timeout
+		sm.idleEvictWarning = warning
+	}
+}
+
+type idleWarning struct {
+	ClosesInMs int64 `json:"closesInMs"`
+}
+
+// watchIdleEviction arms the idle eviction timer for cl. The returned
+// function disarms it and must be called when the connection ends.
+func (sm *SessionManager) watchIdleEviction(sessionKey string, cl *client) (stop func()) {
+	if sm.idleEvictTimeout <= 0 {
+		return func() {}
+	}
+	warning := sm.idleEvictWarning
+	if warning >= sm.idleEvictTimeout {
+		warning = 0
+	}
+	var mu sync.Mutex
+	stopped := false
+	var timer *time.Timer
+	var warnedFor time.Time
+	var check func()
+	check = func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped {
+			return
+		}
+		last := cl.lastActivity()
+		idle := time.Since(last)
+		switch {
+		case idle >= sm.idleEvictTimeout:
+			code, reason := sm.closeFrame(CloseIdle, CloseNoActivity, "idle timeout")
+			sm.disconnectClient(sessionKey, cl, code, reason)
+			return
+		case warning > 0 && idle >= sm.idleEvictTimeout-warning && !warnedFor.Equal(last):
+			warnedFor = last
+			sm.warnIdle(sessionKey, cl, sm.idleEvictTimeout-idle)
+			timer = time.AfterFunc(sm.idleEvictTimeout-idle, check)
+		case warning > 0 && idle < sm.idleEvictTimeout-warning:
+			timer = time.AfterFunc(sm.idleEvictTimeout-warning-idle, check)
+		default:
+			timer = time.AfterFunc(sm.idleEvictTimeout-idle, check)
+		}
+	}
+	mu.Lock()
+	first := sm.idleEvictTimeout
+	if warning > 0 {
+		first -= warning
+	}
+	timer = time.AfterFunc(first, check)
+	mu.Unlock()
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		stopped = true
+		timer.Stop()
+	}
+}
+
+// warnIdle tells cl it will be evicted in closesIn. The warning does not
+// count as traffic.
+func (sm *SessionManager) warnIdle(sessionKey string, cl *client, closesIn time.Duration) {
+	payload, err := json.Marshal(idleWarning{ClosesInMs: closesIn.Milliseconds()})
+	if err != nil {
+		return
+	}
+	frame, err := json.Marshal(Envelope{
+		Type:       "system.idle",
+		SessionKey: sessionKey,
+		Timestamp:  time.Now().UnixNano() / int64(time.Millisecond),
+		Payload:    payload,
+	})
+	if err != nil {
+		return
+	}
+	if err := cl.write(websocket.TextMessage, frame); err != nil {
+		sm.logger.Warn("Idle warning failed", "session", sessionKey, "client", cl.id, "err", err)
+	}
+}
+
+func (cl *client) lastActivity() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&cl.lastActive))
+}
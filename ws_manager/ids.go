@@ -0,0 +1,92 @@
+package ws_manager
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrClientIDTaken refuses a connection whose WithClientIDs ID is held by
+// another connection of the session.
+var ErrClientIDTaken = errors.New("Client ID in use")
+
+// IDGenerator issues the IDs of connections that neither resume a client
+// nor get a stable ID from WithClientIDs.
+type IDGenerator interface {
+	NewID() string
+}
+
+// IDGeneratorFunc is an IDGenerator as a function.
+type IDGeneratorFunc func() string
+
+func (f IDGeneratorFunc) NewID() string {
+	return f()
+}
+
+// WithIDGenerator issues connection IDs with g instead of the manager's
+// counter. The IDs must be unique across the sessions of the manager; with
+// a backend, across instances too, as they are not prefixed with the
+// instance ID. See UUIDv7.
+func WithIDGenerator(g IDGenerator) Option {
+	return func(sm *SessionManager) {
+		sm.idGenerator = g
+	}
+}
+
+// UUIDv7 returns an IDGenerator of version 7 UUIDs (RFC 9562), which are
+// unique across instances and sort by the time they were issued.
+func UUIDv7() IDGenerator {
+	return IDGeneratorFunc(newUUIDv7)
+}
+
+func newUUIDv7() string {
+	var u [16]byte
+	rand.Read(u[6:])
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(u[:6], ms[2:])
+	u[6] = u[6]&0x0f | 0x70
+	u[8] = u[8]&0x3f | 0x80
+	var b [36]byte
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b[:])
+}
+
+// ClientIDFunc returns the stable ID of a connection joining sessionKey as
+// identity, e.g. a user ID from the auth token, so the connection keeps its
+// ID when it reconnects or its address changes behind a proxy. It runs
+// after authentication and roles. An empty ID leaves the connection to the
+// IDGenerator, and an error refuses the dial with 403 Forbidden.
+type ClientIDFunc func(sessionKey, identity string, r *http.Request) (string, error)
+
+// WithClientIDs gives connections the IDs returned by fn, which are then
+// used wherever the connection is addressed: hooks, presence, targeted
+// sends, kick bans and logs. A dial whose ID is held by a connection of the
+// session is refused with 409 Conflict, or closed with a policy violation
+// and the reason "client ID in use" if the other connection joined during
+// the handshake, unless WithDuplicatePolicy(DuplicateCloseOlder) replaces
+// the other connection. Connections resuming a client keep its ID.
+func WithClientIDs(fn ClientIDFunc) Option {
+	return func(sm *SessionManager) {
+		sm.clientIDs = fn
+	}
+}
+
+// clientIDAvailable reports whether no connection of sessionKey holds id.
+func (sm *SessionManager) clientIDAvailable(sessionKey, id string) bool {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	return !ok || s.client(id) == nil
+}
@@ -0,0 +1,101 @@
+package ws_manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type IDsTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *IDsTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.start()
+}
+
+func (suite *IDsTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+func (suite *IDsTestSuite) start(opts ...Option) {
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, opts...)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *IDsTestSuite) TestUUIDv7() {
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	g := UUIDv7()
+	first := g.NewID()
+	time.Sleep(2 * time.Millisecond)
+	second := g.NewID()
+	assert.Regexp(suite.T(), pattern, first)
+	assert.Regexp(suite.T(), pattern, second)
+	assert.True(suite.T(), first < second)
+}
+
+func (suite *IDsTestSuite) TestIDGenerator() {
+	suite.TearDownTest()
+	suite.start(WithIDGenerator(IDGeneratorFunc(func() string { return "fixed" })))
+	_, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", nil)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "fixed", resp.Header.Get(ClientIDHeader))
+}
+
+func (suite *IDsTestSuite) TestStableClientIDs() {
+	suite.TearDownTest()
+	suite.start(
+		WithAuth(headerAuth),
+		WithClientIDs(func(sessionKey, identity string, r *http.Request) (string, error) {
+			return "user-" + identity, nil
+		}),
+	)
+	header := http.Header{}
+	header.Set("X-Identity", "alice")
+	alice, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", header)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "user-alice", resp.Header.Get(ClientIDHeader))
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	_, resp, err = dialSessionWithHeader(suite.server, suite.sessionKey, "", header)
+	assert.Error(suite.T(), err)
+	if assert.NotNil(suite.T(), resp) {
+		assert.Equal(suite.T(), http.StatusConflict, resp.StatusCode)
+	}
+
+	assert.NoError(suite.T(), suite.manager.SendToClient(suite.sessionKey, "user-alice", websocket.TextMessage, []byte("hi alice")))
+	message, err := readWithTimeout(alice, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "hi alice", message)
+
+	alice.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+	again, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", header)
+	assert.NoError(suite.T(), err)
+	defer again.Close()
+	assert.Equal(suite.T(), "user-alice", resp.Header.Get(ClientIDHeader))
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestIDsTestSuite(t *testing.T) {
+	suite.Run(t, new(IDsTestSuite))
+}
@@ -0,0 +1,39 @@
+package ws_manager
+
+import (
+	"time"
+)
+
+// BroadcastOption changes how a single Broadcast is delivered.
+type BroadcastOption func(*broadcastOptions)
+
+type broadcastOptions struct {
+	includeSender bool
+	// writeTimeout bounds each write of a BroadcastContext
+	writeTimeout time.Duration
+	// exclude holds the client IDs left out of the broadcast
+	exclude map[string]bool
+	// filter, if set, selects the connections the broadcast may reach
+	filter func(*client) bool
+}
+
+// IncludeSender makes the broadcast echo back to the sender as well, for
+// clients that render only server-confirmed messages.
+func IncludeSender() BroadcastOption {
+	return func(o *broadcastOptions) {
+		o.includeSender = true
+	}
+}
+
+// SetIncludeSender sets whether every broadcast in the session, including
+// the messages its connections relay, is echoed back to the sender.
+func (sm *SessionManager) SetIncludeSender(sessionKey string, include bool) error {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return sessionNotFound(sessionKey)
+	}
+	s.includeSender = include
+	return nil
+}
@@ -0,0 +1,85 @@
+package ws_manager
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type IncludeSenderTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *IncludeSenderTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey})
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *IncludeSenderTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *IncludeSenderTestSuite) TestBroadcastOption() {
+	sender, senderID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	recipients, errs := suite.manager.Broadcast(suite.sessionKey, senderID, websocket.TextMessage, []byte("confirmed"), IncludeSender())
+	assert.Empty(suite.T(), errs)
+	assert.Equal(suite.T(), 2, recipients)
+	for _, conn := range []*websocket.Conn{sender, receiver} {
+		message, err := readWithTimeout(conn, time.Second)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "confirmed", message)
+	}
+
+	recipients, errs = suite.manager.Broadcast(suite.sessionKey, senderID, websocket.TextMessage, []byte("plain"))
+	assert.Empty(suite.T(), errs)
+	assert.Equal(suite.T(), 1, recipients)
+	message, err := readWithTimeout(receiver, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "plain", message)
+	_, err = readWithTimeout(sender, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *IncludeSenderTestSuite) TestSessionEchoesRelayedMessages() {
+	assert.NoError(suite.T(), suite.manager.SetIncludeSender(suite.sessionKey, true))
+	assert.Error(suite.T(), suite.manager.SetIncludeSender("missing", true))
+	sender, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte("hello")))
+	for _, conn := range []*websocket.Conn{sender, receiver} {
+		message, err := readWithTimeout(conn, time.Second)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "hello", message)
+	}
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestIncludeSenderTestSuite(t *testing.T) {
+	suite.Run(t, new(IncludeSenderTestSuite))
+}
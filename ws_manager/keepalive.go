@@ -0,0 +1,86 @@
+package ws_manager
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultPingInterval = 30 * time.Second
+	defaultPongTimeout  = 10 * time.Second
+)
+
+// WithKeepalive pings every connection each pingInterval and drops it when
+// no pong arrives within pongTimeout of the ping that should have produced
+// it. Pongs also mark the session as used. A dropped connection is
+// reported to the disconnect hooks with the read timeout error. A zero
+// pingInterval disables keepalive; a non-positive pongTimeout keeps the
+// default.
+func WithKeepalive(pingInterval, pongTimeout time.Duration) Option {
+	return func(sm *SessionManager) {
+		sm.pingInterval = pingInterval
+		if pongTimeout > 0 {
+			sm.pongTimeout = pongTimeout
+		}
+	}
+}
+
+// WithMaxMissedPongs lets a connection miss up to n consecutive pongs before
+// keepalive drops it, for peers on lossy links. The connection is then
+// dropped pongTimeout after the n-th unanswered ping. The default is 1.
+func WithMaxMissedPongs(n int) Option {
+	return func(sm *SessionManager) {
+		sm.maxMissedPongs = n
+	}
+}
+
+// keepaliveGrace is how long a connection may go without a pong.
+func (sm *SessionManager) keepaliveGrace() time.Duration {
+	missed := sm.maxMissedPongs
+	if missed < 1 {
+		missed = 1
+	}
+	return time.Duration(missed)*sm.pingInterval + sm.pongTimeout
+}
+
+// startKeepalive arms the read deadline of cl and starts pinging it. When
+// the deadline passes the read loop fails, which removes cl from its session
+// and closes it. The returned function stops the pings and must be called
+// when the connection ends.
+func (sm *SessionManager) startKeepalive(sessionKey string, cl *client) (stop func()) {
+	if sm.pingInterval <= 0 {
+		return func() {}
+	}
+	grace := sm.keepaliveGrace()
+	cl.keepaliveDeadline = time.Now().Add(grace)
+	sm.armReadDeadline(cl, cl.keepaliveDeadline)
+	cl.conn.SetPongHandler(func(string) error {
+		sm.touch(sessionKey)
+		cl.keepaliveDeadline = time.Now().Add(grace)
+		return sm.armReadDeadline(cl, cl.keepaliveDeadline)
+	})
+
+	ticker := time.NewTicker(sm.pingInterval)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				deadline := time.Now().Add(sm.pongTimeout)
+				if err := cl.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+					sm.logger.Warn("Ping failed", "session", sessionKey, "client", cl.id, "err", err)
+					sm.removeClient(sessionKey, cl)
+					cl.conn.Close()
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
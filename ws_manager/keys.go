@@ -0,0 +1,128 @@
+package ws_manager
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// DefaultKeyLength and DefaultKeyAlphabet are the key format used by
+	// CreateSession unless WithKeyFormat sets another.
+	DefaultKeyLength   = 22
+	DefaultKeyAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+	// createSessionAttempts bounds how many keys CreateSession draws
+	// before giving up on finding an unused one.
+	createSessionAttempts = 10
+)
+
+// ErrNoFreeSessionKey is returned by CreateSession when every key it drew
+// was already in use.
+var ErrNoFreeSessionKey = errors.New("No unused session key found")
+
+// KeyValidator checks a session key before a connection joins or a session
+// is registered. A non-nil error rejects the key.
+type KeyValidator func(sessionKey string) error
+
+// GenerateSessionKey returns an unguessable, URL-safe session key made of
+// 128 random bits.
+func GenerateSessionKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DefaultKeyValidator accepts keys made of ASCII letters, digits, '-' and
+// '_', which covers GenerateSessionKey. Keys must also be non-empty and at
+// most 128 characters long whatever the validator.
+func DefaultKeyValidator(sessionKey string) error {
+	for i := 0; i < len(sessionKey); i++ {
+		c := sessionKey[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return errors.New(
+				fmt.Sprintf("Session key contains invalid character %q", c),
+			)
+		}
+	}
+	return nil
+}
+
+// WithKeyValidator sets the initial key validator in place of
+// DefaultKeyValidator. See SetKeyValidator.
+func WithKeyValidator(validate KeyValidator) Option {
+	return func(sm *SessionManager) {
+		sm.keyValidator = validate
+	}
+}
+
+// WithKeyFormat sets the length and alphabet of the keys made by
+// CreateSession. The defaults give 132 random bits. Invalid formats are
+// reported by CreateSession.
+func WithKeyFormat(length int, alphabet string) Option {
+	return func(sm *SessionManager) {
+		sm.keyLength = length
+		sm.keyAlphabet = alphabet
+	}
+}
+
+// CreateSession registers a session under a new cryptographically random
+// key and returns the key. Keys already in use are drawn again, and every
+// key must pass the key validator like one given to RegisterSession.
+func (sm *SessionManager) CreateSession() (key string, err error) {
+	if sm.keyLength <= 0 || sm.keyLength > maxSessionKeyLength {
+		return "", errors.New(
+			fmt.Sprintf("Session key length must be between 1 and %d", maxSessionKeyLength),
+		)
+	}
+	if len(sm.keyAlphabet) < 2 {
+		return "", errors.New("Session key alphabet needs at least 2 characters")
+	}
+	for i := 0; i < createSessionAttempts; i++ {
+		key, err = randomKey(sm.keyLength, sm.keyAlphabet)
+		if err != nil {
+			return "", err
+		}
+		if err = sm.validateKey(key); err != nil {
+			return "", err
+		}
+		sm.sessionManagerMu.Lock()
+		if sm.shutDown {
+			sm.sessionManagerMu.Unlock()
+			return "", ErrShutDown
+		}
+		if _, taken := sm.sessions[key]; !taken {
+			if !sm.claimSessionRoomLocked(key) {
+				sm.sessionManagerMu.Unlock()
+				return "", ErrSessionLimitReached
+			}
+			sm.sessions[key] = newSession(key)
+			sm.markStoredLocked(key, false)
+			sm.webhookLocked(WebhookSessionCreated, sm.sessions[key])
+			sm.sessionManagerMu.Unlock()
+			return key, nil
+		}
+		sm.sessionManagerMu.Unlock()
+	}
+	return "", fmt.Errorf("%w after %d attempts", ErrNoFreeSessionKey, createSessionAttempts)
+}
+
+// randomKey draws length characters uniformly from alphabet.
+func randomKey(length int, alphabet string) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[n.Int64()]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,126 @@
+package ws_manager
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ConnectFunc is called after a connection has joined a session.
+type ConnectFunc func(sessionKey, clientID string)
+
+// DisconnectFunc is called after a connection has left its session. err is
+// the read error that ended the connection, or nil for a clean close.
+type DisconnectFunc func(sessionKey, clientID string, err error)
+
+// MessageFunc is called for every data message a connection sends, after
+// the middlewares and before it is broadcast.
+type MessageFunc func(sessionKey, clientID string, messageType int, data []byte)
+
+// WithOnConnect calls onConnect for every connection EchoHandler adds. It
+// runs outside the manager lock and may call back into the manager.
+func WithOnConnect(onConnect ConnectFunc) Option {
+	return func(sm *SessionManager) {
+		sm.connectHooks = append(sm.connectHooks, onConnect)
+	}
+}
+
+// WithOnDisconnect calls onDisconnect for every connection EchoHandler
+// removes. It runs outside the manager lock and may call back into the
+// manager.
+func WithOnDisconnect(onDisconnect DisconnectFunc) Option {
+	return func(sm *SessionManager) {
+		sm.disconnectHooks = append(sm.disconnectHooks, onDisconnect)
+	}
+}
+
+// OnConnect registers fn as WithOnConnect does, on a running manager.
+// Hooks run in the order they were registered; a hook that panics is
+// logged and does not affect the connection or the other hooks.
+func (sm *SessionManager) OnConnect(fn ConnectFunc) {
+	sm.policyMu.Lock()
+	defer sm.policyMu.Unlock()
+	sm.connectHooks = append(sm.connectHooks, fn)
+}
+
+// OnDisconnect registers fn as WithOnDisconnect does, on a running manager.
+func (sm *SessionManager) OnDisconnect(fn DisconnectFunc) {
+	sm.policyMu.Lock()
+	defer sm.policyMu.Unlock()
+	sm.disconnectHooks = append(sm.disconnectHooks, fn)
+}
+
+// OnMessage registers fn to be called from the connection's read loop for
+// every data message that is about to be broadcast. Control messages and
+// messages dropped by rate limiting, deduplication or a middleware are not
+// passed to it. It runs outside the manager lock, and the connection reads
+// nothing else until it returns.
+func (sm *SessionManager) OnMessage(fn MessageFunc) {
+	sm.policyMu.Lock()
+	defer sm.policyMu.Unlock()
+	sm.messageHooks = append(sm.messageHooks, fn)
+}
+
+// runHook calls fn, logging rather than propagating a panic.
+func (sm *SessionManager) runHook(hook, sessionKey string, cl *client, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			sm.logger.Error("Hook panicked", "hook", hook, "session", sessionKey, "client", cl.id, "panic", r)
+		}
+	}()
+	fn()
+}
+
+func (sm *SessionManager) connected(sessionKey string, cl *client) {
+	sm.policyMu.RLock()
+	hooks := sm.connectHooks
+	sm.policyMu.RUnlock()
+	for _, hook := range hooks {
+		sm.runHook("connect", sessionKey, cl, func() {
+			hook(sessionKey, cl.id)
+		})
+	}
+}
+
+// disconnected removes cl from its session, keeping it resumable, closes
+// its connection and reports why and how it left.
+func (sm *SessionManager) disconnected(sessionKey string, cl *client, err error) {
+	cl.recordClose(closeInfoOf(err))
+	sm.lockSession(sessionKey)
+	if s, ok := sm.sessions[sessionKey]; ok {
+		sm.removeClientLocked(s, cl)
+		sm.parkLocked(s, cl)
+		sm.forgetSeenLocked(s, cl)
+	}
+	if cl.dropErr != nil {
+		err = cl.dropErr
+	}
+	sm.unlockSession(sessionKey)
+	cl.conn.Close()
+	close(cl.left)
+	sm.auditLeave(sessionKey, cl)
+	sm.policyMu.RLock()
+	hooks := sm.disconnectHooks
+	sm.policyMu.RUnlock()
+	if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		err = nil
+	}
+	for _, hook := range hooks {
+		sm.runHook("disconnect", sessionKey, cl, func() {
+			hook(sessionKey, cl.id, err)
+		})
+	}
+	sm.runCloseHooks(sessionKey, cl)
+}
+
+func (sm *SessionManager) received(sessionKey string, cl *client, messageType int, message []byte) {
+	sm.publishMessage(Message{SessionKey: sessionKey, SenderID: cl.id, MessageType: messageType, Data: message, At: time.Now(), Inbound: true})
+	sm.policyMu.RLock()
+	hooks := sm.messageHooks
+	sm.policyMu.RUnlock()
+	for _, hook := range hooks {
+		sm.runHook("message", sessionKey, cl, func() {
+			hook(sessionKey, cl.id, messageType, message)
+		})
+	}
+}
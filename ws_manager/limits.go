@@ -0,0 +1,313 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrClientLimitReached refuses a connection to a session at its
+// WithMaxConnectionsPerSession cap.
+var ErrClientLimitReached = errors.New("Session is full")
+
+// ErrSessionLimitReached is returned for new sessions at the
+// WithMaxSessions cap.
+var ErrSessionLimitReached = errors.New("Too many sessions")
+
+// ErrConnectionLimitReached refuses a connection at the
+// WithMaxTotalConnections cap.
+var ErrConnectionLimitReached = errors.New("Too many connections")
+
+// CloseSessionFull is the close code sent to a connection refused by
+// WithMaxClientsPerSession.
+const CloseSessionFull = 4008
+
+// WithMaxConnectionsPerSession caps how many connections a session holds at
+// once. Dials into a full session are refused with HTTP 503, or with a
+// policy violation close frame if the session filled up during the
+// handshake, and counted in SessionStats.RejectedConnections. Zero means
+// unlimited.
+func WithMaxConnectionsPerSession(n int) Option {
+	return func(sm *SessionManager) {
+		sm.maxConnectionsPerSession = n
+	}
+}
+
+// WithMaxClientsPerSession is WithMaxConnectionsPerSession, except that
+// dials into a full session are upgraded and then closed with
+// CloseSessionFull and the reason "session is full", without joining it.
+// Browser clients cannot see the HTTP status of a refused handshake, so
+// this tells them why they were turned away.
+func WithMaxClientsPerSession(n int) Option {
+	return func(sm *SessionManager) {
+		sm.maxConnectionsPerSession = n
+		sm.closeWhenFull = true
+	}
+}
+
+// WithMaxSessions caps how many sessions the manager holds at once. At the
+// cap RegisterSession and CreateSession fail, and dials that would
+// auto-register a session with WithAutoRegister are refused with HTTP 503,
+// unless WithLimitPolicy makes room instead. Sessions restored from a
+// SessionStore are always loaded. Zero means unlimited.
+func WithMaxSessions(n int) Option {
+	return func(sm *SessionManager) {
+		sm.maxSessions = n
+	}
+}
+
+// WithMaxTotalConnections caps how many connections the manager holds at
+// once across all sessions, for hard resource ceilings on small hosts. At
+// the cap dials are refused with HTTP 503, or closed with
+// CloseTryAgainLater and the reason "too many connections" if the cap was
+// reached during the handshake, unless WithLimitPolicy makes room instead.
+// Zero means unlimited.
+func WithMaxTotalConnections(n int) Option {
+	return func(sm *SessionManager) {
+		sm.maxTotalConnections = n
+	}
+}
+
+// LimitPolicy decides what happens when WithMaxSessions or
+// WithMaxTotalConnections is reached.
+type LimitPolicy int
+
+const (
+	// LimitReject refuses the new session or connection.
+	LimitReject LimitPolicy = iota
+	// LimitEvictLRU makes room for it: the session used least recently is
+	// evicted, its connections closed with the reason "too many sessions",
+	// or the connection quiet the longest is closed with
+	// CloseTryAgainLater and the reason "too many connections".
+	LimitEvictLRU
+)
+
+// WithLimitPolicy sets how WithMaxSessions and WithMaxTotalConnections are
+// enforced, LimitReject by default.
+func WithLimitPolicy(policy LimitPolicy) Option {
+	return func(sm *SessionManager) {
+		sm.limitPolicy = policy
+	}
+}
+
+// Limit names a cap in a LimitEvent.
+type Limit string
+
+const (
+	LimitSessions    Limit = "sessions"
+	LimitConnections Limit = "connections"
+)
+
+// LimitEvent reports that a cap was hit.
+type LimitEvent struct {
+	Limit Limit
+	// SessionKey is the session the new session or connection was for.
+	SessionKey string
+	// Evicted is the session key or client ID removed to make room, empty
+	// if the new one was refused.
+	Evicted string
+}
+
+// LimitFunc is called whenever WithMaxSessions or WithMaxTotalConnections
+// is hit.
+type LimitFunc func(event LimitEvent)
+
+// WithOnLimit calls onLimit whenever a cap is hit, besides counting it in
+// Metrics. It runs under the manager lock and must not call back into the
+// manager.
+func WithOnLimit(onLimit LimitFunc) Option {
+	return func(sm *SessionManager) {
+		sm.onLimit = onLimit
+	}
+}
+
+// roomForSessionLocked reports whether another session may be created,
+// possibly by evicting one. The caller must hold sessionManagerMu.
+func (sm *SessionManager) roomForSessionLocked() bool {
+	return sm.maxSessions <= 0 || len(sm.sessions) < sm.maxSessions ||
+		(sm.limitPolicy == LimitEvictLRU && len(sm.sessions) > 0)
+}
+
+// claimSessionRoomLocked makes room for the new session sessionKey,
+// evicting the least recently used session under LimitEvictLRU, and
+// reports whether it may be created. The caller must hold
+// sessionManagerMu.
+func (sm *SessionManager) claimSessionRoomLocked(sessionKey string) bool {
+	if sm.maxSessions <= 0 || len(sm.sessions) < sm.maxSessions {
+		return true
+	}
+	var lru *session
+	if sm.limitPolicy == LimitEvictLRU {
+		for _, s := range sm.sessions {
+			if lru == nil || s.lastUsed.Before(lru.lastUsed) {
+				lru = s
+			}
+		}
+	}
+	if lru == nil {
+		sm.limitHitLocked(LimitSessions, sessionKey, "")
+		return false
+	}
+	sm.logger.Info("Evicting session to make room", "session", lru.key, "connections", len(lru.clients))
+	sm.evictLocked(lru, websocket.CloseNormalClosure, "too many sessions")
+	sm.limitHitLocked(LimitSessions, sessionKey, lru.key)
+	return true
+}
+
+// claimConnectionRoomLocked makes room for a new connection to sessionKey,
+// closing the connection quiet the longest under LimitEvictLRU, and
+// reports whether it may join. The caller must hold sessionManagerMu.
+func (sm *SessionManager) claimConnectionRoomLocked(sessionKey string) bool {
+	if sm.maxTotalConnections <= 0 || sm.openConnectionsLocked() < sm.maxTotalConnections {
+		return true
+	}
+	var lru *client
+	var lruSession *session
+	if sm.limitPolicy == LimitEvictLRU {
+		for _, s := range sm.sessions {
+			for _, cl := range s.clients {
+				if lru == nil || cl.lastActivity().Before(lru.lastActivity()) {
+					lru, lruSession = cl, s
+				}
+			}
+		}
+	}
+	if lru == nil {
+		sm.limitHitLocked(LimitConnections, sessionKey, "")
+		return false
+	}
+	sm.logger.Info("Closing connection to make room", "session", lruSession.key, "client", lru.id)
+	sm.disconnectClientLocked(lruSession, lru, websocket.CloseTryAgainLater, "too many connections")
+	sm.limitHitLocked(LimitConnections, sessionKey, lru.id)
+	return true
+}
+
+// openConnectionsLocked returns how many connections the manager holds.
+// The caller must hold statsMu.
+func (sm *SessionManager) openConnectionsLocked() int {
+	return int(sm.metrics.Connects - sm.metrics.Disconnects)
+}
+
+// limitHitLocked counts a hit of limit and reports it to WithOnLimit. The
+// caller must hold sessionManagerMu.
+func (sm *SessionManager) limitHitLocked(limit Limit, sessionKey, evicted string) {
+	sm.statsMu.Lock()
+	switch limit {
+	case LimitSessions:
+		sm.metrics.SessionLimitHits++
+	case LimitConnections:
+		sm.metrics.ConnectionLimitHits++
+	}
+	sm.statsMu.Unlock()
+	sm.logger.Warn("Limit reached", "limit", string(limit), "session", sessionKey, "evicted", evicted)
+	if sm.onLimit != nil {
+		sm.onLimit(LimitEvent{Limit: limit, SessionKey: sessionKey, Evicted: evicted})
+	}
+}
+
+// refuseAtLimit reports whether a dial to sessionKey should be refused
+// before the upgrade because a cap is reached under LimitReject, and counts
+// the hit if so.
+func (sm *SessionManager) refuseAtLimit(sessionKey string) error {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	if sm.limitPolicy != LimitReject {
+		return nil
+	}
+	if _, ok := sm.sessions[sessionKey]; !ok && sm.autoRegister && !sm.roomForSessionLocked() {
+		sm.limitHitLocked(LimitSessions, sessionKey, "")
+		return ErrSessionLimitReached
+	}
+	if sm.maxTotalConnections > 0 && sm.openConnectionsLocked() >= sm.maxTotalConnections {
+		sm.limitHitLocked(LimitConnections, sessionKey, "")
+		return ErrConnectionLimitReached
+	}
+	return nil
+}
+
+func (s *session) isFull(max int) bool {
+	return max > 0 && len(s.clients) >= max
+}
+
+// admit reports whether the session has room for another connection and
+// counts a rejection if it does not.
+func (sm *SessionManager) admit(sessionKey string) bool {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok || !s.isFull(sm.maxClientsLocked(s)) {
+		return true
+	}
+	s.rejected++
+	return false
+}
+
+// WithMaxMessageSize limits inbound messages to limit bytes. A connection
+// that sends a larger message is closed with a message-too-big close frame
+// and removed from its session; the message is never broadcast, and at most
+// limit+1 bytes of it are read. In envelope and protocol mode the close
+// frame is preceded by an error envelope:
+//
+//	{"type":"error","sender":"","sessionKey":"abcdefgh","timestamp":1700000000000,"payload":{"error":"message too big","limit":1024}}
+//
+// The disconnect is reported with websocket.ErrReadLimit. Zero means no
+// limit.
+func WithMaxMessageSize(limit int64) Option {
+	return func(sm *SessionManager) {
+		sm.maxMessageSize = limit
+	}
+}
+
+type messageTooBigError struct {
+	Error string `json:"error"`
+	Limit int64  `json:"limit"`
+}
+
+// readMessage reads the next message of cl within the inbound size limit,
+// failing with websocket.ErrReadLimit for larger messages.
+func (sm *SessionManager) readMessage(cl *client) (int, []byte, error) {
+	if sm.maxMessageSize <= 0 {
+		return cl.conn.ReadMessage()
+	}
+	messageType, r, err := cl.conn.NextReader()
+	if err != nil {
+		return messageType, nil, err
+	}
+	message, err := io.ReadAll(io.LimitReader(r, sm.maxMessageSize+1))
+	if err != nil {
+		return messageType, nil, err
+	}
+	if int64(len(message)) > sm.maxMessageSize {
+		return messageType, nil, websocket.ErrReadLimit
+	}
+	return messageType, message, nil
+}
+
+// rejectOversized closes cl after it sent a message over the size limit,
+// telling it why first in envelope and protocol mode.
+func (sm *SessionManager) rejectOversized(sessionKey string, cl *client) {
+	sm.logger.Info("Message too big", "session", sessionKey, "client", cl.id, "limit", sm.maxMessageSize)
+	if sm.envelopeMode || sm.protocolMode {
+		payload, _ := json.Marshal(messageTooBigError{Error: "message too big", Limit: sm.maxMessageSize})
+		frame, err := json.Marshal(Envelope{
+			Type:       "error",
+			SessionKey: sessionKey,
+			Timestamp:  time.Now().UnixNano() / int64(time.Millisecond),
+			Payload:    payload,
+		})
+		if err == nil {
+			// written directly so a send queue cannot hold it back past
+			// the close
+			cl.writeMu.Lock()
+			err = cl.writeFrame(websocket.TextMessage, frame)
+			cl.writeMu.Unlock()
+		}
+		if err != nil {
+			sm.logger.Debug("Size limit notice failed", "session", sessionKey, "client", cl.id, "err", err)
+		}
+	}
+	sm.closeClient(cl, websocket.CloseMessageTooBig, "message too big")
+}
@@ -0,0 +1,114 @@
+package ws_manager
+
+import "log"
+
+// Logger receives the manager's diagnostics: refused and failed
+// connections, write errors and evictions. Each call carries a message and
+// alternating key/value pairs, e.g.
+//
+//	logger.Warn("Ping failed", "session", sessionKey, "client", clientID, "err", err)
+//
+// so adapters for zap, logrus and similar structured loggers stay thin. A
+// *slog.Logger has this method set and can be passed as is; the zapadapter
+// and zerologadapter packages wrap zap and zerolog.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// WithLogger routes the manager's diagnostics to logger instead of the
+// standard log package. Pass NopLogger() to silence them.
+func WithLogger(logger Logger) Option {
+	return func(sm *SessionManager) {
+		sm.logger = logger
+	}
+}
+
+// LogLevel is the least severe level of diagnostics a manager logs.
+type LogLevel int
+
+const (
+	// LogDebug logs everything, including connections joining and leaving
+	// sessions and collection runs.
+	LogDebug LogLevel = iota - 1
+	// LogInfo logs registrations, evictions, refused connections and
+	// everything more severe. It is the default.
+	LogInfo
+	LogWarn
+	LogError
+)
+
+// WithLogLevel drops the diagnostics below level before they reach the
+// logger, whichever WithLogger sets, so managers sharing a logger can log at
+// different levels.
+func WithLogLevel(level LogLevel) Option {
+	return func(sm *SessionManager) {
+		sm.logLevel = level
+	}
+}
+
+// leveledLogger passes the calls at or above level on to logger.
+type leveledLogger struct {
+	logger Logger
+	level  LogLevel
+}
+
+func (l leveledLogger) Debug(msg string, keysAndValues ...interface{}) {
+	if l.level <= LogDebug {
+		l.logger.Debug(msg, keysAndValues...)
+	}
+}
+
+func (l leveledLogger) Info(msg string, keysAndValues ...interface{}) {
+	if l.level <= LogInfo {
+		l.logger.Info(msg, keysAndValues...)
+	}
+}
+
+func (l leveledLogger) Warn(msg string, keysAndValues ...interface{}) {
+	if l.level <= LogWarn {
+		l.logger.Warn(msg, keysAndValues...)
+	}
+}
+
+func (l leveledLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.logger.Error(msg, keysAndValues...)
+}
+
+// NopLogger returns a Logger that discards everything.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// stdLogger is the default Logger, writing to the standard log package.
+type stdLogger struct{}
+
+func (stdLogger) Debug(msg string, keysAndValues ...interface{}) {
+	stdPrint("DEBUG", msg, keysAndValues)
+}
+
+func (stdLogger) Info(msg string, keysAndValues ...interface{}) {
+	stdPrint("INFO", msg, keysAndValues)
+}
+
+func (stdLogger) Warn(msg string, keysAndValues ...interface{}) {
+	stdPrint("WARN", msg, keysAndValues)
+}
+
+func (stdLogger) Error(msg string, keysAndValues ...interface{}) {
+	stdPrint("ERROR", msg, keysAndValues)
+}
+
+func stdPrint(level, msg string, keysAndValues []interface{}) {
+	args := append([]interface{}{level, msg}, keysAndValues...)
+	log.Println(args...)
+}
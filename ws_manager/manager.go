@@ -0,0 +1,20 @@
+package ws_manager
+
+// Manager is the part of SessionManager that application code usually
+// drives: managing sessions, broadcasting and addressing connections.
+// Depend on it instead of *SessionManager to swap in testutil.FakeManager
+// in unit tests.
+type Manager interface {
+	RegisterSession(sessionKey string) error
+	CreateSession() (key string, err error)
+	RemoveSession(sessionKey string) error
+	ListSessions() []string
+	ActiveConnections(sessionKey string) (int, error)
+	BroadcastMessage(sessionKey string, senderID string, messageType int, message []byte) error
+	SendToClient(sessionKey string, clientID string, messageType int, data []byte) error
+	KickClient(sessionKey, clientID, reason string) error
+	SetSessionMetadata(sessionKey string, md map[string]interface{}) error
+	GetSessionMetadata(sessionKey string) (map[string]interface{}, error)
+}
+
+var _ Manager = (*SessionManager)(nil)
@@ -0,0 +1,65 @@
+package ws_manager
+
+import (
+	"net/http"
+)
+
+// ClientMetadataFunc returns the application metadata attached to a
+// connection joining sessionKey, e.g. a username or avatar taken from the
+// upgrade request. It runs after authentication.
+type ClientMetadataFunc func(r *http.Request, sessionKey string) map[string]interface{}
+
+// WithClientMetadata sets how connections get their metadata at join time.
+// The metadata is reported in ClientInfo.Metadata.
+func WithClientMetadata(fn ClientMetadataFunc) Option {
+	return func(sm *SessionManager) {
+		sm.clientMetadata = fn
+	}
+}
+
+// SetSessionMetadata replaces the application metadata attached to the
+// session. md is copied, so later changes by the caller are not seen by the
+// manager. The metadata goes away with the session.
+func (sm *SessionManager) SetSessionMetadata(sessionKey string, md map[string]interface{}) error {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return sessionNotFound(sessionKey)
+	}
+	s.metadata = copyMetadata(md)
+	sm.markStoredLocked(sessionKey, false)
+	return nil
+}
+
+// GetSessionMetadata returns a copy of the session's metadata, empty if none
+// was set.
+func (sm *SessionManager) GetSessionMetadata(sessionKey string) (map[string]interface{}, error) {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return nil, sessionNotFound(sessionKey)
+	}
+	return copyMetadata(s.metadata), nil
+}
+
+// SetClientMetadata replaces the metadata of a connection. md is copied.
+func (sm *SessionManager) SetClientMetadata(sessionKey string, clientID string, md map[string]interface{}) error {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	cl, err := sm.findClient(sessionKey, clientID)
+	if err != nil {
+		return err
+	}
+	cl.metadata = copyMetadata(md)
+	return nil
+}
+
+func copyMetadata(md map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(md))
+	for k, v := range md {
+		copied[k] = v
+	}
+	return copied
+}
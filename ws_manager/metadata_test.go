@@ -0,0 +1,132 @@
+package ws_manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type MetadataTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *MetadataTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey})
+}
+
+func (suite *MetadataTestSuite) TearDownTest() {
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *MetadataTestSuite) TestSetAndGetAreCopies() {
+	md := map[string]interface{}{"owner": "u-42", "beta": true}
+	assert.NoError(suite.T(), suite.manager.SetSessionMetadata(suite.sessionKey, md))
+	md["owner"] = "someone else"
+
+	got, err := suite.manager.GetSessionMetadata(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), map[string]interface{}{"owner": "u-42", "beta": true}, got)
+
+	got["beta"] = false
+	again, err := suite.manager.GetSessionMetadata(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), true, again["beta"])
+}
+
+func (suite *MetadataTestSuite) TestClearedWhenSessionRemoved() {
+	assert.NoError(suite.T(), suite.manager.SetSessionMetadata(suite.sessionKey, map[string]interface{}{"owner": "u-42"}))
+	assert.NoError(suite.T(), suite.manager.RemoveSession(suite.sessionKey))
+	assert.NoError(suite.T(), suite.manager.RegisterSession(suite.sessionKey))
+
+	got, err := suite.manager.GetSessionMetadata(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), got)
+}
+
+func (suite *MetadataTestSuite) TestUnknownSession() {
+	err := suite.manager.SetSessionMetadata("missing", map[string]interface{}{})
+	assert.EqualError(suite.T(), err, "Session missing not found")
+	_, err = suite.manager.GetSessionMetadata("missing")
+	assert.EqualError(suite.T(), err, "Session missing not found")
+}
+
+func (suite *MetadataTestSuite) TestListClientsReportsJoinMetadata() {
+	suite.manager.cronScheduler.Stop()
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithClientMetadata(func(r *http.Request, sessionKey string) map[string]interface{} {
+		return map[string]interface{}{"avatar": r.Header.Get("X-Avatar")}
+	}))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	header := http.Header{}
+	header.Set("X-Avatar", "cat.png")
+	conn, resp, err := dialSessionWithHeader(server, suite.sessionKey, "name=alice", header)
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	clientID := resp.Header.Get(ClientIDHeader)
+
+	clients, err := suite.manager.ListClients(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	if assert.Len(suite.T(), clients, 1) {
+		assert.Equal(suite.T(), clientID, clients[0].ID)
+		assert.Equal(suite.T(), "alice", clients[0].Name)
+		assert.Equal(suite.T(), RoleParticipant, clients[0].Role)
+		assert.Equal(suite.T(), map[string]interface{}{"avatar": "cat.png"}, clients[0].Metadata)
+		assert.NotEmpty(suite.T(), clients[0].RemoteAddr)
+		assert.False(suite.T(), clients[0].JoinedAt.IsZero())
+	}
+
+	assert.NoError(suite.T(), suite.manager.SetClientMetadata(suite.sessionKey, clientID, map[string]interface{}{"status": "away"}))
+	clients, err = suite.manager.ListClients(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), map[string]interface{}{"status": "away"}, clients[0].Metadata)
+	assert.Error(suite.T(), suite.manager.SetClientMetadata(suite.sessionKey, "missing", nil))
+}
+
+func (suite *MetadataTestSuite) TestListSessionsByTagAndMetadata() {
+	for _, key := range []string{"roomone", "roomtwo", "roomthree"} {
+		assert.NoError(suite.T(), suite.manager.RegisterSession(key))
+	}
+	assert.NoError(suite.T(), suite.manager.SetSessionTags("roomone", "chat", "tenant-a"))
+	assert.NoError(suite.T(), suite.manager.SetSessionTags("roomtwo", "chat", "tenant-b"))
+	assert.NoError(suite.T(), suite.manager.SetSessionTags("roomthree", "board", "tenant-a"))
+	assert.NoError(suite.T(), suite.manager.SetSessionMetadata("roomtwo", map[string]interface{}{"owner": "u-42"}))
+
+	assert.Equal(suite.T(), []string{"roomone", "roomtwo"}, suite.manager.ListSessionsByTag("chat"))
+	assert.Equal(suite.T(), []string{"roomthree"}, suite.manager.ListSessionsByTag("tenant-a", "board"))
+	assert.Empty(suite.T(), suite.manager.ListSessionsByTag("missing"))
+	assert.Equal(suite.T(), []string{"roomtwo"}, suite.manager.ListSessionsByMetadata("owner", "u-42"))
+
+	tags, err := suite.manager.GetSessionTags("roomone")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"chat", "tenant-a"}, tags)
+	stats, err := suite.manager.GetSessionStats("roomone")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), tags, stats.Tags)
+
+	assert.NoError(suite.T(), suite.manager.SetSessionTags("roomone"))
+	tags, err = suite.manager.GetSessionTags("roomone")
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), tags)
+	assert.EqualError(suite.T(), suite.manager.SetSessionTags("missing", "chat"), "Session missing not found")
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestMetadataTestSuite(t *testing.T) {
+	suite.Run(t, new(MetadataTestSuite))
+}
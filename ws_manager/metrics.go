@@ -0,0 +1,122 @@
+package ws_manager
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// broadcastLatencyBuckets are the upper bounds, in seconds, of the broadcast
+// latency histogram.
+var broadcastLatencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+
+// Metrics is a point-in-time snapshot of manager-wide counters.
+type Metrics struct {
+	Broadcasts        uint64
+	BytesRelayed      uint64
+	Evictions         uint64
+	DroppedMessages   uint64
+	VetoedBroadcasts  uint64
+	DuplicateMessages uint64
+	// RateLimitedMessages counts inbound messages dropped by WithRateLimit.
+	RateLimitedMessages uint64
+	// Connects and Disconnects count connections joining and leaving
+	// sessions; their difference is the number of open connections.
+	Connects    uint64
+	Disconnects uint64
+	// WriteFailures counts connections dropped after a failed write.
+	WriteFailures uint64
+	// MessagesReceived and BytesReceived count inbound data messages and
+	// their payload bytes.
+	MessagesReceived uint64
+	BytesReceived    uint64
+	// UnknownSessionDials counts dials refused because their session is
+	// not registered.
+	UnknownSessionDials uint64
+	// SessionLimitHits and ConnectionLimitHits count how often
+	// WithMaxSessions and WithMaxTotalConnections were hit, whether the new
+	// session or connection was refused or room was made for it.
+	SessionLimitHits    uint64
+	ConnectionLimitHits uint64
+	// SlowConsumers counts the times a connection became a slow consumer
+	// under WithSlowConsumer, and SlowConsumerDisconnects those of them
+	// closed by SlowConsumerDisconnect.
+	SlowConsumers           uint64
+	SlowConsumerDisconnects uint64
+}
+
+func (sm *SessionManager) Metrics() Metrics {
+	sm.statsMu.Lock()
+	defer sm.statsMu.Unlock()
+	return sm.metricsLocked()
+}
+
+// metricsLocked returns a snapshot of the manager-wide counters. The caller
+// must hold statsMu.
+func (sm *SessionManager) metricsLocked() Metrics {
+	metrics := sm.metrics
+	metrics.SlowConsumers = atomic.LoadUint64(&sm.slowConsumers)
+	metrics.SlowConsumerDisconnects = atomic.LoadUint64(&sm.slowConsumerDisconnects)
+	return metrics
+}
+
+// latencyHistogram counts observations into broadcastLatencyBuckets. The
+// counts are not cumulative; the last one is for observations above every
+// bound.
+type latencyHistogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(broadcastLatencyBuckets)+1)
+	}
+	seconds := d.Seconds()
+	i := 0
+	for i < len(broadcastLatencyBuckets) && seconds > broadcastLatencyBuckets[i] {
+		i++
+	}
+	h.counts[i]++
+	h.sum += seconds
+	h.count++
+}
+
+func (h latencyHistogram) snapshot() latencyHistogram {
+	h.counts = append([]uint64{}, h.counts...)
+	if len(h.counts) == 0 {
+		h.counts = make([]uint64, len(broadcastLatencyBuckets)+1)
+	}
+	return h
+}
+
+// observeBroadcastLocked records how long a broadcast that started at start
+// took to write. The caller must hold sessionManagerMu.
+func (sm *SessionManager) observeBroadcastLocked(start time.Time) {
+	sm.statsMu.Lock()
+	defer sm.statsMu.Unlock()
+	sm.broadcastLatency.observe(time.Since(start))
+}
+
+// countVeto counts a broadcast vetoed by a pre-broadcast hook.
+func (sm *SessionManager) countVeto() {
+	sm.statsMu.Lock()
+	defer sm.statsMu.Unlock()
+	sm.metrics.VetoedBroadcasts++
+}
+
+// countInbound adds an inbound data message of n bytes to the metrics and
+// to the stats of its session.
+func (sm *SessionManager) countInbound(sessionKey string, n int) {
+	sm.statsMu.Lock()
+	sm.metrics.MessagesReceived++
+	sm.metrics.BytesReceived += uint64(n)
+	sm.lastActivity = time.Now()
+	sm.statsMu.Unlock()
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	if s, ok := sm.sessions[sessionKey]; ok {
+		s.received++
+		s.receivedBytes += uint64(n)
+	}
+}
@@ -0,0 +1,92 @@
+package ws_manager
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrCloseConnection, returned by a MessageMiddleware (possibly wrapped),
+// drops the message and closes the sender's connection with
+// ClosePolicyViolation.
+var ErrCloseConnection = errors.New("Close connection")
+
+// MessageContext describes an inbound message on its way to the sender's
+// session. Middlewares may rewrite MessageType and Payload, and narrow who
+// receives it with Recipients.
+type MessageContext struct {
+	SessionKey  string
+	SenderID    string
+	MessageType int
+	Payload     []byte
+	// Recipients, when non-nil, redirects the message to just these client
+	// IDs of the session instead of everyone, e.g. to bounce an invalid
+	// operation back for correction. The sender's topic still applies, and
+	// redirected messages are not published to other instances.
+	Recipients []string
+	// Context carries the trace of the message, see WithTracer.
+	Context context.Context
+}
+
+// MessageMiddleware inspects or rewrites an inbound message before it is
+// broadcast. A non-nil error drops the message.
+type MessageMiddleware func(ctx *MessageContext) error
+
+// Use appends mw to the middlewares run on every inbound data message that
+// is about to be broadcast. Middlewares run in the order they were added,
+// each seeing the changes of the ones before it, and the first error stops
+// the chain. Control messages are not passed through them. Use may be
+// called while connections are open; it applies from their next message.
+func (sm *SessionManager) Use(mw MessageMiddleware) {
+	sm.policyMu.Lock()
+	defer sm.policyMu.Unlock()
+	sm.middlewares = append(sm.middlewares, mw)
+}
+
+// runMiddlewares passes a message from cl through the middleware chain and
+// returns the message to broadcast, with the recipients it was redirected
+// to, if any.
+func (sm *SessionManager) runMiddlewares(sessionKey string, cl *client, messageType int, message []byte) (int, []byte, []string, error) {
+	sm.policyMu.RLock()
+	middlewares := sm.middlewares
+	sm.policyMu.RUnlock()
+	if len(middlewares) == 0 {
+		return messageType, message, nil, nil
+	}
+	ctx := &MessageContext{
+		SessionKey:  sessionKey,
+		SenderID:    cl.id,
+		MessageType: messageType,
+		Payload:     message,
+		Context:     cl.context(),
+	}
+	for _, mw := range middlewares {
+		if err := mw(ctx); err != nil {
+			return 0, nil, nil, err
+		}
+	}
+	return ctx.MessageType, ctx.Payload, ctx.Recipients, nil
+}
+
+// redirect broadcasts a message from cl to the connections with the given
+// client IDs only, within cl's topic if it has one. The sender receives it
+// too if it is listed. Failed writes have dropped their connections and are
+// only logged.
+func (sm *SessionManager) redirect(sessionKey string, cl *client, messageType int, message []byte, recipients []string) error {
+	ids := map[string]bool{}
+	for _, id := range recipients {
+		ids[id] = true
+	}
+	_, errs, _, sent := sm.broadcastAll(sessionKey, cl.id, messageType, message, broadcastOptions{
+		includeSender: ids[cl.id],
+		filter: func(r *client) bool {
+			return ids[r.id] && (cl.topic == "" || r.topic == "" || r.topic == cl.topic)
+		},
+	})
+	if len(errs) > 0 && !sent {
+		return errs[0]
+	}
+	if len(errs) > 0 {
+		sm.logger.Debug("Broadcast dropped connections", "session", sessionKey, "client", cl.id, "errs", errs)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package ws_manager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type MiddlewareTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *MiddlewareTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey})
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *MiddlewareTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *MiddlewareTestSuite) TestMiddlewaresRewriteInOrder() {
+	suite.manager.Use(func(ctx *MessageContext) error {
+		ctx.Payload = bytes.ReplaceAll(ctx.Payload, []byte("hunter2"), []byte("*******"))
+		return nil
+	})
+	suite.manager.Use(func(ctx *MessageContext) error {
+		ctx.Payload = []byte(fmt.Sprintf("%s: %s", ctx.SenderID, ctx.Payload))
+		return nil
+	})
+
+	sender, senderID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	sender.WriteMessage(websocket.TextMessage, []byte("my password is hunter2"))
+	message, err := readWithTimeout(receiver, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), senderID+": my password is *******", message)
+}
+
+func (suite *MiddlewareTestSuite) TestErrorsDropMessagesOrConnections() {
+	suite.manager.Use(func(ctx *MessageContext) error {
+		switch string(ctx.Payload) {
+		case "malformed":
+			return errors.New("malformed payload")
+		case "abusive":
+			return fmt.Errorf("abuse: %w", ErrCloseConnection)
+		}
+		return nil
+	})
+
+	sender, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	sender.WriteMessage(websocket.TextMessage, []byte("malformed"))
+	sender.WriteMessage(websocket.TextMessage, []byte("fine"))
+	message, err := readWithTimeout(receiver, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "fine", message)
+
+	sender.WriteMessage(websocket.TextMessage, []byte("abusive"))
+	_, err = readWithTimeout(sender, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.ClosePolicyViolation))
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	_, err = readWithTimeout(receiver, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *MiddlewareTestSuite) TestRecipientsRedirectMessages() {
+	sender, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	target, targetID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	bystander, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 3))
+	suite.manager.Use(func(ctx *MessageContext) error {
+		switch string(ctx.Payload) {
+		case "whisper":
+			ctx.Recipients = []string{targetID}
+		case "invalid op":
+			ctx.Payload = []byte("rejected: invalid op")
+			ctx.Recipients = []string{ctx.SenderID}
+		}
+		return nil
+	})
+
+	sender.WriteMessage(websocket.TextMessage, []byte("whisper"))
+	message, err := readWithTimeout(target, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "whisper", message)
+
+	sender.WriteMessage(websocket.TextMessage, []byte("invalid op"))
+	message, err = readWithTimeout(sender, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "rejected: invalid op", message)
+
+	_, err = readWithTimeout(bystander, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+	_, err = readWithTimeout(target, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestMiddlewareTestSuite(t *testing.T) {
+	suite.Run(t, new(MiddlewareTestSuite))
+}
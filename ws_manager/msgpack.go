@@ -0,0 +1,325 @@
+package ws_manager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/gorilla/websocket"
+)
+
+// MsgpackCodec returns a codec, offered as "msgpack", that sends envelopes
+// as MessagePack maps in binary frames, with the same keys as the JSON
+// encoding. The payload is carried as a native MessagePack value rather
+// than embedded JSON.
+func MsgpackCodec() Codec {
+	return msgpackCodec{}
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string     { return "msgpack" }
+func (msgpackCodec) MessageType() int { return websocket.BinaryMessage }
+
+func (msgpackCodec) Encode(env Envelope) ([]byte, error) {
+	m := map[string]interface{}{
+		"type":       env.Type,
+		"sender":     env.Sender,
+		"sessionKey": env.SessionKey,
+		"timestamp":  env.Timestamp,
+	}
+	if len(env.Payload) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(env.Payload))
+		dec.UseNumber()
+		var payload interface{}
+		if err := dec.Decode(&payload); err != nil {
+			return nil, err
+		}
+		m["payload"] = payload
+	}
+	if env.Replayed {
+		m["replayed"] = true
+	}
+	var buf bytes.Buffer
+	if err := writeMsgpack(&buf, m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Decode(data []byte) (Envelope, error) {
+	var env Envelope
+	r := bytes.NewReader(data)
+	value, err := readMsgpack(r)
+	if err != nil {
+		return env, err
+	}
+	if r.Len() > 0 {
+		return env, errors.New("Trailing data after MessagePack envelope")
+	}
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return env, errors.New("MessagePack envelope is not a map")
+	}
+	env.Type, _ = m["type"].(string)
+	env.Sender, _ = m["sender"].(string)
+	env.SessionKey, _ = m["sessionKey"].(string)
+	switch ts := m["timestamp"].(type) {
+	case int64:
+		env.Timestamp = ts
+	case uint64:
+		env.Timestamp = int64(ts)
+	}
+	env.Replayed, _ = m["replayed"].(bool)
+	if payload, ok := m["payload"]; ok {
+		env.Payload, err = json.Marshal(payload)
+		if err != nil {
+			return env, err
+		}
+	}
+	return env, nil
+}
+
+// writeMsgpack encodes the JSON-like value v: nil, bools, numbers, strings,
+// slices and string-keyed maps, the latter with sorted keys.
+func writeMsgpack(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case int64:
+		writeMsgpackInt(buf, v)
+	case float64:
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			writeMsgpackInt(buf, n)
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		return writeMsgpack(buf, f)
+	case string:
+		writeMsgpackHeader(buf, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		buf.WriteString(v)
+	case []interface{}:
+		writeMsgpackHeader(buf, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, item := range v {
+			if err := writeMsgpack(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		writeMsgpackHeader(buf, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			writeMsgpack(buf, key)
+			if err := writeMsgpack(buf, v[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New(
+			fmt.Sprintf("Cannot encode %T as MessagePack", v),
+		)
+	}
+	return nil
+}
+
+func writeMsgpackInt(buf *bytes.Buffer, n int64) {
+	if n >= -32 && n <= 127 {
+		buf.WriteByte(byte(n))
+		return
+	}
+	buf.WriteByte(0xd3)
+	binary.Write(buf, binary.BigEndian, n)
+}
+
+// writeMsgpackHeader writes the header of a string, array or map of length
+// n: the fix format below fixMax, then the 8-bit (if the type has one),
+// 16-bit or 32-bit length formats.
+func writeMsgpackHeader(buf *bytes.Buffer, n int, fix byte, fixMax int, f8, f16, f32 byte) {
+	switch {
+	case n < fixMax:
+		buf.WriteByte(fix | byte(n))
+	case f8 != 0 && n <= math.MaxUint8:
+		buf.WriteByte(f8)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(f16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(f32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+// readMsgpack decodes one value, with integers as int64 (uint64 when too
+// large), binary data as []byte and maps as map[string]interface{}.
+func readMsgpack(r *bytes.Reader) (interface{}, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xf0 == 0x80:
+		return readMsgpackMap(r, int(b&0x0f))
+	case b&0xf0 == 0x90:
+		return readMsgpackArray(r, int(b&0x0f))
+	case b&0xe0 == 0xa0:
+		return readMsgpackString(r, int(b&0x1f))
+	}
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readMsgpackLength(r, b-0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackBytes(r, n)
+	case 0xca:
+		var bits uint32
+		err := binary.Read(r, binary.BigEndian, &bits)
+		return float64(math.Float32frombits(bits)), err
+	case 0xcb:
+		var bits uint64
+		err := binary.Read(r, binary.BigEndian, &bits)
+		return math.Float64frombits(bits), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := readMsgpackUint(r, 1<<(b-0xcc))
+		if err == nil && n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), err
+	case 0xd0:
+		var n int8
+		err := binary.Read(r, binary.BigEndian, &n)
+		return int64(n), err
+	case 0xd1:
+		var n int16
+		err := binary.Read(r, binary.BigEndian, &n)
+		return int64(n), err
+	case 0xd2:
+		var n int32
+		err := binary.Read(r, binary.BigEndian, &n)
+		return int64(n), err
+	case 0xd3:
+		var n int64
+		err := binary.Read(r, binary.BigEndian, &n)
+		return n, err
+	case 0xd9, 0xda, 0xdb:
+		n, err := readMsgpackLength(r, b-0xd9)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackString(r, n)
+	case 0xdc, 0xdd:
+		n, err := readMsgpackLength(r, b-0xdc+1)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackArray(r, n)
+	case 0xde, 0xdf:
+		n, err := readMsgpackLength(r, b-0xde+1)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackMap(r, n)
+	}
+	return nil, errors.New(
+		fmt.Sprintf("Unsupported MessagePack format 0x%x", b),
+	)
+}
+
+func readMsgpackUint(r *bytes.Reader, size int) (uint64, error) {
+	var n uint64
+	for i := 0; i < size; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		n = n<<8 | uint64(b)
+	}
+	return n, nil
+}
+
+// readMsgpackLength reads a length of 1, 2 or 4 bytes for width 0, 1, 2.
+func readMsgpackLength(r *bytes.Reader, width byte) (int, error) {
+	n, err := readMsgpackUint(r, 1<<width)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(r.Len()) {
+		return 0, errors.New("MessagePack length exceeds the frame")
+	}
+	return int(n), nil
+}
+
+func readMsgpackBytes(r *bytes.Reader, n int) ([]byte, error) {
+	if n > r.Len() {
+		return nil, errors.New("MessagePack length exceeds the frame")
+	}
+	data := make([]byte, n)
+	_, err := r.Read(data)
+	return data, err
+}
+
+func readMsgpackString(r *bytes.Reader, n int) (string, error) {
+	data, err := readMsgpackBytes(r, n)
+	return string(data), err
+}
+
+func readMsgpackArray(r *bytes.Reader, n int) ([]interface{}, error) {
+	items := []interface{}{}
+	for i := 0; i < n; i++ {
+		item, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func readMsgpackMap(r *bytes.Reader, n int) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	for i := 0; i < n; i++ {
+		key, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		k, ok := key.(string)
+		if !ok {
+			return nil, errors.New("MessagePack map key is not a string")
+		}
+		if m[k], err = readMsgpack(r); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
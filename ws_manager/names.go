@@ -0,0 +1,107 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/chau-t-tran/ws-to-me/utils"
+	"github.com/gorilla/websocket"
+)
+
+// NameCollisionPolicy decides what happens when a connection asks for a
+// display name already used in its session.
+type NameCollisionPolicy int
+
+const (
+	// NameCollisionSuffix appends #2, #3, ... until the name is free.
+	NameCollisionSuffix NameCollisionPolicy = iota
+	// NameCollisionRandom appends a short random token.
+	NameCollisionRandom
+	// NameCollisionReject refuses the connection with HTTP 409.
+	NameCollisionReject
+)
+
+// ErrNameTaken refuses a connection whose display name is used in its
+// session under NameCollisionReject.
+var ErrNameTaken = errors.New("Name already taken")
+
+// WithNameCollisionPolicy sets how duplicate display names are resolved.
+// Connections request a name with the "name" query parameter and learn the
+// name they were given from a welcome frame:
+//
+//	{"type":"welcome","name":"alice#2"}
+func WithNameCollisionPolicy(policy NameCollisionPolicy) Option {
+	return func(sm *SessionManager) {
+		sm.nameCollisionPolicy = policy
+	}
+}
+
+type welcomeFrame struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+func (s *session) nameTaken(name string) bool {
+	for _, cl := range s.clients {
+		if cl.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveNameLocked returns the name a connection asking for requested
+// should get, or ErrNameTaken under the reject policy.
+func (sm *SessionManager) resolveNameLocked(s *session, requested string) (string, error) {
+	if requested == "" || !s.nameTaken(requested) {
+		return requested, nil
+	}
+	switch sm.nameCollisionPolicy {
+	case NameCollisionReject:
+		return "", ErrNameTaken
+	case NameCollisionRandom:
+		for {
+			candidate := requested + "#" + utils.RandomKey()[:4]
+			if !s.nameTaken(candidate) {
+				return candidate, nil
+			}
+		}
+	default:
+		for n := 2; ; n++ {
+			candidate := requested + "#" + strconv.Itoa(n)
+			if !s.nameTaken(candidate) {
+				return candidate, nil
+			}
+		}
+	}
+}
+
+// nameAvailable reports whether a connection asking for name would be
+// admitted under the current policy.
+func (sm *SessionManager) nameAvailable(sessionKey, name string) bool {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return true
+	}
+	_, err := sm.resolveNameLocked(s, name)
+	return err == nil
+}
+
+// sendWelcomeLocked tells cl its effective name. The frame bypasses the
+// broadcast counters and does not count as activity on the connection.
+func (sm *SessionManager) sendWelcomeLocked(s *session, cl *client) error {
+	frame, err := json.Marshal(welcomeFrame{Type: "welcome", Name: cl.name})
+	if err != nil {
+		return err
+	}
+	if err := cl.write(websocket.TextMessage, frame); err != nil {
+		return errors.New(
+			fmt.Sprintf("Welcome to %s failed: %s", cl.id, err),
+		)
+	}
+	return nil
+}
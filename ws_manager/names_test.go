@@ -0,0 +1,99 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type NamesTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *NamesTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+}
+
+func (suite *NamesTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+func (suite *NamesTestSuite) start(policy NameCollisionPolicy) {
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithNameCollisionPolicy(policy))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+// join connects as name and returns the name given in the welcome frame.
+func (suite *NamesTestSuite) join(name string) (*websocket.Conn, string) {
+	conn, err := dialSession(suite.server, suite.sessionKey, "name="+name)
+	if !assert.NoError(suite.T(), err) {
+		return nil, ""
+	}
+	message, err := readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	frame := welcomeFrame{}
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &frame))
+	assert.Equal(suite.T(), "welcome", frame.Type)
+	conn.SetReadDeadline(time.Time{})
+	return conn, frame.Name
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *NamesTestSuite) TestSuffixPolicy() {
+	suite.start(NameCollisionSuffix)
+	_, first := suite.join("alice")
+	_, second := suite.join("alice")
+	_, third := suite.join("alice")
+	assert.Equal(suite.T(), "alice", first)
+	assert.Equal(suite.T(), "alice#2", second)
+	assert.Equal(suite.T(), "alice#3", third)
+}
+
+func (suite *NamesTestSuite) TestRandomPolicy() {
+	suite.start(NameCollisionRandom)
+	_, first := suite.join("alice")
+	_, second := suite.join("alice")
+	assert.Equal(suite.T(), "alice", first)
+	assert.True(suite.T(), strings.HasPrefix(second, "alice#"))
+	assert.Len(suite.T(), second, len("alice#")+4)
+}
+
+func (suite *NamesTestSuite) TestRejectPolicy() {
+	suite.start(NameCollisionReject)
+	suite.join("alice")
+	_, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "name=alice", nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusConflict, resp.StatusCode)
+}
+
+func (suite *NamesTestSuite) TestNameIsFreedOnDisconnect() {
+	suite.start(NameCollisionReject)
+	conn, _ := suite.join("alice")
+	conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+	_, name := suite.join("alice")
+	assert.Equal(suite.T(), "alice", name)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestNamesTestSuite(t *testing.T) {
+	suite.Run(t, new(NamesTestSuite))
+}
@@ -0,0 +1,154 @@
+package ws_manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Namespaces hosts several applications on one deployment, each in a
+// namespace of its own. Every namespace is served by a SessionManager of
+// its own, so session keys never collide across namespaces and auth hooks,
+// rate limits, connection caps and sessions are isolated: a busy namespace
+// only uses up its own limits.
+//
+//	ns := ws_manager.NewNamespaces(ws_manager.WithAutoRegister(true))
+//	ns.Register("chat", ws_manager.WithAuth(chatAuth), ws_manager.WithMaxTotalConnections(10000))
+//	ns.Register("boards", ws_manager.WithRateLimit(20, 40, 10))
+//	e.GET("/:namespace/:sessionKey", ns.EchoHandler)
+//	e.GET("/metrics", echo.WrapHandler(ns.PrometheusHandler()))
+type Namespaces struct {
+	defaults []Option
+
+	mu       sync.RWMutex
+	managers map[string]*SessionManager
+}
+
+// NewNamespaces returns an empty set of namespaces whose managers are
+// created with defaults, ahead of the options given to Register.
+func NewNamespaces(defaults ...Option) *Namespaces {
+	return &Namespaces{
+		defaults: defaults,
+		managers: map[string]*SessionManager{},
+	}
+}
+
+// Register creates the manager of namespace with the default options
+// followed by opts, which override them, and returns it.
+func (n *Namespaces) Register(namespace string, opts ...Option) (*SessionManager, error) {
+	if namespace == "" || strings.Contains(namespace, "/") {
+		return nil, errors.New(
+			fmt.Sprintf("Invalid namespace %q", namespace),
+		)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.managers[namespace]; ok {
+		return nil, errors.New(
+			fmt.Sprintf("Namespace %s already exists", namespace),
+		)
+	}
+	all := append(append([]Option{}, n.defaults...), opts...)
+	sm := CreateSessionManager([]string{}, all...)
+	n.managers[namespace] = sm
+	return sm, nil
+}
+
+// Get returns the manager of namespace.
+func (n *Namespaces) Get(namespace string) (*SessionManager, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	sm, ok := n.managers[namespace]
+	return sm, ok
+}
+
+// List returns the registered namespaces in sorted order.
+func (n *Namespaces) List() []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	names := make([]string, 0, len(n.managers))
+	for name := range n.managers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Remove unregisters namespace and shuts its manager down, as Shutdown.
+func (n *Namespaces) Remove(ctx context.Context, namespace string) error {
+	n.mu.Lock()
+	sm, ok := n.managers[namespace]
+	delete(n.managers, namespace)
+	n.mu.Unlock()
+	if !ok {
+		return errors.New(
+			fmt.Sprintf("Namespace %s not found", namespace),
+		)
+	}
+	return sm.Shutdown(ctx)
+}
+
+// Shutdown shuts every namespace down, as Shutdown, and returns the first
+// error. The namespaces stay registered.
+func (n *Namespaces) Shutdown(ctx context.Context) error {
+	n.mu.RLock()
+	managers := make([]*SessionManager, 0, len(n.managers))
+	for _, sm := range n.managers {
+		managers = append(managers, sm)
+	}
+	n.mu.RUnlock()
+	var first error
+	for _, sm := range managers {
+		if err := sm.Shutdown(ctx); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// EchoHandler serves the connection in the session named by the
+// "sessionKey" path parameter of the namespace named by the "namespace"
+// one.
+func (n *Namespaces) EchoHandler(c echo.Context) error {
+	return n.ServeWS(c.Response(), c.Request(), c.Param("namespace"), c.Param("sessionKey"))
+}
+
+// ServeWS is SessionManager.ServeWS in namespace. Dials to a namespace that
+// is not registered are refused with 404 Not Found.
+func (n *Namespaces) ServeWS(w http.ResponseWriter, r *http.Request, namespace, sessionKey string) error {
+	sm, ok := n.Get(namespace)
+	if !ok {
+		return plainText(w, http.StatusNotFound, "Unknown namespace")
+	}
+	return sm.ServeWS(w, r, sessionKey)
+}
+
+// PrometheusHandler serves the metrics of every namespace, as
+// SessionManager.PrometheusHandler, with a "namespace" label on every
+// series.
+func (n *Namespaces) PrometheusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		names := n.List()
+		managers := make([][]metricFamily, 0, len(names))
+		labels := make([]string, 0, len(names))
+		for _, name := range names {
+			sm, ok := n.Get(name)
+			if !ok {
+				continue
+			}
+			managers = append(managers, sm.metricFamilies())
+			labels = append(labels, fmt.Sprintf("namespace=\"%s\"", escapeLabel(name)))
+		}
+		var b strings.Builder
+		writeFamilies(&b, managers, labels)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(b.String()))
+	}
+}
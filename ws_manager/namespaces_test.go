@@ -0,0 +1,139 @@
+package ws_manager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type NamespacesTestSuite struct {
+	suite.Suite
+	sessionKey string
+	namespaces *Namespaces
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *NamespacesTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.namespaces = NewNamespaces(WithAutoRegister(true))
+	_, err := suite.namespaces.Register("chat", WithAuth(headerAuth), WithMaxConnectionsPerSession(1))
+	assert.NoError(suite.T(), err)
+	_, err = suite.namespaces.Register("boards")
+	assert.NoError(suite.T(), err)
+	e := echo.New()
+	e.GET("/:namespace/:sessionKey", suite.namespaces.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *NamespacesTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.namespaces.Shutdown(context.Background())
+}
+
+func (suite *NamespacesTestSuite) dial(namespace string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	url := fmt.Sprintf("ws%s/%s/%s", strings.TrimPrefix(suite.server.URL, "http"), namespace, suite.sessionKey)
+	return websocket.DefaultDialer.Dial(url, header)
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *NamespacesTestSuite) TestSameKeyIsIsolatedPerNamespace() {
+	header := http.Header{}
+	header.Set("X-Identity", "alice")
+	chatter, _, err := suite.dial("chat", header)
+	assert.NoError(suite.T(), err)
+	defer chatter.Close()
+	board, _, err := suite.dial("boards", nil)
+	assert.NoError(suite.T(), err)
+	defer board.Close()
+	chat, _ := suite.namespaces.Get("chat")
+	boards, _ := suite.namespaces.Get("boards")
+	assert.True(suite.T(), waitForConnections(chat, suite.sessionKey, 1))
+	assert.True(suite.T(), waitForConnections(boards, suite.sessionKey, 1))
+
+	assert.NoError(suite.T(), chat.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("chat only")))
+	message, err := readWithTimeout(chatter, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "chat only", message)
+	_, err = readWithTimeout(board, 300*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *NamespacesTestSuite) TestLimitsAndAuthArePerNamespace() {
+	_, resp, err := suite.dial("chat", nil)
+	assert.Error(suite.T(), err)
+	if assert.NotNil(suite.T(), resp) {
+		assert.Equal(suite.T(), http.StatusUnauthorized, resp.StatusCode)
+	}
+	header := http.Header{}
+	header.Set("X-Identity", "alice")
+	first, _, err := suite.dial("chat", header)
+	assert.NoError(suite.T(), err)
+	defer first.Close()
+	chat, _ := suite.namespaces.Get("chat")
+	assert.True(suite.T(), waitForConnections(chat, suite.sessionKey, 1))
+	_, resp, err = suite.dial("chat", header)
+	assert.Error(suite.T(), err)
+	if assert.NotNil(suite.T(), resp) {
+		assert.Equal(suite.T(), http.StatusServiceUnavailable, resp.StatusCode)
+	}
+
+	for i := 0; i < 2; i++ {
+		conn, _, err := suite.dial("boards", nil)
+		assert.NoError(suite.T(), err)
+		defer conn.Close()
+	}
+	boards, _ := suite.namespaces.Get("boards")
+	assert.True(suite.T(), waitForConnections(boards, suite.sessionKey, 2))
+
+	_, resp, err = suite.dial("missing", nil)
+	assert.Error(suite.T(), err)
+	if assert.NotNil(suite.T(), resp) {
+		assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func (suite *NamespacesTestSuite) TestRegisterAndRemove() {
+	_, err := suite.namespaces.Register("chat")
+	assert.EqualError(suite.T(), err, "Namespace chat already exists")
+	_, err = suite.namespaces.Register("a/b")
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), []string{"boards", "chat"}, suite.namespaces.List())
+
+	assert.NoError(suite.T(), suite.namespaces.Remove(context.Background(), "boards"))
+	assert.Equal(suite.T(), []string{"chat"}, suite.namespaces.List())
+	assert.EqualError(suite.T(), suite.namespaces.Remove(context.Background(), "boards"), "Namespace boards not found")
+}
+
+func (suite *NamespacesTestSuite) TestMetricsAreLabelledByNamespace() {
+	chat, _ := suite.namespaces.Get("chat")
+	assert.NoError(suite.T(), chat.RegisterSession(suite.sessionKey))
+	assert.NoError(suite.T(), chat.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("hi")))
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	suite.namespaces.PrometheusHandler()(rec, req)
+	body := rec.Body.String()
+	assert.Equal(suite.T(), 1, strings.Count(body, "# TYPE wstome_sessions gauge\n"))
+	assert.Contains(suite.T(), body, `wstome_sessions{namespace="boards"} 0`)
+	assert.Contains(suite.T(), body, `wstome_sessions{namespace="chat"} 1`)
+	assert.Contains(suite.T(), body, `wstome_session_broadcasts_total{namespace="chat",session="abcdefgh"} 1`)
+	assert.Contains(suite.T(), body, `wstome_broadcast_duration_seconds_bucket{namespace="chat",le="+Inf"} 1`)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestNamespacesTestSuite(t *testing.T) {
+	suite.Run(t, new(NamespacesTestSuite))
+}
@@ -0,0 +1,410 @@
+package ws_manager
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const natsReconnectDelay = time.Second
+
+// NATSOption configures the connections of a NATSBackend.
+type NATSOption func(*natsDialer)
+
+// natsDialer makes the connections to a NATS server, authenticated and
+// encrypted as the NATSOptions ask.
+type natsDialer struct {
+	addr      string
+	user      string
+	password  string
+	token     string
+	nkey      string
+	sign      func(nonce []byte) ([]byte, error)
+	tlsConfig *tls.Config
+}
+
+// WithNATSUserInfo authenticates with a user and password.
+func WithNATSUserInfo(user, password string) NATSOption {
+	return func(d *natsDialer) {
+		d.user = user
+		d.password = password
+	}
+}
+
+// WithNATSToken authenticates with a token.
+func WithNATSToken(token string) NATSOption {
+	return func(d *natsDialer) {
+		d.token = token
+	}
+}
+
+// WithNATSNKey authenticates with the NKey publicKey, e.g. "UDXU4R...".
+// sign is called with the nonce the server sends and returns its ed25519
+// signature by the key's seed, e.g. the Sign method of a key pair from
+// github.com/nats-io/nkeys, so the seed need not be handed over.
+func WithNATSNKey(publicKey string, sign func(nonce []byte) ([]byte, error)) NATSOption {
+	return func(d *natsDialer) {
+		d.nkey = publicKey
+		d.sign = sign
+	}
+}
+
+// WithNATSTLS upgrades connections to TLS with config after the server's
+// INFO, as NATS servers expect. The server name defaults to the host of
+// addr.
+func WithNATSTLS(config *tls.Config) NATSOption {
+	return func(d *natsDialer) {
+		if config == nil {
+			config = &tls.Config{}
+		}
+		d.tlsConfig = config
+	}
+}
+
+// NATSBackend is a Backend on NATS core pub/sub. Each session is published
+// on its own subject, the session key appended to subjectPrefix and a dot,
+// e.g. "ws.abcdefgh", so session keys must not contain whitespace.
+// Broadcasts also come back to the instance that published them, which
+// drops them by their origin so its connections are not delivered to twice.
+type NATSBackend struct {
+	dialer        natsDialer
+	subjectPrefix string
+
+	mu   sync.Mutex
+	conn net.Conn
+
+	// down is why the subscription is not up, nil while it is
+	downMu sync.Mutex
+	down   error
+}
+
+// NewNATSBackend returns a backend for the NATS server at addr, e.g.
+// "localhost:4222". Connections are made on first use and remade after
+// errors.
+func NewNATSBackend(addr, subjectPrefix string, opts ...NATSOption) *NATSBackend {
+	d := natsDialer{addr: addr}
+	for _, opt := range opts {
+		opt(&d)
+	}
+	return &NATSBackend{dialer: d, subjectPrefix: subjectPrefix}
+}
+
+// Publish implements Backend.
+func (b *NATSBackend) Publish(sessionKey string, msg BackendMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		conn, r, err := b.dialer.dial()
+		if err != nil {
+			return err
+		}
+		b.conn = conn
+		go b.keepPublishConn(conn, r)
+	}
+	_, err = fmt.Fprintf(b.conn, "PUB %s %d\r\n%s\r\n", b.subject(sessionKey), len(payload), payload)
+	if err != nil {
+		b.conn.Close()
+		b.conn = nil
+	}
+	return err
+}
+
+// Subscribe implements Backend. The subscription is made before Subscribe
+// returns; if it later drops, it is remade until unsubscribe is called.
+func (b *NATSBackend) Subscribe(handler func(sessionKey string, msg BackendMessage)) (func(), error) {
+	conn, r, err := b.subscribe()
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	var connMu sync.Mutex
+	go func() {
+		for {
+			b.receive(conn, r, handler)
+			b.setDown(errSubscriptionLost)
+			select {
+			case <-done:
+				return
+			case <-time.After(natsReconnectDelay):
+			}
+			next, nextR, err := b.subscribe()
+			b.setDown(err)
+			if err != nil {
+				continue
+			}
+			connMu.Lock()
+			select {
+			case <-done:
+				next.Close()
+				connMu.Unlock()
+				return
+			default:
+			}
+			conn, r = next, nextR
+			connMu.Unlock()
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			connMu.Lock()
+			close(done)
+			conn.Close()
+			connMu.Unlock()
+		})
+	}, nil
+}
+
+// Healthy implements HealthChecker: it returns why the subscription is
+// down while it is being remade.
+func (b *NATSBackend) Healthy() error {
+	b.downMu.Lock()
+	defer b.downMu.Unlock()
+	return b.down
+}
+
+func (b *NATSBackend) setDown(err error) {
+	b.downMu.Lock()
+	b.down = err
+	b.downMu.Unlock()
+}
+
+// Close closes the connection used for publishing.
+func (b *NATSBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		return nil
+	}
+	err := b.conn.Close()
+	b.conn = nil
+	return err
+}
+
+// keepPublishConn answers the server's pings on the publishing connection
+// so it is not dropped as stale, and forgets the connection when it fails.
+func (b *NATSBackend) keepPublishConn(conn net.Conn, r *bufio.Reader) {
+	defer func() {
+		b.mu.Lock()
+		if b.conn == conn {
+			b.conn = nil
+		}
+		b.mu.Unlock()
+		conn.Close()
+	}()
+	for {
+		line, err := readNATSLine(r)
+		if err != nil || strings.HasPrefix(line, "-ERR") {
+			return
+		}
+		if line == "PING" {
+			b.mu.Lock()
+			_, err = io.WriteString(conn, "PONG\r\n")
+			b.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (b *NATSBackend) subject(sessionKey string) string {
+	return b.subjectPrefix + "." + sessionKey
+}
+
+func (b *NATSBackend) subscribe() (net.Conn, *bufio.Reader, error) {
+	conn, r, err := b.dialer.dial()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := fmt.Fprintf(conn, "SUB %s.> 1\r\n", b.subjectPrefix); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, r, nil
+}
+
+// receive hands every published message to handler until conn fails,
+// answering the server's pings along the way.
+func (b *NATSBackend) receive(conn net.Conn, r *bufio.Reader, handler func(string, BackendMessage)) {
+	defer conn.Close()
+	for {
+		line, err := readNATSLine(r)
+		if err != nil {
+			return
+		}
+		switch {
+		case line == "PING":
+			if _, err := io.WriteString(conn, "PONG\r\n"); err != nil {
+				return
+			}
+		case strings.HasPrefix(line, "MSG "):
+			subject, payload, err := readNATSMsg(r, line)
+			if err != nil {
+				return
+			}
+			var msg BackendMessage
+			if err := json.Unmarshal(payload, &msg); err != nil {
+				continue
+			}
+			handler(strings.TrimPrefix(subject, b.subjectPrefix+"."), msg)
+		case strings.HasPrefix(line, "-ERR"):
+			return
+		}
+	}
+}
+
+// natsInfo is the part of the server's INFO the handshake needs.
+type natsInfo struct {
+	TLSRequired bool   `json:"tls_required"`
+	Nonce       string `json:"nonce"`
+}
+
+// natsConnect is the CONNECT sent to the server.
+type natsConnect struct {
+	Verbose     bool   `json:"verbose"`
+	Pedantic    bool   `json:"pedantic"`
+	Name        string `json:"name"`
+	TLSRequired bool   `json:"tls_required"`
+	User        string `json:"user,omitempty"`
+	Pass        string `json:"pass,omitempty"`
+	AuthToken   string `json:"auth_token,omitempty"`
+	NKey        string `json:"nkey,omitempty"`
+	Sig         string `json:"sig,omitempty"`
+}
+
+// dial connects to the server and completes the handshake: the server's
+// INFO, the TLS upgrade if configured, our CONNECT, and a PING answered by
+// PONG, which also surfaces errors such as a refused CONNECT.
+func (d natsDialer) dial() (net.Conn, *bufio.Reader, error) {
+	conn, err := net.Dial("tcp", d.addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(natsReconnectDelay * 5))
+	conn, r, err := d.handshake(conn)
+	conn.SetDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, r, nil
+}
+
+// handshake returns the connection to use from then on, conn or its TLS
+// upgrade.
+func (d natsDialer) handshake(conn net.Conn) (net.Conn, *bufio.Reader, error) {
+	r := bufio.NewReader(conn)
+	line, err := readNATSLine(r)
+	if err != nil {
+		return conn, nil, err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return conn, nil, errors.New(
+			fmt.Sprintf("Expected INFO from NATS server, got %q", line),
+		)
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		return conn, nil, err
+	}
+	if info.TLSRequired && d.tlsConfig == nil {
+		return conn, nil, errors.New("NATS server requires TLS")
+	}
+	if d.tlsConfig != nil {
+		config := d.tlsConfig
+		if config.ServerName == "" {
+			config = config.Clone()
+			config.ServerName, _, _ = net.SplitHostPort(d.addr)
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.Handshake(); err != nil {
+			return conn, nil, err
+		}
+		conn = tlsConn
+		r = bufio.NewReader(conn)
+	}
+	connect := natsConnect{
+		Name:        "ws-to-me",
+		TLSRequired: d.tlsConfig != nil,
+		User:        d.user,
+		Pass:        d.password,
+		AuthToken:   d.token,
+	}
+	if d.nkey != "" {
+		if info.Nonce == "" {
+			return conn, nil, errors.New("NATS server sent no nonce to sign for NKey authentication")
+		}
+		sig, err := d.sign([]byte(info.Nonce))
+		if err != nil {
+			return conn, nil, err
+		}
+		connect.NKey = d.nkey
+		connect.Sig = base64.RawURLEncoding.EncodeToString(sig)
+	}
+	payload, err := json.Marshal(connect)
+	if err != nil {
+		return conn, nil, err
+	}
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", payload); err != nil {
+		return conn, nil, err
+	}
+	for {
+		line, err := readNATSLine(r)
+		if err != nil {
+			return conn, nil, err
+		}
+		switch {
+		case line == "PONG":
+			return conn, r, nil
+		case strings.HasPrefix(line, "-ERR"):
+			return conn, nil, errors.New(
+				fmt.Sprintf("NATS server refused connection: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR"))),
+			)
+		}
+	}
+}
+
+// readNATSLine reads one protocol line without its CRLF.
+func readNATSLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readNATSMsg reads the payload announced by a "MSG <subject> <sid>
+// [reply-to] <#bytes>" line.
+func readNATSMsg(r *bufio.Reader, line string) (string, []byte, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 4 && len(fields) != 5 {
+		return "", nil, errors.New(
+			fmt.Sprintf("Malformed MSG line %q", line),
+		)
+	}
+	n, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || n < 0 {
+		return "", nil, errors.New(
+			fmt.Sprintf("Malformed MSG line %q", line),
+		)
+	}
+	data := make([]byte, n+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", nil, err
+	}
+	return fields[1], data[:n], nil
+}
@@ -0,0 +1,345 @@
+package ws_manager
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// fakeNATS speaks just enough of the NATS protocol for PUB and SUB with
+// trailing-> wildcards, and pings every new connection once.
+type fakeNATS struct {
+	listener  net.Listener
+	pongs     chan struct{}
+	auth      natsConnect
+	nkey      ed25519.PublicKey
+	tlsConfig *tls.Config
+
+	mu          sync.Mutex
+	conns       map[net.Conn]bool
+	subscribers map[net.Conn]string
+}
+
+func startFakeNATS() (*fakeNATS, error) {
+	return startFakeNATSWith(natsConnect{}, nil, nil)
+}
+
+// startFakeNATSWith starts a fakeNATS that refuses a CONNECT whose user,
+// pass, auth_token and nkey differ from auth's, checks the nonce signature
+// by nkey when auth names one, and requires TLS when config is not nil.
+func startFakeNATSWith(auth natsConnect, nkey ed25519.PublicKey, config *tls.Config) (*fakeNATS, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	f := &fakeNATS{
+		listener:    listener,
+		pongs:       make(chan struct{}, 16),
+		auth:        auth,
+		nkey:        nkey,
+		tlsConfig:   config,
+		conns:       map[net.Conn]bool{},
+		subscribers: map[net.Conn]string{},
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f, nil
+}
+
+// dropSubscribers closes every subscribed connection.
+func (f *fakeNATS) dropSubscribers() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for conn := range f.subscribers {
+		conn.Close()
+		delete(f.subscribers, conn)
+	}
+}
+
+func (f *fakeNATS) subscriberCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subscribers)
+}
+
+func (f *fakeNATS) serve(conn net.Conn) {
+	info := natsInfo{TLSRequired: f.tlsConfig != nil}
+	if f.auth.NKey != "" {
+		info.Nonce = "fakenonce"
+	}
+	infoJSON, _ := json.Marshal(info)
+	fmt.Fprintf(conn, "INFO %s\r\n", infoJSON)
+	if f.tlsConfig != nil {
+		conn = tls.Server(conn, f.tlsConfig)
+	}
+	f.mu.Lock()
+	f.conns[conn] = true
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(f.conns, conn)
+		delete(f.subscribers, conn)
+		f.mu.Unlock()
+		conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	connected := false
+	for {
+		line, err := readNATSLine(r)
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "CONNECT" && !f.authorized(strings.TrimPrefix(line, "CONNECT "), info.Nonce) {
+			io.WriteString(conn, "-ERR 'Authorization Violation'\r\n")
+			return
+		}
+		f.mu.Lock()
+		switch fields[0] {
+		case "PING":
+			conn.Write([]byte("PONG\r\n"))
+			if !connected {
+				connected = true
+				conn.Write([]byte("PING\r\n"))
+			}
+		case "PONG":
+			f.pongs <- struct{}{}
+		case "SUB":
+			f.subscribers[conn] = fields[1]
+		case "PUB":
+			n := 0
+			fmt.Sscan(fields[2], &n)
+			payload := make([]byte, n+2)
+			f.mu.Unlock()
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			f.mu.Lock()
+			for sub, pattern := range f.subscribers {
+				if strings.HasPrefix(fields[1], strings.TrimSuffix(pattern, ">")) {
+					fmt.Fprintf(sub, "MSG %s 1 %d\r\n%s", fields[1], n, payload)
+				}
+			}
+		}
+		f.mu.Unlock()
+	}
+}
+
+// authorized reports whether the CONNECT payload carries the credentials
+// the server was started with.
+func (f *fakeNATS) authorized(payload, nonce string) bool {
+	var connect natsConnect
+	if err := json.Unmarshal([]byte(payload), &connect); err != nil {
+		return false
+	}
+	if connect.User != f.auth.User || connect.Pass != f.auth.Pass || connect.AuthToken != f.auth.AuthToken || connect.NKey != f.auth.NKey {
+		return false
+	}
+	if f.auth.NKey == "" {
+		return true
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(connect.Sig)
+	return err == nil && ed25519.Verify(f.nkey, []byte(nonce), sig)
+}
+
+type NATSTestSuite struct {
+	suite.Suite
+	sessionKey string
+	nats       *fakeNATS
+	managers   []*SessionManager
+	servers    []*httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *NATSTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	nats, err := startFakeNATS()
+	assert.NoError(suite.T(), err)
+	suite.nats = nats
+	suite.managers = nil
+	suite.servers = nil
+	for i := 0; i < 2; i++ {
+		manager := CreateSessionManager(
+			[]string{suite.sessionKey},
+			WithBackend(NewNATSBackend(nats.listener.Addr().String(), "ws")),
+		)
+		e := echo.New()
+		e.GET("/:sessionKey", manager.EchoHandler)
+		suite.managers = append(suite.managers, manager)
+		suite.servers = append(suite.servers, httptest.NewServer(e))
+	}
+}
+
+func (suite *NATSTestSuite) TearDownTest() {
+	for i, server := range suite.servers {
+		server.Close()
+		suite.managers[i].cronScheduler.Stop()
+		suite.managers[i].unsubscribeBackend()
+	}
+	suite.nats.listener.Close()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *NATSTestSuite) TestBroadcastReachesOtherInstancesOnce() {
+	sender, err := dialSession(suite.servers[0], suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	local, err := dialSession(suite.servers[0], suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	remote, err := dialSession(suite.servers[1], suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.managers[0], suite.sessionKey, 2))
+	assert.True(suite.T(), waitForConnections(suite.managers[1], suite.sessionKey, 1))
+
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte("hello")))
+	for _, conn := range []*websocket.Conn{local, remote} {
+		message, err := readWithTimeout(conn, time.Second)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "hello", message)
+	}
+
+	// the publishing instance does not deliver its own broadcast twice
+	_, err = readWithTimeout(local, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *NATSTestSuite) TestServerPingsAreAnswered() {
+	// one pong from each subscribing connection, one from the publisher
+	assert.NoError(suite.T(), suite.managers[0].BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("x")))
+	for i := 0; i < 3; i++ {
+		select {
+		case <-suite.nats.pongs:
+		case <-time.After(time.Second):
+			suite.T().Fatal("ping was not answered")
+		}
+	}
+}
+
+func (suite *NATSTestSuite) TestSubscriptionIsRemadeAfterDrop() {
+	remote, err := dialSession(suite.servers[1], suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.managers[1], suite.sessionKey, 1))
+
+	suite.nats.dropSubscribers()
+	deadline := time.Now().Add(3 * time.Second)
+	for suite.nats.subscriberCount() < 2 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.Equal(suite.T(), 2, suite.nats.subscriberCount())
+
+	assert.NoError(suite.T(), suite.managers[0].BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("back")))
+	message, err := readWithTimeout(remote, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "back", message)
+}
+
+func (suite *NATSTestSuite) TestPublishErrorIsReported() {
+	suite.nats.listener.Close()
+	manager := CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithLogger(NopLogger()),
+		WithBackend(NewNATSBackend(suite.nats.listener.Addr().String(), "ws")),
+	)
+	defer manager.cronScheduler.Stop()
+	assert.Error(suite.T(), manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("x")))
+}
+
+func (suite *NATSTestSuite) TestAuthAndTLS() {
+	serverTLS, clientTLS, err := testTLSConfigs()
+	assert.NoError(suite.T(), err)
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(suite.T(), err)
+	sign := func(nonce []byte) ([]byte, error) {
+		return ed25519.Sign(private, nonce), nil
+	}
+	wrongSign := func(nonce []byte) ([]byte, error) {
+		return ed25519.Sign(private, []byte("other")), nil
+	}
+
+	for name, tc := range map[string]struct {
+		auth  natsConnect
+		good  []NATSOption
+		wrong []NATSOption
+	}{
+		"user": {
+			auth:  natsConnect{User: "relay", Pass: "secret"},
+			good:  []NATSOption{WithNATSUserInfo("relay", "secret")},
+			wrong: []NATSOption{WithNATSUserInfo("relay", "guess")},
+		},
+		"token": {
+			auth:  natsConnect{AuthToken: "secret"},
+			good:  []NATSOption{WithNATSToken("secret")},
+			wrong: []NATSOption{WithNATSToken("guess")},
+		},
+		"nkey": {
+			auth:  natsConnect{NKey: "UFAKE"},
+			good:  []NATSOption{WithNATSNKey("UFAKE", sign)},
+			wrong: []NATSOption{WithNATSNKey("UFAKE", wrongSign)},
+		},
+	} {
+		nats, err := startFakeNATSWith(tc.auth, public, serverTLS)
+		assert.NoError(suite.T(), err)
+		addr := nats.listener.Addr().String()
+
+		received := make(chan string, 1)
+		subscriber := NewNATSBackend(addr, "ws", append(tc.good, WithNATSTLS(clientTLS))...)
+		unsubscribe, err := subscriber.Subscribe(func(sessionKey string, msg BackendMessage) {
+			received <- string(msg.Data)
+		})
+		if !assert.NoError(suite.T(), err, name) {
+			nats.listener.Close()
+			continue
+		}
+		assert.Eventually(suite.T(), func() bool { return nats.subscriberCount() == 1 }, time.Second, 10*time.Millisecond, name)
+		publisher := NewNATSBackend(addr, "ws", append(tc.good, WithNATSTLS(clientTLS))...)
+		assert.NoError(suite.T(), publisher.Publish(suite.sessionKey, BackendMessage{Data: []byte("hello")}), name)
+		select {
+		case message := <-received:
+			assert.Equal(suite.T(), "hello", message, name)
+		case <-time.After(time.Second):
+			suite.T().Errorf("%s: message not received over TLS", name)
+		}
+
+		wrong := NewNATSBackend(addr, "ws", append(tc.wrong, WithNATSTLS(clientTLS))...)
+		assert.ErrorContains(suite.T(), wrong.Publish(suite.sessionKey, BackendMessage{}), "Authorization Violation", name)
+		noTLS := NewNATSBackend(addr, "ws", tc.good...)
+		assert.ErrorContains(suite.T(), noTLS.Publish(suite.sessionKey, BackendMessage{}), "requires TLS", name)
+
+		publisher.Close()
+		unsubscribe()
+		nats.listener.Close()
+	}
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestNATSTestSuite(t *testing.T) {
+	suite.Run(t, new(NATSTestSuite))
+}
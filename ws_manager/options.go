@@ -0,0 +1,67 @@
+package ws_manager
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Option configures optional SessionManager behavior at construction time.
+type Option func(*SessionManager)
+
+// PreBroadcastFunc inspects a broadcast before it leaves a session. It returns
+// the message to deliver, or allow=false to deliver it to nobody.
+type PreBroadcastFunc func(sessionKey, senderID, message string) (newMsg string, allow bool)
+
+// WithPreBroadcast installs a hook that runs for every broadcast, including
+// ones originated by the server. The hook runs under the manager lock and
+// must not call back into the manager. Only the session's shard of the lock
+// is held, so the hook runs concurrently for sessions of other shards.
+func WithPreBroadcast(hook PreBroadcastFunc) Option {
+	return func(sm *SessionManager) {
+		sm.preBroadcast = hook
+	}
+}
+
+// AuthFunc authenticates an upgrade request for sessionKey and returns the
+// caller's identity. A non-nil error rejects the handshake with HTTP 401, or
+// with HTTP 403 if it is ErrForbidden, possibly wrapped.
+type AuthFunc func(sessionKey string, r *http.Request) (identity string, err error)
+
+// ErrForbidden, returned by an AuthFunc or Authenticator, rejects a caller
+// that was identified but may not join the session.
+var ErrForbidden = errors.New("Forbidden")
+
+// Authenticator is AuthFunc as an interface, for authenticators that carry
+// state such as a key set or a session store.
+type Authenticator interface {
+	Authenticate(r *http.Request, sessionKey string) (identity string, err error)
+}
+
+// WithAuthenticator runs a.Authenticate before every upgrade, as WithAuth
+// does.
+func WithAuthenticator(a Authenticator) Option {
+	return WithAuth(func(sessionKey string, r *http.Request) (string, error) {
+		return a.Authenticate(r, sessionKey)
+	})
+}
+
+// WithAuth runs auth before every upgrade. Without it connections are
+// anonymous and have an empty identity.
+func WithAuth(auth AuthFunc) Option {
+	return func(sm *SessionManager) {
+		sm.auth = auth
+	}
+}
+
+// AuthCheckFunc validates an upgrade request for sessionKey, e.g. a bearer
+// token or cookie, without identifying the caller.
+type AuthCheckFunc func(sessionKey string, r *http.Request) error
+
+// WithAuthCheck rejects upgrades with HTTP 401 when check returns an error.
+// Accepted connections are anonymous; use WithAuth to also assign an
+// identity.
+func WithAuthCheck(check AuthCheckFunc) Option {
+	return WithAuth(func(sessionKey string, r *http.Request) (string, error) {
+		return "", check(sessionKey, r)
+	})
+}
@@ -0,0 +1,1121 @@
+package ws_manager
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type OptionsTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+// recordingLogger keeps the messages logged at each level.
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries map[string][]string
+}
+
+func (l *recordingLogger) record(level, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[level] = append(l.entries[level], msg)
+}
+
+func (l *recordingLogger) get(level string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string{}, l.entries[level]...)
+}
+
+func (l *recordingLogger) Debug(msg string, _ ...interface{}) { l.record("debug", msg) }
+func (l *recordingLogger) Info(msg string, _ ...interface{})  { l.record("info", msg) }
+func (l *recordingLogger) Warn(msg string, _ ...interface{})  { l.record("warn", msg) }
+func (l *recordingLogger) Error(msg string, _ ...interface{}) { l.record("error", msg) }
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *OptionsTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+}
+
+func (suite *OptionsTestSuite) TearDownTest() {
+	if suite.server != nil {
+		suite.server.Close()
+		suite.server = nil
+	}
+	if suite.manager != nil {
+		suite.manager.cronScheduler.Stop()
+	}
+}
+
+// start creates a manager with opts and serves its EchoHandler.
+func (suite *OptionsTestSuite) start(opts ...Option) {
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, opts...)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *OptionsTestSuite) TestPreBroadcastRewritesMessage() {
+	suite.start(WithPreBroadcast(func(sessionKey, senderID, message string) (string, bool) {
+		return strings.ReplaceAll(message, "secret", "******"), true
+	}))
+	sender, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	sender.WriteMessage(1, []byte("the secret is out"))
+
+	message, err := readWithTimeout(receiver, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "the ****** is out", message)
+}
+
+func (suite *OptionsTestSuite) TestPreBroadcastMessageSeesFrameType() {
+	suite.start(WithPreBroadcastMessage(func(sessionKey, senderID string, messageType int, message []byte) ([]byte, bool) {
+		if messageType == websocket.BinaryMessage {
+			return message, true
+		}
+		return bytes.ToUpper(message), true
+	}))
+	sender, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	chunk := []byte{0x00, 0x7f, 0xff, 'a'}
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.BinaryMessage, chunk))
+	receiver.SetReadDeadline(time.Now().Add(time.Second))
+	messageType, data, err := receiver.ReadMessage()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), websocket.BinaryMessage, messageType)
+	assert.Equal(suite.T(), chunk, data)
+
+	assert.NoError(suite.T(), suite.manager.BroadcastBinary(suite.sessionKey, "", chunk))
+	messageType, data, err = receiver.ReadMessage()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), websocket.BinaryMessage, messageType)
+	assert.Equal(suite.T(), chunk, data)
+
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte("shout")))
+	messageType, data, err = receiver.ReadMessage()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), websocket.TextMessage, messageType)
+	assert.Equal(suite.T(), "SHOUT", string(data))
+}
+
+func (suite *OptionsTestSuite) TestPreBroadcastVetoesServerBroadcast() {
+	suite.start(WithPreBroadcast(func(sessionKey, senderID, message string) (string, bool) {
+		return message, !strings.Contains(message, "blocked")
+	}))
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("blocked")))
+	_, err = readWithTimeout(receiver, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), uint64(1), suite.manager.Metrics().VetoedBroadcasts)
+}
+
+func (suite *OptionsTestSuite) TestConnectGraceClosesSilentConnection() {
+	suite.start(WithConnectGraceTimeout(200 * time.Millisecond))
+	silent, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	_, err = readWithTimeout(silent, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, CloseNoActivity))
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+}
+
+func (suite *OptionsTestSuite) TestConnectGraceKeepsActiveConnection() {
+	suite.start(WithConnectGraceTimeout(200 * time.Millisecond))
+	active, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	active.WriteMessage(1, []byte("hello"))
+	time.Sleep(400 * time.Millisecond)
+
+	conns, err := suite.manager.GetSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), conns, 1)
+}
+
+func (suite *OptionsTestSuite) TestOversizedOutboundMessageIsDeadLettered() {
+	letters := make(chan DeadLetter, 1)
+	suite.start(
+		WithMaxOutboundMessageSize(10),
+		WithPreBroadcast(func(sessionKey, senderID, message string) (string, bool) {
+			return "[2026-01-01T00:00:00Z] " + message, true
+		}),
+		WithDeadLetterHandler(func(letter DeadLetter) {
+			letters <- letter
+		}),
+	)
+	receiver, receiverID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("hi")))
+
+	_, err = readWithTimeout(receiver, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+	select {
+	case letter := <-letters:
+		assert.Equal(suite.T(), DeadLetterSizeExceeded, letter.Reason)
+		assert.Equal(suite.T(), suite.sessionKey, letter.SessionKey)
+		assert.Equal(suite.T(), receiverID, letter.ClientID)
+	default:
+		suite.T().Error("expected a dead letter")
+	}
+	assert.Equal(suite.T(), uint64(1), suite.manager.Metrics().DroppedMessages)
+}
+
+func (suite *OptionsTestSuite) TestKeepaliveDropsUnresponsiveConnection() {
+	suite.start(WithKeepalive(50*time.Millisecond, 100*time.Millisecond))
+	// a connection that never reads never answers pings
+	_, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+}
+
+func (suite *OptionsTestSuite) TestKeepaliveKeepsResponsiveConnection() {
+	suite.start(WithKeepalive(50*time.Millisecond, 100*time.Millisecond))
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	joined, err := suite.manager.GetLastUsedTime(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+
+	// reading answers pings with pongs
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	time.Sleep(500 * time.Millisecond)
+
+	conns, err := suite.manager.GetSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), conns, 1)
+	lastUsed, err := suite.manager.GetLastUsedTime(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), lastUsed.After(joined))
+}
+
+func (suite *OptionsTestSuite) TestKeepaliveToleratesMissedPongs() {
+	disconnects := make(chan error, 1)
+	suite.start(
+		WithKeepalive(100*time.Millisecond, 100*time.Millisecond),
+		WithMaxMissedPongs(4),
+		WithOnDisconnect(func(sessionKey, clientID string, err error) {
+			disconnects <- err
+		}),
+	)
+	_, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	// two missed pongs are tolerated, well within the 500ms grace
+	time.Sleep(200 * time.Millisecond)
+	conns, err := suite.manager.GetSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), conns, 1)
+
+	var dropErr error
+	assert.Eventually(suite.T(), func() bool {
+		select {
+		case dropErr = <-disconnects:
+			return true
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond, "expected a disconnect")
+	var netErr net.Error
+	if assert.ErrorAs(suite.T(), dropErr, &netErr) {
+		assert.True(suite.T(), netErr.Timeout())
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+}
+
+func (suite *OptionsTestSuite) TestMaxConnectionsPerSessionUnderConcurrentDials() {
+	suite.start(WithMaxConnectionsPerSession(2))
+	dialers := 8
+	var wg sync.WaitGroup
+	for i := 0; i < dialers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", nil)
+			if err != nil {
+				assert.Equal(suite.T(), http.StatusServiceUnavailable, resp.StatusCode)
+				return
+			}
+			// admitted connections stay open, late rejections get a close frame
+			_, err = readWithTimeout(conn, 300*time.Millisecond)
+			if websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+				return
+			}
+			assert.False(suite.T(), websocket.IsUnexpectedCloseError(err))
+		}()
+	}
+	wg.Wait()
+
+	stats, err := suite.manager.GetSessionStats(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 2, stats.Connections)
+	assert.Equal(suite.T(), uint64(dialers-2), stats.RejectedConnections)
+}
+
+func (suite *OptionsTestSuite) TestMaxClientsPerSessionClosesAfterUpgrade() {
+	suite.start(WithMaxClientsPerSession(1))
+	first, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	extra, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	_, err = readWithTimeout(extra, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, CloseSessionFull))
+	assert.Equal(suite.T(), "session is full", err.(*websocket.CloseError).Text)
+
+	stats, err := suite.manager.GetSessionStats(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, stats.Connections)
+	assert.Equal(suite.T(), uint64(1), stats.RejectedConnections)
+	first.Close()
+}
+
+func (suite *OptionsTestSuite) TestAuthCheckRejectsBeforeUpgrade() {
+	suite.start(WithAuthCheck(func(sessionKey string, r *http.Request) error {
+		if r.Header.Get("Authorization") != "Bearer letmein" {
+			return errors.New("bad token")
+		}
+		return nil
+	}))
+	_, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusUnauthorized, resp.StatusCode)
+	conns, err := suite.manager.GetSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), conns)
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer letmein")
+	_, _, err = dialSessionWithHeader(suite.server, suite.sessionKey, "", header)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+}
+
+// tokenAuthenticator identifies callers by their bearer token.
+type tokenAuthenticator map[string]string
+
+func (a tokenAuthenticator) Authenticate(r *http.Request, sessionKey string) (string, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	identity, ok := a[token]
+	if !ok {
+		return "", errors.New("unknown token")
+	}
+	if identity == "mallory" {
+		return "", fmt.Errorf("%s: %w", identity, ErrForbidden)
+	}
+	return identity, nil
+}
+
+func (suite *OptionsTestSuite) TestAuthenticatorSetsIdentity() {
+	suite.start(WithAuthenticator(tokenAuthenticator{"t1": "alice", "t2": "mallory"}))
+	header := http.Header{}
+	_, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", header)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusUnauthorized, resp.StatusCode)
+
+	header.Set("Authorization", "Bearer t2")
+	_, resp, err = dialSessionWithHeader(suite.server, suite.sessionKey, "", header)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+
+	header.Set("Authorization", "Bearer t1")
+	_, _, err = dialSessionWithHeader(suite.server, suite.sessionKey, "", header)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	clients, err := suite.manager.GetClients(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "alice", clients[0].Identity)
+}
+
+// countingPool is a websocket.BufferPool that counts the buffers lent.
+type countingPool struct {
+	mu   sync.Mutex
+	gets int
+	pool sync.Pool
+}
+
+func (p *countingPool) Get() interface{} {
+	p.mu.Lock()
+	p.gets++
+	p.mu.Unlock()
+	return p.pool.Get()
+}
+
+func (p *countingPool) Put(v interface{}) {
+	p.pool.Put(v)
+}
+
+func (suite *OptionsTestSuite) TestUpgraderTuning() {
+	pool := &countingPool{}
+	suite.start(WithBufferSizes(2048, 512), WithHandshakeTimeout(time.Second), WithWriteBufferPool(pool))
+	assert.Equal(suite.T(), 2048, suite.manager.upgrader.ReadBufferSize)
+	assert.Equal(suite.T(), 512, suite.manager.upgrader.WriteBufferSize)
+	assert.Equal(suite.T(), time.Second, suite.manager.upgrader.HandshakeTimeout)
+
+	sender, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte("pooled")))
+	message, err := readWithTimeout(receiver, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "pooled", message)
+	pool.mu.Lock()
+	assert.NotZero(suite.T(), pool.gets)
+	pool.mu.Unlock()
+
+	sm := CreateSessionManager(nil, WithConfig(Config{HandshakeTimeout: 2 * time.Second, WriteBufferPool: pool}))
+	defer sm.cronScheduler.Stop()
+	assert.Equal(suite.T(), 2*time.Second, sm.upgrader.HandshakeTimeout)
+	assert.Equal(suite.T(), websocket.BufferPool(pool), sm.upgrader.WriteBufferPool)
+}
+
+func (suite *OptionsTestSuite) TestConfigAppliesSetFields() {
+	suite.start(
+		WithMaxMessageSize(1024),
+		WithConfig(Config{
+			CheckOrigin: func(r *http.Request) bool {
+				return r.Header.Get("Origin") == ""
+			},
+			ReadBufferSize: 4096,
+			WriteTimeout:   time.Second,
+			MaxMessageSize: 10,
+		}),
+	)
+	assert.Equal(suite.T(), 4096, suite.manager.upgrader.ReadBufferSize)
+	assert.Equal(suite.T(), 1024, suite.manager.upgrader.WriteBufferSize)
+	assert.Equal(suite.T(), defaultPingInterval, suite.manager.pingInterval)
+	assert.False(suite.T(), suite.manager.compression)
+
+	header := http.Header{}
+	header.Set("Origin", "https://elsewhere.example")
+	_, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", header)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+
+	sender, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	suite.manager.sessionManagerMu.RLock()
+	assert.Equal(suite.T(), time.Second, suite.manager.sessions[suite.sessionKey].clients[0].writeTimeout)
+	suite.manager.sessionManagerMu.RUnlock()
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte("0123456789!")))
+	_, err = readWithTimeout(sender, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.CloseMessageTooBig))
+}
+
+func (suite *OptionsTestSuite) TestRateLimitDropsExcessMessages() {
+	suite.start(WithRateLimit(5, 2, 0))
+	sender, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	for i := 0; i < 20; i++ {
+		assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte("flood")))
+	}
+	received := 0
+	for {
+		if _, err := readWithTimeout(receiver, 300*time.Millisecond); err != nil {
+			break
+		}
+		received++
+	}
+	// the burst plus whatever refilled while the flood was sent
+	assert.GreaterOrEqual(suite.T(), received, 2)
+	assert.LessOrEqual(suite.T(), received, 4)
+	assert.Equal(suite.T(), uint64(20-received), suite.manager.Metrics().RateLimitedMessages)
+}
+
+func (suite *OptionsTestSuite) TestRateLimitClosesAbusiveConnection() {
+	suite.start(WithRateLimit(1, 1, 5))
+	sender, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	for i := 0; i < 10; i++ {
+		sender.WriteMessage(websocket.TextMessage, []byte("flood"))
+	}
+	_, err = readWithTimeout(sender, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.ClosePolicyViolation))
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+}
+
+func (suite *OptionsTestSuite) TestByteRateLimitNotifiesSender() {
+	suite.start(
+		WithConnectionRateLimit(RateLimit{Bytes: 1, ByteBurst: 10}),
+		WithRateLimitAction(RateLimitNotify),
+	)
+	sender, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte("0123456")))
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte("789abc")))
+	message, err := readWithTimeout(receiver, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "0123456", message)
+
+	message, err = readWithTimeout(sender, time.Second)
+	assert.NoError(suite.T(), err)
+	var env Envelope
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &env))
+	assert.Equal(suite.T(), "error", env.Type)
+	assert.JSONEq(suite.T(), `{"error":"rate limit exceeded","scope":"connection"}`, string(env.Payload))
+	assert.Equal(suite.T(), uint64(1), suite.manager.Metrics().RateLimitedMessages)
+}
+
+func (suite *OptionsTestSuite) TestSessionRateLimitDisconnects() {
+	suite.start(
+		WithSessionRateLimit(RateLimit{Messages: 0.1, MessageBurst: 2}),
+		WithRateLimitAction(RateLimitDisconnect),
+	)
+	first, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	second, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	// each connection is well behaved, but together they exceed the session
+	assert.NoError(suite.T(), first.WriteMessage(websocket.TextMessage, []byte("one")))
+	message, err := readWithTimeout(second, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "one", message)
+	assert.NoError(suite.T(), second.WriteMessage(websocket.TextMessage, []byte("two")))
+	message, err = readWithTimeout(first, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "two", message)
+
+	assert.NoError(suite.T(), first.WriteMessage(websocket.TextMessage, []byte("three")))
+	_, err = readWithTimeout(first, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, CloseRateLimited))
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+}
+
+func (suite *OptionsTestSuite) TestOversizedInboundMessageRemovesSender() {
+	suite.start(WithMaxMessageSize(10))
+	sender, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte("0123456789!")))
+
+	_, err = readWithTimeout(sender, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.CloseMessageTooBig))
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	_, err = readWithTimeout(receiver, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), uint64(0), suite.manager.Metrics().Broadcasts)
+}
+
+func (suite *OptionsTestSuite) TestOversizedMessageGetsErrorEnvelope() {
+	disconnects := make(chan error, 1)
+	suite.start(
+		WithProtocolMode(true),
+		WithMaxMessageSize(32),
+		WithOnDisconnect(func(sessionKey, clientID string, err error) {
+			disconnects <- err
+		}),
+	)
+	sender, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte(`{"type":"chat","payload":"`+strings.Repeat("x", 64)+`"}`)))
+	message, err := readWithTimeout(sender, time.Second)
+	assert.NoError(suite.T(), err)
+	var env Envelope
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &env))
+	assert.Equal(suite.T(), "error", env.Type)
+	assert.JSONEq(suite.T(), `{"error":"message too big","limit":32}`, string(env.Payload))
+	_, err = readWithTimeout(sender, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.CloseMessageTooBig))
+	select {
+	case err := <-disconnects:
+		assert.Equal(suite.T(), websocket.ErrReadLimit, err)
+	case <-time.After(time.Second):
+		suite.T().Error("expected a disconnect")
+	}
+}
+
+func (suite *OptionsTestSuite) TestPresenceEventsOnJoinAndLeave() {
+	suite.start(WithPresenceEvents(true))
+	watcher, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	peer, peerID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+
+	message, err := readWithTimeout(watcher, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.JSONEq(suite.T(), `{"type":"join","clientID":"`+peerID+`"}`, message)
+	conns, err := suite.manager.GetSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), conns, 2)
+
+	peer.Close()
+	message, err = readWithTimeout(watcher, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.JSONEq(suite.T(), `{"type":"leave","clientID":"`+peerID+`","code":1006}`, message)
+}
+
+func (suite *OptionsTestSuite) TestAnnouncementsCarryClientDetails() {
+	suite.start(WithAnnouncements(true), WithClientMetadata(func(r *http.Request, sessionKey string) map[string]interface{} {
+		return map[string]interface{}{"color": r.URL.Query().Get("color")}
+	}))
+	watcher, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	peer, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "name=bob&color=red", nil)
+	assert.NoError(suite.T(), err)
+	peerID := resp.Header.Get(ClientIDHeader)
+
+	payload := `{"clientID":"` + peerID + `","name":"bob","role":"participant","metadata":{"color":"red"}}`
+	for _, eventType := range []string{"system.join", "system.leave"} {
+		message, err := readWithTimeout(watcher, time.Second)
+		assert.NoError(suite.T(), err)
+		var env Envelope
+		assert.NoError(suite.T(), json.Unmarshal([]byte(message), &env))
+		assert.Equal(suite.T(), eventType, env.Type)
+		assert.Equal(suite.T(), "", env.Sender)
+		assert.Equal(suite.T(), suite.sessionKey, env.SessionKey)
+		if eventType == "system.join" {
+			assert.JSONEq(suite.T(), payload, string(env.Payload))
+			peer.Close()
+		} else {
+			assert.JSONEq(suite.T(), payload[:len(payload)-1]+`,"code":1006}`, string(env.Payload))
+		}
+	}
+}
+
+func (suite *OptionsTestSuite) TestPresenceLeaveOnReapedConnection() {
+	suite.start(WithPresenceEvents(true), WithKeepalive(50*time.Millisecond, 100*time.Millisecond))
+	watcher, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	// the dead peer never reads, so it never answers pings
+	_, deadID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+
+	message, err := readWithTimeout(watcher, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), message, `"join"`)
+	message, err = readWithTimeout(watcher, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.JSONEq(suite.T(), `{"type":"leave","clientID":"`+deadID+`","code":1006}`, message)
+}
+
+func (suite *OptionsTestSuite) TestIdleConnTimeoutDropsSilentConnection() {
+	disconnects := make(chan error, 1)
+	suite.start(
+		WithKeepalive(50*time.Millisecond, 100*time.Millisecond),
+		WithIdleConnTimeout(300*time.Millisecond),
+		WithOnDisconnect(func(sessionKey, clientID string, err error) {
+			disconnects <- err
+		}),
+	)
+	silent, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	active, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	// the silent connection answers pings but never speaks
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := silent.ReadMessage(); err != nil {
+				closed <- err
+				return
+			}
+		}
+	}()
+	go func() {
+		for {
+			if _, _, err := active.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		assert.NoError(suite.T(), active.WriteMessage(websocket.TextMessage, []byte("still here")))
+		time.Sleep(60 * time.Millisecond)
+	}
+
+	select {
+	case err := <-disconnects:
+		var netErr net.Error
+		if assert.ErrorAs(suite.T(), err, &netErr) {
+			assert.True(suite.T(), netErr.Timeout())
+		}
+	case <-time.After(time.Second):
+		suite.T().Error("expected a disconnect")
+	}
+	assert.True(suite.T(), websocket.IsCloseError(<-closed, CloseNoActivity))
+	conns, err := suite.manager.GetSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), conns, 1)
+}
+
+func (suite *OptionsTestSuite) TestIdleEvictionWarnsThenCloses() {
+	suite.start(WithIdleEviction(300*time.Millisecond, 150*time.Millisecond))
+	lurker, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	message, err := readWithTimeout(lurker, time.Second)
+	assert.NoError(suite.T(), err)
+	var env Envelope
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &env))
+	assert.Equal(suite.T(), "system.idle", env.Type)
+	var warning idleWarning
+	assert.NoError(suite.T(), json.Unmarshal(env.Payload, &warning))
+	assert.InDelta(suite.T(), 150, warning.ClosesInMs, 50)
+
+	_, err = readWithTimeout(lurker, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, CloseNoActivity))
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+}
+
+func (suite *OptionsTestSuite) TestIdleEvictionIsResetByTraffic() {
+	suite.start(WithIdleEviction(300*time.Millisecond, 150*time.Millisecond))
+	talker, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	listener, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	// the listener never speaks but keeps receiving the talker's messages
+	for i := 0; i < 8; i++ {
+		assert.NoError(suite.T(), talker.WriteMessage(websocket.TextMessage, []byte("still here")))
+		message, err := readWithTimeout(listener, time.Second)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "still here", message)
+		time.Sleep(80 * time.Millisecond)
+	}
+	conns, err := suite.manager.GetSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), conns, 2)
+}
+
+func (suite *OptionsTestSuite) TestLifecycleCallbacks() {
+	connects := make(chan string, 2)
+	disconnects := make(chan error, 2)
+	suite.start(
+		WithOnConnect(func(sessionKey, clientID string) {
+			// callbacks run outside the lock, so calling back in is fine
+			conns, _ := suite.manager.GetSession(sessionKey)
+			assert.NotEmpty(suite.T(), conns)
+			connects <- clientID
+		}),
+		WithOnDisconnect(func(sessionKey, clientID string, err error) {
+			disconnects <- err
+		}),
+	)
+
+	clean, cleanID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), cleanID, <-connects)
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye")
+	clean.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	select {
+	case err := <-disconnects:
+		assert.NoError(suite.T(), err)
+	case <-time.After(time.Second):
+		suite.T().Error("expected a disconnect")
+	}
+
+	dropped, _, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	<-connects
+	dropped.Close()
+	select {
+	case err := <-disconnects:
+		assert.Error(suite.T(), err)
+	case <-time.After(time.Second):
+		suite.T().Error("expected a disconnect")
+	}
+}
+
+func (suite *OptionsTestSuite) TestRegisteredHooksSurvivePanics() {
+	logger := &recordingLogger{entries: map[string][]string{}}
+	suite.start(WithLogger(logger))
+	connects := make(chan string, 1)
+	messages := make(chan string, 1)
+	disconnects := make(chan string, 1)
+	suite.manager.OnConnect(func(sessionKey, clientID string) {
+		panic("connect hook")
+	})
+	suite.manager.OnConnect(func(sessionKey, clientID string) {
+		connects <- clientID
+	})
+	suite.manager.OnMessage(func(sessionKey, clientID string, messageType int, data []byte) {
+		if string(data) == "boom" {
+			panic("message hook")
+		}
+		messages <- string(data)
+	})
+	suite.manager.OnDisconnect(func(sessionKey, clientID string, err error) {
+		disconnects <- clientID
+	})
+
+	sender, senderID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), senderID, <-connects)
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	<-connects
+
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte("boom")))
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte("hello")))
+	assert.Equal(suite.T(), "hello", <-messages)
+	for _, expected := range []string{"boom", "hello"} {
+		message, err := readWithTimeout(receiver, time.Second)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), expected, message)
+	}
+
+	sender.Close()
+	select {
+	case clientID := <-disconnects:
+		assert.Equal(suite.T(), senderID, clientID)
+	case <-time.After(time.Second):
+		suite.T().Error("expected a disconnect")
+	}
+	assert.Len(suite.T(), logger.get("error"), 3)
+}
+
+func (suite *OptionsTestSuite) TestEnvelopeModeIdentifiesSender() {
+	suite.start(WithEnvelopeMode(true))
+	conn1, conn1ID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	conn2, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	conn3, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 3))
+
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+	conn1.WriteMessage(websocket.TextMessage, []byte("hello"))
+	conn1.WriteMessage(websocket.BinaryMessage, []byte{0x00, 0x01, 0x02})
+
+	for _, peer := range []*websocket.Conn{conn2, conn3} {
+		var text envelope
+		peer.SetReadDeadline(time.Now().Add(time.Second))
+		assert.NoError(suite.T(), peer.ReadJSON(&text))
+		assert.Equal(suite.T(), conn1ID, text.From)
+		assert.Equal(suite.T(), "hello", text.Data)
+		assert.False(suite.T(), text.Binary)
+		assert.GreaterOrEqual(suite.T(), text.TS, before)
+
+		var binary envelope
+		assert.NoError(suite.T(), peer.ReadJSON(&binary))
+		assert.Equal(suite.T(), conn1ID, binary.From)
+		assert.Equal(suite.T(), "AAEC", binary.Data)
+		assert.True(suite.T(), binary.Binary)
+	}
+}
+
+func (suite *OptionsTestSuite) TestAutoRegisterCreatesSessionOnDial() {
+	suite.start(WithAutoRegister(true))
+	sender, err := dialSession(suite.server, "dynamic", "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(suite.server, "dynamic", "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, "dynamic", 2))
+
+	sender.WriteMessage(websocket.TextMessage, []byte("hello"))
+	message, err := readWithTimeout(receiver, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "hello", message)
+}
+
+func (suite *OptionsTestSuite) TestAutoRegisteredSessionIsCollected() {
+	suite.start(WithAutoRegister(true))
+	conn, err := dialSession(suite.server, "dynamic", "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, "dynamic", 1))
+	conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, "dynamic", 0))
+
+	suite.manager.GarbageCollectDaily()
+	suite.manager.GarbageCollectDaily()
+	_, err = suite.manager.GetSession("dynamic")
+	assert.EqualError(suite.T(), err, "Session dynamic not found")
+}
+
+func (suite *OptionsTestSuite) TestAutoRegisterIsCappedAndValidated() {
+	suite.start(WithAutoRegister(true), WithMaxSessions(2))
+	suite.manager.SetKeyValidator(func(sessionKey string) error {
+		if strings.HasPrefix(sessionKey, "admin") {
+			return errors.New("Session key is reserved")
+		}
+		return nil
+	})
+	_, resp, err := dialSessionWithHeader(suite.server, "adminroom", "", nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode)
+
+	first, err := dialSession(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	defer first.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 1))
+
+	_, resp, err = dialSessionWithHeader(suite.server, "roomtwo", "", nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, resp.StatusCode)
+	assert.EqualError(suite.T(), suite.manager.RegisterSession("roomthree"), "Too many sessions")
+	_, err = suite.manager.CreateSession()
+	assert.EqualError(suite.T(), err, "Too many sessions")
+
+	second, err := dialSession(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	defer second.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 2))
+	assert.ElementsMatch(suite.T(), []string{suite.sessionKey, "roomone"}, suite.manager.ListSessions())
+}
+
+func (suite *OptionsTestSuite) TestTotalConnectionsAreCapped() {
+	events := []LimitEvent{}
+	suite.start(WithMaxTotalConnections(2), WithOnLimit(func(event LimitEvent) {
+		events = append(events, event)
+	}))
+	assert.NoError(suite.T(), suite.manager.RegisterSession("roomone"))
+	first, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer first.Close()
+	second, err := dialSession(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	defer second.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 1))
+
+	_, resp, err := dialSessionWithHeader(suite.server, "roomone", "", nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(suite.T(), uint64(1), suite.manager.Metrics().ConnectionLimitHits)
+	suite.manager.sessionManagerMu.RLock()
+	assert.Equal(suite.T(), []LimitEvent{{Limit: LimitConnections, SessionKey: "roomone"}}, events)
+	suite.manager.sessionManagerMu.RUnlock()
+
+	first.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+	third, err := dialSession(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	defer third.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 2))
+}
+
+func (suite *OptionsTestSuite) TestLimitPolicyEvictsLeastRecentlyUsed() {
+	events := []LimitEvent{}
+	suite.start(
+		WithMaxSessions(2),
+		WithMaxTotalConnections(2),
+		WithLimitPolicy(LimitEvictLRU),
+		WithOnLimit(func(event LimitEvent) {
+			events = append(events, event)
+		}),
+	)
+	assert.NoError(suite.T(), suite.manager.RegisterSession("roomone"))
+	suite.manager.sessionManagerMu.Lock()
+	suite.manager.sessions[suite.sessionKey].lastUsed = time.Now().Add(-time.Hour)
+	suite.manager.sessionManagerMu.Unlock()
+	assert.NoError(suite.T(), suite.manager.RegisterSession("roomtwo"))
+	assert.ElementsMatch(suite.T(), []string{"roomone", "roomtwo"}, suite.manager.ListSessions())
+
+	quiet, quietID, err := dialSessionWithID(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	defer quiet.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 1))
+	busy, err := dialSession(suite.server, "roomtwo", "")
+	assert.NoError(suite.T(), err)
+	defer busy.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomtwo", 1))
+	newcomer, err := dialSession(suite.server, "roomtwo", "")
+	assert.NoError(suite.T(), err)
+	defer newcomer.Close()
+
+	_, err = readWithTimeout(quiet, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.CloseTryAgainLater))
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomtwo", 2))
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 0))
+	metrics := suite.manager.Metrics()
+	assert.Equal(suite.T(), uint64(1), metrics.SessionLimitHits)
+	assert.Equal(suite.T(), uint64(1), metrics.ConnectionLimitHits)
+	suite.manager.sessionManagerMu.RLock()
+	assert.Equal(suite.T(), []LimitEvent{
+		{Limit: LimitSessions, SessionKey: "roomtwo", Evicted: suite.sessionKey},
+		{Limit: LimitConnections, SessionKey: "roomtwo", Evicted: quietID},
+	}, events)
+	suite.manager.sessionManagerMu.RUnlock()
+}
+
+func (suite *OptionsTestSuite) TestCompressionIsNegotiated() {
+	suite.start(WithCompression(true), WithCompressionLevel(flate.BestCompression))
+
+	url := "ws" + strings.TrimPrefix(suite.server.URL, "http") + "/" + suite.sessionKey
+	dialer := websocket.Dialer{EnableCompression: true}
+	compressed, resp, err := dialer.Dial(url, nil)
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+	plain, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), resp.Header.Get("Sec-WebSocket-Extensions"))
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	payload := strings.Repeat(`{"kind":"tick"}`, 100)
+	compressed.WriteMessage(websocket.TextMessage, []byte(payload))
+	message, err := readWithTimeout(plain, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), payload, message)
+	plain.WriteMessage(websocket.TextMessage, []byte(payload))
+	message, err = readWithTimeout(compressed, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), payload, message)
+}
+
+func (suite *OptionsTestSuite) TestParallelBroadcastMixesCompressedConnections() {
+	suite.start(WithCompression(true), WithCompressionThreshold(64), WithParallelBroadcast(4))
+
+	url := "ws" + strings.TrimPrefix(suite.server.URL, "http") + "/" + suite.sessionKey
+	dialer := websocket.Dialer{EnableCompression: true}
+	conns := []*websocket.Conn{}
+	for i := 0; i < 4; i++ {
+		d := websocket.DefaultDialer
+		if i%2 == 0 {
+			d = &dialer
+		}
+		conn, _, err := d.Dial(url, nil)
+		assert.NoError(suite.T(), err)
+		conns = append(conns, conn)
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 4))
+	clients, err := suite.manager.GetClients(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	compressed := 0
+	for _, info := range clients {
+		if info.Compressed {
+			compressed++
+		}
+	}
+	assert.Equal(suite.T(), 2, compressed)
+
+	for _, payload := range []string{"short", strings.Repeat(`{"kind":"tick"}`, 100)} {
+		assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte(payload)))
+		for _, conn := range conns {
+			message, err := readWithTimeout(conn, time.Second)
+			assert.NoError(suite.T(), err)
+			assert.Equal(suite.T(), payload, message)
+		}
+	}
+}
+
+func (suite *OptionsTestSuite) TestLoggerReceivesDiagnostics() {
+	logger := &recordingLogger{entries: map[string][]string{}}
+	suite.start(WithLogger(logger), WithAuthCheck(func(sessionKey string, r *http.Request) error {
+		return errors.New("no token")
+	}))
+
+	_, _, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), []string{"Authentication failed"}, logger.get("warn"))
+
+	suite.manager.collectStale(0)
+	assert.Equal(suite.T(), []string{"Evicting idle session"}, logger.get("info"))
+}
+
+func (suite *OptionsTestSuite) TestLogLevelFiltersDiagnostics() {
+	logger := &recordingLogger{entries: map[string][]string{}}
+	suite.start(WithLogLevel(LogWarn), WithLogger(logger), WithAuthCheck(func(sessionKey string, r *http.Request) error {
+		return errors.New("no token")
+	}))
+
+	_, _, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", nil)
+	assert.Error(suite.T(), err)
+	suite.manager.collectStale(0)
+	assert.Equal(suite.T(), []string{"Authentication failed"}, logger.get("warn"))
+	assert.Empty(suite.T(), logger.get("info"))
+	assert.Empty(suite.T(), logger.get("debug"))
+}
+
+func (suite *OptionsTestSuite) TestDefaultLevelIsInfo() {
+	logger := &recordingLogger{entries: map[string][]string{}}
+	suite.start(WithLogger(logger))
+
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+	suite.manager.collectStale(0)
+	assert.Empty(suite.T(), logger.get("debug"))
+	assert.Equal(suite.T(), []string{"Evicting idle session"}, logger.get("info"))
+}
+
+func (suite *OptionsTestSuite) TestLifecycleIsLoggedAtDebug() {
+	logger := &recordingLogger{entries: map[string][]string{}}
+	suite.start(WithLogLevel(LogDebug), WithLogger(logger))
+
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+	suite.manager.collectStale(time.Hour)
+	assert.Equal(suite.T(), []string{"Client joined", "Client left", "Collected idle sessions"}, logger.get("debug"))
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestOptionsTestSuite(t *testing.T) {
+	suite.Run(t, new(OptionsTestSuite))
+}
@@ -0,0 +1,277 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrSessionLocked refuses connections to a session locked with
+// LockSession.
+var ErrSessionLocked = errors.New("Session is locked")
+
+// WithSessionOwners gives every session an owner, who moderates it with
+// control messages:
+//
+//	{"control":"kick","clientID":"7","reason":"spam"}
+//	{"control":"mute","clientID":"7"}
+//	{"control":"unmute","clientID":"7"}
+//	{"control":"lock"}
+//	{"control":"unlock"}
+//	{"control":"transfer","clientID":"7"}
+//
+// The owner is the first connection to join, or a connection whose identity
+// isOwner reports as the owner's, e.g. the user who created the room in the
+// application's database; such a connection takes over ownership when it
+// joins, even a locked session. isOwner may be nil. When the owner leaves,
+// ownership passes to the longest connected remaining connection. Every
+// connection is told who the owner is when it joins and whenever the owner
+// changes:
+//
+//	{"type":"system.owner","sender":"","sessionKey":"abcdefgh","timestamp":1700000000000,"payload":{"clientID":"7"}}
+//
+// Control messages from anyone but the owner are answered with an "error"
+// envelope, as are those naming an unknown connection:
+//
+//	{"type":"error","sender":"","sessionKey":"abcdefgh","timestamp":1700000000000,"payload":{"error":"not the owner","control":"kick"}}
+func WithSessionOwners(isOwner func(sessionKey, identity string) bool) Option {
+	return func(sm *SessionManager) {
+		sm.sessionOwners = true
+		sm.isOwner = isOwner
+	}
+}
+
+// SessionOwner returns the client ID of the session's owner, empty if it
+// has none.
+func (sm *SessionManager) SessionOwner(sessionKey string) (string, error) {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return "", sessionNotFound(sessionKey)
+	}
+	return s.owner, nil
+}
+
+// TransferOwnership makes the connection with clientID the owner of the
+// session.
+func (sm *SessionManager) TransferOwnership(sessionKey, clientID string) error {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	cl, err := sm.findClient(sessionKey, clientID)
+	if err != nil {
+		return err
+	}
+	sm.setOwnerLocked(sm.sessions[sessionKey], cl.id)
+	return nil
+}
+
+// LockSession refuses new connections to the session while locked is set.
+// Dials are answered with 423 Locked; resumed clients and connections
+// WithSessionOwners designates as owner are still let in.
+func (sm *SessionManager) LockSession(sessionKey string, locked bool) error {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return sessionNotFound(sessionKey)
+	}
+	s.locked = locked
+	return nil
+}
+
+// MuteClient drops the data messages and control messages of the
+// connection with clientID while muted is set, telling it with an "error"
+// envelope:
+//
+//	{"type":"error","sender":"","sessionKey":"abcdefgh","timestamp":1700000000000,"payload":{"error":"muted"}}
+//
+// It still receives broadcasts and may acknowledge them with "ack" and
+// "qos-ack".
+func (sm *SessionManager) MuteClient(sessionKey, clientID string, muted bool) error {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	cl, err := sm.findClient(sessionKey, clientID)
+	if err != nil {
+		return err
+	}
+	cl.setMuted(muted)
+	return nil
+}
+
+func (cl *client) setMuted(muted bool) {
+	value := int32(0)
+	if muted {
+		value = 1
+	}
+	atomic.StoreInt32(&cl.muted, value)
+}
+
+func (cl *client) isMuted() bool {
+	return atomic.LoadInt32(&cl.muted) == 1
+}
+
+// sessionLocked reports whether sessionKey is locked by LockSession.
+func (sm *SessionManager) sessionLocked(sessionKey string) bool {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	return ok && s.locked
+}
+
+// designatedOwner reports whether isOwner designates identity as the owner
+// of sessionKey.
+func (sm *SessionManager) designatedOwner(sessionKey, identity string) bool {
+	return sm.sessionOwners && sm.isOwner != nil && sm.isOwner(sessionKey, identity)
+}
+
+// claimOwnershipLocked makes cl, which just joined s, its owner if s has
+// none or cl is the designated owner, and otherwise tells cl who the owner
+// is. The caller must hold sessionManagerMu.
+func (sm *SessionManager) claimOwnershipLocked(s *session, cl *client) {
+	if !sm.sessionOwners {
+		return
+	}
+	if s.owner == "" || cl.ownerCandidate {
+		sm.setOwnerLocked(s, cl.id)
+		return
+	}
+	if frame := ownerFrame(s); frame != nil {
+		if err := cl.write(websocket.TextMessage, frame); err != nil {
+			sm.logger.Warn("Owner notice failed", "session", s.key, "client", cl.id, "err", err)
+		}
+	}
+}
+
+// passOwnershipLocked hands the ownership of s on once cl, its owner, has
+// left. The caller must hold sessionManagerMu.
+func (sm *SessionManager) passOwnershipLocked(s *session, cl *client) {
+	if s.owner != cl.id {
+		return
+	}
+	next := ""
+	if len(s.clients) > 0 {
+		next = s.clients[0].id
+	}
+	sm.setOwnerLocked(s, next)
+}
+
+// setOwnerLocked makes clientID the owner of s and tells the session. The
+// caller must hold sessionManagerMu.
+func (sm *SessionManager) setOwnerLocked(s *session, clientID string) {
+	if s.owner == clientID {
+		return
+	}
+	s.owner = clientID
+	if frame := ownerFrame(s); frame != nil {
+		sm.writePeersLocked(s, nil, frame)
+	}
+}
+
+// ownerFrame returns the envelope naming the owner of s, nil if it has
+// none.
+func ownerFrame(s *session) []byte {
+	if s.owner == "" {
+		return nil
+	}
+	payload, err := json.Marshal(ownerNotice{ClientID: s.owner})
+	if err != nil {
+		return nil
+	}
+	frame, err := json.Marshal(Envelope{
+		Type:       "system.owner",
+		SessionKey: s.key,
+		Timestamp:  time.Now().UnixNano() / int64(time.Millisecond),
+		Payload:    payload,
+	})
+	if err != nil {
+		return nil
+	}
+	return frame
+}
+
+type ownerNotice struct {
+	ClientID string `json:"clientID"`
+}
+
+type moderationError struct {
+	Error   string `json:"error"`
+	Control string `json:"control,omitempty"`
+}
+
+// moderateLocked runs the moderation control msg from cl. It reports
+// whether msg was one. The caller must hold sessionManagerMu.
+func (sm *SessionManager) moderateLocked(sessionKey string, cl *client, msg controlMessage) bool {
+	switch msg.Control {
+	case "kick", "mute", "unmute", "lock", "unlock", "transfer":
+	default:
+		return false
+	}
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return true
+	}
+	if !sm.sessionOwners || s.owner != cl.id {
+		sm.rejectModeration(sessionKey, cl, "not the owner", msg.Control)
+		return true
+	}
+	switch msg.Control {
+	case "lock", "unlock":
+		s.locked = msg.Control == "lock"
+		return true
+	}
+	target := s.client(msg.ClientID)
+	if target == nil {
+		sm.rejectModeration(sessionKey, cl, "client not found", msg.Control)
+		return true
+	}
+	switch msg.Control {
+	case "kick":
+		if target == cl {
+			sm.rejectModeration(sessionKey, cl, "cannot kick yourself", msg.Control)
+			return true
+		}
+		code, reason := sm.kickLocked(s, target, msg.Reason)
+		sm.closeClient(target, code, reason)
+	case "mute", "unmute":
+		target.setMuted(msg.Control == "mute")
+	case "transfer":
+		sm.setOwnerLocked(s, target.id)
+	}
+	return true
+}
+
+// rejectModeration tells cl its control message was refused.
+func (sm *SessionManager) rejectModeration(sessionKey string, cl *client, reason, control string) {
+	sm.logger.Debug("Moderation refused", "session", sessionKey, "client", cl.id, "control", control, "reason", reason)
+	sm.sendError(sessionKey, cl, moderationError{Error: reason, Control: control})
+}
+
+// rejectMuted tells cl, which is muted, that its message was dropped.
+func (sm *SessionManager) rejectMuted(sessionKey string, cl *client) {
+	sm.logger.Debug("Message from muted client dropped", "session", sessionKey, "client", cl.id)
+	sm.sendError(sessionKey, cl, moderationError{Error: "muted"})
+}
+
+// sendError writes an "error" envelope with payload to cl.
+func (sm *SessionManager) sendError(sessionKey string, cl *client, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	frame, err := json.Marshal(Envelope{
+		Type:       "error",
+		SessionKey: sessionKey,
+		Timestamp:  time.Now().UnixNano() / int64(time.Millisecond),
+		Payload:    data,
+	})
+	if err != nil {
+		return
+	}
+	if err := cl.write(websocket.TextMessage, frame); err != nil {
+		sm.logger.Warn("Error notice failed", "session", sessionKey, "client", cl.id, "err", err)
+	}
+}
@@ -0,0 +1,147 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type OwnersTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *OwnersTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.start(WithSessionOwners(nil))
+}
+
+func (suite *OwnersTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+func (suite *OwnersTestSuite) start(opts ...Option) {
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, opts...)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+// readEnvelope reads the next envelope from conn and returns its type and
+// payload.
+func (suite *OwnersTestSuite) readEnvelope(conn *websocket.Conn) (string, string) {
+	message, err := readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	var env Envelope
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &env))
+	return env.Type, string(env.Payload)
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *OwnersTestSuite) TestOwnerModeratesSession() {
+	alice, aliceID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer alice.Close()
+	envType, payload := suite.readEnvelope(alice)
+	assert.Equal(suite.T(), "system.owner", envType)
+	assert.JSONEq(suite.T(), `{"clientID":"`+aliceID+`"}`, payload)
+	bob, bobID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer bob.Close()
+	_, payload = suite.readEnvelope(bob)
+	assert.JSONEq(suite.T(), `{"clientID":"`+aliceID+`"}`, payload)
+
+	bob.WriteJSON(controlMessage{Control: "kick", ClientID: aliceID})
+	envType, payload = suite.readEnvelope(bob)
+	assert.Equal(suite.T(), "error", envType)
+	assert.JSONEq(suite.T(), `{"error":"not the owner","control":"kick"}`, payload)
+
+	alice.WriteJSON(controlMessage{Control: "mute", ClientID: bobID})
+	assert.Eventually(suite.T(), func() bool {
+		clients, _ := suite.manager.GetClients(suite.sessionKey)
+		return len(clients) == 2 && clients[1].Muted
+	}, time.Second, 10*time.Millisecond)
+	bob.WriteMessage(websocket.TextMessage, []byte("hello"))
+	_, payload = suite.readEnvelope(bob)
+	assert.JSONEq(suite.T(), `{"error":"muted"}`, payload)
+	bob.WriteJSON(controlMessage{Control: "lock"})
+	_, payload = suite.readEnvelope(bob)
+	assert.JSONEq(suite.T(), `{"error":"muted"}`, payload)
+	alice.WriteJSON(controlMessage{Control: "unmute", ClientID: bobID})
+	assert.Eventually(suite.T(), func() bool {
+		clients, _ := suite.manager.GetClients(suite.sessionKey)
+		return len(clients) == 2 && !clients[1].Muted
+	}, time.Second, 10*time.Millisecond)
+
+	alice.WriteJSON(controlMessage{Control: "lock"})
+	assert.Eventually(suite.T(), func() bool {
+		stats, _ := suite.manager.GetSessionStats(suite.sessionKey)
+		return stats.Locked
+	}, time.Second, 10*time.Millisecond)
+	_, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", nil)
+	assert.Error(suite.T(), err)
+	if assert.NotNil(suite.T(), resp) {
+		assert.Equal(suite.T(), http.StatusLocked, resp.StatusCode)
+	}
+
+	alice.WriteJSON(controlMessage{Control: "transfer", ClientID: bobID})
+	for _, conn := range []*websocket.Conn{alice, bob} {
+		_, payload = suite.readEnvelope(conn)
+		assert.JSONEq(suite.T(), `{"clientID":"`+bobID+`"}`, payload)
+	}
+	bob.WriteJSON(controlMessage{Control: "kick", ClientID: aliceID, Reason: "bye"})
+	_, err = readWithTimeout(alice, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.ClosePolicyViolation))
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	owner, err := suite.manager.SessionOwner(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), bobID, owner)
+}
+
+func (suite *OwnersTestSuite) TestOwnershipPassesOnAndDesignatedOwnerTakesOver() {
+	suite.TearDownTest()
+	suite.start(WithAuth(headerAuth), WithSessionOwners(func(sessionKey, identity string) bool {
+		return identity == "boss"
+	}))
+	alice, _, err := dialSessionAs(suite.server, suite.sessionKey, "alice")
+	assert.NoError(suite.T(), err)
+	bob, resp, err := dialSessionAs(suite.server, suite.sessionKey, "bob")
+	assert.NoError(suite.T(), err)
+	defer bob.Close()
+	bobID := resp.Header.Get(ClientIDHeader)
+	suite.readEnvelope(bob)
+
+	alice.Close()
+	_, payload := suite.readEnvelope(bob)
+	assert.JSONEq(suite.T(), `{"clientID":"`+bobID+`"}`, payload)
+
+	assert.NoError(suite.T(), suite.manager.LockSession(suite.sessionKey, true))
+	boss, resp, err := dialSessionAs(suite.server, suite.sessionKey, "boss")
+	assert.NoError(suite.T(), err)
+	defer boss.Close()
+	bossID := resp.Header.Get(ClientIDHeader)
+	_, payload = suite.readEnvelope(bob)
+	assert.JSONEq(suite.T(), `{"clientID":"`+bossID+`"}`, payload)
+	owner, err := suite.manager.SessionOwner(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), bossID, owner)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestOwnersTestSuite(t *testing.T) {
+	suite.Run(t, new(OwnersTestSuite))
+}
@@ -0,0 +1,188 @@
+package ws_manager
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// WithUpgrader replaces the default upgrader, e.g. to change buffer sizes or
+// enable compression. A CheckOrigin set on u becomes the origin checker, as
+// if passed to SetOriginChecker; without one all origins are allowed.
+// Rejected origins fail the handshake with HTTP 403.
+func WithUpgrader(u websocket.Upgrader) Option {
+	return func(sm *SessionManager) {
+		if u.CheckOrigin != nil {
+			sm.originChecker = u.CheckOrigin
+		}
+		sm.upgrader = u
+		sm.upgrader.CheckOrigin = sm.checkOrigin
+	}
+}
+
+// maxSessionKeyLength bounds the session keys accepted on upgrade, before
+// any key validator runs.
+const maxSessionKeyLength = 128
+
+// UnknownSessionPolicy decides how EchoHandler answers a dial to a session
+// that is not registered.
+type UnknownSessionPolicy int
+
+const (
+	// UnknownSessionReject fails the handshake with HTTP 404.
+	UnknownSessionReject UnknownSessionPolicy = iota
+	// UnknownSessionClose completes the upgrade and immediately closes the
+	// connection with CloseUnknownSession and the reason "unknown_session",
+	// for clients that cannot inspect a failed handshake.
+	UnknownSessionClose
+)
+
+// CloseUnknownSession is the close code sent under UnknownSessionClose.
+const CloseUnknownSession = 4404
+
+// UnknownSessionFunc is called for every dial refused because its session
+// is not registered.
+type UnknownSessionFunc func(sessionKey string, r *http.Request)
+
+// WithUnknownSessionPolicy sets how dials to unregistered sessions are
+// refused. The default is UnknownSessionReject. Either way the dial is
+// counted in Metrics.UnknownSessionDials. Sessions created by
+// WithAutoRegister are never unknown.
+func WithUnknownSessionPolicy(policy UnknownSessionPolicy) Option {
+	return func(sm *SessionManager) {
+		sm.unknownSessionPolicy = policy
+	}
+}
+
+// WithOnUnknownSession calls fn for every dial refused because its session
+// is not registered, before it is refused. It runs outside the manager lock
+// and may call back into the manager.
+func WithOnUnknownSession(fn UnknownSessionFunc) Option {
+	return func(sm *SessionManager) {
+		sm.unknownSessionHooks = append(sm.unknownSessionHooks, fn)
+	}
+}
+
+// unknownSession counts a dial to the unregistered sessionKey and runs the
+// unknown session hooks.
+func (sm *SessionManager) unknownSession(sessionKey string, r *http.Request) {
+	sm.statsMu.Lock()
+	sm.metrics.UnknownSessionDials++
+	sm.statsMu.Unlock()
+	sm.logger.Info("Dial to unknown session refused", "session", sessionKey, "remote", r.RemoteAddr)
+	for _, hook := range sm.unknownSessionHooks {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					sm.logger.Error("Hook panicked", "hook", "unknown session", "session", sessionKey, "panic", p)
+				}
+			}()
+			hook(sessionKey, r)
+		}()
+	}
+}
+
+// WithCheckOrigin sets the initial origin checker. See SetOriginChecker.
+func WithCheckOrigin(check func(*http.Request) bool) Option {
+	return func(sm *SessionManager) {
+		sm.originChecker = check
+	}
+}
+
+// SetOriginChecker replaces the function used to accept or reject the Origin
+// of upgrade requests. It takes effect for the next upgrade; open connections
+// are unaffected. A nil checker restores the default, which allows all
+// origins.
+func (sm *SessionManager) SetOriginChecker(check func(*http.Request) bool) {
+	sm.policyMu.Lock()
+	defer sm.policyMu.Unlock()
+	sm.originChecker = check
+}
+
+// WithAllowedOrigins accepts only upgrade requests whose Origin matches one
+// of patterns, rejecting the rest with HTTP 403. See AllowOrigins.
+func WithAllowedOrigins(patterns ...string) Option {
+	return func(sm *SessionManager) {
+		sm.originChecker = AllowOrigins(patterns...)
+	}
+}
+
+// AllowOrigins returns an origin checker that accepts requests whose Origin
+// header matches one of patterns, ignoring case. A pattern is a full origin
+// such as "https://example.com" in which "*" stands for any run of
+// characters other than "/", e.g. "https://*.example.com" or
+// "http://localhost:*"; the pattern "*" alone allows every origin. Requests
+// without an Origin header do not come from a browser and are accepted.
+func AllowOrigins(patterns ...string) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		return originAllowed(strings.ToLower(origin), patterns)
+	}
+}
+
+func originAllowed(origin string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			return true
+		}
+		if ok, err := path.Match(strings.ToLower(pattern), origin); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SetKeyValidator replaces the function used to validate session keys on
+// upgrade and in RegisterSession. Requests whose key is rejected fail with
+// HTTP 400. A nil validator accepts every key within the length bounds.
+func (sm *SessionManager) SetKeyValidator(validate KeyValidator) {
+	sm.policyMu.Lock()
+	defer sm.policyMu.Unlock()
+	sm.keyValidator = validate
+}
+
+func (sm *SessionManager) checkOrigin(r *http.Request) bool {
+	sm.policyMu.RLock()
+	check := sm.originChecker
+	sm.policyMu.RUnlock()
+	if check == nil {
+		return CheckOrigin(r)
+	}
+	return check(r)
+}
+
+func (sm *SessionManager) validateKey(sessionKey string) error {
+	if sessionKey == "" {
+		return errors.New("Session key is empty")
+	}
+	if len(sessionKey) > maxSessionKeyLength {
+		return errors.New(
+			fmt.Sprintf("Session key is longer than %d characters", maxSessionKeyLength),
+		)
+	}
+	sm.policyMu.RLock()
+	validate := sm.keyValidator
+	sm.policyMu.RUnlock()
+	if validate == nil {
+		return nil
+	}
+	return validate(sessionKey)
+}
+
+// sessionAvailable reports whether a connection dialing sessionKey would
+// find a session to join.
+func (sm *SessionManager) sessionAvailable(sessionKey string) bool {
+	sm.sessionManagerMu.RLock()
+	defer sm.sessionManagerMu.RUnlock()
+	if _, ok := sm.sessions[sessionKey]; ok {
+		return true
+	}
+	return sm.autoRegister && !sm.shutDown && sm.roomForSessionLocked()
+}
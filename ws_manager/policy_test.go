@@ -0,0 +1,289 @@
+package ws_manager
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PolicyTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *PolicyTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey})
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *PolicyTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *PolicyTestSuite) TestOriginCheckerSwap() {
+	header := http.Header{}
+	header.Set("Origin", "https://evil.example")
+
+	conn, _, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", header)
+	assert.NoError(suite.T(), err)
+	conn.Close()
+
+	suite.manager.SetOriginChecker(func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "https://good.example"
+	})
+	_, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", header)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+
+	header.Set("Origin", "https://good.example")
+	conn, _, err = dialSessionWithHeader(suite.server, suite.sessionKey, "", header)
+	assert.NoError(suite.T(), err)
+	conn.Close()
+}
+
+func (suite *PolicyTestSuite) TestKeyValidatorSwap() {
+	suite.manager.SetKeyValidator(func(key string) error {
+		if len(key) != 8 {
+			return errors.New("bad key")
+		}
+		return nil
+	})
+	_, resp, err := dialSessionWithHeader(suite.server, "short", "", nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode)
+
+	conn, _, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", nil)
+	assert.NoError(suite.T(), err)
+	conn.Close()
+}
+
+func (suite *PolicyTestSuite) TestConcurrentSwapsAndUpgrades() {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			suite.manager.SetOriginChecker(func(r *http.Request) bool { return true })
+			suite.manager.SetKeyValidator(func(string) error { return nil })
+		}()
+		go func() {
+			defer wg.Done()
+			conn, _, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", nil)
+			if err == nil {
+				conn.Close()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (suite *PolicyTestSuite) TestUpgraderOption() {
+	sm := CreateSessionManager([]string{suite.sessionKey}, WithUpgrader(websocket.Upgrader{
+		ReadBufferSize:    4096,
+		WriteBufferSize:   2048,
+		EnableCompression: true,
+		CheckOrigin: func(r *http.Request) bool {
+			return r.Header.Get("Origin") == "https://good.example"
+		},
+	}))
+	defer sm.cronScheduler.Stop()
+	e := echo.New()
+	e.GET("/:sessionKey", sm.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	assert.Equal(suite.T(), 4096, sm.upgrader.ReadBufferSize)
+	assert.True(suite.T(), sm.upgrader.EnableCompression)
+
+	header := http.Header{}
+	header.Set("Origin", "https://evil.example")
+	_, resp, err := dialSessionWithHeader(server, suite.sessionKey, "", header)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+	conns, err := sm.GetSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), conns)
+
+	header.Set("Origin", "https://good.example")
+	_, _, err = dialSessionWithHeader(server, suite.sessionKey, "", header)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(sm, suite.sessionKey, 1))
+}
+
+func (suite *PolicyTestSuite) TestCheckOriginOption() {
+	sm := CreateSessionManager([]string{}, WithCheckOrigin(func(r *http.Request) bool { return false }))
+	defer sm.cronScheduler.Stop()
+	assert.False(suite.T(), sm.upgrader.CheckOrigin(httptest.NewRequest("GET", "/", nil)))
+}
+
+func (suite *PolicyTestSuite) TestAllowedOrigins() {
+	check := AllowOrigins("https://app.example", "https://*.example.com", "http://localhost:*")
+	for origin, allowed := range map[string]bool{
+		"":                           true,
+		"https://app.example":        true,
+		"HTTPS://App.Example":        true,
+		"https://eu.example.com":     true,
+		"https://example.com":        false,
+		"http://eu.example.com":      false,
+		"http://localhost:3000":      true,
+		"https://evil.example":       false,
+		"https://app.example.evil.x": false,
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		assert.Equal(suite.T(), allowed, check(r), origin)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://anything.example")
+	assert.True(suite.T(), AllowOrigins("*")(r))
+
+	sm := CreateSessionManager([]string{suite.sessionKey}, WithConfig(Config{
+		AllowedOrigins: []string{"https://good.example"},
+		CheckOrigin: func(r *http.Request) bool {
+			return r.Header.Get("Origin") == "https://partner.example"
+		},
+	}))
+	defer sm.cronScheduler.Stop()
+	e := echo.New()
+	e.GET("/:sessionKey", sm.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	header := http.Header{}
+	header.Set("Origin", "https://evil.example")
+	_, resp, err := dialSessionWithHeader(server, suite.sessionKey, "", header)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+	for _, origin := range []string{"https://good.example", "https://partner.example"} {
+		header.Set("Origin", origin)
+		conn, _, err := dialSessionWithHeader(server, suite.sessionKey, "", header)
+		if assert.NoError(suite.T(), err) {
+			conn.Close()
+		}
+	}
+}
+
+func (suite *PolicyTestSuite) TestMalformedKeyIsRejected() {
+	_, resp, err := dialSessionWithHeader(suite.server, strings.Repeat("k", maxSessionKeyLength+1), "", nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode)
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest("GET", "/", nil), rec)
+	assert.NoError(suite.T(), suite.manager.EchoHandler(c))
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+}
+
+func (suite *PolicyTestSuite) TestDefaultKeyValidator() {
+	_, resp, err := dialSessionWithHeader(suite.server, "bad%20key", "", nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode)
+
+	assert.EqualError(suite.T(), suite.manager.RegisterSession("bad key"), `Session key contains invalid character ' '`)
+	assert.Error(suite.T(), suite.manager.RegisterSession(""))
+}
+
+func (suite *PolicyTestSuite) TestGenerateSessionKey() {
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		key := GenerateSessionKey()
+		assert.False(suite.T(), seen[key])
+		seen[key] = true
+		assert.NoError(suite.T(), suite.manager.RegisterSession(key))
+	}
+}
+
+func (suite *PolicyTestSuite) TestCreateSession() {
+	key, err := suite.manager.CreateSession()
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), key, DefaultKeyLength)
+	_, err = suite.manager.GetSession(key)
+	assert.NoError(suite.T(), err)
+
+	sm := CreateSessionManager([]string{}, WithKeyFormat(1, "ab"))
+	defer sm.cronScheduler.Stop()
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		key, err := sm.CreateSession()
+		assert.NoError(suite.T(), err)
+		assert.False(suite.T(), seen[key])
+		seen[key] = true
+	}
+	_, err = sm.CreateSession()
+	assert.EqualError(suite.T(), err, "No unused session key found after 10 attempts")
+	assert.ErrorIs(suite.T(), err, ErrNoFreeSessionKey)
+}
+
+func (suite *PolicyTestSuite) TestCreateSessionRejectsBadFormats() {
+	sm := CreateSessionManager([]string{}, WithKeyFormat(64, "a b"))
+	defer sm.cronScheduler.Stop()
+	_, err := sm.CreateSession()
+	assert.Error(suite.T(), err)
+
+	sm.keyAlphabet = "a"
+	_, err = sm.CreateSession()
+	assert.Error(suite.T(), err)
+	sm.keyAlphabet, sm.keyLength = "ab", 0
+	_, err = sm.CreateSession()
+	assert.Error(suite.T(), err)
+}
+
+func (suite *PolicyTestSuite) TestUnknownSessionIsRejected() {
+	_, resp, err := dialSessionWithHeader(suite.server, "missing", "", nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+	assert.Equal(suite.T(), uint64(1), suite.manager.Metrics().UnknownSessionDials)
+}
+
+func (suite *PolicyTestSuite) TestUnknownSessionIsClosed() {
+	unknown := make(chan string, 1)
+	sm := CreateSessionManager([]string{},
+		WithConfig(Config{UnknownSession: UnknownSessionClose}),
+		WithOnUnknownSession(func(sessionKey string, r *http.Request) {
+			unknown <- sessionKey
+		}),
+	)
+	defer sm.cronScheduler.Stop()
+	e := echo.New()
+	e.GET("/:sessionKey", sm.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	conn, err := dialSession(server, "missing", "")
+	assert.NoError(suite.T(), err)
+	_, err = readWithTimeout(conn, time.Second)
+	var closeErr *websocket.CloseError
+	if assert.True(suite.T(), errors.As(err, &closeErr)) {
+		assert.Equal(suite.T(), CloseUnknownSession, closeErr.Code)
+		assert.Equal(suite.T(), "unknown_session", closeErr.Text)
+	}
+	assert.Equal(suite.T(), "missing", <-unknown)
+	assert.Equal(suite.T(), uint64(1), sm.Metrics().UnknownSessionDials)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestPolicyTestSuite(t *testing.T) {
+	suite.Run(t, new(PolicyTestSuite))
+}
@@ -0,0 +1,116 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WithPresenceEvents tells the rest of a session whenever a connection joins
+// or leaves it, including connections dropped by the server:
+//
+//	{"type":"join","clientID":"7"}
+//	{"type":"leave","clientID":"7","code":1000,"reason":"bye"}
+//
+// A leave event carries the code and reason of the close, see CloseInfo.
+func WithPresenceEvents(enabled bool) Option {
+	return func(sm *SessionManager) {
+		sm.presenceEvents = enabled
+	}
+}
+
+// WithAnnouncements tells the rest of a session whenever a connection joins
+// or leaves it with a server-originated Envelope carrying the connection's
+// details, for chat-style apps:
+//
+//	{"type":"system.join","sender":"","sessionKey":"abcdefgh","timestamp":1700000000000,"payload":{"clientID":"7","name":"alice","role":"participant"}}
+//
+// The leave announcement has type "system.leave" and its payload adds the
+// code and reason of the close. The payload also carries the connection's
+// metadata, if any.
+func WithAnnouncements(enabled bool) Option {
+	return func(sm *SessionManager) {
+		sm.announcements = enabled
+	}
+}
+
+type announcement struct {
+	ClientID string                 `json:"clientID"`
+	Name     string                 `json:"name,omitempty"`
+	Role     string                 `json:"role"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Code     int                    `json:"code,omitempty"`
+	Reason   string                 `json:"reason,omitempty"`
+}
+
+type presenceFrame struct {
+	Type     string `json:"type"`
+	ClientID string `json:"clientID"`
+	Code     int    `json:"code,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// presenceLocked sends a presence event about cl to every other connection
+// of s. Like the welcome frame it bypasses the broadcast counters. The caller
+// must hold sessionManagerMu and have already updated s.clients.
+func (sm *SessionManager) presenceLocked(s *session, eventType string, cl *client) {
+	if sm.announcements {
+		sm.announceLocked(s, eventType, cl)
+	}
+	if !sm.presenceEvents {
+		return
+	}
+	event := presenceFrame{Type: eventType, ClientID: cl.id}
+	if eventType == "leave" {
+		info := cl.closeInfo()
+		event.Code, event.Reason = info.Code, info.Reason
+	}
+	frame, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	sm.writePeersLocked(s, cl, frame)
+}
+
+// announceLocked sends the WithAnnouncements envelope about cl to every
+// other connection of s. The caller must hold sessionManagerMu.
+func (sm *SessionManager) announceLocked(s *session, eventType string, cl *client) {
+	a := announcement{
+		ClientID: cl.id,
+		Name:     cl.name,
+		Role:     cl.role,
+		Metadata: cl.metadata,
+	}
+	if eventType == "leave" {
+		info := cl.closeInfo()
+		a.Code, a.Reason = info.Code, info.Reason
+	}
+	payload, err := json.Marshal(a)
+	if err != nil {
+		sm.logger.Warn("Announcement failed", "session", s.key, "client", cl.id, "err", err)
+		return
+	}
+	frame, err := json.Marshal(Envelope{
+		Type:       "system." + eventType,
+		SessionKey: s.key,
+		Timestamp:  time.Now().UnixNano() / int64(time.Millisecond),
+		Payload:    payload,
+	})
+	if err != nil {
+		return
+	}
+	sm.writePeersLocked(s, cl, frame)
+}
+
+// writePeersLocked writes frame to every connection of s but cl.
+func (sm *SessionManager) writePeersLocked(s *session, cl *client, frame []byte) {
+	for _, peer := range s.clients {
+		if peer == cl {
+			continue
+		}
+		if err := peer.write(websocket.TextMessage, frame); err != nil {
+			sm.logger.Warn("Presence event failed", "session", s.key, "client", peer.id, "err", err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package ws_manager
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultMetricsSessionLimit = 10
+	maxMetricsSessionLimit     = 100
+)
+
+// WithMetricsSessionLimit sets how many of the busiest sessions get their own
+// labelled series in PrometheusHandler. Values are clamped to
+// [0, maxMetricsSessionLimit] to keep label cardinality bounded.
+func WithMetricsSessionLimit(n int) Option {
+	return func(sm *SessionManager) {
+		if n < 0 {
+			n = 0
+		}
+		if n > maxMetricsSessionLimit {
+			n = maxMetricsSessionLimit
+		}
+		sm.metricsSessionLimit = n
+	}
+}
+
+type sessionSample struct {
+	key         string
+	connections int
+	broadcasts  uint64
+	bytes       uint64
+}
+
+// PrometheusHandler serves the manager's metrics in the Prometheus text
+// exposition format. Per-session series are only emitted for the sessions
+// with the most broadcasts, up to the configured session limit.
+func (sm *SessionManager) PrometheusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		writeFamilies(&b, [][]metricFamily{sm.metricFamilies()}, nil)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(b.String()))
+	}
+}
+
+// metricFamily is a metric with its samples, rendered by writeFamilies.
+type metricFamily struct {
+	name    string
+	kind    string
+	help    string
+	samples []metricSample
+}
+
+// metricSample is a line of a metricFamily: the family name with suffix,
+// e.g. "_bucket", its rendered labels and its value.
+type metricSample struct {
+	suffix string
+	labels string
+	value  string
+}
+
+// metricFamilies returns the manager's metrics in exposition order.
+func (sm *SessionManager) metricFamilies() []metricFamily {
+	sm.rlockSessions()
+	sm.statsMu.Lock()
+	metrics := sm.metricsLocked()
+	latency := sm.broadcastLatency.snapshot()
+	sm.statsMu.Unlock()
+	connections := 0
+	samples := make([]sessionSample, 0, len(sm.sessions))
+	for key, s := range sm.sessions {
+		connections += len(s.clients)
+		samples = append(samples, sessionSample{
+			key:         key,
+			connections: len(s.clients),
+			broadcasts:  s.broadcasts,
+			bytes:       s.bytes,
+		})
+	}
+	sessions := len(sm.sessions)
+	limit := sm.metricsSessionLimit
+	sm.runlockSessions()
+
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].broadcasts != samples[j].broadcasts {
+			return samples[i].broadcasts > samples[j].broadcasts
+		}
+		return samples[i].key < samples[j].key
+	})
+	if len(samples) > limit {
+		samples = samples[:limit]
+	}
+
+	families := []metricFamily{
+		metric("wstome_sessions", "gauge", "Number of registered sessions.", float64(sessions)),
+		metric("wstome_connections", "gauge", "Number of open connections.", float64(connections)),
+		metric("wstome_broadcasts_total", "counter", "Broadcasts sent.", float64(metrics.Broadcasts)),
+		metric("wstome_relayed_bytes_total", "counter", "Payload bytes written to recipients.", float64(metrics.BytesRelayed)),
+		metric("wstome_received_messages_total", "counter", "Inbound data messages.", float64(metrics.MessagesReceived)),
+		metric("wstome_received_bytes_total", "counter", "Payload bytes of inbound data messages.", float64(metrics.BytesReceived)),
+		metric("wstome_evictions_total", "counter", "Sessions removed by garbage collection.", float64(metrics.Evictions)),
+		metric("wstome_dropped_messages_total", "counter", "Messages that could not be delivered to a recipient.", float64(metrics.DroppedMessages)),
+		metric("wstome_vetoed_broadcasts_total", "counter", "Broadcasts blocked by the pre-broadcast hook.", float64(metrics.VetoedBroadcasts)),
+		metric("wstome_duplicate_messages_total", "counter", "Inbound messages dropped as duplicates.", float64(metrics.DuplicateMessages)),
+		metric("wstome_rate_limited_messages_total", "counter", "Inbound messages dropped by the rate limiter.", float64(metrics.RateLimitedMessages)),
+		metric("wstome_connects_total", "counter", "Connections that joined a session.", float64(metrics.Connects)),
+		metric("wstome_disconnects_total", "counter", "Connections that left a session.", float64(metrics.Disconnects)),
+		metric("wstome_write_failures_total", "counter", "Connections dropped after a failed write.", float64(metrics.WriteFailures)),
+		metric("wstome_unknown_session_dials_total", "counter", "Dials refused because their session is not registered.", float64(metrics.UnknownSessionDials)),
+		metric("wstome_session_limit_hits_total", "counter", "Times the session cap was hit.", float64(metrics.SessionLimitHits)),
+		metric("wstome_connection_limit_hits_total", "counter", "Times the total connection cap was hit.", float64(metrics.ConnectionLimitHits)),
+		metric("wstome_slow_consumers_total", "counter", "Times a connection became a slow consumer.", float64(metrics.SlowConsumers)),
+		metric("wstome_slow_consumer_disconnects_total", "counter", "Slow consumers disconnected.", float64(metrics.SlowConsumerDisconnects)),
+		histogram("wstome_broadcast_duration_seconds", "Time taken to write a broadcast to its recipients.", latency),
+	}
+
+	perSession := []metricFamily{
+		{name: "wstome_session_connections", kind: "gauge", help: "Open connections in the busiest sessions."},
+		{name: "wstome_session_broadcasts_total", kind: "counter", help: "Broadcasts sent in the busiest sessions."},
+		{name: "wstome_session_relayed_bytes_total", kind: "counter", help: "Payload bytes relayed in the busiest sessions."},
+	}
+	for _, sample := range samples {
+		labels := fmt.Sprintf("session=\"%s\"", escapeLabel(sample.key))
+		perSession[0].samples = append(perSession[0].samples, metricSample{labels: labels, value: fmt.Sprint(sample.connections)})
+		perSession[1].samples = append(perSession[1].samples, metricSample{labels: labels, value: fmt.Sprint(sample.broadcasts)})
+		perSession[2].samples = append(perSession[2].samples, metricSample{labels: labels, value: fmt.Sprint(sample.bytes)})
+	}
+	return append(families, perSession...)
+}
+
+func metric(name, kind, help string, value float64) metricFamily {
+	return metricFamily{
+		name:    name,
+		kind:    kind,
+		help:    help,
+		samples: []metricSample{{value: fmt.Sprintf("%g", value)}},
+	}
+}
+
+func histogram(name, help string, h latencyHistogram) metricFamily {
+	family := metricFamily{name: name, kind: "histogram", help: help}
+	var cumulative uint64
+	for i, bound := range broadcastLatencyBuckets {
+		cumulative += h.counts[i]
+		family.samples = append(family.samples, metricSample{
+			suffix: "_bucket",
+			labels: fmt.Sprintf("le=\"%g\"", bound),
+			value:  fmt.Sprint(cumulative),
+		})
+	}
+	family.samples = append(family.samples,
+		metricSample{suffix: "_bucket", labels: `le="+Inf"`, value: fmt.Sprint(h.count)},
+		metricSample{suffix: "_sum", value: fmt.Sprintf("%g", h.sum)},
+		metricSample{suffix: "_count", value: fmt.Sprint(h.count)},
+	)
+	return family
+}
+
+// writeFamilies writes the families of one or more managers, listed in
+// the same order, merging the samples of families with the same name under
+// one header. labels, if not nil, holds the label every sample of the
+// manager at the same index gets, e.g. its namespace.
+func writeFamilies(b *strings.Builder, managers [][]metricFamily, labels []string) {
+	if len(managers) == 0 {
+		return
+	}
+	for i, family := range managers[0] {
+		writeHeader(b, family.name, family.kind, family.help)
+		for j, families := range managers {
+			for _, sample := range families[i].samples {
+				sampleLabels := sample.labels
+				if labels != nil && sampleLabels != "" {
+					sampleLabels = labels[j] + "," + sampleLabels
+				} else if labels != nil {
+					sampleLabels = labels[j]
+				}
+				if sampleLabels != "" {
+					fmt.Fprintf(b, "%s%s{%s} %s\n", family.name, sample.suffix, sampleLabels, sample.value)
+				} else {
+					fmt.Fprintf(b, "%s%s %s\n", family.name, sample.suffix, sample.value)
+				}
+			}
+		}
+	}
+}
+
+func writeHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
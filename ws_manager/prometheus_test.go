@@ -0,0 +1,117 @@
+package ws_manager
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PrometheusTestSuite struct {
+	suite.Suite
+	manager *SessionManager
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *PrometheusTestSuite) TearDownTest() {
+	suite.manager.cronScheduler.Stop()
+}
+
+func (suite *PrometheusTestSuite) scrape() string {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	suite.manager.PrometheusHandler()(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.True(suite.T(), strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+	return rec.Body.String()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *PrometheusTestSuite) TestExposesManagerMetrics() {
+	suite.manager = CreateSessionManager([]string{"abcdefgh", "ijklmnop"})
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage("abcdefgh", "", websocket.TextMessage, []byte("hi")))
+
+	body := suite.scrape()
+	assert.Contains(suite.T(), body, "# TYPE wstome_sessions gauge\nwstome_sessions 2\n")
+	assert.Contains(suite.T(), body, "# TYPE wstome_broadcasts_total counter\nwstome_broadcasts_total 1\n")
+	assert.Contains(suite.T(), body, "wstome_connections 0\n")
+	assert.Contains(suite.T(), body, "wstome_evictions_total 0\n")
+	assert.Contains(suite.T(), body, `wstome_session_broadcasts_total{session="abcdefgh"} 1`)
+}
+
+func (suite *PrometheusTestSuite) TestExposesConnectionChurn() {
+	suite.manager = CreateSessionManager([]string{"abcdefgh"})
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	conn, err := dialSession(server, "abcdefgh", "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, "abcdefgh", 1))
+	conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, "abcdefgh", 0))
+
+	body := suite.scrape()
+	assert.Contains(suite.T(), body, "wstome_connects_total 1\n")
+	assert.Contains(suite.T(), body, "wstome_disconnects_total 1\n")
+	assert.Equal(suite.T(), uint64(1), suite.manager.Metrics().Connects)
+}
+
+func (suite *PrometheusTestSuite) TestExposesThroughputAndLatency() {
+	suite.manager = CreateSessionManager([]string{"abcdefgh"})
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	sender, err := dialSession(server, "abcdefgh", "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(server, "abcdefgh", "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, "abcdefgh", 2))
+	sender.WriteMessage(websocket.TextMessage, []byte("hello"))
+	_, err = readWithTimeout(receiver, time.Second)
+	assert.NoError(suite.T(), err)
+
+	body := suite.scrape()
+	assert.Contains(suite.T(), body, "wstome_received_bytes_total 5\n")
+	assert.Contains(suite.T(), body, "wstome_relayed_bytes_total 5\n")
+	assert.Contains(suite.T(), body, "# TYPE wstome_broadcast_duration_seconds histogram\n")
+	assert.Contains(suite.T(), body, "wstome_broadcast_duration_seconds_bucket{le=\"+Inf\"} 1\n")
+	assert.Contains(suite.T(), body, "wstome_broadcast_duration_seconds_bucket{le=\"1\"} 1\n")
+	assert.Contains(suite.T(), body, "wstome_broadcast_duration_seconds_count 1\n")
+}
+
+func (suite *PrometheusTestSuite) TestSessionSeriesAreCapped() {
+	keys := []string{}
+	for i := 0; i < 5; i++ {
+		keys = append(keys, fmt.Sprintf("session%d", i))
+	}
+	suite.manager = CreateSessionManager(keys, WithMetricsSessionLimit(2))
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage("session3", "", websocket.TextMessage, []byte("hi")))
+
+	body := suite.scrape()
+	assert.Equal(suite.T(), 2, strings.Count(body, "wstome_session_connections{"))
+	assert.Contains(suite.T(), body, `wstome_session_connections{session="session3"} 0`)
+}
+
+func (suite *PrometheusTestSuite) TestSessionLimitIsClamped() {
+	suite.manager = CreateSessionManager([]string{}, WithMetricsSessionLimit(1000000))
+	assert.Equal(suite.T(), maxMetricsSessionLimit, suite.manager.metricsSessionLimit)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestPrometheusTestSuite(t *testing.T) {
+	suite.Run(t, new(PrometheusTestSuite))
+}
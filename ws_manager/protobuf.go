@@ -0,0 +1,128 @@
+package ws_manager
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+// ProtobufCodec returns a codec, offered as "protobuf", that sends
+// envelopes as Protocol Buffers messages in binary frames, following
+//
+//	message Envelope {
+//	  string type = 1;
+//	  string sender = 2;
+//	  string session_key = 3;
+//	  int64 timestamp = 4;
+//	  bytes payload = 5; // JSON
+//	  bool replayed = 6;
+//	}
+//
+// The payload stays JSON, as protobuf has no schema-less values.
+func ProtobufCodec() Codec {
+	return protobufCodec{}
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string     { return "protobuf" }
+func (protobufCodec) MessageType() int { return websocket.BinaryMessage }
+
+const (
+	protoVarint = 0
+	protoBytes  = 2
+)
+
+func (protobufCodec) Encode(env Envelope) ([]byte, error) {
+	buf := []byte{}
+	buf = appendProtoBytes(buf, 1, []byte(env.Type))
+	buf = appendProtoBytes(buf, 2, []byte(env.Sender))
+	buf = appendProtoBytes(buf, 3, []byte(env.SessionKey))
+	if env.Timestamp != 0 {
+		buf = appendProtoVarint(buf, 4<<3|protoVarint)
+		buf = appendProtoVarint(buf, uint64(env.Timestamp))
+	}
+	buf = appendProtoBytes(buf, 5, env.Payload)
+	if env.Replayed {
+		buf = appendProtoVarint(buf, 6<<3|protoVarint)
+		buf = appendProtoVarint(buf, 1)
+	}
+	return buf, nil
+}
+
+func (protobufCodec) Decode(data []byte) (Envelope, error) {
+	var env Envelope
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return env, errors.New("Malformed protobuf tag")
+		}
+		data = data[n:]
+		field, wire := tag>>3, tag&7
+		switch wire {
+		case protoVarint:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return env, errors.New("Malformed protobuf varint")
+			}
+			data = data[n:]
+			switch field {
+			case 4:
+				env.Timestamp = int64(v)
+			case 6:
+				env.Replayed = v != 0
+			}
+		case protoBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return env, errors.New("Malformed protobuf length")
+			}
+			value := data[n : n+int(length)]
+			data = data[n+int(length):]
+			switch field {
+			case 1:
+				env.Type = string(value)
+			case 2:
+				env.Sender = string(value)
+			case 3:
+				env.SessionKey = string(value)
+			case 5:
+				env.Payload = append([]byte{}, value...)
+			}
+		case 1, 5:
+			// fixed64 and fixed32 fields are not part of the schema
+			size := 8
+			if wire == 5 {
+				size = 4
+			}
+			if len(data) < size {
+				return env, errors.New("Malformed protobuf fixed field")
+			}
+			data = data[size:]
+		default:
+			return env, errors.New(
+				fmt.Sprintf("Unsupported protobuf wire type %d", wire),
+			)
+		}
+	}
+	return env, nil
+}
+
+func appendProtoVarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+// appendProtoBytes appends a length-delimited field, leaving it out when
+// empty like proto3 does.
+func appendProtoBytes(buf []byte, field uint64, value []byte) []byte {
+	if len(value) == 0 {
+		return buf
+	}
+	buf = appendProtoVarint(buf, field<<3|protoBytes)
+	buf = appendProtoVarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
@@ -0,0 +1,121 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Envelope is the JSON frame exchanged in protocol mode:
+//
+//	{"type":"chat","sender":"3","sessionKey":"abcdefgh","timestamp":1700000000000,"payload":{"text":"hi"}}
+//
+// Timestamp is in Unix milliseconds. Payload is any JSON value.
+type Envelope struct {
+	Type       string          `json:"type"`
+	Sender     string          `json:"sender"`
+	SessionKey string          `json:"sessionKey"`
+	Timestamp  int64           `json:"timestamp"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	// Replayed marks envelopes replayed from the session history.
+	Replayed bool `json:"replayed,omitempty"`
+	// Seq is the broadcast's sequence number, see WithSequenceNumbers.
+	Seq uint64 `json:"seq,omitempty"`
+	// TTL is how long, in milliseconds, the envelope is replayed from the
+	// session history, see WithHistoryTTL.
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+// EnvelopeHandler handles an inbound envelope of the type it was registered
+// for. Returning ErrCloseConnection (possibly wrapped) closes the sender's
+// connection with ClosePolicyViolation; any other error is logged.
+type EnvelopeHandler func(env Envelope) error
+
+// WithProtocolMode makes connections accepted by EchoHandler speak
+// Envelope frames instead of raw bytes. Inbound frames that are not text
+// envelopes with a type are dropped. The manager fills in the sender,
+// session key and timestamp, so clients cannot forge them, checks it with
+// the validator registered for its type with ValidateEnvelope, if any, and
+// then passes it to the handler registered for its type with
+// HandleEnvelope, or broadcasts it to the session if there is none. Protocol mode replaces
+// WithEnvelopeMode; raw mode remains the default.
+func WithProtocolMode(enabled bool) Option {
+	return func(sm *SessionManager) {
+		sm.protocolMode = enabled
+	}
+}
+
+// HandleEnvelope routes inbound envelopes of type envelopeType to handler
+// instead of broadcasting them. It runs on the sender's read loop, outside
+// the manager lock, and may call back into the manager, e.g. SendTo to
+// reply. A later registration for the same type replaces the earlier one.
+func (sm *SessionManager) HandleEnvelope(envelopeType string, handler EnvelopeHandler) {
+	sm.policyMu.Lock()
+	defer sm.policyMu.Unlock()
+	if sm.envelopeHandlers == nil {
+		sm.envelopeHandlers = map[string]EnvelopeHandler{}
+	}
+	sm.envelopeHandlers[envelopeType] = handler
+}
+
+// BroadcastEnvelope sends payload, encoded as JSON, to every connection in
+// the session as a server-originated envelope of type envelopeType.
+func (sm *SessionManager) BroadcastEnvelope(sessionKey, envelopeType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	frame, err := json.Marshal(Envelope{
+		Type:       envelopeType,
+		SessionKey: sessionKey,
+		Timestamp:  time.Now().UnixNano() / int64(time.Millisecond),
+		Payload:    data,
+	})
+	if err != nil {
+		return err
+	}
+	return sm.BroadcastMessage(sessionKey, "", websocket.TextMessage, frame)
+}
+
+// dispatchEnvelope handles an inbound protocol mode frame from cl. It
+// returns the envelope to broadcast, or forward=false if the frame was
+// dropped or handled.
+func (sm *SessionManager) dispatchEnvelope(sessionKey string, cl *client, messageType int, message []byte) (frame []byte, forward bool) {
+	env, err := cl.decodeEnvelope(messageType, message)
+	if err != nil || env.Type == "" {
+		sm.logger.Debug("Malformed envelope dropped", "session", sessionKey, "client", cl.id)
+		return nil, false
+	}
+	env.Sender = cl.id
+	env.SessionKey = sessionKey
+	env.Timestamp = time.Now().UnixNano() / int64(time.Millisecond)
+	env.Replayed = false
+	env.Seq = 0
+
+	sm.policyMu.RLock()
+	validate := sm.envelopeValidators[env.Type]
+	handler, ok := sm.envelopeHandlers[env.Type]
+	sm.policyMu.RUnlock()
+	if validate != nil && !sm.endToEnd {
+		if err := validate(env); err != nil {
+			sm.rejectInvalid(sessionKey, cl, env.Type, err)
+			return nil, false
+		}
+	}
+	if !ok {
+		frame, err := json.Marshal(env)
+		if err != nil {
+			return nil, false
+		}
+		return frame, true
+	}
+	if err := handler(env); err != nil {
+		sm.logger.Debug("Envelope handler failed", "session", sessionKey, "client", cl.id, "type", env.Type, "err", err)
+		if errors.Is(err, ErrCloseConnection) {
+			sm.closeClient(cl, websocket.ClosePolicyViolation, "message rejected")
+		}
+	}
+	return nil, false
+}
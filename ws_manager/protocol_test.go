@@ -0,0 +1,99 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ProtocolTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *ProtocolTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithProtocolMode(true))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *ProtocolTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+func (suite *ProtocolTestSuite) readEnvelope(conn *websocket.Conn) Envelope {
+	var env Envelope
+	message, err := readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &env))
+	return env
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *ProtocolTestSuite) TestUnhandledEnvelopesAreBroadcast() {
+	sender, senderID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	sender.WriteMessage(websocket.TextMessage, []byte("not an envelope"))
+	sender.WriteMessage(websocket.TextMessage, []byte(`{"payload":"no type"}`))
+	sender.WriteMessage(websocket.TextMessage, []byte(`{"type":"chat","sender":"forged","payload":{"text":"hi"}}`))
+
+	env := suite.readEnvelope(receiver)
+	assert.Equal(suite.T(), "chat", env.Type)
+	assert.Equal(suite.T(), senderID, env.Sender)
+	assert.Equal(suite.T(), suite.sessionKey, env.SessionKey)
+	assert.WithinDuration(suite.T(), time.Now(), time.Unix(0, env.Timestamp*int64(time.Millisecond)), time.Second)
+	assert.JSONEq(suite.T(), `{"text":"hi"}`, string(env.Payload))
+}
+
+func (suite *ProtocolTestSuite) TestHandlersReceiveTheirType() {
+	suite.manager.HandleEnvelope("ping", func(env Envelope) error {
+		return suite.manager.SendTo(env.SessionKey, env.Sender, []byte(`{"type":"pong"}`))
+	})
+	sender, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	other, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	sender.WriteMessage(websocket.TextMessage, []byte(`{"type":"ping"}`))
+	assert.Equal(suite.T(), "pong", suite.readEnvelope(sender).Type)
+	_, err = readWithTimeout(other, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *ProtocolTestSuite) TestBroadcastEnvelope() {
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	err = suite.manager.BroadcastEnvelope(suite.sessionKey, "notice", map[string]string{"text": "restarting"})
+	assert.NoError(suite.T(), err)
+	env := suite.readEnvelope(conn)
+	assert.Equal(suite.T(), "notice", env.Type)
+	assert.Empty(suite.T(), env.Sender)
+	assert.JSONEq(suite.T(), `{"text":"restarting"}`, string(env.Payload))
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestProtocolTestSuite(t *testing.T) {
+	suite.Run(t, new(ProtocolTestSuite))
+}
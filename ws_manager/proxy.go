@@ -0,0 +1,139 @@
+package ws_manager
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// WithTrustedProxies names the reverse proxies and load balancers in front
+// of the manager, as IPs or CIDR ranges such as "10.0.0.0/8". For an
+// upgrade request arriving from one of them, the client address is taken
+// from X-Forwarded-For, skipping the trusted hops from the right, or from
+// X-Real-IP if there is no X-Forwarded-For. The address then stands for
+// the connection everywhere: ClientInfo.RemoteAddr, logs, BanAddress and
+// kick bans, and WithAddressRateLimit. Requests from other peers keep
+// their socket address, so clients cannot spoof the headers. Invalid
+// entries are logged and ignored.
+func WithTrustedProxies(proxies ...string) Option {
+	return func(sm *SessionManager) {
+		sm.trustedProxies = nil
+		sm.invalidProxies = nil
+		for _, proxy := range proxies {
+			if !strings.Contains(proxy, "/") {
+				if ip := net.ParseIP(proxy); ip != nil {
+					bits := 128
+					if v4 := ip.To4(); v4 != nil {
+						ip, bits = v4, 32
+					}
+					sm.trustedProxies = append(sm.trustedProxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+					continue
+				}
+			}
+			_, network, err := net.ParseCIDR(proxy)
+			if err != nil {
+				sm.invalidProxies = append(sm.invalidProxies, proxy)
+				continue
+			}
+			sm.trustedProxies = append(sm.trustedProxies, network)
+		}
+	}
+}
+
+// WithAddressRateLimit limits the inbound traffic of all the connections
+// from the same client address together, across sessions, so a client
+// cannot get around the connection limit by opening more connections. It
+// applies after the connection limit and before the session limit, and
+// reports the scope "address" under RateLimitNotify.
+func WithAddressRateLimit(limit RateLimit) Option {
+	return func(sm *SessionManager) {
+		sm.addrRateLimit = limit
+	}
+}
+
+// isTrustedProxy reports whether ip belongs to a trusted proxy.
+func (sm *SessionManager) isTrustedProxy(ip net.IP) bool {
+	for _, network := range sm.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the address of the client behind r: its socket
+// address, or the forwarded one if r comes from a trusted proxy.
+func (sm *SessionManager) clientAddr(r *http.Request) string {
+	if len(sm.trustedProxies) == 0 {
+		return r.RemoteAddr
+	}
+	peer := net.ParseIP(hostOf(r.RemoteAddr))
+	if peer == nil || !sm.isTrustedProxy(peer) {
+		return r.RemoteAddr
+	}
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hostOf(hops[i]))
+		if ip == nil {
+			// a hop we cannot read ends the chain we can trust
+			break
+		}
+		if i == 0 || !sm.isTrustedProxy(ip) {
+			return ip.String()
+		}
+	}
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+// addrLimiter is the rate limiter shared by the connections from one
+// client address.
+type addrLimiter struct {
+	limiter *rateLimiter
+	conns   int
+}
+
+// claimAddrLimiter returns the limiter of the address of cl, creating it
+// for its first connection, or nil if addresses are not limited.
+func (sm *SessionManager) claimAddrLimiter(cl *client) *rateLimiter {
+	if sm.addrRateLimit.Messages <= 0 && sm.addrRateLimit.Bytes <= 0 {
+		return nil
+	}
+	ip := hostOf(cl.addr)
+	sm.addrLimitersMu.Lock()
+	defer sm.addrLimitersMu.Unlock()
+	if sm.addrLimiters == nil {
+		sm.addrLimiters = map[string]*addrLimiter{}
+	}
+	l, ok := sm.addrLimiters[ip]
+	if !ok {
+		l = &addrLimiter{limiter: newRateLimiter(sm.addrRateLimit)}
+		sm.addrLimiters[ip] = l
+	}
+	l.conns++
+	return l.limiter
+}
+
+// releaseAddrLimiter drops the limiter of the address of cl once its last
+// connection is gone.
+func (sm *SessionManager) releaseAddrLimiter(cl *client) {
+	if cl.addrLimiter == nil {
+		return
+	}
+	ip := hostOf(cl.addr)
+	sm.addrLimitersMu.Lock()
+	defer sm.addrLimitersMu.Unlock()
+	if l, ok := sm.addrLimiters[ip]; ok {
+		l.conns--
+		if l.conns <= 0 {
+			delete(sm.addrLimiters, ip)
+		}
+	}
+}
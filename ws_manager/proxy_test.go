@@ -0,0 +1,135 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ProxyTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *ProxyTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.start(WithTrustedProxies("127.0.0.1", "10.0.0.0/8"))
+}
+
+func (suite *ProxyTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+func (suite *ProxyTestSuite) start(opts ...Option) {
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, opts...)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *ProxyTestSuite) dialFrom(forwardedFor string) (*websocket.Conn, *http.Response, error) {
+	header := http.Header{}
+	header.Set("X-Forwarded-For", forwardedFor)
+	return dialSessionWithHeader(suite.server, suite.sessionKey, "", header)
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *ProxyTestSuite) TestForwardedAddressIsUsed() {
+	conn, _, err := suite.dialFrom("203.0.113.7, 10.1.1.1")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	header := http.Header{}
+	header.Set("X-Real-IP", "198.51.100.2")
+	real, _, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", header)
+	assert.NoError(suite.T(), err)
+	defer real.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	clients, err := suite.manager.ListClients(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	addrs := []string{}
+	for _, info := range clients {
+		addrs = append(addrs, info.RemoteAddr)
+	}
+	assert.ElementsMatch(suite.T(), []string{"203.0.113.7", "198.51.100.2"}, addrs)
+
+	suite.manager.BanAddress(suite.sessionKey, "203.0.113.7", 0)
+	_, resp, err := suite.dialFrom("203.0.113.7")
+	assert.Error(suite.T(), err)
+	if assert.NotNil(suite.T(), resp) {
+		assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+	}
+	other, _, err := suite.dialFrom("203.0.113.8")
+	assert.NoError(suite.T(), err)
+	other.Close()
+}
+
+func (suite *ProxyTestSuite) TestUntrustedPeerKeepsSocketAddress() {
+	suite.TearDownTest()
+	suite.start(WithTrustedProxies("10.0.0.0/8", "not-an-ip"))
+	conn, _, err := suite.dialFrom("203.0.113.7")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	clients, err := suite.manager.ListClients(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	if assert.Len(suite.T(), clients, 1) {
+		assert.True(suite.T(), strings.HasPrefix(clients[0].RemoteAddr, "127.0.0.1:"))
+	}
+	assert.Len(suite.T(), suite.manager.trustedProxies, 1)
+}
+
+func (suite *ProxyTestSuite) TestAddressRateLimitIsShared() {
+	suite.TearDownTest()
+	suite.start(
+		WithTrustedProxies("127.0.0.1"),
+		WithAddressRateLimit(RateLimit{Messages: 0.1, MessageBurst: 1}),
+		WithRateLimitAction(RateLimitNotify),
+	)
+	first, _, err := suite.dialFrom("203.0.113.7")
+	assert.NoError(suite.T(), err)
+	defer first.Close()
+	second, _, err := suite.dialFrom("203.0.113.7")
+	assert.NoError(suite.T(), err)
+	defer second.Close()
+	listener, _, err := suite.dialFrom("198.51.100.2")
+	assert.NoError(suite.T(), err)
+	defer listener.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 3))
+
+	first.WriteMessage(websocket.TextMessage, []byte("one"))
+	message, err := readWithTimeout(listener, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "one", message)
+	_, err = readWithTimeout(second, time.Second)
+	assert.NoError(suite.T(), err)
+
+	second.WriteMessage(websocket.TextMessage, []byte("two"))
+	message, err = readWithTimeout(second, time.Second)
+	assert.NoError(suite.T(), err)
+	var env Envelope
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &env))
+	assert.Equal(suite.T(), "error", env.Type)
+	assert.JSONEq(suite.T(), `{"error":"rate limit exceeded","scope":"address"}`, string(env.Payload))
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestProxyTestSuite(t *testing.T) {
+	suite.Run(t, new(ProxyTestSuite))
+}
@@ -0,0 +1,176 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DeliveryStatus reports the outcome of a BroadcastQoS message for one
+// recipient. Acked is set once the recipient confirmed the message; when it
+// is not, Err says why delivery was given up.
+type DeliveryStatus struct {
+	SessionKey string
+	MessageID  uint64
+	ClientID   string
+	// Seq is the sequence number the message carried on the recipient's
+	// connection.
+	Seq      uint64
+	Attempts int
+	Acked    bool
+	Err      error
+}
+
+// DeliveryFunc receives the delivery status of a BroadcastQoS message,
+// once per recipient. It runs on its own goroutine without the manager
+// lock held.
+type DeliveryFunc func(status DeliveryStatus)
+
+// qosFrame is the frame a BroadcastQoS message is delivered in.
+type qosFrame struct {
+	Seq     uint64 `json:"seq"`
+	Message string `json:"message"`
+}
+
+type pendingDelivery struct {
+	messageID uint64
+	frame     []byte
+	attempts  int
+	backoff   time.Duration
+	timer     *time.Timer
+	onStatus  DeliveryFunc
+}
+
+// WithQoS enables BroadcastQoS, which delivers messages that must not be
+// lost. Each recipient gets the message in a text frame numbered on its
+// connection,
+//
+//	{"seq":7,"message":"..."}
+//
+// and confirms it with a control frame:
+//
+//	{"control":"qos-ack","seq":7}
+//
+// A message not confirmed within retryInterval is written again with the
+// same number, waiting twice as long after each retry, so recipients should
+// ignore numbers they have already seen. After maxRetries unconfirmed
+// retries the message is reported as failed.
+func WithQoS(retryInterval time.Duration, maxRetries int) Option {
+	return func(sm *SessionManager) {
+		sm.qosRetryInterval = retryInterval
+		sm.qosMaxRetries = maxRetries
+	}
+}
+
+// BroadcastQoS broadcasts message to the session with acknowledgement and
+// retries, see WithQoS. onStatus, which may be nil, is told the outcome for
+// every recipient, with the returned id as the MessageID. Connections whose
+// first write fails are dropped and reported as failed.
+func (sm *SessionManager) BroadcastQoS(sessionKey string, senderID string, message []byte, onStatus DeliveryFunc) (id uint64, err error) {
+	if sm.qosRetryInterval <= 0 {
+		return 0, errors.New("QoS is not enabled")
+	}
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return 0, sessionNotFound(sessionKey)
+	}
+	_, message, allow := sm.prepareBroadcastLocked(s, senderID, websocket.TextMessage, message, nil)
+	if !allow {
+		return 0, nil
+	}
+	id = atomic.AddUint64(&sm.qosMessages, 1)
+	for _, cl := range s.recipients(senderID, nil) {
+		cl.qosSeq++
+		frame, err := json.Marshal(qosFrame{Seq: cl.qosSeq, Message: string(message)})
+		if err != nil {
+			return id, err
+		}
+		if cl.pending == nil {
+			cl.pending = map[uint64]*pendingDelivery{}
+		}
+		p := &pendingDelivery{
+			messageID: id,
+			frame:     frame,
+			backoff:   sm.qosRetryInterval,
+			onStatus:  onStatus,
+		}
+		cl.pending[cl.qosSeq] = p
+		sm.attemptDeliveryLocked(s, cl, cl.qosSeq, p)
+	}
+	return id, nil
+}
+
+// attemptDeliveryLocked writes the pending message seq to cl and schedules
+// its retry. The caller must hold sessionManagerMu.
+func (sm *SessionManager) attemptDeliveryLocked(s *session, cl *client, seq uint64, p *pendingDelivery) {
+	p.attempts++
+	if _, err := sm.writeLocked(s, cl, p.frame); err != nil {
+		sm.dropClientLocked(s, cl, err)
+		return
+	}
+	sessionKey := s.key
+	p.timer = time.AfterFunc(p.backoff, func() {
+		sm.retryDelivery(sessionKey, cl, seq)
+	})
+	p.backoff *= 2
+}
+
+func (sm *SessionManager) retryDelivery(sessionKey string, cl *client, seq uint64) {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	p, ok := cl.pending[seq]
+	if !ok {
+		return
+	}
+	s, ok := sm.sessions[sessionKey]
+	if !ok || !s.hasClient(cl) {
+		sm.settleDeliveryLocked(sessionKey, cl, seq, errors.New("connection closed"))
+		return
+	}
+	if p.attempts > sm.qosMaxRetries {
+		sm.settleDeliveryLocked(sessionKey, cl, seq, errors.New(
+			fmt.Sprintf("Not acknowledged after %d attempts", p.attempts),
+		))
+		return
+	}
+	sm.attemptDeliveryLocked(s, cl, seq, p)
+}
+
+// settleDeliveryLocked ends the pending message seq of cl and reports it as
+// acknowledged when err is nil. The caller must hold sessionManagerMu.
+func (sm *SessionManager) settleDeliveryLocked(sessionKey string, cl *client, seq uint64, err error) bool {
+	p, ok := cl.pending[seq]
+	if !ok {
+		return false
+	}
+	delete(cl.pending, seq)
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	if p.onStatus != nil {
+		go p.onStatus(DeliveryStatus{
+			SessionKey: sessionKey,
+			MessageID:  p.messageID,
+			ClientID:   cl.id,
+			Seq:        seq,
+			Attempts:   p.attempts,
+			Acked:      err == nil,
+			Err:        err,
+		})
+	}
+	return true
+}
+
+// failPendingLocked gives up every message still pending for cl, which
+// left session s. The caller must hold sessionManagerMu.
+func (sm *SessionManager) failPendingLocked(s *session, cl *client) {
+	for seq := range cl.pending {
+		sm.settleDeliveryLocked(s.key, cl, seq, errors.New("connection closed"))
+	}
+}
@@ -0,0 +1,135 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type QoSTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *QoSTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithQoS(50*time.Millisecond, 2),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *QoSTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+func readQoSFrame(suite *QoSTestSuite, message string) qosFrame {
+	var frame qosFrame
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &frame))
+	return frame
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *QoSTestSuite) TestAckedDeliveryIsReported() {
+	conn, connID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	statuses := make(chan DeliveryStatus, 1)
+	id, err := suite.manager.BroadcastQoS(suite.sessionKey, "", []byte("insert a"), func(status DeliveryStatus) {
+		statuses <- status
+	})
+	assert.NoError(suite.T(), err)
+	message, err := readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	frame := readQoSFrame(suite, message)
+	assert.Equal(suite.T(), uint64(1), frame.Seq)
+	assert.Equal(suite.T(), "insert a", frame.Message)
+	conn.WriteMessage(1, []byte(fmt.Sprintf(`{"control":"qos-ack","seq":%d}`, frame.Seq)))
+
+	select {
+	case status := <-statuses:
+		assert.True(suite.T(), status.Acked)
+		assert.NoError(suite.T(), status.Err)
+		assert.Equal(suite.T(), id, status.MessageID)
+		assert.Equal(suite.T(), connID, status.ClientID)
+		assert.Equal(suite.T(), 1, status.Attempts)
+	case <-time.After(time.Second):
+		suite.T().Error("no delivery status reported")
+	}
+}
+
+func (suite *QoSTestSuite) TestUnackedMessageIsRetriedThenFails() {
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	statuses := make(chan DeliveryStatus, 1)
+	_, err = suite.manager.BroadcastQoS(suite.sessionKey, "", []byte("delete b"), func(status DeliveryStatus) {
+		statuses <- status
+	})
+	assert.NoError(suite.T(), err)
+	for i := 0; i < 3; i++ {
+		message, err := readWithTimeout(conn, time.Second)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), uint64(1), readQoSFrame(suite, message).Seq)
+	}
+
+	select {
+	case status := <-statuses:
+		assert.False(suite.T(), status.Acked)
+		assert.Error(suite.T(), status.Err)
+		assert.Equal(suite.T(), 3, status.Attempts)
+	case <-time.After(time.Second):
+		suite.T().Error("no delivery status reported")
+	}
+}
+
+func (suite *QoSTestSuite) TestDisconnectFailsPendingMessages() {
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	statuses := make(chan DeliveryStatus, 1)
+	_, err = suite.manager.BroadcastQoS(suite.sessionKey, "", []byte("op"), func(status DeliveryStatus) {
+		statuses <- status
+	})
+	assert.NoError(suite.T(), err)
+	conn.Close()
+
+	select {
+	case status := <-statuses:
+		assert.False(suite.T(), status.Acked)
+		assert.Error(suite.T(), status.Err)
+	case <-time.After(time.Second):
+		suite.T().Error("no delivery status reported")
+	}
+}
+
+func (suite *QoSTestSuite) TestQoSMustBeEnabled() {
+	manager := CreateSessionManager([]string{suite.sessionKey})
+	defer manager.cronScheduler.Stop()
+	_, err := manager.BroadcastQoS(suite.sessionKey, "", []byte("op"), nil)
+	assert.Error(suite.T(), err)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestQoSTestSuite(t *testing.T) {
+	suite.Run(t, new(QoSTestSuite))
+}
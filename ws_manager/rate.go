@@ -0,0 +1,46 @@
+package ws_manager
+
+import (
+	"math"
+	"time"
+)
+
+const defaultRateWindow = 10 * time.Second
+
+// rateEstimator tracks an exponentially-weighted event rate in events per
+// second. Each event adds 1/window to the rate and the rate decays with time
+// constant window between events, so a steady stream of n events per second
+// converges to n.
+type rateEstimator struct {
+	rate float64
+	last time.Time
+}
+
+func (r *rateEstimator) observe(now time.Time, window time.Duration) {
+	r.observeN(now, window, 1)
+}
+
+// observeN records n events at once, e.g. the bytes of a single write.
+func (r *rateEstimator) observeN(now time.Time, window time.Duration, n float64) {
+	r.rate = r.value(now, window) + n/window.Seconds()
+	r.last = now
+}
+
+func (r *rateEstimator) value(now time.Time, window time.Duration) float64 {
+	if r.last.IsZero() {
+		return 0
+	}
+	elapsed := now.Sub(r.last).Seconds()
+	return r.rate * math.Exp(-elapsed/window.Seconds())
+}
+
+// WithRateWindow sets the time constant of the moving average behind
+// SessionStats.MessagesPerSecond. Shorter windows react faster but are
+// noisier. Non-positive values keep the default.
+func WithRateWindow(window time.Duration) Option {
+	return func(sm *SessionManager) {
+		if window > 0 {
+			sm.rateWindow = window
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// CloseRateLimited is the close code sent to a connection disconnected by
+// RateLimitDisconnect.
+const CloseRateLimited = 4009
+
+// RateLimit caps inbound traffic at Messages messages and Bytes payload
+// bytes per second, with bursts of up to MessageBurst messages and
+// ByteBurst bytes. A zero rate leaves that dimension unlimited. A message
+// larger than ByteBurst is let through only when the byte bucket is full.
+type RateLimit struct {
+	Messages     float64
+	MessageBurst int
+	Bytes        float64
+	ByteBurst    int
+}
+
+// RateLimitAction is what happens to a message over a rate limit.
+type RateLimitAction int
+
+const (
+	// RateLimitDrop drops the message silently. It is the default.
+	RateLimitDrop RateLimitAction = iota
+	// RateLimitNotify drops the message and sends the sender an error
+	// envelope:
+	//
+	//	{"type":"error","sender":"","sessionKey":"abcdefgh","timestamp":1700000000000,"payload":{"error":"rate limit exceeded","scope":"connection"}}
+	//
+	// where scope is "connection", "address" or "session".
+	RateLimitNotify
+	// RateLimitDisconnect drops the message and closes the sender's
+	// connection with CloseRateLimited.
+	RateLimitDisconnect
+)
+
+// WithRateLimit limits each connection to perSecond inbound messages with
+// bursts of up to burst. Messages over the limit are dropped instead of
+// broadcast. If maxDropped is positive, a connection that has that many
+// messages dropped in a row is closed with a policy violation. By default
+// there is no limit.
+func WithRateLimit(perSecond float64, burst int, maxDropped int) Option {
+	return func(sm *SessionManager) {
+		sm.connRateLimit.Messages = perSecond
+		sm.connRateLimit.MessageBurst = burst
+		sm.rateMaxDropped = maxDropped
+	}
+}
+
+// WithConnectionRateLimit limits the inbound traffic of each connection.
+// It replaces the message rate set by WithRateLimit.
+func WithConnectionRateLimit(limit RateLimit) Option {
+	return func(sm *SessionManager) {
+		sm.connRateLimit = limit
+	}
+}
+
+// WithSessionRateLimit limits the inbound traffic of all the connections
+// of each session together, so many quiet clients cannot add up to a
+// flood. It applies after the connection limit.
+func WithSessionRateLimit(limit RateLimit) Option {
+	return func(sm *SessionManager) {
+		sm.sessionRateLimit = limit
+	}
+}
+
+// WithRateLimitAction sets what happens to messages over a rate limit.
+func WithRateLimitAction(action RateLimitAction) Option {
+	return func(sm *SessionManager) {
+		sm.rateLimitAction = action
+	}
+}
+
+// tokenBucket is a goroutine-safe token bucket refilled at rate tokens per
+// second up to burst tokens.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// allow takes n tokens if they are available. A full bucket always allows,
+// going into debt for n larger than the burst.
+func (b *tokenBucket) allow(now time.Time, n float64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < n && b.tokens < b.burst {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// rateLimiter enforces a RateLimit with one bucket per dimension. A nil
+// bucket is unlimited.
+type rateLimiter struct {
+	messages *tokenBucket
+	bytes    *tokenBucket
+}
+
+// newRateLimiter returns a limiter for limit, or nil if it limits nothing.
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.Messages <= 0 && limit.Bytes <= 0 {
+		return nil
+	}
+	l := &rateLimiter{}
+	if limit.Messages > 0 {
+		l.messages = newTokenBucket(limit.Messages, limit.MessageBurst)
+	}
+	if limit.Bytes > 0 {
+		l.bytes = newTokenBucket(limit.Bytes, limit.ByteBurst)
+	}
+	return l
+}
+
+func (l *rateLimiter) allow(now time.Time, size int) bool {
+	if l == nil {
+		return true
+	}
+	if l.messages != nil && !l.messages.allow(now, 1) {
+		return false
+	}
+	return l.bytes == nil || l.bytes.allow(now, float64(size))
+}
+
+type rateLimitError struct {
+	Error string `json:"error"`
+	Scope string `json:"scope"`
+}
+
+// rateLimited reports whether an inbound message of size bytes from cl is
+// over its connection or session rate limit, and applies the configured
+// action if so.
+func (sm *SessionManager) rateLimited(sessionKey string, cl *client, size int) bool {
+	now := time.Now()
+	scope := ""
+	if !cl.limiter.allow(now, size) {
+		scope = "connection"
+	} else if !cl.addrLimiter.allow(now, size) {
+		scope = "address"
+	} else if !sm.sessionLimiter(sessionKey).allow(now, size) {
+		scope = "session"
+	}
+	if scope == "" {
+		cl.rateDropped = 0
+		return false
+	}
+	cl.rateDropped++
+	sm.statsMu.Lock()
+	sm.metrics.RateLimitedMessages++
+	sm.statsMu.Unlock()
+	switch {
+	case sm.rateLimitAction == RateLimitDisconnect:
+		code, reason := sm.closeFrame(CloseRateLimit, CloseRateLimited, "rate limit exceeded")
+		sm.disconnectClient(sessionKey, cl, code, reason)
+	case sm.rateMaxDropped > 0 && cl.rateDropped >= sm.rateMaxDropped:
+		code, reason := sm.closeFrame(CloseRateLimit, websocket.ClosePolicyViolation, "rate limit exceeded")
+		sm.disconnectClient(sessionKey, cl, code, reason)
+	case sm.rateLimitAction == RateLimitNotify:
+		sm.notifyRateLimited(sessionKey, cl, scope, now)
+	}
+	return true
+}
+
+// sessionLimiter returns the session's rate limiter, creating it on first
+// use, or nil if sessions are not limited.
+func (sm *SessionManager) sessionLimiter(sessionKey string) *rateLimiter {
+	if sm.sessionRateLimit.Messages <= 0 && sm.sessionRateLimit.Bytes <= 0 {
+		return nil
+	}
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return nil
+	}
+	if s.limiter == nil {
+		s.limiter = newRateLimiter(sm.sessionRateLimit)
+	}
+	return s.limiter
+}
+
+func (sm *SessionManager) notifyRateLimited(sessionKey string, cl *client, scope string, now time.Time) {
+	payload, err := json.Marshal(rateLimitError{Error: "rate limit exceeded", Scope: scope})
+	if err != nil {
+		return
+	}
+	frame, err := json.Marshal(Envelope{
+		Type:       "error",
+		SessionKey: sessionKey,
+		Timestamp:  now.UnixNano() / int64(time.Millisecond),
+		Payload:    payload,
+	})
+	if err != nil {
+		return
+	}
+	if err := cl.write(websocket.TextMessage, frame); err != nil {
+		sm.logger.Warn("Rate limit notice failed", "session", sessionKey, "client", cl.id, "err", err)
+	}
+}
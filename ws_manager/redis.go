@@ -0,0 +1,328 @@
+package ws_manager
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redisReconnectDelay = time.Second
+
+// defaultRedisTimeout bounds connecting and each command unless
+// WithRedisTimeout says otherwise.
+const defaultRedisTimeout = 5 * time.Second
+
+// RedisOption configures the connections of a RedisBackend or
+// RedisSessionStore.
+type RedisOption func(*redisDialer)
+
+// redisDialer makes the connections to a Redis server, authenticated and
+// encrypted as the RedisOptions ask.
+type redisDialer struct {
+	addr      string
+	username  string
+	password  string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+}
+
+// WithRedisAuth authenticates every connection with AUTH, as username when
+// it is not empty, for servers with ACL users, or with password alone for
+// requirepass.
+func WithRedisAuth(username, password string) RedisOption {
+	return func(d *redisDialer) {
+		d.username = username
+		d.password = password
+	}
+}
+
+// WithRedisTLS connects over TLS with config, e.g. to a managed Redis that
+// only accepts TLS. The server name defaults to the host of addr.
+func WithRedisTLS(config *tls.Config) RedisOption {
+	return func(d *redisDialer) {
+		if config == nil {
+			config = &tls.Config{}
+		}
+		d.tlsConfig = config
+	}
+}
+
+// WithRedisTimeout bounds connecting, including TLS and AUTH, and every
+// command and its reply to timeout, 5 seconds by default. Broadcasts
+// publish synchronously, so an unresponsive server holds up broadcasting
+// clients for at most this long.
+func WithRedisTimeout(timeout time.Duration) RedisOption {
+	return func(d *redisDialer) {
+		if timeout > 0 {
+			d.timeout = timeout
+		}
+	}
+}
+
+func newRedisDialer(addr string, opts []RedisOption) redisDialer {
+	d := redisDialer{addr: addr, timeout: defaultRedisTimeout}
+	for _, opt := range opts {
+		opt(&d)
+	}
+	return d
+}
+
+// dial connects to the server and authenticates.
+func (d redisDialer) dial() (net.Conn, *bufio.Reader, error) {
+	var conn net.Conn
+	var err error
+	if d.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: d.timeout}, "tcp", d.addr, d.tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", d.addr, d.timeout)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	r := bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(d.timeout))
+	defer conn.SetDeadline(time.Time{})
+	if d.password != "" {
+		args := []string{"AUTH", d.password}
+		if d.username != "" {
+			args = []string{"AUTH", d.username, d.password}
+		}
+		if _, err = conn.Write(redisCommand(args...)); err == nil {
+			_, err = readRedisReply(r)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	return conn, r, nil
+}
+
+// RedisBackend is a Backend on Redis pub/sub. Each session is published on
+// its own channel, the session key prefixed with channelPrefix.
+type RedisBackend struct {
+	dialer        redisDialer
+	channelPrefix string
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+
+	// down is why the subscription is not up, nil while it is
+	downMu sync.Mutex
+	down   error
+}
+
+// NewRedisBackend returns a backend for the Redis server at addr, e.g.
+// "localhost:6379". Connections are made on first use and remade after
+// errors.
+func NewRedisBackend(addr, channelPrefix string, opts ...RedisOption) *RedisBackend {
+	return &RedisBackend{dialer: newRedisDialer(addr, opts), channelPrefix: channelPrefix}
+}
+
+// Publish implements Backend.
+func (b *RedisBackend) Publish(sessionKey string, msg BackendMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		conn, r, err := b.dialer.dial()
+		if err != nil {
+			return err
+		}
+		b.conn = conn
+		b.r = r
+	}
+	b.conn.SetDeadline(time.Now().Add(b.dialer.timeout))
+	if _, err = b.conn.Write(redisCommand("PUBLISH", b.channelPrefix+sessionKey, string(payload))); err == nil {
+		_, err = readRedisReply(b.r)
+	}
+	if err != nil {
+		b.conn.Close()
+		b.conn = nil
+	}
+	return err
+}
+
+// Subscribe implements Backend. The subscription is made before Subscribe
+// returns; if it later drops, it is remade until unsubscribe is called.
+func (b *RedisBackend) Subscribe(handler func(sessionKey string, msg BackendMessage)) (func(), error) {
+	conn, r, err := b.psubscribe()
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	var connMu sync.Mutex
+	go func() {
+		for {
+			b.receive(conn, r, handler)
+			b.setDown(errSubscriptionLost)
+			select {
+			case <-done:
+				return
+			case <-time.After(redisReconnectDelay):
+			}
+			next, nextR, err := b.psubscribe()
+			b.setDown(err)
+			if err != nil {
+				continue
+			}
+			connMu.Lock()
+			select {
+			case <-done:
+				next.Close()
+				connMu.Unlock()
+				return
+			default:
+			}
+			conn, r = next, nextR
+			connMu.Unlock()
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			connMu.Lock()
+			close(done)
+			conn.Close()
+			connMu.Unlock()
+		})
+	}, nil
+}
+
+// Healthy implements HealthChecker: it returns why the subscription is
+// down while it is being remade.
+func (b *RedisBackend) Healthy() error {
+	b.downMu.Lock()
+	defer b.downMu.Unlock()
+	return b.down
+}
+
+func (b *RedisBackend) setDown(err error) {
+	b.downMu.Lock()
+	b.down = err
+	b.downMu.Unlock()
+}
+
+// Close closes the connection used for publishing.
+func (b *RedisBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		return nil
+	}
+	err := b.conn.Close()
+	b.conn = nil
+	return err
+}
+
+func (b *RedisBackend) psubscribe() (net.Conn, *bufio.Reader, error) {
+	conn, r, err := b.dialer.dial()
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetWriteDeadline(time.Now().Add(b.dialer.timeout))
+	if _, err := conn.Write(redisCommand("PSUBSCRIBE", b.channelPrefix+"*")); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	conn.SetWriteDeadline(time.Time{})
+	return conn, r, nil
+}
+
+// receive hands every published message read from r to handler until conn
+// fails.
+func (b *RedisBackend) receive(conn net.Conn, r *bufio.Reader, handler func(string, BackendMessage)) {
+	defer conn.Close()
+	for {
+		reply, err := readRedisReply(r)
+		if err != nil {
+			return
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 4 || redisString(parts[0]) != "pmessage" {
+			continue
+		}
+		var msg BackendMessage
+		if err := json.Unmarshal([]byte(redisString(parts[3])), &msg); err != nil {
+			continue
+		}
+		handler(strings.TrimPrefix(redisString(parts[2]), b.channelPrefix), msg)
+	}
+}
+
+// redisCommand encodes args as a RESP array of bulk strings.
+func redisCommand(args ...string) []byte {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return []byte(sb.String())
+}
+
+// readRedisReply decodes one RESP value: a string, an int64, a []byte (nil
+// for a null bulk string) or a []interface{}. Error replies are returned as
+// errors.
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("Malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, errors.New(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("Unknown reply type %q", kind)
+}
+
+func redisString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
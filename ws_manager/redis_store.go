@@ -0,0 +1,104 @@
+package ws_manager
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// RedisSessionStore is a SessionStore keeping every session as a JSON
+// field of one Redis hash.
+type RedisSessionStore struct {
+	dialer redisDialer
+	hash   string
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// NewRedisSessionStore returns a store in the hash named hash on the Redis
+// server at addr, e.g. "localhost:6379". Connections are made on first use
+// and remade after errors.
+func NewRedisSessionStore(addr, hash string, opts ...RedisOption) *RedisSessionStore {
+	return &RedisSessionStore{dialer: newRedisDialer(addr, opts), hash: hash}
+}
+
+// SaveSession implements SessionStore.
+func (st *RedisSessionStore) SaveSession(session StoredSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	_, err = st.do("HSET", st.hash, session.Key, string(data))
+	return err
+}
+
+// DeleteSession implements SessionStore.
+func (st *RedisSessionStore) DeleteSession(sessionKey string) error {
+	_, err := st.do("HDEL", st.hash, sessionKey)
+	return err
+}
+
+// LoadSessions implements SessionStore.
+func (st *RedisSessionStore) LoadSessions() ([]StoredSession, error) {
+	reply, err := st.do("HGETALL", st.hash)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := reply.([]interface{})
+	if !ok || len(fields)%2 != 0 {
+		return nil, errors.New(
+			fmt.Sprintf("Malformed HGETALL reply for %s", st.hash),
+		)
+	}
+	sessions := []StoredSession{}
+	for i := 1; i < len(fields); i += 2 {
+		var session StoredSession
+		if err := json.Unmarshal([]byte(redisString(fields[i])), &session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// Close closes the store's connection.
+func (st *RedisSessionStore) Close() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.conn == nil {
+		return nil
+	}
+	err := st.conn.Close()
+	st.conn = nil
+	return err
+}
+
+func (st *RedisSessionStore) do(args ...string) (interface{}, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.conn == nil {
+		conn, r, err := st.dialer.dial()
+		if err != nil {
+			return nil, err
+		}
+		st.conn = conn
+		st.r = r
+	}
+	var reply interface{}
+	st.conn.SetDeadline(time.Now().Add(st.dialer.timeout))
+	_, err := st.conn.Write(redisCommand(args...))
+	if err == nil {
+		reply, err = readRedisReply(st.r)
+	}
+	if err != nil {
+		st.conn.Close()
+		st.conn = nil
+	}
+	return reply, err
+}
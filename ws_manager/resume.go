@@ -0,0 +1,143 @@
+package ws_manager
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// ResumeTokenHeader is the upgrade response header carrying the token a
+// connection presents to reclaim its client ID after it drops.
+const ResumeTokenHeader = "X-Resume-Token"
+
+// WithResume lets a dropped connection come back as the same client. Every
+// connection is issued a single-use token in ResumeTokenHeader. For ttl
+// after the connection ends, dialing the same session with the token in the
+// "resume" query parameter reclaims the old client ID and, in place of the
+// session history, replays the broadcasts missed in the meantime, keeping
+// the last bufferSize of them. A bufferSize of zero uses the history size.
+// The resumed client also keeps its channel subscriptions and blocks.
+// Unknown, expired or already used tokens, or a token presented under a
+// different identity, join fresh.
+func WithResume(ttl time.Duration, bufferSize int) Option {
+	return func(sm *SessionManager) {
+		sm.resumeTTL = ttl
+		sm.resumeBufferSize = bufferSize
+	}
+}
+
+// resumeSlot holds a dropped client until it resumes or ttl passes.
+type resumeSlot struct {
+	client *client
+	missed []historyEntry
+	timer  *time.Timer
+}
+
+func newResumeToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func (sm *SessionManager) missedBufferSize() int {
+	if sm.resumeBufferSize > 0 {
+		return sm.resumeBufferSize
+	}
+	return sm.historySize
+}
+
+// parkLocked keeps the departed cl resumable under its token. The caller
+// must hold sessionManagerMu.
+func (sm *SessionManager) parkLocked(s *session, cl *client) {
+	if sm.resumeTTL <= 0 || cl.resumeToken == "" {
+		return
+	}
+	slot := &resumeSlot{client: cl}
+	slot.timer = time.AfterFunc(sm.resumeTTL, func() {
+		sm.sessionManagerMu.Lock()
+		defer sm.sessionManagerMu.Unlock()
+		if s.parked[cl.resumeToken] == slot {
+			delete(s.parked, cl.resumeToken)
+			sm.forgetSeenLocked(s, cl)
+		}
+	})
+	s.parked[cl.resumeToken] = slot
+}
+
+// claimResume consumes token and returns the client it was issued to, or
+// nil if the connection has to join fresh.
+func (sm *SessionManager) claimResume(sessionKey, token, identity string) *resumeSlot {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return nil
+	}
+	slot, ok := s.parked[token]
+	if !ok {
+		return nil
+	}
+	delete(s.parked, token)
+	slot.timer.Stop()
+	if slot.client.identity != identity {
+		sm.forgetSeenLocked(s, slot.client)
+		return nil
+	}
+	return slot
+}
+
+// restore carries the channel subscriptions and blocks of the parked client
+// over to cl, the connection resuming it. The parked client has left its
+// session, so nothing else touches it.
+func (slot *resumeSlot) restore(cl *client) {
+	for channel := range slot.client.channels {
+		cl.channels[channel] = struct{}{}
+	}
+	for identity := range slot.client.blocked {
+		cl.blocked[identity] = struct{}{}
+	}
+}
+
+// bufferMissedLocked records a broadcast for every parked client it would
+// have reached. The caller must hold sessionManagerMu.
+func (sm *SessionManager) bufferMissedLocked(s *session, senderID string, messageType int, message []byte, match func(*client) bool) {
+	size := sm.missedBufferSize()
+	if size <= 0 {
+		return
+	}
+	for _, slot := range s.parked {
+		if slot.client.id == senderID || (match != nil && !match(slot.client)) {
+			continue
+		}
+		slot.missed = append(slot.missed, historyEntry{
+			messageType: messageType,
+			message:     append([]byte{}, message...),
+		})
+		if len(slot.missed) > size {
+			slot.missed = append([]historyEntry{}, slot.missed[len(slot.missed)-size:]...)
+		}
+	}
+}
+
+// replayLocked brings a joining cl up to date: a resumed client gets what it
+// missed, anyone else but a publisher the session history. The caller must hold
+// sessionManagerMu.
+func (sm *SessionManager) replayLocked(s *session, cl *client) error {
+	if cl.role == RolePublisher {
+		cl.resumed = nil
+		return nil
+	}
+	if cl.resumed == nil {
+		return sm.replayHistoryLocked(s, cl)
+	}
+	missed := cl.resumed.missed
+	cl.resumed = nil
+	for _, entry := range missed {
+		if _, err := sm.writeFrameLocked(s, cl, entry.messageType, entry.message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
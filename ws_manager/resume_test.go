@@ -0,0 +1,171 @@
+package ws_manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ResumeTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *ResumeTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.start(time.Minute)
+}
+
+func (suite *ResumeTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+func (suite *ResumeTestSuite) start(ttl time.Duration, opts ...Option) {
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, append([]Option{WithResume(ttl, 2)}, opts...)...)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *ResumeTestSuite) TestResumeReclaimsIDAndReplaysMissed() {
+	dropped, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", nil)
+	assert.NoError(suite.T(), err)
+	droppedID := resp.Header.Get(ClientIDHeader)
+	token := resp.Header.Get(ResumeTokenHeader)
+	assert.NotEmpty(suite.T(), token)
+	sender, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	dropped.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	for _, message := range []string{"one", "two", "three"} {
+		assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte(message)))
+	}
+	assert.Eventually(suite.T(), func() bool {
+		stats, err := suite.manager.GetSessionStats(suite.sessionKey)
+		return err == nil && stats.Broadcasts == 3
+	}, time.Second, 10*time.Millisecond)
+
+	resumed, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "resume="+token, nil)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), droppedID, resp.Header.Get(ClientIDHeader))
+	assert.NotEqual(suite.T(), token, resp.Header.Get(ResumeTokenHeader))
+
+	// only the last two fit the buffer
+	message, err := readWithTimeout(resumed, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "two", message)
+	message, err = readWithTimeout(resumed, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "three", message)
+
+	// tokens are single use
+	_, again, err := dialSessionWithID(suite.server, suite.sessionKey, "resume="+token)
+	assert.NoError(suite.T(), err)
+	assert.NotEqual(suite.T(), droppedID, again)
+}
+
+func (suite *ResumeTestSuite) TestResumeKeepsChannels() {
+	dropped, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", nil)
+	assert.NoError(suite.T(), err)
+	droppedID := resp.Header.Get(ClientIDHeader)
+	token := resp.Header.Get(ResumeTokenHeader)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	assert.NoError(suite.T(), suite.manager.Subscribe(suite.sessionKey, droppedID, "room-1"))
+
+	dropped.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+	assert.NoError(suite.T(), suite.manager.BroadcastToChannel(suite.sessionKey, "room-1", "", websocket.TextMessage, []byte("missed")))
+
+	resumed, _, err := dialSessionWithHeader(suite.server, suite.sessionKey, "resume="+token, nil)
+	assert.NoError(suite.T(), err)
+	message, err := readWithTimeout(resumed, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "missed", message)
+	channels, err := suite.manager.Channels(suite.sessionKey, droppedID)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"room-1"}, channels)
+
+	assert.NoError(suite.T(), suite.manager.BroadcastToChannel(suite.sessionKey, "room-1", "", websocket.TextMessage, []byte("live")))
+	message, err = readWithTimeout(resumed, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "live", message)
+}
+
+func (suite *ResumeTestSuite) TestAffinityCookieResumes() {
+	suite.TearDownTest()
+	suite.start(time.Minute, WithAffinityCookie("wsaffinity", []byte("s3cret")))
+
+	dropped, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", nil)
+	assert.NoError(suite.T(), err)
+	droppedID := resp.Header.Get(ClientIDHeader)
+	cookies := resp.Cookies()
+	if !assert.Len(suite.T(), cookies, 1) {
+		return
+	}
+	cookie := cookies[0]
+	assert.Equal(suite.T(), "wsaffinity", cookie.Name)
+	assert.Equal(suite.T(), "/"+suite.sessionKey, cookie.Path)
+	assert.True(suite.T(), cookie.Secure)
+	assert.True(suite.T(), cookie.HttpOnly)
+	assert.Equal(suite.T(), http.SameSiteStrictMode, cookie.SameSite)
+	dropped.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+
+	// a tampered cookie is ignored and leaves the slot parked
+	forged := http.Header{"Cookie": {cookie.Name + "=" + cookie.Value + "0"}}
+	fresh, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", forged)
+	assert.NoError(suite.T(), err)
+	defer fresh.Close()
+	assert.NotEqual(suite.T(), droppedID, resp.Header.Get(ClientIDHeader))
+
+	header := http.Header{"Cookie": {cookie.Name + "=" + cookie.Value}}
+	resumed, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", header)
+	assert.NoError(suite.T(), err)
+	defer resumed.Close()
+	assert.Equal(suite.T(), droppedID, resp.Header.Get(ClientIDHeader))
+}
+
+func (suite *ResumeTestSuite) TestUnknownTokenJoinsFresh() {
+	_, id, err := dialSessionWithID(suite.server, suite.sessionKey, "resume=bogus")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "1", id)
+}
+
+func (suite *ResumeTestSuite) TestExpiredTokenJoinsFresh() {
+	suite.TearDownTest()
+	suite.start(50 * time.Millisecond)
+
+	dropped, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", nil)
+	assert.NoError(suite.T(), err)
+	droppedID := resp.Header.Get(ClientIDHeader)
+	token := resp.Header.Get(ResumeTokenHeader)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	dropped.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+	time.Sleep(100 * time.Millisecond)
+
+	_, id, err := dialSessionWithID(suite.server, suite.sessionKey, "resume="+token)
+	assert.NoError(suite.T(), err)
+	assert.NotEqual(suite.T(), droppedID, id)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestResumeTestSuite(t *testing.T) {
+	suite.Run(t, new(ResumeTestSuite))
+}
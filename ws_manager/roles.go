@@ -0,0 +1,122 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Connection roles. Participants send and receive. Observers receive
+// broadcasts, but their inbound messages are dropped with an "error"
+// envelope:
+//
+//	{"type":"error","sender":"","sessionKey":"abcdefgh","timestamp":1700000000000,"payload":{"error":"read only","role":"observer"}}
+//
+// Publishers send but are left out of broadcasts and history replays;
+// messages sent to them directly still reach them.
+const (
+	RoleParticipant = "participant"
+	RoleObserver    = "observer"
+	RolePublisher   = "publisher"
+)
+
+// RoleFunc picks the role of an authenticated connection to sessionKey.
+// requested is the "role" query parameter of the upgrade, possibly empty,
+// which the function should only grant if identity may take it. An empty
+// role means RoleParticipant; an error, or a role other than the ones
+// above, rejects the handshake with HTTP 403.
+type RoleFunc func(sessionKey string, identity string, requested string, r *http.Request) (role string, err error)
+
+// WithRoles assigns connection roles with roles, after WithAuth has
+// identified the caller. Connections admitted by WithAnonymousObserve stay
+// observers. Without it every authenticated connection is a participant.
+func WithRoles(roles RoleFunc) Option {
+	return func(sm *SessionManager) {
+		sm.roles = roles
+	}
+}
+
+// assignRole returns the role of a connection with identity, or an error
+// to refuse it.
+func (sm *SessionManager) assignRole(sessionKey string, identity string, r *http.Request) (string, error) {
+	if sm.roles == nil {
+		return RoleParticipant, nil
+	}
+	role, err := sm.roles(sessionKey, identity, r.URL.Query().Get("role"), r)
+	if err != nil {
+		return "", err
+	}
+	switch role {
+	case "":
+		return RoleParticipant, nil
+	case RoleParticipant, RoleObserver, RolePublisher:
+		return role, nil
+	}
+	return "", errors.New(
+		fmt.Sprintf("Unknown role %s", role),
+	)
+}
+
+type roleError struct {
+	Error string `json:"error"`
+	Role  string `json:"role"`
+}
+
+// rejectReadOnly tells cl, an observer, that its message was dropped.
+func (sm *SessionManager) rejectReadOnly(sessionKey string, cl *client) {
+	sm.logger.Debug("Message from observer dropped", "session", sessionKey, "client", cl.id)
+	payload, err := json.Marshal(roleError{Error: "read only", Role: cl.role})
+	if err != nil {
+		return
+	}
+	frame, err := json.Marshal(Envelope{
+		Type:       "error",
+		SessionKey: sessionKey,
+		Timestamp:  time.Now().UnixNano() / int64(time.Millisecond),
+		Payload:    payload,
+	})
+	if err != nil {
+		return
+	}
+	if err := cl.write(websocket.TextMessage, frame); err != nil {
+		sm.logger.Warn("Read only notice failed", "session", sessionKey, "client", cl.id, "err", err)
+	}
+}
+
+// WithAnonymousObserve admits connections that fail authentication as
+// observers instead of rejecting them with HTTP 401.
+func WithAnonymousObserve(enabled bool) Option {
+	return func(sm *SessionManager) {
+		sm.anonymousObserve = enabled
+	}
+}
+
+// ActiveConnections returns the number of open connections in the session.
+func (sm *SessionManager) ActiveConnections(sessionKey string) (int, error) {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return 0, sessionNotFound(sessionKey)
+	}
+	return len(s.clients), nil
+}
+
+// ActiveConnectionsByRole breaks the session's open connections down by role.
+func (sm *SessionManager) ActiveConnectionsByRole(sessionKey string) (map[string]int, error) {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return nil, sessionNotFound(sessionKey)
+	}
+	counts := map[string]int{}
+	for _, cl := range s.clients {
+		counts[cl.role]++
+	}
+	return counts, nil
+}
@@ -0,0 +1,167 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RolesTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *RolesTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithAuth(headerAuth),
+		WithAnonymousObserve(true),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *RolesTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *RolesTestSuite) TestAnonymousObserverCannotSend() {
+	anonymous, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	alice, _, err := dialSessionAs(suite.server, suite.sessionKey, "alice")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	anonymous.WriteMessage(1, []byte("let me talk"))
+	_, err = readWithTimeout(alice, 300*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *RolesTestSuite) TestAnonymousObserverReceives() {
+	anonymous, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	alice, _, err := dialSessionAs(suite.server, suite.sessionKey, "alice")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	alice.WriteMessage(1, []byte("welcome, watchers"))
+	message, err := readWithTimeout(anonymous, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "welcome, watchers", message)
+}
+
+func (suite *RolesTestSuite) TestActiveConnectionsByRole() {
+	_, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	_, err = dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	_, _, err = dialSessionAs(suite.server, suite.sessionKey, "alice")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 3))
+
+	total, err := suite.manager.ActiveConnections(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 3, total)
+
+	byRole, err := suite.manager.ActiveConnectionsByRole(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), map[string]int{RoleObserver: 2, RoleParticipant: 1}, byRole)
+
+	_, err = suite.manager.ActiveConnectionsByRole("missing")
+	assert.EqualError(suite.T(), err, "Session missing not found")
+}
+
+func (suite *RolesTestSuite) TestObserverIsToldItIsReadOnly() {
+	anonymous, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer anonymous.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	anonymous.WriteMessage(websocket.TextMessage, []byte("let me talk"))
+	message, err := readWithTimeout(anonymous, time.Second)
+	assert.NoError(suite.T(), err)
+	var env Envelope
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &env))
+	assert.Equal(suite.T(), "error", env.Type)
+	assert.JSONEq(suite.T(), `{"error":"read only","role":"observer"}`, string(env.Payload))
+}
+
+func (suite *RolesTestSuite) TestRolesFromQueryParameter() {
+	suite.TearDownTest()
+	suite.manager = CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithAuth(headerAuth),
+		WithRoles(func(sessionKey, identity, requested string, r *http.Request) (string, error) {
+			switch {
+			case requested == RoleObserver:
+				return RoleObserver, nil
+			case requested == RolePublisher && identity == "presenter":
+				return RolePublisher, nil
+			case requested != "":
+				return "", errors.New("role not allowed")
+			}
+			return "", nil
+		}),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+
+	dialAs := func(identity, role string) (*websocket.Conn, *http.Response, error) {
+		header := http.Header{}
+		header.Set("X-Identity", identity)
+		return dialSessionWithHeader(suite.server, suite.sessionKey, "role="+role, header)
+	}
+	_, resp, err := dialAs("bob", RolePublisher)
+	assert.Error(suite.T(), err)
+	if assert.NotNil(suite.T(), resp) {
+		assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+	}
+	presenter, _, err := dialAs("presenter", RolePublisher)
+	assert.NoError(suite.T(), err)
+	defer presenter.Close()
+	viewer, _, err := dialAs("alice", RoleObserver)
+	assert.NoError(suite.T(), err)
+	defer viewer.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+	byRole, err := suite.manager.ActiveConnectionsByRole(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), map[string]int{RoleObserver: 1, RolePublisher: 1}, byRole)
+
+	presenter.WriteMessage(websocket.TextMessage, []byte("slide 2"))
+	message, err := readWithTimeout(viewer, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "slide 2", message)
+
+	recipients, errs := suite.manager.Broadcast(suite.sessionKey, SystemSender, websocket.TextMessage, []byte("announcement"))
+	assert.Empty(suite.T(), errs)
+	assert.Equal(suite.T(), 1, recipients)
+	message, err = readWithTimeout(viewer, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "announcement", message)
+	_, err = readWithTimeout(presenter, 300*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestRolesTestSuite(t *testing.T) {
+	suite.Run(t, new(RolesTestSuite))
+}
@@ -0,0 +1,107 @@
+package ws_manager
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type scheduledBroadcast struct {
+	// session is the session the broadcast was scheduled in; one
+	// registered again under the same key does not receive it
+	session     *session
+	senderID    string
+	messageType int
+	message     []byte
+	entry       *wheelEntry
+}
+
+// ScheduleBroadcast broadcasts message to the session at the given time. The
+// returned cancel function aborts the broadcast if it has not fired yet and
+// is safe to call more than once. If the session no longer exists when the
+// broadcast fires, it is dropped with a log line.
+func (sm *SessionManager) ScheduleBroadcast(sessionKey, senderID, message string, at time.Time) (cancel func(), err error) {
+	return sm.schedule(sessionKey, senderID, websocket.TextMessage, []byte(message), at)
+}
+
+// BroadcastAt broadcasts payload to every connection in the session at the
+// given time, from SystemSender, e.g. to end a countdown. The broadcast is
+// tied to the session: once the session is removed, closed or collected,
+// the broadcast is cancelled, even if a session is registered again under
+// the same key. The returned cancel function aborts the broadcast if it has
+// not fired yet and is safe to call more than once. A time in the past
+// broadcasts on the next tick, see WithScheduleResolution.
+func (sm *SessionManager) BroadcastAt(sessionKey string, at time.Time, payload []byte) (cancel func(), err error) {
+	return sm.schedule(sessionKey, SystemSender, websocket.TextMessage, payload, at)
+}
+
+// BroadcastAfter is BroadcastAt for d from now, e.g. for a reminder.
+func (sm *SessionManager) BroadcastAfter(sessionKey string, d time.Duration, payload []byte) (cancel func(), err error) {
+	return sm.BroadcastAt(sessionKey, time.Now().Add(d), payload)
+}
+
+// ScheduledBroadcasts returns how many broadcasts are scheduled in the
+// session and have not fired yet.
+func (sm *SessionManager) ScheduledBroadcasts(sessionKey string) (int, error) {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return 0, sessionNotFound(sessionKey)
+	}
+	return len(s.scheduled), nil
+}
+
+// schedule puts a broadcast of message in the session on the timer wheel.
+func (sm *SessionManager) schedule(sessionKey, senderID string, messageType int, message []byte, at time.Time) (func(), error) {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return nil, sessionNotFound(sessionKey)
+	}
+	if sm.timers == nil {
+		sm.timers = newTimerWheel(sm.scheduleResolution, sm.fireScheduled)
+	}
+	b := &scheduledBroadcast{session: s, senderID: senderID, messageType: messageType, message: message}
+	b.entry = &wheelEntry{at: at, broadcast: b}
+	if s.scheduled == nil {
+		s.scheduled = map[*scheduledBroadcast]struct{}{}
+	}
+	s.scheduled[b] = struct{}{}
+	sm.timers.add(b.entry)
+	return func() {
+		sm.sessionManagerMu.Lock()
+		defer sm.sessionManagerMu.Unlock()
+		delete(b.session.scheduled, b)
+		sm.timers.remove(b.entry)
+	}, nil
+}
+
+// fireScheduled makes the broadcast of entry, unless it was cancelled or
+// its session is gone.
+func (sm *SessionManager) fireScheduled(entry *wheelEntry) {
+	b := entry.broadcast
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	if _, ok := b.session.scheduled[b]; !ok {
+		return
+	}
+	delete(b.session.scheduled, b)
+	if sm.sessions[b.session.key] != b.session {
+		sm.logger.Warn("Dropping scheduled broadcast for missing session", "session", b.session.key)
+		return
+	}
+	if err := sm.broadcastLocked(b.session.key, b.senderID, b.messageType, b.message, nil); err != nil {
+		sm.logger.Error("Scheduled broadcast failed", "session", b.session.key, "err", err)
+	}
+}
+
+// cancelScheduledLocked cancels the broadcasts scheduled in s, which is
+// going away. The caller must hold sessionManagerMu.
+func (sm *SessionManager) cancelScheduledLocked(s *session) {
+	for b := range s.scheduled {
+		sm.timers.remove(b.entry)
+	}
+	s.scheduled = nil
+}
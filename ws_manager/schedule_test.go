@@ -0,0 +1,133 @@
+package ws_manager
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ScheduleTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *ScheduleTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey})
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *ScheduleTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *ScheduleTestSuite) TestScheduledBroadcastFires() {
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	start := time.Now()
+	_, err = suite.manager.ScheduleBroadcast(suite.sessionKey, "", "reminder", start.Add(200*time.Millisecond))
+	assert.NoError(suite.T(), err)
+
+	message, err := readWithTimeout(receiver, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "reminder", message)
+	assert.True(suite.T(), time.Since(start) >= 200*time.Millisecond)
+}
+
+func (suite *ScheduleTestSuite) TestCancelledBroadcastDoesNotFire() {
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	cancel, err := suite.manager.ScheduleBroadcast(suite.sessionKey, "", "reminder", time.Now().Add(100*time.Millisecond))
+	assert.NoError(suite.T(), err)
+	cancel()
+	cancel()
+
+	_, err = readWithTimeout(receiver, 300*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *ScheduleTestSuite) TestScheduleForMissingSession() {
+	_, err := suite.manager.ScheduleBroadcast("missing", "", "reminder", time.Now())
+	assert.EqualError(suite.T(), err, "Session missing not found")
+}
+
+func (suite *ScheduleTestSuite) TestBroadcastDroppedWhenSessionGone() {
+	_, err := suite.manager.ScheduleBroadcast(suite.sessionKey, "", "reminder", time.Now().Add(100*time.Millisecond))
+	assert.NoError(suite.T(), err)
+
+	suite.manager.sessionManagerMu.Lock()
+	delete(suite.manager.sessions, suite.sessionKey)
+	suite.manager.sessionManagerMu.Unlock()
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(suite.T(), uint64(0), suite.manager.Metrics().Broadcasts)
+}
+
+func (suite *ScheduleTestSuite) TestBroadcastAtAndAfterFireInOrder() {
+	suite.TearDownTest()
+	// a one millisecond tick makes 600ms more than a turn of the wheel
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithScheduleResolution(time.Millisecond))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	start := time.Now()
+	_, err = suite.manager.BroadcastAfter(suite.sessionKey, 600*time.Millisecond, []byte("second"))
+	assert.NoError(suite.T(), err)
+	_, err = suite.manager.BroadcastAt(suite.sessionKey, start.Add(100*time.Millisecond), []byte("first"))
+	assert.NoError(suite.T(), err)
+	pending, err := suite.manager.ScheduledBroadcasts(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 2, pending)
+
+	message, err := readWithTimeout(receiver, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "first", message)
+	message, err = readWithTimeout(receiver, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "second", message)
+	assert.True(suite.T(), time.Since(start) >= 600*time.Millisecond)
+	pending, _ = suite.manager.ScheduledBroadcasts(suite.sessionKey)
+	assert.Equal(suite.T(), 0, pending)
+}
+
+func (suite *ScheduleTestSuite) TestBroadcastCancelledWithSession() {
+	_, err := suite.manager.BroadcastAfter(suite.sessionKey, 100*time.Millisecond, []byte("reminder"))
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), suite.manager.RemoveSession(suite.sessionKey))
+	assert.NoError(suite.T(), suite.manager.RegisterSession(suite.sessionKey))
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+
+	_, err = readWithTimeout(receiver, 300*time.Millisecond)
+	assert.Error(suite.T(), err)
+	suite.manager.timers.mu.Lock()
+	defer suite.manager.timers.mu.Unlock()
+	assert.Equal(suite.T(), 0, suite.manager.timers.pending)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestScheduleTestSuite(t *testing.T) {
+	suite.Run(t, new(ScheduleTestSuite))
+}
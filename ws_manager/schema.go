@@ -0,0 +1,199 @@
+package ws_manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSONSchema returns an EnvelopeValidator that checks envelope payloads
+// against schema, a JSON Schema restricted to the keywords type, enum,
+// properties, required, additionalProperties, items, minLength, maxLength,
+// minimum, maximum, minItems and maxItems. Other keywords are ignored. A
+// missing payload is validated as null.
+//
+//	validate, err := JSONSchema([]byte(`{"type":"object","required":["text"],"properties":{"text":{"type":"string","maxLength":500}}}`))
+//	sm.ValidateEnvelope("chat", validate)
+func JSONSchema(schema []byte) (EnvelopeValidator, error) {
+	var s jsonSchema
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return nil, errors.New(
+			fmt.Sprintf("Invalid schema: %s", err),
+		)
+	}
+	return func(env Envelope) error {
+		var payload interface{}
+		if len(bytes.TrimSpace(env.Payload)) > 0 {
+			if err := json.Unmarshal(env.Payload, &payload); err != nil {
+				return errors.New("payload is not valid JSON")
+			}
+		}
+		return s.validate(payload, "payload")
+	}, nil
+}
+
+type jsonSchema struct {
+	Type                 schemaTypes            `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+}
+
+// schemaTypes is the type keyword, a single type or a list of them.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = schemaTypes{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+// validate checks v, decoded with encoding/json, found at path.
+func (s *jsonSchema) validate(v interface{}, path string) error {
+	if len(s.Type) > 0 && !s.Type.match(v) {
+		return errors.New(
+			fmt.Sprintf("%s must be %s", path, strings.Join(s.Type, " or ")),
+		)
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if reflect.DeepEqual(allowed, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New(
+				fmt.Sprintf("%s must be one of the allowed values", path),
+			)
+		}
+	}
+	switch v := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			return errors.New(
+				fmt.Sprintf("%s must be at least %d characters", path, *s.MinLength),
+			)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return errors.New(
+				fmt.Sprintf("%s must be at most %d characters", path, *s.MaxLength),
+			)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return errors.New(
+				fmt.Sprintf("%s must be at least %v", path, *s.Minimum),
+			)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			return errors.New(
+				fmt.Sprintf("%s must be at most %v", path, *s.Maximum),
+			)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return errors.New(
+				fmt.Sprintf("%s must have at least %d items", path, *s.MinItems),
+			)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			return errors.New(
+				fmt.Sprintf("%s must have at most %d items", path, *s.MaxItems),
+			)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return errors.New(
+					fmt.Sprintf("%s.%s is required", path, name),
+				)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		// sorted, so the same message always reports the same error
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return errors.New(
+						fmt.Sprintf("%s.%s is not allowed", path, name),
+					)
+				}
+				continue
+			}
+			if err := property.validate(v[name], path+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// match reports whether v has one of the types.
+func (t schemaTypes) match(v interface{}) bool {
+	for _, name := range t {
+		switch v := v.(type) {
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case float64:
+			if name == "number" || (name == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case []interface{}:
+			if name == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if name == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
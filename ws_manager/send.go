@@ -0,0 +1,30 @@
+package ws_manager
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// SendTo writes msg as a text message to the single connection with the
+// given ID. See SendToClient.
+func (sm *SessionManager) SendTo(sessionKey, clientID string, msg []byte) error {
+	return sm.SendToClient(sessionKey, clientID, websocket.TextMessage, msg)
+}
+
+// SendToClient writes data to the single connection with the given ID. The
+// write error, if any, is returned as is.
+func (sm *SessionManager) SendToClient(sessionKey string, clientID string, messageType int, data []byte) error {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	cl, err := sm.findClient(sessionKey, clientID)
+	if err != nil {
+		return err
+	}
+	s := sm.sessions[sessionKey]
+	if _, err := sm.writeFrameLocked(s, cl, messageType, data); err != nil {
+		return err
+	}
+	s.lastUsed = time.Now()
+	return nil
+}
@@ -0,0 +1,231 @@
+package ws_manager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// QueueFullPolicy decides what happens to a frame sent to a connection
+// whose send queue is full.
+type QueueFullPolicy int
+
+const (
+	// QueueFullClose drops the frame and, once more than the grace number
+	// of frames have overflowed, closes the connection.
+	QueueFullClose QueueFullPolicy = iota
+	// QueueFullDropOldest discards the oldest queued frame to make room.
+	QueueFullDropOldest
+	// QueueFullDropNewest discards the frame being sent.
+	QueueFullDropNewest
+)
+
+// WithSendQueue gives every connection accepted by EchoHandler its own
+// writer with a queue of up to depth frames, so a slow reader no longer
+// stalls broadcasts to the rest of its session. Sends then only enqueue:
+// write errors surface as the connection closing rather than as broadcast
+// errors. policy applies when the queue is full; under QueueFullClose a
+// connection is closed once more than grace frames have overflowed. A zero
+// depth writes synchronously, which is the default.
+func WithSendQueue(depth int, policy QueueFullPolicy, grace int) Option {
+	return func(sm *SessionManager) {
+		sm.sendQueueDepth = depth
+		sm.sendQueuePolicy = policy
+		sm.sendQueueGrace = grace
+	}
+}
+
+type queuedFrame struct {
+	messageType int
+	data        []byte
+}
+
+type sendQueue struct {
+	depth  int
+	policy QueueFullPolicy
+	grace  int
+
+	// slowAfter, slowPolicy and onSlow are set by WithSlowConsumer; onSlow
+	// is called once per episode and returns the notice to write first
+	slowAfter  time.Duration
+	slowPolicy SlowConsumerPolicy
+	onSlow     func(queued int, lag time.Duration) (queuedFrame, bool)
+
+	mu       sync.Mutex
+	frames   []queuedFrame
+	overflow int
+	closed   bool
+	ready    chan struct{}
+	done     chan struct{}
+	// fullSince is when the queue last filled up, zero once drained to half
+	// its depth; lagging is set while it has been full past slowAfter
+	fullSince time.Time
+	lagging   bool
+	notice    *queuedFrame
+	closeCode int
+}
+
+func newSendQueue(depth int, policy QueueFullPolicy, grace int) *sendQueue {
+	return &sendQueue{
+		depth:  depth,
+		policy: policy,
+		grace:  grace,
+		ready:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// push queues a frame and reports whether the connection has to be closed
+// because it cannot keep up.
+func (q *sendQueue) push(messageType int, data []byte) (overflowed bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	if len(q.frames) >= q.depth {
+		if q.slowLocked(time.Now()) {
+			switch q.slowPolicy {
+			case SlowConsumerDisconnect:
+				q.closeCode = websocket.CloseTryAgainLater
+				return true
+			case SlowConsumerDropOldest:
+				q.frames = q.frames[1:]
+				q.appendLocked(messageType, data)
+				return false
+			}
+		}
+		switch q.policy {
+		case QueueFullDropOldest:
+			q.frames = q.frames[1:]
+		case QueueFullDropNewest:
+			return false
+		default:
+			q.overflow++
+			return q.overflow > q.grace
+		}
+	}
+	q.appendLocked(messageType, data)
+	return false
+}
+
+func (q *sendQueue) appendLocked(messageType int, data []byte) {
+	q.frames = append(q.frames, queuedFrame{messageType: messageType, data: data})
+	q.signalLocked()
+}
+
+func (q *sendQueue) signalLocked() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// slowLocked notes that the queue is full at now and reports whether it has
+// been for longer than slowAfter, starting an episode if it just got there.
+func (q *sendQueue) slowLocked(now time.Time) bool {
+	if q.slowAfter <= 0 {
+		return false
+	}
+	if q.fullSince.IsZero() {
+		q.fullSince = now
+	}
+	if !q.lagging && now.Sub(q.fullSince) > q.slowAfter {
+		q.lagging = true
+		if notice, ok := q.onSlow(len(q.frames), now.Sub(q.fullSince)); ok {
+			q.notice = &notice
+			q.signalLocked()
+		}
+	}
+	return q.lagging
+}
+
+// isLagging reports whether the connection is a slow consumer right now.
+func (q *sendQueue) isLagging() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.lagging
+}
+
+// slowCloseCode returns the close code for a connection push reported as
+// overflowed because of its slow consumer policy, or zero.
+func (q *sendQueue) slowCloseCode() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closeCode
+}
+
+// pop waits for the next frame, the lagging notice first. It returns false
+// once the queue is closed.
+func (q *sendQueue) pop() (queuedFrame, bool) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return queuedFrame{}, false
+		}
+		if q.notice != nil {
+			frame := *q.notice
+			q.notice = nil
+			q.mu.Unlock()
+			return frame, true
+		}
+		if len(q.frames) > 0 {
+			frame := q.frames[0]
+			q.frames = q.frames[1:]
+			if len(q.frames) <= q.depth/2 {
+				q.fullSince = time.Time{}
+				q.lagging = false
+			}
+			q.mu.Unlock()
+			return frame, true
+		}
+		q.mu.Unlock()
+		<-q.ready
+	}
+}
+
+func (q *sendQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.frames = nil
+	q.notice = nil
+	q.signalLocked()
+	q.mu.Unlock()
+}
+
+// startWriter gives cl a send queue drained by its own goroutine. A failed
+// write closes the connection, which ends its read loop. The returned
+// function stops the writer and waits for it; the connection must be
+// closed first so that a blocked write returns.
+func (sm *SessionManager) startWriter(sessionKey string, cl *client) (stop func()) {
+	if sm.sendQueueDepth <= 0 {
+		return func() {}
+	}
+	q := newSendQueue(sm.sendQueueDepth, sm.sendQueuePolicy, sm.sendQueueGrace)
+	sm.watchSlowConsumer(sessionKey, cl, q)
+	cl.queue = q
+	go func() {
+		defer close(q.done)
+		for {
+			frame, ok := q.pop()
+			if !ok {
+				return
+			}
+			cl.writeMu.Lock()
+			err := cl.writeFrame(frame.messageType, frame.data)
+			cl.writeMu.Unlock()
+			if err != nil {
+				sm.logger.Warn("Write failed", "client", cl.id, "err", err)
+				q.close()
+				cl.conn.Close()
+				return
+			}
+		}
+	}()
+	return func() {
+		q.close()
+		<-q.done
+	}
+}
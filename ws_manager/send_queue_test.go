@@ -0,0 +1,219 @@
+package ws_manager
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SendQueueTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *SendQueueTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithSendQueue(4, QueueFullClose, 2),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *SendQueueTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+func queuedMessages(q *sendQueue) []string {
+	messages := []string{}
+	for _, frame := range q.frames {
+		messages = append(messages, string(frame.data))
+	}
+	return messages
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *SendQueueTestSuite) TestSlowConsumerIsDroppedWhileOthersReceive() {
+	fast := []*websocket.Conn{}
+	for i := 0; i < 3; i++ {
+		conn, err := dialSession(suite.server, suite.sessionKey, "")
+		assert.NoError(suite.T(), err)
+		fast = append(fast, conn)
+	}
+	_, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 4))
+
+	// wedge the writer of the last connection as if its socket were full
+	suite.manager.sessionManagerMu.Lock()
+	slow := suite.manager.sessions[suite.sessionKey].clients[3]
+	suite.manager.sessionManagerMu.Unlock()
+	slow.writeMu.Lock()
+	defer slow.writeMu.Unlock()
+
+	for i := 0; i < 10; i++ {
+		message := fmt.Sprintf("update %d", i)
+		assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte(message)))
+		for _, conn := range fast {
+			received, err := readWithTimeout(conn, time.Second)
+			assert.NoError(suite.T(), err)
+			assert.Equal(suite.T(), message, received)
+		}
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 3))
+}
+
+func (suite *SendQueueTestSuite) TestDropPolicies() {
+	oldest := newSendQueue(3, QueueFullDropOldest, 0)
+	newest := newSendQueue(3, QueueFullDropNewest, 0)
+	closing := newSendQueue(3, QueueFullClose, 1)
+	overflowed := []bool{}
+	for i := 1; i <= 5; i++ {
+		message := []byte(fmt.Sprint(i))
+		assert.False(suite.T(), oldest.push(websocket.TextMessage, message))
+		assert.False(suite.T(), newest.push(websocket.TextMessage, message))
+		overflowed = append(overflowed, closing.push(websocket.TextMessage, message))
+	}
+	assert.Equal(suite.T(), []string{"3", "4", "5"}, queuedMessages(oldest))
+	assert.Equal(suite.T(), []string{"1", "2", "3"}, queuedMessages(newest))
+	assert.Equal(suite.T(), []bool{false, false, false, false, true}, overflowed)
+}
+
+func (suite *SendQueueTestSuite) TestConcurrentBroadcastsAreAllDelivered() {
+	suite.TearDownTest()
+	suite.manager = CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithSendQueue(64, QueueFullClose, 0),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 8; j++ {
+				message := fmt.Sprintf("%d-%d", i, j)
+				assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte(message)))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	received := map[string]bool{}
+	for len(received) < 32 {
+		message, err := readWithTimeout(receiver, time.Second)
+		if !assert.NoError(suite.T(), err) {
+			return
+		}
+		received[message] = true
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+}
+
+func (suite *SendQueueTestSuite) TestSlowConsumerPolicies() {
+	slow := 0
+	newQueue := func(policy SlowConsumerPolicy) *sendQueue {
+		q := newSendQueue(2, QueueFullDropNewest, 0)
+		q.slowAfter = time.Millisecond
+		q.slowPolicy = policy
+		q.onSlow = func(queued int, lag time.Duration) (queuedFrame, bool) {
+			slow++
+			assert.Equal(suite.T(), 2, queued)
+			return queuedFrame{messageType: websocket.TextMessage, data: []byte("lagging")}, policy == SlowConsumerNotify
+		}
+		return q
+	}
+	oldest := newQueue(SlowConsumerDropOldest)
+	notify := newQueue(SlowConsumerNotify)
+	for i := 1; i <= 5; i++ {
+		if i == 4 {
+			time.Sleep(5 * time.Millisecond)
+		}
+		message := []byte(fmt.Sprint(i))
+		assert.False(suite.T(), oldest.push(websocket.TextMessage, message))
+		assert.False(suite.T(), notify.push(websocket.TextMessage, message))
+	}
+	assert.Equal(suite.T(), 2, slow)
+	assert.Equal(suite.T(), []string{"4", "5"}, queuedMessages(oldest))
+	assert.Equal(suite.T(), []string{"1", "2"}, queuedMessages(notify))
+	assert.True(suite.T(), notify.isLagging())
+
+	frame, _ := notify.pop()
+	assert.Equal(suite.T(), "lagging", string(frame.data))
+	frame, _ = notify.pop()
+	assert.Equal(suite.T(), "1", string(frame.data))
+	assert.False(suite.T(), notify.isLagging())
+}
+
+func (suite *SendQueueTestSuite) TestSlowConsumerIsDisconnected() {
+	suite.TearDownTest()
+	suite.manager = CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithSendQueue(2, QueueFullDropNewest, 0),
+		WithSlowConsumer(20*time.Millisecond, SlowConsumerDisconnect),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	suite.manager.sessionManagerMu.Lock()
+	slow := suite.manager.sessions[suite.sessionKey].clients[0]
+	suite.manager.sessionManagerMu.Unlock()
+	slow.writeMu.Lock()
+	// let the writer take the first frame and block on it
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("update")))
+	assert.Eventually(suite.T(), func() bool {
+		slow.queue.mu.Lock()
+		defer slow.queue.mu.Unlock()
+		return len(slow.queue.frames) == 0
+	}, time.Second, time.Millisecond)
+	for i := 0; i < 3; i++ {
+		assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("update")))
+	}
+	clients, err := suite.manager.GetClients(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), clients[0].SlowConsumer)
+	time.Sleep(30 * time.Millisecond)
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("update")))
+	slow.writeMu.Unlock()
+
+	_, err = readWithTimeout(conn, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.CloseTryAgainLater), "got %v", err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+	metrics := suite.manager.Metrics()
+	assert.Equal(suite.T(), uint64(1), metrics.SlowConsumers)
+	assert.Equal(suite.T(), uint64(1), metrics.SlowConsumerDisconnects)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestSendQueueTestSuite(t *testing.T) {
+	suite.Run(t, new(SendQueueTestSuite))
+}
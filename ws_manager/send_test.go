@@ -0,0 +1,95 @@
+package ws_manager
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SendTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *SendTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey})
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *SendTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *SendTestSuite) TestSendReachesOnlyTarget() {
+	target, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", nil)
+	assert.NoError(suite.T(), err)
+	other, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	clientID := resp.Header.Get(ClientIDHeader)
+	err = suite.manager.SendToClient(suite.sessionKey, clientID, websocket.TextMessage, []byte("psst"))
+	assert.NoError(suite.T(), err)
+
+	message, err := readWithTimeout(target, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "psst", message)
+
+	_, err = readWithTimeout(other, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *SendTestSuite) TestSendToWritesText() {
+	target, clientID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	assert.NoError(suite.T(), suite.manager.SendTo(suite.sessionKey, clientID, []byte("hello")))
+	messageType, message, err := target.ReadMessage()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), websocket.TextMessage, messageType)
+	assert.Equal(suite.T(), "hello", string(message))
+}
+
+func (suite *SendTestSuite) TestSendNotFound() {
+	err := suite.manager.SendToClient("missing", "1", websocket.TextMessage, []byte("x"))
+	assert.EqualError(suite.T(), err, "Session missing not found")
+
+	err = suite.manager.SendToClient(suite.sessionKey, "404", websocket.TextMessage, []byte("x"))
+	assert.EqualError(suite.T(), err, "Client 404 not found in session abcdefgh")
+}
+
+func (suite *SendTestSuite) TestSendReturnsWriteError() {
+	_, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey, "", nil)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	// close the server side so the write hits a closed connection
+	conns, err := suite.manager.GetSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	conns[0].Close()
+
+	err = suite.manager.SendToClient(suite.sessionKey, resp.Header.Get(ClientIDHeader), websocket.TextMessage, []byte("x"))
+	assert.Error(suite.T(), err)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestSendTestSuite(t *testing.T) {
+	suite.Run(t, new(SendTestSuite))
+}
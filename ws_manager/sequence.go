@@ -0,0 +1,97 @@
+package ws_manager
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSequenceGap is returned by ReplaySince when some of the broadcasts
+// after the requested sequence number are no longer in the history, so the
+// client has to resync its state from scratch.
+var ErrSequenceGap = errors.New("Sequence gap")
+
+// WithSequenceNumbers stamps every broadcast with a sequence number that
+// starts at 1 and increases by one per broadcast in the session, carried in
+// the "seq" field of its envelope:
+//
+//	{"from":"3","ts":1700000000000,"data":"hello","seq":42}
+//
+// It turns on envelope mode unless protocol mode is on, where the Envelope
+// carries Seq instead. A session's broadcasts are written in sequence
+// order, through the send queue when there is one, so a connection sees
+// increasing numbers; a jump means frames were dropped, e.g. by a full send
+// queue, and the client can fetch them from the history with the control
+// message
+//
+//	{"control":"since","seq":41}
+//
+// which replays the retained broadcasts after 41 to that connection only.
+// Broadcasts limited to some connections still take a number, so a
+// connection outside them also sees a jump.
+func WithSequenceNumbers(enabled bool) Option {
+	return func(sm *SessionManager) {
+		sm.sequenceNumbers = enabled
+		if enabled {
+			sm.envelopeMode = true
+		}
+	}
+}
+
+// nextSeqLocked returns the sequence number of the next broadcast in s, or
+// zero without WithSequenceNumbers. The caller must hold sessionManagerMu.
+func (sm *SessionManager) nextSeqLocked(s *session) uint64 {
+	if !sm.sequenceNumbers {
+		return 0
+	}
+	s.seq++
+	return s.seq
+}
+
+// ReplaySince writes the broadcasts of the session history numbered after
+// seq to the connection with clientID, oldest first, as the "since" control
+// message does. It returns how many it wrote, and ErrSequenceGap, after
+// writing them, if the history no longer holds all of them. Live
+// broadcasts wait until the replay is done.
+func (sm *SessionManager) ReplaySince(sessionKey string, clientID string, seq uint64) (int, error) {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return 0, sessionNotFound(sessionKey)
+	}
+	cl := s.client(clientID)
+	if cl == nil {
+		return 0, clientNotFound(sessionKey, clientID)
+	}
+	return sm.replaySinceLocked(s, cl, seq)
+}
+
+// replaySinceLocked writes the history of s after seq to cl. The caller must
+// hold sessionManagerMu.
+func (sm *SessionManager) replaySinceLocked(s *session, cl *client, seq uint64) (int, error) {
+	if !sm.sequenceNumbers || sm.historySizeLocked(s) <= 0 {
+		return 0, errors.New("Replay needs sequence numbers and history")
+	}
+	sm.expireHistoryLocked(s, time.Now())
+	replayed := 0
+	first := uint64(0)
+	for _, entry := range s.history {
+		if entry.seq <= seq {
+			continue
+		}
+		if first == 0 {
+			first = entry.seq
+		}
+		if entry.match != nil && !entry.match(cl) {
+			continue
+		}
+		if _, err := sm.writeFrameLocked(s, cl, entry.messageType, entry.message); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	if s.seq > seq && (first == 0 || first > seq+1) {
+		return replayed, ErrSequenceGap
+	}
+	return replayed, nil
+}
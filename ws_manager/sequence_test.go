@@ -0,0 +1,148 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SequenceTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *SequenceTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+}
+
+func (suite *SequenceTestSuite) TearDownTest() {
+	if suite.server != nil {
+		suite.server.Close()
+		suite.manager.cronScheduler.Stop()
+		suite.server = nil
+	}
+}
+
+func (suite *SequenceTestSuite) start(opts ...Option) {
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, append([]Option{WithSequenceNumbers(true)}, opts...)...)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+// readSeqs reads n envelopes from conn and returns their sequence numbers.
+func (suite *SequenceTestSuite) readSeqs(conn *websocket.Conn, n int) []uint64 {
+	seqs := []uint64{}
+	for i := 0; i < n; i++ {
+		message, err := readWithTimeout(conn, time.Second)
+		if !assert.NoError(suite.T(), err) {
+			break
+		}
+		env := envelope{}
+		assert.NoError(suite.T(), json.Unmarshal([]byte(message), &env))
+		seqs = append(seqs, env.Seq)
+	}
+	return seqs
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *SequenceTestSuite) TestBroadcastsAreNumberedInOrder() {
+	suite.start(WithSendQueue(64, QueueFullDropOldest, 0))
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	for i := 0; i < 20; i++ {
+		_, errs := suite.manager.Broadcast(suite.sessionKey, SystemSender, websocket.TextMessage, []byte("op"))
+		assert.Empty(suite.T(), errs)
+	}
+	seqs := suite.readSeqs(conn, 20)
+	for i, seq := range seqs {
+		assert.Equal(suite.T(), uint64(i+1), seq)
+	}
+}
+
+func (suite *SequenceTestSuite) TestNumbersArePerSession() {
+	suite.start()
+	assert.NoError(suite.T(), suite.manager.RegisterSession("roomtwo"))
+	conn, err := dialSession(suite.server, "roomtwo", "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomtwo", 1))
+
+	suite.manager.Broadcast(suite.sessionKey, SystemSender, websocket.TextMessage, []byte("elsewhere"))
+	suite.manager.Broadcast("roomtwo", SystemSender, websocket.TextMessage, []byte("here"))
+	assert.Equal(suite.T(), []uint64{1}, suite.readSeqs(conn, 1))
+}
+
+func (suite *SequenceTestSuite) TestReplaySince() {
+	suite.start(WithHistorySize(3))
+	for i := 0; i < 5; i++ {
+		suite.manager.Broadcast(suite.sessionKey, SystemSender, websocket.TextMessage, []byte("op"))
+	}
+	conn, id, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	// the join replays the whole history
+	assert.Equal(suite.T(), []uint64{3, 4, 5}, suite.readSeqs(conn, 3))
+
+	assert.NoError(suite.T(), conn.WriteMessage(websocket.TextMessage, []byte(`{"control":"since","seq":3}`)))
+	assert.Equal(suite.T(), []uint64{4, 5}, suite.readSeqs(conn, 2))
+
+	replayed, err := suite.manager.ReplaySince(suite.sessionKey, id, 1)
+	assert.Equal(suite.T(), ErrSequenceGap, err)
+	assert.Equal(suite.T(), 3, replayed)
+	assert.Equal(suite.T(), []uint64{3, 4, 5}, suite.readSeqs(conn, 3))
+
+	replayed, err = suite.manager.ReplaySince(suite.sessionKey, id, 5)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, replayed)
+	_, err = suite.manager.ReplaySince(suite.sessionKey, "missing", 0)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *SequenceTestSuite) TestReplayNeedsHistory() {
+	suite.start()
+	conn, id, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	_, err = suite.manager.ReplaySince(suite.sessionKey, id, 0)
+	assert.Error(suite.T(), err)
+	assert.NotEqual(suite.T(), ErrSequenceGap, err)
+}
+
+func (suite *SequenceTestSuite) TestProtocolModeEnvelopesCarrySeq() {
+	suite.start(WithProtocolMode(true), WithHistorySize(5))
+	assert.NoError(suite.T(), suite.manager.BroadcastEnvelope(suite.sessionKey, "op", "first"))
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	assert.NoError(suite.T(), suite.manager.BroadcastEnvelope(suite.sessionKey, "op", "second"))
+
+	for _, want := range []Envelope{{Seq: 1, Replayed: true}, {Seq: 2}} {
+		message, err := readWithTimeout(conn, time.Second)
+		assert.NoError(suite.T(), err)
+		env := Envelope{}
+		assert.NoError(suite.T(), json.Unmarshal([]byte(message), &env))
+		assert.Equal(suite.T(), want.Seq, env.Seq)
+		assert.Equal(suite.T(), want.Replayed, env.Replayed)
+		assert.Equal(suite.T(), "op", env.Type)
+	}
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestSequenceTestSuite(t *testing.T) {
+	suite.Run(t, new(SequenceTestSuite))
+}
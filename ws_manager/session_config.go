@@ -0,0 +1,119 @@
+package ws_manager
+
+import (
+	"time"
+)
+
+// SessionConfig overrides settings of the manager for one session, for
+// apps whose rooms have different needs, e.g. a lobby with no history and
+// a large cap next to small rooms keeping their last hundred messages.
+// Zero fields keep the manager's settings, so a SessionConfig only needs
+// the settings it changes:
+//
+//	err := sm.RegisterSessionWithConfig("lobby", SessionConfig{
+//		HistorySize: -1,
+//		MaxClients:  5000,
+//		IdleTTL:     -1,
+//	})
+type SessionConfig struct {
+	// HistorySize replaces WithHistorySize; negative keeps no history.
+	// It is also the history of the streams of the session that do not
+	// set StreamHistory.
+	HistorySize int
+	// RateLimit replaces the per-connection rate of WithRateLimit and
+	// WithConnectionRateLimit for the connections of the session, unless
+	// their stream sets StreamRateLimit.
+	RateLimit RateLimit
+	// MaxClients replaces WithMaxConnectionsPerSession; negative is
+	// unlimited.
+	MaxClients int
+	// IdleTTL replaces the ttl of the collectors, see StartGC, for the
+	// session; negative never collects it.
+	IdleTTL time.Duration
+	// IncludeSender echoes every broadcast back to its sender, as
+	// SetIncludeSender.
+	IncludeSender bool
+}
+
+// RegisterSessionWithConfig is RegisterSession with config overriding the
+// settings of the manager for the session.
+func (sm *SessionManager) RegisterSessionWithConfig(sessionKey string, config SessionConfig) error {
+	return sm.registerSession(sessionKey, config)
+}
+
+// SetSessionConfig replaces the overrides of a session, e.g. one created
+// with WithAutoRegister. The cap and rate limit apply to connections joining
+// afterwards, and IncludeSender replaces what SetIncludeSender set.
+func (sm *SessionManager) SetSessionConfig(sessionKey string, config SessionConfig) error {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return sessionNotFound(sessionKey)
+	}
+	s.configure(config)
+	return nil
+}
+
+// configure applies config to s. The caller must hold sessionManagerMu if
+// s is registered.
+func (s *session) configure(config SessionConfig) {
+	s.config = config
+	s.includeSender = config.IncludeSender
+}
+
+// GetSessionConfig returns the overrides of a session.
+func (sm *SessionManager) GetSessionConfig(sessionKey string) (SessionConfig, error) {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return SessionConfig{}, sessionNotFound(sessionKey)
+	}
+	return s.config, nil
+}
+
+// historySizeLocked returns how many broadcasts s keeps. The caller must
+// hold sessionManagerMu.
+func (sm *SessionManager) historySizeLocked(s *session) int {
+	switch {
+	case s.config.HistorySize < 0:
+		return 0
+	case s.config.HistorySize > 0:
+		return s.config.HistorySize
+	}
+	return sm.historySize
+}
+
+// maxClientsLocked returns how many connections s holds at most, zero for
+// no cap. The caller must hold sessionManagerMu.
+func (sm *SessionManager) maxClientsLocked(s *session) int {
+	switch {
+	case s.config.MaxClients < 0:
+		return 0
+	case s.config.MaxClients > 0:
+		return s.config.MaxClients
+	}
+	return sm.maxConnectionsPerSession
+}
+
+// idleTTLLocked returns the ttl a collector with ttl applies to s,
+// negative if s is never collected. The caller must hold sessionManagerMu.
+func idleTTLLocked(s *session, ttl time.Duration) time.Duration {
+	if s.config.IdleTTL != 0 {
+		return s.config.IdleTTL
+	}
+	return ttl
+}
+
+// sessionRateLimitOverride returns the per-connection rate limit set for
+// sessionKey with SessionConfig, and whether there is one.
+func (sm *SessionManager) sessionRateLimitOverride(sessionKey string) (RateLimit, bool) {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok || s.config.RateLimit == (RateLimit{}) {
+		return RateLimit{}, false
+	}
+	return s.config.RateLimit, true
+}
@@ -0,0 +1,127 @@
+package ws_manager
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SessionConfigTestSuite struct {
+	suite.Suite
+	manager *SessionManager
+	server  *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *SessionConfigTestSuite) SetupTest() {
+	suite.manager = CreateSessionManager([]string{"defaults"},
+		WithHistorySize(1),
+		WithMaxConnectionsPerSession(1),
+		WithLogger(NopLogger()),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *SessionConfigTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+// replayed dials sessionKey and returns the history it is sent.
+func (suite *SessionConfigTestSuite) replayed(sessionKey string) []string {
+	conn, err := dialSession(suite.server, sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	var messages []string
+	for {
+		message, err := readWithTimeout(conn, 200*time.Millisecond)
+		if err != nil {
+			return messages
+		}
+		messages = append(messages, message)
+	}
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *SessionConfigTestSuite) TestHistorySize() {
+	assert.NoError(suite.T(), suite.manager.RegisterSessionWithConfig("chat", SessionConfig{HistorySize: 3}))
+	assert.NoError(suite.T(), suite.manager.RegisterSessionWithConfig("cursors", SessionConfig{HistorySize: -1}))
+	for _, key := range []string{"defaults", "chat", "cursors"} {
+		for i := 1; i <= 4; i++ {
+			assert.NoError(suite.T(), suite.manager.BroadcastMessage(key, "", websocket.TextMessage, []byte(fmt.Sprint(i))))
+		}
+	}
+	assert.Equal(suite.T(), []string{"4"}, suite.replayed("defaults"))
+	assert.Equal(suite.T(), []string{"2", "3", "4"}, suite.replayed("chat"))
+	assert.Empty(suite.T(), suite.replayed("cursors"))
+}
+
+func (suite *SessionConfigTestSuite) TestMaxClients() {
+	assert.NoError(suite.T(), suite.manager.RegisterSessionWithConfig("lobby", SessionConfig{MaxClients: -1}))
+	for i := 0; i < 3; i++ {
+		conn, err := dialSession(suite.server, "lobby", "")
+		assert.NoError(suite.T(), err)
+		defer conn.Close()
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, "lobby", 3))
+
+	conn, err := dialSession(suite.server, "defaults", "")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, "defaults", 1))
+	_, resp, err := dialSessionWithHeader(suite.server, "defaults", "", http.Header{})
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func (suite *SessionConfigTestSuite) TestIdleTTL() {
+	assert.NoError(suite.T(), suite.manager.RegisterSessionWithConfig("forever", SessionConfig{IdleTTL: -1}))
+	assert.NoError(suite.T(), suite.manager.RegisterSessionWithConfig("brief", SessionConfig{IdleTTL: time.Millisecond}))
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(suite.T(), 1, suite.manager.CollectGarbage(time.Hour))
+	_, err := suite.manager.GetSession("brief")
+	assert.True(suite.T(), errors.Is(err, ErrSessionNotFound))
+	assert.Equal(suite.T(), 1, suite.manager.CollectGarbage(0))
+	_, err = suite.manager.GetSession("forever")
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *SessionConfigTestSuite) TestIncludeSenderAndRateLimit() {
+	assert.NoError(suite.T(), suite.manager.RegisterSessionWithConfig("echo", SessionConfig{
+		IncludeSender: true,
+		RateLimit:     RateLimit{Messages: 0.001, MessageBurst: 1},
+	}))
+	conn, err := dialSession(suite.server, "echo", "")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, "echo", 1))
+	assert.NoError(suite.T(), conn.WriteMessage(websocket.TextMessage, []byte("first")))
+	assert.NoError(suite.T(), conn.WriteMessage(websocket.TextMessage, []byte("second")))
+	message, err := readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "first", message)
+	_, err = readWithTimeout(conn, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+
+	config, err := suite.manager.GetSessionConfig("echo")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), config.IncludeSender)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestSessionConfigTestSuite(t *testing.T) {
+	suite.Run(t, new(SessionConfigTestSuite))
+}
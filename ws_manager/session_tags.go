@@ -0,0 +1,76 @@
+package ws_manager
+
+import (
+	"reflect"
+	"sort"
+)
+
+// SetSessionTags replaces the tags of the session, e.g. the product or
+// tenant it belongs to, for ListSessionsByTag. Tags are kept with the
+// session's metadata: they are persisted by a SessionStore, exported by
+// ExportSession and reported in SessionStats.Tags.
+func (sm *SessionManager) SetSessionTags(sessionKey string, tags ...string) error {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return sessionNotFound(sessionKey)
+	}
+	s.setTags(tags)
+	sm.markStoredLocked(sessionKey, false)
+	return nil
+}
+
+// GetSessionTags returns the session's tags in sorted order.
+func (sm *SessionManager) GetSessionTags(sessionKey string) ([]string, error) {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return nil, sessionNotFound(sessionKey)
+	}
+	return sortedSet(s.tags), nil
+}
+
+// ListSessionsByTag returns the keys of the sessions carrying every one of
+// tags, in sorted order. Without tags it lists every session.
+func (sm *SessionManager) ListSessionsByTag(tags ...string) []string {
+	return sm.listSessions(func(s *session) bool {
+		for _, tag := range tags {
+			if _, ok := s.tags[tag]; !ok {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// ListSessionsByMetadata returns the keys of the sessions whose metadata
+// holds value under key, e.g. an owner set with SetSessionMetadata, in
+// sorted order. Values are compared with reflect.DeepEqual.
+func (sm *SessionManager) ListSessionsByMetadata(key string, value interface{}) []string {
+	return sm.listSessions(func(s *session) bool {
+		v, ok := s.metadata[key]
+		return ok && reflect.DeepEqual(v, value)
+	})
+}
+
+func (sm *SessionManager) listSessions(match func(s *session) bool) []string {
+	sm.rlockSessions()
+	defer sm.runlockSessions()
+	keys := []string{}
+	for key, s := range sm.sessions {
+		if match(s) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *session) setTags(tags []string) {
+	s.tags = make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		s.tags[tag] = struct{}{}
+	}
+}
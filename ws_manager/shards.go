@@ -0,0 +1,67 @@
+package ws_manager
+
+import (
+	"sync"
+)
+
+// sessionShards is the number of locks the sessions are striped over.
+const sessionShards = 64
+
+// sessionShard guards the sessions whose keys hash to it. Connecting,
+// broadcasting and handling an inbound message only touch one session, so
+// they lock its shard, with sessionManagerMu held shared, and run in
+// parallel with the same work on the sessions of other shards. Anything
+// spanning sessions, and registering or removing one, takes
+// sessionManagerMu exclusively, which excludes every shard.
+type sessionShard struct {
+	mu sync.RWMutex
+}
+
+// shardOf returns the shard of sessionKey, by its 32-bit FNV-1a hash.
+func (sm *SessionManager) shardOf(sessionKey string) *sessionShard {
+	h := uint32(2166136261)
+	for i := 0; i < len(sessionKey); i++ {
+		h ^= uint32(sessionKey[i])
+		h *= 16777619
+	}
+	return &sm.shards[h%sessionShards]
+}
+
+// lockSession locks the session sessionKey for a change to it alone. The
+// set of sessions stays as it is until unlockSession.
+func (sm *SessionManager) lockSession(sessionKey string) {
+	sm.sessionManagerMu.RLock()
+	sm.shardOf(sessionKey).mu.Lock()
+}
+
+func (sm *SessionManager) unlockSession(sessionKey string) {
+	sm.shardOf(sessionKey).mu.Unlock()
+	sm.sessionManagerMu.RUnlock()
+}
+
+// rlockSession locks the session sessionKey for reading.
+func (sm *SessionManager) rlockSession(sessionKey string) {
+	sm.sessionManagerMu.RLock()
+	sm.shardOf(sessionKey).mu.RLock()
+}
+
+func (sm *SessionManager) runlockSession(sessionKey string) {
+	sm.shardOf(sessionKey).mu.RUnlock()
+	sm.sessionManagerMu.RUnlock()
+}
+
+// rlockSessions locks every session for reading, for accessors reporting
+// on all of them.
+func (sm *SessionManager) rlockSessions() {
+	sm.sessionManagerMu.RLock()
+	for i := range sm.shards {
+		sm.shards[i].mu.RLock()
+	}
+}
+
+func (sm *SessionManager) runlockSessions() {
+	for i := len(sm.shards) - 1; i >= 0; i-- {
+		sm.shards[i].mu.RUnlock()
+	}
+	sm.sessionManagerMu.RUnlock()
+}
@@ -0,0 +1,174 @@
+package ws_manager
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ShardsTestSuite struct {
+	suite.Suite
+	keys    []string
+	manager *SessionManager
+	server  *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *ShardsTestSuite) SetupTest() {
+	suite.keys = []string{}
+	for i := 0; i < 8; i++ {
+		suite.keys = append(suite.keys, fmt.Sprintf("session%d", i))
+	}
+	suite.manager = CreateSessionManager(suite.keys, WithLogger(NopLogger()))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *ShardsTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+// keysOnTwoShards returns two of the suite's keys that hash to different
+// shards.
+func (suite *ShardsTestSuite) keysOnTwoShards() (string, string) {
+	for _, key := range suite.keys[1:] {
+		if suite.manager.shardOf(key) != suite.manager.shardOf(suite.keys[0]) {
+			return suite.keys[0], key
+		}
+	}
+	suite.T().Fatal("all keys on one shard")
+	return "", ""
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *ShardsTestSuite) TestKeysSpreadOverShards() {
+	used := map[*sessionShard]bool{}
+	for i := 0; i < 1000; i++ {
+		used[suite.manager.shardOf(fmt.Sprintf("key%d", i))] = true
+	}
+	assert.Equal(suite.T(), sessionShards, len(used))
+	assert.Equal(suite.T(), suite.manager.shardOf("abcdefgh"), suite.manager.shardOf("abcdefgh"))
+}
+
+func (suite *ShardsTestSuite) TestBroadcastsOnOtherShardsProceed() {
+	busy, other := suite.keysOnTwoShards()
+	suite.manager.lockSession(busy)
+
+	done := make(chan struct{})
+	go func() {
+		suite.manager.Broadcast(other, "", websocket.TextMessage, []byte("hello"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		suite.T().Fatal("broadcast blocked by another shard")
+	}
+
+	blocked := make(chan struct{})
+	go func() {
+		suite.manager.Broadcast(busy, "", websocket.TextMessage, []byte("hello"))
+		close(blocked)
+	}()
+	select {
+	case <-blocked:
+		suite.T().Fatal("broadcast ran while its session was locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	suite.manager.unlockSession(busy)
+	select {
+	case <-blocked:
+	case <-time.After(time.Second):
+		suite.T().Fatal("broadcast did not resume")
+	}
+}
+
+func (suite *ShardsTestSuite) TestSingleSessionCallsOnOtherShardsProceed() {
+	busy, other := suite.keysOnTwoShards()
+	calls := map[string]func(){
+		"BroadcastToChannel": func() { suite.manager.BroadcastToChannel(other, "room-1", "", websocket.TextMessage, []byte("hi")) },
+		"SendToClient":       func() { suite.manager.SendToClient(other, "nobody", websocket.TextMessage, []byte("hi")) },
+		"BroadcastFunc": func() {
+			suite.manager.BroadcastFunc(other, "", websocket.TextMessage, []byte("hi"), func(ClientInfo) bool { return true })
+		},
+		"BroadcastWithAck": func() { suite.manager.BroadcastWithAck(other, "", websocket.TextMessage, []byte("hi")) },
+		"GetAuditLog":      func() { suite.manager.GetAuditLog(other, time.Time{}) },
+		"BroadcastContext": func() {
+			suite.manager.BroadcastContext(context.Background(), other, "", websocket.TextMessage, []byte("hi"))
+		},
+		"ReplaySince": func() { suite.manager.ReplaySince(other, "nobody", 0) },
+	}
+	suite.manager.lockSession(busy)
+	defer suite.manager.unlockSession(busy)
+	for name, call := range calls {
+		done := make(chan struct{})
+		go func() {
+			call()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			suite.T().Fatalf("%s blocked by another shard", name)
+		}
+	}
+}
+
+func (suite *ShardsTestSuite) TestConcurrentSessionsKeepCounts() {
+	const clients, broadcasts = 2, 20
+	conns := make([][]*websocket.Conn, len(suite.keys))
+	for i, key := range suite.keys {
+		for j := 0; j < clients; j++ {
+			conn, err := dialSession(suite.server, key, "")
+			assert.NoError(suite.T(), err)
+			defer conn.Close()
+			conns[i] = append(conns[i], conn)
+		}
+		assert.True(suite.T(), waitForConnections(suite.manager, key, clients))
+	}
+
+	var wg sync.WaitGroup
+	for _, key := range suite.keys {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for n := 0; n < broadcasts; n++ {
+				_, errs := suite.manager.Broadcast(key, "", websocket.TextMessage, []byte(key))
+				assert.Empty(suite.T(), errs)
+			}
+		}(key)
+	}
+	wg.Wait()
+
+	for i, key := range suite.keys {
+		for _, conn := range conns[i] {
+			for n := 0; n < broadcasts; n++ {
+				message, err := readWithTimeout(conn, time.Second)
+				assert.NoError(suite.T(), err)
+				assert.Equal(suite.T(), key, message)
+			}
+		}
+	}
+	metrics := suite.manager.Metrics()
+	assert.Equal(suite.T(), uint64(len(suite.keys)*clients), metrics.Connects)
+	assert.Equal(suite.T(), uint64(len(suite.keys)*broadcasts), metrics.Broadcasts)
+	assert.Equal(suite.T(), uint64(len(suite.keys)*clients*broadcasts*len(suite.keys[0])), metrics.BytesRelayed)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestShardsTestSuite(t *testing.T) {
+	suite.Run(t, new(ShardsTestSuite))
+}
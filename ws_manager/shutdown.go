@@ -0,0 +1,99 @@
+package ws_manager
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrShutDown is returned for connections and sessions once Shutdown is
+// called.
+var ErrShutDown = errors.New("Session manager is shut down")
+
+// WithShutdownNotice sends notice as a text message to every connection
+// when Shutdown starts, ahead of its close frame, e.g. to tell clients to
+// reconnect elsewhere. The notice bypasses send queues and pre-broadcast
+// hooks.
+func WithShutdownNotice(notice string) Option {
+	return func(sm *SessionManager) {
+		sm.shutdownNotice = notice
+	}
+}
+
+// sendShutdownNoticeLocked writes the shutdown notice to every connection.
+// The caller must hold sessionManagerMu.
+func (sm *SessionManager) sendShutdownNoticeLocked() {
+	if sm.shutdownNotice == "" {
+		return
+	}
+	deadline := time.Now().Add(time.Second)
+	for _, s := range sm.sessions {
+		for _, cl := range s.clients {
+			cl.writeMu.Lock()
+			cl.conn.SetWriteDeadline(deadline)
+			err := cl.conn.WriteMessage(websocket.TextMessage, []byte(sm.shutdownNotice))
+			cl.writeMu.Unlock()
+			if err != nil {
+				sm.logger.Debug("Shutdown notice failed", "session", s.key, "client", cl.id, "err", err)
+			}
+		}
+	}
+}
+
+// Shutdown stops accepting connections, sends the shutdown notice if one is
+// configured, closes every connection of every session with a going-away
+// close frame, or the one set with WithCloseCode(CloseShutdown, ...),
+// removes all sessions, and stops the collectors started by
+// StartGC or WithGC and the backend subscription. Pending session store
+// changes are saved first, and the removed sessions stay stored. Connection
+// writers stop with their handlers. It then waits for the connection
+// handlers to return, or for ctx to be done, in which case ctx.Err() is
+// returned. Calling it again only waits.
+func (sm *SessionManager) Shutdown(ctx context.Context) error {
+	sm.flushStore()
+	sm.sessionManagerMu.Lock()
+	if !sm.shutDown {
+		close(sm.done)
+		sm.sendShutdownNoticeLocked()
+	}
+	sm.shutDown = true
+	code, reason := sm.closeFrame(CloseShutdown, websocket.CloseGoingAway, "server shutting down")
+	for _, s := range sm.sessions {
+		sm.removeSessionLocked(s, code, reason)
+	}
+	unsubscribe := sm.unsubscribeBackend
+	sm.unsubscribeBackend = nil
+	sm.sessionManagerMu.Unlock()
+	sm.cronScheduler.Stop()
+	if unsubscribe != nil {
+		unsubscribe()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		sm.handlers.Wait()
+		sm.stopAudit()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// trackHandler registers a running connection handler with Shutdown. It
+// fails once the manager is shut down; otherwise the caller must call
+// sm.handlers.Done when the handler returns.
+func (sm *SessionManager) trackHandler() error {
+	sm.sessionManagerMu.RLock()
+	defer sm.sessionManagerMu.RUnlock()
+	if sm.shutDown {
+		return ErrShutDown
+	}
+	sm.handlers.Add(1)
+	return nil
+}
@@ -0,0 +1,143 @@
+package ws_manager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/goleak"
+)
+
+type ShutdownTestSuite struct {
+	suite.Suite
+	manager *SessionManager
+	server  *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *ShutdownTestSuite) SetupTest() {
+	suite.manager = CreateSessionManager([]string{"roomone", "roomtwo"})
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *ShutdownTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *ShutdownTestSuite) TestShutdownClosesEverySession() {
+	first, err := dialSession(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	second, err := dialSession(suite.server, "roomtwo", "")
+	assert.NoError(suite.T(), err)
+	writer, err := dialSession(suite.server, "roomtwo", "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 1))
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomtwo", 2))
+
+	// keep a client writing while the manager shuts down
+	go func() {
+		for {
+			if err := writer.WriteMessage(websocket.TextMessage, []byte("spam")); err != nil {
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	assert.NoError(suite.T(), suite.manager.Shutdown(ctx))
+
+	_, err = readWithTimeout(first, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.CloseGoingAway))
+	for {
+		if _, err = readWithTimeout(second, time.Second); err != nil {
+			break
+		}
+	}
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.CloseGoingAway))
+
+	_, err = suite.manager.GetSession("roomone")
+	assert.EqualError(suite.T(), err, "Session roomone not found")
+	_, err = suite.manager.GetSession("roomtwo")
+	assert.EqualError(suite.T(), err, "Session roomtwo not found")
+}
+
+func (suite *ShutdownTestSuite) TestShutdownNoticePrecedesClose() {
+	suite.TearDownTest()
+	suite.manager = CreateSessionManager([]string{"roomone"}, WithShutdownNotice("restarting"), WithSendQueue(4, QueueFullClose, 0))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+
+	conn, err := dialSession(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 1))
+	assert.NoError(suite.T(), suite.manager.Shutdown(context.Background()))
+
+	message, err := readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "restarting", message)
+	_, err = readWithTimeout(conn, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.CloseGoingAway))
+}
+
+func (suite *ShutdownTestSuite) TestShutdownRejectsNewConnections() {
+	assert.NoError(suite.T(), suite.manager.Shutdown(context.Background()))
+
+	_, resp, err := dialSessionWithHeader(suite.server, "roomone", "", nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Error(suite.T(), suite.manager.RegisterSession("roomthree"))
+}
+
+func (suite *ShutdownTestSuite) TestShutdownHonorsContext() {
+	// a handler that never returns
+	assert.NoError(suite.T(), suite.manager.trackHandler())
+	defer suite.manager.handlers.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(suite.T(), context.DeadlineExceeded, suite.manager.Shutdown(ctx))
+}
+
+func (suite *ShutdownTestSuite) TestCancelledContextShutsDown() {
+	defer goleak.VerifyNone(suite.T(), goleak.IgnoreCurrent())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager := CreateSessionManagerWithContext(ctx, []string{"roomone"})
+	stopGC := manager.StartGC(time.Hour, time.Hour)
+	defer stopGC()
+	e := echo.New()
+	e.GET("/:sessionKey", manager.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	conn, err := dialSession(server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	assert.True(suite.T(), waitForConnections(manager, "roomone", 1))
+
+	cancel()
+	_, err = readWithTimeout(conn, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.CloseGoingAway))
+	assert.Error(suite.T(), manager.RegisterSession("roomtwo"))
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestShutdownTestSuite(t *testing.T) {
+	suite.Run(t, new(ShutdownTestSuite))
+}
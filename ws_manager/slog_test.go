@@ -0,0 +1,77 @@
+//go:build go1.21
+
+package ws_manager
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SlogTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+
+	mu  sync.Mutex
+	out bytes.Buffer
+}
+
+// Write lets the suite collect the handler's output safely.
+func (suite *SlogTestSuite) Write(p []byte) (int, error) {
+	suite.mu.Lock()
+	defer suite.mu.Unlock()
+	return suite.out.Write(p)
+}
+
+func (suite *SlogTestSuite) lines() []string {
+	suite.mu.Lock()
+	defer suite.mu.Unlock()
+	return strings.Split(strings.TrimSpace(suite.out.String()), "\n")
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *SlogTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.out.Reset()
+	logger := slog.New(slog.NewTextHandler(suite, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithLogger(logger), WithLogLevel(LogInfo))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *SlogTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *SlogTestSuite) TestSlogLoggerIsALogger() {
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	suite.manager.collectStale(0)
+
+	lines := suite.lines()
+	if assert.Len(suite.T(), lines, 1) {
+		assert.Contains(suite.T(), lines[0], `level=INFO msg="Evicting idle session" session=abcdefgh connections=1`)
+	}
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestSlogTestSuite(t *testing.T) {
+	suite.Run(t, new(SlogTestSuite))
+}
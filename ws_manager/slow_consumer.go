@@ -0,0 +1,88 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// SlowConsumerPolicy decides what happens to a connection whose send queue
+// has stayed full for longer than the WithSlowConsumer threshold.
+type SlowConsumerPolicy int
+
+const (
+	// SlowConsumerDropOldest discards the oldest queued frame for every new
+	// one until the connection catches up, so it sees the latest messages.
+	SlowConsumerDropOldest SlowConsumerPolicy = iota
+	// SlowConsumerNotify writes a "system.lagging" envelope ahead of the
+	// queued frames, once per episode, and otherwise leaves the queue policy
+	// in charge:
+	//
+	//	{"type":"system.lagging","sender":"","sessionKey":"abcdefgh","timestamp":1700000000000,"payload":{"queued":64,"laggingMs":5000}}
+	SlowConsumerNotify
+	// SlowConsumerDisconnect closes the connection with
+	// CloseTryAgainLater (1013) and the reason "slow consumer".
+	SlowConsumerDisconnect
+)
+
+// WithSlowConsumer marks a connection as a slow consumer once its send queue
+// has been full for longer than threshold, and applies policy to it. The
+// queue counts as full from the first frame that finds no room until the
+// writer drains it to half its depth, which also ends the episode. Until
+// then, and without it, the QueueFullPolicy of WithSendQueue applies. It has
+// no effect without WithSendQueue. Episodes are counted in
+// Metrics.SlowConsumers, and ClientInfo.SlowConsumer tells whether a
+// connection is in one.
+func WithSlowConsumer(threshold time.Duration, policy SlowConsumerPolicy) Option {
+	return func(sm *SessionManager) {
+		sm.slowConsumerThreshold = threshold
+		sm.slowConsumerPolicy = policy
+	}
+}
+
+type laggingNotice struct {
+	Queued    int   `json:"queued"`
+	LaggingMs int64 `json:"laggingMs"`
+}
+
+// watchSlowConsumer arms the slow consumer detection of q for cl.
+func (sm *SessionManager) watchSlowConsumer(sessionKey string, cl *client, q *sendQueue) {
+	if sm.slowConsumerThreshold <= 0 {
+		return
+	}
+	q.slowAfter = sm.slowConsumerThreshold
+	q.slowPolicy = sm.slowConsumerPolicy
+	q.onSlow = func(queued int, lag time.Duration) (queuedFrame, bool) {
+		sm.logger.Warn("Slow consumer", "session", sessionKey, "client", cl.id, "queued", queued, "lagging", lag)
+		atomic.AddUint64(&sm.slowConsumers, 1)
+		switch sm.slowConsumerPolicy {
+		case SlowConsumerDisconnect:
+			atomic.AddUint64(&sm.slowConsumerDisconnects, 1)
+		case SlowConsumerNotify:
+			return sm.laggingFrame(sessionKey, cl, queued, lag)
+		}
+		return queuedFrame{}, false
+	}
+}
+
+// laggingFrame returns the "system.lagging" envelope for cl, encoded with
+// its codec. It reports false if the envelope cannot be built.
+func (sm *SessionManager) laggingFrame(sessionKey string, cl *client, queued int, lag time.Duration) (queuedFrame, bool) {
+	payload, err := json.Marshal(laggingNotice{Queued: queued, LaggingMs: lag.Milliseconds()})
+	if err != nil {
+		return queuedFrame{}, false
+	}
+	frame, err := json.Marshal(Envelope{
+		Type:       "system.lagging",
+		SessionKey: sessionKey,
+		Timestamp:  time.Now().UnixNano() / int64(time.Millisecond),
+		Payload:    payload,
+	})
+	if err != nil {
+		return queuedFrame{}, false
+	}
+	messageType, frame := cl.encodeFrame(websocket.TextMessage, frame)
+	return queuedFrame{messageType: messageType, data: frame}, true
+}
@@ -0,0 +1,230 @@
+package ws_manager
+
+import (
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// SessionSnapshot is the state of a session exported by ExportSession, for
+// moving it to another instance during a rolling deploy. It marshals to
+// JSON.
+type SessionSnapshot struct {
+	Key       string                 `json:"key"`
+	CreatedAt time.Time              `json:"createdAt"`
+	LastUsed  time.Time              `json:"lastUsed"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Tags      []string               `json:"tags,omitempty"`
+	// Seq is the sequence number of the last broadcast, see
+	// WithSequenceNumbers.
+	Seq uint64 `json:"seq,omitempty"`
+	// History holds the replayable broadcasts. As in a SessionStore,
+	// broadcasts limited to some of the connections are not kept.
+	History []StoredMessage `json:"history,omitempty"`
+	// BannedIdentities lists the identities banned by BanIdentity.
+	BannedIdentities []string `json:"bannedIdentities,omitempty"`
+	IncludeSender    bool     `json:"includeSender,omitempty"`
+	// Clients lists the connections expected to reconnect: the open ones
+	// and those waiting to resume.
+	Clients []ClientSnapshot `json:"clients,omitempty"`
+}
+
+// ClientSnapshot is a connection of a SessionSnapshot.
+type ClientSnapshot struct {
+	ID       string   `json:"id"`
+	Identity string   `json:"identity,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Role     string   `json:"role,omitempty"`
+	Topic    string   `json:"topic,omitempty"`
+	Stream   string   `json:"stream,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Channels []string `json:"channels,omitempty"`
+	// Blocked lists the identities the connection blocked.
+	Blocked  []string               `json:"blocked,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// ResumeToken is the token issued under WithResume, empty without it.
+	ResumeToken string `json:"resumeToken,omitempty"`
+}
+
+// ExportSession returns a snapshot of the session for ImportSession on
+// another instance. The session and its connections are left as they are;
+// the caller usually removes it, e.g. with Shutdown, once the snapshot is
+// imported.
+func (sm *SessionManager) ExportSession(sessionKey string) (SessionSnapshot, error) {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return SessionSnapshot{}, sessionNotFound(sessionKey)
+	}
+	sm.expireHistoryLocked(s, time.Now())
+	snapshot := SessionSnapshot{
+		Key:           s.key,
+		CreatedAt:     s.createdAt,
+		LastUsed:      s.lastUsed,
+		Metadata:      copyMetadata(s.metadata),
+		Tags:          sortedSet(s.tags),
+		Seq:           s.seq,
+		IncludeSender: s.includeSender,
+	}
+	for _, entry := range s.history {
+		if entry.match != nil {
+			continue
+		}
+		snapshot.History = append(snapshot.History, StoredMessage{
+			MessageType: entry.messageType,
+			Message:     append([]byte{}, entry.message...),
+			At:          entry.at,
+			Seq:         entry.seq,
+			TTL:         entry.ttl,
+		})
+	}
+	snapshot.BannedIdentities = sortedSet(s.banned)
+	for _, cl := range s.clients {
+		snapshot.Clients = append(snapshot.Clients, cl.snapshot())
+	}
+	for _, slot := range s.parked {
+		snapshot.Clients = append(snapshot.Clients, slot.client.snapshot())
+	}
+	return snapshot, nil
+}
+
+// ImportSession registers the session of snapshot with its metadata, tags,
+// history, sequence counter and bans. With WithResume, every client of the
+// snapshot holding a resume token is parked for the resume ttl, so a
+// connection presenting the token reclaims its client ID, channels and
+// blocks and is replayed the broadcasts it missed; a client that still has
+// the history can also catch up with the "since" control message. History
+// beyond WithHistorySize is dropped, oldest first. Client IDs are kept, and
+// numeric ones are not issued again here; with a backend they carry the
+// exporting instance's prefix.
+func (sm *SessionManager) ImportSession(snapshot SessionSnapshot) error {
+	if err := sm.validateKey(snapshot.Key); err != nil {
+		return err
+	}
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	if sm.shutDown {
+		return ErrShutDown
+	}
+	if _, ok := sm.sessions[snapshot.Key]; ok {
+		return &SessionError{SessionKey: snapshot.Key, Err: ErrSessionExists}
+	}
+	if !sm.claimSessionRoomLocked(snapshot.Key) {
+		return ErrSessionLimitReached
+	}
+	s := newSession(snapshot.Key)
+	if !snapshot.CreatedAt.IsZero() {
+		s.createdAt = snapshot.CreatedAt
+	}
+	if !snapshot.LastUsed.IsZero() {
+		s.lastUsed = snapshot.LastUsed
+	}
+	if snapshot.Metadata != nil {
+		s.metadata = copyMetadata(snapshot.Metadata)
+	}
+	s.setTags(snapshot.Tags)
+	s.seq = snapshot.Seq
+	s.includeSender = snapshot.IncludeSender
+	history := snapshot.History
+	if size := sm.historySizeLocked(s); len(history) > size {
+		history = history[len(history)-size:]
+	}
+	for _, msg := range history {
+		s.history = append(s.history, historyEntry{
+			messageType: msg.MessageType,
+			message:     append([]byte{}, msg.Message...),
+			at:          msg.At,
+			seq:         msg.Seq,
+			ttl:         msg.TTL,
+		})
+	}
+	for _, identity := range snapshot.BannedIdentities {
+		s.banned[identity] = struct{}{}
+	}
+	sm.sessions[s.key] = s
+	for _, cs := range snapshot.Clients {
+		sm.reserveClientID(cs.ID)
+		cl := cs.client()
+		if cl.resumeToken != "" {
+			sm.parkLocked(s, cl)
+		}
+	}
+	sm.markStoredLocked(s.key, false)
+	sm.webhookLocked(WebhookSessionCreated, s)
+	return nil
+}
+
+func (cl *client) snapshot() ClientSnapshot {
+	return ClientSnapshot{
+		ID:          cl.id,
+		Identity:    cl.identity,
+		Name:        cl.name,
+		Role:        cl.role,
+		Topic:       cl.topic,
+		Stream:      cl.stream,
+		Tags:        sortedSet(cl.tags),
+		Channels:    sortedSet(cl.channels),
+		Blocked:     sortedSet(cl.blocked),
+		Metadata:    copyMetadata(cl.metadata),
+		ResumeToken: cl.resumeToken,
+	}
+}
+
+// reserveClientID keeps newClientID from handing out the imported id again.
+func (sm *SessionManager) reserveClientID(id string) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return
+	}
+	for {
+		next := atomic.LoadUint64(&sm.nextClientID)
+		if next >= n || atomic.CompareAndSwapUint64(&sm.nextClientID, next, n) {
+			return
+		}
+	}
+}
+
+// client rebuilds the connectionless client of cs, to be parked until it
+// resumes.
+func (cs ClientSnapshot) client() *client {
+	cl := &client{
+		id:          cs.ID,
+		identity:    cs.Identity,
+		name:        cs.Name,
+		role:        cs.Role,
+		topic:       cs.Topic,
+		stream:      cs.Stream,
+		tags:        map[string]struct{}{},
+		blocked:     map[string]struct{}{},
+		channels:    map[string]struct{}{},
+		metadata:    copyMetadata(cs.Metadata),
+		resumeToken: cs.ResumeToken,
+		left:        make(chan struct{}),
+	}
+	for _, tag := range cs.Tags {
+		cl.tags[tag] = struct{}{}
+	}
+	for _, channel := range cs.Channels {
+		cl.channels[channel] = struct{}{}
+	}
+	for _, identity := range cs.Blocked {
+		cl.blocked[identity] = struct{}{}
+	}
+	return cl
+}
+
+// sortedSet returns the members of set in sorted order, or nil if it is
+// empty.
+func sortedSet(set map[string]struct{}) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
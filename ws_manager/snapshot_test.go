@@ -0,0 +1,108 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SnapshotTestSuite struct {
+	suite.Suite
+	sessionKey string
+	source     *SessionManager
+	target     *SessionManager
+	sourceSrv  *httptest.Server
+	targetSrv  *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *SnapshotTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.source, suite.sourceSrv = suite.start([]string{suite.sessionKey})
+	suite.target, suite.targetSrv = suite.start(nil)
+}
+
+func (suite *SnapshotTestSuite) TearDownTest() {
+	suite.sourceSrv.Close()
+	suite.targetSrv.Close()
+	suite.source.cronScheduler.Stop()
+	suite.target.cronScheduler.Stop()
+}
+
+func (suite *SnapshotTestSuite) start(keys []string) (*SessionManager, *httptest.Server) {
+	manager := CreateSessionManager(keys, WithResume(time.Minute, 0), WithHistorySize(2))
+	e := echo.New()
+	e.GET("/:sessionKey", manager.EchoHandler)
+	return manager, httptest.NewServer(e)
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *SnapshotTestSuite) TestSessionMovesBetweenInstances() {
+	conn, resp, err := dialSessionWithHeader(suite.sourceSrv, suite.sessionKey, "topic=news", nil)
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	clientID := resp.Header.Get(ClientIDHeader)
+	token := resp.Header.Get(ResumeTokenHeader)
+	assert.True(suite.T(), waitForConnections(suite.source, suite.sessionKey, 1))
+	assert.NoError(suite.T(), suite.source.SetSessionMetadata(suite.sessionKey, map[string]interface{}{"title": "standup"}))
+	suite.source.BanIdentity(suite.sessionKey, "mallory")
+	for _, message := range []string{"one", "two", "three"} {
+		suite.source.Broadcast(suite.sessionKey, SystemSender, websocket.TextMessage, []byte(message))
+	}
+
+	snapshot, err := suite.source.ExportSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	data, err := json.Marshal(snapshot)
+	assert.NoError(suite.T(), err)
+	var decoded SessionSnapshot
+	assert.NoError(suite.T(), json.Unmarshal(data, &decoded))
+	assert.Equal(suite.T(), []string{"mallory"}, decoded.BannedIdentities)
+	if assert.Len(suite.T(), decoded.Clients, 1) {
+		assert.Equal(suite.T(), clientID, decoded.Clients[0].ID)
+		assert.Equal(suite.T(), "news", decoded.Clients[0].Topic)
+		assert.Equal(suite.T(), token, decoded.Clients[0].ResumeToken)
+	}
+	if assert.Len(suite.T(), decoded.History, 2) {
+		assert.Equal(suite.T(), "two", string(decoded.History[0].Message))
+	}
+
+	assert.NoError(suite.T(), suite.target.ImportSession(decoded))
+	assert.EqualError(suite.T(), suite.target.ImportSession(decoded), "Session abcdefgh already exists")
+	md, err := suite.target.GetSessionMetadata(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), map[string]interface{}{"title": "standup"}, md)
+	suite.target.Broadcast(suite.sessionKey, SystemSender, websocket.TextMessage, []byte("four"))
+
+	conn.Close()
+	moved, resp, err := dialSessionWithHeader(suite.targetSrv, suite.sessionKey, "topic=news&resume="+token, nil)
+	assert.NoError(suite.T(), err)
+	defer moved.Close()
+	assert.Equal(suite.T(), clientID, resp.Header.Get(ClientIDHeader))
+	message, err := readWithTimeout(moved, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "four", message)
+
+	fresh, resp, err := dialSessionWithHeader(suite.targetSrv, suite.sessionKey, "", nil)
+	assert.NoError(suite.T(), err)
+	defer fresh.Close()
+	assert.NotEqual(suite.T(), clientID, resp.Header.Get(ClientIDHeader))
+}
+
+func (suite *SnapshotTestSuite) TestExportUnknownSession() {
+	_, err := suite.source.ExportSession("missing")
+	assert.EqualError(suite.T(), err, "Session missing not found")
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestSnapshotTestSuite(t *testing.T) {
+	suite.Run(t, new(SnapshotTestSuite))
+}
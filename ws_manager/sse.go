@@ -0,0 +1,317 @@
+package ws_manager
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// SSETokenHeader is the request header of ServeSSEPublish carrying the
+// token a stream was opened with.
+const SSETokenHeader = "X-SSE-Token"
+
+// sseStream is an open ServeSSE stream, reachable by its publish token.
+type sseStream struct {
+	sessionKey string
+	conn       *websocket.Conn
+	writeMu    sync.Mutex
+}
+
+type sseOpen struct {
+	ClientID string `json:"clientId"`
+	Token    string `json:"token"`
+}
+
+type sseClose struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// EchoSSEHandler is ServeSSE for the session named by the "sessionKey" path
+// parameter.
+func (sm *SessionManager) EchoSSEHandler(c echo.Context) error {
+	return sm.ServeSSE(c.Response(), c.Request(), c.Param("sessionKey"))
+}
+
+// EchoSSEPublishHandler is ServeSSEPublish for the session named by the
+// "sessionKey" path parameter.
+func (sm *SessionManager) EchoSSEPublishHandler(c echo.Context) error {
+	return sm.ServeSSEPublish(c.Response(), c.Request(), c.Param("sessionKey"))
+}
+
+// ServeSSE streams sessionKey to r as server-sent events, for clients
+// behind proxies that block WebSocket upgrades. The stream joins the
+// session as a connection of its own: r goes through the same origin
+// check, authentication, roles, bans and limits as an upgrade, with its
+// query parameters, headers and cookies, and refusals get the same status
+// codes. The first event carries the client ID and the token to publish
+// with:
+//
+//	event: open
+//	data: {"clientId":"3","token":"9f86d081884c7d65"}
+//
+// Text frames follow as unnamed events, split into one data line per line,
+// and binary frames as "binary" events holding base64. Keepalive pings
+// become comment lines. When the session ends the connection, a "close"
+// event carries the close code and reason before the response ends:
+//
+//	event: close
+//	data: {"code":1008,"reason":"kicked"}
+//
+// A client that goes away leaves the session as if its socket closed.
+func (sm *SessionManager) ServeSSE(w http.ResponseWriter, r *http.Request, sessionKey string) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return plainText(w, http.StatusInternalServerError, "Streaming unsupported")
+	}
+	conn, resp, err := sm.dialInternal(r, sessionKey)
+	if err != nil {
+		if resp == nil {
+			return plainText(w, http.StatusInternalServerError, err.Error())
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return plainText(w, resp.StatusCode, string(body))
+	}
+	defer conn.Close()
+	token := newResumeToken()
+	stream := &sseStream{sessionKey: sessionKey, conn: conn}
+	sm.sseMu.Lock()
+	if sm.sseStreams == nil {
+		sm.sseStreams = map[string]*sseStream{}
+	}
+	sm.sseStreams[token] = stream
+	sm.sseMu.Unlock()
+	unregister := func() {
+		sm.sseMu.Lock()
+		delete(sm.sseStreams, token)
+		sm.sseMu.Unlock()
+	}
+	defer unregister()
+
+	clientID := resp.Header.Get(ClientIDHeader)
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set(ClientIDHeader, clientID)
+	for _, cookie := range resp.Header.Values("Set-Cookie") {
+		header.Add("Set-Cookie", cookie)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	// events are written from the read loop and the ping handler, which
+	// runs inside it, so they never interleave
+	open, _ := json.Marshal(sseOpen{ClientID: clientID, Token: token})
+	writeEvent(w, "open", open)
+	flusher.Flush()
+	conn.SetPingHandler(func(data string) error {
+		io.WriteString(w, ":\n\n")
+		flusher.Flush()
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-r.Context().Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	for {
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			// publishing stops before the client hears of the close
+			unregister()
+			var closeErr *websocket.CloseError
+			if r.Context().Err() == nil && errors.As(err, &closeErr) {
+				data, _ := json.Marshal(sseClose{Code: closeErr.Code, Reason: closeErr.Text})
+				writeEvent(w, "close", data)
+				flusher.Flush()
+			}
+			return nil
+		}
+		if messageType == websocket.BinaryMessage {
+			writeEvent(w, "binary", []byte(base64.StdEncoding.EncodeToString(message)))
+		} else {
+			writeEvent(w, "", message)
+		}
+		flusher.Flush()
+	}
+}
+
+// ServeSSEPublish sends the body of r, a POST, into sessionKey as a message
+// of the ServeSSE stream whose token is in SSETokenHeader or the "token"
+// query parameter. The message goes through the same read-side policies as
+// one sent over a WebSocket, e.g. rate limits, roles, middlewares and
+// control messages. A body with Content-Type application/octet-stream is
+// sent as a binary frame, anything else as text. It answers 202 Accepted,
+// or 403 Forbidden for a token that has no open stream in the session.
+func (sm *SessionManager) ServeSSEPublish(w http.ResponseWriter, r *http.Request, sessionKey string) error {
+	if r.Method != http.MethodPost {
+		return plainText(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+	token := r.Header.Get(SSETokenHeader)
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	sm.sseMu.Lock()
+	stream, ok := sm.sseStreams[token]
+	sm.sseMu.Unlock()
+	if !ok || stream.sessionKey != sessionKey {
+		return plainText(w, http.StatusForbidden, "Forbidden")
+	}
+	var body io.Reader = r.Body
+	if sm.maxMessageSize > 0 {
+		body = io.LimitReader(r.Body, sm.maxMessageSize+1)
+	}
+	message, err := io.ReadAll(body)
+	if err != nil {
+		return plainText(w, http.StatusBadRequest, err.Error())
+	}
+	if sm.maxMessageSize > 0 && int64(len(message)) > sm.maxMessageSize {
+		return plainText(w, http.StatusRequestEntityTooLarge, "Message too big")
+	}
+	messageType := websocket.TextMessage
+	if r.Header.Get("Content-Type") == "application/octet-stream" {
+		messageType = websocket.BinaryMessage
+	}
+	stream.writeMu.Lock()
+	err = stream.conn.WriteMessage(messageType, message)
+	stream.writeMu.Unlock()
+	if err != nil {
+		return plainText(w, http.StatusGone, "Stream closed")
+	}
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+// writeEvent writes one server-sent event named event, or an unnamed one.
+func writeEvent(w io.Writer, event string, data []byte) {
+	var b bytes.Buffer
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", strings.TrimSuffix(line, "\r"))
+	}
+	b.WriteString("\n")
+	w.Write(b.Bytes())
+}
+
+// dialInternal connects to sessionKey over an in-memory pipe, upgrading a
+// copy of r with the handler used for WebSocket clients. A refused
+// handshake returns the response it got.
+func (sm *SessionManager) dialInternal(r *http.Request, sessionKey string) (*websocket.Conn, *http.Response, error) {
+	header := http.Header{}
+	for name, values := range r.Header {
+		if name == "Connection" || name == "Upgrade" || strings.HasPrefix(name, "Sec-Websocket-") {
+			continue
+		}
+		header[name] = values
+	}
+	u := *r.URL
+	u.Scheme = "ws"
+	u.Host = r.Host
+	dialer := websocket.Dialer{
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go sm.serveInternal(pipeConn{Conn: server, remote: pipeAddr(r.RemoteAddr)}, r, sessionKey)
+			return client, nil
+		},
+	}
+	return dialer.DialContext(r.Context(), u.String(), header)
+}
+
+// serveInternal reads the upgrade request written by dialInternal from conn
+// and serves it as if it had arrived on r's connection.
+func (sm *SessionManager) serveInternal(conn net.Conn, r *http.Request, sessionKey string) {
+	br := bufio.NewReader(conn)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	req.RemoteAddr = r.RemoteAddr
+	req.TLS = r.TLS
+	w := &pipeResponse{conn: conn, rw: bufio.NewReadWriter(br, bufio.NewWriter(conn)), header: http.Header{}}
+	sm.serve(w, req.WithContext(r.Context()), sessionKey)
+	w.finish()
+}
+
+// pipeResponse is the hijackable ResponseWriter of serveInternal. A
+// response that is not hijacked is buffered and written out by finish.
+type pipeResponse struct {
+	conn     net.Conn
+	rw       *bufio.ReadWriter
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	hijacked bool
+}
+
+func (w *pipeResponse) Header() http.Header {
+	return w.header
+}
+
+func (w *pipeResponse) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *pipeResponse) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
+
+func (w *pipeResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return w.conn, w.rw, nil
+}
+
+func (w *pipeResponse) finish() {
+	if w.hijacked {
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resp := http.Response{
+		StatusCode:    w.status,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.header,
+		Body:          io.NopCloser(&w.body),
+		ContentLength: int64(w.body.Len()),
+	}
+	resp.Write(w.conn)
+	w.conn.Close()
+}
+
+// pipeConn reports the address of the request it carries as its remote
+// address.
+type pipeConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c pipeConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "tcp" }
+func (a pipeAddr) String() string  { return string(a) }
@@ -0,0 +1,195 @@
+package ws_manager
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SSETestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *SSETestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.start()
+}
+
+func (suite *SSETestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+func (suite *SSETestSuite) start(opts ...Option) {
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, opts...)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	e.GET("/sse/:sessionKey", suite.manager.EchoSSEHandler)
+	e.POST("/sse/:sessionKey", suite.manager.EchoSSEPublishHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+type sseEvent struct {
+	event string
+	data  string
+}
+
+// readEvent reads the next event of an SSE stream, skipping comments.
+func readEvent(r *bufio.Reader) (sseEvent, error) {
+	ev := sseEvent{}
+	lines := []string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return ev, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && len(lines) > 0:
+			ev.data = strings.Join(lines, "\n")
+			return ev, nil
+		case strings.HasPrefix(line, "event: "):
+			ev.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			lines = append(lines, strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
+
+// openStream opens an SSE stream and returns its reader, response and
+// open event.
+func (suite *SSETestSuite) openStream(query string, header http.Header) (*bufio.Reader, *http.Response, sseOpen, error) {
+	req, err := http.NewRequest(http.MethodGet, suite.server.URL+"/sse/"+suite.sessionKey+"?"+query, nil)
+	if err != nil {
+		return nil, nil, sseOpen{}, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, sseOpen{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, resp, sseOpen{}, errors.New(resp.Status)
+	}
+	r := bufio.NewReader(resp.Body)
+	ev, err := readEvent(r)
+	if err != nil {
+		return nil, resp, sseOpen{}, err
+	}
+	var open sseOpen
+	err = json.Unmarshal([]byte(ev.data), &open)
+	return r, resp, open, err
+}
+
+func (suite *SSETestSuite) publish(token, body string) int {
+	req, _ := http.NewRequest(http.MethodPost, suite.server.URL+"/sse/"+suite.sessionKey, strings.NewReader(body))
+	req.Header.Set(SSETokenHeader, token)
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(suite.T(), err) {
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *SSETestSuite) TestStreamReceivesAndPublishes() {
+	ws, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer ws.Close()
+	stream, resp, open, err := suite.openStream("", nil)
+	if !assert.NoError(suite.T(), err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(suite.T(), "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(suite.T(), open.ClientID, resp.Header.Get(ClientIDHeader))
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	assert.NoError(suite.T(), ws.WriteMessage(websocket.TextMessage, []byte("line one\nline two")))
+	ev, err := readEvent(stream)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), sseEvent{data: "line one\nline two"}, ev)
+	assert.NoError(suite.T(), ws.WriteMessage(websocket.BinaryMessage, []byte{0xff, 0x00}))
+	ev, err = readEvent(stream)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), sseEvent{event: "binary", data: "/wA="}, ev)
+
+	assert.Equal(suite.T(), http.StatusAccepted, suite.publish(open.Token, "from the stream"))
+	message, err := readWithTimeout(ws, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "from the stream", message)
+	assert.Equal(suite.T(), http.StatusForbidden, suite.publish("bogus", "forged"))
+
+	clients, err := suite.manager.GetClients(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	if assert.Len(suite.T(), clients, 2) {
+		assert.Equal(suite.T(), open.ClientID, clients[1].ID)
+		assert.True(suite.T(), strings.HasPrefix(clients[1].RemoteAddr, "127.0.0.1:"))
+	}
+}
+
+func (suite *SSETestSuite) TestStreamSharesAuthAndEndsWithClose() {
+	suite.TearDownTest()
+	suite.start(WithAuth(headerAuth))
+
+	_, resp, _, err := suite.openStream("", nil)
+	assert.Error(suite.T(), err)
+	if assert.NotNil(suite.T(), resp) {
+		assert.Equal(suite.T(), http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	header := http.Header{}
+	header.Set("X-Identity", "alice")
+	stream, resp, open, err := suite.openStream("", header)
+	if !assert.NoError(suite.T(), err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	clients, err := suite.manager.GetClients(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "alice", clients[0].Identity)
+
+	assert.NoError(suite.T(), suite.manager.KickClient(suite.sessionKey, open.ClientID, "kicked"))
+	ev, err := readEvent(stream)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), sseEvent{event: "close", data: `{"code":1008,"reason":"kicked"}`}, ev)
+	assert.Equal(suite.T(), http.StatusForbidden, suite.publish(open.Token, "too late"))
+}
+
+func (suite *SSETestSuite) TestClosingTheStreamLeavesTheSession() {
+	stream, resp, _, err := suite.openStream("", nil)
+	if !assert.NoError(suite.T(), err) {
+		return
+	}
+	assert.NotNil(suite.T(), stream)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	resp.Body.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestSSETestSuite(t *testing.T) {
+	suite.Run(t, new(SSETestSuite))
+}
@@ -0,0 +1,225 @@
+package ws_manager
+
+import (
+	"sort"
+	"time"
+)
+
+// SessionStats is a snapshot of a single session's activity.
+type SessionStats struct {
+	SessionKey        string
+	Connections       int
+	Broadcasts        uint64
+	BytesRelayed      uint64
+	MessagesPerSecond float64
+	CreatedAt         time.Time
+	LastUsed          time.Time
+	// RejectedConnections counts dials refused because the session was full.
+	RejectedConnections uint64
+	// PeakConnections is the most connections the session held at once.
+	PeakConnections int
+	// MessagesReceived and BytesReceived count the data messages the
+	// session's connections sent and their payload bytes.
+	MessagesReceived uint64
+	BytesReceived    uint64
+	// Tags are the tags set by SetSessionTags, sorted.
+	Tags []string
+	// Owner is the client ID of the owner, see WithSessionOwners, and
+	// Locked is set by LockSession.
+	Owner  string
+	Locked bool
+}
+
+func (sm *SessionManager) GetSessionStats(sessionKey string) (SessionStats, error) {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return SessionStats{}, sessionNotFound(sessionKey)
+	}
+	return sm.sessionStatsLocked(s, time.Now()), nil
+}
+
+// ListSessions returns the registered session keys in sorted order.
+func (sm *SessionManager) ListSessions() []string {
+	sm.sessionManagerMu.RLock()
+	defer sm.sessionManagerMu.RUnlock()
+	keys := make([]string, 0, len(sm.sessions))
+	for key := range sm.sessions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ListSessionsDetailed returns the stats of every session, sorted by key.
+func (sm *SessionManager) ListSessionsDetailed() []SessionStats {
+	sm.rlockSessions()
+	defer sm.runlockSessions()
+	now := time.Now()
+	stats := make([]SessionStats, 0, len(sm.sessions))
+	for _, s := range sm.sessions {
+		stats = append(stats, sm.sessionStatsLocked(s, now))
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].SessionKey < stats[j].SessionKey
+	})
+	return stats
+}
+
+func (sm *SessionManager) sessionStatsLocked(s *session, now time.Time) SessionStats {
+	return SessionStats{
+		SessionKey:          s.key,
+		Connections:         len(s.clients),
+		Broadcasts:          s.broadcasts,
+		BytesRelayed:        s.bytes,
+		MessagesPerSecond:   s.messageRate.value(now, sm.rateWindow),
+		RejectedConnections: s.rejected,
+		CreatedAt:           s.createdAt,
+		LastUsed:            s.lastUsed,
+		PeakConnections:     s.peak,
+		MessagesReceived:    s.received,
+		BytesReceived:       s.receivedBytes,
+		Tags:                sortedSet(s.tags),
+		Owner:               s.owner,
+		Locked:              s.locked,
+	}
+}
+
+// SessionStats is GetSessionStats.
+func (sm *SessionManager) SessionStats(sessionKey string) (SessionStats, error) {
+	return sm.GetSessionStats(sessionKey)
+}
+
+// ManagerStats is a snapshot of a manager's activity since it was created,
+// for dashboards that do without Prometheus.
+type ManagerStats struct {
+	Sessions    int
+	Connections int
+	// PeakConnections is the most connections open at once.
+	PeakConnections  int
+	Broadcasts       uint64
+	MessagesReceived uint64
+	BytesRelayed     uint64
+	BytesReceived    uint64
+	StartedAt        time.Time
+	// LastActivity is when a message was last received or broadcast, the
+	// zero time if never.
+	LastActivity time.Time
+}
+
+// Stats returns the manager-wide counters. They are kept up to date as
+// broadcasts and inbound messages are counted, so reading them costs no
+// more than counting the open connections.
+func (sm *SessionManager) Stats() ManagerStats {
+	sm.rlockSessions()
+	defer sm.runlockSessions()
+	sm.statsMu.Lock()
+	defer sm.statsMu.Unlock()
+	stats := ManagerStats{
+		Sessions:         len(sm.sessions),
+		PeakConnections:  sm.peakConnections,
+		Broadcasts:       sm.metrics.Broadcasts,
+		MessagesReceived: sm.metrics.MessagesReceived,
+		BytesRelayed:     sm.metrics.BytesRelayed,
+		BytesReceived:    sm.metrics.BytesReceived,
+		StartedAt:        sm.startedAt,
+		LastActivity:     sm.lastActivity,
+	}
+	for _, s := range sm.sessions {
+		stats.Connections += len(s.clients)
+	}
+	return stats
+}
+
+// ConnectionStats is a snapshot of a single connection's delivery state.
+type ConnectionStats struct {
+	Delivered  uint64
+	Acked      uint64
+	MissedAcks int
+}
+
+func (sm *SessionManager) GetConnectionStats(sessionKey, clientID string) (ConnectionStats, error) {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	cl, err := sm.findClient(sessionKey, clientID)
+	if err != nil {
+		return ConnectionStats{}, err
+	}
+	return ConnectionStats{
+		Delivered:  cl.delivered,
+		Acked:      cl.acked,
+		MissedAcks: cl.missedAcks,
+	}, nil
+}
+
+// SessionRate is a session's share of the traffic in a GlobalStatsReport.
+type SessionRate struct {
+	SessionKey        string
+	Connections       int
+	MessagesPerSecond float64
+}
+
+// GlobalStatsReport summarizes activity across every session of a manager.
+// Rates are moving averages over the window set by WithRateWindow.
+type GlobalStatsReport struct {
+	Sessions           int
+	Connections        int
+	MessagesPerSecond  float64
+	BytesPerSecond     float64
+	EvictionsPerSecond float64
+	Busiest            []SessionRate
+}
+
+// GlobalStats returns a manager-wide summary including the topN sessions
+// with the highest message rate, busiest first. A non-positive topN leaves
+// Busiest empty.
+func (sm *SessionManager) GlobalStats(topN int) GlobalStatsReport {
+	sm.rlockSessions()
+	defer sm.runlockSessions()
+	now := time.Now()
+	sm.statsMu.Lock()
+	report := GlobalStatsReport{
+		Sessions:           len(sm.sessions),
+		MessagesPerSecond:  sm.messageRate.value(now, sm.rateWindow),
+		BytesPerSecond:     sm.byteRate.value(now, sm.rateWindow),
+		EvictionsPerSecond: sm.evictionRate.value(now, sm.rateWindow),
+		Busiest:            []SessionRate{},
+	}
+	sm.statsMu.Unlock()
+	rates := make([]SessionRate, 0, len(sm.sessions))
+	for key, s := range sm.sessions {
+		report.Connections += len(s.clients)
+		rates = append(rates, SessionRate{
+			SessionKey:        key,
+			Connections:       len(s.clients),
+			MessagesPerSecond: s.messageRate.value(now, sm.rateWindow),
+		})
+	}
+	if topN <= 0 {
+		return report
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].MessagesPerSecond != rates[j].MessagesPerSecond {
+			return rates[i].MessagesPerSecond > rates[j].MessagesPerSecond
+		}
+		return rates[i].SessionKey < rates[j].SessionKey
+	})
+	if topN < len(rates) {
+		rates = rates[:topN]
+	}
+	report.Busiest = rates
+	return report
+}
+
+// recordBroadcastLocked counts a broadcast in session s and in the
+// manager-wide totals. The caller must hold sessionManagerMu.
+func (sm *SessionManager) recordBroadcastLocked(s *session, now time.Time) {
+	s.broadcasts++
+	s.messageRate.observe(now, sm.rateWindow)
+	sm.statsMu.Lock()
+	defer sm.statsMu.Unlock()
+	sm.metrics.Broadcasts++
+	sm.lastActivity = now
+	sm.messageRate.observe(now, sm.rateWindow)
+}
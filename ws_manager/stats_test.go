@@ -0,0 +1,167 @@
+package ws_manager
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type StatsTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *StatsTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey})
+}
+
+func (suite *StatsTestSuite) TearDownTest() {
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *StatsTestSuite) TestRateConvergesToSteadyRate() {
+	window := 2 * time.Second
+	estimator := rateEstimator{}
+	now := time.Now()
+	for i := 0; i < 200; i++ {
+		now = now.Add(100 * time.Millisecond)
+		estimator.observe(now, window)
+	}
+	assert.InDelta(suite.T(), 10.0, estimator.value(now, window), 0.5)
+
+	// the rate decays once traffic stops
+	later := now.Add(10 * window)
+	assert.Less(suite.T(), estimator.value(later, window), 0.1)
+}
+
+func (suite *StatsTestSuite) TestSessionStatsReportsBroadcasts() {
+	for i := 0; i < 3; i++ {
+		assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("hi")))
+	}
+	stats, err := suite.manager.GetSessionStats(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), uint64(3), stats.Broadcasts)
+	assert.Greater(suite.T(), stats.MessagesPerSecond, 0.0)
+}
+
+func (suite *StatsTestSuite) TestSessionStatsReportsTimes() {
+	before, err := suite.manager.GetSessionStats(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), before.CreatedAt.IsZero())
+	assert.Equal(suite.T(), before.CreatedAt, before.LastUsed)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("hello")))
+	after, err := suite.manager.GetSessionStats(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), before.CreatedAt, after.CreatedAt)
+	assert.True(suite.T(), after.LastUsed.After(before.LastUsed))
+	assert.Equal(suite.T(), uint64(0), after.BytesRelayed)
+}
+
+func (suite *StatsTestSuite) TestStatsCountTraffic() {
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+	sender, err := dialSession(server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+	sender.WriteMessage(websocket.TextMessage, []byte("hello"))
+	_, err = readWithTimeout(receiver, time.Second)
+	assert.NoError(suite.T(), err)
+	receiver.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	stats, err := suite.manager.SessionStats(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, stats.Connections)
+	assert.Equal(suite.T(), 2, stats.PeakConnections)
+	assert.Equal(suite.T(), uint64(1), stats.MessagesReceived)
+	assert.Equal(suite.T(), uint64(len("hello")), stats.BytesReceived)
+	assert.Equal(suite.T(), uint64(len("hello")), stats.BytesRelayed)
+
+	global := suite.manager.Stats()
+	assert.Equal(suite.T(), 1, global.Sessions)
+	assert.Equal(suite.T(), 1, global.Connections)
+	assert.Equal(suite.T(), 2, global.PeakConnections)
+	assert.Equal(suite.T(), uint64(1), global.Broadcasts)
+	assert.Equal(suite.T(), uint64(1), global.MessagesReceived)
+	assert.False(suite.T(), global.StartedAt.IsZero())
+	assert.False(suite.T(), global.LastActivity.Before(global.StartedAt))
+}
+
+func (suite *StatsTestSuite) TestRateWindowOption() {
+	sm := CreateSessionManager([]string{}, WithRateWindow(time.Minute))
+	defer sm.cronScheduler.Stop()
+	assert.Equal(suite.T(), time.Minute, sm.rateWindow)
+}
+
+func (suite *StatsTestSuite) TestSessionStatsNotFound() {
+	_, err := suite.manager.GetSessionStats("missing")
+	assert.EqualError(suite.T(), err, "Session missing not found")
+}
+
+func (suite *StatsTestSuite) TestGlobalStatsRanksBusiestSessions() {
+	assert.NoError(suite.T(), suite.manager.RegisterSession("quiet"))
+	assert.NoError(suite.T(), suite.manager.RegisterSession("busy"))
+	for i := 0; i < 5; i++ {
+		assert.NoError(suite.T(), suite.manager.BroadcastMessage("busy", "", websocket.TextMessage, []byte("hi")))
+	}
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("hi")))
+
+	report := suite.manager.GlobalStats(2)
+	assert.Equal(suite.T(), 3, report.Sessions)
+	assert.Equal(suite.T(), 0, report.Connections)
+	assert.Greater(suite.T(), report.MessagesPerSecond, 0.0)
+	if assert.Len(suite.T(), report.Busiest, 2) {
+		assert.Equal(suite.T(), "busy", report.Busiest[0].SessionKey)
+		assert.Equal(suite.T(), suite.sessionKey, report.Busiest[1].SessionKey)
+	}
+
+	assert.Empty(suite.T(), suite.manager.GlobalStats(0).Busiest)
+}
+
+func (suite *StatsTestSuite) TestGlobalStatsTracksEvictions() {
+	suite.manager.GarbageCollectDaily()
+	suite.manager.GarbageCollectDaily()
+	report := suite.manager.GlobalStats(1)
+	assert.Equal(suite.T(), 0, report.Sessions)
+	assert.Greater(suite.T(), report.EvictionsPerSecond, 0.0)
+}
+
+func (suite *StatsTestSuite) TestListSessions() {
+	assert.NoError(suite.T(), suite.manager.RegisterSession("aaaa"))
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage("aaaa", "", websocket.TextMessage, []byte("hi")))
+
+	keys := suite.manager.ListSessions()
+	assert.Equal(suite.T(), []string{"aaaa", suite.sessionKey}, keys)
+	keys[0] = "mutated"
+	assert.Equal(suite.T(), []string{"aaaa", suite.sessionKey}, suite.manager.ListSessions())
+
+	detailed := suite.manager.ListSessionsDetailed()
+	if assert.Len(suite.T(), detailed, 2) {
+		assert.Equal(suite.T(), "aaaa", detailed[0].SessionKey)
+		assert.Equal(suite.T(), uint64(1), detailed[0].Broadcasts)
+		assert.Equal(suite.T(), suite.sessionKey, detailed[1].SessionKey)
+	}
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestStatsTestSuite(t *testing.T) {
+	suite.Run(t, new(StatsTestSuite))
+}
@@ -0,0 +1,177 @@
+package ws_manager
+
+import (
+	"time"
+)
+
+// StoredSession is the state of a session kept in a SessionStore.
+type StoredSession struct {
+	Key       string                 `json:"key"`
+	CreatedAt time.Time              `json:"createdAt"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Tags      []string               `json:"tags,omitempty"`
+	// History holds the session's replayable broadcasts when the store
+	// keeps history. Broadcasts limited to some of the connections, e.g.
+	// topic broadcasts, are not kept.
+	History []StoredMessage `json:"history,omitempty"`
+}
+
+// StoredMessage is a broadcast kept in the history of a StoredSession.
+type StoredMessage struct {
+	MessageType int       `json:"messageType"`
+	Message     []byte    `json:"message"`
+	At          time.Time `json:"at"`
+	Seq         uint64    `json:"seq,omitempty"`
+	// TTL is how long after At the message is replayed, see WithHistoryTTL.
+	TTL time.Duration `json:"ttl,omitempty"`
+}
+
+// SessionStore persists sessions so they survive a restart. The manager
+// saves a session whenever it is registered or its metadata, tags or history
+// changes, deletes it once it is removed, closed or collected, and loads
+// every stored session when it is created. Saves happen on a background
+// goroutine, outside the manager lock.
+type SessionStore interface {
+	SaveSession(session StoredSession) error
+	DeleteSession(sessionKey string) error
+	LoadSessions() ([]StoredSession, error)
+}
+
+// WithSessionStore persists the sessions registered at runtime in store and
+// restores the stored ones on creation. With history set, the replay
+// history of WithHistorySize is persisted too. Sessions removed by Shutdown
+// stay stored.
+func WithSessionStore(store SessionStore, history bool) Option {
+	return func(sm *SessionManager) {
+		sm.store = store
+		sm.storeHistory = history
+	}
+}
+
+// markStoredLocked schedules sessionKey to be saved, or deleted if it is no
+// longer registered and deleted is set. The caller must hold
+// sessionManagerMu.
+func (sm *SessionManager) markStoredLocked(sessionKey string, deleted bool) {
+	if sm.store == nil {
+		return
+	}
+	sm.storeMarkMu.Lock()
+	defer sm.storeMarkMu.Unlock()
+	if deleted {
+		sm.storeDeletes[sessionKey] = struct{}{}
+	} else {
+		delete(sm.storeDeletes, sessionKey)
+	}
+	sm.storeDirty[sessionKey] = struct{}{}
+	select {
+	case sm.storeSignal <- struct{}{}:
+	default:
+	}
+}
+
+// restoreSessions registers the sessions held by the store.
+func (sm *SessionManager) restoreSessions() {
+	stored, err := sm.store.LoadSessions()
+	if err != nil {
+		sm.logger.Error("Loading stored sessions failed", "err", err)
+		return
+	}
+	for _, st := range stored {
+		s, ok := sm.sessions[st.Key]
+		if !ok {
+			s = newSession(st.Key)
+			sm.sessions[st.Key] = s
+		}
+		if !st.CreatedAt.IsZero() {
+			s.createdAt = st.CreatedAt
+		}
+		s.metadata = copyMetadata(st.Metadata)
+		s.setTags(st.Tags)
+		if sm.storeHistory {
+			for _, msg := range st.History {
+				s.history = append(s.history, historyEntry{
+					messageType: msg.MessageType,
+					message:     msg.Message,
+					at:          msg.At,
+					seq:         msg.Seq,
+					ttl:         msg.TTL,
+				})
+				if msg.Seq > s.seq {
+					s.seq = msg.Seq
+				}
+			}
+		}
+	}
+	sm.logger.Info("Restored stored sessions", "sessions", len(stored))
+}
+
+// persistSessions saves the changed sessions until the manager shuts down.
+func (sm *SessionManager) persistSessions() {
+	for {
+		select {
+		case <-sm.storeSignal:
+			sm.flushStore()
+		case <-sm.done:
+			return
+		}
+	}
+}
+
+// flushStore writes the pending changes to the store.
+func (sm *SessionManager) flushStore() {
+	if sm.store == nil {
+		return
+	}
+	sm.storeMu.Lock()
+	defer sm.storeMu.Unlock()
+	sm.sessionManagerMu.Lock()
+	saves := []StoredSession{}
+	deletes := []string{}
+	for key := range sm.storeDirty {
+		if s, ok := sm.sessions[key]; ok {
+			saves = append(saves, sm.storedLocked(s))
+		} else if _, ok := sm.storeDeletes[key]; ok {
+			deletes = append(deletes, key)
+		}
+	}
+	sm.storeDirty = map[string]struct{}{}
+	sm.storeDeletes = map[string]struct{}{}
+	sm.sessionManagerMu.Unlock()
+
+	for _, st := range saves {
+		if err := sm.store.SaveSession(st); err != nil {
+			sm.logger.Error("Saving session failed", "session", st.Key, "err", err)
+		}
+	}
+	for _, key := range deletes {
+		if err := sm.store.DeleteSession(key); err != nil {
+			sm.logger.Error("Deleting stored session failed", "session", key, "err", err)
+		}
+	}
+}
+
+// storedLocked returns the stored form of s. The caller must hold
+// sessionManagerMu.
+func (sm *SessionManager) storedLocked(s *session) StoredSession {
+	st := StoredSession{
+		Key:       s.key,
+		CreatedAt: s.createdAt,
+		Metadata:  copyMetadata(s.metadata),
+		Tags:      sortedSet(s.tags),
+	}
+	if sm.storeHistory {
+		for _, entry := range s.history {
+			if entry.match != nil {
+				continue
+			}
+			st.History = append(st.History, StoredMessage{
+				MessageType: entry.messageType,
+				Message:     append([]byte{}, entry.message...),
+				At:          entry.at,
+				Seq:         entry.seq,
+				TTL:         entry.ttl,
+			})
+		}
+	}
+	return st
+}
@@ -0,0 +1,135 @@
+package ws_manager
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type StoreTestSuite struct {
+	suite.Suite
+	store *FileSessionStore
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *StoreTestSuite) SetupTest() {
+	store, err := NewFileSessionStore(suite.T().TempDir())
+	assert.NoError(suite.T(), err)
+	suite.store = store
+}
+
+// waitForStored polls store until it holds n sessions.
+func waitForStored(store SessionStore, n int) []StoredSession {
+	deadline := time.Now().Add(time.Second)
+	for {
+		sessions, err := store.LoadSessions()
+		if err == nil && len(sessions) == n || time.Now().After(deadline) {
+			return sessions
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *StoreTestSuite) TestSessionsSurviveRestart() {
+	first := CreateSessionManager([]string{}, WithHistorySize(5), WithSessionStore(suite.store, true))
+	assert.NoError(suite.T(), first.RegisterSession("roomone"))
+	assert.NoError(suite.T(), first.SetSessionMetadata("roomone", map[string]interface{}{"title": "standup"}))
+	assert.NoError(suite.T(), first.BroadcastMessage("roomone", "", websocket.TextMessage, []byte("earlier")))
+	assert.NoError(suite.T(), first.Shutdown(context.Background()))
+	stored := waitForStored(suite.store, 1)
+	if assert.Len(suite.T(), stored, 1) {
+		assert.Equal(suite.T(), "roomone", stored[0].Key)
+		assert.Len(suite.T(), stored[0].History, 1)
+	}
+
+	second := CreateSessionManager([]string{}, WithHistorySize(5), WithSessionStore(suite.store, true))
+	defer second.Shutdown(context.Background())
+	md, err := second.GetSessionMetadata("roomone")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "standup", md["title"])
+
+	e := echo.New()
+	e.GET("/:sessionKey", second.EchoHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+	conn, err := dialSession(server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	message, err := readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "earlier", message)
+
+	assert.NoError(suite.T(), second.RemoveSession("roomone"))
+	assert.Empty(suite.T(), waitForStored(suite.store, 0))
+}
+
+func (suite *StoreTestSuite) TestHistoryIsOptional() {
+	sm := CreateSessionManager([]string{}, WithHistorySize(5), WithSessionStore(suite.store, false))
+	key, err := sm.CreateSession()
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), sm.BroadcastMessage(key, "", websocket.TextMessage, []byte("not kept")))
+	assert.NoError(suite.T(), sm.Shutdown(context.Background()))
+
+	stored := waitForStored(suite.store, 1)
+	if assert.Len(suite.T(), stored, 1) {
+		assert.Equal(suite.T(), key, stored[0].Key)
+		assert.Empty(suite.T(), stored[0].History)
+	}
+}
+
+func (suite *StoreTestSuite) TestRedisSessionStore() {
+	redis, err := startFakeRedis()
+	assert.NoError(suite.T(), err)
+	defer redis.listener.Close()
+	store := NewRedisSessionStore(redis.listener.Addr().String(), "ws:sessions")
+	defer store.Close()
+
+	assert.NoError(suite.T(), store.SaveSession(StoredSession{Key: "roomone", Metadata: map[string]interface{}{"n": 1.0}}))
+	assert.NoError(suite.T(), store.SaveSession(StoredSession{Key: "roomtwo"}))
+	sessions, err := store.LoadSessions()
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), sessions, 2)
+
+	assert.NoError(suite.T(), store.DeleteSession("roomtwo"))
+	sessions, err = store.LoadSessions()
+	assert.NoError(suite.T(), err)
+	if assert.Len(suite.T(), sessions, 1) {
+		assert.Equal(suite.T(), "roomone", sessions[0].Key)
+		assert.Equal(suite.T(), 1.0, sessions[0].Metadata["n"])
+	}
+}
+
+func (suite *StoreTestSuite) TestRedisSessionStoreAuthAndTLS() {
+	serverTLS, clientTLS, err := testTLSConfigs()
+	assert.NoError(suite.T(), err)
+	redis, err := startFakeRedisWith("", "secret", serverTLS)
+	assert.NoError(suite.T(), err)
+	defer redis.listener.Close()
+	addr := redis.listener.Addr().String()
+
+	store := NewRedisSessionStore(addr, "ws:sessions", WithRedisAuth("", "secret"), WithRedisTLS(clientTLS))
+	defer store.Close()
+	assert.NoError(suite.T(), store.SaveSession(StoredSession{Key: "roomone"}))
+	sessions, err := store.LoadSessions()
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), sessions, 1)
+
+	unauthenticated := NewRedisSessionStore(addr, "ws:sessions", WithRedisTLS(clientTLS))
+	defer unauthenticated.Close()
+	_, err = unauthenticated.LoadSessions()
+	assert.ErrorContains(suite.T(), err, "NOAUTH")
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(StoreTestSuite))
+}
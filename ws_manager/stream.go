@@ -0,0 +1,309 @@
+package ws_manager
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Streams are delivered as binary frames, each carrying a 17 byte header
+// followed by up to chunkSize bytes of payload:
+//
+//	offset  size  field
+//	0       4     magic "WSTM"
+//	4       8     stream ID, big-endian, unique per manager
+//	12      4     chunk sequence number, big-endian, starting at 0
+//	16      1     flags, StreamFinalChunk set on the last chunk
+//	17      n     payload
+//
+// Clients reassemble a stream by concatenating payloads in sequence order
+// until they see the final chunk.
+const (
+	StreamMagic      = "WSTM"
+	StreamHeaderSize = 17
+	StreamFinalChunk = 0x01
+)
+
+// BroadcastStream reads r in chunks of chunkSize bytes and sends them in
+// order to every recipient of a broadcast from senderID. Each recipient's
+// connection stays locked for the whole stream so no other write can be
+// interleaved with its chunks, which means r should be a fast source such
+// as a buffer or a file: like BroadcastReader, pair it with WithSendQueue
+// to keep other broadcasts from waiting on it. The session itself is not
+// locked while r is read. A recipient whose write fails gets no further
+// chunks and is dropped once the stream ends, while the others get the rest
+// of it. Chunks are not passed to the pre-broadcast hook.
+func (sm *SessionManager) BroadcastStream(sessionKey, senderID string, r io.Reader, chunkSize int) error {
+	if chunkSize <= 0 {
+		return errors.New(
+			fmt.Sprintf("Invalid chunk size %d", chunkSize),
+		)
+	}
+	if sm.maxOutboundMessageSize > 0 && StreamHeaderSize+chunkSize > sm.maxOutboundMessageSize {
+		return errors.New(
+			fmt.Sprintf("Chunk size %d exceeds the outbound message limit of %d bytes", chunkSize, sm.maxOutboundMessageSize),
+		)
+	}
+
+	sm.rlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	var clients []*client
+	if ok {
+		clients = s.recipients(senderID, nil)
+	}
+	sm.runlockSession(sessionKey)
+	if !ok {
+		return sessionNotFound(sessionKey)
+	}
+	streamID := atomic.AddUint64(&sm.nextStreamID, 1)
+
+	recipients := make([]*streamTarget, 0, len(clients))
+	for _, cl := range clients {
+		cl.writeMu.Lock()
+		recipients = append(recipients, &streamTarget{cl: cl})
+	}
+	// live are the recipients still taking chunks, in a slice of its own
+	// so recipients keeps the ones that failed
+	live := append([]*streamTarget{}, recipients...)
+	current := make([]byte, chunkSize)
+	next := make([]byte, chunkSize)
+	n, err := readChunk(r, current)
+	for seq := uint32(0); err == nil; seq++ {
+		var m int
+		m, err = readChunk(r, next)
+		if err != nil {
+			break
+		}
+		final := m == 0
+		frame := streamFrame(streamID, seq, final, current[:n])
+		kept := live[:0]
+		for _, rc := range live {
+			if rc.err = rc.cl.writeFrame(websocket.BinaryMessage, frame); rc.err != nil {
+				rc.cl.writeMu.Unlock()
+				continue
+			}
+			rc.frames++
+			rc.bytes += len(frame)
+			kept = append(kept, rc)
+		}
+		live = kept
+		if final {
+			break
+		}
+		current, next = next, current
+		n = m
+	}
+	for _, rc := range live {
+		rc.cl.writeMu.Unlock()
+	}
+
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	sm.streamedLocked(s, recipients)
+	if err != nil {
+		return err
+	}
+	sm.recordBroadcastLocked(s, time.Now())
+	return nil
+}
+
+// streamTarget is a connection receiving a BroadcastStream, with the
+// frames and bytes written to it and the error that ended its share.
+type streamTarget struct {
+	cl     *client
+	frames int
+	bytes  int
+	err    error
+}
+
+// streamedLocked records what a stream delivered to each recipient and
+// drops the ones whose write failed.
+func (sm *SessionManager) streamedLocked(s *session, recipients []*streamTarget) {
+	total := 0
+	for _, rc := range recipients {
+		if rc.err != nil {
+			sm.logger.Warn("Write failed", "session", s.key, "client", rc.cl.id, "err", rc.err)
+			sm.dropClientLocked(s, rc.cl, rc.err)
+		}
+		if rc.frames == 0 {
+			continue
+		}
+		rc.cl.markActive()
+		rc.cl.delivered += uint64(rc.frames)
+		sm.trackAckLocked(s, rc.cl)
+		s.bytes += uint64(rc.bytes)
+		total += rc.bytes
+	}
+	sm.statsMu.Lock()
+	sm.metrics.BytesRelayed += uint64(total)
+	sm.byteRate.observeN(time.Now(), sm.rateWindow, float64(total))
+	sm.statsMu.Unlock()
+	s.lastUsed = time.Now()
+}
+
+// readChunk fills buf from r, returning fewer bytes only at end of input.
+func readChunk(r io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return n, nil
+	}
+	return n, err
+}
+
+func streamFrame(streamID uint64, seq uint32, final bool, payload []byte) []byte {
+	frame := make([]byte, StreamHeaderSize+len(payload))
+	copy(frame, StreamMagic)
+	binary.BigEndian.PutUint64(frame[4:12], streamID)
+	binary.BigEndian.PutUint32(frame[12:16], seq)
+	if final {
+		frame[16] = StreamFinalChunk
+	}
+	copy(frame[StreamHeaderSize:], payload)
+	return frame
+}
+
+// streamRecipient is a connection receiving a BroadcastReader message.
+type streamRecipient struct {
+	cl  *client
+	w   io.WriteCloser
+	err error
+}
+
+// BroadcastReader relays the payload read from r to every recipient of a
+// broadcast from senderID as a single messageType message, written
+// chunkSize bytes at a time through NextWriter, which sends it as
+// continuation frames as its write buffer fills. Unlike Broadcast,
+// the payload is never held whole: one chunk is buffered for all
+// recipients, and the next is read once every recipient has taken it, so r
+// is read at the pace of the slowest recipient and memory stays bounded
+// whatever the payload and session size. With WithWriteTimeout, a
+// recipient that does not take a chunk in time is dropped from the message
+// and its connection closed, so it cannot hold up the others.
+//
+// The session is not locked while the message is relayed, but each
+// recipient's connection is, since WebSocket messages cannot interleave:
+// other writes to it wait for the message to end, so pair it with
+// WithSendQueue to keep other broadcasts from waiting too. As with
+// BroadcastStream, the payload is not wrapped, encoded, kept in history or
+// passed to the pre-broadcast hook. It returns how many recipients got the
+// whole message. If r fails, every recipient's connection is closed, as
+// the message cannot be completed.
+func (sm *SessionManager) BroadcastReader(sessionKey, senderID string, messageType int, r io.Reader, chunkSize int) (int, error) {
+	if chunkSize <= 0 {
+		return 0, errors.New(
+			fmt.Sprintf("Invalid chunk size %d", chunkSize),
+		)
+	}
+	sm.sessionManagerMu.RLock()
+	s, ok := sm.sessions[sessionKey]
+	var clients []*client
+	if ok {
+		clients = s.recipients(senderID, nil)
+	}
+	sm.sessionManagerMu.RUnlock()
+	if !ok {
+		return 0, sessionNotFound(sessionKey)
+	}
+
+	recipients := make([]*streamRecipient, 0, len(clients))
+	for _, cl := range clients {
+		cl.writeMu.Lock()
+		cl.setWriteCompression(chunkSize)
+		w, err := cl.conn.NextWriter(messageType)
+		if err != nil {
+			cl.writeMu.Unlock()
+			sm.logger.Warn("Write failed", "session", sessionKey, "client", cl.id, "err", err)
+			continue
+		}
+		recipients = append(recipients, &streamRecipient{cl: cl, w: w})
+	}
+
+	buf := make([]byte, chunkSize)
+	total := 0
+	for len(recipients) > 0 {
+		n, err := readChunk(r, buf)
+		if err != nil {
+			for _, rc := range recipients {
+				rc.cl.conn.Close()
+				rc.cl.writeMu.Unlock()
+			}
+			return 0, err
+		}
+		if n > 0 {
+			total += n
+			recipients = sm.writeChunk(sessionKey, recipients, buf[:n])
+		}
+		if n < chunkSize {
+			break
+		}
+	}
+
+	delivered := []*client{}
+	for _, rc := range recipients {
+		if err := rc.w.Close(); err != nil {
+			sm.dropStreamRecipient(sessionKey, rc, err)
+			continue
+		}
+		if rc.cl.writeTimeout > 0 {
+			rc.cl.conn.SetWriteDeadline(time.Time{})
+		}
+		rc.cl.writeMu.Unlock()
+		delivered = append(delivered, rc.cl)
+	}
+
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	now := time.Now()
+	for _, cl := range delivered {
+		cl.markActive()
+		cl.delivered++
+		s.bytes += uint64(total)
+	}
+	sm.statsMu.Lock()
+	sm.metrics.BytesRelayed += uint64(total * len(delivered))
+	sm.byteRate.observeN(now, sm.rateWindow, float64(total*len(delivered)))
+	sm.statsMu.Unlock()
+	sm.recordBroadcastLocked(s, now)
+	s.lastUsed = now
+	return len(delivered), nil
+}
+
+// writeChunk writes chunk to every recipient in parallel and returns the
+// ones that took it. The others are dropped.
+func (sm *SessionManager) writeChunk(sessionKey string, recipients []*streamRecipient, chunk []byte) []*streamRecipient {
+	var wg sync.WaitGroup
+	for _, rc := range recipients {
+		wg.Add(1)
+		go func(rc *streamRecipient) {
+			defer wg.Done()
+			if rc.cl.writeTimeout > 0 {
+				rc.cl.conn.SetWriteDeadline(time.Now().Add(rc.cl.writeTimeout))
+			}
+			_, rc.err = rc.w.Write(chunk)
+		}(rc)
+	}
+	wg.Wait()
+	kept := recipients[:0]
+	for _, rc := range recipients {
+		if rc.err != nil {
+			sm.dropStreamRecipient(sessionKey, rc, rc.err)
+			continue
+		}
+		kept = append(kept, rc)
+	}
+	return kept
+}
+
+// dropStreamRecipient closes the connection of a recipient that failed to
+// take the message and releases it.
+func (sm *SessionManager) dropStreamRecipient(sessionKey string, rc *streamRecipient, err error) {
+	sm.logger.Warn("Write failed", "session", sessionKey, "client", rc.cl.id, "err", err)
+	rc.cl.conn.Close()
+	rc.cl.writeMu.Unlock()
+}
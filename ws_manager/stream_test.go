@@ -0,0 +1,278 @@
+package ws_manager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type StreamTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *StreamTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey})
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *StreamTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+// gatedReader blocks its first Read until release is closed, closing
+// started when it gets there.
+type gatedReader struct {
+	r        io.Reader
+	started  chan struct{}
+	release  chan struct{}
+	openGate sync.Once
+}
+
+func newGatedReader(r io.Reader) *gatedReader {
+	return &gatedReader{r: r, started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (g *gatedReader) Read(p []byte) (int, error) {
+	g.openGate.Do(func() {
+		close(g.started)
+		<-g.release
+	})
+	return g.r.Read(p)
+}
+
+// reassemble reads stream chunks from conn until the final one.
+func (suite *StreamTestSuite) reassemble(conn *websocket.Conn) (uint64, string) {
+	var payload bytes.Buffer
+	var streamID uint64
+	for seq := uint32(0); ; seq++ {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		messageType, frame, err := conn.ReadMessage()
+		if !assert.NoError(suite.T(), err) {
+			return 0, ""
+		}
+		assert.Equal(suite.T(), websocket.BinaryMessage, messageType)
+		assert.Equal(suite.T(), StreamMagic, string(frame[:4]))
+		streamID = binary.BigEndian.Uint64(frame[4:12])
+		assert.Equal(suite.T(), seq, binary.BigEndian.Uint32(frame[12:16]))
+		payload.Write(frame[StreamHeaderSize:])
+		if frame[16]&StreamFinalChunk != 0 {
+			return streamID, payload.String()
+		}
+	}
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *StreamTestSuite) TestStreamIsDeliveredInOrder() {
+	sender, senderID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	blob := strings.Repeat("0123456789", 10) + "xyz"
+	err = suite.manager.BroadcastStream(suite.sessionKey, senderID, strings.NewReader(blob), 16)
+	assert.NoError(suite.T(), err)
+
+	streamID, payload := suite.reassemble(receiver)
+	assert.Equal(suite.T(), uint64(1), streamID)
+	assert.Equal(suite.T(), blob, payload)
+
+	_, err = readWithTimeout(sender, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *StreamTestSuite) TestStreamIsNotInterleaved() {
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	done := make(chan error)
+	go func() {
+		done <- suite.manager.BroadcastStream(suite.sessionKey, "", strings.NewReader(strings.Repeat("a", 4096)), 8)
+	}()
+	go suite.manager.Broadcast(suite.sessionKey, "", websocket.TextMessage, []byte("interruption"))
+
+	// the text broadcast lands either before or after the whole stream
+	receiver.SetReadDeadline(time.Now().Add(time.Second))
+	messageType, first, err := receiver.ReadMessage()
+	assert.NoError(suite.T(), err)
+	if messageType == websocket.TextMessage {
+		assert.Equal(suite.T(), "interruption", string(first))
+		_, payload := suite.reassemble(receiver)
+		assert.Len(suite.T(), payload, 4096)
+	} else {
+		chunks := 1
+		for first[16]&StreamFinalChunk == 0 {
+			receiver.SetReadDeadline(time.Now().Add(time.Second))
+			messageType, first, err = receiver.ReadMessage()
+			assert.NoError(suite.T(), err)
+			assert.Equal(suite.T(), websocket.BinaryMessage, messageType)
+			chunks++
+		}
+		assert.Equal(suite.T(), 512, chunks)
+		message, err := readWithTimeout(receiver, time.Second)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "interruption", message)
+	}
+	assert.NoError(suite.T(), <-done)
+}
+
+func (suite *StreamTestSuite) TestEmptyStreamSendsFinalChunk() {
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	assert.NoError(suite.T(), suite.manager.BroadcastStream(suite.sessionKey, "", strings.NewReader(""), 16))
+	_, payload := suite.reassemble(receiver)
+	assert.Equal(suite.T(), "", payload)
+}
+
+func (suite *StreamTestSuite) TestInvalidChunkSize() {
+	err := suite.manager.BroadcastStream(suite.sessionKey, "", strings.NewReader("x"), 0)
+	assert.EqualError(suite.T(), err, "Invalid chunk size 0")
+
+	WithMaxOutboundMessageSize(64)(suite.manager)
+	err = suite.manager.BroadcastStream(suite.sessionKey, "", strings.NewReader("x"), 64)
+	assert.EqualError(suite.T(), err, "Chunk size 64 exceeds the outbound message limit of 64 bytes")
+}
+
+func (suite *StreamTestSuite) TestStreamDoesNotLockManagerWhileReading() {
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer receiver.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	r := newGatedReader(strings.NewReader("hello"))
+	done := make(chan error, 1)
+	go func() {
+		done <- suite.manager.BroadcastStream(suite.sessionKey, "", r, 16)
+	}()
+	<-r.started
+	registered := make(chan error, 1)
+	go func() {
+		registered <- suite.manager.RegisterSession("roomtwoo")
+	}()
+	select {
+	case err := <-registered:
+		assert.NoError(suite.T(), err)
+	case <-time.After(time.Second):
+		suite.T().Fatal("registering waited for the stream's reader")
+	}
+	close(r.release)
+
+	_, payload := suite.reassemble(receiver)
+	assert.Equal(suite.T(), "hello", payload)
+	assert.NoError(suite.T(), <-done)
+}
+
+func (suite *StreamTestSuite) TestStreamDropsFailedRecipient() {
+	victim, victimID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer victim.Close()
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer receiver.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	r := newGatedReader(strings.NewReader(strings.Repeat("a", 256)))
+	done := make(chan error, 1)
+	go func() {
+		done <- suite.manager.BroadcastStream(suite.sessionKey, "", r, 8)
+	}()
+	<-r.started
+	suite.manager.rlockSession(suite.sessionKey)
+	for _, cl := range suite.manager.sessions[suite.sessionKey].clients {
+		if cl.id == victimID {
+			cl.conn.Close()
+		}
+	}
+	suite.manager.runlockSession(suite.sessionKey)
+	close(r.release)
+
+	_, payload := suite.reassemble(receiver)
+	assert.Len(suite.T(), payload, 256)
+	assert.NoError(suite.T(), <-done)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	assert.Equal(suite.T(), uint64(1), suite.manager.Metrics().WriteFailures)
+}
+
+func (suite *StreamTestSuite) TestBroadcastReaderSendsOneMessage() {
+	receivers := []*websocket.Conn{}
+	for i := 0; i < 3; i++ {
+		conn, err := dialSession(suite.server, suite.sessionKey, "")
+		assert.NoError(suite.T(), err)
+		defer conn.Close()
+		receivers = append(receivers, conn)
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 3))
+
+	blob := bytes.Repeat([]byte("canvas snapshot "), 64<<10)
+	delivered, err := suite.manager.BroadcastReader(suite.sessionKey, "", websocket.BinaryMessage, bytes.NewReader(blob), 4096)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 3, delivered)
+	for _, conn := range receivers {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		messageType, message, err := conn.ReadMessage()
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), websocket.BinaryMessage, messageType)
+		assert.True(suite.T(), bytes.Equal(blob, message))
+	}
+	stats, err := suite.manager.GetSessionStats(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), uint64(3*len(blob)), stats.BytesRelayed)
+
+	// writes after the message are not held up
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("after")))
+	message, err := readWithTimeout(receivers[0], time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "after", message)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("disk gone")
+}
+
+func (suite *StreamTestSuite) TestBroadcastReaderFailureClosesRecipients() {
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer receiver.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	_, err = suite.manager.BroadcastReader(suite.sessionKey, "", websocket.BinaryMessage, io.MultiReader(strings.NewReader("partial"), failingReader{}), 4)
+	assert.EqualError(suite.T(), err, "disk gone")
+	_, err = readWithTimeout(receiver, time.Second)
+	assert.Error(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 0))
+
+	_, err = suite.manager.BroadcastReader("missing", "", websocket.BinaryMessage, strings.NewReader("x"), 4)
+	assert.EqualError(suite.T(), err, "Session missing not found")
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestStreamTestSuite(t *testing.T) {
+	suite.Run(t, new(StreamTestSuite))
+}
@@ -0,0 +1,213 @@
+package ws_manager
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StreamOption sets how the connections of a stream registered with
+// WithStream differ from the rest of the session.
+type StreamOption func(*streamConfig)
+
+type streamConfig struct {
+	// historySize is how many broadcasts of the stream each session keeps
+	// for connections joining it, historySize of WithHistorySize unless
+	// historySet
+	historySize int
+	historySet  bool
+	rateLimit   *RateLimit
+	coalesce    *time.Duration
+}
+
+// StreamHistory keeps the last size broadcasts of the stream in each
+// session and replays them to connections joining the stream, instead of
+// the WithHistorySize of the session. Zero keeps none, e.g. for cursor
+// positions that are stale by the time anyone joins.
+func StreamHistory(size int) StreamOption {
+	return func(c *streamConfig) {
+		c.historySize = size
+		c.historySet = true
+	}
+}
+
+// StreamRateLimit limits each connection of the stream to perSecond
+// messages with bursts of burst, instead of the WithRateLimit of the
+// manager. The session rate limit still applies to all streams together.
+func StreamRateLimit(perSecond float64, burst int) StreamOption {
+	return func(c *streamConfig) {
+		c.rateLimit = &RateLimit{Messages: perSecond, MessageBurst: burst}
+	}
+}
+
+// StreamCoalescing batches the frames written to the connections of the
+// stream over window, instead of the WithCoalescing of the manager. A
+// window of zero or less sends them one by one.
+func StreamCoalescing(window time.Duration) StreamOption {
+	return func(c *streamConfig) {
+		c.coalesce = &window
+	}
+}
+
+// WithStream registers name as a stream: a logical sub-endpoint of every
+// session that connections join by dialing the session key followed by
+// the stream, e.g. /abcdefgh/cursor, with the route
+//
+//	e.GET("/:sessionKey/:stream", sm.EchoHandler)
+//
+// or Handler, or ServeStream. What a connection of a stream sends reaches
+// only the connections of the same stream, and keeps the stream's own
+// history, so high-frequency ephemeral traffic and durable chat can share
+// a session with different history, rate limit and batching settings.
+// Connections dialing the session key alone form the session's default
+// stream, which WithStream leaves as it is configured otherwise.
+// Broadcasts made by the application reach every stream, except those of
+// BroadcastToStream. Dials naming an unregistered stream are refused with
+// 404 Not Found.
+func WithStream(name string, opts ...StreamOption) Option {
+	return func(sm *SessionManager) {
+		c := &streamConfig{}
+		for _, opt := range opts {
+			opt(c)
+		}
+		if sm.streams == nil {
+			sm.streams = map[string]*streamConfig{}
+		}
+		sm.streams[name] = c
+	}
+}
+
+// ServeStream is ServeWS for a connection of the named stream of
+// sessionKey, see WithStream. An empty stream is the default one.
+func (sm *SessionManager) ServeStream(w http.ResponseWriter, r *http.Request, sessionKey, stream string) error {
+	return sm.serveStream(w, r, sessionKey, stream)
+}
+
+// BroadcastToStream sends data to the connections of the named stream of
+// the session, other than the sender. An empty stream is the default one.
+func (sm *SessionManager) BroadcastToStream(sessionKey, stream string, senderID string, messageType int, data []byte) error {
+	return sm.broadcastStream(sessionKey, stream, senderID, messageType, data, func(cl *client) bool {
+		return cl.stream == stream
+	})
+}
+
+// broadcastStream sends data to the connections of stream for which match
+// returns true, recording it in the stream's history.
+func (sm *SessionManager) broadcastStream(sessionKey, stream string, senderID string, messageType int, data []byte, match func(*client) bool) error {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return sessionNotFound(sessionKey)
+	}
+	messageType, data, allow := sm.prepareStreamBroadcastLocked(s, sm.streams[stream], stream, senderID, messageType, data, match)
+	if !allow {
+		return nil
+	}
+	_, failed, errs := sm.deliverLocked(s, senderID, messageType, data, match)
+	for i, cl := range failed {
+		sm.dropClientLocked(s, cl, errs[i])
+	}
+	return newBroadcastError(failed, errs)
+}
+
+// relayToStream broadcasts a message from cl to the other connections of
+// its stream, within its topic if it has one.
+func (sm *SessionManager) relayToStream(sessionKey string, cl *client, messageType int, message []byte) error {
+	return sm.broadcastStream(sessionKey, cl.stream, cl.id, messageType, message, func(r *client) bool {
+		return r.stream == cl.stream && (cl.topic == "" || r.topic == "" || r.topic == cl.topic)
+	})
+}
+
+// streamKnown reports whether stream is the default stream or registered
+// with WithStream.
+func (sm *SessionManager) streamKnown(stream string) bool {
+	_, ok := sm.streams[stream]
+	return stream == "" || ok
+}
+
+// sessionAndStream returns the session key and stream of a request to
+// Handler: the last path segment is the stream if it names a registered
+// one and follows the session key, so behind a path prefix a session key
+// naming a stream is read as the stream.
+func (sm *SessionManager) sessionAndStream(r *http.Request) (string, string) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if n := len(segments); n >= 2 && segments[n-1] != "" {
+		if _, ok := sm.streams[segments[n-1]]; ok {
+			return segments[n-2], segments[n-1]
+		}
+	}
+	return sessionKeyFromRequest(r), ""
+}
+
+// streamRateLimit returns the rate limit of the connections of stream in
+// sessionKey.
+func (sm *SessionManager) streamRateLimit(sessionKey, stream string) RateLimit {
+	if c, ok := sm.streams[stream]; ok && c.rateLimit != nil {
+		return *c.rateLimit
+	}
+	if limit, ok := sm.sessionRateLimitOverride(sessionKey); ok {
+		return limit
+	}
+	return sm.connRateLimit
+}
+
+// streamCoalesceWindow returns the coalescing window of the connections of
+// stream.
+func (sm *SessionManager) streamCoalesceWindow(stream string) time.Duration {
+	if c, ok := sm.streams[stream]; ok && c.coalesce != nil {
+		return *c.coalesce
+	}
+	return sm.coalesceWindow
+}
+
+// recordStreamHistoryLocked appends a broadcast of stream to its history
+// in s, as recordHistoryLocked does for the session history. The caller
+// must hold sessionManagerMu.
+func (sm *SessionManager) recordStreamHistoryLocked(s *session, c *streamConfig, stream string, senderID string, messageType int, message []byte, match func(*client) bool, now time.Time, seq uint64) {
+	size := sm.historySizeLocked(s)
+	if c.historySet {
+		size = c.historySize
+	}
+	if size <= 0 {
+		return
+	}
+	ttl := sm.historyTTL(messageType, message)
+	messageType, message = sm.replayFrame(senderID, messageType, message, now, seq)
+	if s.streamHistory == nil {
+		s.streamHistory = map[string][]historyEntry{}
+	}
+	history := append(s.streamHistory[stream], historyEntry{
+		messageType: messageType,
+		message:     append([]byte{}, message...),
+		match:       match,
+		at:          now,
+		seq:         seq,
+		ttl:         ttl,
+	})
+	if len(history) > size {
+		history = append([]historyEntry{}, history[len(history)-size:]...)
+	}
+	kept := history[:0]
+	for _, entry := range history {
+		if !entry.expired(now, sm.historyMaxAge) {
+			kept = append(kept, entry)
+		}
+	}
+	s.streamHistory[stream] = kept
+}
+
+// replayStreamHistoryLocked writes the history of the stream of cl to it.
+// The caller must hold sessionManagerMu.
+func (sm *SessionManager) replayStreamHistoryLocked(s *session, cl *client) error {
+	now := time.Now()
+	for _, entry := range s.streamHistory[cl.stream] {
+		if entry.expired(now, sm.historyMaxAge) || (entry.match != nil && !entry.match(cl)) {
+			continue
+		}
+		if _, err := sm.writeFrameLocked(s, cl, entry.messageType, entry.message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
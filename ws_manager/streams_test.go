@@ -0,0 +1,109 @@
+package ws_manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type StreamsTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *StreamsTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey},
+		WithHistorySize(10),
+		WithStream("chat"),
+		WithStream("cursor", StreamHistory(0), StreamRateLimit(100, 100)),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	e.GET("/:sessionKey/:stream", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *StreamsTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *StreamsTestSuite) TestStreamsAreSeparate() {
+	dial := func(path string) *websocket.Conn {
+		conn, err := dialSession(suite.server, path, "")
+		assert.NoError(suite.T(), err)
+		return conn
+	}
+	chatA, chatB := dial(suite.sessionKey+"/chat"), dial(suite.sessionKey+"/chat")
+	cursorA, cursorB := dial(suite.sessionKey+"/cursor"), dial(suite.sessionKey+"/cursor")
+	plain := dial(suite.sessionKey)
+	for _, conn := range []*websocket.Conn{chatA, chatB, cursorA, cursorB, plain} {
+		defer conn.Close()
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 5))
+
+	cursorA.WriteMessage(websocket.TextMessage, []byte("x=10"))
+	message, err := readWithTimeout(cursorB, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "x=10", message)
+	chatA.WriteMessage(websocket.TextMessage, []byte("hello"))
+	message, err = readWithTimeout(chatB, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "hello", message)
+	for _, conn := range []*websocket.Conn{cursorB, plain} {
+		_, err = readWithTimeout(conn, 100*time.Millisecond)
+		assert.Error(suite.T(), err)
+	}
+
+	lateChat, lateCursor := dial(suite.sessionKey+"/chat"), dial(suite.sessionKey+"/cursor")
+	defer lateChat.Close()
+	defer lateCursor.Close()
+	message, err = readWithTimeout(lateChat, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "hello", message)
+	_, err = readWithTimeout(lateCursor, 100*time.Millisecond)
+	assert.Error(suite.T(), err)
+
+	clients, err := suite.manager.GetClients(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	if assert.Len(suite.T(), clients, 7) {
+		assert.Equal(suite.T(), "cursor", clients[2].Stream)
+	}
+}
+
+func (suite *StreamsTestSuite) TestUnknownStreamAndHandlerPaths() {
+	_, resp, err := dialSessionWithHeader(suite.server, suite.sessionKey+"/video", "", nil)
+	assert.Error(suite.T(), err)
+	if assert.NotNil(suite.T(), resp) {
+		assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+	}
+
+	for path, expected := range map[string][2]string{
+		"/ws/abcdefgh/chat": {"abcdefgh", "chat"},
+		"/ws/abcdefgh":      {"abcdefgh", ""},
+		"/chat":             {"chat", ""},
+	} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		sessionKey, stream := suite.manager.sessionAndStream(r)
+		assert.Equal(suite.T(), expected, [2]string{sessionKey, stream}, path)
+	}
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestStreamsTestSuite(t *testing.T) {
+	suite.Run(t, new(StreamsTestSuite))
+}
@@ -0,0 +1,137 @@
+package ws_manager
+
+import (
+	"time"
+)
+
+// defaultSubscriptionBuffer is how many messages a subscription holds for
+// its consumer unless SubscriptionBuffer says otherwise.
+const defaultSubscriptionBuffer = 256
+
+// Message is a message of a session, as seen by SubscribeMessages. Data
+// must not be modified.
+type Message struct {
+	SessionKey string
+	// SenderID is the client ID of the sender, SystemSender or empty for
+	// broadcasts made by the application
+	SenderID    string
+	MessageType int
+	Data        []byte
+	At          time.Time
+	// Seq is the sequence number of a broadcast, see WithSequenceNumbers
+	Seq uint64
+	// Inbound is set for a message as a connection sent it, see
+	// IncludeInbound
+	Inbound bool
+}
+
+// SubscribeOption configures a subscription made with SubscribeMessages.
+type SubscribeOption func(*subscription)
+
+// IncludeInbound also delivers every data message the session's
+// connections send, after the middlewares and before it is handled or
+// broadcast, with Inbound set. These are the messages OnMessage sees.
+func IncludeInbound() SubscribeOption {
+	return func(sub *subscription) {
+		sub.inbound = true
+	}
+}
+
+// SubscriptionBuffer sets how many messages the subscription holds for a
+// consumer that has fallen behind, 256 by default.
+func SubscriptionBuffer(size int) SubscribeOption {
+	return func(sub *subscription) {
+		if size > 0 {
+			sub.size = size
+		}
+	}
+}
+
+type subscription struct {
+	messages chan Message
+	inbound  bool
+	size     int
+}
+
+// SubscribeMessages returns a channel that receives every broadcast of the
+// session, as it was sent before any protocol mode envelope is added, for
+// server-side consumers such as chat log writers or analytics pipelines.
+// Broadcasts vetoed by the pre-broadcast hooks are not delivered. The
+// messages are handed over without blocking the session: a subscription
+// whose buffer is full is ended. The channel is closed once unsubscribe is
+// called, the subscription is ended, or the session is removed or closed.
+//
+//	messages, unsubscribe, err := sm.SubscribeMessages("abcdefgh")
+//	defer unsubscribe()
+//	for msg := range messages {
+//		chatLog.Append(msg.SenderID, msg.Data)
+//	}
+func (sm *SessionManager) SubscribeMessages(sessionKey string, opts ...SubscribeOption) (<-chan Message, func(), error) {
+	sub := &subscription{size: defaultSubscriptionBuffer}
+	for _, opt := range opts {
+		opt(sub)
+	}
+	sub.messages = make(chan Message, sub.size)
+
+	sm.sessionManagerMu.RLock()
+	defer sm.sessionManagerMu.RUnlock()
+	if _, ok := sm.sessions[sessionKey]; !ok {
+		return nil, nil, sessionNotFound(sessionKey)
+	}
+	sm.subscriptionsMu.Lock()
+	defer sm.subscriptionsMu.Unlock()
+	if sm.subscriptions == nil {
+		sm.subscriptions = map[string]map[*subscription]struct{}{}
+	}
+	if sm.subscriptions[sessionKey] == nil {
+		sm.subscriptions[sessionKey] = map[*subscription]struct{}{}
+	}
+	sm.subscriptions[sessionKey][sub] = struct{}{}
+	unsubscribe := func() {
+		sm.subscriptionsMu.Lock()
+		defer sm.subscriptionsMu.Unlock()
+		sm.endSubscriptionLocked(sessionKey, sub)
+	}
+	return sub.messages, unsubscribe, nil
+}
+
+// publishMessage hands msg to the subscribers of its session without
+// blocking, as broadcasts are published under the manager lock.
+func (sm *SessionManager) publishMessage(msg Message) {
+	sm.subscriptionsMu.Lock()
+	defer sm.subscriptionsMu.Unlock()
+	for sub := range sm.subscriptions[msg.SessionKey] {
+		if msg.Inbound && !sub.inbound {
+			continue
+		}
+		select {
+		case sub.messages <- msg:
+		default:
+			sm.logger.Warn("Message subscriber fell behind, ending subscription", "session", msg.SessionKey)
+			sm.endSubscriptionLocked(msg.SessionKey, sub)
+		}
+	}
+}
+
+// endSubscriptions ends every subscription to sessionKey.
+func (sm *SessionManager) endSubscriptions(sessionKey string) {
+	sm.subscriptionsMu.Lock()
+	defer sm.subscriptionsMu.Unlock()
+	for sub := range sm.subscriptions[sessionKey] {
+		sm.endSubscriptionLocked(sessionKey, sub)
+	}
+}
+
+// endSubscriptionLocked removes sub and closes its channel, unless it has
+// already ended. The caller must hold subscriptionsMu.
+func (sm *SessionManager) endSubscriptionLocked(sessionKey string, sub *subscription) {
+	subs := sm.subscriptions[sessionKey]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(sm.subscriptions, sessionKey)
+	}
+	close(sub.messages)
+}
@@ -0,0 +1,102 @@
+package ws_manager
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SubscriptionsTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *SubscriptionsTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey})
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *SubscriptionsTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+// next returns the next message of messages.
+func (suite *SubscriptionsTestSuite) next(messages <-chan Message) Message {
+	select {
+	case msg, ok := <-messages:
+		assert.True(suite.T(), ok, "subscription ended")
+		return msg
+	case <-time.After(time.Second):
+		suite.T().Fatal("no message delivered")
+		return Message{}
+	}
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *SubscriptionsTestSuite) TestBroadcastsAndInboundAreDelivered() {
+	_, _, err := suite.manager.SubscribeMessages("missing")
+	assert.Error(suite.T(), err)
+	broadcasts, unsubscribe, err := suite.manager.SubscribeMessages(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	all, unsubscribeAll, err := suite.manager.SubscribeMessages(suite.sessionKey, IncludeInbound())
+	assert.NoError(suite.T(), err)
+	defer unsubscribeAll()
+
+	conn, id, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+	msg := suite.next(broadcasts)
+	assert.Equal(suite.T(), id, msg.SenderID)
+	assert.Equal(suite.T(), "hello", string(msg.Data))
+	assert.False(suite.T(), msg.Inbound)
+	msg = suite.next(all)
+	assert.True(suite.T(), msg.Inbound)
+	assert.Equal(suite.T(), "hello", string(msg.Data))
+	assert.False(suite.T(), suite.next(all).Inbound)
+
+	suite.manager.Broadcast(suite.sessionKey, SystemSender, websocket.TextMessage, []byte("notice"))
+	assert.Equal(suite.T(), "notice", string(suite.next(broadcasts).Data))
+	unsubscribe()
+	unsubscribe()
+	_, ok := <-broadcasts
+	assert.False(suite.T(), ok)
+}
+
+func (suite *SubscriptionsTestSuite) TestSubscriptionsEnd() {
+	slow, _, err := suite.manager.SubscribeMessages(suite.sessionKey, SubscriptionBuffer(1))
+	assert.NoError(suite.T(), err)
+	messages, _, err := suite.manager.SubscribeMessages(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	suite.manager.Broadcast(suite.sessionKey, SystemSender, websocket.TextMessage, []byte("one"))
+	suite.manager.Broadcast(suite.sessionKey, SystemSender, websocket.TextMessage, []byte("two"))
+	assert.Equal(suite.T(), "one", string(suite.next(slow).Data))
+	_, ok := <-slow
+	assert.False(suite.T(), ok)
+
+	assert.NoError(suite.T(), suite.manager.RemoveSession(suite.sessionKey))
+	suite.next(messages)
+	suite.next(messages)
+	_, ok = <-messages
+	assert.False(suite.T(), ok)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestSubscriptionsTestSuite(t *testing.T) {
+	suite.Run(t, new(SubscriptionsTestSuite))
+}
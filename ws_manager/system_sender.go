@@ -0,0 +1,39 @@
+package ws_manager
+
+// SystemSender is the sender ID for broadcasts that come from the
+// application rather than a connection, such as announcements. It matches
+// no connection, so every connection receives the broadcast, and envelopes
+// carry it as the sender so clients can tell such messages apart:
+//
+//	sm.Broadcast(key, SystemSender, websocket.TextMessage, []byte("restarting soon"))
+//
+// Any other sender ID broadcasts on that connection's behalf, with its
+// blocks and exclusion from the recipients applied as if it had sent the
+// message itself.
+const SystemSender = "system"
+
+// Exclude leaves the connections with clientIDs out of the broadcast, for
+// example the moderator whose action it announces. Exclusions apply on this
+// instance only; with a backend the other instances deliver to all their
+// connections.
+func Exclude(clientIDs ...string) BroadcastOption {
+	return func(o *broadcastOptions) {
+		if o.exclude == nil {
+			o.exclude = map[string]bool{}
+		}
+		for _, id := range clientIDs {
+			o.exclude[id] = true
+		}
+	}
+}
+
+// match returns the recipient filter for the options, or nil to reach
+// everyone.
+func (o broadcastOptions) match() func(*client) bool {
+	if len(o.exclude) == 0 && o.filter == nil {
+		return nil
+	}
+	return func(cl *client) bool {
+		return !o.exclude[cl.id] && (o.filter == nil || o.filter(cl))
+	}
+}
@@ -0,0 +1,107 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SystemSenderTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *SystemSenderTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithEnvelopeMode(true))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *SystemSenderTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+// dial joins n connections and returns them with their client IDs.
+func (suite *SystemSenderTestSuite) dial(n int) ([]*websocket.Conn, []string) {
+	conns := []*websocket.Conn{}
+	ids := []string{}
+	for i := 0; i < n; i++ {
+		conn, id, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+		assert.NoError(suite.T(), err)
+		suite.T().Cleanup(func() { conn.Close() })
+		conns = append(conns, conn)
+		ids = append(ids, id)
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, n))
+	return conns, ids
+}
+
+// readEnvelope reads one envelope from conn.
+func (suite *SystemSenderTestSuite) readEnvelope(conn *websocket.Conn) envelope {
+	message, err := readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	env := envelope{}
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &env))
+	return env
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *SystemSenderTestSuite) TestSystemSenderReachesEveryone() {
+	conns, _ := suite.dial(2)
+
+	recipients, errs := suite.manager.Broadcast(suite.sessionKey, SystemSender, websocket.TextMessage, []byte("restarting soon"))
+	assert.Empty(suite.T(), errs)
+	assert.Equal(suite.T(), 2, recipients)
+	for _, conn := range conns {
+		env := suite.readEnvelope(conn)
+		assert.Equal(suite.T(), SystemSender, env.From)
+		assert.Equal(suite.T(), "restarting soon", env.Data)
+	}
+}
+
+func (suite *SystemSenderTestSuite) TestExcludeLeavesOutConnections() {
+	conns, ids := suite.dial(3)
+
+	recipients, errs := suite.manager.Broadcast(suite.sessionKey, SystemSender, websocket.TextMessage, []byte("kicked"), Exclude(ids[1]))
+	assert.Empty(suite.T(), errs)
+	assert.Equal(suite.T(), 2, recipients)
+	assert.Equal(suite.T(), "kicked", suite.readEnvelope(conns[0]).Data)
+	assert.Equal(suite.T(), "kicked", suite.readEnvelope(conns[2]).Data)
+	_, err := readWithTimeout(conns[1], 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *SystemSenderTestSuite) TestImpersonatedSender() {
+	conns, ids := suite.dial(3)
+
+	recipients, errs := suite.manager.Broadcast(suite.sessionKey, ids[0], websocket.TextMessage, []byte("on behalf"), IncludeSender(), Exclude(ids[0], ids[2]))
+	assert.Empty(suite.T(), errs)
+	assert.Equal(suite.T(), 1, recipients)
+	env := suite.readEnvelope(conns[1])
+	assert.Equal(suite.T(), ids[0], env.From)
+	assert.Equal(suite.T(), "on behalf", env.Data)
+	for _, conn := range []*websocket.Conn{conns[0], conns[2]} {
+		_, err := readWithTimeout(conn, 200*time.Millisecond)
+		assert.Error(suite.T(), err)
+	}
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestSystemSenderTestSuite(t *testing.T) {
+	suite.Run(t, new(SystemSenderTestSuite))
+}
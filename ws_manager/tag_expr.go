@@ -0,0 +1,179 @@
+package ws_manager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// tagExpr is a boolean expression over the tags of a connection.
+//
+// Grammar, lowest precedence first:
+//
+//	or   = and { "OR" and }
+//	and  = not { "AND" not }
+//	not  = "NOT" not | atom
+//	atom = tag | "(" or ")"
+type tagExpr interface {
+	eval(tags map[string]struct{}) bool
+}
+
+type tagTerm string
+
+type notExpr struct {
+	x tagExpr
+}
+
+type andExpr struct {
+	left, right tagExpr
+}
+
+type orExpr struct {
+	left, right tagExpr
+}
+
+func (t tagTerm) eval(tags map[string]struct{}) bool {
+	_, ok := tags[string(t)]
+	return ok
+}
+
+func (e notExpr) eval(tags map[string]struct{}) bool {
+	return !e.x.eval(tags)
+}
+
+func (e andExpr) eval(tags map[string]struct{}) bool {
+	return e.left.eval(tags) && e.right.eval(tags)
+}
+
+func (e orExpr) eval(tags map[string]struct{}) bool {
+	return e.left.eval(tags) || e.right.eval(tags)
+}
+
+type tagExprParser struct {
+	tokens []string
+	pos    int
+}
+
+func parseTagExpr(expr string) (tagExpr, error) {
+	p := &tagExprParser{tokens: tokenizeTagExpr(expr)}
+	if len(p.tokens) == 0 {
+		return nil, errors.New("Empty tag expression")
+	}
+	parsed, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, errors.New(
+			fmt.Sprintf("Unexpected %q in tag expression", p.tokens[p.pos]),
+		)
+	}
+	return parsed, nil
+}
+
+func tokenizeTagExpr(expr string) []string {
+	var tokens []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range expr {
+		switch {
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+func (p *tagExprParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *tagExprParser) acceptKeyword(keyword string) bool {
+	if strings.EqualFold(p.peek(), keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *tagExprParser) parseOr() (tagExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *tagExprParser) parseAnd() (tagExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *tagExprParser) parseNot() (tagExpr, error) {
+	if p.acceptKeyword("NOT") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{x}, nil
+	}
+	return p.parseAtom()
+}
+
+func (p *tagExprParser) parseAtom() (tagExpr, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return nil, errors.New("Unexpected end of tag expression")
+	case token == "(":
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, errors.New("Missing closing parenthesis in tag expression")
+		}
+		p.pos++
+		return inner, nil
+	case token == ")",
+		strings.EqualFold(token, "AND"),
+		strings.EqualFold(token, "OR"):
+		return nil, errors.New(
+			fmt.Sprintf("Unexpected %q in tag expression", token),
+		)
+	}
+	p.pos++
+	return tagTerm(token), nil
+}
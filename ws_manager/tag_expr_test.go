@@ -0,0 +1,105 @@
+package ws_manager
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TagExprTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *TagExprTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey})
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *TagExprTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *TagExprTestSuite) TestParseAndEvaluate() {
+	tags := map[string]struct{}{"team:red": {}, "observer": {}}
+	cases := map[string]bool{
+		"team:red":                           true,
+		"team:blue":                          false,
+		"team:red AND NOT observer":          false,
+		"team:red and not team:blue":         true,
+		"team:blue OR observer":              true,
+		"NOT (team:red OR team:blue)":        false,
+		"(team:blue OR team:red) AND NOT x":  true,
+		"team:blue OR team:red AND observer": true,
+	}
+	for expr, expected := range cases {
+		parsed, err := parseTagExpr(expr)
+		if assert.NoError(suite.T(), err, expr) {
+			assert.Equal(suite.T(), expected, parsed.eval(tags), expr)
+		}
+	}
+}
+
+func (suite *TagExprTestSuite) TestParseErrors() {
+	for _, expr := range []string{"", "AND", "team:red AND", "(team:red", "team:red)", "NOT", "a b"} {
+		_, err := parseTagExpr(expr)
+		assert.Error(suite.T(), err, expr)
+	}
+}
+
+func (suite *TagExprTestSuite) TestBroadcastReachesMatchingConnections() {
+	_, senderID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	red, err := dialSession(suite.server, suite.sessionKey, "tag=team:red")
+	assert.NoError(suite.T(), err)
+	redObserver, err := dialSession(suite.server, suite.sessionKey, "tag=team:red&tag=observer")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 3))
+
+	err = suite.manager.BroadcastToTagExpr(
+		suite.sessionKey,
+		senderID,
+		"team:red AND NOT observer",
+		"hello red",
+	)
+	assert.NoError(suite.T(), err)
+
+	message, err := readWithTimeout(red, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "hello red", message)
+
+	_, err = readWithTimeout(redObserver, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *TagExprTestSuite) TestInvalidExpressionSendsNothing() {
+	red, err := dialSession(suite.server, suite.sessionKey, "tag=team:red")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	err = suite.manager.BroadcastToTagExpr(suite.sessionKey, "", "team:red AND (", "hello")
+	assert.Error(suite.T(), err)
+
+	_, err = readWithTimeout(red, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestTagExprTestSuite(t *testing.T) {
+	suite.Run(t, new(TagExprTestSuite))
+}
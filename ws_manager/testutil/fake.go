@@ -0,0 +1,335 @@
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Frame is a message delivered to a fake client.
+type Frame struct {
+	MessageType int
+	Data        []byte
+}
+
+// Broadcast is a broadcast recorded by FakeManager.
+type Broadcast struct {
+	SessionKey  string
+	SenderID    string
+	MessageType int
+	Data        []byte
+	// Recipients is how many fake clients received the broadcast.
+	Recipients int
+}
+
+// FakeManager is an in-memory ws_manager.Manager for unit tests. It records
+// every broadcast and delivers them to fake clients joined with Connect, so
+// code built on the manager can be tested without sockets, an echo server
+// or sleeps. Everything happens synchronously. It is safe for concurrent
+// use.
+type FakeManager struct {
+	mu         sync.Mutex
+	sessions   map[string]*fakeSession
+	broadcasts []Broadcast
+	lastID     int
+	lastKey    int
+}
+
+type fakeSession struct {
+	clients  []*FakeClient
+	metadata map[string]interface{}
+}
+
+// NewFakeManager returns a fake with sessionKeys registered.
+func NewFakeManager(sessionKeys ...string) *FakeManager {
+	fm := &FakeManager{sessions: map[string]*fakeSession{}}
+	for _, key := range sessionKeys {
+		fm.sessions[key] = &fakeSession{}
+	}
+	return fm
+}
+
+// RegisterSession implements ws_manager.Manager.
+func (fm *FakeManager) RegisterSession(sessionKey string) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	if _, ok := fm.sessions[sessionKey]; ok {
+		return errors.New(
+			fmt.Sprintf("Session %s already exists", sessionKey),
+		)
+	}
+	fm.sessions[sessionKey] = &fakeSession{}
+	return nil
+}
+
+// CreateSession implements ws_manager.Manager. Keys are "fake1", "fake2"
+// and so on, skipping registered ones.
+func (fm *FakeManager) CreateSession() (key string, err error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	for {
+		fm.lastKey++
+		key = "fake" + strconv.Itoa(fm.lastKey)
+		if _, taken := fm.sessions[key]; !taken {
+			fm.sessions[key] = &fakeSession{}
+			return key, nil
+		}
+	}
+}
+
+// RemoveSession implements ws_manager.Manager. Its clients are closed with
+// a normal closure.
+func (fm *FakeManager) RemoveSession(sessionKey string) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	s, err := fm.sessionLocked(sessionKey)
+	if err != nil {
+		return err
+	}
+	delete(fm.sessions, sessionKey)
+	for _, fc := range s.clients {
+		fc.closeLocked(websocket.CloseNormalClosure, "session removed")
+	}
+	return nil
+}
+
+// ListSessions implements ws_manager.Manager.
+func (fm *FakeManager) ListSessions() []string {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	keys := make([]string, 0, len(fm.sessions))
+	for key := range fm.sessions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ActiveConnections implements ws_manager.Manager.
+func (fm *FakeManager) ActiveConnections(sessionKey string) (int, error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	s, err := fm.sessionLocked(sessionKey)
+	if err != nil {
+		return 0, err
+	}
+	return len(s.clients), nil
+}
+
+// BroadcastMessage implements ws_manager.Manager. It delivers message to
+// every client of the session but the sender and records it.
+func (fm *FakeManager) BroadcastMessage(sessionKey string, senderID string, messageType int, message []byte) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	s, err := fm.sessionLocked(sessionKey)
+	if err != nil {
+		return err
+	}
+	recipients := 0
+	for _, fc := range s.clients {
+		if fc.id != senderID {
+			fc.deliverLocked(messageType, message)
+			recipients++
+		}
+	}
+	fm.broadcasts = append(fm.broadcasts, Broadcast{
+		SessionKey:  sessionKey,
+		SenderID:    senderID,
+		MessageType: messageType,
+		Data:        append([]byte{}, message...),
+		Recipients:  recipients,
+	})
+	return nil
+}
+
+// SendToClient implements ws_manager.Manager.
+func (fm *FakeManager) SendToClient(sessionKey string, clientID string, messageType int, data []byte) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	fc, err := fm.clientLocked(sessionKey, clientID)
+	if err != nil {
+		return err
+	}
+	fc.deliverLocked(messageType, data)
+	return nil
+}
+
+// KickClient implements ws_manager.Manager. The client is closed with a
+// policy violation and reason.
+func (fm *FakeManager) KickClient(sessionKey, clientID, reason string) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	fc, err := fm.clientLocked(sessionKey, clientID)
+	if err != nil {
+		return err
+	}
+	fm.removeLocked(fc)
+	fc.closeLocked(websocket.ClosePolicyViolation, reason)
+	return nil
+}
+
+// SetSessionMetadata implements ws_manager.Manager.
+func (fm *FakeManager) SetSessionMetadata(sessionKey string, md map[string]interface{}) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	s, err := fm.sessionLocked(sessionKey)
+	if err != nil {
+		return err
+	}
+	s.metadata = copyMetadata(md)
+	return nil
+}
+
+// GetSessionMetadata implements ws_manager.Manager.
+func (fm *FakeManager) GetSessionMetadata(sessionKey string) (map[string]interface{}, error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	s, err := fm.sessionLocked(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	return copyMetadata(s.metadata), nil
+}
+
+// Connect joins a fake client to the session. Client IDs are "1", "2" and
+// so on, like the manager's.
+func (fm *FakeManager) Connect(sessionKey string) (*FakeClient, error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	s, err := fm.sessionLocked(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	fm.lastID++
+	fc := &FakeClient{fm: fm, id: strconv.Itoa(fm.lastID), sessionKey: sessionKey}
+	s.clients = append(s.clients, fc)
+	return fc, nil
+}
+
+// Broadcasts returns the broadcasts recorded so far, oldest first.
+func (fm *FakeManager) Broadcasts() []Broadcast {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	return append([]Broadcast{}, fm.broadcasts...)
+}
+
+// Reset forgets the recorded broadcasts.
+func (fm *FakeManager) Reset() {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	fm.broadcasts = nil
+}
+
+func (fm *FakeManager) sessionLocked(sessionKey string) (*fakeSession, error) {
+	s, ok := fm.sessions[sessionKey]
+	if !ok {
+		return nil, errors.New(
+			fmt.Sprintf("Session %s not found", sessionKey),
+		)
+	}
+	return s, nil
+}
+
+func (fm *FakeManager) clientLocked(sessionKey, clientID string) (*FakeClient, error) {
+	s, err := fm.sessionLocked(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, fc := range s.clients {
+		if fc.id == clientID {
+			return fc, nil
+		}
+	}
+	return nil, errors.New(
+		fmt.Sprintf("Client %s not found in session %s", clientID, sessionKey),
+	)
+}
+
+func (fm *FakeManager) removeLocked(fc *FakeClient) {
+	s, ok := fm.sessions[fc.sessionKey]
+	if !ok {
+		return
+	}
+	for i, other := range s.clients {
+		if other == fc {
+			s.clients = append(s.clients[:i], s.clients[i+1:]...)
+			return
+		}
+	}
+}
+
+// FakeClient is a connection simulated by FakeManager.
+type FakeClient struct {
+	fm         *FakeManager
+	id         string
+	sessionKey string
+	received   []Frame
+	closed     bool
+	code       int
+	reason     string
+}
+
+// ID returns the client's ID.
+func (fc *FakeClient) ID() string {
+	return fc.id
+}
+
+// Send simulates the client sending a frame: like the manager's read loop,
+// the fake broadcasts it to the rest of the session.
+func (fc *FakeClient) Send(messageType int, data []byte) error {
+	fc.fm.mu.Lock()
+	closed := fc.closed
+	fc.fm.mu.Unlock()
+	if closed {
+		return errors.New(
+			fmt.Sprintf("Client %s is closed", fc.id),
+		)
+	}
+	return fc.fm.BroadcastMessage(fc.sessionKey, fc.id, messageType, data)
+}
+
+// Received returns the frames delivered to the client so far, oldest first.
+func (fc *FakeClient) Received() []Frame {
+	fc.fm.mu.Lock()
+	defer fc.fm.mu.Unlock()
+	return append([]Frame{}, fc.received...)
+}
+
+// Disconnect simulates the client leaving its session.
+func (fc *FakeClient) Disconnect() {
+	fc.fm.mu.Lock()
+	defer fc.fm.mu.Unlock()
+	fc.fm.removeLocked(fc)
+	fc.closeLocked(websocket.CloseNormalClosure, "")
+}
+
+// Closed reports whether the client was closed, and with which close code
+// and reason.
+func (fc *FakeClient) Closed() (closed bool, code int, reason string) {
+	fc.fm.mu.Lock()
+	defer fc.fm.mu.Unlock()
+	return fc.closed, fc.code, fc.reason
+}
+
+func (fc *FakeClient) deliverLocked(messageType int, data []byte) {
+	fc.received = append(fc.received, Frame{MessageType: messageType, Data: append([]byte{}, data...)})
+}
+
+func (fc *FakeClient) closeLocked(code int, reason string) {
+	if fc.closed {
+		return
+	}
+	fc.closed, fc.code, fc.reason = true, code, reason
+}
+
+func copyMetadata(md map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(md))
+	for k, v := range md {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,113 @@
+package testutil
+
+import (
+	"testing"
+
+	"github.com/chau-t-tran/ws-to-me/ws_manager"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+var _ ws_manager.Manager = (*FakeManager)(nil)
+
+type FakeTestSuite struct {
+	suite.Suite
+	manager *FakeManager
+}
+
+// announce stands in for application code written against the interface.
+func announce(m ws_manager.Manager, sessionKey, text string) error {
+	if n, err := m.ActiveConnections(sessionKey); err != nil || n == 0 {
+		return err
+	}
+	return m.BroadcastMessage(sessionKey, "", websocket.TextMessage, []byte(text))
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *FakeTestSuite) SetupTest() {
+	suite.manager = NewFakeManager("abcdefgh")
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *FakeTestSuite) TestRecordsBroadcasts() {
+	alice, err := suite.manager.Connect("abcdefgh")
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), announce(suite.manager, "abcdefgh", "hello"))
+
+	broadcasts := suite.manager.Broadcasts()
+	if assert.Len(suite.T(), broadcasts, 1) {
+		assert.Equal(suite.T(), "abcdefgh", broadcasts[0].SessionKey)
+		assert.Equal(suite.T(), "hello", string(broadcasts[0].Data))
+		assert.Equal(suite.T(), 1, broadcasts[0].Recipients)
+	}
+	assert.Equal(suite.T(), []Frame{{websocket.TextMessage, []byte("hello")}}, alice.Received())
+
+	suite.manager.Reset()
+	assert.Empty(suite.T(), suite.manager.Broadcasts())
+}
+
+func (suite *FakeTestSuite) TestClientsRelayToEachOther() {
+	alice, err := suite.manager.Connect("abcdefgh")
+	assert.NoError(suite.T(), err)
+	bob, err := suite.manager.Connect("abcdefgh")
+	assert.NoError(suite.T(), err)
+	assert.NotEqual(suite.T(), alice.ID(), bob.ID())
+
+	assert.NoError(suite.T(), alice.Send(websocket.BinaryMessage, []byte{1, 2}))
+	assert.Empty(suite.T(), alice.Received())
+	assert.Equal(suite.T(), []Frame{{websocket.BinaryMessage, []byte{1, 2}}}, bob.Received())
+	assert.Equal(suite.T(), alice.ID(), suite.manager.Broadcasts()[0].SenderID)
+
+	assert.NoError(suite.T(), suite.manager.SendToClient("abcdefgh", alice.ID(), websocket.TextMessage, []byte("direct")))
+	assert.Len(suite.T(), alice.Received(), 1)
+	assert.Len(suite.T(), bob.Received(), 1)
+}
+
+func (suite *FakeTestSuite) TestKickAndDisconnect() {
+	alice, _ := suite.manager.Connect("abcdefgh")
+	bob, _ := suite.manager.Connect("abcdefgh")
+
+	assert.NoError(suite.T(), suite.manager.KickClient("abcdefgh", alice.ID(), "spam"))
+	closed, code, reason := alice.Closed()
+	assert.True(suite.T(), closed)
+	assert.Equal(suite.T(), websocket.ClosePolicyViolation, code)
+	assert.Equal(suite.T(), "spam", reason)
+	assert.Error(suite.T(), alice.Send(websocket.TextMessage, []byte("late")))
+	assert.Error(suite.T(), suite.manager.KickClient("abcdefgh", alice.ID(), "again"))
+
+	bob.Disconnect()
+	n, err := suite.manager.ActiveConnections("abcdefgh")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, n)
+}
+
+func (suite *FakeTestSuite) TestSessions() {
+	key, err := suite.manager.CreateSession()
+	assert.NoError(suite.T(), err)
+	assert.Error(suite.T(), suite.manager.RegisterSession(key))
+	assert.NoError(suite.T(), suite.manager.RegisterSession("roomtwo"))
+	assert.Equal(suite.T(), []string{"abcdefgh", key, "roomtwo"}, suite.manager.ListSessions())
+
+	assert.NoError(suite.T(), suite.manager.SetSessionMetadata(key, map[string]interface{}{"title": "standup"}))
+	md, err := suite.manager.GetSessionMetadata(key)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "standup", md["title"])
+
+	alice, _ := suite.manager.Connect(key)
+	assert.NoError(suite.T(), suite.manager.RemoveSession(key))
+	closed, code, _ := alice.Closed()
+	assert.True(suite.T(), closed)
+	assert.Equal(suite.T(), websocket.CloseNormalClosure, code)
+	assert.Error(suite.T(), suite.manager.BroadcastMessage(key, "", websocket.TextMessage, []byte("gone")))
+	_, err = suite.manager.Connect(key)
+	assert.Error(suite.T(), err)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestFakeTestSuite(t *testing.T) {
+	suite.Run(t, new(FakeTestSuite))
+}
@@ -0,0 +1,138 @@
+// Package testutil contains helpers for testing code built on ws_manager.
+package testutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// SeqFunc extracts a sequence number from a received message.
+type SeqFunc func(message []byte) (uint64, error)
+
+// JSONSeq returns a SeqFunc reading an unsigned integer field from a JSON
+// object message, e.g. JSONSeq("seq") for {"seq":3,"data":"..."}.
+func JSONSeq(field string) SeqFunc {
+	return func(message []byte) (uint64, error) {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(message, &fields); err != nil {
+			return 0, err
+		}
+		raw, ok := fields[field]
+		if !ok {
+			return 0, errors.New(fmt.Sprintf("Field %s not found", field))
+		}
+		var seq uint64
+		err := json.Unmarshal(raw, &seq)
+		return seq, err
+	}
+}
+
+// OrderingChecker records the sequence numbers of messages received on a
+// connection and asserts on their order. It is safe for concurrent use.
+type OrderingChecker struct {
+	mu    sync.Mutex
+	seqOf SeqFunc
+	seqs  []uint64
+	errs  []error
+}
+
+// NewOrderingChecker returns a checker using seqOf to number messages. Feed
+// it with Record or Listen.
+func NewOrderingChecker(seqOf SeqFunc) *OrderingChecker {
+	return &OrderingChecker{seqOf: seqOf}
+}
+
+// Listen reads conn until it fails, recording every message. It is usually
+// run in its own goroutine.
+func (oc *OrderingChecker) Listen(conn *websocket.Conn) {
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		oc.Record(message)
+	}
+}
+
+// Record numbers a single message. Messages without a readable sequence
+// number are reported by the assertions.
+func (oc *OrderingChecker) Record(message []byte) {
+	seq, err := oc.seqOf(message)
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	if err != nil {
+		oc.errs = append(oc.errs, err)
+		return
+	}
+	oc.seqs = append(oc.seqs, seq)
+}
+
+// Sequences returns a copy of the sequence numbers recorded so far.
+func (oc *OrderingChecker) Sequences() []uint64 {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	return append([]uint64{}, oc.seqs...)
+}
+
+// WaitFor blocks until n messages have been recorded or timeout elapses and
+// reports whether n were reached.
+func (oc *OrderingChecker) WaitFor(n int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		oc.mu.Lock()
+		count := len(oc.seqs) + len(oc.errs)
+		oc.mu.Unlock()
+		if count >= n {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// AssertMonotonic fails t unless every recorded sequence number is greater
+// than the one before it.
+func (oc *OrderingChecker) AssertMonotonic(t testing.TB) bool {
+	t.Helper()
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	ok := oc.assertReadable(t)
+	for i := 1; i < len(oc.seqs); i++ {
+		if oc.seqs[i] <= oc.seqs[i-1] {
+			t.Errorf("sequence %d at position %d is not after %d", oc.seqs[i], i, oc.seqs[i-1])
+			ok = false
+		}
+	}
+	return ok
+}
+
+// AssertNoGaps fails t unless the recorded sequence numbers are consecutive.
+func (oc *OrderingChecker) AssertNoGaps(t testing.TB) bool {
+	t.Helper()
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	ok := oc.assertReadable(t)
+	for i := 1; i < len(oc.seqs); i++ {
+		if oc.seqs[i] != oc.seqs[i-1]+1 {
+			t.Errorf("expected sequence %d at position %d, got %d", oc.seqs[i-1]+1, i, oc.seqs[i])
+			ok = false
+		}
+	}
+	return ok
+}
+
+func (oc *OrderingChecker) assertReadable(t testing.TB) bool {
+	t.Helper()
+	for _, err := range oc.errs {
+		t.Errorf("unreadable sequence number: %s", err)
+	}
+	return len(oc.errs) == 0
+}
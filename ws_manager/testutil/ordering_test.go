@@ -0,0 +1,78 @@
+package testutil
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type OrderingTestSuite struct {
+	suite.Suite
+}
+
+// recordingT captures failures instead of failing the real test.
+type recordingT struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *OrderingTestSuite) TestOrderedSequencePasses() {
+	checker := NewOrderingChecker(JSONSeq("seq"))
+	for i := 1; i <= 3; i++ {
+		checker.Record([]byte(fmt.Sprintf(`{"seq":%d}`, i)))
+	}
+	assert.Equal(suite.T(), []uint64{1, 2, 3}, checker.Sequences())
+	assert.True(suite.T(), checker.AssertMonotonic(suite.T()))
+	assert.True(suite.T(), checker.AssertNoGaps(suite.T()))
+}
+
+func (suite *OrderingTestSuite) TestGapsAndReorderingFail() {
+	checker := NewOrderingChecker(JSONSeq("seq"))
+	for _, seq := range []int{1, 3, 2} {
+		checker.Record([]byte(fmt.Sprintf(`{"seq":%d}`, seq)))
+	}
+	t := &recordingT{}
+	assert.False(suite.T(), checker.AssertMonotonic(t))
+	assert.False(suite.T(), checker.AssertNoGaps(t))
+	assert.Len(suite.T(), t.failures, 3)
+}
+
+func (suite *OrderingTestSuite) TestUnreadableMessagesFail() {
+	checker := NewOrderingChecker(JSONSeq("seq"))
+	checker.Record([]byte("not json"))
+	t := &recordingT{}
+	assert.False(suite.T(), checker.AssertMonotonic(t))
+}
+
+func (suite *OrderingTestSuite) TestConcurrentRecord() {
+	checker := NewOrderingChecker(JSONSeq("seq"))
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(seq int) {
+			defer wg.Done()
+			checker.Record([]byte(fmt.Sprintf(`{"seq":%d}`, seq)))
+		}(i)
+	}
+	wg.Wait()
+	assert.True(suite.T(), checker.WaitFor(50, time.Second))
+	assert.Len(suite.T(), checker.Sequences(), 50)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestOrderingTestSuite(t *testing.T) {
+	suite.Run(t, new(OrderingTestSuite))
+}
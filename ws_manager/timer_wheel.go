@@ -0,0 +1,138 @@
+package ws_manager
+
+import (
+	"sync"
+	"time"
+)
+
+// wheelSlots is the number of slots of a timerWheel; with the default
+// resolution one turn of the wheel is a little over five seconds.
+const wheelSlots = 512
+
+// defaultScheduleResolution is the tick of the timer wheel unless
+// WithScheduleResolution says otherwise.
+const defaultScheduleResolution = 10 * time.Millisecond
+
+// WithScheduleResolution sets how often the timer wheel behind
+// ScheduleBroadcast, BroadcastAt and BroadcastAfter ticks, 10ms by default.
+// Scheduled broadcasts fire up to one resolution late, never early.
+func WithScheduleResolution(resolution time.Duration) Option {
+	return func(sm *SessionManager) {
+		sm.scheduleResolution = resolution
+	}
+}
+
+// timerWheel is a hashed timing wheel: every entry sits in the slot of the
+// tick it is due at, and rounds counts the full turns of the wheel left
+// before then. A single goroutine advances the wheel, and only while
+// entries are pending.
+type timerWheel struct {
+	mu      sync.Mutex
+	tick    time.Duration
+	slots   [wheelSlots][]*wheelEntry
+	pos     int
+	pending int
+	running bool
+	// fire is called, outside mu, with each entry that is due
+	fire func(*wheelEntry)
+}
+
+type wheelEntry struct {
+	at     time.Time
+	rounds int
+	// live is unset once the entry has fired or been removed
+	live bool
+	// broadcast is the scheduled broadcast the entry fires
+	broadcast *scheduledBroadcast
+}
+
+func newTimerWheel(tick time.Duration, fire func(*wheelEntry)) *timerWheel {
+	if tick <= 0 {
+		tick = defaultScheduleResolution
+	}
+	return &timerWheel{tick: tick, fire: fire}
+}
+
+// add schedules entry for entry.at.
+func (w *timerWheel) add(entry *wheelEntry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	entry.live = true
+	w.pending++
+	w.placeLocked(entry)
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+}
+
+// placeLocked puts entry in the slot it is due at. The caller must hold mu.
+func (w *timerWheel) placeLocked(entry *wheelEntry) {
+	ticks := int((time.Until(entry.at) + w.tick - 1) / w.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+	entry.rounds = (ticks - 1) / wheelSlots
+	slot := (w.pos + ticks) % wheelSlots
+	w.slots[slot] = append(w.slots[slot], entry)
+}
+
+// remove takes entry off the wheel, reporting whether it was still
+// pending. The entry stays in its slot until the wheel next reaches it.
+func (w *timerWheel) remove(entry *wheelEntry) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !entry.live {
+		return false
+	}
+	entry.live = false
+	w.pending--
+	return true
+}
+
+// run advances the wheel every tick until no entries are pending.
+func (w *timerWheel) run() {
+	ticker := time.NewTicker(w.tick)
+	defer ticker.Stop()
+	for range ticker.C {
+		due, more := w.advance()
+		for _, entry := range due {
+			w.fire(entry)
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+// advance moves the wheel on by one tick and returns the entries that are
+// due. more is unset, and the wheel stopped, once nothing is pending.
+func (w *timerWheel) advance() (due []*wheelEntry, more bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pos = (w.pos + 1) % wheelSlots
+	entries := w.slots[w.pos]
+	w.slots[w.pos] = nil
+	now := time.Now()
+	for _, entry := range entries {
+		switch {
+		case !entry.live:
+		case entry.rounds > 0:
+			entry.rounds--
+			w.slots[w.pos] = append(w.slots[w.pos], entry)
+		case now.Before(entry.at):
+			// the ticker's phase put the entry a fraction of a tick early
+			w.placeLocked(entry)
+		default:
+			entry.live = false
+			w.pending--
+			due = append(due, entry)
+		}
+	}
+	if w.pending == 0 {
+		w.running = false
+		w.slots = [wheelSlots][]*wheelEntry{}
+		return due, false
+	}
+	return due, true
+}
@@ -0,0 +1,13 @@
+package ws_manager
+
+// BroadcastToTopic sends data to the connections of the session subscribed
+// to topic, plus the connections without a topic, which receive everything.
+// Connections pick their topic with the "topic" query parameter on connect,
+// and messages they send are scoped to it.
+func (sm *SessionManager) BroadcastToTopic(sessionKey, topic string, senderID string, messageType int, data []byte) error {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	return sm.broadcastLocked(sessionKey, senderID, messageType, data, func(cl *client) bool {
+		return cl.topic == "" || cl.topic == topic
+	})
+}
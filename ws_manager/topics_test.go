@@ -0,0 +1,93 @@
+package ws_manager
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TopicsTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *TopicsTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey})
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *TopicsTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *TopicsTestSuite) TestTopicBroadcastReachesSubscribersAndUnscoped() {
+	chat, err := dialSession(suite.server, suite.sessionKey, "topic=chat")
+	assert.NoError(suite.T(), err)
+	cursors, err := dialSession(suite.server, suite.sessionKey, "topic=cursors")
+	assert.NoError(suite.T(), err)
+	everything, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 3))
+
+	err = suite.manager.BroadcastToTopic(suite.sessionKey, "chat", "", websocket.TextMessage, []byte("hi chat"))
+	assert.NoError(suite.T(), err)
+
+	message, err := readWithTimeout(chat, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "hi chat", message)
+	message, err = readWithTimeout(everything, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "hi chat", message)
+	_, err = readWithTimeout(cursors, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *TopicsTestSuite) TestClientMessagesAreScopedToTheirTopic() {
+	sender, err := dialSession(suite.server, suite.sessionKey, "topic=chat")
+	assert.NoError(suite.T(), err)
+	chat, err := dialSession(suite.server, suite.sessionKey, "topic=chat")
+	assert.NoError(suite.T(), err)
+	cursors, err := dialSession(suite.server, suite.sessionKey, "topic=cursors")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 3))
+
+	sender.WriteMessage(websocket.TextMessage, []byte("hello"))
+
+	message, err := readWithTimeout(chat, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "hello", message)
+	_, err = readWithTimeout(cursors, 200*time.Millisecond)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *TopicsTestSuite) TestSessionBroadcastReachesEveryTopic() {
+	chat, err := dialSession(suite.server, suite.sessionKey, "topic=chat")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("to all")))
+	message, err := readWithTimeout(chat, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "to all", message)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestTopicsTestSuite(t *testing.T) {
+	suite.Run(t, new(TopicsTestSuite))
+}
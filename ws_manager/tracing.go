@@ -0,0 +1,111 @@
+package ws_manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+// Tracer starts the spans the manager records for connections, inbound
+// messages and broadcasts. It is shaped after OpenTelemetry's tracer so an
+// adapter stays thin: attributes are alternating key/value pairs, e.g.
+//
+//	tracer.Start(ctx, "ws.broadcast", "session", sessionKey, "recipients", 12)
+//
+// Spans are named "ws.connection", "ws.message" and "ws.broadcast". A
+// connection span starts from the upgrade request's context, so it joins
+// the trace of an instrumented HTTP server; message spans are its children,
+// and broadcasts sent by a connection are children of the message being
+// relayed. Broadcast spans are started and ended under the manager lock.
+type Tracer interface {
+	Start(ctx context.Context, name string, keysAndValues ...interface{}) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	SetAttributes(keysAndValues ...interface{})
+	RecordError(err error)
+	End()
+}
+
+// WithTracer records spans with tracer. Without one nothing is traced.
+func WithTracer(tracer Tracer) Option {
+	return func(sm *SessionManager) {
+		sm.tracer = tracer
+	}
+}
+
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, _ string, _ ...interface{}) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(...interface{}) {}
+func (nopSpan) RecordError(error)            {}
+func (nopSpan) End()                         {}
+
+// ClientContext returns the context of a connection: the span of the
+// message it is sending, or of the connection itself between messages.
+// Hooks that run outside the manager lock use it to attach their own spans
+// to the connection's trace.
+func (sm *SessionManager) ClientContext(sessionKey string, clientID string) (context.Context, error) {
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	cl, err := sm.findClient(sessionKey, clientID)
+	if err != nil {
+		return nil, err
+	}
+	return cl.context(), nil
+}
+
+// spanContext boxes a context for atomic.Value, which needs one concrete
+// type.
+type spanContext struct {
+	ctx context.Context
+}
+
+func (cl *client) context() context.Context {
+	if sc, ok := cl.spanCtx.Load().(spanContext); ok {
+		return sc.ctx
+	}
+	return context.Background()
+}
+
+func (cl *client) setContext(ctx context.Context) {
+	cl.spanCtx.Store(spanContext{ctx})
+}
+
+// endConnectionSpan ends the span of a connection that ended with err.
+func endConnectionSpan(span Span, err error) {
+	if err != nil && websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// startBroadcastSpanLocked starts the span of a broadcast from senderID to
+// recipients. The caller must hold sessionManagerMu.
+func (sm *SessionManager) startBroadcastSpanLocked(s *session, senderID string, recipients int) Span {
+	ctx := context.Background()
+	if sender := s.client(senderID); sender != nil {
+		ctx = sender.context()
+	}
+	_, span := sm.tracer.Start(ctx, "ws.broadcast", "session", s.key, "sender", senderID, "recipients", recipients)
+	return span
+}
+
+// endBroadcastSpan ends span with the outcome of the broadcast.
+func endBroadcastSpan(span Span, delivered int, errs []error) {
+	span.SetAttributes("delivered", delivered, "failures", len(errs))
+	if len(errs) > 0 {
+		span.RecordError(errors.New(
+			fmt.Sprintf("%d writes failed: %v", len(errs), errs[0]),
+		))
+	}
+	span.End()
+}
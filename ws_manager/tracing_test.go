@@ -0,0 +1,172 @@
+package ws_manager
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type parentKey struct{}
+
+type recordedSpan struct {
+	name   string
+	parent *recordedSpan
+	attrs  map[string]interface{}
+	errs   []error
+	ended  bool
+	tracer *recordingTracer
+}
+
+func (s *recordedSpan) SetAttributes(keysAndValues ...interface{}) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		s.attrs[keysAndValues[i].(string)] = keysAndValues[i+1]
+	}
+}
+
+func (s *recordedSpan) RecordError(err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.errs = append(s.errs, err)
+}
+
+func (s *recordedSpan) End() {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.ended = true
+}
+
+// recordingTracer keeps every span it starts, linked to the span found in
+// the parent context.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, keysAndValues ...interface{}) (context.Context, Span) {
+	parent, _ := ctx.Value(parentKey{}).(*recordedSpan)
+	span := &recordedSpan{name: name, parent: parent, attrs: map[string]interface{}{}, tracer: t}
+	span.SetAttributes(keysAndValues...)
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return context.WithValue(ctx, parentKey{}, span), span
+}
+
+func (t *recordingTracer) named(name string) []*recordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spans := []*recordedSpan{}
+	for _, span := range t.spans {
+		if span.name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+type TracingTestSuite struct {
+	suite.Suite
+	sessionKey string
+	tracer     *recordingTracer
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *TracingTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.tracer = &recordingTracer{}
+	suite.manager = CreateSessionManager(
+		[]string{suite.sessionKey},
+		WithTracer(suite.tracer),
+	)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *TracingTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *TracingTestSuite) TestBroadcastSpansNestUnderTheMessage() {
+	var middlewareSpan *recordedSpan
+	suite.manager.Use(func(ctx *MessageContext) error {
+		middlewareSpan, _ = ctx.Context.Value(parentKey{}).(*recordedSpan)
+		return nil
+	})
+	sender, senderID, err := dialSessionWithID(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	ctx, err := suite.manager.ClientContext(suite.sessionKey, senderID)
+	assert.NoError(suite.T(), err)
+	connSpan, _ := ctx.Value(parentKey{}).(*recordedSpan)
+	if assert.NotNil(suite.T(), connSpan) {
+		assert.Equal(suite.T(), "ws.connection", connSpan.name)
+		assert.Equal(suite.T(), senderID, connSpan.attrs["client"])
+	}
+
+	assert.NoError(suite.T(), sender.WriteMessage(websocket.TextMessage, []byte("hello")))
+	_, err = readWithTimeout(receiver, time.Second)
+	assert.NoError(suite.T(), err)
+
+	messages := suite.tracer.named("ws.message")
+	broadcasts := suite.tracer.named("ws.broadcast")
+	if assert.Len(suite.T(), messages, 1) && assert.Len(suite.T(), broadcasts, 1) {
+		assert.Equal(suite.T(), connSpan, messages[0].parent)
+		assert.Equal(suite.T(), messages[0], middlewareSpan)
+		assert.Equal(suite.T(), messages[0], broadcasts[0].parent)
+		assert.Equal(suite.T(), suite.sessionKey, broadcasts[0].attrs["session"])
+		assert.Equal(suite.T(), 1, broadcasts[0].attrs["recipients"])
+	}
+
+	sender.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	time.Sleep(50 * time.Millisecond)
+	suite.tracer.mu.Lock()
+	defer suite.tracer.mu.Unlock()
+	if assert.Len(suite.T(), broadcasts, 1) {
+		assert.Equal(suite.T(), 1, broadcasts[0].attrs["delivered"])
+		assert.True(suite.T(), broadcasts[0].ended)
+	}
+	assert.True(suite.T(), connSpan.ended)
+}
+
+func (suite *TracingTestSuite) TestServerBroadcastHasNoParent() {
+	conn, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("notice")))
+	_, err = readWithTimeout(conn, time.Second)
+	assert.NoError(suite.T(), err)
+	broadcasts := suite.tracer.named("ws.broadcast")
+	if assert.Len(suite.T(), broadcasts, 1) {
+		assert.Nil(suite.T(), broadcasts[0].parent)
+	}
+
+	_, err = suite.manager.ClientContext(suite.sessionKey, "missing")
+	assert.Error(suite.T(), err)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestTracingTestSuite(t *testing.T) {
+	suite.Run(t, new(TracingTestSuite))
+}
@@ -0,0 +1,37 @@
+package ws_manager
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WithBufferSizes sizes the read and write buffers every connection is
+// upgraded with, 1KB each by default. Larger buffers mean fewer syscalls
+// per frame, smaller ones less memory per socket. Zero reuses the 4KB
+// buffers net/http allocated for the handshake. The sizes do not limit the
+// size of messages.
+func WithBufferSizes(readBufferSize, writeBufferSize int) Option {
+	return func(sm *SessionManager) {
+		sm.upgrader.ReadBufferSize = readBufferSize
+		sm.upgrader.WriteBufferSize = writeBufferSize
+	}
+}
+
+// WithHandshakeTimeout fails upgrades that have not completed within
+// timeout. Zero, the default, waits indefinitely.
+func WithHandshakeTimeout(timeout time.Duration) Option {
+	return func(sm *SessionManager) {
+		sm.upgrader.HandshakeTimeout = timeout
+	}
+}
+
+// WithWriteBufferPool makes connections borrow their write buffer from pool
+// for each frame instead of holding one for their lifetime, which saves
+// memory when most connections are idle. The buffers take the size set by
+// WithBufferSizes.
+func WithWriteBufferPool(pool websocket.BufferPool) Option {
+	return func(sm *SessionManager) {
+		sm.upgrader.WriteBufferPool = pool
+	}
+}
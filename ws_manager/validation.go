@@ -0,0 +1,70 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// EnvelopeValidator checks an inbound protocol mode envelope. A non-nil
+// error rejects it, and its text is sent back to the sender as the reason.
+type EnvelopeValidator func(env Envelope) error
+
+// WithEnvelopeValidator makes protocol mode check inbound envelopes of
+// envelopeType with validate before they are handled or broadcast, see
+// ValidateEnvelope.
+func WithEnvelopeValidator(envelopeType string, validate EnvelopeValidator) Option {
+	return func(sm *SessionManager) {
+		if sm.envelopeValidators == nil {
+			sm.envelopeValidators = map[string]EnvelopeValidator{}
+		}
+		sm.envelopeValidators[envelopeType] = validate
+	}
+}
+
+// ValidateEnvelope registers validate for inbound envelopes of
+// envelopeType on a running manager. An envelope it rejects is neither
+// passed to its handler nor broadcast, and the sender is told:
+//
+//	{"type":"error","sender":"","sessionKey":"abcdefgh","timestamp":1700000000000,"payload":{"error":"invalid message","messageType":"chat","reason":"payload.text is required"}}
+//
+// See JSONSchema for validating payloads against a schema. A later
+// registration for the same type replaces the earlier one. Validators are
+// skipped under WithEndToEndEncryption, whose payloads are ciphertext.
+func (sm *SessionManager) ValidateEnvelope(envelopeType string, validate EnvelopeValidator) {
+	sm.policyMu.Lock()
+	defer sm.policyMu.Unlock()
+	if sm.envelopeValidators == nil {
+		sm.envelopeValidators = map[string]EnvelopeValidator{}
+	}
+	sm.envelopeValidators[envelopeType] = validate
+}
+
+type validationError struct {
+	Error       string `json:"error"`
+	MessageType string `json:"messageType"`
+	Reason      string `json:"reason"`
+}
+
+// rejectInvalid tells cl that its envelope of envelopeType was dropped
+// because of reason.
+func (sm *SessionManager) rejectInvalid(sessionKey string, cl *client, envelopeType string, reason error) {
+	sm.logger.Debug("Invalid envelope dropped", "session", sessionKey, "client", cl.id, "type", envelopeType, "err", reason)
+	payload, err := json.Marshal(validationError{Error: "invalid message", MessageType: envelopeType, Reason: reason.Error()})
+	if err != nil {
+		return
+	}
+	frame, err := json.Marshal(Envelope{
+		Type:       "error",
+		SessionKey: sessionKey,
+		Timestamp:  time.Now().UnixNano() / int64(time.Millisecond),
+		Payload:    payload,
+	})
+	if err != nil {
+		return
+	}
+	if err := cl.write(websocket.TextMessage, frame); err != nil {
+		sm.logger.Warn("Validation notice failed", "session", sessionKey, "client", cl.id, "err", err)
+	}
+}
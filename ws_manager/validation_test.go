@@ -0,0 +1,114 @@
+package ws_manager
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ValidationTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *ValidationTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithProtocolMode(true))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *ValidationTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.cronScheduler.Stop()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *ValidationTestSuite) TestJSONSchema() {
+	validate, err := JSONSchema([]byte(`{
+		"type": "object",
+		"required": ["text"],
+		"additionalProperties": false,
+		"properties": {
+			"text": {"type": "string", "minLength": 1, "maxLength": 5},
+			"mood": {"enum": ["happy", "sad"]},
+			"count": {"type": "integer", "minimum": 0},
+			"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}}
+		}
+	}`))
+	assert.NoError(suite.T(), err)
+	cases := map[string]string{
+		`{"text":"hi","mood":"happy","count":3,"tags":["a"]}`: "",
+		`{"mood":"happy"}`:                   "payload.text is required",
+		`{"text":""}`:                        "payload.text must be at least 1 characters",
+		`{"text":"toolong"}`:                 "payload.text must be at most 5 characters",
+		`{"text":"hi","mood":"angry"}`:       "payload.mood must be one of the allowed values",
+		`{"text":"hi","count":1.5}`:          "payload.count must be integer",
+		`{"text":"hi","count":-1}`:           "payload.count must be at least 0",
+		`{"text":"hi","tags":[1]}`:           "payload.tags[0] must be string",
+		`{"text":"hi","tags":["a","b","c"]}`: "payload.tags must have at most 2 items",
+		`{"text":"hi","extra":true}`:         "payload.extra is not allowed",
+		`"hi"`:                               "payload must be object",
+	}
+	for payload, want := range cases {
+		err := validate(Envelope{Type: "chat", Payload: json.RawMessage(payload)})
+		if want == "" {
+			assert.NoError(suite.T(), err, payload)
+		} else if assert.Error(suite.T(), err, payload) {
+			assert.Equal(suite.T(), want, err.Error(), payload)
+		}
+	}
+	assert.EqualError(suite.T(), validate(Envelope{Type: "chat"}), "payload must be object")
+
+	_, err = JSONSchema([]byte(`{"type":`))
+	assert.Error(suite.T(), err)
+}
+
+func (suite *ValidationTestSuite) TestInvalidEnvelopeIsRejected() {
+	suite.manager.ValidateEnvelope("chat", func(env Envelope) error {
+		if string(env.Payload) == `"spam"` {
+			return errors.New("no spam")
+		}
+		return nil
+	})
+	sender, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer sender.Close()
+	receiver, err := dialSession(suite.server, suite.sessionKey, "")
+	assert.NoError(suite.T(), err)
+	defer receiver.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	sender.WriteMessage(websocket.TextMessage, []byte(`{"type":"chat","payload":"spam"}`))
+	message, err := readWithTimeout(sender, time.Second)
+	assert.NoError(suite.T(), err)
+	var env Envelope
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &env))
+	assert.Equal(suite.T(), "error", env.Type)
+	assert.JSONEq(suite.T(), `{"error":"invalid message","messageType":"chat","reason":"no spam"}`, string(env.Payload))
+
+	sender.WriteMessage(websocket.TextMessage, []byte(`{"type":"chat","payload":"hello"}`))
+	message, err = readWithTimeout(receiver, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), json.Unmarshal([]byte(message), &env))
+	assert.JSONEq(suite.T(), `"hello"`, string(env.Payload))
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestValidationTestSuite(t *testing.T) {
+	suite.Run(t, new(ValidationTestSuite))
+}
@@ -0,0 +1,250 @@
+package ws_manager
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Session lifecycle events posted by WithWebhooks.
+const (
+	// WebhookSessionCreated is posted when a session is registered,
+	// created or auto-registered.
+	WebhookSessionCreated = "session.created"
+	// WebhookSessionEmpty is posted when the last connection leaves a
+	// session.
+	WebhookSessionEmpty = "session.empty"
+	// WebhookSessionEvicted is posted when garbage collection removes a
+	// session.
+	WebhookSessionEvicted = "session.evicted"
+	// WebhookClientThreshold is posted when a session's connection count
+	// reaches one of WebhookConfig.Thresholds, or drops back below it.
+	WebhookClientThreshold = "session.clients"
+)
+
+// WebhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the
+// body, keyed with WebhookConfig.Secret.
+const WebhookSignatureHeader = "X-Webhook-Signature"
+
+const (
+	defaultWebhookRetries       = 3
+	defaultWebhookRetryInterval = time.Second
+	defaultWebhookTimeout       = 10 * time.Second
+	webhookQueueSize            = 1024
+)
+
+// WebhookEvent is the JSON body of a webhook:
+//
+//	{"event":"session.clients","sessionKey":"abcdefgh","timestamp":1700000000000,"clients":10,"threshold":10,"direction":"up"}
+type WebhookEvent struct {
+	Event      string `json:"event"`
+	SessionKey string `json:"sessionKey"`
+	// Timestamp is in Unix milliseconds.
+	Timestamp int64 `json:"timestamp"`
+	// Clients is the session's connection count after the event.
+	Clients int `json:"clients"`
+	// Threshold and Direction, "up" or "down", are set for
+	// WebhookClientThreshold.
+	Threshold int    `json:"threshold,omitempty"`
+	Direction string `json:"direction,omitempty"`
+}
+
+// WebhookConfig configures WithWebhooks.
+type WebhookConfig struct {
+	// URLs receive every event as a POST.
+	URLs []string
+	// Secret signs bodies in WebhookSignatureHeader; empty sends no
+	// signature.
+	Secret string
+	// Thresholds are the connection counts that trigger
+	// WebhookClientThreshold.
+	Thresholds []int
+	// MaxRetries is how often a failed POST is retried, 3 by default;
+	// negative never retries. RetryInterval is the delay before the first
+	// retry, 1s by default; it doubles after each one.
+	MaxRetries    int
+	RetryInterval time.Duration
+	// Client sends the POSTs; by default a client giving up on a POST
+	// after 10s. A POST still in flight is cancelled when the manager
+	// shuts down.
+	Client *http.Client
+}
+
+// WithWebhooks POSTs session lifecycle events to the configured URLs, so
+// external services such as billing or analytics can react without
+// polling. Events are queued and sent in order from a single goroutine, so
+// they never hold up sessions; a POST answered with anything but a 2xx is
+// retried, and events are dropped if the queue overflows or the manager
+// shuts down.
+func WithWebhooks(cfg WebhookConfig) Option {
+	return func(sm *SessionManager) {
+		switch {
+		case cfg.MaxRetries == 0:
+			cfg.MaxRetries = defaultWebhookRetries
+		case cfg.MaxRetries < 0:
+			cfg.MaxRetries = 0
+		}
+		if cfg.RetryInterval <= 0 {
+			cfg.RetryInterval = defaultWebhookRetryInterval
+		}
+		if cfg.Client == nil {
+			cfg.Client = &http.Client{Timeout: defaultWebhookTimeout}
+		}
+		sm.webhooks = &cfg
+	}
+}
+
+// SessionEventFunc is called with a session lifecycle event, see
+// OnSessionEvent.
+type SessionEventFunc func(event WebhookEvent)
+
+// OnSessionEvent registers fn to be called in-process with every session
+// lifecycle event but WebhookClientThreshold, whether or not webhooks are
+// configured. It runs under the manager lock and must not call back into
+// the manager; hand the event off instead, e.g. on a buffered channel.
+// Events of different sessions may be passed to it concurrently.
+func (sm *SessionManager) OnSessionEvent(fn SessionEventFunc) {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	sm.sessionEventHooks = append(sm.sessionEventHooks, fn)
+}
+
+// webhookLocked passes event for s to the session event hooks and queues
+// it for the webhooks and the audit sink. The caller must hold sessionManagerMu.
+func (sm *SessionManager) webhookLocked(event string, s *session) {
+	sm.recordAudit(AuditEvent{Event: event, SessionKey: s.key})
+	if sm.webhooks == nil && len(sm.sessionEventHooks) == 0 {
+		return
+	}
+	e := WebhookEvent{
+		Event:      event,
+		SessionKey: s.key,
+		Timestamp:  time.Now().UnixNano() / int64(time.Millisecond),
+		Clients:    len(s.clients),
+	}
+	for _, hook := range sm.sessionEventHooks {
+		hook(e)
+	}
+	if sm.webhooks != nil {
+		sm.queueWebhook(e)
+	}
+}
+
+// thresholdWebhooksLocked queues the threshold events for s after its
+// connection count changed from before. The caller must hold
+// sessionManagerMu.
+func (sm *SessionManager) thresholdWebhooksLocked(s *session, before int) {
+	if sm.webhooks == nil {
+		return
+	}
+	after := len(s.clients)
+	for _, threshold := range sm.webhooks.Thresholds {
+		direction := ""
+		switch {
+		case before < threshold && after >= threshold:
+			direction = "up"
+		case before >= threshold && after < threshold:
+			direction = "down"
+		default:
+			continue
+		}
+		sm.queueWebhook(WebhookEvent{
+			Event:      WebhookClientThreshold,
+			SessionKey: s.key,
+			Timestamp:  time.Now().UnixNano() / int64(time.Millisecond),
+			Clients:    after,
+			Threshold:  threshold,
+			Direction:  direction,
+		})
+	}
+}
+
+func (sm *SessionManager) queueWebhook(event WebhookEvent) {
+	select {
+	case sm.webhookQueue <- event:
+	default:
+		sm.logger.Warn("Webhook queue full, event dropped", "event", event.Event, "session", event.SessionKey)
+	}
+}
+
+// deliverWebhooks posts queued events until the manager shuts down.
+func (sm *SessionManager) deliverWebhooks() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-sm.done
+		cancel()
+	}()
+	for {
+		select {
+		case event := <-sm.webhookQueue:
+			body, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			for _, url := range sm.webhooks.URLs {
+				sm.postWebhook(ctx, url, event, body)
+			}
+		case <-sm.done:
+			return
+		}
+	}
+}
+
+// postWebhook sends body to url, retrying with backoff until ctx ends.
+func (sm *SessionManager) postWebhook(ctx context.Context, url string, event WebhookEvent, body []byte) {
+	delay := sm.webhooks.RetryInterval
+	for attempt := 0; ; attempt++ {
+		err := sm.sendWebhook(ctx, url, body)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		if attempt >= sm.webhooks.MaxRetries {
+			sm.logger.Warn("Webhook failed", "url", url, "event", event.Event, "session", event.SessionKey, "err", err)
+			return
+		}
+		select {
+		case <-time.After(delay):
+		case <-sm.done:
+			return
+		}
+		delay *= 2
+	}
+}
+
+func (sm *SessionManager) sendWebhook(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sm.webhooks.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(sm.webhooks.Secret, body))
+	}
+	resp, err := sm.webhooks.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(
+			fmt.Sprintf("Webhook answered %d", resp.StatusCode),
+		)
+	}
+	return nil
+}
+
+// SignWebhook returns the WebhookSignatureHeader value for body, for
+// receivers verifying a webhook with hmac.Equal.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
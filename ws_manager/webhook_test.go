@@ -0,0 +1,220 @@
+package ws_manager
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type WebhookTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *SessionManager
+	server     *httptest.Server
+	hook       *httptest.Server
+
+	mu       sync.Mutex
+	events   []WebhookEvent
+	failNext int
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *WebhookTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+	suite.events = nil
+	suite.failNext = 0
+	suite.hook = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		suite.mu.Lock()
+		defer suite.mu.Unlock()
+		if suite.failNext > 0 {
+			suite.failNext--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.Header.Get(WebhookSignatureHeader) != SignWebhook("s3cret", body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event WebhookEvent
+		if err := json.Unmarshal(body, &event); err == nil {
+			suite.events = append(suite.events, event)
+		}
+	}))
+	suite.manager = CreateSessionManager([]string{suite.sessionKey}, WithWebhooks(WebhookConfig{
+		URLs:          []string{suite.hook.URL},
+		Secret:        "s3cret",
+		Thresholds:    []int{2},
+		RetryInterval: 10 * time.Millisecond,
+	}))
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+}
+
+func (suite *WebhookTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.manager.Shutdown(context.Background())
+	suite.hook.Close()
+}
+
+// waitForEvents polls until n events have been received.
+func (suite *WebhookTestSuite) waitForEvents(n int) []WebhookEvent {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		suite.mu.Lock()
+		events := append([]WebhookEvent{}, suite.events...)
+		suite.mu.Unlock()
+		if len(events) >= n || time.Now().After(deadline) {
+			return events
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *WebhookTestSuite) TestSessionLifecycle() {
+	assert.NoError(suite.T(), suite.manager.RegisterSession("roomone"))
+	first, err := dialSession(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	second, err := dialSession(suite.server, "roomone", "")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 2))
+	first.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 1))
+	second.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, "roomone", 0))
+
+	events := suite.waitForEvents(4)
+	names := []string{}
+	for _, event := range events {
+		assert.Equal(suite.T(), "roomone", event.SessionKey)
+		assert.NotZero(suite.T(), event.Timestamp)
+		names = append(names, event.Event+":"+event.Direction)
+	}
+	assert.Equal(suite.T(), []string{
+		WebhookSessionCreated + ":",
+		WebhookClientThreshold + ":up",
+		WebhookClientThreshold + ":down",
+		WebhookSessionEmpty + ":",
+	}, names)
+	if len(events) == 4 {
+		assert.Equal(suite.T(), 2, events[1].Clients)
+		assert.Equal(suite.T(), 2, events[1].Threshold)
+		assert.Equal(suite.T(), 1, events[2].Clients)
+	}
+}
+
+func (suite *WebhookTestSuite) TestEvictionIsPosted() {
+	suite.manager.GarbageCollectDaily()
+	suite.manager.GarbageCollectDaily()
+	events := suite.waitForEvents(1)
+	if assert.Len(suite.T(), events, 1) {
+		assert.Equal(suite.T(), WebhookSessionEvicted, events[0].Event)
+		assert.Equal(suite.T(), suite.sessionKey, events[0].SessionKey)
+	}
+}
+
+func (suite *WebhookTestSuite) TestSessionEventsWithoutWebhooks() {
+	sm := CreateSessionManager([]string{})
+	defer sm.Shutdown(context.Background())
+	events := make(chan WebhookEvent, 4)
+	sm.OnSessionEvent(func(event WebhookEvent) {
+		events <- event
+	})
+	assert.NoError(suite.T(), sm.RegisterSession("roomone"))
+	sm.GarbageCollectDaily()
+	sm.GarbageCollectDaily()
+	for _, name := range []string{WebhookSessionCreated, WebhookSessionEvicted} {
+		select {
+		case event := <-events:
+			assert.Equal(suite.T(), name, event.Event)
+			assert.Equal(suite.T(), "roomone", event.SessionKey)
+		case <-time.After(time.Second):
+			suite.T().Fatal("no session event for " + name)
+		}
+	}
+}
+
+func (suite *WebhookTestSuite) TestFailedPostsAreRetried() {
+	suite.mu.Lock()
+	suite.failNext = 2
+	suite.mu.Unlock()
+	key, err := suite.manager.CreateSession()
+	assert.NoError(suite.T(), err)
+
+	events := suite.waitForEvents(1)
+	if assert.Len(suite.T(), events, 1) {
+		assert.Equal(suite.T(), WebhookSessionCreated, events[0].Event)
+		assert.Equal(suite.T(), key, events[0].SessionKey)
+	}
+}
+
+func (suite *WebhookTestSuite) TestNegativeMaxRetriesNeverRetries() {
+	manager := CreateSessionManager(nil, WithWebhooks(WebhookConfig{
+		URLs:          []string{suite.hook.URL},
+		Secret:        "s3cret",
+		MaxRetries:    -1,
+		RetryInterval: 10 * time.Millisecond,
+	}))
+	defer manager.Shutdown(context.Background())
+	assert.Equal(suite.T(), defaultWebhookTimeout, manager.webhooks.Client.Timeout)
+
+	suite.mu.Lock()
+	suite.failNext = 1
+	suite.mu.Unlock()
+	_, err := manager.CreateSession()
+	assert.NoError(suite.T(), err)
+	key, err := manager.CreateSession()
+	assert.NoError(suite.T(), err)
+
+	suite.waitForEvents(1)
+	// long enough for a retry of the failed post to land
+	time.Sleep(50 * time.Millisecond)
+	suite.mu.Lock()
+	events := append([]WebhookEvent{}, suite.events...)
+	suite.mu.Unlock()
+	if assert.Len(suite.T(), events, 1) {
+		assert.Equal(suite.T(), key, events[0].SessionKey)
+	}
+}
+
+func (suite *WebhookTestSuite) TestShutdownCancelsPost() {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		close(started)
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	defer hook.Close()
+	manager := CreateSessionManager(nil, WithWebhooks(WebhookConfig{URLs: []string{hook.URL}}))
+	_, err := manager.CreateSession()
+	assert.NoError(suite.T(), err)
+
+	<-started
+	assert.NoError(suite.T(), manager.Shutdown(context.Background()))
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		suite.T().Fatal("post outlived the manager")
+	}
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestWebhookTestSuite(t *testing.T) {
+	suite.Run(t, new(WebhookTestSuite))
+}
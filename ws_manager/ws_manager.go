@@ -1,10 +1,11 @@
 package ws_manager
 
 import (
-	"errors"
-	"fmt"
+	"context"
+	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-co-op/gocron"
@@ -21,34 +22,530 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin:     CheckOrigin,
 }
 
+type client struct {
+	id       string
+	conn     *websocket.Conn
+	addr     string
+	identity string
+	name     string
+	role     string
+	topic    string
+	stream   string
+	tags     map[string]struct{}
+	blocked  map[string]struct{}
+	metadata map[string]interface{}
+	channels map[string]struct{}
+	active   int32
+	// lastActive is the time of the last message in either direction, in
+	// Unix nanoseconds
+	lastActive int64
+	joinedAt   time.Time
+	limiter    *rateLimiter
+	// addrLimiter is shared with the connections from the same address,
+	// see WithAddressRateLimit
+	addrLimiter *rateLimiter
+	// codec encodes the connection's envelopes, nil for JSON
+	codec   Codec
+	writeMu sync.Mutex
+	queue   *sendQueue
+	// compressed is set when the connection negotiated permessage-deflate;
+	// frames below compressThreshold bytes are sent uncompressed
+	compressed        bool
+	compressThreshold int
+	// writeTimeout bounds each data frame write; zero means no deadline
+	writeTimeout time.Duration
+	// left is closed once the connection's read loop has ended
+	left chan struct{}
+	// dropErr is the write error that got the connection dropped, guarded
+	// by sessionManagerMu
+	dropErr error
+	// closed tells how the connection ended, see recordClose
+	closeMu sync.Mutex
+	closed  *CloseInfo
+	// muted is set by MuteClient; ownerCandidate by WithSessionOwners
+	// for a designated owner
+	muted          int32
+	ownerCandidate bool
+	// publicKey is published for WithEndToEndEncryption
+	publicKey string
+
+	resumeToken string
+	resumed     *resumeSlot
+
+	// read-side deadlines, owned by the read loop
+	keepaliveDeadline time.Time
+	idleDeadline      time.Time
+	// rateDropped counts the messages rate limited in a row
+	rateDropped int
+
+	delivered  uint64
+	acked      uint64
+	missedAcks int
+	// ackDeadlines are the delivered messages awaiting their ack, oldest
+	// first, and ackTimer fires at the first deadline, see WithAckPolicy
+	ackDeadlines []ackDeadline
+	ackTimer     *time.Timer
+
+	// qosSeq numbers the BroadcastQoS messages written to the connection;
+	// pending holds the unacknowledged ones
+	qosSeq  uint64
+	pending map[uint64]*pendingDelivery
+
+	// spanCtx holds the connection's trace context, see ClientContext
+	spanCtx atomic.Value
+
+	// coalesce batches text frames, see WithCoalescing
+	coalesce *coalescer
+}
+
+func newClient(conn *websocket.Conn, identity string, tags []string) *client {
+	cl := &client{
+		conn:     conn,
+		addr:     conn.RemoteAddr().String(),
+		identity: identity,
+		role:     RoleParticipant,
+		tags:     map[string]struct{}{},
+		blocked:  map[string]struct{}{},
+		channels: map[string]struct{}{},
+		left:     make(chan struct{}),
+	}
+	cl.lastActive = time.Now().UnixNano()
+	for _, tag := range tags {
+		cl.tags[tag] = struct{}{}
+	}
+	return cl
+}
+
+// write sends a data frame to cl. gorilla/websocket allows one writer per
+// connection at a time, so every data frame goes through writeMu; control
+// frames use WriteControl, which is safe to call concurrently. With a send
+// queue the frame is only queued, and a connection that overflows it is
+// closed, with a close frame if its slow consumer policy disconnected it.
+// With coalescing, text frames are held for the next batch.
+func (cl *client) write(messageType int, data []byte) error {
+	messageType, data = cl.encodeFrame(messageType, data)
+	if cl.coalesce != nil {
+		if messageType == websocket.TextMessage {
+			cl.coalesce.hold(data)
+			return nil
+		}
+		return cl.coalesce.writeThrough(messageType, data)
+	}
+	return cl.send(messageType, data)
+}
+
+// send is write for a frame already encoded.
+func (cl *client) send(messageType int, data []byte) error {
+	if cl.queue != nil {
+		if cl.queue.push(messageType, append([]byte{}, data...)) {
+			cl.queue.close()
+			if code := cl.queue.slowCloseCode(); code != 0 {
+				message := websocket.FormatCloseMessage(code, "slow consumer")
+				cl.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+			}
+			cl.conn.Close()
+		}
+		return nil
+	}
+	cl.writeMu.Lock()
+	defer cl.writeMu.Unlock()
+	return cl.writeFrame(messageType, data)
+}
+
+// writeFrame writes a data frame within the write timeout. The caller must
+// hold writeMu.
+func (cl *client) writeFrame(messageType int, data []byte) error {
+	if cl.writeTimeout > 0 {
+		cl.conn.SetWriteDeadline(time.Now().Add(cl.writeTimeout))
+	}
+	cl.setWriteCompression(len(data))
+	return cl.conn.WriteMessage(messageType, data)
+}
+
+type session struct {
+	key        string
+	clients    []*client
+	createdAt  time.Time
+	lastUsed   time.Time
+	broadcasts uint64
+	bytes      uint64
+	rejected   uint64
+	// received and receivedBytes count inbound data messages, peak the
+	// most connections held at once
+	received      uint64
+	receivedBytes uint64
+	peak          int
+	banned        map[string]struct{}
+	// bannedAddrs and bannedIDs map remote IPs and client IDs to the end
+	// of their ban, the zero time for none
+	bannedAddrs map[string]time.Time
+	bannedIDs   map[string]time.Time
+	// seen holds the message IDs seen by dedup key, see WithInboundDedup,
+	// and seenSwept when expired ones were last removed
+	seen        map[string]map[string]time.Time
+	seenSwept   time.Time
+	audit       []AuditEntry
+	history     []historyEntry
+	parked      map[string]*resumeSlot
+	metadata    map[string]interface{}
+	// tags are set by SetSessionTags
+	tags map[string]struct{}
+	// includeSender echoes broadcasts back to their sender
+	includeSender bool
+	// seq is the sequence number of the last broadcast
+	seq uint64
+	// expiresAt is when a session warned under WithExpiryWarning is
+	// removed, and warnedFor its lastUsed at the time
+	expiresAt time.Time
+	warnedFor time.Time
+	// owner is the client ID of the owner, see WithSessionOwners, and
+	// locked is set by LockSession
+	owner  string
+	locked bool
+	// scheduled holds the broadcasts waiting on the timer wheel
+	scheduled map[*scheduledBroadcast]struct{}
+	// streamHistory holds the history of each stream, see WithStream
+	streamHistory map[string][]historyEntry
+	// config overrides the manager's settings, see SessionConfig
+	config SessionConfig
+
+	messageRate rateEstimator
+	limiter     *rateLimiter
+}
+
+func newSession(key string) *session {
+	now := time.Now()
+	return &session{
+		key:         key,
+		clients:     []*client{},
+		createdAt:   now,
+		lastUsed:    now,
+		banned:      map[string]struct{}{},
+		bannedAddrs: map[string]time.Time{},
+		bannedIDs:   map[string]time.Time{},
+		seen:        map[string]map[string]time.Time{},
+		parked:      map[string]*resumeSlot{},
+	}
+}
+
 type SessionManager struct {
-	sessions         map[string][]*websocket.Conn
-	lastUsed         map[string]time.Time
-	currentTime      time.Time
-	sessionManagerMu sync.Mutex
+	sessions    map[string]*session
+	currentTime time.Time
+	// sessionManagerMu guards all session and connection state. Holding it
+	// exclusively covers every session; holding it shared only keeps the
+	// set of sessions from changing, and the state of a session also needs
+	// the lock of its shard, see lockSession. A caller that "must hold
+	// sessionManagerMu" holds either. Accessors that only read lock shared
+	// and return copies.
+	sessionManagerMu sync.RWMutex
+	shards           [sessionShards]sessionShard
+	// statsMu guards the manager-wide counters: metrics, lastActivity,
+	// peakConnections, the rate estimators and broadcastLatency, which
+	// sessions in different shards update at once
+	statsMu        sync.Mutex
+	handlers       sync.WaitGroup
+	shutDown       bool
+	done           chan struct{}
+	shutdownNotice string
+	// closeCodes overrides the server's close frames, see WithCloseCode
+	closeCodes map[CloseScenario]closeCode
+	// sessionOwners and isOwner are set by WithSessionOwners
+	sessionOwners bool
+	isOwner       func(sessionKey, identity string) bool
+	// subscriptionsMu guards subscriptions, the in-process subscribers of
+	// each session's messages, see SubscribeMessages
+	subscriptionsMu sync.Mutex
+	subscriptions   map[string]map[*subscription]struct{}
+	// timers fires scheduled broadcasts, see BroadcastAt; it is created
+	// with the first one
+	timers             *timerWheel
+	scheduleResolution time.Duration
+	// draining is set by StartDraining, which closes drained once the
+	// last connection has left; drainStatus and drainHost are set by
+	// WithDrainResponse
+	draining    bool
+	drained     chan struct{}
+	drainStatus int
+	drainHost   string
+	// duplicatePolicy and onDuplicate are set by WithDuplicatePolicy and
+	// WithOnDuplicate
+	duplicatePolicy DuplicatePolicy
+	onDuplicate     DuplicateFunc
+	// streams are the sub-endpoints registered with WithStream
+	streams map[string]*streamConfig
+	// endToEnd is set by WithEndToEndEncryption
+	endToEnd bool
+	// controlMessages is set by WithControlMessages
+	controlMessages bool
 
 	cronScheduler *gocron.Scheduler
 	maxAliveTime  time.Duration
+
+	preBroadcast        PreBroadcastFunc
+	preBroadcastMessage PreBroadcastMessageFunc
+	auth                AuthFunc
+	roles               RoleFunc
+	clientMetadata      ClientMetadataFunc
+	metrics             Metrics
+	metricsSessionLimit int
+	rateWindow          time.Duration
+	connectGraceTimeout time.Duration
+	idleConnTimeout     time.Duration
+	idleEvictTimeout    time.Duration
+	idleEvictWarning    time.Duration
+	writeTimeout        time.Duration
+	pingInterval        time.Duration
+	pongTimeout         time.Duration
+	maxMissedPongs      int
+	anonymousObserve    bool
+	presenceEvents      bool
+	announcements       bool
+	envelopeMode        bool
+	protocolMode        bool
+	codecs              []Codec
+	autoRegister        bool
+	maxSessions         int
+	maxTotalConnections int
+	limitPolicy         LimitPolicy
+	onLimit             LimitFunc
+	// startedAt, lastActivity and peakConnections feed Stats
+	startedAt       time.Time
+	lastActivity    time.Time
+	peakConnections int
+	logger          Logger
+	logLevel        LogLevel
+	tracer          Tracer
+
+	upgrader         websocket.Upgrader
+	compression      bool
+	compressionLevel int
+	// compressionThreshold is the smallest frame compressed, zero for all
+	compressionThreshold int
+	policyMu             sync.RWMutex
+	originChecker        func(*http.Request) bool
+	keyValidator         KeyValidator
+	keyLength            int
+	keyAlphabet          string
+	middlewares          []MessageMiddleware
+	connectHooks         []ConnectFunc
+	disconnectHooks      []DisconnectFunc
+	closeHooks           []CloseFunc
+	messageHooks         []MessageFunc
+	unknownSessionHooks  []UnknownSessionFunc
+	webhooks             *WebhookConfig
+	webhookQueue         chan WebhookEvent
+	auditSink            AuditSink
+	auditPayloads        bool
+	auditQueue           chan AuditEvent
+	auditStop            chan struct{}
+	auditStopOnce        sync.Once
+	auditDone            chan struct{}
+	envelopeHandlers     map[string]EnvelopeHandler
+	envelopeValidators   map[string]EnvelopeValidator
+
+	// sessionEventHooks are guarded by sessionManagerMu, see OnSessionEvent
+	sessionEventHooks []SessionEventFunc
+
+	unknownSessionPolicy UnknownSessionPolicy
+
+	// groups span sessions; connections leaving their session hold only
+	// its shard, so they also take groupsMu
+	groupsMu sync.Mutex
+	groups   map[string]map[*client]string
+
+	maxConnectionsPerSession int
+	closeWhenFull            bool
+	maxMessageSize           int64
+	historySize              int
+	historyMaxAge            time.Duration
+	historyTTLs              map[string]time.Duration
+	sequenceNumbers          bool
+
+	sendQueueDepth  int
+	sendQueuePolicy QueueFullPolicy
+	sendQueueGrace  int
+	// slowConsumerThreshold and slowConsumerPolicy are set by
+	// WithSlowConsumer; slowConsumers and slowConsumerDisconnects are
+	// updated atomically, as send queues count them without the lock
+	slowConsumerThreshold   time.Duration
+	slowConsumerPolicy      SlowConsumerPolicy
+	slowConsumers           uint64
+	slowConsumerDisconnects uint64
+	// coalesceWindow is set by WithCoalescing
+	coalesceWindow time.Duration
+	// broadcastWorkers bounds the parallel writes of a broadcast
+	broadcastWorkers int
+	kickBan          bool
+	kickBanDuration  time.Duration
+
+	resumeTTL        time.Duration
+	resumeBufferSize int
+	// affinityCookie names the signed cookie carrying the resume token
+	affinityCookie string
+	affinitySecret []byte
+	// sseStreams maps the publish tokens of open ServeSSE streams to them
+	sseMu      sync.Mutex
+	sseStreams map[string]*sseStream
+
+	connRateLimit    RateLimit
+	sessionRateLimit RateLimit
+	rateLimitAction  RateLimitAction
+	rateMaxDropped   int
+	// addrRateLimit is set by WithAddressRateLimit; addrLimiters holds the
+	// limiters of the addresses with open connections
+	addrRateLimit  RateLimit
+	addrLimitersMu sync.Mutex
+	addrLimiters   map[string]*addrLimiter
+	// trustedProxies is set by WithTrustedProxies, with the entries it could
+	// not parse in invalidProxies
+	trustedProxies []*net.IPNet
+	invalidProxies []string
+
+	deadLetter             func(DeadLetter)
+	maxOutboundMessageSize int
+
+	dedupWindow time.Duration
+	dedupID     MessageIDFunc
+
+	nameCollisionPolicy NameCollisionPolicy
+
+	auditEnabled    bool
+	auditMaxEntries int
+	auditMaxAge     time.Duration
+
+	ackTimeout   time.Duration
+	ackMaxMissed int
+
+	qosRetryInterval time.Duration
+	qosMaxRetries    int
+	// qosMessages numbers BroadcastQoS messages; it is updated atomically
+	qosMessages uint64
+
+	store        SessionStore
+	storeHistory bool
+	// storeMu orders flushes; storeDirty and storeDeletes, guarded by
+	// sessionManagerMu and storeMarkMu, hold the sessions to save or delete
+	storeMu      sync.Mutex
+	storeMarkMu  sync.Mutex
+	storeDirty   map[string]struct{}
+	storeDeletes map[string]struct{}
+	storeSignal  chan struct{}
+
+	backend            Backend
+	instanceID         string
+	unsubscribeBackend func()
+	// backendErr is why the backend subscription could not be made
+	backendErr error
+
+	// idGenerator and clientIDs are set by WithIDGenerator and
+	// WithClientIDs
+	idGenerator IDGenerator
+	clientIDs   ClientIDFunc
+
+	gcInterval time.Duration
+	gcTTL      time.Duration
+	stopGC     func()
+	onEvict    EvictFunc
+	// gcStopped and gcLastRun are guarded by sessionManagerMu, see Health
+	gcStopped bool
+	gcLastRun time.Time
+	// expiryWarning and expiryExtend are set by WithExpiryWarning
+	expiryWarning time.Duration
+	expiryExtend  bool
+
+	nextStreamID uint64
+	nextClientID uint64
+
+	messageRate  rateEstimator
+	byteRate     rateEstimator
+	evictionRate rateEstimator
+
+	broadcastLatency latencyHistogram
+}
+
+func CreateSessionManager(sessionKeys []string, opts ...Option) *SessionManager {
+	return CreateSessionManagerWithContext(context.Background(), sessionKeys, opts...)
 }
 
-func CreateSessionManager(sessionKeys []string) SessionManager {
-	sm := SessionManager{
-		sessions: map[string][]*websocket.Conn{},
-		lastUsed: map[string]time.Time{},
+// CreateSessionManagerWithContext is CreateSessionManager with a lifecycle
+// tied to ctx: once ctx is done the manager shuts down as if Shutdown had
+// been called, and every goroutine it started exits.
+func CreateSessionManagerWithContext(ctx context.Context, sessionKeys []string, opts ...Option) *SessionManager {
+	sm := &SessionManager{
+		done:                make(chan struct{}),
+		sessions:            map[string]*session{},
+		groups:              map[string]map[*client]string{},
+		metricsSessionLimit: defaultMetricsSessionLimit,
+		rateWindow:          defaultRateWindow,
+		pingInterval:        defaultPingInterval,
+		pongTimeout:         defaultPongTimeout,
+		compressionLevel:    defaultCompressionLevel,
+		logger:              stdLogger{},
+		tracer:              nopTracer{},
+		keyValidator:        DefaultKeyValidator,
+		keyLength:           DefaultKeyLength,
+		keyAlphabet:         DefaultKeyAlphabet,
 	}
 	for _, key := range sessionKeys {
-		sm.sessions[key] = []*websocket.Conn{}
-		sm.lastUsed[key] = time.Now()
+		sm.sessions[key] = newSession(key)
+	}
+	sm.upgrader = upgrader
+	sm.upgrader.CheckOrigin = sm.checkOrigin
+	for _, opt := range opts {
+		opt(sm)
+	}
+	if sm.logLevel > LogDebug {
+		sm.logger = leveledLogger{logger: sm.logger, level: sm.logLevel}
+	}
+	for _, proxy := range sm.invalidProxies {
+		sm.logger.Error("Invalid trusted proxy", "proxy", proxy)
+	}
+	if sm.compression {
+		sm.upgrader.EnableCompression = true
+	}
+	if sm.store != nil {
+		sm.storeDirty = map[string]struct{}{}
+		sm.storeDeletes = map[string]struct{}{}
+		sm.storeSignal = make(chan struct{}, 1)
+		sm.restoreSessions()
+		go sm.persistSessions()
+	}
+	if sm.webhooks != nil {
+		sm.webhookQueue = make(chan WebhookEvent, webhookQueueSize)
+		go sm.deliverWebhooks()
+	}
+	if sm.auditSink != nil {
+		sm.auditQueue = make(chan AuditEvent, auditQueueSize)
+		sm.auditStop = make(chan struct{})
+		sm.auditDone = make(chan struct{})
+		go sm.writeAudit()
 	}
 
 	sm.maxAliveTime = 24 * time.Hour
 	sm.currentTime = time.Now()
+	sm.startedAt = sm.currentTime
 	sm.cronScheduler = gocron.NewScheduler(time.UTC)
+	// GarbageCollectDaily moves currentTime on by a day, so the first run
+	// waits a day rather than ageing every session at start
 	_, _ = sm.cronScheduler.
 		Every(1).
 		Day().
+		WaitForSchedule().
 		Do(sm.GarbageCollectDaily)
 	sm.cronScheduler.StartAsync()
+	sm.subscribeBackend()
+	if sm.gcInterval > 0 {
+		sm.stopGC = sm.StartGC(sm.gcInterval, sm.gcTTL)
+	}
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				sm.Shutdown(context.Background())
+			case <-sm.done:
+			}
+		}()
+	}
 	return sm
 }
 
@@ -56,93 +553,595 @@ func (sm *SessionManager) GarbageCollectDaily() {
 	sm.sessionManagerMu.Lock()
 	defer sm.sessionManagerMu.Unlock()
 	sm.currentTime = sm.currentTime.Add(24 * time.Hour)
-	for key, _ := range sm.sessions {
-		lastTime, err := sm.GetLastUsedTime(key)
-		if err != nil {
-			panic(err)
-		}
-		aliveTime := sm.currentTime.Sub(lastTime)
+	for _, s := range sm.sessions {
+		aliveTime := sm.currentTime.Sub(s.lastUsed)
 		if aliveTime > sm.maxAliveTime {
 			// in-loop deletion safe in go
-			delete(sm.sessions, key)
-			delete(sm.lastUsed, key)
+			sm.expireLocked(s)
 		}
 	}
 }
 
 func (sm *SessionManager) GetSession(sessionKey string) ([]*websocket.Conn, error) {
-	session, ok := sm.sessions[sessionKey]
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
 	if !ok {
-		return session, errors.New(
-			fmt.Sprintf("Session %s not found", sessionKey),
-		)
+		return nil, sessionNotFound(sessionKey)
+	}
+	session := make([]*websocket.Conn, len(s.clients))
+	for i, cl := range s.clients {
+		session[i] = cl.conn
 	}
 	return session, nil
 }
 
 func (sm *SessionManager) GetLastUsedTime(sessionKey string) (time.Time, error) {
-	time, ok := sm.lastUsed[sessionKey]
+	sm.rlockSession(sessionKey)
+	defer sm.runlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
 	if !ok {
-		return time, errors.New(
-			fmt.Sprintf("Session %s last used time not found", sessionKey),
-		)
+		return time.Time{}, sessionNotFound(sessionKey)
 	}
-	return time, nil
+	return s.lastUsed, nil
 }
 
 func (sm *SessionManager) RegisterSession(sessionKey string) error {
+	return sm.registerSession(sessionKey, SessionConfig{})
+}
+
+func (sm *SessionManager) registerSession(sessionKey string, config SessionConfig) error {
+	if err := sm.validateKey(sessionKey); err != nil {
+		return err
+	}
 	sm.sessionManagerMu.Lock()
 	defer sm.sessionManagerMu.Unlock()
-	_, err := sm.GetSession(sessionKey)
-	if err == nil {
-		return errors.New(
-			fmt.Sprintf("Session %s already exists", sessionKey),
-		)
+	if sm.shutDown {
+		return ErrShutDown
+	}
+	if _, ok := sm.sessions[sessionKey]; ok {
+		return &SessionError{SessionKey: sessionKey, Err: ErrSessionExists}
 	}
-	sm.sessions[sessionKey] = []*websocket.Conn{}
+	if !sm.claimSessionRoomLocked(sessionKey) {
+		return ErrSessionLimitReached
+	}
+	sm.sessions[sessionKey] = newSession(sessionKey)
+	sm.sessions[sessionKey].configure(config)
+	sm.markStoredLocked(sessionKey, false)
+	sm.webhookLocked(WebhookSessionCreated, sm.sessions[sessionKey])
+	return nil
+}
 
-	_, err = sm.GetLastUsedTime(sessionKey)
-	if err == nil {
-		return errors.New(
-			fmt.Sprintf("Session %s last used time already exists", sessionKey),
-		)
+// RemoveSession deletes the session and closes each of its connections with
+// a normal closure. Connections dialing the key afterwards are rejected
+// unless the key is registered again, in which case they join a new session.
+func (sm *SessionManager) RemoveSession(sessionKey string) error {
+	sm.sessionManagerMu.Lock()
+	defer sm.sessionManagerMu.Unlock()
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return sessionNotFound(sessionKey)
 	}
-	sm.lastUsed[sessionKey] = time.Now()
+	sm.removeSessionLocked(s, websocket.CloseNormalClosure, "session removed")
+	sm.markStoredLocked(sessionKey, true)
 	return nil
 }
 
+// removeSessionLocked deletes s from the manager and closes its connections
+// with code and reason. The caller must hold sessionManagerMu.
+func (sm *SessionManager) removeSessionLocked(s *session, code int, reason string) {
+	delete(sm.sessions, s.key)
+	sm.endSubscriptions(s.key)
+	sm.cancelScheduledLocked(s)
+	for _, cl := range s.clients {
+		sm.leaveGroupsLocked(cl)
+		sm.closeClient(cl, code, reason)
+	}
+	sm.statsMu.Lock()
+	sm.metrics.Disconnects += uint64(len(s.clients))
+	sm.statsMu.Unlock()
+	s.clients = []*client{}
+	sm.drainCheckLocked()
+}
+
 func (sm *SessionManager) AddConnection(sessionKey string, ws *websocket.Conn) error {
+	cl := newClient(ws, "", nil)
+	cl.id = sm.newClientID()
+	return sm.addClient(sessionKey, cl)
+}
+
+// WithAutoRegister creates sessions on demand when a connection dials a key
+// that is not registered, instead of rejecting it, as ad-hoc "share this
+// link" apps want. The key must still pass SetKeyValidator, and
+// WithMaxSessions caps how many sessions can be created this way.
+// Auto-registered sessions are collected like any other once idle.
+func WithAutoRegister(enabled bool) Option {
+	return func(sm *SessionManager) {
+		sm.autoRegister = enabled
+	}
+}
+
+// addClient joins cl to its session. A refused connection gets a
+// *ClientError wrapping why, such as ErrSessionLocked. Only the shard of
+// the session is locked, unless joining may register the session or evict
+// a connection of another one.
+func (sm *SessionManager) addClient(sessionKey string, cl *client) error {
+	sm.lockSession(sessionKey)
+	if _, ok := sm.sessions[sessionKey]; (ok || !sm.autoRegister) && sm.maxTotalConnections <= 0 {
+		defer sm.unlockSession(sessionKey)
+		return sm.addClientLocked(sessionKey, cl)
+	}
+	sm.unlockSession(sessionKey)
 	sm.sessionManagerMu.Lock()
 	defer sm.sessionManagerMu.Unlock()
-	if session, ok := sm.sessions[sessionKey]; ok {
-		sm.sessions[sessionKey] = append(session, ws)
-		return nil
+	return sm.addClientLocked(sessionKey, cl)
+}
+
+// addClientLocked is addClient for a caller holding sessionManagerMu,
+// exclusively if sessionKey may be registered or the total connection cap
+// applies.
+func (sm *SessionManager) addClientLocked(sessionKey string, cl *client) error {
+	if sm.draining {
+		return refusal(sessionKey, cl, ErrDraining)
+	}
+	if _, ok := sm.sessions[sessionKey]; !ok && sm.autoRegister && !sm.shutDown {
+		if !sm.claimSessionRoomLocked(sessionKey) {
+			return refusal(sessionKey, cl, ErrSessionLimitReached)
+		}
+		sm.sessions[sessionKey] = newSession(sessionKey)
+		sm.markStoredLocked(sessionKey, false)
+		sm.webhookLocked(WebhookSessionCreated, sm.sessions[sessionKey])
+	}
+	if s, ok := sm.sessions[sessionKey]; ok {
+		if s.isBanned(cl.identity) {
+			return &ClientError{SessionKey: sessionKey, ClientID: cl.id, Identity: cl.identity, Err: ErrBanned}
+		}
+		if s.locked && cl.resumed == nil && !cl.ownerCandidate {
+			return refusal(sessionKey, cl, ErrSessionLocked)
+		}
+		if err := sm.resolveDuplicateLocked(s, cl); err != nil {
+			return refusal(sessionKey, cl, err)
+		}
+		name, err := sm.resolveNameLocked(s, cl.name)
+		if err != nil {
+			return refusal(sessionKey, cl, err)
+		}
+		if s.isFull(sm.maxClientsLocked(s)) {
+			s.rejected++
+			return refusal(sessionKey, cl, ErrClientLimitReached)
+		}
+		if !sm.claimConnectionRoomLocked(sessionKey) {
+			return refusal(sessionKey, cl, ErrConnectionLimitReached)
+		}
+		cl.name = name
+		cl.joinedAt = time.Now()
+		s.clients = append(s.clients, cl)
+		s.lastUsed = cl.joinedAt
+		sm.thresholdWebhooksLocked(s, len(s.clients)-1)
+		if len(s.clients) > s.peak {
+			s.peak = len(s.clients)
+		}
+		sm.statsMu.Lock()
+		sm.metrics.Connects++
+		if open := sm.openConnectionsLocked(); open > sm.peakConnections {
+			sm.peakConnections = open
+		}
+		sm.statsMu.Unlock()
+		sm.logger.Debug("Client joined", "session", sessionKey, "client", cl.id, "connections", len(s.clients))
+		sm.presenceLocked(s, "join", cl)
+		sm.recordAudit(auditEventOf(AuditJoin, sessionKey, cl))
+		sm.claimOwnershipLocked(s, cl)
+		sm.exchangeKeysLocked(s, cl)
+		if cl.name != "" {
+			if err := sm.sendWelcomeLocked(s, cl); err != nil {
+				return err
+			}
+		}
+		return sm.replayLocked(s, cl)
 	} else {
-		return errors.New(
-			fmt.Sprintf("Session %s does not exist", sessionKey),
-		)
+		return sessionNotFound(sessionKey)
+	}
+}
+
+// refusal returns the error refusing cl a place in sessionKey.
+func refusal(sessionKey string, cl *client, err error) error {
+	return &ClientError{SessionKey: sessionKey, ClientID: cl.id, Err: err}
+}
+
+// removeClient drops cl from the session if it is still a member.
+func (sm *SessionManager) removeClient(sessionKey string, cl *client) {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return
+	}
+	sm.removeClientLocked(s, cl)
+}
+
+// removeClientLocked drops cl from s and its groups and tells the rest of
+// the session it left. The caller must hold sessionManagerMu.
+func (sm *SessionManager) removeClientLocked(s *session, cl *client) {
+	if !s.removeClient(cl) {
+		return
+	}
+	sm.thresholdWebhooksLocked(s, len(s.clients)+1)
+	if len(s.clients) == 0 {
+		sm.webhookLocked(WebhookSessionEmpty, s)
+	}
+	sm.leaveGroupsLocked(cl)
+	sm.failPendingLocked(s, cl)
+	sm.statsMu.Lock()
+	sm.metrics.Disconnects++
+	sm.statsMu.Unlock()
+	sm.logger.Debug("Client left", "session", s.key, "client", cl.id, "connections", len(s.clients))
+	sm.presenceLocked(s, "leave", cl)
+	sm.passOwnershipLocked(s, cl)
+	sm.drainCheckLocked()
+}
+
+// dropClientLocked removes a connection whose write failed with err from
+// the session and closes it, which ends its read loop; the disconnect hooks
+// then see err. The caller must hold sessionManagerMu.
+func (sm *SessionManager) dropClientLocked(s *session, cl *client, err error) {
+	if cl.dropErr == nil {
+		cl.dropErr = err
+		sm.statsMu.Lock()
+		sm.metrics.WriteFailures++
+		sm.statsMu.Unlock()
 	}
+	sm.removeClientLocked(s, cl)
+	cl.conn.Close()
 }
 
-func (sm *SessionManager) Broadcast(sessionKey string, senderAddr string, message []byte) error {
+// removeClient drops cl from the session and reports whether it was a
+// member.
+func (s *session) removeClient(cl *client) bool {
+	for i, member := range s.clients {
+		if member == cl {
+			s.clients = append(s.clients[:i], s.clients[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SetTags replaces the tags of the connection with clientID in the given session.
+func (sm *SessionManager) SetTags(sessionKey string, clientID string, tags []string) error {
 	sm.sessionManagerMu.Lock()
 	defer sm.sessionManagerMu.Unlock()
-	session, err := sm.GetSession(sessionKey)
+	cl, err := sm.findClient(sessionKey, clientID)
 	if err != nil {
 		return err
 	}
+	cl.tags = map[string]struct{}{}
+	for _, tag := range tags {
+		cl.tags[tag] = struct{}{}
+	}
+	return nil
+}
 
-	for _, c := range session {
-		receiverAddr := c.RemoteAddr().String()
-		if receiverAddr == senderAddr {
-			continue
+func (sm *SessionManager) findClient(sessionKey string, clientID string) (*client, error) {
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return nil, sessionNotFound(sessionKey)
+	}
+	for _, cl := range s.clients {
+		if cl.id == clientID {
+			return cl, nil
 		}
-		err := c.WriteMessage(1, message)
+	}
+	return nil, clientNotFound(sessionKey, clientID)
+}
+
+// Broadcast sends data as a messageType frame to every connection in the
+// session except the sender. It returns how many connections the frame was
+// written to, and an error for each write that failed; the connections that
+// failed are removed from the session and closed. An unknown session is
+// reported as the only error. With a backend the broadcast is also
+// published to the other instances, and a failed publish is reported too.
+// IncludeSender echoes the frame back to the sender as well, and Exclude
+// leaves out the given connections. Application code announces to everyone
+// with SystemSender as the sender.
+func (sm *SessionManager) Broadcast(sessionKey string, senderID string, messageType int, data []byte, opts ...BroadcastOption) (recipients int, errs []error) {
+	options := broadcastOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	recipients, errs, published, publish := sm.broadcastAll(sessionKey, senderID, messageType, data, options)
+	if publish {
+		if err := sm.publish(sessionKey, senderID, messageType, published); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return recipients, errs
+}
+
+// broadcastAll is the local part of Broadcast. publish reports whether the
+// broadcast went out and published should be handed to the backend.
+func (sm *SessionManager) broadcastAll(sessionKey string, senderID string, messageType int, data []byte, options broadcastOptions) (recipients int, errs []error, published []byte, publish bool) {
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return 0, []error{sessionNotFound(sessionKey)}, nil, false
+	}
+	match := options.match()
+	published, allow := sm.hookBroadcastLocked(s, senderID, messageType, data)
+	if !allow {
+		return 0, nil, nil, false
+	}
+	messageType, data = sm.acceptBroadcastLocked(s, nil, "", senderID, messageType, published, match)
+	recipients, failed, writeErrs := sm.deliverLocked(s, senderID, messageType, data, match)
+	if sender, err := sm.findClient(sessionKey, senderID); err == nil && options.includeSender && !s.includeSender && !options.exclude[senderID] {
+		written, err := sm.writeFrameLocked(s, sender, messageType, data)
 		if err != nil {
-			return err
+			failed = append(failed, sender)
+			writeErrs = append(writeErrs, err)
+		} else if written {
+			recipients++
+		}
+	}
+	for i, cl := range failed {
+		errs = append(errs, &ClientError{SessionKey: sessionKey, ClientID: cl.id, Op: "write", Err: writeErrs[i]})
+		sm.dropClientLocked(s, cl, writeErrs[i])
+	}
+	return recipients, errs, published, true
+}
+
+// deliverLocked writes a prepared broadcast to every recipient that
+// matches, carrying on past failed writes. It returns the number of frames
+// written and the connections whose writes failed, with their errors. The
+// caller must hold sessionManagerMu.
+func (sm *SessionManager) deliverLocked(s *session, senderID string, messageType int, message []byte, match func(*client) bool) (int, []*client, []error) {
+	defer sm.observeBroadcastLocked(time.Now())
+	recipients := s.recipients(senderID, match)
+	span := sm.startBroadcastSpanLocked(s, senderID, len(recipients))
+	if sm.broadcastWorkers > 1 && len(recipients) > 1 {
+		delivered, failed, errs := sm.fanOutLocked(s, recipients, messageType, message)
+		endBroadcastSpan(span, delivered, errs)
+		return delivered, failed, errs
+	}
+	delivered := 0
+	failed := []*client{}
+	errs := []error{}
+	defer func() {
+		endBroadcastSpan(span, delivered, errs)
+	}()
+	for _, cl := range recipients {
+		written, err := sm.writeFrameLocked(s, cl, messageType, message)
+		if err != nil {
+			failed = append(failed, cl)
+			errs = append(errs, err)
+			continue
+		}
+		if written {
+			delivered++
+		}
+	}
+	return delivered, failed, errs
+}
+
+// BroadcastMessage is Broadcast with an explicit frame type, so binary
+// payloads reach recipients as binary frames. With a backend the broadcast
+// is also published to the other instances; each runs it through its own
+// pre-broadcast hook.
+func (sm *SessionManager) BroadcastMessage(sessionKey string, senderID string, messageType int, message []byte) error {
+	sm.lockSession(sessionKey)
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		sm.unlockSession(sessionKey)
+		return sessionNotFound(sessionKey)
+	}
+	message, allow := sm.hookBroadcastLocked(s, senderID, messageType, message)
+	var err error
+	if allow {
+		err = sm.sendLocked(s, senderID, messageType, message, nil)
+	}
+	sm.unlockSession(sessionKey)
+	if !allow {
+		return nil
+	}
+	if publishErr := sm.publish(sessionKey, senderID, messageType, message); err == nil {
+		err = publishErr
+	}
+	return err
+}
+
+// BroadcastToTagExpr sends message to every connection in the session whose
+// tags satisfy expr, e.g. "team:red AND NOT observer". Tags are combined with
+// AND, OR and NOT (case-insensitive) and may be grouped with parentheses.
+// An invalid expression is reported without sending anything.
+func (sm *SessionManager) BroadcastToTagExpr(sessionKey, senderID, expr, message string) error {
+	parsed, err := parseTagExpr(expr)
+	if err != nil {
+		return err
+	}
+	sm.lockSession(sessionKey)
+	defer sm.unlockSession(sessionKey)
+	return sm.broadcastLocked(sessionKey, senderID, websocket.TextMessage, []byte(message), func(cl *client) bool {
+		return parsed.eval(cl.tags)
+	})
+}
+
+// broadcastLocked writes message as a messageType frame to every connection
+// in the session other than the sender for which match returns true. A nil
+// match selects all.
+// The caller must hold sessionManagerMu.
+func (sm *SessionManager) broadcastLocked(sessionKey string, senderID string, messageType int, message []byte, match func(*client) bool) error {
+	s, ok := sm.sessions[sessionKey]
+	if !ok {
+		return sessionNotFound(sessionKey)
+	}
+	message, allow := sm.hookBroadcastLocked(s, senderID, messageType, message)
+	if !allow {
+		return nil
+	}
+	return sm.sendLocked(s, senderID, messageType, message, match)
+}
+
+// sendLocked is broadcastLocked for a message that already passed the
+// pre-broadcast hooks, here or on the instance that published it. The
+// caller must hold sessionManagerMu.
+func (sm *SessionManager) sendLocked(s *session, senderID string, messageType int, message []byte, match func(*client) bool) error {
+	messageType, message = sm.acceptBroadcastLocked(s, nil, "", senderID, messageType, message, match)
+	_, failed, errs := sm.deliverLocked(s, senderID, messageType, message, match)
+	for i, cl := range failed {
+		sm.dropClientLocked(s, cl, errs[i])
+	}
+	return newBroadcastError(failed, errs)
+}
+
+// prepareBroadcastLocked runs a broadcast through the pre-broadcast hook and
+// records it in the session counters, audit log and history. It returns the
+// frame to write, or allow=false if the hook vetoed it. The caller must hold
+// sessionManagerMu.
+func (sm *SessionManager) prepareBroadcastLocked(s *session, senderID string, messageType int, message []byte, match func(*client) bool) (int, []byte, bool) {
+	return sm.prepareStreamBroadcastLocked(s, nil, "", senderID, messageType, message, match)
+}
+
+// prepareStreamBroadcastLocked is prepareBroadcastLocked for a broadcast
+// to stream, recorded in the history of the stream rather than that of the
+// session when c, its configuration, is not nil. The caller must hold
+// sessionManagerMu.
+func (sm *SessionManager) prepareStreamBroadcastLocked(s *session, c *streamConfig, stream string, senderID string, messageType int, message []byte, match func(*client) bool) (int, []byte, bool) {
+	message, allow := sm.hookBroadcastLocked(s, senderID, messageType, message)
+	if !allow {
+		return 0, nil, false
+	}
+	messageType, message = sm.acceptBroadcastLocked(s, c, stream, senderID, messageType, message, match)
+	return messageType, message, true
+}
+
+// hookBroadcastLocked runs a broadcast through the pre-broadcast hooks and
+// returns the message they leave, or allow=false if one vetoed it. The
+// caller must hold sessionManagerMu.
+func (sm *SessionManager) hookBroadcastLocked(s *session, senderID string, messageType int, message []byte) ([]byte, bool) {
+	if sm.preBroadcastMessage != nil {
+		newMsg, allow := sm.preBroadcastMessage(s.key, senderID, messageType, message)
+		if !allow {
+			sm.countVeto()
+			return nil, false
 		}
+		message = newMsg
 	}
+	if sm.preBroadcast != nil {
+		newMsg, allow := sm.preBroadcast(s.key, senderID, string(message))
+		if !allow {
+			sm.countVeto()
+			return nil, false
+		}
+		message = []byte(newMsg)
+	}
+	return message, true
+}
 
-	sm.lastUsed[sessionKey] = time.Now()
+// acceptBroadcastLocked records a broadcast the hooks let through, as
+// prepareStreamBroadcastLocked, and returns the frame to write. The caller
+// must hold sessionManagerMu.
+func (sm *SessionManager) acceptBroadcastLocked(s *session, c *streamConfig, stream string, senderID string, messageType int, message []byte, match func(*client) bool) (int, []byte) {
+	senderIdentity := s.identityOf(senderID)
+	now := time.Now()
+	sm.recordBroadcastLocked(s, now)
+	sm.auditLocked(s, senderID, senderIdentity, message, now)
+	seq := sm.nextSeqLocked(s)
+	sm.auditBroadcast(s, senderID, senderIdentity, messageType, message, now, seq)
+	if c != nil {
+		sm.recordStreamHistoryLocked(s, c, stream, senderID, messageType, message, match, now, seq)
+	} else {
+		sm.recordHistoryLocked(s, senderID, messageType, message, match, now, seq)
+	}
+	sm.publishMessage(Message{SessionKey: s.key, SenderID: senderID, MessageType: messageType, Data: message, At: now, Seq: seq})
+	messageType, message = sm.wrapEnvelope(senderID, messageType, message, now, seq)
+	sm.bufferMissedLocked(s, senderID, messageType, message, match)
+	s.lastUsed = now
+	return messageType, message
+}
+
+// client returns the connection with clientID, or nil if there is none.
+func (s *session) client(clientID string) *client {
+	for _, cl := range s.clients {
+		if cl.id == clientID {
+			return cl
+		}
+	}
 	return nil
 }
+
+// identityOf returns the identity of the connection with clientID, or an
+// empty identity if there is none.
+func (s *session) identityOf(clientID string) string {
+	for _, cl := range s.clients {
+		if cl.id == clientID {
+			return cl.identity
+		}
+	}
+	return ""
+}
+
+// recipients returns the connections a broadcast from senderID reaches:
+// everyone that matches and has not blocked the sender, leaving out the
+// sender itself unless the session includes it.
+func (s *session) recipients(senderID string, match func(*client) bool) []*client {
+	senderIdentity := s.identityOf(senderID)
+	recipients := []*client{}
+	for _, cl := range s.clients {
+		if cl.id == senderID && !s.includeSender {
+			continue
+		}
+		if cl.role == RolePublisher {
+			continue
+		}
+		if match != nil && !match(cl) {
+			continue
+		}
+		if cl.hasBlocked(senderIdentity) {
+			continue
+		}
+		recipients = append(recipients, cl)
+	}
+	return recipients
+}
+
+// writeLocked delivers message to a single connection of session s and
+// records it in the session and manager counters. It reports whether the
+// message was written; oversized messages are dropped without an error.
+// The caller must hold sessionManagerMu.
+func (sm *SessionManager) writeLocked(s *session, cl *client, message []byte) (bool, error) {
+	return sm.writeFrameLocked(s, cl, websocket.TextMessage, message)
+}
+
+func (sm *SessionManager) writeFrameLocked(s *session, cl *client, messageType int, message []byte) (bool, error) {
+	if sm.oversizedLocked(s, cl, message) {
+		return false, nil
+	}
+	return sm.wroteLocked(s, cl, message, cl.write(messageType, message))
+}
+
+// oversizedLocked dead-letters message for cl if it is over the outbound
+// size limit and reports whether it did.
+func (sm *SessionManager) oversizedLocked(s *session, cl *client, message []byte) bool {
+	if sm.maxOutboundMessageSize > 0 && len(message) > sm.maxOutboundMessageSize {
+		sm.deadLetterLocked(s, cl, message, DeadLetterSizeExceeded)
+		return true
+	}
+	return false
+}
+
+// wroteLocked records the outcome err of writing message to cl.
+func (sm *SessionManager) wroteLocked(s *session, cl *client, message []byte, err error) (bool, error) {
+	if err != nil {
+		sm.logger.Warn("Write failed", "session", s.key, "client", cl.id, "err", err)
+		sm.deadLetterLocked(s, cl, message, DeadLetterWriteFailed)
+		return false, err
+	}
+	cl.markActive()
+	cl.delivered++
+	sm.trackAckLocked(s, cl)
+	s.bytes += uint64(len(message))
+	sm.statsMu.Lock()
+	sm.metrics.BytesRelayed += uint64(len(message))
+	sm.byteRate.observeN(time.Now(), sm.rateWindow, float64(len(message)))
+	sm.statsMu.Unlock()
+	return true, nil
+}
@@ -2,8 +2,13 @@ package ws_manager
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -19,7 +24,7 @@ type WSManagerTestSuite struct {
 	wsUrl       string
 	port        int
 	sessionKey  string
-	manager     SessionManager
+	manager     *SessionManager
 	session     []*websocket.Conn
 	e           *echo.Echo
 	testMessage string
@@ -31,10 +36,18 @@ type wsResponseAggregator struct {
 }
 
 func (w *wsResponseAggregator) GetData() map[string]string {
-	return w.data
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	data := map[string]string{}
+	for k, v := range w.data {
+		data[k] = v
+	}
+	return data
 }
 
-func listen(conn *websocket.Conn, agg wsResponseAggregator) {
+// listen records the latest message conn receives under the client ID
+// the manager assigned to it.
+func listen(conn *websocket.Conn, clientID string, agg *wsResponseAggregator) {
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
@@ -42,9 +55,77 @@ func listen(conn *websocket.Conn, agg wsResponseAggregator) {
 			return
 		}
 		agg.mu.Lock()
-		defer agg.mu.Unlock()
-		agg.data[conn.LocalAddr().String()] = string(message)
+		agg.data[clientID] = string(message)
+		agg.mu.Unlock()
+	}
+}
+
+// dialSession connects to sessionKey on an httptest server running the
+// manager's EchoHandler, appending query to the URL.
+func dialSession(server *httptest.Server, sessionKey string, query string) (*websocket.Conn, error) {
+	conn, _, err := dialSessionWithHeader(server, sessionKey, query, nil)
+	return conn, err
+}
+
+// dialSessionWithID is dialSession that also returns the client ID the
+// manager assigned to the connection.
+func dialSessionWithID(server *httptest.Server, sessionKey string, query string) (*websocket.Conn, string, error) {
+	conn, resp, err := dialSessionWithHeader(server, sessionKey, query, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return conn, resp.Header.Get(ClientIDHeader), nil
+}
+
+// dialSessionAs connects with an X-Identity header for use with headerAuth.
+func dialSessionAs(server *httptest.Server, sessionKey string, identity string) (*websocket.Conn, *http.Response, error) {
+	header := http.Header{}
+	header.Set("X-Identity", identity)
+	return dialSessionWithHeader(server, sessionKey, "", header)
+}
+
+func dialSessionWithHeader(server *httptest.Server, sessionKey string, query string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/" + sessionKey
+	if query != "" {
+		url += "?" + query
+	}
+	return websocket.DefaultDialer.Dial(url, header)
+}
+
+// headerAuth identifies callers by their X-Identity header.
+func headerAuth(sessionKey string, r *http.Request) (string, error) {
+	identity := r.Header.Get("X-Identity")
+	if identity == "" {
+		return "", errors.New("missing identity")
+	}
+	return identity, nil
+}
+
+// waitForConnections polls until the session holds n connections, since the
+// handler registers a client only after the handshake completes.
+func waitForConnections(sm *SessionManager, sessionKey string, n int) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		sm.sessionManagerMu.Lock()
+		count := -1
+		if s, ok := sm.sessions[sessionKey]; ok {
+			count = len(s.clients)
+		}
+		sm.sessionManagerMu.Unlock()
+		if count == n {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
+	return false
+}
+
+// readWithTimeout returns the next message on conn, or an error if none
+// arrives within d.
+func readWithTimeout(conn *websocket.Conn, d time.Duration) (string, error) {
+	conn.SetReadDeadline(time.Now().Add(d))
+	_, message, err := conn.ReadMessage()
+	return string(message), err
 }
 
 /*-------------------Setups/Teardowns-------------------*/
@@ -57,7 +138,9 @@ func (suite *WSManagerTestSuite) SetupSuite() {
 	suite.manager = CreateSessionManager([]string{})
 
 	suite.e = echo.New()
-	suite.e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.e.GET("/:sessionKey", func(c echo.Context) error {
+		return suite.manager.EchoHandler(c)
+	})
 
 	go func() {
 		suite.e.Start(fmt.Sprintf(":%d", suite.port))
@@ -93,10 +176,9 @@ func (suite *WSManagerTestSuite) TestSessionManagerConstructor() {
 
 func (suite *WSManagerTestSuite) TestClientNotAddedIfSessionNotRegistered() {
 	dialer := websocket.Dialer{}
-	_, _, err := dialer.Dial(suite.wsUrl, nil)
-	if err != nil {
-		panic(err)
-	}
+	_, resp, err := dialer.Dial(suite.wsUrl, nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
 
 	_, err = suite.manager.GetSession(suite.sessionKey)
 	assert.EqualError(
@@ -129,21 +211,22 @@ func (suite *WSManagerTestSuite) TestDoesNotBroadcastToSelf() {
 	assert.NoError(suite.T(), err)
 
 	dialer1 := websocket.Dialer{}
-	conn1, _, err := dialer1.Dial(suite.wsUrl, nil)
+	conn1, resp1, err := dialer1.Dial(suite.wsUrl, nil)
 	if err != nil {
 		panic(err)
 	}
+	id1 := resp1.Header.Get(ClientIDHeader)
 
 	responseData := wsResponseAggregator{
 		data: map[string]string{},
 	}
 
-	go listen(conn1, responseData)
+	go listen(conn1, id1, &responseData)
 
 	conn1.WriteMessage(1, []byte(suite.testMessage))
 	time.Sleep(2 * time.Second)
 
-	assert.Equal(suite.T(), "", responseData.GetData()[conn1.LocalAddr().String()])
+	assert.Equal(suite.T(), "", responseData.GetData()[id1])
 }
 
 func (suite *WSManagerTestSuite) TestOneToManyBroadcast() {
@@ -152,19 +235,19 @@ func (suite *WSManagerTestSuite) TestOneToManyBroadcast() {
 
 	// add multiple connections
 	dialer1 := websocket.Dialer{}
-	conn1, _, err := dialer1.Dial(suite.wsUrl, nil)
+	conn1, resp1, err := dialer1.Dial(suite.wsUrl, nil)
 	if err != nil {
 		panic(err)
 	}
 
 	dialer2 := websocket.Dialer{}
-	conn2, _, err := dialer2.Dial(suite.wsUrl, nil)
+	conn2, resp2, err := dialer2.Dial(suite.wsUrl, nil)
 	if err != nil {
 		panic(err)
 	}
 
 	dialer3 := websocket.Dialer{}
-	conn3, _, err := dialer3.Dial(suite.wsUrl, nil)
+	conn3, resp3, err := dialer3.Dial(suite.wsUrl, nil)
 	if err != nil {
 		panic(err)
 	}
@@ -175,19 +258,234 @@ func (suite *WSManagerTestSuite) TestOneToManyBroadcast() {
 	}
 
 	// listen on all three connections
-	go listen(conn1, responseData)
-	go listen(conn2, responseData)
-	go listen(conn3, responseData)
+	id1 := resp1.Header.Get(ClientIDHeader)
+	id2 := resp2.Header.Get(ClientIDHeader)
+	id3 := resp3.Header.Get(ClientIDHeader)
+	go listen(conn1, id1, &responseData)
+	go listen(conn2, id2, &responseData)
+	go listen(conn3, id3, &responseData)
 
 	// test broadcast
 	conn1.WriteMessage(1, []byte(suite.testMessage))
-	//suite.manager.Broadcast(suite.sessionKey, conn1.LocalAddr().String(), suite.testMessage)
 	time.Sleep(2 * time.Second)
 
 	log.Println("RESPONSES:", responseData.GetData())
 
-	assert.Equal(suite.T(), suite.testMessage, responseData.GetData()[conn2.LocalAddr().String()])
-	assert.Equal(suite.T(), suite.testMessage, responseData.GetData()[conn3.LocalAddr().String()])
+	assert.Equal(suite.T(), suite.testMessage, responseData.GetData()[id2])
+	assert.Equal(suite.T(), suite.testMessage, responseData.GetData()[id3])
+}
+
+func (suite *WSManagerTestSuite) TestBroadcastReportsRecipientsAndFailures() {
+	err := suite.manager.RegisterSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+
+	dialer := websocket.Dialer{}
+	_, senderResp, err := dialer.Dial(suite.wsUrl, nil)
+	if err != nil {
+		panic(err)
+	}
+	healthy, _, err := dialer.Dial(suite.wsUrl, nil)
+	if err != nil {
+		panic(err)
+	}
+	_, brokenResp, err := dialer.Dial(suite.wsUrl, nil)
+	if err != nil {
+		panic(err)
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 3))
+	senderID := senderResp.Header.Get(ClientIDHeader)
+	brokenID := brokenResp.Header.Get(ClientIDHeader)
+
+	suite.manager.sessionManagerMu.Lock()
+	broken, err := suite.manager.findClient(suite.sessionKey, brokenID)
+	suite.manager.sessionManagerMu.Unlock()
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), broken.conn.UnderlyingConn().(*net.TCPConn).CloseWrite())
+
+	recipients, errs := suite.manager.Broadcast(suite.sessionKey, senderID, websocket.TextMessage, []byte(suite.testMessage))
+	assert.Equal(suite.T(), 1, recipients)
+	if assert.Len(suite.T(), errs, 1) {
+		assert.Contains(suite.T(), errs[0].Error(), "Write to "+brokenID+" failed")
+	}
+	message, err := readWithTimeout(healthy, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), suite.testMessage, message)
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	_, errs = suite.manager.Broadcast("missing", "", websocket.TextMessage, []byte(suite.testMessage))
+	assert.Len(suite.T(), errs, 1)
+}
+
+func (suite *WSManagerTestSuite) TestConcurrentBroadcastsAreDelivered() {
+	err := suite.manager.RegisterSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+
+	clients := 8
+	perClient := 50
+	dialer := websocket.Dialer{}
+	conns := make([]*websocket.Conn, clients)
+	for i := range conns {
+		conns[i], _, err = dialer.Dial(suite.wsUrl, nil)
+		if err != nil {
+			panic(err)
+		}
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, clients))
+
+	var received sync.WaitGroup
+	counts := make([]int, clients)
+	for i, conn := range conns {
+		received.Add(1)
+		go func(i int, conn *websocket.Conn) {
+			defer received.Done()
+			for counts[i] < (clients-1)*perClient {
+				if _, err := readWithTimeout(conn, 2*time.Second); err != nil {
+					return
+				}
+				counts[i]++
+			}
+		}(i, conn)
+	}
+
+	var sent sync.WaitGroup
+	for _, conn := range conns {
+		sent.Add(1)
+		go func(conn *websocket.Conn) {
+			defer sent.Done()
+			for j := 0; j < perClient; j++ {
+				conn.WriteMessage(websocket.TextMessage, []byte(suite.testMessage))
+			}
+		}(conn)
+	}
+	sent.Wait()
+	received.Wait()
+
+	for i := range conns {
+		assert.Equal(suite.T(), (clients-1)*perClient, counts[i])
+	}
+}
+
+func (suite *WSManagerTestSuite) TestBroadcastPreservesBinaryFrames() {
+	err := suite.manager.RegisterSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+
+	dialer := websocket.Dialer{}
+	sender, _, err := dialer.Dial(suite.wsUrl, nil)
+	if err != nil {
+		panic(err)
+	}
+	receiver, _, err := dialer.Dial(suite.wsUrl, nil)
+	if err != nil {
+		panic(err)
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	payload := []byte{0x00, 0xff, 0x10, 0x80}
+	sender.WriteMessage(websocket.BinaryMessage, payload)
+
+	receiver.SetReadDeadline(time.Now().Add(time.Second))
+	messageType, message, err := receiver.ReadMessage()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), websocket.BinaryMessage, messageType)
+	assert.Equal(suite.T(), payload, message)
+}
+
+func (suite *WSManagerTestSuite) TestClosedClientIsRemoved() {
+	err := suite.manager.RegisterSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+
+	dialer := websocket.Dialer{}
+	leaving, _, err := dialer.Dial(suite.wsUrl, nil)
+	if err != nil {
+		panic(err)
+	}
+	staying, _, err := dialer.Dial(suite.wsUrl, nil)
+	if err != nil {
+		panic(err)
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	staying.WriteMessage(websocket.TextMessage, []byte(suite.testMessage))
+	message, err := readWithTimeout(leaving, time.Second)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), suite.testMessage, message)
+
+	leaving.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+	session, err := suite.manager.GetSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), session, 1)
+}
+
+func (suite *WSManagerTestSuite) TestRemoveSessionClosesConnections() {
+	err := suite.manager.RegisterSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+
+	dialer := websocket.Dialer{}
+	conn, _, err := dialer.Dial(suite.wsUrl, nil)
+	if err != nil {
+		panic(err)
+	}
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 1))
+
+	err = suite.manager.RemoveSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+
+	_, err = readWithTimeout(conn, time.Second)
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.CloseNormalClosure))
+
+	_, err = suite.manager.GetSession(suite.sessionKey)
+	assert.EqualError(suite.T(), err, fmt.Sprintf("Session %s not found", suite.sessionKey))
+	_, err = suite.manager.GetLastUsedTime(suite.sessionKey)
+	assert.Error(suite.T(), err)
+	err = suite.manager.RemoveSession(suite.sessionKey)
+	assert.EqualError(suite.T(), err, fmt.Sprintf("Session %s not found", suite.sessionKey))
+}
+
+func (suite *WSManagerTestSuite) TestDialAfterRemoveSessionIsRejected() {
+	err := suite.manager.RegisterSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), suite.manager.RemoveSession(suite.sessionKey))
+
+	dialer := websocket.Dialer{}
+	_, resp, err := dialer.Dial(suite.wsUrl, nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+func (suite *WSManagerTestSuite) TestCloseSessionWaitsForAcks() {
+	err := suite.manager.RegisterSession(suite.sessionKey)
+	assert.NoError(suite.T(), err)
+
+	dialer := websocket.Dialer{}
+	polite, _, err := dialer.Dial(suite.wsUrl, nil)
+	assert.NoError(suite.T(), err)
+	silent, resp, err := dialer.Dial(suite.wsUrl, nil)
+	assert.NoError(suite.T(), err)
+	defer silent.Close()
+	assert.True(suite.T(), waitForConnections(suite.manager, suite.sessionKey, 2))
+
+	// reading answers the close frame; the silent peer never reads
+	closed := make(chan error, 1)
+	go func() {
+		_, _, err := polite.ReadMessage()
+		closed <- err
+	}()
+
+	err = suite.manager.CloseSession(suite.sessionKey, websocket.CloseGoingAway, "maintenance")
+	var closeErr *CloseError
+	if assert.ErrorAs(suite.T(), err, &closeErr) {
+		assert.Len(suite.T(), closeErr.Failures, 1)
+		assert.Contains(suite.T(), closeErr.Failures, resp.Header.Get(ClientIDHeader))
+	}
+	err = <-closed
+	assert.True(suite.T(), websocket.IsCloseError(err, websocket.CloseGoingAway))
+	assert.Equal(suite.T(), "maintenance", err.(*websocket.CloseError).Text)
+
+	_, err = suite.manager.GetSession(suite.sessionKey)
+	assert.Error(suite.T(), err)
+	err = suite.manager.CloseSession(suite.sessionKey, websocket.CloseNormalClosure, "")
+	assert.EqualError(suite.T(), err, fmt.Sprintf("Session %s not found", suite.sessionKey))
 }
 
 /*-------------------Test Runner------------------------*/
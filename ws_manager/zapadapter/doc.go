@@ -0,0 +1,6 @@
+// Package zapadapter routes ws_manager diagnostics to zap. It is a module
+// of its own, so the ws_manager module does not require zap of applications
+// that do not use it:
+//
+//	go get github.com/chau-t-tran/ws-to-me/ws_manager/zapadapter
+package zapadapter
@@ -0,0 +1,34 @@
+package zapadapter
+
+import (
+	"github.com/chau-t-tran/ws-to-me/ws_manager"
+	"go.uber.org/zap"
+)
+
+// New returns a ws_manager.Logger writing to logger, with the key/value
+// pairs of each call as fields:
+//
+//	sm := ws_manager.CreateSessionManager(keys, ws_manager.WithLogger(zapadapter.New(logger)))
+func New(logger *zap.Logger) ws_manager.Logger {
+	return sugared{logger.WithOptions(zap.AddCallerSkip(1)).Sugar()}
+}
+
+type sugared struct {
+	logger *zap.SugaredLogger
+}
+
+func (l sugared) Debug(msg string, keysAndValues ...interface{}) {
+	l.logger.Debugw(msg, keysAndValues...)
+}
+
+func (l sugared) Info(msg string, keysAndValues ...interface{}) {
+	l.logger.Infow(msg, keysAndValues...)
+}
+
+func (l sugared) Warn(msg string, keysAndValues ...interface{}) {
+	l.logger.Warnw(msg, keysAndValues...)
+}
+
+func (l sugared) Error(msg string, keysAndValues ...interface{}) {
+	l.logger.Errorw(msg, keysAndValues...)
+}
@@ -0,0 +1,48 @@
+package zapadapter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type ZapTestSuite struct {
+	suite.Suite
+	logs *observer.ObservedLogs
+	core zapcore.Core
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *ZapTestSuite) SetupTest() {
+	suite.core, suite.logs = observer.New(zapcore.InfoLevel)
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *ZapTestSuite) TestFieldsAndLevels() {
+	logger := New(zap.New(suite.core))
+	logger.Debug("Client joined", "session", "abcdefgh")
+	logger.Warn("Write failed", "session", "abcdefgh", "err", errors.New("broken pipe"))
+
+	entries := suite.logs.All()
+	if assert.Len(suite.T(), entries, 1) {
+		assert.Equal(suite.T(), zapcore.WarnLevel, entries[0].Level)
+		assert.Equal(suite.T(), "Write failed", entries[0].Message)
+		assert.Equal(suite.T(), map[string]interface{}{
+			"session": "abcdefgh",
+			"err":     "broken pipe",
+		}, entries[0].ContextMap())
+	}
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestZapTestSuite(t *testing.T) {
+	suite.Run(t, new(ZapTestSuite))
+}
@@ -0,0 +1,6 @@
+// Package zerologadapter routes ws_manager diagnostics to zerolog. It is a
+// module of its own, so the ws_manager module does not require zerolog of
+// applications that do not use it:
+//
+//	go get github.com/chau-t-tran/ws-to-me/ws_manager/zerologadapter
+package zerologadapter
@@ -0,0 +1,56 @@
+package zerologadapter
+
+import (
+	"fmt"
+
+	"github.com/chau-t-tran/ws-to-me/ws_manager"
+	"github.com/rs/zerolog"
+)
+
+// New returns a ws_manager.Logger writing to logger, with the key/value
+// pairs of each call as fields:
+//
+//	sm := ws_manager.CreateSessionManager(keys, ws_manager.WithLogger(zerologadapter.New(logger)))
+func New(logger zerolog.Logger) ws_manager.Logger {
+	return adapter{logger}
+}
+
+type adapter struct {
+	logger zerolog.Logger
+}
+
+func (l adapter) Debug(msg string, keysAndValues ...interface{}) {
+	send(l.logger.Debug(), msg, keysAndValues)
+}
+
+func (l adapter) Info(msg string, keysAndValues ...interface{}) {
+	send(l.logger.Info(), msg, keysAndValues)
+}
+
+func (l adapter) Warn(msg string, keysAndValues ...interface{}) {
+	send(l.logger.Warn(), msg, keysAndValues)
+}
+
+func (l adapter) Error(msg string, keysAndValues ...interface{}) {
+	send(l.logger.Error(), msg, keysAndValues)
+}
+
+// send adds the key/value pairs to event and writes it. A disabled level
+// gives a nil event, on which every call is a no-op.
+func send(event *zerolog.Event, msg string, keysAndValues []interface{}) {
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		if err, ok := keysAndValues[i+1].(error); ok {
+			event = event.AnErr(key, err)
+		} else {
+			event = event.Interface(key, keysAndValues[i+1])
+		}
+	}
+	if len(keysAndValues)%2 == 1 {
+		event = event.Interface("!BADKEY", keysAndValues[len(keysAndValues)-1])
+	}
+	event.Msg(msg)
+}
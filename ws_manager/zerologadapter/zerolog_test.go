@@ -0,0 +1,47 @@
+package zerologadapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ZerologTestSuite struct {
+	suite.Suite
+	out bytes.Buffer
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *ZerologTestSuite) SetupTest() {
+	suite.out.Reset()
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *ZerologTestSuite) TestFieldsAndLevels() {
+	logger := New(zerolog.New(&suite.out).Level(zerolog.InfoLevel))
+	logger.Debug("Client joined", "session", "abcdefgh")
+	logger.Warn("Write failed", "session", "abcdefgh", "connections", 2, "err", errors.New("broken pipe"))
+
+	var entry map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(suite.out.Bytes(), &entry))
+	assert.Equal(suite.T(), map[string]interface{}{
+		"level":       "warn",
+		"message":     "Write failed",
+		"session":     "abcdefgh",
+		"connections": float64(2),
+		"err":         "broken pipe",
+	}, entry)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestZerologTestSuite(t *testing.T) {
+	suite.Run(t, new(ZerologTestSuite))
+}
@@ -0,0 +1,477 @@
+// Package wsclient is a Go client for sessions served by ws_manager. It
+// dials a session, reconnects when the connection drops, keeps it alive
+// with pings, and speaks the manager's protocol mode envelopes.
+package wsclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// clientIDHeader and resumeTokenHeader match the upgrade response
+	// headers of ws_manager.
+	clientIDHeader    = "X-Client-Id"
+	resumeTokenHeader = "X-Resume-Token"
+
+	defaultMinReconnectDelay = 100 * time.Millisecond
+	defaultMaxReconnectDelay = 10 * time.Second
+	defaultBufferSize        = 64
+)
+
+// ErrNotConnected is returned by sends while the client is reconnecting.
+var ErrNotConnected = errors.New("Not connected")
+
+// ErrClosed is returned by sends after Close or once the client has
+// stopped reconnecting.
+var ErrClosed = errors.New("Client is closed")
+
+// Envelope is the JSON frame exchanged with a ws_manager server in
+// protocol mode. Timestamp is in Unix milliseconds.
+type Envelope struct {
+	Type       string          `json:"type"`
+	Sender     string          `json:"sender"`
+	SessionKey string          `json:"sessionKey"`
+	Timestamp  int64           `json:"timestamp"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	Replayed   bool            `json:"replayed,omitempty"`
+	Seq        uint64          `json:"seq,omitempty"`
+}
+
+// Decode unmarshals the payload of env into v.
+func (env Envelope) Decode(v interface{}) error {
+	return json.Unmarshal(env.Payload, v)
+}
+
+// Message is a data frame received from the session.
+type Message struct {
+	Type int
+	Data []byte
+}
+
+// Envelope decodes msg as an envelope.
+func (msg Message) Envelope() (Envelope, error) {
+	var env Envelope
+	err := json.Unmarshal(msg.Data, &env)
+	return env, err
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHeader sends header with every dial, e.g. for authentication.
+func WithHeader(header http.Header) Option {
+	return func(c *Client) {
+		c.header = header
+	}
+}
+
+// WithQuery adds query to the session URL of every dial, e.g. a name or
+// tags.
+func WithQuery(query url.Values) Option {
+	return func(c *Client) {
+		c.query = query
+	}
+}
+
+// WithDialer dials with dialer instead of websocket.DefaultDialer.
+func WithDialer(dialer *websocket.Dialer) Option {
+	return func(c *Client) {
+		c.dialer = dialer
+	}
+}
+
+// WithReconnect sets the delay before redialing a dropped connection. It
+// starts at min and doubles after each failed attempt up to max. A
+// non-positive min disables reconnecting. The defaults are 100ms and 10s.
+func WithReconnect(min, max time.Duration) Option {
+	return func(c *Client) {
+		c.minDelay = min
+		c.maxDelay = max
+	}
+}
+
+// WithHeartbeat pings the server every interval and treats the connection
+// as dropped when nothing, not even a ping or pong, arrives for timeout.
+// The server's pings are always answered.
+func WithHeartbeat(interval, timeout time.Duration) Option {
+	return func(c *Client) {
+		c.pingInterval = interval
+		c.pongTimeout = timeout
+	}
+}
+
+// WithOnMessage calls fn for every message received instead of delivering
+// it on Messages. It runs on the read goroutine; the client reads nothing
+// else until it returns.
+func WithOnMessage(fn func(Message)) Option {
+	return func(c *Client) {
+		c.onMessage = fn
+	}
+}
+
+// WithOnConnect calls fn after every successful dial, including the first,
+// with the connection's client ID.
+func WithOnConnect(fn func(clientID string)) Option {
+	return func(c *Client) {
+		c.onConnect = fn
+	}
+}
+
+// WithOnDisconnect calls fn whenever the connection drops, with the error
+// that ended it.
+func WithOnDisconnect(fn func(err error)) Option {
+	return func(c *Client) {
+		c.onDisconnect = fn
+	}
+}
+
+// WithBufferSize sets how many received messages Messages buffers. The
+// default is 64; when the buffer is full the client stops reading.
+func WithBufferSize(size int) Option {
+	return func(c *Client) {
+		c.bufferSize = size
+	}
+}
+
+// WithEnvelopeValidator makes SendEnvelope check envelopes of envelopeType
+// with validate and return its error instead of sending them, mirroring a
+// server-side validator so invalid messages fail before they leave.
+func WithEnvelopeValidator(envelopeType string, validate func(Envelope) error) Option {
+	return func(c *Client) {
+		if c.validators == nil {
+			c.validators = map[string]func(Envelope) error{}
+		}
+		c.validators[envelopeType] = validate
+	}
+}
+
+// Client is a connection to one session. Its methods are safe for
+// concurrent use.
+type Client struct {
+	url    string
+	header http.Header
+	query  url.Values
+	dialer *websocket.Dialer
+
+	minDelay     time.Duration
+	maxDelay     time.Duration
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	bufferSize   int
+
+	onMessage    func(Message)
+	onConnect    func(string)
+	onDisconnect func(error)
+	validators   map[string]func(Envelope) error
+
+	messages chan Message
+	done     chan struct{}
+	stopped  chan struct{}
+
+	mu          sync.Mutex
+	writeMu     sync.Mutex
+	conn        *websocket.Conn
+	id          string
+	resumeToken string
+	closed      bool
+}
+
+// Connect dials sessionKey on the ws_manager server at baseURL, e.g.
+// "ws://localhost:5000", and keeps the connection up until Close. Only the
+// first dial's error is returned; later drops are redialed in the
+// background.
+func Connect(baseURL, sessionKey string, opts ...Option) (*Client, error) {
+	c := &Client{
+		url:        strings.TrimSuffix(baseURL, "/") + "/" + url.PathEscape(sessionKey),
+		dialer:     websocket.DefaultDialer,
+		minDelay:   defaultMinReconnectDelay,
+		maxDelay:   defaultMaxReconnectDelay,
+		bufferSize: defaultBufferSize,
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.messages = make(chan Message, c.bufferSize)
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	go c.run(conn)
+	return c, nil
+}
+
+// ID returns the client ID the server assigned to the current connection.
+// A resumed connection keeps its ID.
+func (c *Client) ID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.id
+}
+
+// Messages returns the received messages. It is closed once the client
+// stops for good, after Close or a drop it does not reconnect from. It is
+// not used with WithOnMessage.
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+// Done is closed once the client has stopped.
+func (c *Client) Done() <-chan struct{} {
+	return c.stopped
+}
+
+// Send sends data as a text frame.
+func (c *Client) Send(data []byte) error {
+	return c.write(websocket.TextMessage, data)
+}
+
+// SendBinary sends data as a binary frame.
+func (c *Client) SendBinary(data []byte) error {
+	return c.write(websocket.BinaryMessage, data)
+}
+
+// SendEnvelope sends an envelope of envelopeType with payload encoded as
+// JSON. The server fills in the sender, session key and timestamp. See
+// WithEnvelopeValidator.
+func (c *Client) SendEnvelope(envelopeType string, payload interface{}) error {
+	env := Envelope{Type: envelopeType}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		env.Payload = data
+	}
+	if validate, ok := c.validators[envelopeType]; ok {
+		if err := validate(env); err != nil {
+			return err
+		}
+	}
+	frame, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return c.Send(frame)
+}
+
+// RequestSince asks the server to resend the broadcasts numbered after seq,
+// for servers running with sequence numbers and history. Call it with the
+// last Seq seen when the numbers jump.
+func (c *Client) RequestSince(seq uint64) error {
+	return c.Send([]byte(fmt.Sprintf(`{"control":"since","seq":%d}`, seq)))
+}
+
+// Close closes the connection with a normal closure and stops
+// reconnecting. It waits for the read goroutine to finish.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		<-c.stopped
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	conn := c.conn
+	c.mu.Unlock()
+	var err error
+	if conn != nil {
+		message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		err = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		conn.Close()
+	}
+	<-c.stopped
+	return err
+}
+
+func (c *Client) write(messageType int, data []byte) error {
+	c.mu.Lock()
+	conn, closed := c.conn, c.closed
+	c.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	if conn == nil {
+		return ErrNotConnected
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return conn.WriteMessage(messageType, data)
+}
+
+// dial connects to the session, resuming the previous connection when the
+// server issued a resume token.
+func (c *Client) dial() (*websocket.Conn, error) {
+	query := url.Values{}
+	for key, values := range c.query {
+		query[key] = values
+	}
+	c.mu.Lock()
+	if c.resumeToken != "" {
+		query.Set("resume", c.resumeToken)
+	}
+	c.mu.Unlock()
+	target := c.url
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	conn, resp, err := c.dialer.Dial(target, c.header)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		conn.Close()
+		return nil, ErrClosed
+	}
+	c.conn = conn
+	c.id = resp.Header.Get(clientIDHeader)
+	c.resumeToken = resp.Header.Get(resumeTokenHeader)
+	id := c.id
+	c.mu.Unlock()
+	if c.onConnect != nil {
+		c.onConnect(id)
+	}
+	return conn, nil
+}
+
+// run reads conn and its successors until the client stops.
+func (c *Client) run(conn *websocket.Conn) {
+	defer close(c.stopped)
+	defer close(c.messages)
+	defer func() {
+		c.mu.Lock()
+		c.closed = true
+		c.mu.Unlock()
+	}()
+	for {
+		err := c.read(conn)
+		c.mu.Lock()
+		c.conn = nil
+		closed := c.closed
+		c.mu.Unlock()
+		conn.Close()
+		if closed {
+			return
+		}
+		if c.onDisconnect != nil {
+			c.onDisconnect(err)
+		}
+		if c.minDelay <= 0 || permanentClose(err) {
+			return
+		}
+		if conn = c.redial(); conn == nil {
+			return
+		}
+	}
+}
+
+// redial dials until it succeeds or the client is closed, backing off
+// between attempts.
+func (c *Client) redial() *websocket.Conn {
+	delay := c.minDelay
+	for {
+		select {
+		case <-c.done:
+			return nil
+		case <-time.After(delay):
+		}
+		conn, err := c.dial()
+		if err == nil {
+			return conn
+		}
+		if err == ErrClosed {
+			return nil
+		}
+		delay *= 2
+		if c.maxDelay > 0 && delay > c.maxDelay {
+			delay = c.maxDelay
+		}
+	}
+}
+
+// read delivers the messages of conn until it fails.
+func (c *Client) read(conn *websocket.Conn) error {
+	stopHeartbeat := c.startHeartbeat(conn)
+	defer stopHeartbeat()
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		c.extendDeadline(conn)
+		msg := Message{Type: messageType, Data: data}
+		if c.onMessage != nil {
+			c.onMessage(msg)
+			continue
+		}
+		select {
+		case c.messages <- msg:
+		case <-c.done:
+			return ErrClosed
+		}
+	}
+}
+
+// startHeartbeat pings conn every ping interval and arms its read deadline.
+// The returned function stops the pings.
+func (c *Client) startHeartbeat(conn *websocket.Conn) (stop func()) {
+	conn.SetPingHandler(func(data string) error {
+		c.extendDeadline(conn)
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+	conn.SetPongHandler(func(string) error {
+		c.extendDeadline(conn)
+		return nil
+	})
+	c.extendDeadline(conn)
+	if c.pingInterval <= 0 {
+		return func() {}
+	}
+	ticker := time.NewTicker(c.pingInterval)
+	quit := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.pingInterval)); err != nil {
+					return
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(quit)
+	}
+}
+
+func (c *Client) extendDeadline(conn *websocket.Conn) {
+	if c.pongTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(c.pongTimeout))
+	}
+}
+
+// permanentClose reports whether err is a close the server does not want
+// redialed: a normal closure or a policy violation such as a kick or ban.
+func permanentClose(err error) bool {
+	return websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.ClosePolicyViolation)
+}
@@ -0,0 +1,323 @@
+package wsclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chau-t-tran/ws-to-me/ws_manager"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ClientTestSuite struct {
+	suite.Suite
+	sessionKey string
+	manager    *ws_manager.SessionManager
+	server     *httptest.Server
+	url        string
+}
+
+/*-------------------Setups/Teardowns-------------------*/
+
+func (suite *ClientTestSuite) SetupTest() {
+	suite.sessionKey = "abcdefgh"
+}
+
+func (suite *ClientTestSuite) TearDownTest() {
+	if suite.server != nil {
+		suite.server.Close()
+		suite.manager.Shutdown(context.Background())
+		suite.server = nil
+	}
+}
+
+func (suite *ClientTestSuite) start(opts ...ws_manager.Option) {
+	suite.manager = ws_manager.CreateSessionManager([]string{suite.sessionKey}, opts...)
+	e := echo.New()
+	e.GET("/:sessionKey", suite.manager.EchoHandler)
+	suite.server = httptest.NewServer(e)
+	suite.url = "ws" + strings.TrimPrefix(suite.server.URL, "http")
+}
+
+// waitForClients polls the session until it has n connections.
+func (suite *ClientTestSuite) waitForClients(n int) []ws_manager.ClientInfo {
+	deadline := time.Now().Add(time.Second)
+	for {
+		clients, _ := suite.manager.GetClients(suite.sessionKey)
+		if len(clients) == n || time.Now().After(deadline) {
+			return clients
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func receive(c *Client) (Message, bool) {
+	select {
+	case msg, ok := <-c.Messages():
+		return msg, ok
+	case <-time.After(time.Second):
+		return Message{}, false
+	}
+}
+
+/*-------------------Tests------------------------------*/
+
+func (suite *ClientTestSuite) TestSendAndReceive() {
+	suite.start()
+	alice, err := Connect(suite.url, suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	defer alice.Close()
+	bob, err := Connect(suite.url, suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	defer bob.Close()
+	assert.NotEmpty(suite.T(), alice.ID())
+	suite.waitForClients(2)
+
+	assert.NoError(suite.T(), alice.Send([]byte("hello")))
+	msg, ok := receive(bob)
+	assert.True(suite.T(), ok)
+	assert.Equal(suite.T(), websocket.TextMessage, msg.Type)
+	assert.Equal(suite.T(), "hello", string(msg.Data))
+}
+
+func (suite *ClientTestSuite) TestEnvelopes() {
+	suite.start(ws_manager.WithProtocolMode(true))
+	alice, err := Connect(suite.url, suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	defer alice.Close()
+	bob, err := Connect(suite.url, suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	defer bob.Close()
+	suite.waitForClients(2)
+
+	assert.NoError(suite.T(), alice.SendEnvelope("chat", map[string]string{"text": "hi"}))
+	msg, ok := receive(bob)
+	assert.True(suite.T(), ok)
+	env, err := msg.Envelope()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "chat", env.Type)
+	assert.Equal(suite.T(), alice.ID(), env.Sender)
+	assert.Equal(suite.T(), suite.sessionKey, env.SessionKey)
+	var payload map[string]string
+	assert.NoError(suite.T(), env.Decode(&payload))
+	assert.Equal(suite.T(), "hi", payload["text"])
+}
+
+func (suite *ClientTestSuite) TestEnvelopeValidator() {
+	validate, err := ws_manager.JSONSchema([]byte(`{"type":"object","required":["text"]}`))
+	assert.NoError(suite.T(), err)
+	suite.start(ws_manager.WithProtocolMode(true), ws_manager.WithEnvelopeValidator("chat", validate))
+	errMissingText := errors.New("text is required")
+	alice, err := Connect(suite.url, suite.sessionKey, WithEnvelopeValidator("chat", func(env Envelope) error {
+		var payload map[string]string
+		if env.Decode(&payload) != nil || payload["text"] == "" {
+			return errMissingText
+		}
+		return nil
+	}))
+	assert.NoError(suite.T(), err)
+	defer alice.Close()
+	bob, err := Connect(suite.url, suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	defer bob.Close()
+	suite.waitForClients(2)
+
+	assert.Equal(suite.T(), errMissingText, alice.SendEnvelope("chat", map[string]string{}))
+	assert.NoError(suite.T(), bob.SendEnvelope("chat", map[string]string{}))
+	msg, ok := receive(bob)
+	assert.True(suite.T(), ok)
+	env, err := msg.Envelope()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "error", env.Type)
+	assert.JSONEq(suite.T(), `{"error":"invalid message","messageType":"chat","reason":"payload.text is required"}`, string(env.Payload))
+}
+
+func (suite *ClientTestSuite) TestRequestSince() {
+	suite.start(ws_manager.WithProtocolMode(true), ws_manager.WithSequenceNumbers(true), ws_manager.WithHistorySize(10))
+	alice, err := Connect(suite.url, suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	defer alice.Close()
+	suite.waitForClients(1)
+	for i := 0; i < 3; i++ {
+		assert.NoError(suite.T(), suite.manager.BroadcastEnvelope(suite.sessionKey, "op", i))
+	}
+	for want := uint64(1); want <= 3; want++ {
+		msg, ok := receive(alice)
+		assert.True(suite.T(), ok)
+		env, err := msg.Envelope()
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), want, env.Seq)
+	}
+
+	assert.NoError(suite.T(), alice.RequestSince(1))
+	for want := uint64(2); want <= 3; want++ {
+		msg, ok := receive(alice)
+		assert.True(suite.T(), ok)
+		env, err := msg.Envelope()
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), want, env.Seq)
+		assert.True(suite.T(), env.Replayed)
+	}
+}
+
+func (suite *ClientTestSuite) TestReconnectsAfterDrop() {
+	suite.start()
+	var mu sync.Mutex
+	connects, disconnects := 0, 0
+	alice, err := Connect(suite.url, suite.sessionKey,
+		WithReconnect(10*time.Millisecond, 50*time.Millisecond),
+		WithOnConnect(func(string) {
+			mu.Lock()
+			connects++
+			mu.Unlock()
+		}),
+		WithOnDisconnect(func(error) {
+			mu.Lock()
+			disconnects++
+			mu.Unlock()
+		}),
+	)
+	assert.NoError(suite.T(), err)
+	defer alice.Close()
+	clients := suite.waitForClients(1)
+	if !assert.Len(suite.T(), clients, 1) {
+		return
+	}
+	clients[0].Conn.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		clients = suite.waitForClients(1)
+		if len(clients) == 1 && clients[0].ID != "" && clients[0].ID == alice.ID() || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	assert.Equal(suite.T(), 2, connects)
+	assert.Equal(suite.T(), 1, disconnects)
+	mu.Unlock()
+
+	bob, err := Connect(suite.url, suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	defer bob.Close()
+	suite.waitForClients(2)
+	assert.NoError(suite.T(), bob.Send([]byte("welcome back")))
+	msg, ok := receive(alice)
+	assert.True(suite.T(), ok)
+	assert.Equal(suite.T(), "welcome back", string(msg.Data))
+}
+
+func (suite *ClientTestSuite) TestKickIsNotRedialed() {
+	suite.start()
+	alice, err := Connect(suite.url, suite.sessionKey, WithReconnect(10*time.Millisecond, 50*time.Millisecond))
+	assert.NoError(suite.T(), err)
+	defer alice.Close()
+	suite.waitForClients(1)
+	assert.NoError(suite.T(), suite.manager.KickClient(suite.sessionKey, alice.ID(), "bye"))
+
+	select {
+	case <-alice.Done():
+	case <-time.After(time.Second):
+		suite.T().Fatal("client kept running after a kick")
+	}
+	_, ok := <-alice.Messages()
+	assert.False(suite.T(), ok)
+	assert.Equal(suite.T(), ErrClosed, alice.Send([]byte("late")))
+}
+
+func (suite *ClientTestSuite) TestOnMessageCallback() {
+	suite.start()
+	received := make(chan string, 1)
+	alice, err := Connect(suite.url, suite.sessionKey, WithOnMessage(func(msg Message) {
+		received <- string(msg.Data)
+	}))
+	assert.NoError(suite.T(), err)
+	defer alice.Close()
+	suite.waitForClients(1)
+
+	assert.NoError(suite.T(), suite.manager.BroadcastMessage(suite.sessionKey, "", websocket.TextMessage, []byte("announcement")))
+	select {
+	case msg := <-received:
+		assert.Equal(suite.T(), "announcement", msg)
+	case <-time.After(time.Second):
+		suite.T().Fatal("callback not called")
+	}
+}
+
+func (suite *ClientTestSuite) TestHeartbeatKeepsConnectionUp() {
+	suite.start()
+	dropped := make(chan error, 1)
+	alice, err := Connect(suite.url, suite.sessionKey,
+		WithHeartbeat(20*time.Millisecond, 100*time.Millisecond),
+		WithOnDisconnect(func(err error) { dropped <- err }),
+	)
+	assert.NoError(suite.T(), err)
+	defer alice.Close()
+	suite.waitForClients(1)
+	time.Sleep(300 * time.Millisecond)
+	assert.Len(suite.T(), dropped, 0)
+}
+
+func (suite *ClientTestSuite) TestHeartbeatDetectsDeadServer() {
+	// The server never reads, so it never answers pings.
+	upgrader := websocket.Upgrader{}
+	held := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err == nil {
+			held <- conn
+		}
+	}))
+	defer server.Close()
+	dropped := make(chan error, 1)
+	alice, err := Connect("ws"+strings.TrimPrefix(server.URL, "http"), suite.sessionKey,
+		WithReconnect(0, 0),
+		WithHeartbeat(20*time.Millisecond, 100*time.Millisecond),
+		WithOnDisconnect(func(err error) { dropped <- err }),
+	)
+	assert.NoError(suite.T(), err)
+	defer alice.Close()
+	conn := <-held
+	defer conn.Close()
+
+	select {
+	case <-dropped:
+	case <-time.After(time.Second):
+		suite.T().Fatal("dead connection not detected")
+	}
+	<-alice.Done()
+}
+
+func (suite *ClientTestSuite) TestCloseStopsClient() {
+	suite.start()
+	alice, err := Connect(suite.url, suite.sessionKey)
+	assert.NoError(suite.T(), err)
+	suite.waitForClients(1)
+	assert.NoError(suite.T(), alice.Close())
+	assert.Empty(suite.T(), suite.waitForClients(0))
+	_, ok := <-alice.Messages()
+	assert.False(suite.T(), ok)
+	assert.Equal(suite.T(), ErrClosed, alice.Send([]byte("late")))
+	assert.NoError(suite.T(), alice.Close())
+}
+
+func (suite *ClientTestSuite) TestConnectError() {
+	suite.start(ws_manager.WithAutoRegister(false))
+	_, err := Connect(suite.url, "missing")
+	assert.Error(suite.T(), err)
+}
+
+/*-------------------Test Runner------------------------*/
+
+func TestClientTestSuite(t *testing.T) {
+	suite.Run(t, new(ClientTestSuite))
+}